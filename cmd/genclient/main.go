@@ -0,0 +1,57 @@
+// Command genclient generates TypeScript and Python client stubs from the
+// gRPC service definition, and packages them for publishing.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	protoPath := flag.String("proto", "pkg/proto/user.proto", "path to the .proto file")
+	outDir := flag.String("out", "clients", "output directory for generated packages")
+	langs := flag.String("lang", "typescript,python", "comma-separated languages to generate (typescript, python)")
+	version := flag.String("version", "0.1.0", "package version")
+	flag.Parse()
+
+	api, err := parseProto(*protoPath)
+	if err != nil {
+		log.Fatalf("failed to parse %s: %v", *protoPath, err)
+	}
+
+	for _, lang := range strings.Split(*langs, ",") {
+		var files map[string]string
+		switch strings.TrimSpace(lang) {
+		case "typescript", "ts":
+			files = generateTypeScript(api, *version)
+			lang = "typescript"
+		case "python", "py":
+			files = generatePython(api, *version)
+			lang = "python"
+		default:
+			log.Fatalf("unsupported language %q", lang)
+		}
+
+		if err := writeFiles(filepath.Join(*outDir, lang), files); err != nil {
+			log.Fatalf("failed to write %s client: %v", lang, err)
+		}
+		log.Printf("generated %s client in %s", lang, filepath.Join(*outDir, lang))
+	}
+}
+
+// writeFiles writes generated files relative to dir
+func writeFiles(dir string, files map[string]string) error {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestNames(t *testing.T) {
+	tests := []struct {
+		convert func(string) string
+		in      string
+		want    string
+	}{
+		{lowerCamel, "missing_ids", "missingIds"},
+		{lowerCamel, "page_token", "pageToken"},
+		{lowerCamel, "name", "name"},
+		{lowerCamel, "trailing_", "trailing"},
+		{lowerFirst, "GetUser", "getUser"},
+		{lowerFirst, "", ""},
+		{snakeCase, "GetUsersByIDs", "get_users_by_ids"},
+		{snakeCase, "GetUserByID", "get_user_by_id"},
+		{snakeCase, "HTTPServer", "http_server"},
+		{snakeCase, "Sha256Sum", "sha256_sum"},
+		{snakeCase, "ListUsers", "list_users"},
+		{snakeCase, "setLogLevel", "set_log_level"},
+	}
+	for _, tt := range tests {
+		if got := tt.convert(tt.in); got != tt.want {
+			t.Errorf("convert(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
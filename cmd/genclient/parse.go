@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+
+	"github.com/emicklei/proto"
+)
+
+// apiSpec is the subset of a .proto file needed to generate clients
+type apiSpec struct {
+	Package  string
+	Messages []messageSpec
+	Services []serviceSpec
+}
+
+type messageSpec struct {
+	Name   string
+	Fields []fieldSpec
+}
+
+type fieldSpec struct {
+	Name     string
+	Type     string
+	Repeated bool
+	MapKey   string // non-empty for map fields
+}
+
+type serviceSpec struct {
+	Name    string
+	Methods []methodSpec
+}
+
+type methodSpec struct {
+	Name         string
+	Request      string
+	Response     string
+	StreamsReply bool
+}
+
+// parseProto reads the messages and services declared in a .proto file
+func parseProto(path string) (*apiSpec, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	definition, err := proto.NewParser(f).Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	api := &apiSpec{}
+	proto.Walk(definition,
+		proto.WithPackage(func(p *proto.Package) {
+			api.Package = p.Name
+		}),
+		proto.WithMessage(func(m *proto.Message) {
+			msg := messageSpec{Name: m.Name}
+			for _, element := range m.Elements {
+				switch field := element.(type) {
+				case *proto.NormalField:
+					msg.Fields = append(msg.Fields, fieldSpec{Name: field.Name, Type: field.Type, Repeated: field.Repeated})
+				case *proto.MapField:
+					msg.Fields = append(msg.Fields, fieldSpec{Name: field.Name, Type: field.Type, MapKey: field.KeyType})
+				}
+			}
+			api.Messages = append(api.Messages, msg)
+		}),
+		proto.WithService(func(s *proto.Service) {
+			svc := serviceSpec{Name: s.Name}
+			for _, element := range s.Elements {
+				if rpc, ok := element.(*proto.RPC); ok {
+					svc.Methods = append(svc.Methods, methodSpec{
+						Name:         rpc.Name,
+						Request:      rpc.RequestType,
+						Response:     rpc.ReturnsType,
+						StreamsReply: rpc.StreamsReturns,
+					})
+				}
+			}
+			api.Services = append(api.Services, svc)
+		}),
+	)
+
+	return api, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const fixture = `syntax = "proto3";
+
+package shop;
+
+import "google/protobuf/timestamp.proto";
+
+service OrderService {
+  rpc GetOrder(GetOrderRequest) returns (Order);
+  rpc WatchOrders(GetOrderRequest) returns (stream Order);
+}
+
+message GetOrderRequest {
+  uint32 id = 1;
+}
+
+message Order {
+  uint32 id = 1;
+  repeated string items = 2;
+  map<string, int64> quantities = 3;
+  google.protobuf.Timestamp placed_at = 4;
+}
+`
+
+func parseFixture(t *testing.T) *apiSpec {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "shop.proto")
+	if err := os.WriteFile(path, []byte(fixture), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	api, err := parseProto(path)
+	if err != nil {
+		t.Fatalf("parseProto: %v", err)
+	}
+	return api
+}
+
+func TestParseProto(t *testing.T) {
+	api := parseFixture(t)
+	want := &apiSpec{
+		Package: "shop",
+		Messages: []messageSpec{
+			{Name: "GetOrderRequest", Fields: []fieldSpec{{Name: "id", Type: "uint32"}}},
+			{Name: "Order", Fields: []fieldSpec{
+				{Name: "id", Type: "uint32"},
+				{Name: "items", Type: "string", Repeated: true},
+				{Name: "quantities", Type: "int64", MapKey: "string"},
+				{Name: "placed_at", Type: "google.protobuf.Timestamp"},
+			}},
+		},
+		Services: []serviceSpec{{Name: "OrderService", Methods: []methodSpec{
+			{Name: "GetOrder", Request: "GetOrderRequest", Response: "Order"},
+			{Name: "WatchOrders", Request: "GetOrderRequest", Response: "Order", StreamsReply: true},
+		}}},
+	}
+	if !reflect.DeepEqual(api, want) {
+		t.Fatalf("parseProto:\n got %+v\nwant %+v", api, want)
+	}
+
+	if _, err := parseProto(filepath.Join(t.TempDir(), "missing.proto")); err == nil {
+		t.Fatal("parseProto of a missing file: expected an error")
+	}
+
+	// The API's own definition parses, with every service
+	api, err := parseProto("../../pkg/proto/user.proto")
+	if err != nil || len(api.Services) != 3 {
+		t.Fatalf("parseProto(user.proto): %v, %d services", err, len(api.Services))
+	}
+}
+
+func TestGenerateClients(t *testing.T) {
+	api := parseFixture(t)
+
+	ts := generateTypeScript(api, "1.2.3")
+	py := generatePython(api, "1.2.3")
+	for name, tc := range map[string]struct {
+		files    map[string]string
+		source   string
+		contains []string
+		absent   string
+	}{
+		"typescript": {ts, "src/index.ts", []string{
+			"export interface Order {",
+			"  items?: string[];",
+			"  quantities?: Record<string, string>;",
+			"  placedAt?: string;",
+			`getOrder(request: GetOrderRequest): Promise<Order> {`,
+			`this.transport("/shop.OrderService/GetOrder", request)`,
+		}, "watchOrders"},
+		"python": {py, "shop_client/__init__.py", []string{
+			"class Order:",
+			"    items: List[str] = field(default_factory=list)",
+			"    quantities: Dict[str, int] = field(default_factory=dict)",
+			"    placed_at: Optional[str] = None",
+			"    def get_order(self, request: GetOrderRequest) -> Dict[str, Any]:",
+			`self._transport("/shop.OrderService/GetOrder", asdict(request))`,
+		}, "watch_orders"},
+	} {
+		source, ok := tc.files[tc.source]
+		if !ok {
+			t.Fatalf("%s: no %s among %d files", name, tc.source, len(tc.files))
+		}
+		for _, want := range tc.contains {
+			if !strings.Contains(source, want) {
+				t.Errorf("%s: missing %q in\n%s", name, want, source)
+			}
+		}
+		// Streaming methods need a transport the stubs don't define
+		if strings.Contains(source, tc.absent) {
+			t.Errorf("%s: generated the streaming method %s", name, tc.absent)
+		}
+	}
+
+	if !strings.Contains(ts["package.json"], `"version": "1.2.3"`) || !strings.Contains(py["pyproject.toml"], `version = "1.2.3"`) {
+		t.Fatal("package metadata without the version")
+	}
+}
+
+func TestWriteFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := writeFiles(dir, map[string]string{"src/index.ts": "export {};\n"}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "src", "index.ts")); err != nil || string(data) != "export {};\n" {
+		t.Fatalf("written file: %q, %v", data, err)
+	}
+}
@@ -0,0 +1,37 @@
+// Command gendashboard writes the example Grafana dashboard and the
+// Prometheus recording rules for the service's RED metrics.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/114windd/restapi/internal/metrics"
+)
+
+func main() {
+	outDir := flag.String("out", "monitoring", "output directory")
+	flag.Parse()
+
+	dashboard, err := metrics.Dashboard()
+	if err != nil {
+		log.Fatalf("failed to render dashboard: %v", err)
+	}
+	files := map[string][]byte{
+		"grafana-dashboard.json": dashboard,
+		"recording-rules.yml":    metrics.RecordingRulesYAML(),
+	}
+
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		log.Fatalf("failed to create %s: %v", *outDir, err)
+	}
+	for name, content := range files {
+		path := filepath.Join(*outDir, name)
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			log.Fatalf("failed to write %s: %v", path, err)
+		}
+		log.Printf("wrote %s", path)
+	}
+}
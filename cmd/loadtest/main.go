@@ -0,0 +1,193 @@
+// Command loadtest sends one of a few request scenarios to a running server
+// at a constant rate, reports the latency distribution, and exits non-zero
+// when the 95th or 99th percentile exceeds the scenario's baseline or too
+// many requests fail, so regressions in the handler path are caught:
+//
+//	go run ./cmd/loadtest -url http://localhost:8080 -scenario get-user -rate 200 -duration 30s
+//
+// The server's rate limits apply to the load as well; raise them with
+// RATE_LIMITS when testing throughput.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "REST API base URL")
+	name := flag.String("scenario", "get-user", "scenario to run: "+strings.Join(scenarioNames(), ", "))
+	rate := flag.Int("rate", 100, "requests per second")
+	duration := flag.Duration("duration", 30*time.Second, "how long to send requests")
+	workers := flag.Int("workers", 50, "requests in flight at most; ticks finding every worker busy are dropped")
+	p95 := flag.Duration("p95", 0, "95th percentile latency threshold (default: the scenario's baseline)")
+	p99 := flag.Duration("p99", 0, "99th percentile latency threshold (default: the scenario's baseline)")
+	maxErrors := flag.Float64("max-errors", 0.01, "fraction of failed or dropped requests tolerated")
+	flag.Parse()
+
+	sc, ok := scenarios[*name]
+	if !ok {
+		log.Fatalf("unknown scenario %q; expected one of %s", *name, strings.Join(scenarioNames(), ", "))
+	}
+	if *rate <= 0 || *workers <= 0 {
+		log.Fatal("-rate and -workers must be positive")
+	}
+	limits := sc.Baseline
+	if *p95 > 0 {
+		limits.P95 = *p95
+	}
+	if *p99 > 0 {
+		limits.P99 = *p99
+	}
+
+	ctx := context.Background()
+	api := &apiClient{
+		baseURL: strings.TrimSuffix(*baseURL, "/"),
+		http:    &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{MaxIdleConnsPerHost: *workers}},
+	}
+	next, err := sc.Setup(ctx, api)
+	if err != nil {
+		log.Fatalf("set up %s: %v", *name, err)
+	}
+
+	log.Printf("running %s (%s) at %d/s for %s", *name, sc.Description, *rate, *duration)
+	res := run(api.http, next, *rate, *workers, *duration)
+	res.report(os.Stdout, *name)
+	if failures := res.check(limits, *maxErrors); len(failures) > 0 {
+		fmt.Printf("FAIL: %s\n", strings.Join(failures, "; "))
+		os.Exit(1)
+	}
+	fmt.Printf("ok: p95 <= %s, p99 <= %s, errors <= %.2f%%\n", limits.P95, limits.P99, *maxErrors*100)
+}
+
+// result is the outcome of a run
+type result struct {
+	elapsed   time.Duration
+	latencies []time.Duration // of successful requests
+	errors    int             // failed requests and non-2xx responses
+	dropped   int             // requests not sent because every worker was busy
+	statuses  map[int]int
+}
+
+// run sends a request built by next every 1/rate seconds for duration
+func run(client *http.Client, next func() (*http.Request, error), rate, workers int, duration time.Duration) *result {
+	res := &result{statuses: make(map[int]int)}
+	var mu sync.Mutex
+	record := func(latency time.Duration, status int, failed bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if status != 0 {
+			res.statuses[status]++
+		}
+		if failed {
+			res.errors++
+			return
+		}
+		res.latencies = append(res.latencies, latency)
+	}
+
+	jobs := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				req, err := next()
+				if err != nil {
+					record(0, 0, true)
+					continue
+				}
+				start := time.Now()
+				resp, err := client.Do(req)
+				if err != nil {
+					record(0, 0, true)
+					continue
+				}
+				_, _ = io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				record(time.Since(start), resp.StatusCode, resp.StatusCode >= 300)
+			}
+		}()
+	}
+
+	start := time.Now()
+	ticker := time.NewTicker(time.Second / time.Duration(rate))
+	for time.Since(start) < duration {
+		<-ticker.C
+		select {
+		case jobs <- struct{}{}:
+		default:
+			res.dropped++
+		}
+	}
+	ticker.Stop()
+	close(jobs)
+	wg.Wait()
+	res.elapsed = time.Since(start)
+	return res
+}
+
+func (r *result) total() int {
+	return len(r.latencies) + r.errors + r.dropped
+}
+
+// percentile returns the latency below which p percent of successful
+// requests completed
+func (r *result) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(r.latencies))*p/100+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(r.latencies) {
+		i = len(r.latencies) - 1
+	}
+	return r.latencies[i]
+}
+
+func (r *result) report(w io.Writer, name string) {
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	total := r.total()
+	fmt.Fprintf(w, "%s: %d requests in %s (%.1f/s), %d errors, %d dropped\n",
+		name, total, r.elapsed.Round(time.Millisecond), float64(total)/r.elapsed.Seconds(), r.errors, r.dropped)
+	fmt.Fprintf(w, "latency p50=%s p90=%s p95=%s p99=%s max=%s\n",
+		r.percentile(50), r.percentile(90), r.percentile(95), r.percentile(99), r.percentile(100))
+
+	statuses := make([]int, 0, len(r.statuses))
+	for status := range r.statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	for _, status := range statuses {
+		fmt.Fprintf(w, "  %d: %d\n", status, r.statuses[status])
+	}
+}
+
+// check lists the thresholds the run exceeded
+func (r *result) check(limits thresholds, maxErrors float64) []string {
+	var failures []string
+	if total := r.total(); total == 0 {
+		return []string{"no requests sent"}
+	} else if rate := float64(r.errors+r.dropped) / float64(total); rate > maxErrors {
+		failures = append(failures, fmt.Sprintf("%.2f%% of requests failed or were dropped, threshold %.2f%%", rate*100, maxErrors*100))
+	}
+	if p := r.percentile(95); p > limits.P95 {
+		failures = append(failures, fmt.Sprintf("p95 %s exceeds %s", p, limits.P95))
+	}
+	if p := r.percentile(99); p > limits.P99 {
+		failures = append(failures, fmt.Sprintf("p99 %s exceeds %s", p, limits.P99))
+	}
+	return failures
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// thresholds are the latencies a scenario must stay within
+type thresholds struct {
+	P95 time.Duration
+	P99 time.Duration
+}
+
+// scenario is a request repeated for the length of a run
+type scenario struct {
+	Description string
+	// Baseline is the expected latency of a healthy server on modest hardware
+	Baseline thresholds
+	// Setup prepares the server, e.g. by creating a user, and returns the
+	// function building each request
+	Setup func(ctx context.Context, api *apiClient) (func() (*http.Request, error), error)
+}
+
+var scenarios = map[string]scenario{
+	"get-user": {
+		Description: "GET /users/:id as the user",
+		Baseline:    thresholds{P95: 50 * time.Millisecond, P99: 150 * time.Millisecond},
+		Setup: func(ctx context.Context, api *apiClient) (func() (*http.Request, error), error) {
+			user, token, err := api.signup(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return func() (*http.Request, error) {
+				return api.request(ctx, http.MethodGet, fmt.Sprintf("/users/%d", user.ID), token, nil)
+			}, nil
+		},
+	},
+	"list-users": {
+		Description: "GET /users",
+		Baseline:    thresholds{P95: 150 * time.Millisecond, P99: 400 * time.Millisecond},
+		Setup: func(ctx context.Context, api *apiClient) (func() (*http.Request, error), error) {
+			_, token, err := api.signup(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return func() (*http.Request, error) {
+				return api.request(ctx, http.MethodGet, "/users", token, nil)
+			}, nil
+		},
+	},
+	"search-users": {
+		Description: "GET /users/search?q=loadtest",
+		Baseline:    thresholds{P95: 100 * time.Millisecond, P99: 300 * time.Millisecond},
+		Setup: func(ctx context.Context, api *apiClient) (func() (*http.Request, error), error) {
+			_, token, err := api.signup(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return func() (*http.Request, error) {
+				return api.request(ctx, http.MethodGet, "/users/search?q=loadtest&limit=20", token, nil)
+			}, nil
+		},
+	},
+	"login": {
+		Description: "POST /login; dominated by bcrypt",
+		Baseline:    thresholds{P95: 400 * time.Millisecond, P99: 800 * time.Millisecond},
+		Setup: func(ctx context.Context, api *apiClient) (func() (*http.Request, error), error) {
+			user, _, err := api.signup(ctx)
+			if err != nil {
+				return nil, err
+			}
+			body := map[string]string{"email": user.Email, "password": loadtestPassword}
+			return func() (*http.Request, error) {
+				return api.request(ctx, http.MethodPost, "/login", "", body)
+			}, nil
+		},
+	},
+}
+
+func scenarioNames() []string {
+	names := make([]string, 0, len(scenarios))
+	for name := range scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadtestPassword is the password of the users created by Setup
+const loadtestPassword = "loadtest-password"
+
+// apiClient sends requests to the REST API under test
+type apiClient struct {
+	baseURL string
+	http    *http.Client
+}
+
+type loadtestUser struct {
+	ID    uint   `json:"id"`
+	Email string `json:"email"`
+}
+
+// signup creates a user for the run and returns it with its token
+func (api *apiClient) signup(ctx context.Context) (*loadtestUser, string, error) {
+	email := fmt.Sprintf("loadtest+%d@example.com", time.Now().UnixNano())
+	req, err := api.request(ctx, http.MethodPost, "/signup", "", map[string]string{
+		"name": "Loadtest", "email": email, "password": loadtestPassword,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := api.http.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return nil, "", fmt.Errorf("signup: status %d", resp.StatusCode)
+	}
+
+	var out struct {
+		User  loadtestUser `json:"user"`
+		Token string       `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, "", fmt.Errorf("signup: %w", err)
+	}
+	return &out.User, out.Token, nil
+}
+
+// request builds a request to path, with body encoded as JSON when not nil
+func (api *apiClient) request(ctx context.Context, method, path, token string, body interface{}) (*http.Request, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, api.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
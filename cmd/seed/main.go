@@ -0,0 +1,49 @@
+// Command seed loads users from a YAML or JSON fixture file into the
+// database configured by DATABASE_URL. Users are upserted by email, so the
+// command can be rerun after editing the fixture.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/114windd/restapi/internal/app"
+	"github.com/114windd/restapi/internal/config"
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/seed"
+)
+
+func main() {
+	file := flag.String("file", "fixtures/users.yaml", "fixture file (.yaml, .yml or .json)")
+	force := flag.Bool("force", false, "allow seeding when ENV=production")
+	flag.Parse()
+
+	logger.Init()
+	cfg := config.Load()
+	if cfg.Production() && !*force {
+		log.Fatal("refusing to seed a production database; pass -force to override")
+	}
+
+	fixture, err := seed.Load(*file)
+	if err != nil {
+		log.Fatalf("failed to load fixture: %v", err)
+	}
+
+	repo, err := database.Connect(cfg.Database.URL, app.MigrationOptions(cfg), cfg.Database.ConnectTimeout)
+	if err != nil {
+		log.Fatalf("failed to connect to database: %v", err)
+	}
+	defer repo.Close()
+	if cfg.Database.TenancyMode == config.TenancyModeRLS {
+		// Each user is written in its own tenant
+		repo.RegisterSessionHook(database.ApplyTenant)
+	}
+
+	result, err := seed.Apply(context.Background(), repo, fixture)
+	if err != nil {
+		log.Fatalf("seeding failed after %d created, %d updated: %v", result.Created, result.Updated, err)
+	}
+	log.Printf("seeded %s: %d created, %d updated, %d unchanged", *file, result.Created, result.Updated, result.Unchanged)
+}
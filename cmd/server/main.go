@@ -1,81 +1,218 @@
 package main
 
 import (
-	"net"
+	"context"
+	"net/http"
+	"os"
 
-	"github.com/gin-gonic/gin"
 	"google.golang.org/grpc"
 
-	"github.com/114windd/restapi/internal/api"
-	"github.com/114windd/restapi/internal/database"
-	grpcserver "github.com/114windd/restapi/internal/grpc"
+	"github.com/114windd/restapi/internal/app"
+	"github.com/114windd/restapi/internal/config"
+	"github.com/114windd/restapi/internal/listen"
 	"github.com/114windd/restapi/internal/logger"
 	"github.com/114windd/restapi/internal/metrics"
-	"github.com/114windd/restapi/pkg/proto"
+	"github.com/114windd/restapi/internal/selfcheck"
+	"github.com/114windd/restapi/internal/tlsconfig"
+	"github.com/114windd/restapi/internal/version"
 )
 
 func main() {
 	// Initialize logger first
 	logger.Init()
-	logger.Log.Info("Starting hybrid REST + gRPC API server")
 
-	// Initialize database
-	database.InitDB()
+	cfg := config.Load()
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		// `server check` runs the startup self-check and exits
+		if !selfCheck(cfg) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	build := version.Get()
+	logger.Log.WithField("version", build.Version).
+		WithField("commit", build.Commit).
+		WithField("build_time", build.BuildTime).
+		WithField("go_version", build.GoVersion).
+		Info("Starting hybrid REST + gRPC API server")
+	if err := logger.Configure(cfg.Logging); err != nil {
+		logger.Log.WithError(err).Fatal("Failed to configure logging")
+	}
+	if !selfCheck(cfg) {
+		logger.Log.Fatal("Startup self-check failed, refusing to start")
+	}
+	metrics.Init(cfg.Metrics)
+
+	// Wire database, cache, services and handlers
+	application, err := app.New(cfg)
+	if err != nil {
+		logger.Log.WithError(err).Fatal("Failed to initialize application")
+	}
+
+	// Optionally preload the cache so the first requests aren't served cold
+	if cfg.Cache.WarmUsers > 0 {
+		if err := application.Users.WarmCache(context.Background(), cfg.Cache.WarmUsers); err != nil {
+			logger.Log.WithError(err).Warn("Failed to warm cache")
+		}
+	}
+
+	// Log levels, rate limits, experiments and CORS origins follow CONFIG_FILE
+	if cfg.File != "" {
+		logger.Log.Info("Watching " + cfg.File + " for configuration changes")
+		go func() {
+			if err := application.WatchConfig(context.Background()); err != nil {
+				logger.Log.WithError(err).Error("Failed to watch the config file, changes need a restart")
+			}
+		}()
+	}
+
+	// Cleanup tasks run in the background for the life of the process
+	if application.Cron != nil {
+		application.Cron.Start()
+	}
+
+	// TLS is shared by the REST and gRPC listeners
+	serverTLS, err := tlsconfig.New(cfg.TLS)
+	if err != nil {
+		logger.Log.WithError(err).Fatal("Failed to configure TLS")
+	}
+	if serverTLS.Autocert != nil {
+		go func() {
+			// Serve ACME HTTP-01 challenges; other requests are redirected to HTTPS
+			if err := http.ListenAndServe(cfg.TLS.AutocertHTTPAddr, serverTLS.Autocert.HTTPHandler(nil)); err != nil {
+				logger.Log.WithError(err).Error("Autocert HTTP challenge listener stopped")
+			}
+		}()
+	}
+
+	// Metrics optionally get their own internal listener, kept off the public port
+	metricsAddr := cfg.Server.HTTPAddr
+	if cfg.Server.MetricsAddr != "" {
+		metricsAddr = cfg.Server.MetricsAddr
+		go startMetricsServer(application, metricsAddr)
+	}
+	logger.Log.Info("Metrics available at " + metricsAddr + "/metrics")
+	logger.Log.Info("Health checks available at " + cfg.Server.HTTPAddr + "/livez and /readyz")
+
+	if cfg.Server.SinglePort {
+		serveSinglePort(application, serverTLS)
+		return
+	}
 
 	// Start gRPC server in a goroutine
-	go startGrpcServer()
-
-	// Setup Gin router with logging and metrics middleware
-	r := gin.New()
-	r.Use(api.LoggingMiddleware())
-	r.Use(metrics.PrometheusMiddleware())
-	r.Use(gin.Recovery())
-
-	// Health check and metrics routes
-	r.GET("/healthz", metrics.HealthCheckHandler)
-	metrics.SetupMetricsRoutes(r)
-
-	// Public routes
-	r.POST("/signup", api.Signup)
-	r.POST("/login", api.Login)
-
-	// Protected routes
-	protected := r.Group("/")
-	protected.Use(api.AuthMiddleware())
-	{
-		protected.GET("/users", api.GetUsers)
-		protected.GET("/users/:id", api.GetUser)
-		protected.PUT("/users/:id", api.UpdateUser)
-		protected.DELETE("/users/:id", api.DeleteUser)
-	}
-
-	logger.Log.Info("REST server starting on :8080")
-	logger.Log.Info("gRPC server starting on :50051")
-	logger.Log.Info("Metrics available at :8080/metrics")
-	logger.Log.Info("Health check available at :8080/healthz")
-
-	if err := r.Run(":8080"); err != nil {
+	go startGrpcServer(application, serverTLS)
+
+	logger.Log.Info("REST server starting on " + cfg.Server.HTTPAddr)
+	logger.Log.Info("gRPC server starting on " + cfg.Server.GRPCAddr)
+
+	lis, err := listen.Listen(cfg.Server.HTTPAddr)
+	if err != nil {
+		logger.Log.WithError(err).Fatal("Failed to listen on " + cfg.Server.HTTPAddr)
+	}
+	srv := &http.Server{
+		Handler:   application.Router(),
+		TLSConfig: serverTLS.Config,
+	}
+
+	if serverTLS.Enabled() {
+		logger.Log.Info("REST server using TLS")
+		err = srv.ServeTLS(lis, "", "")
+	} else {
+		err = srv.Serve(lis)
+	}
+	if err != nil {
 		logger.Log.WithError(err).Fatal("Failed to start REST server")
 	}
 }
 
+// serveSinglePort serves REST and gRPC on HTTP_ADDR. Plaintext connections
+// are split by protocol with cmux; with TLS, gRPC requests are handed to the
+// gRPC server by the REST server's HTTP/2 handler.
+func serveSinglePort(application *app.App, serverTLS *tlsconfig.Server) {
+	addr := application.Config.Server.HTTPAddr
+	logger.Log.Info("REST and gRPC servers starting on " + addr)
+
+	lis, err := listen.Listen(addr)
+	if err != nil {
+		logger.Log.WithError(err).Fatal("Failed to listen on " + addr)
+	}
+	grpcServer := application.GRPCServer()
+	router := application.Router()
+
+	if serverTLS.Enabled() {
+		logger.Log.Info("REST and gRPC servers using TLS")
+		srv := &http.Server{
+			Handler:   listen.GRPCHandler(grpcServer, router),
+			TLSConfig: serverTLS.Config,
+		}
+		if err := srv.ServeTLS(lis, "", ""); err != nil {
+			logger.Log.WithError(err).Fatal("Failed to start server")
+		}
+		return
+	}
+
+	grpcLis, httpLis, serve := listen.Split(lis)
+	go func() {
+		if err := grpcServer.Serve(grpcLis); err != nil {
+			logger.Log.WithError(err).Fatal("Failed to serve gRPC")
+		}
+	}()
+	go func() {
+		if err := (&http.Server{Handler: router}).Serve(httpLis); err != nil {
+			logger.Log.WithError(err).Fatal("Failed to start REST server")
+		}
+	}()
+	if err := serve(); err != nil {
+		logger.Log.WithError(err).Fatal("Failed to serve " + addr)
+	}
+}
+
+// startMetricsServer serves /metrics on the internal metrics address, without TLS
+func startMetricsServer(application *app.App, addr string) {
+	lis, err := listen.Listen(addr)
+	if err != nil {
+		logger.Log.WithError(err).Fatal("Failed to listen on " + addr)
+	}
+	srv := &http.Server{Handler: application.MetricsRouter()}
+	if err := srv.Serve(lis); err != nil {
+		logger.Log.WithError(err).Fatal("Failed to serve metrics")
+	}
+}
+
+// selfCheck runs the startup checks, printing the report to stderr, and
+// reports whether they passed
+func selfCheck(cfg *config.Config) bool {
+	checks, closeDB := app.StartupChecks(cfg)
+	defer closeDB()
+
+	report := selfcheck.Run(context.Background(), selfcheck.DefaultTimeout, checks)
+	report.Write(os.Stderr)
+	return !report.Failed()
+}
+
 // startGrpcServer starts the gRPC server
-func startGrpcServer() {
-	lis, err := net.Listen("tcp", ":50051")
+func startGrpcServer(application *app.App, serverTLS *tlsconfig.Server) {
+	addr := application.Config.Server.GRPCAddr
+	lis, err := listen.Listen(addr)
 	if err != nil {
-		logger.Log.WithError(err).Fatal("Failed to listen on :50051")
+		logger.Log.WithError(err).Fatal("Failed to listen on " + addr)
 	}
 
-	// Create gRPC server with interceptors
-	grpcServer := grpc.NewServer(
-		grpc.UnaryInterceptor(metrics.GrpcPrometheusInterceptor()),
-	)
+	var opts []grpc.ServerOption
+	if serverTLS.Enabled() {
+		clientCAFile := application.Config.TLS.GRPCClientCAFile
+		creds, err := serverTLS.GRPCCredentials(clientCAFile)
+		if err != nil {
+			logger.Log.WithError(err).Fatal("Failed to configure gRPC TLS")
+		}
+		opts = append(opts, grpc.Creds(creds))
+		logger.Log.WithField("mtls", clientCAFile != "").Info("gRPC server using TLS")
+	}
 
-	// Register the user service
-	userService := grpcserver.NewGrpcUserService()
-	proto.RegisterUserServiceServer(grpcServer, userService)
+	grpcServer := application.GRPCServer(opts...)
 
-	logger.Log.Info("gRPC server listening on :50051")
+	logger.Log.Info("gRPC server listening on " + addr)
 	if err := grpcServer.Serve(lis); err != nil {
 		logger.Log.WithError(err).Fatal("Failed to serve gRPC")
 	}
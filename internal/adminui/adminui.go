@@ -0,0 +1,47 @@
+// Package adminui is a minimal admin dashboard built into the binary, so
+// small deployments don't need a separate frontend. The pages are static:
+// they log in through the REST API and fetch users, statistics, SLO reports,
+// security flags and user history with the admin's token, which the API
+// checks as for any other client.
+package adminui
+
+import (
+	"embed"
+	"io/fs"
+	"mime"
+	"path"
+)
+
+//go:embed static
+var static embed.FS
+
+// Index is the dashboard page; the other files are the assets it loads
+const Index = "index.html"
+
+// File is one of the dashboard's files
+type File struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Files returns the dashboard's files
+func Files() []File {
+	entries, err := fs.ReadDir(static, "static")
+	if err != nil {
+		panic(err) // embedded at build time
+	}
+	files := make([]File, 0, len(entries))
+	for _, entry := range entries {
+		data, err := static.ReadFile("static/" + entry.Name())
+		if err != nil {
+			panic(err)
+		}
+		contentType := mime.TypeByExtension(path.Ext(entry.Name()))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		files = append(files, File{Name: entry.Name(), ContentType: contentType, Data: data})
+	}
+	return files
+}
@@ -0,0 +1,237 @@
+// Admin dashboard. Everything it shows comes from the REST API, called with
+// the token of an admin who logged in here; the token is kept for the
+// browser tab only.
+"use strict";
+
+const api = "/api/v1";
+const views = ["login", "overview", "users", "flags"];
+const tokenKey = "admin_token";
+
+const $ = (id) => document.getElementById(id);
+
+class APIError extends Error {
+  constructor(status, message) {
+    super(message);
+    this.status = status;
+  }
+}
+
+async function request(method, path, body) {
+  const headers = { "Accept": "application/json" };
+  const token = sessionStorage.getItem(tokenKey);
+  if (token) {
+    headers["Authorization"] = "Bearer " + token;
+  }
+  if (body !== undefined) {
+    headers["Content-Type"] = "application/json";
+  }
+  const resp = await fetch(api + path, {
+    method,
+    headers,
+    body: body === undefined ? undefined : JSON.stringify(body),
+  });
+  const data = await resp.json().catch(() => ({}));
+  if (!resp.ok) {
+    throw new APIError(resp.status, data.error || resp.statusText);
+  }
+  return data;
+}
+
+function showError(err) {
+  if (err instanceof APIError && err.status === 401 && sessionStorage.getItem(tokenKey)) {
+    // Expired or revoked token
+    logout();
+  }
+  $("error").textContent = err.message;
+  $("error").hidden = false;
+}
+
+function clearError() {
+  $("error").hidden = true;
+}
+
+function show(view) {
+  clearError();
+  for (const name of views) {
+    $(name).hidden = name !== view;
+  }
+  for (const button of document.querySelectorAll("nav button[data-view]")) {
+    button.classList.toggle("active", button.dataset.view === view);
+  }
+  const load = { overview: loadOverview, users: () => loadUsers(""), flags: loadFlags }[view];
+  if (load) {
+    load().catch(showError);
+  }
+}
+
+function logout() {
+  sessionStorage.removeItem(tokenKey);
+  $("nav").hidden = true;
+  show("login");
+}
+
+// row appends a table row of text cells, plus an optional action button
+function row(tbody, cells, action) {
+  const tr = document.createElement("tr");
+  for (const cell of cells) {
+    const td = document.createElement("td");
+    td.textContent = cell === undefined || cell === null ? "" : String(cell);
+    tr.appendChild(td);
+  }
+  if (action) {
+    const td = document.createElement("td");
+    const button = document.createElement("button");
+    button.type = "button";
+    button.textContent = action.label;
+    button.addEventListener("click", () => action.run().catch(showError));
+    td.appendChild(button);
+    tr.appendChild(td);
+  }
+  tbody.appendChild(tr);
+  return tr;
+}
+
+function when(timestamp) {
+  return timestamp ? new Date(timestamp).toLocaleString() : "";
+}
+
+function percent(ratio) {
+  return (ratio * 100).toFixed(2) + "%";
+}
+
+async function loadOverview() {
+  const { stats } = await request("GET", "/users/stats");
+  const dl = $("stats");
+  dl.replaceChildren();
+  for (const [label, value] of [
+    ["Total", stats.total_users],
+    ["New in 24h", stats.new_users_last_24h],
+    ["Active in 24h", stats.active_users_last_24h],
+  ]) {
+    const div = document.createElement("div");
+    const dt = document.createElement("dt");
+    const dd = document.createElement("dd");
+    dt.textContent = label;
+    dd.textContent = String(value);
+    div.append(dt, dd);
+    dl.appendChild(div);
+  }
+
+  const tbody = $("slo");
+  tbody.replaceChildren();
+  try {
+    const report = await request("GET", "/admin/slo");
+    $("slo-summary").textContent = (report.met ? "All objectives met" : "Objectives missed") + " over the last " + report.window + ".";
+    for (const e of report.endpoints || []) {
+      const tr = row(tbody, [e.endpoint, e.requests, percent(e.availability), percent(e.latency_compliance),
+        percent(Math.min(e.availability_budget_remaining, e.latency_budget_remaining)), e.met ? "yes" : "no"]);
+      tr.classList.toggle("bad", !e.met);
+    }
+  } catch (err) {
+    if (!(err instanceof APIError) || err.status !== 404) {
+      throw err;
+    }
+    $("slo-summary").textContent = "SLO tracking is disabled.";
+  }
+}
+
+async function loadUsers(query) {
+  const data = query
+    ? await request("GET", "/users/search?q=" + encodeURIComponent(query))
+    : await request("GET", "/users");
+  $("users-note").textContent = data.truncated ? "Only the first users are shown; search to find others." : "";
+  $("history").hidden = true;
+  const tbody = $("user-rows");
+  tbody.replaceChildren();
+  for (const u of data.users || []) {
+    row(tbody, [u.id, u.name, u.email, u.role, u.status, when(u.last_login_at)], {
+      label: "History",
+      run: () => loadHistory(u),
+    });
+  }
+}
+
+async function loadHistory(user) {
+  $("history-title").textContent = "History of " + user.email;
+  const tbody = $("history-rows");
+  tbody.replaceChildren();
+  try {
+    const { history } = await request("GET", "/admin/users/" + user.id + "/history");
+    for (const h of history || []) {
+      row(tbody, [when(h.valid_from), h.valid_to ? when(h.valid_to) : "current", h.name, h.email, h.role]);
+    }
+  } catch (err) {
+    if (!(err instanceof APIError) || err.status !== 404) {
+      throw err;
+    }
+    row(tbody, ["No history recorded"]);
+  }
+  $("history").hidden = false;
+}
+
+async function loadFlags() {
+  const tbody = $("flag-rows");
+  tbody.replaceChildren();
+  let flags;
+  try {
+    flags = (await request("GET", "/admin/security/flags?status=open")).flags || [];
+  } catch (err) {
+    if (!(err instanceof APIError) || err.status !== 404) {
+      throw err;
+    }
+    $("flags-note").textContent = "Anomaly detection is disabled.";
+    return;
+  }
+  $("flags-note").textContent = flags.length ? "" : "No open flags.";
+  for (const f of flags) {
+    row(tbody, [when(f.created_at), f.user_id, f.analyzer, f.severity, f.reason, f.ip], {
+      label: "Resolve",
+      run: async () => {
+        await request("POST", "/admin/security/flags/" + f.id + "/resolve");
+        await loadFlags();
+      },
+    });
+  }
+}
+
+document.addEventListener("DOMContentLoaded", () => {
+  $("login-form").addEventListener("submit", async (event) => {
+    event.preventDefault();
+    clearError();
+    const form = new FormData(event.target);
+    try {
+      const data = await request("POST", "/login", {
+        email: form.get("email"),
+        password: form.get("password"),
+        totp_code: form.get("totp_code") || undefined,
+      });
+      if (data.user.role !== "admin") {
+        throw new Error("Admin access required");
+      }
+      sessionStorage.setItem(tokenKey, data.token);
+      event.target.reset();
+      $("nav").hidden = false;
+      show("overview");
+    } catch (err) {
+      showError(err);
+    }
+  });
+
+  $("search-form").addEventListener("submit", (event) => {
+    event.preventDefault();
+    clearError();
+    loadUsers(new FormData(event.target).get("q").trim()).catch(showError);
+  });
+
+  for (const button of document.querySelectorAll("nav button[data-view]")) {
+    button.addEventListener("click", () => show(button.dataset.view));
+  }
+  $("logout").addEventListener("click", logout);
+
+  if (sessionStorage.getItem(tokenKey)) {
+    $("nav").hidden = false;
+    show("overview");
+  } else {
+    show("login");
+  }
+});
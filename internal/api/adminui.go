@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/adminui"
+	"github.com/114windd/restapi/internal/router"
+)
+
+// adminUIPolicy only lets the dashboard load its own files and call this
+// API. The pages carry no data; that comes from the API, with the token of
+// an admin who logged in on the page.
+const adminUIPolicy = "default-src 'self'; img-src 'self' data:; frame-ancestors 'none'; base-uri 'none'; form-action 'none'"
+
+// ConfigureAdminUI enables the admin dashboard at /admin
+func (h *Handler) ConfigureAdminUI(enabled bool) {
+	h.adminUI = enabled
+}
+
+// AdminUIRoutes serves the dashboard page at /admin and its assets beside
+// it. It returns nothing until ConfigureAdminUI enables the dashboard.
+func (h *Handler) AdminUIRoutes() []router.Route {
+	if !h.adminUI {
+		return nil
+	}
+	var routes []router.Route
+	for _, file := range adminui.Files() {
+		path := "/admin/" + file.Name
+		if file.Name == adminui.Index {
+			path = "/admin"
+		}
+		routes = append(routes, router.Route{Method: http.MethodGet, Path: path, Handler: serveAdminUIFile(file), Summary: "Admin dashboard", RateLimit: router.RateLimitDefault, Timeout: h.timeout})
+	}
+	return routes
+}
+
+func serveAdminUIFile(file adminui.File) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Security-Policy", adminUIPolicy)
+		// Revalidated on every load, so deploys take effect at once
+		c.Header("Cache-Control", "no-cache")
+		c.Data(http.StatusOK, file.ContentType, file.Data)
+	}
+}
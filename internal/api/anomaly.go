@@ -0,0 +1,162 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/geoip"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/security"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// ConfigureAnomalyDetection screens logins with monitor. When stepUp is
+// set, logins a finding marks as risky must be confirmed with a code mailed
+// to the account.
+func (h *Handler) ConfigureAnomalyDetection(monitor *security.Monitor, stepUp *security.StepUp) {
+	h.anomaly = monitor
+	h.stepUp = stepUp
+}
+
+// screenLogin runs a login whose credentials checked out past the anomaly
+// analyzers. It writes the error response and returns false when the login
+// must first be confirmed with a step-up code. Users with 2FA have already
+// given a second factor, and OAuth logins (canStepUp false) have no way to
+// send one, so neither is asked for a code.
+func (h *Handler) screenLogin(c *gin.Context, user *models.User, login, code string, canStepUp bool) bool {
+	if h.anomaly == nil {
+		return true
+	}
+	ctx := c.Request.Context()
+	event := securityEvent(c, security.LoginSucceeded, user.ID, login)
+	stepUp := canStepUp && h.stepUp != nil && !user.TwoFactorEnabled
+
+	// A valid code confirms a login screened when the code was sent
+	if stepUp && code != "" {
+		if err := h.stepUp.Verify(ctx, user.ID, code); err != nil {
+			if !errors.Is(err, security.ErrInvalidCode) {
+				logAuth(c, "login_failed", user.Email).WithError(err).Error("Failed to verify step-up code")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify step-up code"})
+				return false
+			}
+			logAuth(c, "login_failed", user.Email).Warn("Invalid step-up code")
+			h.recordAuthFailure(c, login)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired code", "code": "invalid_step_up_code"})
+			return false
+		}
+		h.anomaly.Record(ctx, event)
+		return true
+	}
+
+	// Retries while a code is pending are held without screening them again,
+	// so they neither flag the account twice nor mail more codes
+	if stepUp {
+		pending, err := h.stepUp.Pending(ctx, user.ID)
+		if err != nil {
+			logAuth(c, "login_step_up", user.Email).WithError(err).Warn("Failed to check for a pending step-up code")
+		}
+		if pending {
+			respondStepUpRequired(c)
+			return false
+		}
+	}
+
+	verdict := h.anomaly.Screen(ctx, event)
+	if verdict.StepUp && stepUp {
+		if err := h.stepUp.Challenge(ctx, user, event); err != nil {
+			logAuth(c, "login_step_up", user.Email).WithError(err).Error("Failed to send step-up code")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send confirmation code"})
+			return false
+		}
+		logAuth(c, "login_step_up", user.Email).WithField("user_id", user.ID).Warn("Unusual login held for step-up confirmation")
+		respondStepUpRequired(c)
+		return false
+	}
+	h.anomaly.Record(ctx, event)
+	return true
+}
+
+func respondStepUpRequired(c *gin.Context) {
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Confirm this login with the code sent to your email", "code": "step_up_required"})
+}
+
+// observeAuthFailure feeds a failed login to the anomaly analyzers
+func (h *Handler) observeAuthFailure(c *gin.Context, login string) {
+	if h.anomaly == nil || login == "" {
+		return
+	}
+	h.anomaly.Observe(c.Request.Context(), securityEvent(c, security.LoginFailed, 0, login))
+}
+
+// securityEvent describes an authentication event in the request
+func securityEvent(c *gin.Context, kind string, userID uint, login string) security.Event {
+	event := security.Event{
+		Kind:      kind,
+		UserID:    userID,
+		Login:     login,
+		TenantID:  database.TenantFromContext(c.Request.Context()),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		At:        time.Now(),
+	}
+	if location, ok := c.Get(locationKey); ok {
+		event.Location = location.(geoip.Location)
+	}
+	return event
+}
+
+// GetSecurityFlags lists flagged accounts; ?status=open or resolved filters them
+func (h *Handler) GetSecurityFlags(c *gin.Context) {
+	if !h.requireAnomaly(c) {
+		return
+	}
+
+	flags, err := h.anomaly.Flags(c.Request.Context(), c.Query("status"))
+	if err != nil {
+		logger.LogDatabase("select", "security_flags").WithError(err).Error("Failed to list security flags")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch security flags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"flags": flags})
+}
+
+// ResolveSecurityFlag closes a flag once the account has been reviewed
+func (h *Handler) ResolveSecurityFlag(c *gin.Context) {
+	if !h.requireAnomaly(c) {
+		return
+	}
+	id, ok := parseID(c, "security flag")
+	if !ok {
+		return
+	}
+
+	adminID := currentIdentity(c).UserID
+	flag, err := h.anomaly.ResolveFlag(c.Request.Context(), id, adminID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Security flag not found"})
+			return
+		}
+		logger.LogDatabase("update", "security_flags").WithError(err).Error("Failed to resolve security flag")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve security flag"})
+		return
+	}
+
+	logger.Log.WithField("flag_id", id).WithField("admin_id", adminID).Info("Security flag resolved")
+	c.JSON(http.StatusOK, gin.H{"message": "Security flag resolved", "flag": flag})
+}
+
+// requireAnomaly responds 404 when anomaly detection is not configured
+func (h *Handler) requireAnomaly(c *gin.Context) bool {
+	if h.anomaly == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Anomaly detection is not enabled"})
+		return false
+	}
+	return true
+}
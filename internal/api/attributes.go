@@ -0,0 +1,72 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/service"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// Custom attribute definition handlers (admin only)
+func (h *Handler) GetAttributeDefinitions(c *gin.Context) {
+	defs, err := h.users.ListAttributeDefinitions(c.Request.Context())
+	if err != nil {
+		logger.LogDatabase("select", "attribute_definitions").WithError(err).Error("Failed to fetch attribute definitions")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attribute definitions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"attributes": defs})
+}
+
+func (h *Handler) CreateAttributeDefinition(c *gin.Context) {
+	var req models.CreateAttributeDefinitionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Log.WithError(err).Warn("Invalid attribute definition request")
+		respondBindError(c, err)
+		return
+	}
+
+	def, err := h.users.CreateAttributeDefinition(c.Request.Context(), req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAttributes) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, database.ErrDuplicateKey) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Attribute already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create attribute definition"})
+		return
+	}
+
+	logger.LogDatabase("create", "attribute_definitions").WithField("name", def.Name).Info("Attribute definition created successfully")
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "Attribute definition created successfully",
+		"attribute": def,
+	})
+}
+
+func (h *Handler) DeleteAttributeDefinition(c *gin.Context) {
+	id, ok := parseID(c, "attribute")
+	if !ok {
+		return
+	}
+
+	if err := h.users.DeleteAttributeDefinition(c.Request.Context(), id); err != nil {
+		logger.LogDatabase("delete", "attribute_definitions").WithError(err).WithField("id", id).Error("Failed to delete attribute definition")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete attribute definition"})
+		return
+	}
+
+	logger.LogDatabase("delete", "attribute_definitions").WithField("id", id).Info("Attribute definition deleted successfully")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attribute definition deleted successfully"})
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/service"
+	"github.com/114windd/restapi/internal/storage"
+)
+
+// ConfigureAvatars enables avatar uploads of up to maxBytes; 0 disables them
+func (h *Handler) ConfigureAvatars(maxBytes int64) {
+	h.maxAvatarBytes = maxBytes
+}
+
+// UploadAvatar replaces a user's avatar with the image in the "avatar"
+// field of a multipart form
+func (h *Handler) UploadAvatar(c *gin.Context) {
+	id, ok := parseID(c, "user")
+	if !ok {
+		return
+	}
+	if !requireUserOwnership(c, id) {
+		return
+	}
+
+	header, err := c.FormFile("avatar")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing avatar file"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to open uploaded avatar")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read upload"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to read uploaded avatar")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read upload"})
+		return
+	}
+
+	user, err := h.users.SetAvatar(c.Request.Context(), id, data)
+	if err != nil {
+		avatarError(c, err, "Failed to store avatar")
+		return
+	}
+
+	logger.Log.WithField("user_id", id).WithField("bytes", len(data)).Info("Avatar uploaded")
+	c.JSON(http.StatusOK, gin.H{"message": "Avatar updated successfully", "user": user})
+}
+
+// DeleteAvatar removes a user's avatar
+func (h *Handler) DeleteAvatar(c *gin.Context) {
+	id, ok := parseID(c, "user")
+	if !ok {
+		return
+	}
+	if !requireUserOwnership(c, id) {
+		return
+	}
+
+	user, err := h.users.DeleteAvatar(c.Request.Context(), id)
+	if err != nil {
+		avatarError(c, err, "Failed to delete avatar")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Avatar deleted successfully", "user": user})
+}
+
+// GetAvatar serves an avatar image. Names change on every upload, so the
+// response can be cached indefinitely.
+func (h *Handler) GetAvatar(c *gin.Context) {
+	image, info, err := h.users.GetAvatar(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		avatarError(c, err, "Failed to fetch avatar")
+		return
+	}
+	defer image.Close()
+
+	c.DataFromReader(http.StatusOK, info.Size, info.ContentType, image, map[string]string{
+		"Cache-Control":           "public, max-age=31536000, immutable",
+		"Content-Security-Policy": "default-src 'none'",
+	})
+}
+
+// avatarError maps avatar errors to HTTP responses
+func avatarError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidAvatar):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_avatar"})
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, storage.ErrObjectNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+	case errors.Is(err, service.ErrAvatarsDisabled):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Avatars are not enabled"})
+	default:
+		logger.Log.WithError(err).Error(message)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
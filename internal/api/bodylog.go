@@ -0,0 +1,163 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// redacted replaces sensitive values in logged bodies and headers
+const redacted = "[REDACTED]"
+
+// sensitiveFields are redacted from logged bodies wherever a field name
+// contains one of them. otpauth covers the provisioning URL, which embeds
+// the TOTP secret.
+var sensitiveFields = []string{"password", "token", "secret", "authorization", "api_key", "backup_code", "cookie", "totp_code", "step_up_code", "otpauth"}
+
+// sensitiveRequestFields are also redacted from request bodies, where a
+// "code" is a one-time code; in responses it is the error code
+var sensitiveRequestFields = []string{"code"}
+
+// sensitiveHeaders are redacted from logged request headers
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Cookie":              true,
+	"Proxy-Authorization": true,
+	"X-Api-Key":           true,
+	"X-Captcha-Token":     true,
+}
+
+// bodyRedactor masks sensitive fields of logged JSON and form bodies
+type bodyRedactor struct {
+	fields []string
+	json   *regexp.Regexp
+}
+
+// newBodyRedactor creates a redactor for request bodies, or for response
+// bodies when request is false, also masking the extra fields
+func newBodyRedactor(extra []string, request bool) *bodyRedactor {
+	fields := append([]string{}, sensitiveFields...)
+	if request {
+		fields = append(fields, sensitiveRequestFields...)
+	}
+	for _, field := range extra {
+		fields = append(fields, strings.ToLower(field))
+	}
+	quoted := make([]string, len(fields))
+	for i, field := range fields {
+		quoted[i] = regexp.QuoteMeta(field)
+	}
+	// A pattern rather than a parser, so truncated bodies are still redacted
+	pattern := `(?i)("[^"]*(?:` + strings.Join(quoted, "|") + `)[^"]*"\s*:\s*)("(?:[^"\\]|\\.)*"?|\[[^\]]*\]?|[^,}\s]+)`
+	return &bodyRedactor{fields: fields, json: regexp.MustCompile(pattern)}
+}
+
+// sensitive reports whether a field name matches one of the redacted fields
+func (r *bodyRedactor) sensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, field := range r.fields {
+		if strings.Contains(name, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// body renders a captured body for the log, redacted according to its
+// content type. Bodies that can't be redacted field by field, such as text
+// and XML, are omitted.
+func (r *bodyRedactor) body(header http.Header, data []byte, truncated bool) string {
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	var text string
+	switch {
+	case len(data) == 0:
+		return ""
+	case header.Get("Content-Encoding") != "":
+		return "[" + header.Get("Content-Encoding") + " encoded body omitted]"
+	case mediaType == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(data))
+		if err != nil {
+			return "[unparseable form body]"
+		}
+		for key := range values {
+			if r.sensitive(key) {
+				values[key] = []string{redacted}
+			}
+		}
+		text = values.Encode()
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		text = r.json.ReplaceAllString(string(data), `$1"`+redacted+`"`)
+	default:
+		return "[" + mediaType + " body omitted]"
+	}
+	if truncated {
+		text += "...[truncated]"
+	}
+	return text
+}
+
+// headers returns request headers for the log with credentials redacted
+func (r *bodyRedactor) headers(header http.Header) map[string]string {
+	logged := make(map[string]string, len(header))
+	for name, values := range header {
+		if sensitiveHeaders[name] {
+			logged[name] = redacted
+			continue
+		}
+		logged[name] = strings.Join(values, ", ")
+	}
+	return logged
+}
+
+// bodyCapture keeps the first max bytes of a body as it is read or written
+type bodyCapture struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *bodyCapture) capture(data []byte) {
+	if room := b.max - b.buf.Len(); room < len(data) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(data[:room])
+		}
+		return
+	}
+	b.buf.Write(data)
+}
+
+// capturingReader records a request body while the handler reads it, so
+// capture doesn't bypass the body size limit or read what isn't consumed
+type capturingReader struct {
+	io.ReadCloser
+	*bodyCapture
+}
+
+func (r *capturingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.capture(p[:n])
+	return n, err
+}
+
+// capturingWriter records a response body as it is written
+type capturingWriter struct {
+	gin.ResponseWriter
+	*bodyCapture
+}
+
+func (w *capturingWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
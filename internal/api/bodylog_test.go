@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBodyRedaction(t *testing.T) {
+	jsonHeader := http.Header{"Content-Type": {"application/json"}}
+	tests := []struct {
+		name    string
+		body    string
+		request bool
+		secret  string
+	}{
+		{"password", `{"email":"a@example.com","password":"hunter2"}`, true, "hunter2"},
+		{"token", `{"refresh_token":"r3fr3sh"}`, false, "r3fr3sh"},
+		{"secret", `{"secret":"JBSWY3DPEHPK3PXP"}`, false, "JBSWY3DPEHPK3PXP"},
+		{"code", `{"code":"123456"}`, true, "123456"},
+		{"totp_code", `{"email":"a@example.com","totp_code":"654321"}`, true, "654321"},
+		{"step_up_code", `{"step_up_code":"112233"}`, true, "112233"},
+		{"backup_code", `{"backup_code":"abcde12345"}`, true, "abcde12345"},
+		{"backup_codes", `{"backup_codes":["abcde12345","fghij67890"]}`, false, "abcde12345"},
+		{"otpauth", `{"otpauth_url":"otpauth://totp/restapi:a?secret=JBSWY3DPEHPK3PXP"}`, false, "JBSWY3DPEHPK3PXP"},
+		{"truncated", `{"password":"hunt`, true, "hunt"},
+	}
+	for _, tt := range tests {
+		got := newBodyRedactor(nil, tt.request).body(jsonHeader, []byte(tt.body), false)
+		if strings.Contains(got, tt.secret) || !strings.Contains(got, redacted) {
+			t.Errorf("%s: logged %s", tt.name, got)
+		}
+	}
+
+	// Error codes in responses stay readable
+	response := `{"error":"Two-factor code required","code":"two_factor_required"}`
+	if got := newBodyRedactor(nil, false).body(jsonHeader, []byte(response), false); got != response {
+		t.Errorf("error response logged as %s", got)
+	}
+
+	form := http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}
+	if got := newBodyRedactor([]string{"PIN"}, true).body(form, []byte("name=a&pin=1234&code=9876"), false); strings.Contains(got, "1234") || strings.Contains(got, "9876") || !strings.Contains(got, "name=a") {
+		t.Errorf("form body logged as %s", got)
+	}
+}
+
+func TestBodyLoggingOmitsUnredactableTypes(t *testing.T) {
+	r := newBodyRedactor(nil, true)
+	for _, contentType := range []string{"text/plain", "text/csv; charset=utf-8", "application/xml", "image/png"} {
+		header := http.Header{"Content-Type": {contentType}}
+		if got := r.body(header, []byte("password=hunter2"), false); strings.Contains(got, "hunter2") || !strings.HasSuffix(got, "body omitted]") {
+			t.Errorf("%s body logged as %s", contentType, got)
+		}
+	}
+}
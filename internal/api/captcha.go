@@ -0,0 +1,103 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/bruteforce"
+	"github.com/114windd/restapi/internal/captcha"
+	"github.com/114windd/restapi/internal/logger"
+)
+
+// ConfigureCaptcha sets the challenge deciding when /login and /signup
+// require a CAPTCHA; nil disables it
+func (h *Handler) ConfigureCaptcha(challenge *captcha.Challenge) {
+	h.captcha = challenge
+}
+
+// ConfigureBruteForce sets the guard delaying logins after repeated
+// failures; nil disables delays
+func (h *Handler) ConfigureBruteForce(guard *bruteforce.Guard) {
+	h.bruteForce = guard
+}
+
+// requireCaptcha verifies the CAPTCHA token when the client, or the account
+// named by email when not empty, has exceeded the failed-attempt threshold.
+// It writes the error response and returns false when the request must not
+// proceed.
+func (h *Handler) requireCaptcha(c *gin.Context, token, email string) bool {
+	clientIP := c.ClientIP()
+	if !h.captcha.Required(clientIP) && (email == "" || !h.captcha.Required(bruteforce.EmailKey(email))) {
+		return true
+	}
+
+	if token == "" {
+		token = c.GetHeader("X-Captcha-Token")
+	}
+
+	if err := h.captcha.Verify(c.Request.Context(), token, clientIP); err != nil {
+		logger.Log.WithError(err).WithField("client_ip", clientIP).Warn("CAPTCHA challenge failed")
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":            "CAPTCHA verification required",
+			"captcha_required": true,
+		})
+		return false
+	}
+	return true
+}
+
+// attemptCountedKey marks requests whose login attempt delayLogin has
+// already counted against the brute-force guard
+const attemptCountedKey = "login_attempt_counted"
+
+// recordAuthFailure counts a failed login or signup toward the CAPTCHA
+// threshold and login delays, for the client and, when email is not empty,
+// for the account, which anomaly detection also watches. Logins counted by
+// delayLogin are not counted by the guard again.
+func (h *Handler) recordAuthFailure(c *gin.Context, email string) {
+	ctx := c.Request.Context()
+	clientIP := c.ClientIP()
+	counted := c.GetBool(attemptCountedKey)
+	h.captcha.RecordFailure(clientIP)
+	if email == "" {
+		if !counted {
+			h.bruteForce.RecordFailure(ctx, bruteforce.IPKey(clientIP))
+		}
+		return
+	}
+	h.captcha.RecordFailure(bruteforce.EmailKey(email))
+	if !counted {
+		h.bruteForce.RecordFailure(ctx, bruteforce.IPKey(clientIP), bruteforce.EmailKey(email))
+	}
+	h.observeAuthFailure(c, email)
+}
+
+// resetAuthFailures clears the failure counts after a successful attempt.
+// The client's login delay is left to expire, so an attacker can't clear it
+// by logging in to an account of their own between guesses.
+func (h *Handler) resetAuthFailures(c *gin.Context, email string) {
+	h.captcha.Reset(c.ClientIP())
+	if email != "" {
+		h.captcha.Reset(bruteforce.EmailKey(email))
+		if c.GetBool(attemptCountedKey) {
+			h.bruteForce.Succeeded(c.Request.Context(), bruteforce.IPKey(c.ClientIP()), bruteforce.EmailKey(email))
+		} else {
+			h.bruteForce.Reset(c.Request.Context(), bruteforce.EmailKey(email))
+		}
+	}
+}
+
+// delayLogin counts the login attempt against the client and the account,
+// before the credentials are checked, and waits out the progressive delay
+// owed after earlier failures. It writes the error response and returns
+// false if the request deadline passes first.
+func (h *Handler) delayLogin(c *gin.Context, email string) bool {
+	c.Set(attemptCountedKey, h.bruteForce != nil)
+	err := h.bruteForce.Wait(c.Request.Context(), bruteforce.IPKey(c.ClientIP()), bruteforce.EmailKey(email))
+	if err != nil {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, try again later"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/service"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// ConfigureEmailCheck enables anti-enumeration mode for the email
+// availability check, where every request must carry a valid CAPTCHA token
+func (h *Handler) ConfigureEmailCheck(requireCaptcha bool) {
+	h.emailCheckCaptcha = requireCaptcha
+}
+
+// CheckEmail reports whether an email address can be used to sign up,
+// served at /signup/check-email and /users/email-available. The response
+// only says whether it is available, never who owns it.
+func (h *Handler) CheckEmail(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	var req models.CheckEmailRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A valid email is required"})
+		return
+	}
+
+	if h.emailCheckCaptcha {
+		if !h.captcha.Enabled() {
+			// Fail closed: anti-enumeration mode without a CAPTCHA provider
+			logger.Log.Error("Email check requires a CAPTCHA but no CAPTCHA provider is configured")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Email availability check is unavailable"})
+			return
+		}
+
+		token := req.CaptchaToken
+		if token == "" {
+			token = c.GetHeader("X-Captcha-Token")
+		}
+		if err := h.captcha.Verify(c.Request.Context(), token, c.ClientIP()); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":            "CAPTCHA verification required",
+				"captcha_required": true,
+			})
+			return
+		}
+	}
+
+	available, err := h.users.IsEmailAvailable(c.Request.Context(), req.Email)
+	if err != nil {
+		if errors.Is(err, service.ErrEmailDomainNotAllowed) {
+			c.JSON(http.StatusOK, gin.H{"available": false, "code": "email_domain_not_allowed"})
+			return
+		}
+		logger.Log.WithError(err).Error("Failed to check email availability")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check email"})
+		return
+	}
+
+	// Log the domain only, so the log doesn't become an address list
+	logger.Log.WithField("domain", req.Email[strings.LastIndex(req.Email, "@")+1:]).
+		WithField("client_ip", c.ClientIP()).
+		Debug("Email availability checked")
+
+	c.JSON(http.StatusOK, gin.H{"available": available})
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/cache"
+	"github.com/114windd/restapi/internal/captcha"
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/service"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// tokenVerifier accepts a single CAPTCHA token
+type tokenVerifier string
+
+func (v tokenVerifier) Verify(ctx context.Context, token, remoteIP string) error {
+	if token != string(v) {
+		return captcha.ErrVerificationFailed
+	}
+	return nil
+}
+
+func TestCheckEmail(t *testing.T) {
+	tests := []struct {
+		name           string
+		requireCaptcha bool
+		verifier       captcha.Verifier
+		query          string
+		header         string
+		status         int
+		body           map[string]interface{}
+	}{
+		{name: "available", query: "email=new@example.com", status: http.StatusOK, body: map[string]interface{}{"available": true}},
+		{name: "taken", query: "email=Alice@Example.com", status: http.StatusOK, body: map[string]interface{}{"available": false}},
+		{name: "denied domain", query: "email=bob@spam.test", status: http.StatusOK, body: map[string]interface{}{"available": false, "code": "email_domain_not_allowed"}},
+		{name: "invalid email", query: "email=nope", status: http.StatusBadRequest},
+		{name: "missing email", status: http.StatusBadRequest},
+		{name: "captcha without provider", requireCaptcha: true, query: "email=new@example.com", status: http.StatusServiceUnavailable},
+		{name: "captcha missing", requireCaptcha: true, verifier: tokenVerifier("human"), query: "email=new@example.com", status: http.StatusForbidden, body: map[string]interface{}{"error": "CAPTCHA verification required", "captcha_required": true}},
+		{name: "captcha wrong", requireCaptcha: true, verifier: tokenVerifier("human"), query: "email=new@example.com&captcha_token=bot", status: http.StatusForbidden},
+		{name: "captcha in query", requireCaptcha: true, verifier: tokenVerifier("human"), query: "email=new@example.com&captcha_token=human", status: http.StatusOK, body: map[string]interface{}{"available": true}},
+		{name: "captcha in header", requireCaptcha: true, verifier: tokenVerifier("human"), query: "email=new@example.com", header: "human", status: http.StatusOK, body: map[string]interface{}{"available": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := database.NewMemoryRepository()
+			if err := repo.CreateUser(context.Background(), &models.User{Name: "Alice", Email: "alice@example.com", Password: "x"}); err != nil {
+				t.Fatal(err)
+			}
+			users := service.NewUserService(repo, cache.New(cache.NewMemoryStore(time.Minute)))
+			users.SetEmailDomainPolicy(service.EmailDomainPolicy{Deny: []string{"spam.test"}})
+
+			h := NewHandler(users, nil)
+			h.ConfigureEmailCheck(tt.requireCaptcha)
+			if tt.verifier != nil {
+				h.ConfigureCaptcha(captcha.NewChallenge(tt.verifier, 3, time.Minute))
+			}
+			r := gin.New()
+			r.GET("/signup/check-email", h.CheckEmail)
+
+			req := httptest.NewRequest(http.MethodGet, "/signup/check-email?"+tt.query, nil)
+			if tt.header != "" {
+				req.Header.Set("X-Captcha-Token", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body)
+			}
+			if got := w.Header().Get("Cache-Control"); got != "no-store" {
+				t.Fatalf("Cache-Control: %q", got)
+			}
+			if tt.body == nil {
+				return
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if len(body) != len(tt.body) {
+				t.Fatalf("expected %v, got %v", tt.body, body)
+			}
+			for key, want := range tt.body {
+				if body[key] != want {
+					t.Fatalf("expected %v, got %v", tt.body, body)
+				}
+			}
+		})
+	}
+}
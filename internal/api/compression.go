@@ -0,0 +1,197 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/logger"
+)
+
+// CompressionMiddleware compresses response bodies of at least minBytes with
+// gzip or deflate, whichever the client's Accept-Encoding prefers. Smaller
+// bodies, streams and already encoded responses are sent as is.
+func CompressionMiddleware(minBytes int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		writer := &compressWriter{ResponseWriter: c.Writer, encoding: encoding, minBytes: minBytes}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if err := writer.finish(); err != nil {
+			logger.Log.WithError(err).Debug("Failed to write compressed response")
+		}
+	}
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header,
+// or returns "" when the response should not be compressed
+func negotiateEncoding(header string) string {
+	for _, accepted := range parseAccept(header) {
+		switch accepted.value {
+		case "gzip", "*":
+			return "gzip"
+		case "deflate":
+			return "deflate"
+		}
+	}
+	return ""
+}
+
+// acceptValue is one entry of an Accept or Accept-Encoding header
+type acceptValue struct {
+	value string
+	q     float64
+}
+
+// parseAccept returns the values of an Accept-style header, most preferred
+// first. Values with q=0 are refused and left out.
+func parseAccept(header string) []acceptValue {
+	var values []acceptValue
+	for _, part := range strings.Split(header, ",") {
+		value, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			// Encodings aren't media types; fall back to splitting off parameters
+			fields := strings.Split(part, ";")
+			value, params = strings.ToLower(strings.TrimSpace(fields[0])), map[string]string{}
+			for _, field := range fields[1:] {
+				if k, v, ok := strings.Cut(strings.TrimSpace(field), "="); ok {
+					params[strings.ToLower(k)] = v
+				}
+			}
+		}
+		if value == "" {
+			continue
+		}
+		q := 1.0
+		if raw, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(raw, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			values = append(values, acceptValue{value: value, q: q})
+		}
+	}
+	sort.SliceStable(values, func(i, j int) bool { return values[i].q > values[j].q })
+	return values
+}
+
+// compressWriter holds back the start of a response until it reaches
+// minBytes, then switches to compressing it
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	minBytes int
+
+	buf         bytes.Buffer
+	encoder     io.WriteCloser
+	decided     bool
+	passthrough bool
+}
+
+// eligible reports whether the response may be compressed at all
+func (w *compressWriter) eligible() bool {
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	switch w.Status() {
+	case http.StatusNoContent, http.StatusNotModified:
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	switch {
+	case mediaType == "text/event-stream":
+		return false
+	case strings.HasPrefix(mediaType, "image/") && mediaType != "image/svg+xml":
+		return false
+	}
+	return true
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.decided = true
+		w.passthrough = !w.eligible()
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(data)
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+
+	w.buf.Write(data)
+	if w.buf.Len() >= w.minBytes {
+		if err := w.startEncoding(); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Written reports true once anything was written, even if it is still buffered
+func (w *compressWriter) Written() bool {
+	return w.buf.Len() > 0 || w.encoder != nil || w.ResponseWriter.Written()
+}
+
+// Flush sends what has been written so far, compressing it if it is eligible
+func (w *compressWriter) Flush() {
+	if w.encoder == nil && w.buf.Len() > 0 && !w.passthrough {
+		if err := w.startEncoding(); err != nil {
+			return
+		}
+	}
+	if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+		_ = flusher.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// startEncoding switches the response to compressed and writes the buffered start of the body
+func (w *compressWriter) startEncoding() error {
+	header := w.Header()
+	header.Set("Content-Encoding", w.encoding)
+	header.Del("Content-Length")
+	if w.encoding == "deflate" {
+		w.encoder = zlib.NewWriter(w.ResponseWriter)
+	} else {
+		w.encoder = gzip.NewWriter(w.ResponseWriter)
+	}
+	_, err := w.encoder.Write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+// finish completes the response: it closes the compressed stream or sends a
+// body too small to be worth compressing
+func (w *compressWriter) finish() error {
+	if w.encoder != nil {
+		return w.encoder.Close()
+	}
+	if w.buf.Len() > 0 {
+		_, err := w.ResponseWriter.Write(w.buf.Bytes())
+		return err
+	}
+	return nil
+}
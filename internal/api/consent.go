@@ -0,0 +1,86 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/consent"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// ConfigureConsent enables terms of service tracking. When the service
+// requires a terms version, authenticated routes refuse callers who haven't
+// accepted it.
+func (h *Handler) ConfigureConsent(service *consent.Service) {
+	h.consent = service
+}
+
+// ConsentMiddleware answers 451 to callers who haven't accepted the current
+// terms of service, naming the version to accept through POST /me/consents.
+// It returns nil when no terms version is required.
+func (h *Handler) ConsentMiddleware() gin.HandlerFunc {
+	if h.consent == nil || h.consent.TermsVersion() == "" {
+		return nil
+	}
+	return func(c *gin.Context) {
+		accepted, err := h.consent.HasAccepted(c.Request.Context(), c.GetUint("user_id"))
+		if err != nil {
+			logger.Log.WithError(err).Error("Failed to check terms of service acceptance")
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check terms of service acceptance"})
+			return
+		}
+		if !accepted {
+			c.AbortWithStatusJSON(http.StatusUnavailableForLegalReasons, gin.H{
+				"error":         "The terms of service have changed; accept the current version to continue",
+				"code":          "terms_not_accepted",
+				"terms_version": h.consent.TermsVersion(),
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// AcceptConsent records that the caller accepted a version of the terms of service
+func (h *Handler) AcceptConsent(c *gin.Context) {
+	if h.consent == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Consent tracking is not enabled"})
+		return
+	}
+
+	var req models.AcceptConsentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	accepted, err := h.consent.Accept(c.Request.Context(), userID, req.Document, req.Version, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if errors.Is(err, consent.ErrStaleVersion) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Only the current terms of service can be accepted", "code": "stale_terms_version", "terms_version": h.consent.TermsVersion()})
+			return
+		}
+		logger.Log.WithError(err).WithField("user_id", userID).Error("Failed to record consent")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record consent"})
+		return
+	}
+
+	logger.Log.WithField("user_id", userID).WithField("document", accepted.Document).WithField("version", accepted.Version).Info("Consent recorded")
+	c.JSON(http.StatusCreated, gin.H{"consent": accepted})
+}
+
+// acceptTermsOnSignup records the terms version a new user accepted while
+// signing up. Signup already succeeded, so a failure is only logged and the
+// user is asked to accept again on their next request.
+func (h *Handler) acceptTermsOnSignup(c *gin.Context, userID uint, version string) {
+	if h.consent == nil || version == "" {
+		return
+	}
+	if _, err := h.consent.Accept(c.Request.Context(), userID, models.ConsentTerms, version, c.ClientIP(), c.Request.UserAgent()); err != nil {
+		logger.Log.WithError(err).WithField("user_id", userID).Error("Failed to record consent on signup")
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// corsMaxAge is how long browsers may cache a preflight response, in seconds
+const corsMaxAge = "600"
+
+// corsExposedHeaders are the response headers scripts on allowed origins may read
+const corsExposedHeaders = "ETag, Location, Link, Retry-After, Deprecation, Sunset, X-Request-ID"
+
+// CORS lets browsers on allowed origins call the API. The origins can be
+// replaced while serving.
+type CORS struct {
+	origins atomic.Pointer[map[string]bool]
+}
+
+// NewCORS allows the given origins; "*" allows any and none disables CORS
+func NewCORS(origins []string) *CORS {
+	cors := &CORS{}
+	cors.SetOrigins(origins)
+	return cors
+}
+
+// SetOrigins replaces the allowed origins
+func (cors *CORS) SetOrigins(origins []string) {
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		allowed[origin] = true
+	}
+	cors.origins.Store(&allowed)
+}
+
+func (cors *CORS) allowed(origin string) bool {
+	allowed := *cors.origins.Load()
+	return allowed["*"] || allowed[origin]
+}
+
+// Middleware adds CORS headers for allowed origins and answers their
+// preflight requests. Requests from other origins get no CORS headers, so
+// browsers block them.
+func (cors *CORS) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		c.Writer.Header().Add("Vary", "Origin")
+		if !cors.allowed(origin) {
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", origin)
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+			if headers := c.GetHeader("Access-Control-Request-Headers"); headers != "" {
+				c.Header("Access-Control-Allow-Headers", headers)
+			}
+			c.Header("Access-Control-Max-Age", corsMaxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Header("Access-Control-Expose-Headers", corsExposedHeaders)
+		c.Next()
+	}
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/service"
+)
+
+// Signup email domain policy handlers (admin only)
+func (h *Handler) GetEmailDomainPolicy(c *gin.Context) {
+	policy, err := h.users.GetEmailDomainPolicy(c.Request.Context())
+	if err != nil {
+		logger.LogDatabase("select", "signup_domain_policies").WithError(err).Error("Failed to fetch email domain policy")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch email domain policy"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"policy": policy})
+}
+
+func (h *Handler) UpdateEmailDomainPolicy(c *gin.Context) {
+	var policy service.EmailDomainPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		logger.Log.WithError(err).Warn("Invalid email domain policy request")
+		respondBindError(c, err)
+		return
+	}
+
+	policy, err := h.users.UpdateEmailDomainPolicy(c.Request.Context(), policy)
+	if err != nil {
+		logger.LogDatabase("upsert", "signup_domain_policies").WithError(err).Error("Failed to update email domain policy")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update email domain policy"})
+		return
+	}
+
+	logger.Log.WithFields(map[string]interface{}{
+		"admin_id": GetUserIDFromContext(c),
+		"allow":    policy.Allow,
+		"deny":     policy.Deny,
+	}).Info("Signup email domain policy updated")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email domain policy updated successfully", "policy": policy})
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/database"
+)
+
+// DryRunMiddleware honors ?dry_run=true on routes that support it: the
+// request is fully validated, including database constraints, but nothing
+// is persisted and no events are published.
+func DryRunMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value := c.Query("dry_run")
+		if value == "" {
+			c.Next()
+			return
+		}
+
+		dryRun, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "dry_run must be true or false"})
+			c.Abort()
+			return
+		}
+		if dryRun {
+			c.Request = c.Request.WithContext(database.WithDryRun(c.Request.Context()))
+		}
+		c.Next()
+	}
+}
+
+// isDryRun reports whether the request is a dry run
+func isDryRun(c *gin.Context) bool {
+	return database.IsDryRun(c.Request.Context())
+}
+
+// dryRunResponse builds the body returned instead of a mutation's usual
+// response, carrying the would-be result
+func dryRunResponse(body gin.H) gin.H {
+	body["message"] = "Dry run: request is valid, nothing was changed"
+	body["dry_run"] = true
+	return body
+}
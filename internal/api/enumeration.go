@@ -0,0 +1,49 @@
+package api
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/metrics"
+)
+
+// ConfigureEnumerationProtection hides which email addresses have accounts.
+// With uniformSignup, signup answers the same whether or not the address is
+// taken; with honeypot, signups filling in the hidden "website" field are
+// dropped; and login and signup wait a random time up to jitter.
+func (h *Handler) ConfigureEnumerationProtection(uniformSignup, honeypot bool, jitter time.Duration) {
+	h.uniformSignup = uniformSignup
+	h.honeypot = honeypot
+	h.jitter = jitter
+}
+
+// waitJitter sleeps for a random time up to the configured jitter, blurring
+// the timing differences left between outcomes. It returns early if the
+// request is cancelled.
+func (h *Handler) waitJitter(c *gin.Context) {
+	if h.jitter <= 0 {
+		return
+	}
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(h.jitter))))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-c.Request.Context().Done():
+	}
+}
+
+// recordEnumerationAttempt logs and counts a request that may be probing
+// which accounts exist
+func recordEnumerationAttempt(c *gin.Context, endpoint, signal, email string) {
+	metrics.RecordEnumerationAttempt(endpoint, signal)
+	logAuth(c, "enumeration_attempt", email).WithField("endpoint", endpoint).WithField("signal", signal).Warn("Possible account enumeration")
+}
+
+// respondSignupAccepted is the answer to every signup when signup must not
+// reveal whether the address was taken
+func respondSignupAccepted(c *gin.Context) {
+	c.JSON(http.StatusAccepted, gin.H{"message": "Check your email to continue"})
+}
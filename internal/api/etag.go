@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// userETag returns the strong entity tag of a user's current version
+func userETag(user *models.User) string {
+	return `"` + strconv.FormatUint(uint64(user.Version), 10) + `"`
+}
+
+// parseIfMatch returns the version named by an If-Match value. "*" matches
+// any version and yields 0.
+func parseIfMatch(header string) (uint, bool) {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return 0, true
+	}
+	if len(header) < 2 || header[0] != '"' || header[len(header)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.ParseUint(header[1:len(header)-1], 10, 32)
+	if err != nil || version == 0 {
+		return 0, false
+	}
+	return uint(version), true
+}
+
+// requireIfMatch reads the version the client expects to modify. It aborts
+// with 428 when If-Match is missing and 412 when it can't match any version.
+func requireIfMatch(c *gin.Context) (uint, bool) {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header with the user's ETag is required"})
+		return 0, false
+	}
+	version, ok := parseIfMatch(header)
+	if !ok {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "If-Match does not match the current version"})
+		return 0, false
+	}
+	return version, true
+}
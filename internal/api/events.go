@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/events"
+	"github.com/114windd/restapi/internal/logger"
+)
+
+// Default keep-alive interval of idle event streams, see ConfigureEventStream
+const defaultHeartbeat = 15 * time.Second
+
+// reconnectDelay is the retry interval suggested to EventSource clients
+const reconnectDelay = 3 * time.Second
+
+// ConfigureEventStream enables GET /events, streaming the hub's events with
+// a keep-alive comment every heartbeat while idle. Zero keeps the default.
+func (h *Handler) ConfigureEventStream(hub *events.Hub, heartbeat time.Duration) {
+	h.eventHub = hub
+	if heartbeat > 0 {
+		h.heartbeat = heartbeat
+	}
+}
+
+// StreamEvents streams user created/updated/deleted events of the caller's
+// tenant as Server-Sent Events. A client resumes after a disconnect by
+// sending the last id it received as Last-Event-ID (or ?last_event_id=);
+// if events it missed are no longer retained it first gets a "reset" event
+// and should reload its state.
+func (h *Handler) StreamEvents(c *gin.Context) {
+	if h.eventHub == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event streaming is not enabled"})
+		return
+	}
+
+	cursor := c.GetHeader("Last-Event-ID")
+	if cursor == "" {
+		cursor = c.Query("last_event_id")
+	}
+	var after uint64
+	if cursor != "" {
+		var err error
+		if after, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Last-Event-ID"})
+			return
+		}
+	}
+
+	sub, backlog, complete := h.eventHub.Subscribe(after)
+	defer sub.Close()
+	tenantID := database.TenantFromContext(c.Request.Context())
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // stop nginx from buffering the stream
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	fmt.Fprintf(w, "retry: %d\n\n", reconnectDelay.Milliseconds())
+	if !complete {
+		fmt.Fprint(w, "event: reset\ndata: {\"reason\":\"events since Last-Event-ID are no longer available\"}\n\n")
+	}
+	for _, record := range backlog {
+		if record.Event.TenantID == tenantID {
+			writeEvent(w, record)
+		}
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			w.Flush()
+		case record, ok := <-sub.C:
+			if !ok {
+				// Fell behind; the client reconnects and resumes from its last id
+				logger.Log.WithField("user_id", GetUserIDFromContext(c)).Warn("Event stream client too slow, disconnecting")
+				return
+			}
+			if record.Event.TenantID != tenantID {
+				continue
+			}
+			writeEvent(w, record)
+			w.Flush()
+		}
+	}
+}
+
+// writeEvent writes one record in the text/event-stream format
+func writeEvent(w io.Writer, record events.Record) {
+	data, err := json.Marshal(record.Event)
+	if err != nil {
+		logger.Log.WithError(err).WithField("type", record.Event.Type).Error("Failed to encode event")
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", record.ID, record.Event.Type, data)
+}
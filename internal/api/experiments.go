@@ -0,0 +1,52 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/experiments"
+	"github.com/114windd/restapi/internal/logger"
+)
+
+// ConfigureExperiments enables A/B experiment assignment
+func (h *Handler) ConfigureExperiments(service *experiments.Service) {
+	h.experiments = service
+}
+
+// GetMyExperiments returns the caller's variant in every running experiment
+func (h *Handler) GetMyExperiments(c *gin.Context) {
+	assignments := []experiments.Assignment{}
+	if h.experiments != nil {
+		assignments = h.experiments.Assignments(c.GetUint("user_id"))
+	}
+
+	c.Header("Cache-Control", "private, no-cache")
+	c.JSON(http.StatusOK, gin.H{"experiments": assignments})
+}
+
+// RecordMyExposure records that the caller was shown their variant of an
+// experiment. Clients call it when the variant is actually rendered, so
+// analysis only counts users who saw it.
+func (h *Handler) RecordMyExposure(c *gin.Context) {
+	if h.experiments == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Experiment not found"})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	key := c.Param("key")
+	assignment, err := h.experiments.RecordExposure(c.Request.Context(), userID, key)
+	if err != nil {
+		if errors.Is(err, experiments.ErrUnknownExperiment) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Experiment not found"})
+			return
+		}
+		logger.LogDatabase("create", "experiment_exposures").WithError(err).WithField("experiment", key).Error("Failed to record experiment exposure")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record exposure"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"experiment": assignment})
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/auth"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+	logger.Init()
+	logger.Log.SetOutput(io.Discard)
+}
+
+func FuzzAuthMiddleware(f *testing.F) {
+	tokens := auth.NewTokens([]byte("fuzz-secret"))
+	valid, err := tokens.GenerateToken(auth.Identity{UserID: 7, Role: "user", TenantID: "default"})
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, seed := range []string{"", "Bearer ", "Bearer " + valid, valid, "Basic dXNlcjpwYXNz", "Bearer a.b.c", "Bearer " + valid + "."} {
+		f.Add(seed)
+	}
+
+	h := NewHandler(nil, tokens)
+	f.Fuzz(func(t *testing.T, header string) {
+		r := gin.New()
+		next := false
+		r.GET("/", h.AuthMiddleware(), func(c *gin.Context) {
+			next = true
+			if _, ok := auth.IdentityFromContext(c.Request.Context()); !ok {
+				t.Fatal("authenticated request carries no identity")
+			}
+		})
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header["Authorization"] = []string{header}
+		r.ServeHTTP(w, req)
+
+		if !next && w.Code != http.StatusUnauthorized {
+			t.Fatalf("rejected request: expected 401, got %d", w.Code)
+		}
+	})
+}
+
+func FuzzBindJSON(f *testing.F) {
+	for _, seed := range []string{
+		`{"name":"Alice","email":"alice@example.com","password":"password123"}`,
+		`{"email":"alice@example.com","password":"password123","totp_code":"123456"}`,
+		`{"ids":[1,2,3]}`,
+		`{"name":null,"phone":"+14155550100","attributes":{"plan":"pro"}}`,
+		`{"ids":[-1]}`,
+		`{"ids":"1"}`,
+		`{"attributes":[[[[[[[[[[]]]]]]]]]]}`,
+		`{"name":1e400}`,
+		`[]`,
+		`null`,
+		``,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	binders := map[string]func() interface{}{
+		"signup":      func() interface{} { return &models.SignupRequest{} },
+		"login":       func() interface{} { return &models.LoginRequest{} },
+		"batch_get":   func() interface{} { return &models.BatchGetUsersRequest{} },
+		"rest_update": func() interface{} { return &models.RestUpdateUserRequest{} },
+		"patch":       func() interface{} { return &models.PatchUserRequest{} },
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		for name, newRequest := range binders {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			if err := c.ShouldBindJSON(newRequest()); err != nil {
+				respondBindError(c, err)
+				if w.Code != http.StatusBadRequest {
+					t.Fatalf("%s: expected 400 for a rejected body, got %d", name, w.Code)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/graphql"
+	"github.com/114windd/restapi/internal/router"
+)
+
+// ConfigureGraphQL enables the /graphql endpoint, and the in-browser
+// playground at /graphql/playground when playground is set
+func (h *Handler) ConfigureGraphQL(server *graphql.Server, playground bool) {
+	h.graphql = server
+	h.graphqlPlayground = playground
+}
+
+// GraphQLRoutes serves GraphQL at /graphql behind the same authentication
+// as the REST API. It returns nothing until ConfigureGraphQL is called.
+func (h *Handler) GraphQLRoutes() []router.Route {
+	if h.graphql == nil {
+		return nil
+	}
+	routes := []router.Route{
+		// Queries are reads, and mutations refuse impersonation tokens themselves
+		{Method: http.MethodPost, Path: "/graphql", Handler: h.GraphQL, Summary: "Run a GraphQL query or mutation", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout, ReadOnly: true},
+	}
+	if h.graphqlPlayground {
+		// The page itself is public; queries it sends carry the token entered in its headers editor
+		routes = append(routes, router.Route{Method: http.MethodGet, Path: "/graphql/playground", Handler: GraphQLPlayground, Summary: "In-browser GraphQL IDE", RateLimit: router.RateLimitDefault, Timeout: h.timeout})
+	}
+	return routes
+}
+
+// GraphQL executes a request. As is conventional for GraphQL, query errors
+// are reported in the response's "errors" with status 200.
+func (h *Handler) GraphQL(c *gin.Context) {
+	var req graphql.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, h.graphql.Execute(c.Request.Context(), req))
+}
+
+// GraphQLPlayground serves GraphiQL pointed at /graphql
+func GraphQLPlayground(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(playgroundPage))
+}
+
+const playgroundPage = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>GraphQL Playground</title>
+  <link rel="stylesheet" href="https://unpkg.com/graphiql@3/graphiql.min.css">
+  <style>body { margin: 0; height: 100vh; } #graphiql { height: 100vh; }</style>
+</head>
+<body>
+  <div id="graphiql"></div>
+  <script src="https://unpkg.com/react@18/umd/react.production.min.js"></script>
+  <script src="https://unpkg.com/react-dom@18/umd/react-dom.production.min.js"></script>
+  <script src="https://unpkg.com/graphiql@3/graphiql.min.js"></script>
+  <script>
+    const fetcher = GraphiQL.createFetcher({ url: "/graphql" });
+    ReactDOM.createRoot(document.getElementById("graphiql")).render(
+      React.createElement(GraphiQL, {
+        fetcher: fetcher,
+        defaultHeaders: '{\n  "Authorization": "Bearer <token>"\n}',
+        isHeadersEditorEnabled: true,
+      })
+    );
+  </script>
+</body>
+</html>
+`
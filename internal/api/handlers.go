@@ -1,38 +1,140 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
-
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/auth"
+	"github.com/114windd/restapi/internal/bruteforce"
+	"github.com/114windd/restapi/internal/cache"
+	"github.com/114windd/restapi/internal/captcha"
+	"github.com/114windd/restapi/internal/consent"
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/events"
+	"github.com/114windd/restapi/internal/experiments"
+	"github.com/114windd/restapi/internal/graphql"
+	"github.com/114windd/restapi/internal/invitation"
 	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/oauth"
+	"github.com/114windd/restapi/internal/organization"
+	"github.com/114windd/restapi/internal/phone"
+	"github.com/114windd/restapi/internal/preferences"
+	"github.com/114windd/restapi/internal/privacy"
+	"github.com/114windd/restapi/internal/recovery"
+	"github.com/114windd/restapi/internal/router"
+	"github.com/114windd/restapi/internal/security"
 	"github.com/114windd/restapi/internal/service"
+	"github.com/114windd/restapi/internal/session"
+	"github.com/114windd/restapi/internal/slo"
+	"github.com/114windd/restapi/internal/sms"
+	"github.com/114windd/restapi/internal/storage"
 	"github.com/114windd/restapi/pkg/models"
 )
 
-var (
-	jwtSecret = []byte("mock-secret-key")
-)
+// Handler serves the REST API on top of the application's services
+type Handler struct {
+	users       *service.UserService
+	tokens      *auth.Tokens
+	sessions    *session.Manager
+	captcha     *captcha.Challenge
+	bruteForce  *bruteforce.Guard
+	experiments *experiments.Service
+	slo         *slo.Tracker
+	recovery    *recovery.Service
+	privacy     *privacy.Service
+	consent     *consent.Service
+	preferences *preferences.Service
+	invitations *invitation.Service
+	orgs        *organization.Service
+	oauth       map[string]oauth.Provider
+	heldLogins  cache.Store
+	limiter     *router.Limiter
+	objects     storage.ObjectStore
+	graphql     *graphql.Server
+	eventHub    *events.Hub
+	phone       *phone.Service
+	sms         *sms.Client
+	anomaly     *security.Monitor
+	stepUp      *security.StepUp
+
+	emailCheckCaptcha bool
+	uniformSignup     bool
+	honeypot          bool
+	otpLogin          bool
+	graphqlPlayground bool
+	adminUI           bool
+	maxAvatarBytes    int64
+	impersonationTTL  time.Duration
+	timeout           time.Duration
+	longTimeout       time.Duration
+	heartbeat         time.Duration
+	jitter            time.Duration
+}
+
+// NewHandler creates a Handler. Sessions, CAPTCHA challenges, login delays,
+// experiments, SLO reports, account recovery, data exports, terms of service
+// tracking, social login, avatar uploads, GraphQL, the event stream, phone
+// verification, anomaly detection and the admin dashboard are disabled until
+// configured.
+func NewHandler(users *service.UserService, tokens *auth.Tokens) *Handler {
+	return &Handler{users: users, tokens: tokens, timeout: defaultTimeout, longTimeout: longTimeout, impersonationTTL: defaultImpersonationTTL, heartbeat: defaultHeartbeat}
+}
 
 // Auth handlers
-func Signup(c *gin.Context) {
+func (h *Handler) Signup(c *gin.Context) {
 	var req models.SignupRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		logger.Log.WithError(err).Warn("Invalid signup request")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
-	logger.LogAuth("signup_attempt", req.Email).Info("User signup attempt")
+	h.waitJitter(c)
+	logAuth(c, "signup_attempt", req.Email).Info("User signup attempt")
+
+	if h.honeypot && req.Website != "" {
+		recordEnumerationAttempt(c, "signup", "honeypot", req.Email)
+		h.recordAuthFailure(c, "")
+		respondSignupAccepted(c)
+		return
+	}
+	if !h.requireCaptcha(c, req.CaptchaToken, "") {
+		return
+	}
+	if req.TermsVersion != "" && h.consent != nil && req.TermsVersion != h.consent.TermsVersion() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only the current terms of service can be accepted", "code": "stale_terms_version", "terms_version": h.consent.TermsVersion()})
+		return
+	}
 
 	// Use the service layer
-	user, err := service.CreateUser(req.Name, req.Email, req.Password)
+	user, err := h.users.CreateUser(c.Request.Context(), req.Name, req.Email, req.Password, req.Attributes)
 	if err != nil {
-		if strings.Contains(err.Error(), "duplicate key") {
+		if errors.Is(err, service.ErrEmailDomainNotAllowed) {
+			logAuth(c, "signup_domain_rejected", req.Email).Warn("Signup rejected by email domain policy")
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": "email_domain_not_allowed"})
+			return
+		}
+		if errors.Is(err, service.ErrInvalidAttributes) {
+			h.recordAuthFailure(c, "")
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrEmailTaken) {
+			h.recordAuthFailure(c, "")
+			recordEnumerationAttempt(c, "signup", "email_taken", req.Email)
+			if h.uniformSignup {
+				// Spend the time of hashing the password of a new account
+				h.users.SimulatePasswordCheck(req.Password)
+				h.users.NotifyExistingAccount(c.Request.Context(), req.Email)
+				respondSignupAccepted(c)
+				return
+			}
 			c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
 			return
 		}
@@ -40,87 +142,224 @@ func Signup(c *gin.Context) {
 		return
 	}
 
+	if h.uniformSignup {
+		// New accounts log in like existing ones, so dry runs answer the same too
+		if !isDryRun(c) {
+			h.acceptTermsOnSignup(c, user.ID, req.TermsVersion)
+			logAuth(c, "signup_success", req.Email).WithField("user_id", user.ID).Info("User created successfully")
+		}
+		respondSignupAccepted(c)
+		return
+	}
+	if isDryRun(c) {
+		c.JSON(http.StatusOK, dryRunResponse(gin.H{"user": user}))
+		return
+	}
+	h.acceptTermsOnSignup(c, user.ID, req.TermsVersion)
+
 	// Generate JWT
-	token, err := generateJWT(user.ID)
+	token, refreshToken, err := h.issueTokens(c, user)
 	if err != nil {
 		logger.Log.WithError(err).Error("Failed to generate JWT")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	logger.LogAuth("signup_success", req.Email).WithField("user_id", user.ID).Info("User created successfully")
+	logAuth(c, "signup_success", req.Email).WithField("user_id", user.ID).Info("User created successfully")
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message": "User created successfully",
-		"user":    user,
-		"token":   token,
-	})
+	c.JSON(http.StatusCreated, tokenResponse("User created successfully", user, token, refreshToken))
 }
 
-func Login(c *gin.Context) {
+func (h *Handler) Login(c *gin.Context) {
 	var req models.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		logger.Log.WithError(err).Warn("Invalid login request")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
-	logger.LogAuth("login_attempt", req.Email).Info("User login attempt")
+	h.waitJitter(c)
+	logAuth(c, "login_attempt", req.Email).Info("User login attempt")
+
+	if !h.delayLogin(c, req.Email) {
+		return
+	}
+	if !h.requireCaptcha(c, req.CaptchaToken, req.Email) {
+		return
+	}
 
 	// Use the service layer
-	user, err := service.GetUserByEmail(req.Email)
+	user, err := h.users.GetUserByEmail(c.Request.Context(), req.Email)
 	if err != nil {
-		logger.LogAuth("login_failed", req.Email).Warn("User not found")
+		// Answer like a wrong password, and as slowly
+		h.users.SimulatePasswordCheck(req.Password)
+		logAuth(c, "login_failed", req.Email).Warn("User not found")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			recordEnumerationAttempt(c, "login", "unknown_account", req.Email)
+		}
+		h.recordAuthFailure(c, req.Email)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
 	// Check password
-	if err := service.ValidatePassword(user, req.Password); err != nil {
-		logger.LogAuth("login_failed", req.Email).Warn("Invalid password")
+	if err := h.users.ValidatePassword(user, req.Password); err != nil {
+		logAuth(c, "login_failed", req.Email).Warn("Invalid password")
+		h.recordAuthFailure(c, req.Email)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
+	if !h.rejectInactive(c, user) {
+		return
+	}
+
+	// Second factor, once the password is known to be right
+	if !h.requireSecondFactor(c, user, req.TOTPCode) || !h.screenLogin(c, user, req.Email, req.StepUpCode, true) {
+		return
+	}
+
+	h.resetAuthFailures(c, req.Email)
+	if err := h.users.RecordLogin(c.Request.Context(), user); err != nil {
+		logAuth(c, "login_success", req.Email).WithError(err).Warn("Failed to record last login")
+	}
+
 	// Generate JWT
-	token, err := generateJWT(user.ID)
+	token, refreshToken, err := h.issueTokens(c, user)
 	if err != nil {
 		logger.Log.WithError(err).Error("Failed to generate JWT")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	logger.LogAuth("login_success", req.Email).WithField("user_id", user.ID).Info("User logged in successfully")
+	logAuth(c, "login_success", req.Email).WithField("user_id", user.ID).Info("User logged in successfully")
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Login successful",
-		"user":    user,
-		"token":   token,
-	})
+	c.JSON(http.StatusOK, tokenResponse("Login successful", user, token, refreshToken))
+}
+
+// requireSecondFactor checks the authenticator or backup code of a user
+// with 2FA enabled, once their first factor is known to be right. It
+// writes the error response and returns false when the login must not
+// proceed.
+func (h *Handler) requireSecondFactor(c *gin.Context, user *models.User, code string) bool {
+	if !user.TwoFactorEnabled {
+		return true
+	}
+	if code == "" {
+		logAuth(c, "login_2fa_required", user.Email).Info("Two-factor code required")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Two-factor code required", "code": "two_factor_required"})
+		return false
+	}
+	if err := h.users.VerifySecondFactor(c.Request.Context(), user, code); err != nil {
+		if !errors.Is(err, service.ErrInvalidTwoFactorCode) {
+			logAuth(c, "login_failed", user.Email).WithError(err).Error("Failed to verify two-factor code")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify two-factor code"})
+			return false
+		}
+		logAuth(c, "login_failed", user.Email).Warn("Invalid two-factor code")
+		h.recordAuthFailure(c, user.Email)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code", "code": "invalid_two_factor_code"})
+		return false
+	}
+	return true
 }
 
 // CRUD handlers
-func GetUsers(c *gin.Context) {
-	users, err := service.ListUsers()
+
+// userFilters reads the status and attr.<name>=<value> filters of a user
+// listing, answering 400 when the status is unknown
+func userFilters(c *gin.Context) (string, map[string]string, bool) {
+	attributeFilters := make(map[string]string)
+	for key, values := range c.Request.URL.Query() {
+		if name, ok := strings.CutPrefix(key, "attr."); ok && len(values) > 0 {
+			attributeFilters[name] = values[0]
+		}
+	}
+
+	status := c.Query("status")
+	if status != "" && !models.ValidUserStatus(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be active, suspended or deactivated"})
+		return "", nil, false
+	}
+	return status, attributeFilters, true
+}
+
+// GetUsers lists users, up to service.MaxListUsers; the response says
+// "truncated" when more matched
+func (h *Handler) GetUsers(c *gin.Context) {
+	status, attributeFilters, ok := userFilters(c)
+	if !ok {
+		return
+	}
+
+	users, truncated, err := h.users.ListUsers(c.Request.Context(), status, attributeFilters)
 	if err != nil {
 		logger.LogDatabase("select", "users").WithError(err).Error("Failed to fetch users")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
 		return
 	}
 
-	logger.LogDatabase("select", "users").WithField("count", len(users)).Info("Users fetched successfully")
+	logger.LogDatabase("select", "users").WithField("count", len(users)).WithField("truncated", truncated).Info("Users fetched successfully")
+	if truncated {
+		c.JSON(http.StatusOK, gin.H{"users": users, "truncated": true})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+func (h *Handler) SearchUsers(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	users, err := h.users.SearchUsers(c.Request.Context(), c.Query("q"), limit)
+	if err != nil {
+		if errors.Is(err, service.ErrEmptySearchQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		logger.LogDatabase("select", "users").WithError(err).Error("Failed to search users")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search users"})
+		return
+	}
+
+	logger.LogDatabase("select", "users").WithField("count", len(users)).Info("Users searched successfully")
 	c.JSON(http.StatusOK, gin.H{"users": users})
 }
 
-func GetUser(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
+func (h *Handler) GetUserStats(c *gin.Context) {
+	stats, err := h.users.GetUserStats(c.Request.Context())
 	if err != nil {
-		logger.Log.WithError(err).Warn("Invalid user ID format")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		logger.LogDatabase("select", "users").WithError(err).Error("Failed to compute user stats")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute user stats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"stats": stats})
+}
+
+// WarmCache preloads the cache, e.g. after a failover
+func (h *Handler) WarmCache(c *gin.Context) {
+	n, err := strconv.Atoi(c.DefaultQuery("users", "100"))
+	if err != nil || n < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid users count"})
+		return
+	}
+
+	if err := h.users.WarmCache(c.Request.Context(), n); err != nil {
+		logger.Log.WithError(err).Error("Failed to warm cache")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to warm cache"})
 		return
 	}
 
-	user, err := service.GetUser(uint(id))
+	c.JSON(http.StatusOK, gin.H{"message": "Cache warmed successfully"})
+}
+
+func (h *Handler) GetUser(c *gin.Context) {
+	id, ok := parseID(c, "user")
+	if !ok {
+		return
+	}
+
+	user, err := h.users.GetUser(c.Request.Context(), id)
 	if err != nil {
 		logger.LogDatabase("select", "users").WithField("user_id", id).Warn("User not found")
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
@@ -128,27 +367,74 @@ func GetUser(c *gin.Context) {
 	}
 
 	logger.LogDatabase("select", "users").WithField("user_id", id).Info("User fetched successfully")
+	c.Header("ETag", userETag(user))
 	c.JSON(http.StatusOK, gin.H{"user": user})
 }
 
-func UpdateUser(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
+// BatchGetUsers fetches many users in one query, for clients hydrating
+// lists of user references
+func (h *Handler) BatchGetUsers(c *gin.Context) {
+	var req models.BatchGetUsersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	users, missing, err := h.users.GetUsersByIDs(c.Request.Context(), req.IDs)
 	if err != nil {
-		logger.Log.WithError(err).Warn("Invalid user ID format")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		logger.LogDatabase("select", "users").WithError(err).Error("Failed to batch fetch users")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+	if missing == nil {
+		missing = []uint{}
+	}
+
+	logger.LogDatabase("select", "users").WithField("count", len(users)).Info("Users batch fetched successfully")
+	c.JSON(http.StatusOK, gin.H{"users": users, "missing_ids": missing})
+}
+
+func (h *Handler) UpdateUser(c *gin.Context) {
+	id, ok := parseID(c, "user")
+	if !ok {
+		return
+	}
+
+	if !requireUserOwnership(c, id) {
+		return
+	}
+
+	version, ok := requireIfMatch(c)
+	if !ok {
 		return
 	}
 
 	var req models.RestUpdateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		logger.Log.WithError(err).Warn("Invalid update request")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
-	user, err := service.UpdateUser(uint(id), req.Name, req.Email)
+	user, err := h.users.UpdateUser(c.Request.Context(), id, version, req)
 	if err != nil {
-		if strings.Contains(err.Error(), "duplicate key") {
+		if errors.Is(err, service.ErrInvalidAttributes) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrInvalidUpdate) {
+			respondBindError(c, err)
+			return
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if errors.Is(err, service.ErrVersionConflict) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "User was modified by another request; fetch it again and retry"})
+			return
+		}
+		if errors.Is(err, service.ErrEmailTaken) {
 			c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
 			return
 		}
@@ -156,44 +442,115 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
+	if isDryRun(c) {
+		c.JSON(http.StatusOK, dryRunResponse(gin.H{"user": user}))
+		return
+	}
+
 	logger.LogDatabase("update", "users").WithField("user_id", id).Info("User updated successfully")
 
+	c.Header("ETag", userETag(user))
 	c.JSON(http.StatusOK, gin.H{
 		"message": "User updated successfully",
 		"user":    user,
 	})
 }
 
-func DeleteUser(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
+func (h *Handler) PatchUser(c *gin.Context) {
+	id, ok := parseID(c, "user")
+	if !ok {
+		return
+	}
+
+	if !requireUserOwnership(c, id) {
+		return
+	}
+
+	version, ok := requireIfMatch(c)
+	if !ok {
+		return
+	}
+
+	var req models.PatchUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Log.WithError(err).Warn("Invalid patch request")
+		respondBindError(c, err)
+		return
+	}
+
+	user, err := h.users.PatchUser(c.Request.Context(), id, version, req)
 	if err != nil {
-		logger.Log.WithError(err).Warn("Invalid user ID format")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		if errors.Is(err, service.ErrInvalidAttributes) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrInvalidUpdate) {
+			respondBindError(c, err)
+			return
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if errors.Is(err, service.ErrVersionConflict) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "User was modified by another request; fetch it again and retry"})
+			return
+		}
+		if errors.Is(err, service.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+
+	if isDryRun(c) {
+		c.JSON(http.StatusOK, dryRunResponse(gin.H{"user": user}))
+		return
+	}
+
+	logger.LogDatabase("update", "users").WithField("user_id", id).Info("User patched successfully")
+
+	c.Header("ETag", userETag(user))
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User updated successfully",
+		"user":    user,
+	})
+}
+
+func (h *Handler) DeleteUser(c *gin.Context) {
+	id, ok := parseID(c, "user")
+	if !ok {
 		return
 	}
 
-	if err := service.DeleteUser(uint(id)); err != nil {
+	if !requireUserOwnership(c, id) {
+		return
+	}
+
+	// Like DELETE /me, erasure also revokes the user's sessions and removes
+	// their exports
+	deleteUser := h.users.DeleteUser
+	if h.privacy != nil {
+		deleteUser = h.privacy.Erase
+	}
+	if err := deleteUser(c.Request.Context(), id); err != nil {
 		logger.LogDatabase("delete", "users").WithError(err).WithField("user_id", id).Error("Failed to delete user")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
 		return
 	}
 
+	if isDryRun(c) {
+		c.JSON(http.StatusOK, dryRunResponse(gin.H{}))
+		return
+	}
+
 	logger.LogDatabase("delete", "users").WithField("user_id", id).Info("User deleted successfully")
 
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
 
-// JWT helper functions
-func generateJWT(userID uint) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
-}
-
-func AuthMiddleware() gin.HandlerFunc {
+func (h *Handler) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -204,24 +561,72 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
-
-		if err != nil || !token.Valid {
+		identity, err := h.tokens.Authenticate(c.Request.Context(), tokenString)
+		if err != nil {
 			logger.Log.WithError(err).Warn("Invalid JWT token")
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
-		claims := token.Claims.(jwt.MapClaims)
-		userID := uint(claims["user_id"].(float64))
-		c.Set("user_id", userID)
+		c.Set("user_id", identity.UserID)
+		c.Set("role", identity.Role)
+		// subject_id is whose data the request acts on, actor_id who is acting;
+		// they differ only for impersonation tokens
+		c.Set("subject_id", identity.UserID)
+		c.Set("actor_id", identity.Actor())
+		ctx := auth.WithIdentity(c.Request.Context(), identity)
+		if identity.TenantID != "" {
+			// The token's tenant is authoritative over any X-Tenant-ID header
+			ctx = database.WithTenant(ctx, identity.TenantID)
+		}
+		c.Request = c.Request.WithContext(ctx)
+
+		if identity.IsImpersonated() {
+			if !guardImpersonation(c, identity) {
+				return
+			}
+			c.Next()
+			auditImpersonatedRequest(c, identity)
+			return
+		}
 		c.Next()
 	}
 }
 
+// AdminMiddleware restricts access to users with the admin role.
+// It must run after AuthMiddleware.
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("role") != models.RoleAdmin {
+			logger.Log.WithField("user_id", GetUserIDFromContext(c)).Warn("Admin access denied")
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// currentIdentity returns the authenticated caller set by AuthMiddleware
+func currentIdentity(c *gin.Context) *auth.Identity {
+	identity, _ := auth.IdentityFromContext(c.Request.Context())
+	return identity
+}
+
+// requireUserOwnership aborts with 403 unless the caller may modify the target user
+func requireUserOwnership(c *gin.Context, targetID uint) bool {
+	if currentIdentity(c).CanModifyUser(targetID) {
+		return true
+	}
+	logger.Log.WithFields(map[string]interface{}{
+		"user_id":        GetUserIDFromContext(c),
+		"target_user_id": targetID,
+	}).Warn("Forbidden attempt to modify another user")
+	c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to modify this user"})
+	return false
+}
+
 // Helper to get user ID from context for logging
 func GetUserIDFromContext(c *gin.Context) string {
 	if userID, exists := c.Get("user_id"); exists {
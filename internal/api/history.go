@@ -0,0 +1,53 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/service"
+)
+
+// GetUserHistory returns the recorded snapshots of a user (admin only).
+// With ?at=<RFC3339> only the snapshot valid at that time is returned.
+func (h *Handler) GetUserHistory(c *gin.Context) {
+	id, ok := parseID(c, "user")
+	if !ok {
+		return
+	}
+
+	if raw := c.Query("at"); raw != "" {
+		at, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "at must be an RFC 3339 timestamp"})
+			return
+		}
+
+		snapshot, err := h.users.GetUserAt(c.Request.Context(), id, at)
+		if err != nil {
+			h.userHistoryError(c, id, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"snapshot": snapshot})
+		return
+	}
+
+	history, err := h.users.GetUserHistory(c.Request.Context(), id)
+	if err != nil {
+		h.userHistoryError(c, id, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"history": history})
+}
+
+func (h *Handler) userHistoryError(c *gin.Context, id uint, err error) {
+	if errors.Is(err, service.ErrNoUserHistory) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No history found for user"})
+		return
+	}
+	logger.LogDatabase("select", "users_history").WithError(err).WithField("user_id", id).Error("Failed to fetch user history")
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user history"})
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/invitation"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/service"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// ConfigureInvitations enables admin invitations
+func (h *Handler) ConfigureInvitations(service *invitation.Service) {
+	h.invitations = service
+}
+
+// Invitation handlers (admin only, except AcceptInvitation)
+
+// GetInvitations lists invitations, optionally filtered by ?status=
+func (h *Handler) GetInvitations(c *gin.Context) {
+	if !h.requireInvitations(c) {
+		return
+	}
+
+	status := c.Query("status")
+	switch status {
+	case "", models.InvitationPending, models.InvitationAccepted, models.InvitationExpired:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status filter"})
+		return
+	}
+
+	invitations, err := h.invitations.List(c.Request.Context(), status)
+	if err != nil {
+		logger.LogDatabase("select", "invitations").WithError(err).Error("Failed to list invitations")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invitations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invitations": invitations})
+}
+
+// CreateInvitation creates an invited account and emails the invitee a
+// token to activate it
+func (h *Handler) CreateInvitation(c *gin.Context) {
+	if !h.requireInvitations(c) {
+		return
+	}
+
+	var req models.CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	inv, _, err := h.invitations.Invite(c.Request.Context(), currentIdentity(c).UserID, req)
+	if err != nil {
+		invitationError(c, err, "Failed to create invitation")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Invitation sent", "invitation": inv})
+}
+
+// GetInvitation returns an invitation
+func (h *Handler) GetInvitation(c *gin.Context) {
+	id, ok := h.invitationID(c)
+	if !ok {
+		return
+	}
+
+	inv, err := h.invitations.Get(c.Request.Context(), id)
+	if err != nil {
+		invitationError(c, err, "Failed to fetch invitation")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invitation": inv})
+}
+
+// ResendInvitation emails a new token to an invitee who hasn't accepted yet,
+// restarting the expiry; the previous token stops working
+func (h *Handler) ResendInvitation(c *gin.Context) {
+	id, ok := h.invitationID(c)
+	if !ok {
+		return
+	}
+
+	inv, _, err := h.invitations.Resend(c.Request.Context(), id)
+	if err != nil {
+		invitationError(c, err, "Failed to resend invitation")
+		return
+	}
+
+	logger.Log.WithField("invitation_id", inv.ID).WithField("admin_id", GetUserIDFromContext(c)).Info("Invitation resent")
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation resent", "invitation": inv})
+}
+
+// AcceptInvitation activates an invited account with the password the
+// invitee chose and signs them in
+func (h *Handler) AcceptInvitation(c *gin.Context) {
+	if !h.requireInvitations(c) {
+		return
+	}
+
+	var req models.AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	user, err := h.invitations.Accept(c.Request.Context(), c.Param("token"), req.Name, req.Password)
+	if err != nil {
+		if errors.Is(err, invitation.ErrInvalidToken) {
+			h.recordAuthFailure(c, "")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired invitation"})
+			return
+		}
+		invitationError(c, err, "Failed to accept invitation")
+		return
+	}
+
+	token, refreshToken, err := h.issueTokens(c, user)
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to generate JWT")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	c.JSON(http.StatusOK, tokenResponse("Invitation accepted", user, token, refreshToken))
+}
+
+// requireInvitations responds 404 when invitations are not configured
+func (h *Handler) requireInvitations(c *gin.Context) bool {
+	if h.invitations == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitations are not enabled"})
+		return false
+	}
+	return true
+}
+
+// invitationID parses the :id parameter of an invitation route
+func (h *Handler) invitationID(c *gin.Context) (uint, bool) {
+	if !h.requireInvitations(c) {
+		return 0, false
+	}
+	return parseID(c, "invitation")
+}
+
+// invitationError maps invitation errors to responses
+func invitationError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+	case errors.Is(err, invitation.ErrAlreadyAccepted), errors.Is(err, service.ErrNotInvited):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrEmailDomainNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": "email_domain_not_allowed"})
+	case errors.Is(err, service.ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already in use"})
+	case errors.Is(err, service.ErrInvalidAttributes):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		logger.Log.WithError(err).Error(message)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
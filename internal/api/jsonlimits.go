@@ -0,0 +1,93 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// errJSONTooDeep is returned by checkJSON for bodies nested beyond the limit
+var errJSONTooDeep = errors.New("JSON body is nested too deeply")
+
+// duplicateKeyError is returned by checkJSON for an object naming a key twice,
+// which encoding/json would silently resolve to the last value
+type duplicateKeyError struct {
+	Key string
+}
+
+func (e *duplicateKeyError) Error() string {
+	return fmt.Sprintf("JSON body has a duplicate key %q", e.Key)
+}
+
+// isJSON reports whether mediaType is JSON, including +json suffixed types
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// jsonFrame is an object or array being scanned by checkJSON
+type jsonFrame struct {
+	object bool
+	// expectKey is set in an object when the next token is a key
+	expectKey bool
+	keys      map[string]bool
+}
+
+// checkJSON scans data without decoding it, rejecting objects and arrays
+// nested deeper than maxDepth (0 disables) and, unless allowDuplicates,
+// objects naming a key twice. Malformed JSON is left to the binder to report.
+func checkJSON(data []byte, maxDepth int, allowDuplicates bool) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var stack []*jsonFrame
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			// io.EOF at the end of the body, or a syntax error for the binder
+			return nil
+		}
+
+		var top *jsonFrame
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+		switch tok {
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+			if len(stack) > 0 && stack[len(stack)-1].object {
+				stack[len(stack)-1].expectKey = true
+			}
+			continue
+		}
+
+		if top != nil && top.expectKey {
+			key, _ := tok.(string)
+			if !allowDuplicates {
+				if top.keys[key] {
+					return &duplicateKeyError{Key: key}
+				}
+				top.keys[key] = true
+			}
+			top.expectKey = false
+			continue
+		}
+
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			if maxDepth > 0 && len(stack) >= maxDepth {
+				return errJSONTooDeep
+			}
+			frame := &jsonFrame{object: tok == json.Delim('{')}
+			frame.expectKey = frame.object
+			if frame.object && !allowDuplicates {
+				frame.keys = make(map[string]bool)
+			}
+			stack = append(stack, frame)
+		default:
+			if top != nil && top.object {
+				top.expectKey = true
+			}
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckJSON(t *testing.T) {
+	var duplicate *duplicateKeyError
+	tests := []struct {
+		body       string
+		maxDepth   int
+		duplicates bool
+		check      func(error) bool
+	}{
+		{`{"a":1,"b":[1,2,{"c":null}]}`, 3, false, func(err error) bool { return err == nil }},
+		{`{"a":1,"b":[1,2,{"c":null}]}`, 2, false, func(err error) bool { return errors.Is(err, errJSONTooDeep) }},
+		{strings.Repeat("[", 100) + strings.Repeat("]", 100), 0, false, func(err error) bool { return err == nil }},
+		{`{"a":1,"a":2}`, 0, false, func(err error) bool { return errors.As(err, &duplicate) && duplicate.Key == "a" }},
+		{`{"a":1,"a":2}`, 0, true, func(err error) bool { return err == nil }},
+		// Keys only clash within one object, not with keys of nested or sibling objects
+		{`{"a":{"a":1},"b":[{"a":1},{"a":2}]}`, 0, false, func(err error) bool { return err == nil }},
+		{`{"a":{"b":1,"b":2}}`, 0, false, func(err error) bool { return errors.As(err, &duplicate) && duplicate.Key == "b" }},
+		{`{"a":[{}],"b":1,"b":2}`, 0, false, func(err error) bool { return errors.As(err, &duplicate) && duplicate.Key == "b" }},
+		// Malformed JSON is left to the binder
+		{`{"a":`, 1, false, func(err error) bool { return err == nil }},
+	}
+	for _, tt := range tests {
+		if err := checkJSON([]byte(tt.body), tt.maxDepth, tt.duplicates); !tt.check(err) {
+			t.Errorf("checkJSON(%s, %d, %t): unexpected result %v", tt.body, tt.maxDepth, tt.duplicates, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/i18n"
+	"github.com/114windd/restapi/internal/logger"
+)
+
+// LocalizationMiddleware negotiates the response language from the
+// Accept-Language header, announces it in Content-Language and stores it
+// in the request context for i18n.FromContext. JSON responses get their
+// "error" and "message" texts and the messages of rejected "fields"
+// translated; codes, field names and data are left alone so clients can
+// keep matching on them.
+func LocalizationMiddleware(catalog *i18n.Catalog) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept-Language")
+		lang := catalog.Negotiate(c.GetHeader("Accept-Language"))
+		c.Header("Content-Language", lang)
+		c.Request = c.Request.WithContext(i18n.WithLanguage(c.Request.Context(), lang))
+		if lang == i18n.Default {
+			c.Next()
+			return
+		}
+
+		writer := &bufferedJSONWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if !writer.buffering {
+			return
+		}
+		body := writer.buf.Bytes()
+		if translated, err := translateMessages(catalog, lang, body); err == nil {
+			body = translated
+		} else {
+			logger.Log.WithError(err).Warn("Failed to translate response")
+		}
+
+		if _, err := c.Writer.Write(body); err != nil {
+			logger.Log.WithError(err).Debug("Failed to write response")
+		}
+	}
+}
+
+// translateMessages rewrites the human-readable texts of a JSON body into
+// lang. Bodies without any are returned unchanged.
+func translateMessages(catalog *i18n.Catalog, lang string, body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	object, ok := doc.(map[string]interface{})
+	if !ok {
+		return body, nil
+	}
+
+	changed := false
+	for _, key := range []string{"error", "message"} {
+		if text, ok := object[key].(string); ok {
+			object[key] = catalog.Translate(lang, text)
+			changed = true
+		}
+	}
+	if fields, ok := object["fields"].([]interface{}); ok {
+		for _, field := range fields {
+			if fe, ok := field.(map[string]interface{}); ok {
+				if text, ok := fe["message"].(string); ok {
+					fe["message"] = catalog.Translate(lang, text)
+					changed = true
+				}
+			}
+		}
+	}
+	if !changed {
+		return body, nil
+	}
+	return json.Marshal(object)
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/logger"
+)
+
+// logLevelsRequest replaces the default log level and the per-package overrides
+type logLevelsRequest struct {
+	Default    string            `json:"default" binding:"required"`
+	Components map[string]string `json:"components"`
+}
+
+// logLevelRequest changes the default log level
+type logLevelRequest struct {
+	Level string `json:"level" binding:"required"`
+}
+
+// Log level handlers (admin only)
+func (h *Handler) GetLogLevels(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"levels": logger.CurrentLevels()})
+}
+
+func (h *Handler) UpdateLogLevels(c *gin.Context) {
+	var req logLevelsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	levels, err := logger.NewLevels(req.Default, req.Components)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	logger.SetLevels(levels)
+
+	logger.Log.WithFields(map[string]interface{}{
+		"admin_id": GetUserIDFromContext(c),
+		"levels":   levels,
+	}).Warn("Log levels changed")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Log levels updated successfully", "levels": levels})
+}
+
+// UpdateLogLevel changes the default log level, keeping per-package levels
+func (h *Handler) UpdateLogLevel(c *gin.Context) {
+	var req logLevelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	previous, err := logger.SetDefaultLevel(req.Level)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	level := logger.CurrentLevels().Default
+
+	logger.Log.WithFields(map[string]interface{}{
+		"admin_id":       GetUserIDFromContext(c),
+		"level":          level.String(),
+		"previous_level": previous.String(),
+	}).Warn("Log level changed")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Log level updated successfully", "level": level.String(), "previous_level": previous.String()})
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/service"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// Self-service handlers operating on the authenticated user's own record
+
+func (h *Handler) GetMe(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	user, err := h.users.GetUser(c.Request.Context(), userID)
+	if err != nil {
+		logger.LogDatabase("select", "users").WithField("user_id", userID).Warn("Authenticated user not found")
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	body := gin.H{"user": user}
+	if h.consent != nil {
+		consents, err := h.consent.History(c.Request.Context(), userID)
+		if err != nil {
+			logger.Log.WithError(err).WithField("user_id", userID).Error("Failed to fetch consent history")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+			return
+		}
+		body["consents"] = consents
+		body["terms_version"] = h.consent.TermsVersion()
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+func (h *Handler) UpdateMe(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req models.RestUpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Log.WithError(err).Warn("Invalid update request")
+		respondBindError(c, err)
+		return
+	}
+
+	// If-Match is optional here; when sent it guards against lost updates
+	var version uint
+	if header := c.GetHeader("If-Match"); header != "" {
+		var ok bool
+		if version, ok = parseIfMatch(header); !ok {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "If-Match does not match the current version"})
+			return
+		}
+	}
+
+	user, err := h.users.UpdateUser(c.Request.Context(), userID, version, req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAttributes) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrInvalidUpdate) {
+			respondBindError(c, err)
+			return
+		}
+		if errors.Is(err, service.ErrVersionConflict) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "User was modified by another request; fetch it again and retry"})
+			return
+		}
+		if errors.Is(err, service.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+
+	if isDryRun(c) {
+		c.JSON(http.StatusOK, dryRunResponse(gin.H{"user": user}))
+		return
+	}
+
+	logger.LogDatabase("update", "users").WithField("user_id", userID).Info("User updated own record")
+
+	c.Header("ETag", userETag(user))
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User updated successfully",
+		"user":    user,
+	})
+}
+
+func (h *Handler) DeleteMe(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	deleteUser := h.users.DeleteUser
+	if h.privacy != nil {
+		deleteUser = h.privacy.Erase
+	}
+	if err := deleteUser(c.Request.Context(), userID); err != nil {
+		logger.LogDatabase("delete", "users").WithError(err).WithField("user_id", userID).Error("Failed to delete user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		return
+	}
+
+	if isDryRun(c) {
+		c.JSON(http.StatusOK, dryRunResponse(gin.H{}))
+		return
+	}
+
+	logger.LogDatabase("delete", "users").WithField("user_id", userID).Info("User deleted own account")
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+}
@@ -1,20 +1,44 @@
 package api
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 
+	"github.com/114windd/restapi/internal/config"
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/geoip"
 	"github.com/114windd/restapi/internal/logger"
 	"github.com/114windd/restapi/internal/metrics"
+	"github.com/114windd/restapi/internal/requestid"
 )
 
-// LoggingMiddleware creates a Gin middleware for request logging
-func LoggingMiddleware() gin.HandlerFunc {
+// LoggingMiddleware creates a Gin middleware for request logging. With
+// cfg.Bodies set it also logs request headers and the start of request and
+// response bodies, with credentials and other sensitive fields redacted.
+// With geo set, requests are logged with the client's country and city.
+func LoggingMiddleware(cfg config.LoggingConfig, geo *geoip.Locator) gin.HandlerFunc {
+	requests := newBodyRedactor(cfg.RedactFields, true)
+	responses := newBodyRedactor(cfg.RedactFields, false)
+
 	return func(c *gin.Context) {
 		start := time.Now()
 		path := c.Request.URL.Path
 		method := c.Request.Method
+		location := geo.Lookup(c.ClientIP())
+		c.Set(locationKey, location)
+
+		var requestBody, responseBody *bodyCapture
+		if cfg.Bodies {
+			requestBody = &bodyCapture{max: cfg.BodyMaxBytes}
+			responseBody = &bodyCapture{max: cfg.BodyMaxBytes}
+			if c.Request.Body != nil {
+				c.Request.Body = &capturingReader{ReadCloser: c.Request.Body, bodyCapture: requestBody}
+			}
+			c.Writer = &capturingWriter{ResponseWriter: c.Writer, bodyCapture: responseBody}
+		}
 
 		// Process request
 		c.Next()
@@ -25,10 +49,22 @@ func LoggingMiddleware() gin.HandlerFunc {
 
 		entry := logger.LogRequest(method, path, GetUserIDFromContext(c))
 		entry = entry.WithFields(map[string]interface{}{
+			"request_id":  c.GetString("request_id"),
 			"status_code": statusCode,
 			"duration_ms": duration.Milliseconds(),
 			"client_ip":   c.ClientIP(),
 		})
+		entry = entry.WithFields(location.LogFields())
+		if c.GetBool("impersonated") {
+			entry = entry.WithField("impersonated", true)
+		}
+		if cfg.Bodies {
+			entry = entry.WithFields(map[string]interface{}{
+				"request_headers": requests.headers(c.Request.Header),
+				"request_body":    requests.body(c.Request.Header, requestBody.buf.Bytes(), requestBody.truncated),
+				"response_body":   responses.body(c.Writer.Header(), responseBody.buf.Bytes(), responseBody.truncated),
+			})
+		}
 
 		if statusCode >= 400 {
 			entry.Warn("Request completed with error")
@@ -38,11 +74,73 @@ func LoggingMiddleware() gin.HandlerFunc {
 	}
 }
 
+// locationKey holds the client's geoip.Location, set by LoggingMiddleware
+const locationKey = "client_location"
+
+// logAuth returns an auth audit entry for the request, located like the
+// request log
+func logAuth(c *gin.Context, action, email string) *logrus.Entry {
+	entry := logger.LogAuth(action, email)
+	if location, ok := c.Get(locationKey); ok {
+		entry = entry.WithFields(location.(geoip.Location).LogFields())
+	}
+	return entry
+}
+
+// RequestIDMiddleware assigns each request an ID, reusing the caller's
+// X-Request-ID when present, and echoes it in the response
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestid.Header)
+		if id == "" {
+			id = requestid.New()
+		}
+
+		c.Set("request_id", id)
+		c.Header(requestid.Header, id)
+		c.Request = c.Request.WithContext(requestid.WithID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// DBSessionMiddleware attaches per-request Postgres session settings to the
+// request context. It must run after RequestIDMiddleware.
+func DBSessionMiddleware(cfg config.DatabaseConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		settings := database.SessionSettings{
+			StatementTimeout: cfg.StatementTimeout,
+			ApplicationName:  cfg.ApplicationName + "/" + c.GetString("request_id"),
+			Role:             cfg.SessionRole,
+		}
+		c.Request = c.Request.WithContext(database.WithSessionSettings(c.Request.Context(), settings))
+		c.Next()
+	}
+}
+
+// TenantMiddleware scopes unauthenticated requests (e.g. signup and login) to
+// the tenant named in the X-Tenant-ID header, which must be one of tenants.
+// AuthMiddleware replaces it with the tenant carried by the token.
+func TenantMiddleware(tenants []string) gin.HandlerFunc {
+	known := make(map[string]bool, len(tenants))
+	for _, tenantID := range tenants {
+		known[tenantID] = true
+	}
+	return func(c *gin.Context) {
+		if tenantID := c.GetHeader("X-Tenant-ID"); tenantID != "" {
+			if !known[tenantID] {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Unknown tenant", "code": "unknown_tenant"})
+				return
+			}
+			c.Request = c.Request.WithContext(database.WithTenant(c.Request.Context(), tenantID))
+		}
+		c.Next()
+	}
+}
+
 // PrometheusMiddleware creates a Gin middleware for Prometheus metrics
 func PrometheusMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
-		path := c.Request.URL.Path
 		method := c.Request.Method
 
 		// Process request
@@ -52,6 +150,20 @@ func PrometheusMiddleware() gin.HandlerFunc {
 		duration := time.Since(start).Seconds()
 		statusCode := c.Writer.Status()
 
-		metrics.RecordHTTPRequest(method, path, statusCode, duration)
+		metrics.RecordHTTPRequest(method, metrics.EndpointLabel(c), statusCode, duration)
+	}
+}
+
+// DeprecationMiddleware marks responses on legacy unversioned paths as
+// deprecated (RFC 9745), announcing the sunset date when set (RFC 8594) and
+// linking to the same route under successorPrefix
+func DeprecationMiddleware(sunset time.Time, successorPrefix string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		if !sunset.IsZero() {
+			c.Header("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+		c.Header("Link", "<"+successorPrefix+c.Request.URL.Path+`>; rel="successor-version"`)
+		c.Next()
 	}
 }
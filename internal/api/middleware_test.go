@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/config"
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/requestid"
+)
+
+func TestDBSessionMiddleware(t *testing.T) {
+	cfg := config.DatabaseConfig{StatementTimeout: 3 * time.Second, ApplicationName: "restapi", SessionRole: "app_user"}
+	var settings database.SessionSettings
+	var ok bool
+	r := gin.New()
+	r.Use(RequestIDMiddleware(), DBSessionMiddleware(cfg))
+	r.GET("/", func(c *gin.Context) {
+		settings, ok = database.SessionSettingsFromContext(c.Request.Context())
+	})
+
+	for _, tc := range []struct {
+		requestID string
+		generated bool
+	}{
+		{requestID: "req-42"},
+		{generated: true},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.requestID != "" {
+			req.Header.Set(requestid.Header, tc.requestID)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		id := w.Header().Get(requestid.Header)
+		if id == "" || !tc.generated && id != tc.requestID {
+			t.Fatalf("request ID %q echoed as %q", tc.requestID, id)
+		}
+		want := database.SessionSettings{StatementTimeout: 3 * time.Second, ApplicationName: "restapi/" + id, Role: "app_user"}
+		if !ok || settings != want {
+			t.Fatalf("session settings %+v, want %+v", settings, want)
+		}
+	}
+}
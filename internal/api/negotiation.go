@@ -0,0 +1,273 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/logger"
+)
+
+// Response formats offered through content negotiation
+const (
+	FormatJSON = "application/json"
+	FormatXML  = "application/xml"
+	FormatCSV  = "text/csv"
+)
+
+// errNotTabular is returned when a response has no list to render as CSV
+var errNotTabular = errors.New("response is not a list")
+
+// ContentNegotiationMiddleware renders successful JSON responses as XML or
+// CSV when the Accept header prefers them. CSV is only offered by list
+// endpoints, whose response holds a single array of objects; other
+// endpoints answer 406 to a request accepting nothing but CSV.
+func ContentNegotiationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept")
+		format, ok := negotiateFormat(c.GetHeader("Accept"))
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusNotAcceptable, notAcceptable())
+			return
+		}
+		if format == FormatJSON {
+			c.Next()
+			return
+		}
+
+		writer := &bufferedJSONWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if !writer.buffering {
+			return
+		}
+		body := writer.buf.Bytes()
+		if status := c.Writer.Status(); status >= 200 && status < 300 {
+			converted, err := renderFormat(format, body)
+			switch {
+			case errors.Is(err, errNotTabular):
+				// The handler already ran; only the representation is refused
+				body, _ = json.Marshal(notAcceptable())
+				c.Writer.WriteHeader(http.StatusNotAcceptable)
+			case err != nil:
+				logger.Log.WithError(err).Warn("Failed to render response as " + format)
+			default:
+				body = converted
+				c.Header("Content-Type", format+"; charset=utf-8")
+			}
+		}
+
+		if _, err := c.Writer.Write(body); err != nil {
+			logger.Log.WithError(err).Debug("Failed to write response")
+		}
+	}
+}
+
+func notAcceptable() gin.H {
+	return gin.H{
+		"error":     "None of the accepted formats is available",
+		"code":      "not_acceptable",
+		"available": []string{FormatJSON, FormatXML, FormatCSV},
+	}
+}
+
+// negotiateFormat picks the preferred response format from an Accept
+// header. A missing header or a wildcard selects JSON.
+func negotiateFormat(header string) (string, bool) {
+	if header == "" {
+		return FormatJSON, true
+	}
+	for _, accepted := range parseAccept(header) {
+		switch accepted.value {
+		case FormatJSON, "application/*", "*/*":
+			return FormatJSON, true
+		case FormatXML, "text/xml":
+			return FormatXML, true
+		case FormatCSV:
+			return FormatCSV, true
+		}
+	}
+	return "", false
+}
+
+// renderFormat converts a JSON document to format
+func renderFormat(format string, body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if format == FormatCSV {
+		return renderCSV(doc)
+	}
+	return renderXML(doc)
+}
+
+// xmlNamePattern matches JSON keys usable as XML element names as they are
+var xmlNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9._-]*$`)
+
+// renderXML writes a JSON document as XML under a <response> root. Object
+// keys become elements, sorted by name, and array elements are <item>s.
+func renderXML(doc interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	if err := encodeXML(encoder, xml.StartElement{Name: xml.Name{Local: "response"}}, doc); err != nil {
+		return nil, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeXML(encoder *xml.Encoder, start xml.StartElement, value interface{}) error {
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child := xml.StartElement{Name: xml.Name{Local: key}}
+			if !xmlNamePattern.MatchString(key) {
+				child = xml.StartElement{
+					Name: xml.Name{Local: "entry"},
+					Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: key}},
+				}
+			}
+			if err := encodeXML(encoder, child, v[key]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := encodeXML(encoder, xml.StartElement{Name: xml.Name{Local: "item"}}, item); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if err := encoder.EncodeToken(xml.CharData(scalarString(v))); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+// renderCSV writes the list of a list response as CSV with a header row.
+// Nested objects are flattened into dotted columns, e.g. attributes.plan.
+func renderCSV(doc interface{}) ([]byte, error) {
+	rows, err := tabularRows(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	flattened := make([]map[string]string, len(rows))
+	columns := map[string]bool{}
+	for i, row := range rows {
+		flattened[i] = map[string]string{}
+		flattenRow("", row, flattened[i])
+		for column := range flattened[i] {
+			columns[column] = true
+		}
+	}
+	header := make([]string, 0, len(columns))
+	for column := range columns {
+		header = append(header, column)
+	}
+	sort.Slice(header, func(i, j int) bool {
+		// id leads, the remaining columns are alphabetical
+		if header[i] == "id" || header[j] == "id" {
+			return header[i] == "id"
+		}
+		return header[i] < header[j]
+	})
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write(header)
+	for _, row := range flattened {
+		record := make([]string, len(header))
+		for i, column := range header {
+			record[i] = row[column]
+		}
+		_ = w.Write(record)
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// tabularRows finds the single array of objects in a list response, such
+// as the users of {"users": [...], "next_page_token": "..."}
+func tabularRows(doc interface{}) ([]map[string]interface{}, error) {
+	object, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, errNotTabular
+	}
+	var list []interface{}
+	for _, value := range object {
+		if items, ok := value.([]interface{}); ok {
+			if list != nil {
+				return nil, errNotTabular
+			}
+			list = items
+		}
+	}
+	if list == nil {
+		return nil, errNotTabular
+	}
+	rows := make([]map[string]interface{}, len(list))
+	for i, item := range list {
+		if rows[i], ok = item.(map[string]interface{}); !ok {
+			return nil, errNotTabular
+		}
+	}
+	return rows, nil
+}
+
+func flattenRow(prefix string, object map[string]interface{}, out map[string]string) {
+	for key, value := range object {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flattenRow(prefix+key+".", v, out)
+		case []interface{}:
+			encoded, _ := json.Marshal(v)
+			out[prefix+key] = string(encoded)
+		case nil:
+			out[prefix+key] = ""
+		default:
+			out[prefix+key] = scalarString(v)
+		}
+	}
+}
+
+func scalarString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/cache"
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/oauth"
+	"github.com/114windd/restapi/internal/service"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// oauthStateMaxAge bounds how long a user may take at the provider's consent page
+const oauthStateMaxAge = 600 // seconds
+
+// TwoFactorTokenTTL bounds how long a provider login may wait for the
+// second factor of a user with 2FA
+const TwoFactorTokenTTL = 5 * time.Minute
+
+// maxTwoFactorAttempts is how many wrong codes invalidate a two-factor token
+const maxTwoFactorAttempts = 5
+
+// pendingLogin is a provider login held for the second factor. It is keyed
+// by the hash of its token.
+type pendingLogin struct {
+	UserID    uint      `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Attempts  int       `json:"attempts"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ConfigureOAuth enables login through the given external providers, keyed
+// by name. Logins of users with 2FA are held in pending, which must keep
+// entries for at least TwoFactorTokenTTL, until POST /login/2fa.
+func (h *Handler) ConfigureOAuth(providers map[string]oauth.Provider, pending cache.Store) {
+	h.oauth = providers
+	h.heldLogins = pending
+}
+
+// OAuthLogin redirects to the provider's consent page. The state and nonce
+// are kept in a short-lived cookie and checked by OAuthCallback.
+func (h *Handler) OAuthLogin(c *gin.Context) {
+	name := c.Param("provider")
+	provider, ok := h.oauth[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown login provider"})
+		return
+	}
+
+	state, nonce := randomState(), randomState()
+	url := provider.AuthCodeURL(state, nonce)
+	if url == "" {
+		logAuth(c, "oauth_unavailable", "").WithField("provider", name).Error("Login provider unavailable")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Login provider unavailable"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthCookie(name), state+"."+nonce, oauthStateMaxAge, "/", "", isHTTPS(c), true)
+	c.Redirect(http.StatusFound, url)
+}
+
+// OAuthCallback completes a provider login, linking the external identity
+// to a user and issuing the same tokens as /login
+func (h *Handler) OAuthCallback(c *gin.Context) {
+	name := c.Param("provider")
+	provider, ok := h.oauth[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown login provider"})
+		return
+	}
+
+	cookie, _ := c.Cookie(oauthCookie(name))
+	c.SetCookie(oauthCookie(name), "", -1, "/", "", isHTTPS(c), true)
+	state, nonce, _ := strings.Cut(cookie, ".")
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(c.Query("state"))) != 1 {
+		logAuth(c, "oauth_failed", "").WithField("provider", name).Warn("OAuth state mismatch")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login attempt, start again"})
+		return
+	}
+	if reason := c.Query("error"); reason != "" {
+		logAuth(c, "oauth_failed", "").WithField("provider", name).WithField("reason", reason).Warn("Login denied at provider")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login was denied by the provider"})
+		return
+	}
+
+	external, err := provider.Exchange(c.Request.Context(), c.Query("code"), nonce)
+	if err != nil {
+		logAuth(c, "oauth_failed", "").WithField("provider", name).WithError(err).Warn("OAuth code exchange failed")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login with provider failed"})
+		return
+	}
+
+	user, err := h.users.LoginWithIdentity(c.Request.Context(), name, external)
+	if err != nil {
+		if errors.Is(err, oauth.ErrNoVerifiedEmail) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Your account at the provider has no verified email address"})
+			return
+		}
+		if errors.Is(err, service.ErrEmailDomainNotAllowed) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": "email_domain_not_allowed"})
+			return
+		}
+		logAuth(c, "oauth_failed", external.Email).WithField("provider", name).WithError(err).Error("Failed to link external identity")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+
+	if !h.rejectInactive(c, user) {
+		return
+	}
+	// The provider vouches for the first factor only
+	if user.TwoFactorEnabled {
+		h.holdForSecondFactor(c, user, name)
+		return
+	}
+	h.completeOAuthLogin(c, user, name)
+}
+
+// holdForSecondFactor answers a provider login of a user with 2FA with a
+// short-lived token to be exchanged, with the code, at POST /login/2fa
+func (h *Handler) holdForSecondFactor(c *gin.Context, user *models.User, provider string) {
+	if h.heldLogins == nil {
+		logAuth(c, "oauth_failed", user.Email).WithField("provider", provider).Error("Provider login needs a second factor but no store is configured")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+	token := randomState()
+	pending := pendingLogin{UserID: user.ID, Provider: provider, ExpiresAt: time.Now().Add(TwoFactorTokenTTL)}
+	if err := h.heldLogins.Set(c.Request.Context(), pendingLoginKey(c, token), pending); err != nil {
+		logAuth(c, "oauth_failed", user.Email).WithField("provider", provider).WithError(err).Error("Failed to hold login for the second factor")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+	logAuth(c, "login_2fa_required", user.Email).WithField("provider", provider).Info("Two-factor code required")
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Two-factor code required", "code": "two_factor_required", "two_factor_token": token})
+}
+
+// CompleteTwoFactorLogin finishes a provider login held by OAuthCallback
+// with the user's authenticator or backup code. Each wrong code counts
+// against the token, which stops working after maxTwoFactorAttempts.
+func (h *Handler) CompleteTwoFactorLogin(c *gin.Context) {
+	var req models.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if h.heldLogins == nil {
+		respondInvalidTwoFactorToken(c)
+		return
+	}
+
+	ctx := c.Request.Context()
+	key := pendingLoginKey(c, req.TwoFactorToken)
+	var pending pendingLogin
+	ok, err := h.heldLogins.Get(ctx, key, &pending)
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to look up a pending login")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+	if !ok || time.Now().After(pending.ExpiresAt) {
+		respondInvalidTwoFactorToken(c)
+		return
+	}
+
+	user, err := h.users.GetUser(ctx, pending.UserID)
+	if err != nil {
+		_ = h.heldLogins.Delete(ctx, key)
+		respondInvalidTwoFactorToken(c)
+		return
+	}
+	if !h.rejectInactive(c, user) {
+		_ = h.heldLogins.Delete(ctx, key)
+		return
+	}
+	if !h.requireSecondFactor(c, user, req.TOTPCode) {
+		pending.Attempts++
+		if pending.Attempts >= maxTwoFactorAttempts {
+			err = h.heldLogins.Delete(ctx, key)
+		} else {
+			err = h.heldLogins.Set(ctx, key, pending)
+		}
+		if err != nil {
+			logger.Log.WithError(err).Warn("Failed to count a wrong two-factor code")
+		}
+		return
+	}
+	if err := h.heldLogins.Delete(ctx, key); err != nil {
+		logger.Log.WithError(err).Error("Failed to consume a pending login")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+	h.completeOAuthLogin(c, user, pending.Provider)
+}
+
+// completeOAuthLogin screens a provider login and issues the same tokens as /login
+func (h *Handler) completeOAuthLogin(c *gin.Context, user *models.User, provider string) {
+	if !h.screenLogin(c, user, user.Email, "", false) {
+		return
+	}
+
+	if err := h.users.RecordLogin(c.Request.Context(), user); err != nil {
+		logAuth(c, "login_success", user.Email).WithError(err).Warn("Failed to record last login")
+	}
+
+	token, refreshToken, err := h.issueTokens(c, user)
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to generate JWT")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	logAuth(c, "login_success", user.Email).WithField("provider", provider).WithField("user_id", user.ID).Info("User logged in through provider")
+
+	c.JSON(http.StatusOK, tokenResponse("Login successful", user, token, refreshToken))
+}
+
+func respondInvalidTwoFactorToken(c *gin.Context) {
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login attempt, start again", "code": "invalid_two_factor_token"})
+}
+
+// Pending logins are keyed by tenant and by the hash of their token, so the
+// store never holds a usable token
+func pendingLoginKey(c *gin.Context, token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return database.TenantFromContext(c.Request.Context()) + ":oauth:2fa:" + hex.EncodeToString(sum[:])
+}
+
+func oauthCookie(provider string) string {
+	return "oauth_" + provider
+}
+
+func randomState() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/storage"
+)
+
+// ConfigureObjects sets the object store whose signed URLs GetSignedObject
+// serves. Only the local backend needs this; S3 URLs point at the bucket.
+func (h *Handler) ConfigureObjects(store storage.ObjectStore) {
+	h.objects = store
+}
+
+// GetSignedObject serves an object from local storage to the holder of a
+// URL issued by its SignedURL
+func (h *Handler) GetSignedObject(c *gin.Context) {
+	local, ok := h.objects.(*storage.LocalObjectStore)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if err := local.Verify(key, c.Query("expires"), c.Query("signature")); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+
+	object, info, err := local.Get(c.Request.Context(), key)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	if err != nil {
+		logger.Log.WithError(err).WithField("key", key).Error("Failed to read object")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch object"})
+		return
+	}
+	defer object.Close()
+
+	c.DataFromReader(http.StatusOK, info.Size, info.ContentType, object, map[string]string{
+		"Cache-Control":           "private, no-store",
+		"Content-Security-Policy": "default-src 'none'",
+	})
+}
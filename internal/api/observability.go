@@ -0,0 +1,16 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/114windd/restapi/internal/metrics"
+	"github.com/114windd/restapi/internal/router"
+)
+
+// ObservabilityRoutes serves the observability status to admins on the
+// public listener; the internal METRICS_ADDR listener serves it as is
+func (h *Handler) ObservabilityRoutes() []router.Route {
+	return []router.Route{
+		{Method: http.MethodGet, Path: "/internal/observability", Handler: metrics.ObservabilityStatusHandler, Summary: "Health of the metrics registry and push target", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+	}
+}
@@ -0,0 +1,20 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/router"
+	"github.com/114windd/restapi/internal/version"
+)
+
+// OpenAPI serves the OpenAPI document of the versioned route tables, with
+// the rate limits the registrar's limiter currently enforces
+func (h *Handler) OpenAPI(c *gin.Context) {
+	var limits map[string]router.RateLimit
+	if h.limiter != nil {
+		limits = h.limiter.Limits()
+	}
+	c.JSON(http.StatusOK, router.OpenAPI("restapi", version.Get().Version, h.Versions(), limits))
+}
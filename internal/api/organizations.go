@@ -0,0 +1,223 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/organization"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// ConfigureOrganizations enables the /orgs routes
+func (h *Handler) ConfigureOrganizations(service *organization.Service) {
+	h.orgs = service
+}
+
+// Organization handlers. Callers see only the organizations they belong
+// to, and only owners (or admins) can change them.
+
+// GetOrganizations lists the caller's organizations with their role in each
+func (h *Handler) GetOrganizations(c *gin.Context) {
+	if !h.requireOrganizations(c) {
+		return
+	}
+
+	orgs, err := h.orgs.List(c.Request.Context(), currentIdentity(c))
+	if err != nil {
+		organizationError(c, err, "Failed to fetch organizations")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"organizations": orgs})
+}
+
+// CreateOrganization creates an organization owned by the caller
+func (h *Handler) CreateOrganization(c *gin.Context) {
+	if !h.requireOrganizations(c) {
+		return
+	}
+
+	var req models.CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	org, err := h.orgs.Create(c.Request.Context(), currentIdentity(c), req.Name)
+	if err != nil {
+		organizationError(c, err, "Failed to create organization")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Organization created successfully", "organization": org})
+}
+
+// GetOrganization returns an organization the caller belongs to
+func (h *Handler) GetOrganization(c *gin.Context) {
+	id, ok := h.organizationID(c)
+	if !ok {
+		return
+	}
+
+	org, err := h.orgs.Get(c.Request.Context(), currentIdentity(c), id)
+	if err != nil {
+		organizationError(c, err, "Failed to fetch organization")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"organization": org})
+}
+
+// UpdateOrganization renames an organization
+func (h *Handler) UpdateOrganization(c *gin.Context) {
+	id, ok := h.organizationID(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	org, err := h.orgs.Rename(c.Request.Context(), currentIdentity(c), id, req.Name)
+	if err != nil {
+		organizationError(c, err, "Failed to update organization")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Organization updated successfully", "organization": org})
+}
+
+// DeleteOrganization deletes an organization and its memberships
+func (h *Handler) DeleteOrganization(c *gin.Context) {
+	id, ok := h.organizationID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.orgs.Delete(c.Request.Context(), currentIdentity(c), id); err != nil {
+		organizationError(c, err, "Failed to delete organization")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Organization deleted successfully"})
+}
+
+// GetOrganizationMembers lists the members of an organization the caller belongs to
+func (h *Handler) GetOrganizationMembers(c *gin.Context) {
+	id, ok := h.organizationID(c)
+	if !ok {
+		return
+	}
+
+	members, err := h.orgs.Members(c.Request.Context(), currentIdentity(c), id)
+	if err != nil {
+		organizationError(c, err, "Failed to fetch members")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+// AddOrganizationMember adds a user to an organization
+func (h *Handler) AddOrganizationMember(c *gin.Context) {
+	id, ok := h.organizationID(c)
+	if !ok {
+		return
+	}
+
+	var req models.AddMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	member, err := h.orgs.AddMember(c.Request.Context(), currentIdentity(c), id, req.UserID, req.Role)
+	if err != nil {
+		organizationError(c, err, "Failed to add member")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Member added successfully", "member": member})
+}
+
+// UpdateOrganizationMember changes a member's role
+func (h *Handler) UpdateOrganizationMember(c *gin.Context) {
+	id, userID, ok := h.memberIDs(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	member, err := h.orgs.SetRole(c.Request.Context(), currentIdentity(c), id, userID, req.Role)
+	if err != nil {
+		organizationError(c, err, "Failed to update member")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Member updated successfully", "member": member})
+}
+
+// RemoveOrganizationMember removes a member; members may remove themselves to leave
+func (h *Handler) RemoveOrganizationMember(c *gin.Context) {
+	id, userID, ok := h.memberIDs(c)
+	if !ok {
+		return
+	}
+
+	if err := h.orgs.RemoveMember(c.Request.Context(), currentIdentity(c), id, userID); err != nil {
+		organizationError(c, err, "Failed to remove member")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+}
+
+// requireOrganizations responds 404 when organizations are not configured
+func (h *Handler) requireOrganizations(c *gin.Context) bool {
+	if h.orgs == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organizations are not enabled"})
+		return false
+	}
+	return true
+}
+
+// organizationID parses the :id parameter of an organization route
+func (h *Handler) organizationID(c *gin.Context) (uint, bool) {
+	if !h.requireOrganizations(c) {
+		return 0, false
+	}
+	return parseID(c, "organization")
+}
+
+// memberIDs parses the :id and :user_id parameters of a membership route
+func (h *Handler) memberIDs(c *gin.Context) (uint, uint, bool) {
+	id, ok := h.organizationID(c)
+	if !ok {
+		return 0, 0, false
+	}
+	var params memberParams
+	if !bindURI(c, &params, "user") {
+		return 0, 0, false
+	}
+	return id, params.UserID, true
+}
+
+// organizationError maps organization errors to responses
+func organizationError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, organization.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, organization.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, organization.ErrAlreadyMember), errors.Is(err, organization.ErrLastOwner):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		logger.Log.WithError(err).Error(message)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// outageRetryAfter is the Retry-After of responses during a database outage
+const outageRetryAfter = 5 * time.Second
+
+var outageResponse = gin.H{"error": "Service temporarily unavailable, try again later", "code": "database_unavailable"}
+
+// DatabaseOutageMiddleware replaces server errors with a 503 and a
+// Retry-After while unavailable reports the database down, so clients know
+// the failure is temporary. Queries fail fast during an outage, so these
+// responses come at once.
+func DatabaseOutageMiddleware(unavailable func() bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer = &outageWriter{ResponseWriter: c.Writer, unavailable: unavailable}
+		c.Next()
+	}
+}
+
+// outageWriter swaps a 5xx response written during an outage for the
+// outage response, discarding the handler's body
+type outageWriter struct {
+	gin.ResponseWriter
+	unavailable func() bool
+	swapped     bool
+}
+
+func (w *outageWriter) WriteHeader(code int) {
+	if code >= http.StatusInternalServerError && code != http.StatusServiceUnavailable && !w.Written() && w.unavailable() {
+		w.swapped = true
+		body, _ := json.Marshal(outageResponse)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Retry-After", strconv.Itoa(int(outageRetryAfter/time.Second)))
+		w.ResponseWriter.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.ResponseWriter.Write(body)
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *outageWriter) Write(b []byte) (int, error) {
+	if w.swapped {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *outageWriter) WriteString(s string) (int, error) {
+	if w.swapped {
+		return len(s), nil
+	}
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDatabaseOutageMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	down := false
+	r := gin.New()
+	r.Use(DatabaseOutageMiddleware(func() bool { return down }))
+	r.GET("/fail", func(c *gin.Context) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+	})
+	r.GET("/missing", func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	})
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	if w := get("/fail"); w.Code != http.StatusInternalServerError || w.Header().Get("Retry-After") != "" {
+		t.Fatalf("without an outage: %d %q", w.Code, w.Body.String())
+	}
+
+	down = true
+	w := get("/fail")
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "5" || !strings.Contains(w.Body.String(), `"code":"database_unavailable"`) {
+		t.Fatalf("during an outage: %d %v %q", w.Code, w.Header(), w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "Failed to get user") {
+		t.Fatalf("the handler's body leaked: %q", w.Body.String())
+	}
+	if w := get("/missing"); w.Code != http.StatusNotFound {
+		t.Fatalf("client errors must pass through, got %d", w.Code)
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/errorreporting"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/metrics"
+)
+
+// RecoveryMiddleware replaces gin.Recovery: it turns a panicking handler
+// into a 500 response and reports the panic, and any other 5xx response,
+// to reporter with the request's context
+func RecoveryMiddleware(reporter *errorreporting.Reporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				// Deliberate abort of the response, see net/http
+				panic(recovered)
+			}
+
+			stack := debug.Stack()
+			logger.Log.WithFields(map[string]interface{}{
+				"request_id": c.GetString("request_id"),
+				"method":     c.Request.Method,
+				"path":       c.Request.URL.Path,
+				"panic":      fmt.Sprint(recovered),
+				"stack":      string(stack),
+			}).Error("Panic recovered")
+			metrics.RecordPanic(errorreporting.TransportHTTP, metrics.EndpointLabel(c))
+			reporter.Report(c.Request.Context(), &errorreporting.Event{
+				Err:       fmt.Errorf("panic: %v", recovered),
+				Panic:     recovered,
+				Stack:     stack,
+				Transport: errorreporting.TransportHTTP,
+				Method:    c.Request.Method,
+				Route:     c.FullPath(),
+				Status:    strconv.Itoa(http.StatusInternalServerError),
+			})
+
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}()
+
+		c.Next()
+
+		if status := c.Writer.Status(); status >= http.StatusInternalServerError {
+			err := errors.New(http.StatusText(status))
+			if last := c.Errors.Last(); last != nil {
+				err = last.Err
+			}
+			reporter.Report(c.Request.Context(), &errorreporting.Event{
+				Err:       err,
+				Transport: errorreporting.TransportHTTP,
+				Method:    c.Request.Method,
+				Route:     c.FullPath(),
+				Status:    strconv.Itoa(status),
+			})
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/validation"
+)
+
+// idParams are the route parameters of a single resource, e.g. /users/:id
+type idParams struct {
+	ID uint `uri:"id" json:"id" binding:"required,min=1"`
+}
+
+// memberParams is the :user_id route parameter of an organization membership
+type memberParams struct {
+	UserID uint `uri:"user_id" json:"user_id" binding:"required,min=1"`
+}
+
+// bindURI binds the route parameters into params. Invalid parameters are
+// answered with 400 and the validation envelope, under an error naming the
+// resource, e.g. "Invalid user ID".
+func bindURI(c *gin.Context, params interface{}, resource string) bool {
+	err := c.ShouldBindUri(params)
+	if err == nil {
+		return true
+	}
+	fields, ok := validation.Translate(err)
+	var numErr *strconv.NumError
+	if !ok && errors.As(err, &numErr) {
+		// Not a number, reported like a JSON type mismatch
+		for _, param := range c.Params {
+			if param.Value == numErr.Num {
+				fields = validation.Errors{{Field: param.Key, Rule: "type", Message: param.Key + " must be a number"}}
+				break
+			}
+		}
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + resource + " ID", "code": "invalid_id", "fields": fields})
+	return false
+}
+
+// parseID returns the :id route parameter of a resource route
+func parseID(c *gin.Context, resource string) (uint, bool) {
+	var params idParams
+	if !bindURI(c, &params, resource) {
+		return 0, false
+	}
+	return params.ID, true
+}
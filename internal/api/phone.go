@@ -0,0 +1,198 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/phone"
+	"github.com/114windd/restapi/internal/service"
+	"github.com/114windd/restapi/internal/sms"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// ConfigurePhone enables phone verification by SMS and, when otpLogin is
+// set, logging in with a code texted to a verified number. client receives
+// the provider's delivery reports.
+func (h *Handler) ConfigurePhone(service *phone.Service, client *sms.Client, otpLogin bool) {
+	h.phone = service
+	h.sms = client
+	h.otpLogin = otpLogin
+}
+
+// SendPhoneVerification texts a code to the caller's phone number
+func (h *Handler) SendPhoneVerification(c *gin.Context) {
+	if !h.requirePhone(c) || !requireAccountOwner(c) {
+		return
+	}
+	userID := c.GetUint("user_id")
+
+	if err := h.phone.SendVerification(c.Request.Context(), userID); err != nil {
+		phoneError(c, err, "Failed to send verification code")
+		return
+	}
+
+	logger.Log.WithField("user_id", userID).Info("Phone verification code sent")
+	c.JSON(http.StatusAccepted, gin.H{"message": "Verification code sent"})
+}
+
+// ConfirmPhoneVerification marks the caller's phone number verified with
+// the code texted to it
+func (h *Handler) ConfirmPhoneVerification(c *gin.Context) {
+	if !h.requirePhone(c) || !requireAccountOwner(c) {
+		return
+	}
+	userID := c.GetUint("user_id")
+
+	var req models.PhoneCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	user, err := h.phone.ConfirmVerification(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		phoneError(c, err, "Failed to verify phone number")
+		return
+	}
+
+	logger.Log.WithField("user_id", userID).Info("Phone number verified")
+	c.JSON(http.StatusOK, gin.H{"message": "Phone number verified", "user": user})
+}
+
+// RequestOTPLogin texts a login code to a verified phone number. The
+// answer is the same whether or not the number belongs to an account.
+func (h *Handler) RequestOTPLogin(c *gin.Context) {
+	if !h.requireOTPLogin(c) {
+		return
+	}
+
+	var req models.OTPLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if !h.requireCaptcha(c, req.CaptchaToken, "") {
+		return
+	}
+
+	if err := h.phone.SendLoginCode(c.Request.Context(), req.Phone); err != nil {
+		phoneError(c, err, "Failed to send login code")
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the number belongs to an account, a login code was sent"})
+}
+
+// VerifyOTPLogin signs in with a code sent by RequestOTPLogin, returning
+// tokens like /login. Failures count toward login delays and CAPTCHA
+// challenges, with the phone number standing in for the email.
+func (h *Handler) VerifyOTPLogin(c *gin.Context) {
+	if !h.requireOTPLogin(c) {
+		return
+	}
+
+	var req models.OTPVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if !h.delayLogin(c, req.Phone) {
+		return
+	}
+
+	user, err := h.phone.VerifyLoginCode(c.Request.Context(), req.Phone, req.Code)
+	if err != nil {
+		if errors.Is(err, phone.ErrInvalidCode) {
+			logger.Log.Warn("Invalid login code")
+			h.recordAuthFailure(c, req.Phone)
+		}
+		phoneError(c, err, "Failed to verify login code")
+		return
+	}
+	if !h.rejectInactive(c, user) || !h.requireSecondFactor(c, user, req.TOTPCode) ||
+		!h.screenLogin(c, user, req.Phone, req.StepUpCode, true) {
+		return
+	}
+
+	h.resetAuthFailures(c, req.Phone)
+	if err := h.users.RecordLogin(c.Request.Context(), user); err != nil {
+		logAuth(c, "login_success", user.Email).WithError(err).Warn("Failed to record last login")
+	}
+
+	token, refreshToken, err := h.issueTokens(c, user)
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to generate JWT")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	logAuth(c, "login_success", user.Email).WithField("user_id", user.ID).WithField("method", "sms").Info("User logged in with a login code")
+	c.JSON(http.StatusOK, tokenResponse("Login successful", user, token, refreshToken))
+}
+
+// SMSStatusCallback receives delivery reports from the SMS provider
+func (h *Handler) SMSStatusCallback(c *gin.Context) {
+	if h.sms == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	if _, err := h.sms.ReceiveStatus(c.Request); err != nil {
+		switch {
+		case errors.Is(err, sms.ErrNoDeliveryReports):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		case errors.Is(err, sms.ErrInvalidSignature):
+			logger.Log.WithField("client_ip", c.ClientIP()).Warn("SMS delivery report with an invalid signature")
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid signature"})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery report"})
+		}
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// requirePhone responds 404 when phone verification is not configured
+func (h *Handler) requirePhone(c *gin.Context) bool {
+	if h.phone == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Phone verification is not enabled"})
+		return false
+	}
+	return true
+}
+
+// requireOTPLogin responds 404 when logging in with texted codes is not enabled
+func (h *Handler) requireOTPLogin(c *gin.Context) bool {
+	if h.phone == nil || !h.otpLogin {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Login with a phone number is not enabled"})
+		return false
+	}
+	return true
+}
+
+// phoneError maps phone verification errors to responses
+func phoneError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, phone.ErrInvalidCode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired code", "code": "invalid_code"})
+	case errors.Is(err, phone.ErrRateLimited):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many codes sent to this phone number, try again later", "code": "sms_rate_limited"})
+	case errors.Is(err, phone.ErrNoPhone):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Set a phone number first", "code": "no_phone"})
+	case errors.Is(err, phone.ErrAlreadyVerified):
+		c.JSON(http.StatusConflict, gin.H{"error": "Phone number already verified"})
+	case errors.Is(err, service.ErrPhoneTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "Phone number already verified by another account", "code": "phone_taken"})
+	case errors.Is(err, sms.ErrRejected):
+		logger.Log.WithError(err).Warn(message)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "The phone number cannot receive text messages", "code": "sms_rejected"})
+	default:
+		logger.Log.WithError(err).Error(message)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
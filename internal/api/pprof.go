@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/router"
+)
+
+// PprofRoutes serves the net/http/pprof profiles under /debug/pprof to
+// admins. They have no deadline, as CPU profiles and traces run for the
+// requested number of seconds.
+func (h *Handler) PprofRoutes() []router.Route {
+	route := func(method, path string, handler http.HandlerFunc, summary string) router.Route {
+		return router.Route{Method: method, Path: path, Handler: gin.WrapF(handler), Summary: summary, Scopes: adminOnly, RateLimit: router.RateLimitAdmin}
+	}
+	return []router.Route{
+		route(http.MethodGet, "/debug/pprof/", pprof.Index, "List the available profiles"),
+		route(http.MethodGet, "/debug/pprof/cmdline", pprof.Cmdline, "Get the server's command line"),
+		route(http.MethodGet, "/debug/pprof/profile", pprof.Profile, "Record a CPU profile"),
+		route(http.MethodGet, "/debug/pprof/symbol", pprof.Symbol, "Look up program counters"),
+		route(http.MethodPost, "/debug/pprof/symbol", pprof.Symbol, "Look up program counters"),
+		route(http.MethodGet, "/debug/pprof/trace", pprof.Trace, "Record an execution trace"),
+		{Method: http.MethodGet, Path: "/debug/pprof/:name", Handler: namedProfile, Summary: "Get a named profile such as heap or goroutine", Scopes: adminOnly, RateLimit: router.RateLimitAdmin},
+	}
+}
+
+// namedProfile serves a runtime/pprof profile (heap, goroutine, allocs, ...)
+func namedProfile(c *gin.Context) {
+	pprof.Handler(c.Param("name")).ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/preferences"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// ConfigurePreferences enables GET and PUT /me/preferences
+func (h *Handler) ConfigurePreferences(service *preferences.Service) {
+	h.preferences = service
+}
+
+// GetMyPreferences returns the caller's preferences, defaults included
+func (h *Handler) GetMyPreferences(c *gin.Context) {
+	if h.preferences == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Preferences are not enabled"})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	prefs, err := h.preferences.Get(c.Request.Context(), userID)
+	if err != nil {
+		logger.LogDatabase("select", "user_preferences").WithError(err).WithField("user_id", userID).Error("Failed to get preferences")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get preferences"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"preferences": prefs})
+}
+
+// UpdateMyPreferences merges the keys in the body into the caller's
+// preferences; keys left out are unchanged and null resets a key
+func (h *Handler) UpdateMyPreferences(c *gin.Context) {
+	if h.preferences == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Preferences are not enabled"})
+		return
+	}
+
+	var patch models.Preferences
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	prefs, err := h.preferences.Update(c.Request.Context(), userID, patch)
+	if err != nil {
+		if errors.Is(err, preferences.ErrInvalidPreferences) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		logger.LogDatabase("upsert", "user_preferences").WithError(err).WithField("user_id", userID).Error("Failed to update preferences")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update preferences"})
+		return
+	}
+
+	logger.Log.WithField("user_id", userID).Info("Preferences updated")
+	c.JSON(http.StatusOK, gin.H{"message": "Preferences updated successfully", "preferences": prefs})
+}
+
+// ListPreferenceDefinitions describes the preferences users can set
+func (h *Handler) ListPreferenceDefinitions(c *gin.Context) {
+	if h.preferences == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Preferences are not enabled"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"definitions": h.preferences.Definitions()})
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/privacy"
+)
+
+// ConfigurePrivacy enables data exports, and makes DELETE /me and
+// DELETE /users/:id anonymize the records kept about the user instead of
+// only deleting the account
+func (h *Handler) ConfigurePrivacy(service *privacy.Service) {
+	h.privacy = service
+}
+
+// RequestDataExport starts building an archive of the caller's data; poll
+// GET /me/export for the download link
+func (h *Handler) RequestDataExport(c *gin.Context) {
+	if h.privacy == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Data export is not enabled"})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	export, err := h.privacy.StartExport(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, privacy.ErrExportInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": "An export is already being prepared"})
+			return
+		}
+		logger.Log.WithError(err).WithField("user_id", userID).Error("Failed to start data export")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start data export"})
+		return
+	}
+
+	logger.Log.WithField("user_id", userID).WithField("export_id", export.ID).Info("Data export requested")
+	c.JSON(http.StatusAccepted, gin.H{"message": "Export started", "export": export})
+}
+
+// GetDataExport reports the caller's latest export, with a short-lived
+// download_url once it is completed
+func (h *Handler) GetDataExport(c *gin.Context) {
+	if h.privacy == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Data export is not enabled"})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	export, url, err := h.privacy.LatestExport(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, privacy.ErrNoExport) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No export requested; POST /me/export to start one"})
+			return
+		}
+		logger.Log.WithError(err).WithField("user_id", userID).Error("Failed to get data export")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get data export"})
+		return
+	}
+
+	body := gin.H{"export": export}
+	if url != "" {
+		body["download_url"] = url
+	}
+	c.JSON(http.StatusOK, body)
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/recovery"
+	"github.com/114windd/restapi/internal/service"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// ConfigureRecovery enables the admin account recovery workflow
+func (h *Handler) ConfigureRecovery(service *recovery.Service) {
+	h.recovery = service
+}
+
+// Account recovery handlers (admin only, except RedeemRecoveryToken)
+
+// GetRecoveryCases lists recovery cases, optionally filtered by ?status=
+func (h *Handler) GetRecoveryCases(c *gin.Context) {
+	if !h.requireRecovery(c) {
+		return
+	}
+
+	cases, err := h.recovery.List(c.Request.Context(), c.Query("status"))
+	if err != nil {
+		logger.LogDatabase("select", "recovery_cases").WithError(err).Error("Failed to list recovery cases")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recovery cases"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"cases": cases})
+}
+
+// OpenRecoveryCase opens a case for a user whose identity the caller verified
+func (h *Handler) OpenRecoveryCase(c *gin.Context) {
+	if !h.requireRecovery(c) {
+		return
+	}
+
+	var req models.OpenRecoveryCaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	rc, err := h.recovery.Open(c.Request.Context(), currentIdentity(c).UserID, req)
+	if err != nil {
+		recoveryError(c, err, "Failed to open recovery case")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Recovery case opened", "case": rc})
+}
+
+// GetRecoveryCase returns a case with its audit log
+func (h *Handler) GetRecoveryCase(c *gin.Context) {
+	id, ok := h.recoveryCaseID(c)
+	if !ok {
+		return
+	}
+
+	rc, err := h.recovery.Get(c.Request.Context(), id)
+	if err != nil {
+		recoveryError(c, err, "Failed to fetch recovery case")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"case": rc})
+}
+
+// ApproveRecoveryCase records the caller's approval of a case
+func (h *Handler) ApproveRecoveryCase(c *gin.Context) {
+	id, ok := h.recoveryCaseID(c)
+	if !ok {
+		return
+	}
+
+	var req models.RecoveryDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	rc, err := h.recovery.Approve(c.Request.Context(), id, currentIdentity(c).UserID, req.Note)
+	if err != nil {
+		recoveryError(c, err, "Failed to approve recovery case")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recovery case approved", "case": rc})
+}
+
+// RejectRecoveryCase closes a case without resetting credentials
+func (h *Handler) RejectRecoveryCase(c *gin.Context) {
+	id, ok := h.recoveryCaseID(c)
+	if !ok {
+		return
+	}
+
+	var req models.RecoveryDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	rc, err := h.recovery.Reject(c.Request.Context(), id, currentIdentity(c).UserID, req.Note)
+	if err != nil {
+		recoveryError(c, err, "Failed to reject recovery case")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recovery case rejected", "case": rc})
+}
+
+// ResetRecoveryCase completes an approved case, resetting the user's
+// credentials and issuing a single-use reset token
+func (h *Handler) ResetRecoveryCase(c *gin.Context) {
+	id, ok := h.recoveryCaseID(c)
+	if !ok {
+		return
+	}
+
+	var req models.RecoveryResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	rc, token, err := h.recovery.Reset(c.Request.Context(), id, currentIdentity(c).UserID, req.NewEmail)
+	if err != nil {
+		recoveryError(c, err, "Failed to reset credentials")
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Credentials reset",
+		"case":        rc,
+		"reset_token": token,
+	})
+}
+
+// RedeemRecoveryToken lets a recovered user choose a new password
+func (h *Handler) RedeemRecoveryToken(c *gin.Context) {
+	if !h.requireRecovery(c) {
+		return
+	}
+
+	var req models.RedeemRecoveryTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	if err := h.recovery.Redeem(c.Request.Context(), req.Token, req.Password); err != nil {
+		if errors.Is(err, recovery.ErrInvalidToken) || errors.Is(err, database.ErrVersionConflict) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired recovery token"})
+			return
+		}
+		logger.Log.WithError(err).Error("Failed to redeem recovery token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password updated, you can now log in"})
+}
+
+// requireRecovery responds 404 when account recovery is not configured
+func (h *Handler) requireRecovery(c *gin.Context) bool {
+	if h.recovery == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account recovery is not enabled"})
+		return false
+	}
+	return true
+}
+
+// recoveryCaseID parses the :id parameter of a recovery case route
+func (h *Handler) recoveryCaseID(c *gin.Context) (uint, bool) {
+	if !h.requireRecovery(c) {
+		return 0, false
+	}
+	return parseID(c, "recovery case")
+}
+
+// recoveryError maps recovery workflow errors to responses
+func recoveryError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+	case errors.Is(err, recovery.ErrSelfApproval), errors.Is(err, recovery.ErrAlreadyApproved):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, recovery.ErrInvalidTransition), errors.Is(err, database.ErrVersionConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrEmailDomainNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": "email_domain_not_allowed"})
+	case errors.Is(err, service.ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already in use"})
+	default:
+		logger.Log.WithError(err).Error(message)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
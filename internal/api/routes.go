@@ -0,0 +1,161 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/router"
+)
+
+// Default request deadlines, see ConfigureTimeouts
+const (
+	defaultTimeout = 10 * time.Second
+	longTimeout    = 60 * time.Second
+)
+
+var (
+	authenticated = []string{router.ScopeAuthenticated}
+	adminOnly     = []string{router.ScopeAuthenticated, router.ScopeAdmin}
+)
+
+// ConfigureTimeouts sets the request deadlines of ordinary routes and of
+// slow ones such as uploads and exports. Zero keeps the default.
+func (h *Handler) ConfigureTimeouts(timeout, long time.Duration) {
+	if timeout > 0 {
+		h.timeout = timeout
+	}
+	if long > 0 {
+		h.longTimeout = long
+	}
+}
+
+// Versions lists the API versions served, newest last
+func (h *Handler) Versions() []router.Version {
+	return []router.Version{
+		{Prefix: "/api/v1", Routes: h.RoutesV1()},
+	}
+}
+
+// LegacyVersion is the version whose routes are also served at the
+// deprecated unversioned paths (e.g. /users as an alias of /api/v1/users)
+const LegacyVersion = "/api/v1"
+
+// RoutesV1 is the /api/v1 route table. It is mounted through a
+// router.Registrar and API documentation tooling reads the same metadata.
+func (h *Handler) RoutesV1() []router.Route {
+	return []router.Route{
+		// Public routes
+		{Method: http.MethodGet, Path: "/openapi.json", Handler: h.OpenAPI, Summary: "Describe the API as an OpenAPI document", RateLimit: router.RateLimitDefault, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/signup", Handler: h.Signup, Summary: "Create an account", RateLimit: router.RateLimitAuth, Timeout: h.timeout, DryRun: true},
+		{Method: http.MethodPost, Path: "/login", Handler: h.Login, Summary: "Authenticate and obtain a token", RateLimit: router.RateLimitAuth, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/login/otp", Handler: h.RequestOTPLogin, Summary: "Text a login code to a verified phone number", RateLimit: router.RateLimitAuth, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/login/otp/verify", Handler: h.VerifyOTPLogin, Summary: "Authenticate with a texted login code", RateLimit: router.RateLimitAuth, Timeout: h.timeout},
+		{Method: http.MethodGet, Path: "/signup/check-email", Handler: h.CheckEmail, Summary: "Check whether an email can be used to sign up", RateLimit: router.RateLimitLookup, Timeout: h.timeout},
+		{Method: http.MethodGet, Path: "/users/email-available", Handler: h.CheckEmail, Summary: "Check whether an email can be used to sign up", RateLimit: router.RateLimitLookup, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/token/refresh", Handler: h.RefreshToken, Summary: "Exchange a refresh token for a new access token", RateLimit: router.RateLimitAuth, Timeout: h.timeout},
+		{Method: http.MethodGet, Path: "/auth/:provider/login", Handler: h.OAuthLogin, Summary: "Start login with an external provider", RateLimit: router.RateLimitAuth, Timeout: h.timeout},
+		{Method: http.MethodGet, Path: "/auth/:provider/callback", Handler: h.OAuthCallback, Summary: "Complete login with an external provider", RateLimit: router.RateLimitAuth, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/login/2fa", Handler: h.CompleteTwoFactorLogin, Summary: "Complete a provider login with a two-factor code", RateLimit: router.RateLimitAuth, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/invitations/:token/accept", Handler: h.AcceptInvitation, Summary: "Activate an invited account by choosing a password", RateLimit: router.RateLimitAuth, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/recovery/redeem", Handler: h.RedeemRecoveryToken, Summary: "Set a new password with an account recovery token", RateLimit: router.RateLimitAuth, Timeout: h.timeout},
+		{Method: http.MethodGet, Path: "/avatars/:name", Handler: h.GetAvatar, Summary: "Serve an avatar image", RateLimit: router.RateLimitDefault, Timeout: h.timeout},
+		{Method: http.MethodGet, Path: "/objects/*key", Handler: h.GetSignedObject, Summary: "Download a stored file through a signed URL", RateLimit: router.RateLimitDefault, Timeout: h.longTimeout},
+		{Method: http.MethodPost, Path: "/sms/status", Handler: h.SMSStatusCallback, Summary: "Receive SMS delivery reports from the provider", RateLimit: router.RateLimitDefault, Timeout: h.timeout, Form: true},
+
+		// Protected routes
+		{Method: http.MethodGet, Path: "/users", Handler: h.GetUsers, Summary: "List users", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout},
+		{Method: http.MethodGet, Path: "/users/search", Handler: h.SearchUsers, Summary: "Fuzzy search users by name or email", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout},
+		{Method: http.MethodGet, Path: "/users/stats", Handler: h.GetUserStats, Summary: "Aggregate user statistics", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/users/batch-get", Handler: h.BatchGetUsers, Summary: "Get many users by ID", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout, ReadOnly: true},
+		{Method: http.MethodGet, Path: "/users/export", Handler: h.ExportUsers, Summary: "Download every user as CSV", Scopes: adminOnly, RateLimit: router.RateLimitDefault, Timeout: h.longTimeout},
+		{Method: http.MethodGet, Path: "/users/:id", Handler: h.GetUser, Summary: "Get a user", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout},
+		{Method: http.MethodPut, Path: "/users/:id", Handler: h.UpdateUser, Summary: "Replace a user", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout, DryRun: true},
+		{Method: http.MethodPatch, Path: "/users/:id", Handler: h.PatchUser, Summary: "Partially update a user", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout, DryRun: true},
+		{Method: http.MethodDelete, Path: "/users/:id", Handler: h.DeleteUser, Summary: "Delete a user", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout, DryRun: true},
+		{Method: http.MethodPost, Path: "/users/:id/avatar", Handler: h.UploadAvatar, Summary: "Upload a user's avatar image", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.longTimeout, Upload: h.maxAvatarBytes},
+		{Method: http.MethodDelete, Path: "/users/:id/avatar", Handler: h.DeleteAvatar, Summary: "Remove a user's avatar", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout},
+
+		// Self-service routes on the caller's own record
+		{Method: http.MethodGet, Path: "/me", Handler: h.GetMe, Summary: "Get the caller's account", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout, NoConsent: true},
+		{Method: http.MethodPut, Path: "/me", Handler: h.UpdateMe, Summary: "Update the caller's account", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout, DryRun: true},
+		{Method: http.MethodDelete, Path: "/me", Handler: h.DeleteMe, Summary: "Delete the caller's account", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout, DryRun: true, NoConsent: true},
+		{Method: http.MethodPost, Path: "/me/export", Handler: h.RequestDataExport, Summary: "Start an export of the caller's personal data", Scopes: authenticated, RateLimit: router.RateLimitAuth, Timeout: h.timeout, NoConsent: true},
+		{Method: http.MethodGet, Path: "/me/export", Handler: h.GetDataExport, Summary: "Status and download link of the caller's latest data export", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout, NoConsent: true},
+		{Method: http.MethodPost, Path: "/me/consents", Handler: h.AcceptConsent, Summary: "Accept the current terms of service", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout, NoConsent: true},
+		{Method: http.MethodGet, Path: "/me/preferences", Handler: h.GetMyPreferences, Summary: "The caller's preferences", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout},
+		{Method: http.MethodPut, Path: "/me/preferences", Handler: h.UpdateMyPreferences, Summary: "Merge changes into the caller's preferences", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout},
+		{Method: http.MethodGet, Path: "/me/preferences/definitions", Handler: h.ListPreferenceDefinitions, Summary: "The preferences users can set, with types and defaults", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/me/deactivate", Handler: h.DeactivateMe, Summary: "Deactivate the caller's account without deleting it", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout, NoConsent: true},
+		{Method: http.MethodGet, Path: "/me/experiments", Handler: h.GetMyExperiments, Summary: "The caller's experiment variants", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/me/experiments/:key/exposures", Handler: h.RecordMyExposure, Summary: "Record that the caller saw their experiment variant", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/me/2fa/enroll", Handler: h.EnrollTwoFactor, Summary: "Start enrolling an authenticator app", Scopes: authenticated, RateLimit: router.RateLimitAuth, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/me/2fa/verify", Handler: h.VerifyTwoFactor, Summary: "Confirm an authenticator and enable two-factor authentication", Scopes: authenticated, RateLimit: router.RateLimitAuth, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/me/2fa/disable", Handler: h.DisableTwoFactor, Summary: "Disable two-factor authentication", Scopes: authenticated, RateLimit: router.RateLimitAuth, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/me/phone/verify", Handler: h.SendPhoneVerification, Summary: "Text a verification code to the caller's phone number", Scopes: authenticated, RateLimit: router.RateLimitAuth, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/me/phone/verify/confirm", Handler: h.ConfirmPhoneVerification, Summary: "Verify the caller's phone number with the texted code", Scopes: authenticated, RateLimit: router.RateLimitAuth, Timeout: h.timeout},
+		{Method: http.MethodGet, Path: "/me/sessions", Handler: h.GetMySessions, Summary: "List the caller's active sessions", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout},
+		{Method: http.MethodDelete, Path: "/me/sessions/:id", Handler: h.RevokeMySession, Summary: "Revoke one of the caller's sessions", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/logout", Handler: h.Logout, Summary: "Revoke the current session", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout, NoConsent: true},
+
+		// Organization routes, scoped to the caller's memberships
+		{Method: http.MethodGet, Path: "/orgs", Handler: h.GetOrganizations, Summary: "List the caller's organizations", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/orgs", Handler: h.CreateOrganization, Summary: "Create an organization owned by the caller", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout},
+		{Method: http.MethodGet, Path: "/orgs/:id", Handler: h.GetOrganization, Summary: "Get an organization", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout},
+		{Method: http.MethodPut, Path: "/orgs/:id", Handler: h.UpdateOrganization, Summary: "Rename an organization", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout},
+		{Method: http.MethodDelete, Path: "/orgs/:id", Handler: h.DeleteOrganization, Summary: "Delete an organization", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout},
+		{Method: http.MethodGet, Path: "/orgs/:id/members", Handler: h.GetOrganizationMembers, Summary: "List an organization's members", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/orgs/:id/members", Handler: h.AddOrganizationMember, Summary: "Add a user to an organization", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout},
+		{Method: http.MethodPut, Path: "/orgs/:id/members/:user_id", Handler: h.UpdateOrganizationMember, Summary: "Change a member's role", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout},
+		{Method: http.MethodDelete, Path: "/orgs/:id/members/:user_id", Handler: h.RemoveOrganizationMember, Summary: "Remove a member from an organization", Scopes: authenticated, RateLimit: router.RateLimitDefault, Timeout: h.timeout},
+
+		// Admin routes
+		{Method: http.MethodGet, Path: "/admin/attributes", Handler: h.GetAttributeDefinitions, Summary: "List custom attribute definitions", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/admin/attributes", Handler: h.CreateAttributeDefinition, Summary: "Define a custom attribute", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodDelete, Path: "/admin/attributes/:id", Handler: h.DeleteAttributeDefinition, Summary: "Delete a custom attribute definition", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodGet, Path: "/admin/signup-domains", Handler: h.GetEmailDomainPolicy, Summary: "Get the signup email domain policy", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodPut, Path: "/admin/signup-domains", Handler: h.UpdateEmailDomainPolicy, Summary: "Replace the signup email domain policy", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodGet, Path: "/admin/log-levels", Handler: h.GetLogLevels, Summary: "Get the log levels", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodPut, Path: "/admin/log-levels", Handler: h.UpdateLogLevels, Summary: "Change the default and per-package log levels", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodPut, Path: "/admin/loglevel", Handler: h.UpdateLogLevel, Summary: "Change the default log level", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodGet, Path: "/admin/slo", Handler: h.GetSLOReport, Summary: "Per-endpoint SLO compliance and error budgets", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodGet, Path: "/admin/invitations", Handler: h.GetInvitations, Summary: "List invitations", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/admin/invitations", Handler: h.CreateInvitation, Summary: "Create an invited account and email the invitee", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodGet, Path: "/admin/invitations/:id", Handler: h.GetInvitation, Summary: "Get an invitation", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/admin/invitations/:id/resend", Handler: h.ResendInvitation, Summary: "Email an invitation again with a new token", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodGet, Path: "/admin/recovery-cases", Handler: h.GetRecoveryCases, Summary: "List account recovery cases", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/admin/recovery-cases", Handler: h.OpenRecoveryCase, Summary: "Open an account recovery case", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodGet, Path: "/admin/recovery-cases/:id", Handler: h.GetRecoveryCase, Summary: "Get a recovery case and its audit log", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/admin/recovery-cases/:id/approve", Handler: h.ApproveRecoveryCase, Summary: "Approve a recovery case", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/admin/recovery-cases/:id/reject", Handler: h.RejectRecoveryCase, Summary: "Reject a recovery case", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/admin/recovery-cases/:id/reset", Handler: h.ResetRecoveryCase, Summary: "Reset the credentials of an approved recovery case", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodGet, Path: "/admin/security/flags", Handler: h.GetSecurityFlags, Summary: "List accounts flagged by anomaly detection", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/admin/security/flags/:id/resolve", Handler: h.ResolveSecurityFlag, Summary: "Resolve a security flag after reviewing the account", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/admin/cache/warm", Handler: h.WarmCache, Summary: "Preload the cache", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.longTimeout},
+		{Method: http.MethodGet, Path: "/admin/sessions", Handler: h.GetSessions, Summary: "List active sessions", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodDelete, Path: "/admin/sessions/:id", Handler: h.RevokeSession, Summary: "Revoke a session", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodGet, Path: "/admin/users/:id/history", Handler: h.GetUserHistory, Summary: "User record history", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/admin/impersonate/:id", Handler: h.ImpersonateUser, Summary: "Issue a short-lived token acting as a user", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/admin/users/:id/suspend", Handler: h.SuspendUser, Summary: "Suspend a user's account", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodPost, Path: "/admin/users/:id/reactivate", Handler: h.ReactivateUser, Summary: "Reactivate a suspended or deactivated account", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodDelete, Path: "/admin/users/:id/sessions", Handler: h.RevokeUserSessions, Summary: "Revoke all sessions of a user", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Timeout: h.timeout},
+		{Method: http.MethodGet, Path: "/events", Handler: h.StreamEvents, Summary: "Stream user change events (Server-Sent Events)", Scopes: adminOnly, RateLimit: router.RateLimitAdmin, Stream: true},
+	}
+}
+
+// NewRegistrar returns a registrar enforcing this package's authentication
+// and scope middleware. /openapi.json documents the limits of limiter.
+func (h *Handler) NewRegistrar(limiter *router.Limiter) *router.Registrar {
+	h.limiter = limiter
+	return &router.Registrar{
+		Authenticate: h.AuthMiddleware(),
+		Scopes: map[string]gin.HandlerFunc{
+			router.ScopeAdmin: AdminMiddleware(),
+		},
+		Limiter:   limiter,
+		Consent:   h.ConsentMiddleware(),
+		DryRun:    DryRunMiddleware(),
+		Negotiate: ContentNegotiationMiddleware(),
+	}
+}
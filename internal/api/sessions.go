@@ -0,0 +1,260 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/auth"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/session"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// ConfigureSessions sets the manager tracking login sessions and refresh
+// tokens; nil disables sessions
+func (h *Handler) ConfigureSessions(manager *session.Manager) {
+	h.sessions = manager
+}
+
+// issueTokens starts a session when sessions are enabled and signs an access
+// token for user. refreshToken is empty when sessions are disabled. The
+// device logging in is recorded, alerting the user when it is new.
+func (h *Handler) issueTokens(c *gin.Context, user *models.User) (accessToken, refreshToken string, err error) {
+	identity := auth.Identity{UserID: user.ID, Role: user.Role, TenantID: user.TenantID}
+	h.recordDevice(c, user)
+
+	if h.sessions != nil {
+		s, refresh, err := h.sessions.Start(c.Request.Context(), user.ID, user.TenantID, c.ClientIP(), c.Request.UserAgent())
+		if err != nil {
+			return "", "", err
+		}
+		identity.SessionID = s.ID
+		refreshToken = refresh
+	}
+
+	accessToken, err = h.tokens.GenerateToken(identity)
+	return accessToken, refreshToken, err
+}
+
+// recordDevice remembers the device of a login. Failures are only logged:
+// they must not block the login.
+func (h *Handler) recordDevice(c *gin.Context, user *models.User) {
+	device := session.ParseDevice(c.Request.UserAgent())
+	known := models.KnownDevice{Key: device.Key(), Name: device.Name, Type: device.Type, LastIP: c.ClientIP()}
+	isNew, err := h.users.RecordDevice(c.Request.Context(), user, known)
+	if err != nil {
+		logger.Log.WithError(err).WithField("user_id", user.ID).Warn("Failed to record login device")
+		return
+	}
+	if isNew {
+		logAuth(c, "new_device", user.Email).WithField("user_id", user.ID).WithField("device", device.Name).Info("Login from a new device")
+	}
+}
+
+// tokenResponse builds a response body including the issued tokens
+func tokenResponse(message string, user *models.User, accessToken, refreshToken string) gin.H {
+	body := gin.H{
+		"message": message,
+		"user":    user,
+		"token":   accessToken,
+	}
+	if refreshToken != "" {
+		body["refresh_token"] = refreshToken
+	}
+	return body
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a rotated refresh token
+func (h *Handler) RefreshToken(c *gin.Context) {
+	if h.sessions == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sessions are not enabled"})
+		return
+	}
+
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	s, refreshToken, err := h.sessions.Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, session.ErrNotFound) || errors.Is(err, session.ErrInvalidRefreshToken) {
+			logger.Log.WithError(err).Warn("Refresh token rejected")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		logger.Log.WithError(err).Error("Failed to refresh session")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	user, err := h.users.GetUser(c.Request.Context(), s.UserID)
+	if err != nil {
+		_ = h.sessions.Revoke(c.Request.Context(), s.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if !user.IsActive() {
+		_ = h.sessions.Revoke(c.Request.Context(), s.ID)
+		h.rejectInactive(c, user)
+		return
+	}
+
+	accessToken, err := h.tokens.GenerateToken(auth.Identity{UserID: user.ID, Role: user.Role, TenantID: user.TenantID, SessionID: s.ID})
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to generate JWT")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenResponse("Token refreshed successfully", user, accessToken, refreshToken))
+}
+
+// Logout revokes the caller's current session
+func (h *Handler) Logout(c *gin.Context) {
+	identity := currentIdentity(c)
+	if h.sessions != nil && identity.SessionID != "" {
+		if err := h.sessions.Revoke(c.Request.Context(), identity.SessionID); err != nil {
+			logger.Log.WithError(err).Error("Failed to revoke session")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// GetMySessions lists the caller's live sessions, marking the one the
+// request was made with
+func (h *Handler) GetMySessions(c *gin.Context) {
+	if h.sessions == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sessions are not enabled"})
+		return
+	}
+
+	identity := currentIdentity(c)
+	list, err := h.sessions.ListByUser(c.Request.Context(), identity.UserID)
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to list sessions")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list sessions"})
+		return
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].LastSeenAt.After(list[j].LastSeenAt)
+	})
+
+	c.JSON(http.StatusOK, gin.H{"sessions": list, "current_session_id": identity.SessionID})
+}
+
+// RevokeMySession signs out one of the caller's sessions, e.g. a lost device
+func (h *Handler) RevokeMySession(c *gin.Context) {
+	if h.sessions == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sessions are not enabled"})
+		return
+	}
+
+	// Other users' sessions are reported as missing rather than forbidden
+	userID := c.GetUint("user_id")
+	s, err := h.sessions.Validate(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, session.ErrNotFound) || (err == nil && s.UserID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err == nil {
+		err = h.sessions.Revoke(c.Request.Context(), s.ID)
+	}
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to revoke session")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	logger.Log.WithField("session_id", s.ID).WithField("user_id", userID).Info("Session revoked by its user")
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// Admin session handlers
+
+// GetSessions lists active sessions across all instances, filtered by
+// user_id and ip and paginated with page and page_size
+func (h *Handler) GetSessions(c *gin.Context) {
+	if h.sessions == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sessions are not enabled"})
+		return
+	}
+
+	userID, _ := strconv.Atoi(c.Query("user_id"))
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page"})
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if err != nil || pageSize < 1 || pageSize > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page_size"})
+		return
+	}
+
+	list, total, err := h.sessions.List(c.Request.Context(), session.Filter{
+		UserID: uint(userID),
+		IP:     c.Query("ip"),
+		Offset: (page - 1) * pageSize,
+		Limit:  pageSize,
+	})
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to list sessions")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions":  list,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// RevokeSession ends any session immediately
+func (h *Handler) RevokeSession(c *gin.Context) {
+	if h.sessions == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sessions are not enabled"})
+		return
+	}
+
+	if err := h.sessions.Revoke(c.Request.Context(), c.Param("id")); err != nil {
+		logger.Log.WithError(err).Error("Failed to revoke session")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	logger.Log.WithField("session_id", c.Param("id")).WithField("admin_id", GetUserIDFromContext(c)).Info("Session revoked")
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// RevokeUserSessions ends all sessions of a user
+func (h *Handler) RevokeUserSessions(c *gin.Context) {
+	if h.sessions == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sessions are not enabled"})
+		return
+	}
+
+	id, ok := parseID(c, "user")
+	if !ok {
+		return
+	}
+
+	if err := h.sessions.RevokeUser(c.Request.Context(), id); err != nil {
+		logger.Log.WithError(err).Error("Failed to revoke user sessions")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	logger.Log.WithField("user_id", id).WithField("admin_id", GetUserIDFromContext(c)).Info("User sessions revoked")
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked successfully"})
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/slo"
+)
+
+// ConfigureSLO enables the SLO report endpoint
+func (h *Handler) ConfigureSLO(tracker *slo.Tracker) {
+	h.slo = tracker
+}
+
+// GetSLOReport returns each endpoint's availability and latency against its
+// objective, with the error budget left in the rolling window (admin only)
+func (h *Handler) GetSLOReport(c *gin.Context) {
+	if h.slo == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "SLO tracking is disabled"})
+		return
+	}
+
+	reports := h.slo.Reports()
+	met := true
+	for _, r := range reports {
+		met = met && r.Met
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"window":    h.slo.Window().String(),
+		"met":       met,
+		"endpoints": reports,
+	})
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// rejectInactive responds 403 and returns false when user's account is
+// suspended or deactivated. Login paths call it once the credentials are
+// known to be right, so the status isn't revealed to anyone else.
+func (h *Handler) rejectInactive(c *gin.Context, user *models.User) bool {
+	if user.IsActive() {
+		return true
+	}
+	logAuth(c, "login_refused", user.Email).WithField("user_id", user.ID).WithField("status", user.Status).Warn("Login to inactive account refused")
+	switch user.Status {
+	case models.StatusDeactivated:
+		c.JSON(http.StatusForbidden, gin.H{"error": "This account has been deactivated", "code": "account_deactivated"})
+	case models.StatusInvited:
+		c.JSON(http.StatusForbidden, gin.H{"error": "This account's invitation has not been accepted yet", "code": "invitation_pending"})
+	default:
+		c.JSON(http.StatusForbidden, gin.H{"error": "This account has been suspended", "code": "account_suspended"})
+	}
+	return false
+}
+
+// SuspendUser locks a user's account and ends their sessions
+func (h *Handler) SuspendUser(c *gin.Context) {
+	id, ok := parseID(c, "user")
+	if !ok {
+		return
+	}
+	if id == currentIdentity(c).UserID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot suspend yourself"})
+		return
+	}
+
+	user, err := h.users.SuspendUser(c.Request.Context(), id)
+	if err != nil {
+		respondStatusError(c, err, "suspend")
+		return
+	}
+	h.endSessions(c.Request.Context(), user.ID)
+
+	logger.Log.WithField("user_id", user.ID).WithField("admin_id", GetUserIDFromContext(c)).Info("User suspended")
+	c.JSON(http.StatusOK, gin.H{"message": "User suspended successfully", "user": user})
+}
+
+// ReactivateUser restores a suspended or deactivated account
+func (h *Handler) ReactivateUser(c *gin.Context) {
+	id, ok := parseID(c, "user")
+	if !ok {
+		return
+	}
+
+	user, err := h.users.ReactivateUser(c.Request.Context(), id)
+	if err != nil {
+		respondStatusError(c, err, "reactivate")
+		return
+	}
+
+	logger.Log.WithField("user_id", user.ID).WithField("admin_id", GetUserIDFromContext(c)).Info("User reactivated")
+	c.JSON(http.StatusOK, gin.H{"message": "User reactivated successfully", "user": user})
+}
+
+// DeactivateMe closes the caller's account without deleting it and logs
+// them out everywhere. Only an admin can reactivate it.
+func (h *Handler) DeactivateMe(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	user, err := h.users.DeactivateUser(c.Request.Context(), userID)
+	if err != nil {
+		respondStatusError(c, err, "deactivate")
+		return
+	}
+	h.endSessions(c.Request.Context(), user.ID)
+
+	logger.Log.WithField("user_id", user.ID).Info("User deactivated their account")
+	c.JSON(http.StatusOK, gin.H{"message": "Account deactivated successfully", "user": user})
+}
+
+// endSessions revokes a user's sessions so their tokens stop working; a
+// failure is logged since the status change itself already succeeded
+func (h *Handler) endSessions(ctx context.Context, userID uint) {
+	if h.sessions == nil {
+		return
+	}
+	if err := h.sessions.RevokeUser(ctx, userID); err != nil {
+		logger.Log.WithError(err).WithField("user_id", userID).Error("Failed to revoke sessions of inactive user")
+	}
+}
+
+func respondStatusError(c *gin.Context, err error, action string) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	logger.LogDatabase("update", "users").WithError(err).Errorf("Failed to %s user", action)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action + " user"})
+}
@@ -0,0 +1,222 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/logger"
+)
+
+// Headers selecting how timestamps are rendered in JSON responses
+const (
+	TimeZoneHeader   = "Time-Zone"   // IANA zone name, e.g. Europe/Amsterdam
+	TimeFormatHeader = "Time-Format" // one of the TimeFormat* values
+)
+
+// Timestamp formats accepted in the Time-Format header
+const (
+	TimeFormatRFC3339 = "rfc3339"
+	TimeFormatRFC1123 = "rfc1123"
+	TimeFormatUnix    = "unix"
+	TimeFormatUnixMs  = "unix_ms"
+)
+
+// timeZoneAttribute is the custom user attribute consulted when a request
+// doesn't send Time-Zone
+const timeZoneAttribute = "timezone"
+
+// timestampKeys are JSON keys holding timestamps besides those ending in _at
+var timestampKeys = map[string]bool{
+	"timestamp":  true,
+	"valid_from": true,
+	"valid_to":   true,
+}
+
+// timeRendering is how a response's timestamps are rendered
+type timeRendering struct {
+	location *time.Location
+	format   string
+}
+
+// TimeRenderingMiddleware rewrites the timestamps of JSON responses into
+// the caller's timezone and format. The timezone comes from the Time-Zone
+// header or, for authenticated callers, their "timezone" attribute.
+// Responses are left untouched when neither is set.
+func (h *Handler) TimeRenderingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rendering := timeRendering{format: TimeFormatRFC3339}
+
+		if name := c.GetHeader(TimeZoneHeader); name != "" {
+			location, err := time.LoadLocation(name)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Unknown time zone in " + TimeZoneHeader})
+				return
+			}
+			rendering.location = location
+		}
+		if format := c.GetHeader(TimeFormatHeader); format != "" {
+			switch format {
+			case TimeFormatRFC3339, TimeFormatRFC1123, TimeFormatUnix, TimeFormatUnixMs:
+				rendering.format = format
+			default:
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Unsupported " + TimeFormatHeader})
+				return
+			}
+		}
+
+		// Without a header or credentials there is nothing to apply
+		explicit := rendering.location != nil || rendering.format != TimeFormatRFC3339
+		if !explicit && c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+
+		writer := &bufferedJSONWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if !writer.buffering {
+			return
+		}
+		body := writer.buf.Bytes()
+
+		if rendering.location == nil {
+			rendering.location = h.preferredLocation(c)
+		}
+		if rendering.location != nil || rendering.format != TimeFormatRFC3339 {
+			if rendering.location == nil {
+				rendering.location = time.UTC
+			}
+			if transformed, err := rendering.apply(body); err == nil {
+				body = transformed
+				c.Header(TimeZoneHeader, rendering.location.String())
+			} else {
+				logger.Log.WithError(err).Warn("Failed to render response timestamps")
+			}
+		}
+
+		if _, err := c.Writer.Write(body); err != nil {
+			logger.Log.WithError(err).Debug("Failed to write response")
+		}
+	}
+}
+
+// preferredLocation returns the authenticated caller's preferred time zone,
+// if they have a valid one
+func (h *Handler) preferredLocation(c *gin.Context) *time.Location {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		return nil
+	}
+	user, err := h.users.GetUser(c.Request.Context(), userID)
+	if err != nil {
+		return nil
+	}
+	name, _ := user.Attributes[timeZoneAttribute].(string)
+	if name == "" {
+		return nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil
+	}
+	return location
+}
+
+// apply rewrites every timestamp in a JSON document
+func (r timeRendering) apply(body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(r.walk("", doc))
+}
+
+func (r timeRendering) walk(key string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			v[k] = r.walk(k, child)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = r.walk(key, child)
+		}
+		return v
+	case string:
+		if !strings.HasSuffix(key, "_at") && !timestampKeys[key] {
+			return v
+		}
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return v
+		}
+		return r.render(t)
+	default:
+		return v
+	}
+}
+
+func (r timeRendering) render(t time.Time) interface{} {
+	t = t.In(r.location)
+	switch r.format {
+	case TimeFormatRFC1123:
+		return t.Format(time.RFC1123Z)
+	case TimeFormatUnix:
+		return t.Unix()
+	case TimeFormatUnixMs:
+		return t.UnixMilli()
+	default:
+		return t.Format(time.RFC3339Nano)
+	}
+}
+
+// bufferedJSONWriter holds back JSON response bodies so they can be
+// rewritten; other content types (e.g. streams) pass straight through
+type bufferedJSONWriter struct {
+	gin.ResponseWriter
+	buf       bytes.Buffer
+	decided   bool
+	buffering bool
+}
+
+func (w *bufferedJSONWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	w.buffering = mediaType == "application/json"
+}
+
+func (w *bufferedJSONWriter) Write(data []byte) (int, error) {
+	w.decide()
+	if !w.buffering {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.buf.Write(data)
+}
+
+func (w *bufferedJSONWriter) WriteString(s string) (int, error) {
+	w.decide()
+	if !w.buffering {
+		return w.ResponseWriter.WriteString(s)
+	}
+	return w.buf.WriteString(s)
+}
+
+func (w *bufferedJSONWriter) Flush() {
+	if !w.buffering {
+		w.ResponseWriter.Flush()
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/service"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// Two-factor authentication handlers on the caller's own account
+
+// EnrollTwoFactor starts TOTP enrollment, returning the secret and the
+// otpauth:// provisioning URI to render as a QR code
+func (h *Handler) EnrollTwoFactor(c *gin.Context) {
+	if !requireAccountOwner(c) {
+		return
+	}
+	userID := c.GetUint("user_id")
+
+	enrollment, err := h.users.EnrollTwoFactor(c.Request.Context(), userID)
+	if err != nil {
+		twoFactorError(c, err, "Failed to start two-factor enrollment")
+		return
+	}
+
+	logger.Log.WithField("user_id", userID).Info("Two-factor enrollment started")
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// VerifyTwoFactor confirms enrollment with a code from the authenticator,
+// enabling 2FA and returning the backup codes
+func (h *Handler) VerifyTwoFactor(c *gin.Context) {
+	if !requireAccountOwner(c) {
+		return
+	}
+	userID := c.GetUint("user_id")
+
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	codes, err := h.users.ConfirmTwoFactor(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		twoFactorError(c, err, "Failed to enable two-factor authentication")
+		return
+	}
+
+	logger.Log.WithField("user_id", userID).Info("Two-factor authentication enabled")
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication enabled", "backup_codes": codes})
+}
+
+// DisableTwoFactor turns 2FA off; the body must carry a current code
+func (h *Handler) DisableTwoFactor(c *gin.Context) {
+	if !requireAccountOwner(c) {
+		return
+	}
+	userID := c.GetUint("user_id")
+
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	if err := h.users.DisableTwoFactor(c.Request.Context(), userID, req.Code); err != nil {
+		twoFactorError(c, err, "Failed to disable two-factor authentication")
+		return
+	}
+
+	logger.Log.WithField("user_id", userID).Info("Two-factor authentication disabled")
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// requireAccountOwner rejects impersonation tokens, so an admin acting as
+// a user cannot change how that user signs in
+func requireAccountOwner(c *gin.Context) bool {
+	if currentIdentity(c).IsImpersonated() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed while impersonating a user"})
+		return false
+	}
+	return true
+}
+
+// twoFactorError maps two-factor service errors to HTTP responses
+func twoFactorError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidTwoFactorCode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "code": "invalid_two_factor_code"})
+	case errors.Is(err, service.ErrTwoFactorEnabled), errors.Is(err, service.ErrTwoFactorNotEnabled),
+		errors.Is(err, service.ErrTwoFactorNotEnrolled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		logger.Log.WithError(err).Error(message)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/validation"
+)
+
+// respondBindError answers a request whose body failed to bind. Validation
+// failures list each rejected field, a body over the size limit is a 413;
+// other errors (e.g. malformed JSON) are reported as-is.
+func respondBindError(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		abortBodyTooLarge(c)
+		return
+	}
+	if fields, ok := validation.Translate(err); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "code": "validation_failed", "fields": fields})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
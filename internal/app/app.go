@@ -0,0 +1,594 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/api"
+	"github.com/114windd/restapi/internal/auth"
+	"github.com/114windd/restapi/internal/bruteforce"
+	"github.com/114windd/restapi/internal/cache"
+	"github.com/114windd/restapi/internal/captcha"
+	"github.com/114windd/restapi/internal/config"
+	"github.com/114windd/restapi/internal/consent"
+	"github.com/114windd/restapi/internal/cron"
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/errorreporting"
+	"github.com/114windd/restapi/internal/events"
+	"github.com/114windd/restapi/internal/experiments"
+	"github.com/114windd/restapi/internal/geoip"
+	"github.com/114windd/restapi/internal/graphql"
+	grpcserver "github.com/114windd/restapi/internal/grpc"
+	"github.com/114windd/restapi/internal/i18n"
+	"github.com/114windd/restapi/internal/invitation"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/mail"
+	"github.com/114windd/restapi/internal/metrics"
+	"github.com/114windd/restapi/internal/middleware"
+	"github.com/114windd/restapi/internal/oauth"
+	"github.com/114windd/restapi/internal/organization"
+	"github.com/114windd/restapi/internal/phone"
+	"github.com/114windd/restapi/internal/preferences"
+	"github.com/114windd/restapi/internal/privacy"
+	"github.com/114windd/restapi/internal/recovery"
+	"github.com/114windd/restapi/internal/router"
+	"github.com/114windd/restapi/internal/security"
+	"github.com/114windd/restapi/internal/service"
+	"github.com/114windd/restapi/internal/session"
+	"github.com/114windd/restapi/internal/slo"
+	"github.com/114windd/restapi/internal/sms"
+	"github.com/114windd/restapi/internal/static"
+	"github.com/114windd/restapi/internal/storage"
+	"github.com/114windd/restapi/pkg/proto"
+)
+
+// eventStreamBuffer is how many events an /events client may fall behind
+// before it is disconnected
+const eventStreamBuffer = 256
+
+// App is the application container. New wires its components in
+// dependency order; fields are listed in that order.
+type App struct {
+	Config   *config.Config
+	Logger   *logrus.Logger
+	Errors   *errorreporting.Reporter
+	Repo     database.UserRepository
+	Storage  *storage.Stores
+	Cache    *cache.Cache
+	Mailer   mail.Mailer
+	GeoIP    *geoip.Locator // nil unless GEOIP_DATABASE_PATH is set
+	Messages *i18n.Catalog
+	Tokens   *auth.Tokens
+	Users    *service.UserService
+	Objects  storage.ObjectStore
+	Events   *events.Publisher // nil unless EVENTS_BROKER is set
+	EventHub *events.Hub
+	SLO      *slo.Tracker
+	Sessions *session.Manager // nil unless sessions are enabled
+	Recovery *recovery.Service
+	Privacy  *privacy.Service
+	Consent  *consent.Service
+	Prefs    *preferences.Service
+	Invites  *invitation.Service
+	SMS      *sms.Client
+	Phone    *phone.Service
+	Security *security.Monitor // nil unless ANOMALY_DETECTION is set
+	Orgs     *organization.Service
+	Static   *static.Server // nil unless STATIC_DIR or STATIC_EMBEDDED is set
+	Handler  *api.Handler
+	GRPC     *grpcserver.GrpcUserService
+	Cron     *cron.Scheduler // nil unless CRON_ENABLED; started by the caller
+
+	// Health holds the dependencies reported by /readyz
+	Health *metrics.Registry
+	// RateLimits are enforced per rate limit class; nil disables rate limiting
+	RateLimits map[string]router.RateLimit
+	// Experiments and CORS are reconfigured by Reload
+	Experiments *experiments.Service
+	CORS        *api.CORS
+
+	limiter  *router.Limiter // enforces RateLimits, see rateLimiter
+	ctx      context.Context // lifetime of background work, ended by Shutdown
+	stop     context.CancelFunc
+	reloadMu sync.Mutex
+	reloaded reloadable // the settings last applied by Reload
+}
+
+// MigrationOptions returns how the schema is migrated under cfg
+func MigrationOptions(cfg *config.Config) database.MigrationOptions {
+	return database.MigrationOptions{
+		LockTimeout:      cfg.Database.MigrationLockTimeout,
+		Role:             cfg.Database.MaintenanceRole,
+		RowLevelSecurity: cfg.Database.TenancyMode == config.TenancyModeRLS,
+	}
+}
+
+// New connects to the database and wires the application. The logger must
+// be initialized first. With DB_LAZY_CONNECT the database is connected in
+// the background instead, and /readyz reports not ready until it is.
+func New(cfg *config.Config) (*App, error) {
+	var repo *database.PostgresRepository
+	var err error
+	if cfg.Database.LazyConnect {
+		repo, err = database.OpenLazy(cfg.Database.URL)
+	} else {
+		repo, err = database.Connect(cfg.Database.URL, MigrationOptions(cfg), cfg.Database.ConnectTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	repo.SetQueryTimeout(cfg.Database.QueryTimeout)
+	repo.SetSlowQueryThreshold(cfg.Database.SlowQueryThreshold)
+	if cfg.Database.PrepareStatements {
+		repo.EnablePreparedStatements()
+	}
+	if cfg.Database.SessionSettings {
+		repo.RegisterSessionHook(database.ApplySessionSettings)
+	}
+	if cfg.Database.TenancyMode == config.TenancyModeRLS {
+		repo.RegisterSessionHook(database.ApplyTenant)
+	}
+	if err := repo.UseReplicas(cfg.Database.ReplicaURLs, cfg.Database.ReplicaCheckInterval); err != nil {
+		return nil, err
+	}
+
+	a, err := NewWithRepository(cfg, repo)
+	if err != nil {
+		return nil, err
+	}
+	a.Health.Register("database", metrics.CheckFunc(repo.CheckConnection))
+	a.Health.Register("migrations", metrics.CheckFunc(repo.CheckMigrations))
+	if cfg.Database.LazyConnect {
+		logger.Log.Info("Connecting to the database in the background")
+		repo.ConnectInBackground(a.ctx, MigrationOptions(cfg))
+	}
+	if cfg.Database.HealthCheckInterval > 0 {
+		// Outages open the circuit breaker and degrade /readyz until the connection is back
+		repo.MonitorConnection(a.ctx, cfg.Database.HealthCheckInterval, cfg.Database.OutageThreshold)
+	}
+	if len(cfg.Database.ReplicaURLs) > 0 {
+		// Reads fail over to the primary, so losing the replicas only degrades
+		a.Users.SetReplicaReads(true)
+		a.Health.Register("replicas", metrics.CheckFunc(repo.CheckReplicas), metrics.Optional())
+	}
+	return a, nil
+}
+
+// NewWithRepository wires the application on top of an existing repository
+func NewWithRepository(cfg *config.Config, repo database.UserRepository) (*App, error) {
+	// Rate limit, cache and session state, in memory or shared through Redis
+	stores, err := storage.New(cfg.Storage, cfg.Cache.TTL)
+	if err != nil {
+		return nil, fmt.Errorf("configure storage: %w", err)
+	}
+
+	a := &App{
+		Config:   cfg,
+		Logger:   logger.Log,
+		Errors:   errorreporting.New(),
+		Repo:     repo,
+		Storage:  stores,
+		Cache:    cache.New(stores.Cache),
+		Messages: i18n.NewCatalog(),
+		Tokens:   newTokens(cfg.Auth),
+
+		reloaded: reloadableSettings(cfg),
+	}
+	a.ctx, a.stop = context.WithCancel(context.Background())
+
+	a.RateLimits, err = router.ParseRateLimits(cfg.API.RateLimits, router.DefaultRateLimits)
+	if err != nil {
+		return nil, fmt.Errorf("configure rate limits: %w", err)
+	}
+	a.CORS = api.NewCORS(cfg.Security.CORSOrigins)
+
+	// Panics and server errors go to Sentry when configured
+	if cfg.Errors.SentryDSN != "" {
+		hook, err := errorreporting.NewSentryHook(cfg.Errors.SentryDSN, cfg.Errors.Environment, cfg.Errors.Release)
+		if err != nil {
+			return nil, fmt.Errorf("configure error reporting: %w", err)
+		}
+		a.Errors.AddHook(hook)
+	}
+
+	// Client locations in request logs and login audit records
+	if cfg.GeoIP.DatabasePath != "" {
+		if a.GeoIP, err = geoip.Open(cfg.GeoIP.DatabasePath, cfg.GeoIP.CacheSize); err != nil {
+			return nil, fmt.Errorf("configure GeoIP: %w", err)
+		}
+	}
+
+	// Email is rendered from templates and sent in the background
+	mailQueue, err := mail.New(context.Background(), cfg.Mail)
+	if err != nil {
+		return nil, fmt.Errorf("configure mail: %w", err)
+	}
+	a.Mailer = mailQueue
+
+	a.Users = service.NewUserService(a.Repo, a.Cache)
+	a.Users.SetEmailDomainPolicy(service.EmailDomainPolicy{
+		Allow: cfg.Signup.AllowedDomains,
+		Deny:  cfg.Signup.DeniedDomains,
+	})
+	a.Users.SetTOTPIssuer(cfg.Auth.TOTPIssuer)
+	a.Users.SetEmailNormalization(cfg.Signup.StripPlusTags)
+	a.Users.SetEmailAvailabilityTTL(cfg.Signup.EmailAvailabilityCacheTTL)
+	a.Users.SetMailer(a.Mailer)
+
+	// User events to Kafka or NATS
+	publisher, err := events.New(cfg.Events)
+	if err != nil {
+		return nil, fmt.Errorf("configure events: %w", err)
+	}
+	if publisher != nil {
+		a.Events = publisher
+		a.Users.SetEventPublisher(publisher)
+	}
+	// Admins can follow the same events live on /events
+	a.EventHub = events.NewHub(cfg.Events.StreamHistory, eventStreamBuffer)
+	a.Users.SetEventHub(a.EventHub)
+
+	a.Health = metrics.NewRegistry()
+	a.Health.Register("database", metrics.CheckFunc(repo.Ping))
+	a.Health.Register("cache", metrics.CheckFunc(a.Users.PingCache))
+	if stores.Ping != nil {
+		a.Health.Register("storage", metrics.CheckFunc(stores.Ping))
+	}
+	if a.Events != nil {
+		a.Health.Register("events", a.Events, metrics.Optional())
+	}
+	a.Health.Register("mail", mailQueue, metrics.Optional())
+	logger.Log.WithField("backend", stores.Backend).Info("State storage configured")
+
+	a.Handler = api.NewHandler(a.Users, a.Tokens)
+	a.Handler.ConfigureTimeouts(cfg.API.RequestTimeout, cfg.API.LongRequestTimeout)
+	a.Handler.ConfigureImpersonation(cfg.Auth.ImpersonationTTL)
+	a.Handler.ConfigureEventStream(a.EventHub, cfg.Events.StreamHeartbeat)
+	a.Handler.ConfigureAdminUI(cfg.API.AdminUI)
+
+	// A frontend deployed with the API, at paths no route takes
+	switch {
+	case cfg.Static.Embedded:
+		a.Static = static.New(static.Embedded(), cfg.Static.SPA)
+	case cfg.Static.Dir != "":
+		if info, err := os.Stat(cfg.Static.Dir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("configure static files: %s is not a directory", cfg.Static.Dir)
+		}
+		a.Static = static.New(os.DirFS(cfg.Static.Dir), cfg.Static.SPA)
+	}
+
+	// Per-endpoint availability and latency objectives
+	objectives, err := slo.ParseObjectives(cfg.SLO.Objectives)
+	if err != nil {
+		return nil, fmt.Errorf("configure SLOs: %w", err)
+	}
+	if cfg.SLO.Window < time.Minute {
+		return nil, fmt.Errorf("configure SLOs: window %s is shorter than a minute", cfg.SLO.Window)
+	}
+	a.SLO = slo.NewTracker(objectives, cfg.SLO.Window)
+	a.Handler.ConfigureSLO(a.SLO)
+	// Email checks would undo uniform signup answers without a CAPTCHA
+	a.Handler.ConfigureEmailCheck(cfg.Signup.CheckEmailRequireCaptcha || cfg.Enumeration.UniformSignup)
+	a.Handler.ConfigureEnumerationProtection(cfg.Enumeration.UniformSignup, cfg.Enumeration.Honeypot, cfg.Enumeration.Jitter)
+
+	// A/B experiments; unconfigured experiments leave /me/experiments empty
+	defs, err := experiments.Parse(cfg.Experiments.Definitions)
+	if err != nil {
+		return nil, fmt.Errorf("configure experiments: %w", err)
+	}
+	a.Experiments = experiments.NewService(defs, a.Repo)
+	a.Handler.ConfigureExperiments(a.Experiments)
+
+	// Login with Google, GitHub and other external providers
+	providers, err := oauth.New(cfg.OAuth)
+	if err != nil {
+		return nil, fmt.Errorf("configure OAuth: %w", err)
+	}
+	a.Handler.ConfigureOAuth(providers, stores.Codes(api.TwoFactorTokenTTL))
+
+	// CAPTCHA challenges on /login and /signup after repeated failures
+	if cfg.Captcha.Provider != "" {
+		verifier, err := captcha.New(cfg.Captcha.Provider, cfg.Captcha.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("configure CAPTCHA: %w", err)
+		}
+		a.Handler.ConfigureCaptcha(captcha.NewChallenge(verifier, cfg.Captcha.FailureThreshold, cfg.Captcha.FailureWindow))
+	}
+
+	// Avatar images and exports in local, S3 or MinIO object storage
+	a.Objects, err = storage.NewObjectStore(cfg.Objects)
+	if err != nil {
+		return nil, fmt.Errorf("configure object storage: %w", err)
+	}
+	a.Users.SetAvatarStore(a.Objects, cfg.Avatars.MaxDimension)
+	a.Handler.ConfigureObjects(a.Objects)
+	a.Handler.ConfigureAvatars(cfg.Avatars.MaxBytes)
+
+	// Progressive delays on /login after repeated failures
+	if cfg.BruteForce.BaseDelay > 0 {
+		a.Handler.ConfigureBruteForce(bruteforce.NewGuard(stores.Failures, cfg.BruteForce.FreeAttempts, cfg.BruteForce.BaseDelay, cfg.BruteForce.MaxDelay, cfg.BruteForce.Window))
+	}
+
+	// Server-side sessions, enabling refresh tokens and instant revocation
+	if cfg.Session.Enabled {
+		a.Sessions = session.NewManager(stores.Sessions, cfg.Session.TTL)
+		a.Handler.ConfigureSessions(a.Sessions)
+		a.Tokens.SetSessionValidator(func(ctx context.Context, id string) error {
+			s, err := a.Sessions.Validate(ctx, id)
+			if err != nil {
+				return err
+			}
+			// Last-seen tracking is best effort and never fails a request
+			if err := a.Sessions.Seen(ctx, s); err != nil && !errors.Is(err, session.ErrNotFound) {
+				logger.Log.WithError(err).WithField("session_id", id).Warn("Failed to record session activity")
+			}
+			return nil
+		})
+	}
+	// Without sessions to revoke, suspending or deactivating an account
+	// takes effect through a status check on each token, served from the
+	// user cache that status changes invalidate. Tokens of users that don't
+	// exist are left to the handlers, which answer 404. With sessions, the
+	// check covers impersonation tokens, which carry no session.
+	a.Tokens.SetAccountValidator(func(ctx context.Context, identity *auth.Identity) error {
+		if identity.TenantID != "" {
+			ctx = database.WithTenant(ctx, identity.TenantID)
+		}
+		if err := a.checkAccount(ctx, identity.UserID, identity.IsImpersonated()); err != nil {
+			return err
+		}
+		// The admin's own account must stay active too
+		if identity.IsImpersonated() {
+			return a.checkAccount(ctx, identity.ActorID, true)
+		}
+		return nil
+	})
+
+	// Admin-verified recovery for users who lost access to their email
+	a.Recovery = recovery.NewService(a.Repo, a.Users, a.Mailer, cfg.Recovery.RequiredApprovals, cfg.Recovery.TokenTTL)
+	if a.Sessions != nil {
+		a.Recovery.SetSessions(a.Sessions)
+	}
+	a.Handler.ConfigureRecovery(a.Recovery)
+
+	// Accounts created by admins, activated by the invitee
+	a.Invites = invitation.NewService(a.Repo, a.Users, a.Mailer, cfg.Invitations.TTL)
+	a.Handler.ConfigureInvitations(a.Invites)
+
+	// Personal data exports and erasure on account deletion
+	a.Privacy = privacy.NewService(a.Repo, a.Users, a.Objects, cfg.Privacy.ExportRetention, cfg.Privacy.ExportLinkTTL)
+	if a.Sessions != nil {
+		a.Privacy.SetSessions(a.Sessions)
+	}
+	a.Handler.ConfigurePrivacy(a.Privacy)
+	if cfg.API.GraphQL {
+		a.Handler.ConfigureGraphQL(graphql.NewServer(a.Users, a.Privacy), cfg.API.GraphQLPlayground)
+	}
+
+	// Terms of service acceptance, enforced once a version is configured
+	a.Consent = consent.NewService(a.Repo, a.Cache, cfg.Consent.TermsVersion)
+	a.Handler.ConfigureConsent(a.Consent)
+
+	a.Prefs = preferences.NewService(a.Repo)
+	a.Handler.ConfigurePreferences(a.Prefs)
+
+	a.Orgs = organization.NewService(a.Repo, a.Users)
+	a.Handler.ConfigureOrganizations(a.Orgs)
+
+	// Phone verification and login codes by SMS, rate limited per number
+	a.SMS, err = sms.New(cfg.SMS)
+	if err != nil {
+		return nil, fmt.Errorf("configure SMS: %w", err)
+	}
+	a.Phone = phone.NewService(a.Users, a.SMS, stores.Codes(cfg.SMS.CodeTTL), cfg.SMS.CodeTTL)
+	a.Phone.SetRateLimit(stores.Limits, cfg.SMS.RateLimit, cfg.SMS.RateWindow)
+	a.Handler.ConfigurePhone(a.Phone, a.SMS, cfg.SMS.OTPLogin)
+
+	// Anomaly detection on logins: flags for review, step-up codes and alerts
+	if cfg.Anomaly.Enabled {
+		a.Security = security.NewMonitor(
+			security.NewFailedLogins(stores.Codes(cfg.Anomaly.FailedLoginWindow), cfg.Anomaly.FailedLogins, cfg.Anomaly.FailedLoginWindow),
+			security.NewNewIP(stores.Codes(cfg.Anomaly.HistoryTTL)),
+			security.NewImpossibleTravel(stores.Codes(cfg.Anomaly.HistoryTTL), float64(cfg.Anomaly.MaxTravelSpeed)),
+		)
+		a.Security.SetFlagStore(a.Repo)
+		if cfg.Anomaly.WebhookURL != "" {
+			a.Security.SetAlerter(security.NewWebhookAlerter(cfg.Anomaly.WebhookURL, cfg.Anomaly.WebhookSecret))
+		}
+		var stepUp *security.StepUp
+		if cfg.Anomaly.StepUp {
+			stepUp = security.NewStepUp(stores.Codes(cfg.Anomaly.StepUpTTL), a.Mailer, cfg.Anomaly.StepUpTTL)
+		}
+		a.Handler.ConfigureAnomalyDetection(a.Security, stepUp)
+	}
+
+	a.GRPC = grpcserver.NewGrpcUserService(a.Users)
+	a.GRPC.ConfigurePrivacy(a.Privacy)
+
+	// Periodic cleanup of stale data
+	if cfg.Cron.Enabled {
+		a.Cron = cron.NewScheduler()
+		if a.Sessions != nil {
+			a.Cron.Register(cron.PurgeExpiredSessions(a.Sessions), cfg.Cron.SessionPurgeInterval)
+		}
+		a.Cron.Register(cron.ExpireRecoveryTokens(a.Recovery), cfg.Cron.RecoveryTokenInterval)
+		a.Cron.Register(cron.PurgeExpiredExports(a.Privacy), cfg.Cron.ExportPurgeInterval)
+		if cfg.Cron.HistoryRetention > 0 {
+			a.Cron.Register(cron.PurgeUserHistory(a.Repo, cfg.Cron.HistoryRetention), cfg.Cron.HistoryPurgeInterval)
+		}
+		a.Health.Register("scheduler", a.Cron, metrics.Optional())
+	}
+	return a, nil
+}
+
+// checkAccount fails unless user id can still sign in. A user that doesn't
+// exist passes unless required, since its handlers answer 404 anyway.
+func (a *App) checkAccount(ctx context.Context, id uint, required bool) error {
+	user, err := a.Users.GetUser(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if required {
+			return errors.New("account no longer exists")
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !user.IsActive() {
+		return fmt.Errorf("account is %s", user.Status)
+	}
+	return nil
+}
+
+// Router builds the REST router with middleware and all routes
+func (a *App) Router() *gin.Engine {
+	cfg := a.Config
+
+	// Upload and form routes get their own body policy, keyed by full path as gin reports it
+	uploads := make(map[string]int64)
+	forms := make(map[string]bool)
+	for _, version := range a.Handler.Versions() {
+		for _, route := range version.Routes {
+			paths := []string{version.Prefix + route.Path}
+			if version.Prefix == api.LegacyVersion {
+				paths = append(paths, route.Path)
+			}
+			for _, path := range paths {
+				if route.Upload > 0 {
+					uploads[path] = route.Upload
+				}
+				if route.Form {
+					forms[path] = true
+				}
+			}
+		}
+	}
+
+	r := gin.New()
+	// X-Forwarded-For is only believed from TRUSTED_PROXIES, so clients
+	// can't choose the IP that rate limits and lockouts are keyed on.
+	// Validate has already rejected malformed entries.
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		logger.Log.WithError(err).Error("Invalid TRUSTED_PROXIES, trusting no proxy")
+		_ = r.SetTrustedProxies(nil)
+	}
+	r.Use(a.middleware(uploads, forms).Gin()...)
+
+	// Health check and metrics routes
+	r.GET("/healthz", metrics.HealthCheckHandler(a.Repo.Ping))
+	r.GET("/livez", metrics.LivenessHandler)
+	r.GET("/version", metrics.VersionHandler)
+	r.GET("/readyz", metrics.ReadinessHandler(a.Health))
+	// API routes, with auth, rate limit and timeout policies taken from the route table
+	registrar := a.Handler.NewRegistrar(a.rateLimiter())
+	if cfg.Server.MetricsAddr == "" {
+		metrics.SetupMetricsRoutes(r)
+		registrar.Register(r, a.Handler.ObservabilityRoutes())
+	}
+	if cfg.Metrics.Pprof {
+		registrar.Register(r, a.Handler.PprofRoutes())
+	}
+	registrar.Register(r, a.Handler.GraphQLRoutes())
+	registrar.Register(r, a.Handler.AdminUIRoutes())
+	for _, version := range a.Handler.Versions() {
+		registrar.RegisterVersion(r, version)
+
+		// Unversioned paths remain as deprecated aliases of the legacy version
+		if version.Prefix == api.LegacyVersion {
+			legacy := r.Group("/", api.DeprecationMiddleware(a.Config.API.LegacySunset, version.Prefix))
+			registrar.Register(legacy, version.Routes)
+		}
+	}
+
+	// The frontend gets whatever the API doesn't route; API misses stay JSON
+	if a.Static != nil {
+		r.NoRoute(func(c *gin.Context) {
+			if !a.Static.Serve(c.Writer, c.Request) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			}
+		})
+	}
+
+	return r
+}
+
+// MetricsRouter serves /metrics and the observability status on their own,
+// for the internal METRICS_ADDR listener
+func (a *App) MetricsRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(api.RecoveryMiddleware(a.Errors))
+	metrics.SetupMetricsRoutes(r)
+	r.GET("/internal/observability", metrics.ObservabilityStatusHandler)
+	return r
+}
+
+// middleware is the chain of cross-cutting layers shared by the REST router
+// and the gRPC server; uploads are the body limits of upload routes
+func (a *App) middleware(uploads map[string]int64, forms map[string]bool) middleware.Chain {
+	// Outages are only detected on Postgres, by the connection monitor
+	var databaseUnavailable func() bool
+	if repo, ok := a.Repo.(*database.PostgresRepository); ok && a.Config.Database.HealthCheckInterval > 0 {
+		databaseUnavailable = repo.Unavailable
+	}
+	return middleware.New(middleware.Options{
+		Config:        a.Config,
+		Errors:        a.Errors,
+		Messages:      a.Messages,
+		Tokens:        a.Tokens,
+		CORS:          a.CORS,
+		SLO:           a.SLO,
+		Limiter:       a.rateLimiter(),
+		Uploads:       uploads,
+		Forms:         forms,
+		TimeRendering: a.Handler.TimeRenderingMiddleware(),
+		GeoIP:         a.GeoIP,
+
+		DatabaseUnavailable: databaseUnavailable,
+	})
+}
+
+// rateLimiter enforces RateLimits on both protocols, sharing client buckets.
+// It is created on first use, so that RateLimits can be changed after New.
+func (a *App) rateLimiter() *router.Limiter {
+	if a.RateLimits != nil && a.limiter == nil {
+		a.limiter = router.NewLimiter(a.RateLimits, a.Storage.Limits)
+	}
+	return a.limiter
+}
+
+// GRPCServer builds the gRPC server with interceptors and all services registered
+func (a *App) GRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(a.middleware(nil, nil).ServerOptions(), opts...)
+	grpcServer := grpc.NewServer(opts...)
+
+	// Register the user service
+	proto.RegisterUserServiceServer(grpcServer, a.GRPC)
+	proto.RegisterAdminServiceServer(grpcServer, grpcserver.NewAdminServer())
+	proto.RegisterOrganizationServiceServer(grpcServer, grpcserver.NewOrganizationServer(a.Orgs))
+
+	// Health checking for load balancers, reporting NOT_SERVING once the app
+	// shuts down, and optionally reflection for grpcurl/grpcui
+	grpcserver.RegisterHealthServer(a.ctx, grpcServer, a.Repo.Ping)
+	if a.Config.API.GRPCReflection {
+		reflection.Register(grpcServer)
+	}
+
+	return grpcServer
+}
+
+// Shutdown ends the app's background work, such as database monitoring
+// and gRPC health checks. It doesn't stop the servers.
+func (a *App) Shutdown() {
+	a.stop()
+}
@@ -0,0 +1,163 @@
+package app
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/114windd/restapi/internal/config"
+	"github.com/114windd/restapi/internal/experiments"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/router"
+)
+
+// configReloadDelay lets a burst of writes to the config file settle before
+// it is read again
+const configReloadDelay = 100 * time.Millisecond
+
+// reloadable are the settings Reload applies without a restart
+type reloadable struct {
+	LogLevel    string
+	LogLevels   string
+	RateLimits  string
+	Experiments string
+	CORSOrigins []string
+}
+
+func reloadableSettings(cfg *config.Config) reloadable {
+	return reloadable{
+		LogLevel:    cfg.Logging.Level,
+		LogLevels:   cfg.Logging.Levels,
+		RateLimits:  cfg.API.RateLimits,
+		Experiments: cfg.Experiments.Definitions,
+		CORSOrigins: cfg.Security.CORSOrigins,
+	}
+}
+
+// restartSettings is cfg without its reloadable settings
+func restartSettings(cfg *config.Config) config.Config {
+	c := *cfg
+	c.Logging.Level, c.Logging.Levels = "", ""
+	c.API.RateLimits = ""
+	c.Experiments.Definitions = ""
+	c.Security.CORSOrigins = nil
+	return c
+}
+
+// Reload applies the log levels, rate limits, experiments and CORS origins
+// of cfg while serving, logging an audit entry for each setting that
+// changed. An invalid cfg is rejected as a whole. Other settings are read
+// once at startup, so changes to them are only reported, as are changes to
+// the rate limits when rate limiting is disabled.
+func (a *App) Reload(cfg *config.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	levels, err := logger.ConfiguredLevels(cfg.Logging)
+	if err != nil {
+		return err
+	}
+	limits, err := router.ParseRateLimits(cfg.API.RateLimits, router.DefaultRateLimits)
+	if err != nil {
+		return err
+	}
+	defs, err := experiments.Parse(cfg.Experiments.Definitions)
+	if err != nil {
+		return err
+	}
+
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	prev, next := a.reloaded, reloadableSettings(cfg)
+	apply := func(setting string, from, to interface{}, set func()) {
+		if reflect.DeepEqual(from, to) {
+			return
+		}
+		// Logged before applying, so that raising the log level doesn't hide it
+		logger.LogConfigChange(setting, from, to).Info("Configuration changed")
+		set()
+	}
+	setLevels := func() { logger.SetLevels(levels) }
+	apply("LOG_LEVEL", prev.LogLevel, next.LogLevel, setLevels)
+	apply("LOG_LEVELS", prev.LogLevels, next.LogLevels, setLevels)
+	if a.RateLimits != nil {
+		apply("RATE_LIMITS", prev.RateLimits, next.RateLimits, func() {
+			// Before the routers are built there is no limiter yet, and
+			// rateLimiter creates it with these limits
+			a.RateLimits = limits
+			if a.limiter != nil {
+				a.limiter.SetLimits(limits)
+			}
+		})
+	} else if prev.RateLimits != next.RateLimits {
+		logger.Log.Warn("Rate limiting is disabled, so RATE_LIMITS changes take effect after a restart")
+	}
+	apply("EXPERIMENTS", prev.Experiments, next.Experiments, func() { a.Experiments.SetExperiments(defs) })
+	apply("CORS_ALLOWED_ORIGINS", prev.CORSOrigins, next.CORSOrigins, func() { a.CORS.SetOrigins(next.CORSOrigins) })
+	a.reloaded = next
+
+	if !reflect.DeepEqual(restartSettings(a.Config), restartSettings(cfg)) {
+		logger.Log.Warn("Configuration changes other than log levels, rate limits, experiments and CORS origins take effect after a restart")
+	}
+	return nil
+}
+
+// WatchConfig reloads CONFIG_FILE whenever it changes, until ctx is done.
+// The file's directory is watched, so that files replaced by a rename, as
+// editors and Kubernetes ConfigMap updates do, are followed. Without a
+// config file it returns at once.
+func (a *App) WatchConfig(ctx context.Context) error {
+	path := a.Config.File
+	if path == "" {
+		return nil
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	name := filepath.Clean(path)
+	var pending <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			// ConfigMap volumes swap the ..data symlink instead of writing the file
+			if event.Op != fsnotify.Chmod && (filepath.Clean(event.Name) == name || filepath.Base(event.Name) == "..data") {
+				pending = time.After(configReloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Log.WithError(err).Warn("Config file watch error")
+		case <-pending:
+			pending = nil
+			a.reloadFile(path)
+		}
+	}
+}
+
+// reloadFile reads the config file and applies it, keeping the current
+// settings when it can't be read or is invalid
+func (a *App) reloadFile(path string) {
+	cfg, err := config.LoadFile(path)
+	if err == nil {
+		err = a.Reload(cfg)
+	}
+	if err != nil {
+		logger.Log.WithError(err).WithField("file", path).Error("Config file not reloaded, keeping the current settings")
+	}
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/114windd/restapi/internal/auth"
+	"github.com/114windd/restapi/internal/config"
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/selfcheck"
+	"github.com/114windd/restapi/internal/tlsconfig"
+)
+
+// StartupChecks are run before the server starts and by `server check`:
+// configuration, JWT signing key, TLS material, database connectivity and
+// migration status. Pending migrations are only a warning, since startup
+// applies them, and so is a database that doesn't answer when startup
+// waits for it. The returned function closes the check's database
+// connection.
+func StartupChecks(cfg *config.Config) ([]selfcheck.Check, func()) {
+	var repo *database.PostgresRepository
+	checks := []selfcheck.Check{
+		{Name: "config", Run: func(ctx context.Context) error {
+			return cfg.Validate()
+		}},
+		{Name: "jwt", Run: func(ctx context.Context) error {
+			return newTokens(cfg.Auth).Check()
+		}},
+		{Name: "tls", Run: func(ctx context.Context) error {
+			_, err := tlsconfig.New(cfg.TLS)
+			return err
+		}},
+		{Name: "database", Run: func(ctx context.Context) error {
+			opened, err := database.OpenLazy(cfg.Database.URL)
+			if err != nil {
+				return err
+			}
+			if err := opened.Ping(ctx); err != nil {
+				_ = opened.Close()
+				return databaseUnavailable(cfg.Database, err)
+			}
+			repo = opened
+			return nil
+		}},
+		{Name: "migrations", Run: func(ctx context.Context) error {
+			if repo == nil {
+				return fmt.Errorf("%w: database unavailable", selfcheck.ErrSkipped)
+			}
+			return selfcheck.Warning(repo.CheckMigrations(ctx))
+		}},
+	}
+	closeDB := func() {
+		if repo != nil {
+			_ = repo.Close()
+		}
+	}
+	return checks, closeDB
+}
+
+// databaseUnavailable is the self-check outcome of a database that doesn't
+// answer: only a warning when startup would wait for it
+func databaseUnavailable(cfg config.DatabaseConfig, err error) error {
+	switch {
+	case cfg.LazyConnect:
+		return selfcheck.Warning(fmt.Errorf("%w; connecting in the background", err))
+	case cfg.ConnectTimeout > 0:
+		return selfcheck.Warning(fmt.Errorf("%w; startup retries for %s", err, cfg.ConnectTimeout))
+	}
+	return err
+}
+
+// newTokens creates the token signer and validator described by cfg
+func newTokens(cfg config.AuthConfig) *auth.Tokens {
+	tokens := auth.NewTokens([]byte(cfg.JWTSecret))
+	tokens.SetIssuer(cfg.JWTIssuer)
+	tokens.SetAudience(cfg.JWTAudience)
+	return tokens
+}
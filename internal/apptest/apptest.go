@@ -0,0 +1,252 @@
+// Package apptest runs the full application against an in-memory repository
+// so REST and gRPC integration tests don't need Postgres. The end-to-end
+// tests in internal/e2e run it against Postgres instead.
+package apptest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/114windd/restapi/internal/app"
+	"github.com/114windd/restapi/internal/auth"
+	"github.com/114windd/restapi/internal/config"
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/pkg/client"
+	"github.com/114windd/restapi/pkg/models"
+	"github.com/114windd/restapi/pkg/proto"
+)
+
+// TestServer is a running application with REST served over httptest and
+// gRPC over an in-process listener
+type TestServer struct {
+	App  *app.App
+	Repo *database.MemoryRepository // nil when started on another repository
+
+	HTTP *httptest.Server
+	GRPC proto.UserServiceClient
+
+	grpcListener *bufconn.Listener
+}
+
+// Option adjusts the configuration before the application is wired
+type Option func(cfg *config.Config)
+
+// NewTestServer starts a TestServer, stopped when the test finishes.
+// External dependencies (CAPTCHA, Redis, TLS) are disabled, state is kept in
+// memory, and rate limiting is off so tests can make many requests from the
+// same address. Options may turn sessions back on with the memory store.
+func NewTestServer(t testing.TB, opts ...Option) *TestServer {
+	t.Helper()
+
+	repo := database.NewMemoryRepository()
+	ts := NewTestServerWithRepository(t, repo, opts...)
+	ts.Repo = repo
+	return ts
+}
+
+// NewTestServerWithRepository is like NewTestServer but keeps users in repo,
+// e.g. a migrated Postgres database
+func NewTestServerWithRepository(t testing.TB, repo database.UserRepository, opts ...Option) *TestServer {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	if logger.Log == nil {
+		logger.Init()
+		logger.Log.SetOutput(io.Discard)
+	}
+
+	cfg := config.Load()
+	cfg.Captcha.Provider = ""
+	cfg.Storage = config.StorageConfig{Backend: config.StorageBackendMemory}
+	cfg.Objects.Backend = config.ObjectStorageLocal
+	cfg.Objects.LocalDir = t.TempDir()
+	cfg.Session.Enabled = false
+	cfg.Database.SessionSettings = false
+	cfg.Database.TenancyMode = config.TenancyModeNone
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	application, err := app.NewWithRepository(cfg, repo)
+	if err != nil {
+		t.Fatalf("wire application: %v", err)
+	}
+	application.RateLimits = nil
+	t.Cleanup(application.Shutdown)
+
+	ts := &TestServer{App: application, grpcListener: bufconn.Listen(1 << 20)}
+
+	ts.HTTP = httptest.NewServer(application.Router())
+	t.Cleanup(ts.HTTP.Close)
+
+	grpcServer := application.GRPCServer()
+	go func() { _ = grpcServer.Serve(ts.grpcListener) }()
+	t.Cleanup(grpcServer.Stop)
+
+	ts.GRPC = ts.GRPCClient(t)
+
+	return ts
+}
+
+// GRPCClient returns a pkg/client client connected to the server's gRPC API,
+// closed when the test finishes
+func (ts *TestServer) GRPCClient(t testing.TB, opts ...client.Option) *client.Client {
+	t.Helper()
+	opts = append([]client.Option{client.WithDialOptions(
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ts.grpcListener.DialContext(ctx)
+		}),
+	)}, opts...)
+	c, err := client.New("passthrough:///bufnet", opts...)
+	if err != nil {
+		t.Fatalf("dial gRPC: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+// Do sends a JSON request to the REST API, authenticated with token when not
+// empty, and decodes the response body into out when not nil. It returns the
+// response status code.
+func (ts *TestServer) Do(t testing.TB, method, path, token string, body, out any) int {
+	t.Helper()
+	return ts.DoWithHeaders(t, method, path, token, nil, body, out)
+}
+
+// DoWithHeaders is like Do but also sets the given request headers
+func (ts *TestServer) DoWithHeaders(t testing.TB, method, path, token string, header http.Header, body, out any) int {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("encode request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, ts.HTTP.URL+path, reader)
+	if err != nil {
+		t.Fatalf("build request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	resp, err := ts.HTTP.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("decode %s %s response: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// Upload POSTs data as the file field of a multipart form and decodes the
+// JSON response into out when not nil. It returns the response status code.
+func (ts *TestServer) Upload(t testing.TB, path, token, field, filename string, data []byte, out any) int {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatalf("build form: %v", err)
+	}
+	part.Write(data)
+	form.Close()
+
+	req, err := http.NewRequest(http.MethodPost, ts.HTTP.URL+path, &body)
+	if err != nil {
+		t.Fatalf("build request: %v", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := ts.HTTP.Client().Do(req)
+	if err != nil {
+		t.Fatalf("POST %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("decode POST %s response: %v", path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// Signup creates a user through the REST API and returns it with its token
+func (ts *TestServer) Signup(t testing.TB, name, email, password string) (*models.User, string) {
+	t.Helper()
+
+	var resp struct {
+		User  models.User `json:"user"`
+		Token string      `json:"token"`
+	}
+	req := models.SignupRequest{Name: name, Email: email, Password: password}
+	if code := ts.Do(t, http.MethodPost, "/signup", "", req, &resp); code != http.StatusCreated {
+		t.Fatalf("signup %s: status %d", email, code)
+	}
+	return &resp.User, resp.Token
+}
+
+// Token issues an access token for identity
+func (ts *TestServer) Token(t testing.TB, identity auth.Identity) string {
+	t.Helper()
+
+	token, err := ts.App.Tokens.GenerateToken(identity)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	return token
+}
+
+// AdminToken issues an admin access token
+func (ts *TestServer) AdminToken(t testing.TB) string {
+	return ts.Token(t, auth.Identity{UserID: 1 << 30, Role: models.RoleAdmin, TenantID: models.DefaultTenant})
+}
+
+// AdminAccount signs up a user and issues an admin token for it, for flows
+// such as impersonation that check the admin's own account
+func (ts *TestServer) AdminAccount(t testing.TB, name, email string) (*models.User, string) {
+	t.Helper()
+
+	user, _ := ts.Signup(t, name, email, "password123")
+	return user, ts.Token(t, auth.Identity{UserID: user.ID, Role: models.RoleAdmin, TenantID: user.TenantID})
+}
+
+// WithToken returns a gRPC context authenticated with token
+func WithToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
@@ -0,0 +1,55 @@
+package apptest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/114windd/restapi/pkg/models"
+	"github.com/114windd/restapi/pkg/proto"
+)
+
+// The handler path benchmarks include the whole middleware chain and the
+// transport, over loopback HTTP and an in-process gRPC listener
+
+func BenchmarkRESTGetUser(b *testing.B) {
+	ts := NewTestServer(b)
+	user, token := ts.Signup(b, "Alice", "alice@example.com", "password123")
+	path := fmt.Sprintf("/users/%d", user.ID)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if code := ts.Do(b, http.MethodGet, path, token, nil, nil); code != http.StatusOK {
+			b.Fatalf("GET %s: status %d", path, code)
+		}
+	}
+}
+
+func BenchmarkRESTListUsers(b *testing.B) {
+	ts := NewTestServer(b)
+	_, token := ts.Signup(b, "Alice", "alice@example.com", "password123")
+	for i := 0; i < 100; i++ {
+		user := &models.User{Name: fmt.Sprintf("User %d", i), Email: fmt.Sprintf("user%d@example.com", i), Password: "x"}
+		if err := ts.Repo.CreateUser(context.Background(), user); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if code := ts.Do(b, http.MethodGet, "/users", token, nil, nil); code != http.StatusOK {
+			b.Fatalf("GET /users: status %d", code)
+		}
+	}
+}
+
+func BenchmarkGRPCGetUser(b *testing.B) {
+	ts := NewTestServer(b)
+	user, token := ts.Signup(b, "Alice", "alice@example.com", "password123")
+	ctx := WithToken(context.Background(), token)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ts.GRPC.GetUser(ctx, &proto.GetUserRequest{Id: uint32(user.ID)}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
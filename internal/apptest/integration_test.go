@@ -0,0 +1,3843 @@
+package apptest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp/totp"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+
+	"github.com/114windd/restapi/internal/api"
+	"github.com/114windd/restapi/internal/auth"
+	"github.com/114windd/restapi/internal/cache"
+	"github.com/114windd/restapi/internal/config"
+	"github.com/114windd/restapi/internal/consent"
+	"github.com/114windd/restapi/internal/cron"
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/errorreporting"
+	"github.com/114windd/restapi/internal/events"
+	"github.com/114windd/restapi/internal/geoip"
+	grpcserver "github.com/114windd/restapi/internal/grpc"
+	"github.com/114windd/restapi/internal/listen"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/mail"
+	"github.com/114windd/restapi/internal/metrics"
+	"github.com/114windd/restapi/internal/oauth"
+	"github.com/114windd/restapi/internal/phone"
+	"github.com/114windd/restapi/internal/preferences"
+	"github.com/114windd/restapi/internal/privacy"
+	"github.com/114windd/restapi/internal/requestid"
+	"github.com/114windd/restapi/internal/router"
+	"github.com/114windd/restapi/internal/security"
+	"github.com/114windd/restapi/internal/service"
+	"github.com/114windd/restapi/internal/sms"
+	"github.com/114windd/restapi/internal/validation"
+	"github.com/114windd/restapi/internal/version"
+	"github.com/114windd/restapi/pkg/client"
+	"github.com/114windd/restapi/pkg/models"
+	"github.com/114windd/restapi/pkg/proto"
+)
+
+type userResponse struct {
+	User  models.User `json:"user"`
+	Error string      `json:"error"`
+}
+
+func TestRESTSignupAndLogin(t *testing.T) {
+	ts := NewTestServer(t)
+
+	user, token := ts.Signup(t, "Alice", "alice@example.com", "password123")
+	if user.ID == 0 || token == "" {
+		t.Fatalf("expected a user ID and token, got %d and %q", user.ID, token)
+	}
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	code := ts.Do(t, http.MethodPost, "/login", "", models.LoginRequest{Email: "alice@example.com", Password: "password123"}, &login)
+	if code != http.StatusOK || login.Token == "" {
+		t.Fatalf("login: status %d, token %q", code, login.Token)
+	}
+
+	code = ts.Do(t, http.MethodPost, "/login", "", models.LoginRequest{Email: "alice@example.com", Password: "wrong"}, nil)
+	if code != http.StatusUnauthorized {
+		t.Fatalf("login with wrong password: expected 401, got %d", code)
+	}
+
+	var me userResponse
+	if code := ts.Do(t, http.MethodGet, "/me", login.Token, nil, &me); code != http.StatusOK || me.User.Email != "alice@example.com" {
+		t.Fatalf("GET /me: status %d, user %+v", code, me.User)
+	}
+}
+
+func TestRESTDuplicateSignup(t *testing.T) {
+	ts := NewTestServer(t)
+	ts.Signup(t, "Alice", "alice@example.com", "password123")
+
+	req := models.SignupRequest{Name: "Alice again", Email: "alice@example.com", Password: "password123"}
+	if code := ts.Do(t, http.MethodPost, "/signup", "", req, nil); code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", code)
+	}
+}
+
+func TestEmailNormalization(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.Signup.StripPlusTags = true })
+
+	user, _ := ts.Signup(t, "Nina", "Nina+Work@Example.COM", "password123")
+	if user.Email != "nina@example.com" {
+		t.Fatalf("expected the stored email to be normalized, got %q", user.Email)
+	}
+
+	code := ts.Do(t, http.MethodPost, "/login", "", models.LoginRequest{Email: "NINA@example.com", Password: "password123"}, nil)
+	if code != http.StatusOK {
+		t.Fatalf("login with a differently cased email: status %d", code)
+	}
+
+	req := models.SignupRequest{Name: "Nina again", Email: "nina+other@example.com", Password: "password123"}
+	if code := ts.Do(t, http.MethodPost, "/signup", "", req, nil); code != http.StatusConflict {
+		t.Fatalf("signup with an equivalent email: expected 409, got %d", code)
+	}
+
+	other, token := ts.Signup(t, "Omar", "omar@example.com", "password123")
+	patch := map[string]string{"email": "NINA@example.com"}
+	if code := ts.DoWithHeaders(t, http.MethodPatch, fmt.Sprintf("/users/%d", other.ID), token, ifMatch(other.Version), patch, nil); code != http.StatusConflict {
+		t.Fatalf("changing email to a taken one: expected 409, got %d", code)
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	ts := NewTestServer(t)
+
+	var body struct {
+		Code   string                  `json:"code"`
+		Fields []validation.FieldError `json:"fields"`
+	}
+	req := models.SignupRequest{Name: "Mallory", Email: "not-an-email", Password: "short"}
+	if code := ts.Do(t, http.MethodPost, "/signup", "", req, &body); code != http.StatusBadRequest || body.Code != "validation_failed" {
+		t.Fatalf("expected 400 validation_failed, got %d %+v", code, body)
+	}
+	rules := map[string]string{}
+	for _, f := range body.Fields {
+		rules[f.Field] = f.Rule
+	}
+	if rules["email"] != "email" || rules["password"] != "min" || len(rules) != 2 {
+		t.Fatalf("unexpected field errors: %+v", body.Fields)
+	}
+
+	// Route IDs are bound and validated the same way
+	alice, token := ts.Signup(t, "Alice", "alice@example.com", "password123")
+	for path, rule := range map[string]string{"/users/abc": "type", "/users/0": "required"} {
+		var idBody struct {
+			Error  string                  `json:"error"`
+			Code   string                  `json:"code"`
+			Fields []validation.FieldError `json:"fields"`
+		}
+		code := ts.Do(t, http.MethodGet, path, token, nil, &idBody)
+		if code != http.StatusBadRequest || idBody.Error != "Invalid user ID" || idBody.Code != "invalid_id" || len(idBody.Fields) != 1 || idBody.Fields[0].Field != "id" || idBody.Fields[0].Rule != rule {
+			t.Fatalf("GET %s: expected 400 invalid_id on id/%s, got %d %+v", path, rule, code, idBody)
+		}
+	}
+
+	// PUT accepts a partial body but still rejects a malformed email, like PATCH
+	update := models.RestUpdateUserRequest{Email: "not-an-email"}
+	put := func(path string, headers http.Header) {
+		t.Helper()
+		body.Code, body.Fields = "", nil
+		if code := ts.DoWithHeaders(t, http.MethodPut, path, token, headers, update, &body); code != http.StatusBadRequest || body.Code != "validation_failed" || len(body.Fields) != 1 || body.Fields[0].Field != "email" {
+			t.Fatalf("PUT %s with a malformed email: expected 400 validation_failed, got %d %+v", path, code, body)
+		}
+	}
+	put(fmt.Sprintf("/users/%d", alice.ID), ifMatch(alice.Version))
+	put("/me", nil)
+	if _, err := ts.GRPC.UpdateUser(WithToken(context.Background(), token), &proto.UpdateUserRequest{Id: uint32(alice.ID), Email: "not-an-email"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("gRPC UpdateUser with a malformed email: expected InvalidArgument, got %v", err)
+	}
+
+	_, err := ts.GRPC.CreateUser(context.Background(), &proto.CreateUserRequest{Name: "Mallory", Email: "not-an-email", Password: "password123"})
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument || len(st.Details()) != 1 {
+		t.Fatalf("expected InvalidArgument with details, got %v", err)
+	}
+	detail, ok := st.Details()[0].(*errdetails.BadRequest)
+	if !ok || len(detail.FieldViolations) != 1 || detail.FieldViolations[0].Field != "email" {
+		t.Fatalf("unexpected details: %+v", st.Details())
+	}
+}
+
+func TestRequestBodyLimits(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Security.MaxBodyBytes = 4 << 10
+		cfg.Security.MaxJSONDepth = 8
+	})
+
+	post := func(body io.Reader, length int64) (int, string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, ts.HTTP.URL+"/signup", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.ContentLength = length
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := ts.HTTP.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var out struct {
+			Code string `json:"code"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out.Code
+	}
+
+	big := `{"name":"` + strings.Repeat("a", 8<<10) + `"}`
+	if code, errCode := post(strings.NewReader(big), int64(len(big))); code != http.StatusRequestEntityTooLarge || errCode != "body_too_large" {
+		t.Fatalf("oversized body: expected 413 body_too_large, got %d %q", code, errCode)
+	}
+	// Without a Content-Length the limit applies while reading
+	if code, errCode := post(io.MultiReader(strings.NewReader(big)), -1); code != http.StatusRequestEntityTooLarge || errCode != "body_too_large" {
+		t.Fatalf("oversized chunked body: expected 413 body_too_large, got %d %q", code, errCode)
+	}
+
+	deep := `{"name":"Alice","attributes":{"a":` + strings.Repeat("[", 10) + strings.Repeat("]", 10) + `}}`
+	if code, errCode := post(strings.NewReader(deep), -1); code != http.StatusBadRequest || errCode != "json_too_deep" {
+		t.Fatalf("deeply nested body: expected 400 json_too_deep, got %d %q", code, errCode)
+	}
+
+	// A duplicate key could otherwise slip a second value past whatever read the first
+	duplicate := `{"name":"Alice","email":"alice@example.com","password":"password123","email":"admin@example.com"}`
+	if code, errCode := post(strings.NewReader(duplicate), -1); code != http.StatusBadRequest || errCode != "duplicate_json_key" {
+		t.Fatalf("duplicate key: expected 400 duplicate_json_key, got %d %q", code, errCode)
+	}
+
+	ok := `{"name":"Alice","email":"alice@example.com","password":"password123"}`
+	if code, _ := post(strings.NewReader(ok), -1); code != http.StatusCreated {
+		t.Fatalf("valid body: expected 201, got %d", code)
+	}
+}
+
+func TestRESTRequiresAuthentication(t *testing.T) {
+	ts := NewTestServer(t)
+
+	if code := ts.Do(t, http.MethodGet, "/users", "", nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodGet, "/users", "not-a-token", nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with an invalid token, got %d", code)
+	}
+}
+
+func TestRESTUserCRUD(t *testing.T) {
+	ts := NewTestServer(t)
+	alice, aliceToken := ts.Signup(t, "Alice", "alice@example.com", "password123")
+	bob, bobToken := ts.Signup(t, "Bob", "bob@example.com", "password123")
+	alicePath := fmt.Sprintf("/users/%d", alice.ID)
+
+	var got userResponse
+	if code := ts.Do(t, http.MethodGet, alicePath, bobToken, nil, &got); code != http.StatusOK || got.User.Name != "Alice" {
+		t.Fatalf("GET %s: status %d, user %+v", alicePath, code, got.User)
+	}
+
+	var list struct {
+		Users []models.User `json:"users"`
+	}
+	if code := ts.Do(t, http.MethodGet, "/users", aliceToken, nil, &list); code != http.StatusOK || len(list.Users) != 2 {
+		t.Fatalf("GET /users: status %d, %d users", code, len(list.Users))
+	}
+
+	name := "Alice Liddell"
+	if code := ts.DoWithHeaders(t, http.MethodPatch, alicePath, aliceToken, ifMatch(got.User.Version), models.PatchUserRequest{Name: &name}, &got); code != http.StatusOK || got.User.Name != name {
+		t.Fatalf("PATCH %s: status %d, user %+v", alicePath, code, got.User)
+	}
+
+	update := models.RestUpdateUserRequest{Email: "alice@example.org"}
+	if code := ts.DoWithHeaders(t, http.MethodPut, alicePath, aliceToken, ifMatch(got.User.Version), update, &got); code != http.StatusOK || got.User.Email != update.Email {
+		t.Fatalf("PUT %s: status %d, user %+v", alicePath, code, got.User)
+	}
+
+	// Users may only modify their own record
+	if code := ts.Do(t, http.MethodDelete, alicePath, bobToken, nil, nil); code != http.StatusForbidden {
+		t.Fatalf("DELETE %s as another user: expected 403, got %d", alicePath, code)
+	}
+
+	if code := ts.Do(t, http.MethodDelete, alicePath, aliceToken, nil, nil); code != http.StatusOK {
+		t.Fatalf("DELETE %s: expected 200, got %d", alicePath, code)
+	}
+	if code := ts.Do(t, http.MethodGet, alicePath, bobToken, nil, nil); code != http.StatusNotFound {
+		t.Fatalf("GET deleted user: expected 404, got %d", code)
+	}
+
+	// Admins may modify any record
+	bobPath := fmt.Sprintf("/users/%d", bob.ID)
+	if code := ts.Do(t, http.MethodDelete, bobPath, ts.AdminToken(t), nil, nil); code != http.StatusOK {
+		t.Fatalf("DELETE %s as admin: expected 200, got %d", bobPath, code)
+	}
+}
+
+func TestRESTOptimisticConcurrency(t *testing.T) {
+	ts := NewTestServer(t)
+	user, token := ts.Signup(t, "Erin", "erin@example.com", "password123")
+	path := fmt.Sprintf("/users/%d", user.ID)
+	name := "Erin Example"
+	patch := models.PatchUserRequest{Name: &name}
+
+	if code := ts.Do(t, http.MethodPatch, path, token, patch, nil); code != http.StatusPreconditionRequired {
+		t.Fatalf("PATCH without If-Match: expected 428, got %d", code)
+	}
+
+	var got userResponse
+	if code := ts.DoWithHeaders(t, http.MethodPatch, path, token, ifMatch(user.Version), patch, &got); code != http.StatusOK || got.User.Version != user.Version+1 {
+		t.Fatalf("PATCH: status %d, user %+v", code, got.User)
+	}
+
+	// A second editor still holding the old version must not clobber the change
+	if code := ts.DoWithHeaders(t, http.MethodPatch, path, token, ifMatch(user.Version), patch, nil); code != http.StatusPreconditionFailed {
+		t.Fatalf("PATCH with a stale If-Match: expected 412, got %d", code)
+	}
+
+	_, err := ts.GRPC.UpdateUser(WithToken(context.Background(), token), &proto.UpdateUserRequest{Id: uint32(user.ID), Name: "Erin", Version: uint32(user.Version)})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("gRPC UpdateUser with a stale version: expected FailedPrecondition, got %v", err)
+	}
+
+	// Unknown users are not found, whichever method updates them
+	admin := ts.AdminToken(t)
+	unknown := fmt.Sprintf("/users/%d", user.ID+100)
+	if code := ts.DoWithHeaders(t, http.MethodPut, unknown, admin, ifMatch(1), models.RestUpdateUserRequest{Name: "Nobody"}, nil); code != http.StatusNotFound {
+		t.Fatalf("PUT %s: expected 404, got %d", unknown, code)
+	}
+	if code := ts.DoWithHeaders(t, http.MethodPatch, unknown, admin, ifMatch(1), patch, nil); code != http.StatusNotFound {
+		t.Fatalf("PATCH %s: expected 404, got %d", unknown, code)
+	}
+}
+
+func ifMatch(version uint) http.Header {
+	return http.Header{"If-Match": {fmt.Sprintf("%q", fmt.Sprint(version))}}
+}
+
+func TestGRPCUserFlow(t *testing.T) {
+	ts := NewTestServer(t)
+	ctx := context.Background()
+
+	created, err := ts.GRPC.CreateUser(ctx, &proto.CreateUserRequest{Name: "Carol", Email: "carol@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	id := created.User.Id
+	token := ts.Token(t, auth.Identity{UserID: uint(id), Role: models.RoleUser, TenantID: models.DefaultTenant})
+
+	if _, err := ts.GRPC.GetUser(ctx, &proto.GetUserRequest{Id: id}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("GetUser without a token: expected Unauthenticated, got %v", err)
+	}
+	if _, err := ts.GRPC.ListUsers(ctx, &proto.ListUsersRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("ListUsers without a token: expected Unauthenticated, got %v", err)
+	}
+
+	got, err := ts.GRPC.GetUser(WithToken(ctx, token), &proto.GetUserRequest{Id: id})
+	if err != nil || got.User.Email != "carol@example.com" {
+		t.Fatalf("GetUser: %v, %+v", err, got)
+	}
+	if !got.User.CreatedAt.IsValid() || time.Since(got.User.CreatedAt.AsTime()) > time.Minute {
+		t.Fatalf("GetUser: unexpected created_at %v", got.User.CreatedAt)
+	}
+
+	_, err = ts.GRPC.UpdateUser(ctx, &proto.UpdateUserRequest{Id: id, Name: "Caroline"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("UpdateUser without a token: expected Unauthenticated, got %v", err)
+	}
+
+	updated, err := ts.GRPC.UpdateUser(WithToken(ctx, token), &proto.UpdateUserRequest{Id: id, Name: "Caroline"})
+	if err != nil || updated.User.Name != "Caroline" {
+		t.Fatalf("UpdateUser: %v, %+v", err, updated)
+	}
+
+	list, err := ts.GRPC.ListUsers(WithToken(ctx, token), &proto.ListUsersRequest{})
+	if err != nil || len(list.Users) != 1 {
+		t.Fatalf("ListUsers: %v, %+v", err, list)
+	}
+
+	if _, err := ts.GRPC.DeleteUser(WithToken(ctx, token), &proto.DeleteUserRequest{Id: id}); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, err := ts.GRPC.GetUser(WithToken(ctx, ts.AdminToken(t)), &proto.GetUserRequest{Id: id}); status.Code(err) != codes.NotFound {
+		t.Fatalf("GetUser after delete: expected NotFound, got %v", err)
+	}
+}
+
+func TestGRPCUpdateMask(t *testing.T) {
+	ts := NewTestServer(t)
+	ctx := context.Background()
+
+	created, err := ts.GRPC.CreateUser(ctx, &proto.CreateUserRequest{Name: "Kim", Email: "kim@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	id := created.User.Id
+	ctx = WithToken(ctx, ts.Token(t, auth.Identity{UserID: uint(id), Role: models.RoleUser, TenantID: models.DefaultTenant}))
+
+	// Without a mask only the populated fields change
+	updated, err := ts.GRPC.UpdateUser(ctx, &proto.UpdateUserRequest{Id: id, Bio: "Pilot", Phone: "+15551234567"})
+	if err != nil || updated.User.Name != "Kim" || updated.User.Bio != "Pilot" {
+		t.Fatalf("UpdateUser: %v, %+v", err, updated)
+	}
+
+	// A masked field is applied even when empty
+	updated, err = ts.GRPC.UpdateUser(ctx, &proto.UpdateUserRequest{Id: id, Name: "Ignored", UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"bio"}}})
+	if err != nil || updated.User.Bio != "" || updated.User.Name != "Kim" || updated.User.Phone != "+15551234567" {
+		t.Fatalf("UpdateUser with mask: %v, %+v", err, updated)
+	}
+
+	for _, paths := range [][]string{{"password"}, {"name"}} {
+		_, err = ts.GRPC.UpdateUser(ctx, &proto.UpdateUserRequest{Id: id, UpdateMask: &fieldmaskpb.FieldMask{Paths: paths}})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("mask %v: expected InvalidArgument, got %v", paths, err)
+		}
+	}
+}
+
+func TestGRPCListUsersPagination(t *testing.T) {
+	ts := NewTestServer(t)
+	ctx := context.Background()
+
+	for _, name := range []string{"Dave", "Alice", "Erin", "Carol", "Bob"} {
+		if _, err := ts.GRPC.CreateUser(ctx, &proto.CreateUserRequest{Name: name, Email: strings.ToLower(name) + "@example.com", Password: "password123"}); err != nil {
+			t.Fatalf("CreateUser %s: %v", name, err)
+		}
+	}
+
+	ctx = WithToken(ctx, ts.AdminToken(t))
+
+	var names []string
+	req := &proto.ListUsersRequest{PageSize: 2, OrderBy: "name desc", Filter: `email : "example.com" AND name != "Carol"`}
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatalf("pagination did not terminate: %v", names)
+		}
+		list, err := ts.GRPC.ListUsers(ctx, req)
+		if err != nil {
+			t.Fatalf("ListUsers: %v", err)
+		}
+		if list.TotalSize != 4 {
+			t.Fatalf("total_size: expected 4 on every page, got %d", list.TotalSize)
+		}
+		for _, u := range list.Users {
+			names = append(names, u.Name)
+		}
+		if list.NextPageToken == "" {
+			break
+		}
+		req.PageToken = list.NextPageToken
+	}
+	if got := strings.Join(names, ","); got != "Erin,Dave,Bob,Alice" {
+		t.Fatalf("expected Erin,Dave,Bob,Alice, got %s", got)
+	}
+
+	// A token can't be reused with a different ordering
+	first, err := ts.GRPC.ListUsers(ctx, &proto.ListUsersRequest{PageSize: 1})
+	if err != nil || first.NextPageToken == "" {
+		t.Fatalf("ListUsers: %v, %+v", err, first)
+	}
+	_, err = ts.GRPC.ListUsers(ctx, &proto.ListUsersRequest{PageSize: 1, PageToken: first.NextPageToken, OrderBy: "name"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("mismatched page token: expected InvalidArgument, got %v", err)
+	}
+	if _, err := ts.GRPC.ListUsers(ctx, &proto.ListUsersRequest{Filter: "password = x"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("unknown filter field: expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestCustomAttributes(t *testing.T) {
+	ts := NewTestServer(t)
+	admin := ts.AdminToken(t)
+
+	for _, def := range []models.CreateAttributeDefinitionRequest{
+		{Name: "tier", Type: models.AttributeTypeString, Validation: "^(gold|silver)$"},
+		{Name: "seats", Type: models.AttributeTypeNumber},
+	} {
+		if code := ts.Do(t, http.MethodPost, "/admin/attributes", admin, def, nil); code != http.StatusCreated {
+			t.Fatalf("POST /admin/attributes %s: status %d", def.Name, code)
+		}
+	}
+	for name, tc := range map[string]struct {
+		def    models.CreateAttributeDefinitionRequest
+		status int
+	}{
+		"duplicate":           {models.CreateAttributeDefinitionRequest{Name: "tier", Type: models.AttributeTypeString}, http.StatusConflict},
+		"unknown type":        {models.CreateAttributeDefinitionRequest{Name: "since", Type: "date"}, http.StatusBadRequest},
+		"pattern on a number": {models.CreateAttributeDefinitionRequest{Name: "age", Type: models.AttributeTypeNumber, Validation: "^1"}, http.StatusBadRequest},
+		"invalid pattern":     {models.CreateAttributeDefinitionRequest{Name: "code", Type: models.AttributeTypeString, Validation: "("}, http.StatusBadRequest},
+	} {
+		if code := ts.Do(t, http.MethodPost, "/admin/attributes", admin, tc.def, nil); code != tc.status {
+			t.Errorf("POST /admin/attributes with %s: expected %d, got %d", name, tc.status, code)
+		}
+	}
+	_, token := ts.Signup(t, "Gus", "gus@example.com", "password123")
+	if code := ts.Do(t, http.MethodGet, "/admin/attributes", token, nil, nil); code != http.StatusForbidden {
+		t.Fatalf("GET /admin/attributes as a user: expected 403, got %d", code)
+	}
+
+	// Values are checked against the definitions
+	signup := models.SignupRequest{Name: "Hana", Email: "hana@example.com", Password: "password123", Attributes: models.Attributes{"tier": "gold", "seats": 5}}
+	var created userResponse
+	if code := ts.Do(t, http.MethodPost, "/signup", "", signup, &created); code != http.StatusCreated || created.User.Attributes["tier"] != "gold" {
+		t.Fatalf("signup with attributes: status %d, %+v", code, created.User.Attributes)
+	}
+	for _, attrs := range []models.Attributes{{"tier": "bronze"}, {"seats": "five"}, {"plan": "pro"}} {
+		signup := models.SignupRequest{Name: "Ivo", Email: "ivo@example.com", Password: "password123", Attributes: attrs}
+		if code := ts.Do(t, http.MethodPost, "/signup", "", signup, nil); code != http.StatusBadRequest {
+			t.Errorf("signup with attributes %v: expected 400, got %d", attrs, code)
+		}
+	}
+
+	var page struct {
+		Users []models.User `json:"users"`
+	}
+	if code := ts.Do(t, http.MethodGet, "/users?attr.tier=gold", admin, nil, &page); code != http.StatusOK || len(page.Users) != 1 || page.Users[0].ID != created.User.ID {
+		t.Fatalf("GET /users?attr.tier=gold: status %d, %+v", code, page.Users)
+	}
+
+	var defs struct {
+		Attributes []models.AttributeDefinition `json:"attributes"`
+	}
+	ts.Do(t, http.MethodGet, "/admin/attributes", admin, nil, &defs)
+	if len(defs.Attributes) != 2 {
+		t.Fatalf("GET /admin/attributes: %+v", defs.Attributes)
+	}
+	if code := ts.Do(t, http.MethodDelete, fmt.Sprintf("/admin/attributes/%d", defs.Attributes[0].ID), admin, nil, nil); code != http.StatusOK {
+		t.Fatalf("DELETE /admin/attributes/%d: status %d", defs.Attributes[0].ID, code)
+	}
+	ts.Do(t, http.MethodGet, "/admin/attributes", admin, nil, &defs)
+	if len(defs.Attributes) != 1 {
+		t.Fatalf("attributes after deleting one: %+v", defs.Attributes)
+	}
+}
+
+func TestUserSearch(t *testing.T) {
+	ts := NewTestServer(t)
+	ts.Signup(t, "Alice Martin", "alice@example.com", "password123")
+	ts.Signup(t, "Bob Stone", "bob@example.org", "password123")
+	_, token := ts.Signup(t, "Carla Alison", "carla@example.com", "password123")
+
+	var resp struct {
+		Users []models.User `json:"users"`
+	}
+	if code := ts.Do(t, http.MethodGet, "/users/search?q=ALI", token, nil, &resp); code != http.StatusOK || len(resp.Users) != 2 {
+		t.Fatalf("GET /users/search?q=ALI: status %d, %+v", code, resp.Users)
+	}
+	if code := ts.Do(t, http.MethodGet, "/users/search?q=example.org", token, nil, &resp); code != http.StatusOK || len(resp.Users) != 1 || resp.Users[0].Name != "Bob Stone" {
+		t.Fatalf("search by email: status %d, %+v", code, resp.Users)
+	}
+	if code := ts.Do(t, http.MethodGet, "/users/search?q=a&limit=1", token, nil, &resp); code != http.StatusOK || len(resp.Users) != 1 {
+		t.Fatalf("search with a limit: status %d, %d users", code, len(resp.Users))
+	}
+	if code := ts.Do(t, http.MethodGet, "/users/search?q=+", token, nil, nil); code != http.StatusBadRequest {
+		t.Fatalf("blank search: expected 400, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodGet, "/users/search?q=ali", "", nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("search without a token: expected 401, got %d", code)
+	}
+
+	ctx := WithToken(context.Background(), token)
+	found, err := ts.GRPC.SearchUsers(ctx, &proto.SearchUsersRequest{Query: "ali"})
+	if err != nil || len(found.Users) != 2 {
+		t.Fatalf("gRPC SearchUsers: %v, %v", found, err)
+	}
+	if _, err := ts.GRPC.SearchUsers(ctx, &proto.SearchUsersRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("gRPC SearchUsers without a query: expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestUserStats(t *testing.T) {
+	ts := NewTestServer(t)
+	alice, token := ts.Signup(t, "Alice", "alice@example.com", "password123")
+	ts.Signup(t, "Bob", "bob@example.com", "password123")
+	if err := ts.Repo.TouchLastLogin(context.Background(), alice.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	var resp struct {
+		Stats models.UserStats `json:"stats"`
+	}
+	if code := ts.Do(t, http.MethodGet, "/api/v1/users/stats", token, nil, &resp); code != http.StatusOK {
+		t.Fatalf("GET /users/stats: expected 200, got %d", code)
+	}
+	if resp.Stats.TotalUsers != 2 || resp.Stats.NewUsersLast24h != 2 || resp.Stats.ActiveUsersLast24h != 1 {
+		t.Fatalf("unexpected stats %+v", resp.Stats)
+	}
+}
+
+func TestWarmCacheEndpoint(t *testing.T) {
+	ts := NewTestServer(t)
+	_, token := ts.Signup(t, "Ada", "ada@example.com", "password123")
+	admin := ts.AdminToken(t)
+
+	for path, want := range map[string]int{
+		"/admin/cache/warm":           http.StatusOK,
+		"/admin/cache/warm?users=0":   http.StatusOK,
+		"/admin/cache/warm?users=-1":  http.StatusBadRequest,
+		"/admin/cache/warm?users=all": http.StatusBadRequest,
+	} {
+		if code := ts.Do(t, http.MethodPost, path, admin, nil, nil); code != want {
+			t.Errorf("POST %s: expected %d, got %d", path, want, code)
+		}
+	}
+	if code := ts.Do(t, http.MethodPost, "/admin/cache/warm", token, nil, nil); code != http.StatusForbidden {
+		t.Fatalf("POST /admin/cache/warm as a user: expected 403, got %d", code)
+	}
+}
+
+func TestGRPCClientToken(t *testing.T) {
+	ts := NewTestServer(t)
+
+	created, err := ts.GRPC.CreateUser(context.Background(), &proto.CreateUserRequest{Name: "Lee", Email: "lee@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	token := ts.Token(t, auth.Identity{UserID: uint(created.User.Id), Role: models.RoleUser, TenantID: models.DefaultTenant})
+
+	c := ts.GRPCClient(t, client.WithToken(token), client.WithTimeout(time.Second))
+	updated, err := c.UpdateUser(context.Background(), &proto.UpdateUserRequest{Id: created.User.Id, Name: "Leigh"})
+	if err != nil || updated.User.Name != "Leigh" {
+		t.Fatalf("UpdateUser with client token: %v, %+v", err, updated)
+	}
+}
+
+func TestRESTAndGRPCShareState(t *testing.T) {
+	ts := NewTestServer(t)
+	user, token := ts.Signup(t, "Dave", "dave@example.com", "password123")
+
+	got, err := ts.GRPC.GetUser(WithToken(context.Background(), token), &proto.GetUserRequest{Id: uint32(user.ID)})
+	if err != nil || got.User.Email != "dave@example.com" {
+		t.Fatalf("GetUser over gRPC for a REST signup: %v, %+v", err, got)
+	}
+}
+
+func TestIndependentApplications(t *testing.T) {
+	// Each App owns its repository, caches, limits and signing key, so two
+	// of them in one process share nothing
+	first := NewTestServer(t)
+	second := NewTestServer(t, func(cfg *config.Config) { cfg.Auth.JWTSecret = "another-secret-of-at-least-32-bytes" })
+	_, token := first.Signup(t, "Fay", "fay@example.com", "password123")
+
+	if code := first.Do(t, http.MethodGet, "/me", token, nil, nil); code != http.StatusOK {
+		t.Fatalf("GET /me on the first app: expected 200, got %d", code)
+	}
+	if code := second.Do(t, http.MethodGet, "/me", token, nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("GET /me on the second app with the first one's token: expected 401, got %d", code)
+	}
+	login := models.LoginRequest{Email: "fay@example.com", Password: "password123"}
+	if code := second.Do(t, http.MethodPost, "/login", "", login, nil); code != http.StatusUnauthorized {
+		t.Fatalf("login on the second app: expected 401, got %d", code)
+	}
+	second.Signup(t, "Fay", "fay@example.com", "password123")
+
+	var resp struct {
+		Stats models.UserStats `json:"stats"`
+	}
+	if code := first.Do(t, http.MethodGet, "/users/stats", token, nil, &resp); code != http.StatusOK || resp.Stats.TotalUsers != 1 {
+		t.Fatalf("GET /users/stats on the first app: status %d, %+v", code, resp.Stats)
+	}
+}
+
+func TestRESTVersionedAndLegacyPaths(t *testing.T) {
+	ts := NewTestServer(t)
+	_, token := ts.Signup(t, "Erin", "erin@example.com", "password123")
+
+	for path, deprecated := range map[string]bool{"/api/v1/me": false, "/me": true} {
+		req, _ := http.NewRequest(http.MethodGet, ts.HTTP.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := ts.HTTP.Client().Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d", path, resp.StatusCode)
+		}
+		if got := resp.Header.Get("Deprecation") != ""; got != deprecated {
+			t.Fatalf("GET %s: Deprecation header present = %v, want %v", path, got, deprecated)
+		}
+	}
+}
+
+func TestSessionsWithMemoryStore(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.Session.Enabled = true })
+	ts.Signup(t, "Frank", "frank@example.com", "password123")
+
+	var login struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	creds := models.LoginRequest{Email: "frank@example.com", Password: "password123"}
+	if code := ts.Do(t, http.MethodPost, "/login", "", creds, &login); code != http.StatusOK || login.RefreshToken == "" {
+		t.Fatalf("POST /login: status %d, refresh token %q", code, login.RefreshToken)
+	}
+
+	if code := ts.Do(t, http.MethodPost, "/logout", login.Token, nil, nil); code != http.StatusOK {
+		t.Fatalf("POST /logout: expected 200, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodGet, "/me", login.Token, nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("GET /me after logout: expected 401, got %d", code)
+	}
+	refresh := models.RefreshTokenRequest{RefreshToken: login.RefreshToken}
+	if code := ts.Do(t, http.MethodPost, "/token/refresh", "", refresh, nil); code != http.StatusUnauthorized {
+		t.Fatalf("POST /token/refresh after logout: expected 401, got %d", code)
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	// loginFrom logs in through a proxy claiming the client is at 203.0.113.9
+	// and reports whether the server believed it
+	loginFrom := func(ts *TestServer) bool {
+		t.Helper()
+		ts.Signup(t, "Quinn", "quinn@example.com", "password123")
+		var login struct {
+			Token string `json:"token"`
+		}
+		creds := models.LoginRequest{Email: "quinn@example.com", Password: "password123"}
+		header := http.Header{"X-Forwarded-For": {"203.0.113.9"}}
+		if code := ts.DoWithHeaders(t, http.MethodPost, "/login", "", header, creds, &login); code != http.StatusOK {
+			t.Fatalf("POST /login: expected 200, got %d", code)
+		}
+		var list struct {
+			Sessions []struct {
+				IP string `json:"ip"`
+			} `json:"sessions"`
+		}
+		if code := ts.Do(t, http.MethodGet, "/me/sessions", login.Token, nil, &list); code != http.StatusOK {
+			t.Fatalf("GET /me/sessions: expected 200, got %d", code)
+		}
+		for _, s := range list.Sessions {
+			if s.IP == "203.0.113.9" {
+				return true
+			}
+		}
+		return false
+	}
+
+	// By default no proxy is trusted, so clients can't pick their address
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.Session.Enabled = true })
+	if loginFrom(ts) {
+		t.Fatal("X-Forwarded-For was believed without trusted proxies")
+	}
+
+	proxied := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Session.Enabled = true
+		cfg.Server.TrustedProxies = []string{"127.0.0.0/8"}
+	})
+	if !loginFrom(proxied) {
+		t.Fatal("X-Forwarded-For was ignored from a trusted proxy")
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	ts := NewTestServer(t)
+
+	var doc struct {
+		Paths map[string]map[string]struct {
+			Summary   string                 `json:"summary"`
+			Security  []interface{}          `json:"security"`
+			Scopes    []string               `json:"x-scopes"`
+			RateLimit map[string]interface{} `json:"x-rate-limit"`
+			Timeout   string                 `json:"x-timeout"`
+		} `json:"paths"`
+	}
+	if code := ts.Do(t, http.MethodGet, "/api/v1/openapi.json", "", nil, &doc); code != http.StatusOK {
+		t.Fatalf("GET /api/v1/openapi.json: expected 200, got %d", code)
+	}
+
+	// Every route of the table is described with the policies it is served with
+	for _, route := range ts.App.Handler.RoutesV1() {
+		path := "/api/v1" + regexp.MustCompile(`[:*](\w+)`).ReplaceAllString(route.Path, "{$1}")
+		op, ok := doc.Paths[path][strings.ToLower(route.Method)]
+		if !ok {
+			t.Fatalf("%s %s is not documented", route.Method, path)
+		}
+		if op.Summary != route.Summary || op.RateLimit["class"] != route.RateLimit || len(op.Scopes) != len(route.Scopes) || (len(op.Security) == 0) != route.Public() {
+			t.Fatalf("%s %s: documented as %+v", route.Method, path, op)
+		}
+	}
+	login := doc.Paths["/api/v1/login"]["post"]
+	if login.Timeout != "10s" || login.RateLimit["class"] != router.RateLimitAuth {
+		t.Fatalf("POST /login: documented as %+v", login)
+	}
+}
+
+func TestSelfServiceSessions(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.Session.Enabled = true })
+	_, first := ts.Signup(t, "Judy", "judy@example.com", "password123")
+	_, other := ts.Signup(t, "Mallory", "mallory@example.com", "password123")
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	creds := models.LoginRequest{Email: "judy@example.com", Password: "password123"}
+	header := http.Header{"User-Agent": {"Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"}}
+	if code := ts.DoWithHeaders(t, http.MethodPost, "/login", "", header, creds, &login); code != http.StatusOK {
+		t.Fatalf("POST /login: expected 200, got %d", code)
+	}
+
+	var listed struct {
+		Sessions []struct {
+			ID     string `json:"id"`
+			Device string `json:"device"`
+		} `json:"sessions"`
+		Current string `json:"current_session_id"`
+	}
+	if code := ts.Do(t, http.MethodGet, "/me/sessions", first, nil, &listed); code != http.StatusOK || len(listed.Sessions) != 2 {
+		t.Fatalf("GET /me/sessions: status %d, sessions %+v", code, listed.Sessions)
+	}
+	var laptop string
+	for _, s := range listed.Sessions {
+		if s.ID != listed.Current {
+			laptop = s.ID
+			if s.Device != "Firefox on Linux" {
+				t.Errorf("device: got %q", s.Device)
+			}
+		}
+	}
+
+	if code := ts.Do(t, http.MethodDelete, "/me/sessions/"+laptop, other, nil, nil); code != http.StatusNotFound {
+		t.Fatalf("revoking another user's session: expected 404, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodDelete, "/me/sessions/"+laptop, first, nil, nil); code != http.StatusOK {
+		t.Fatalf("DELETE /me/sessions/:id: expected 200, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodGet, "/me", login.Token, nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("GET /me with the revoked session: expected 401, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodGet, "/me", first, nil, nil); code != http.StatusOK {
+		t.Fatalf("GET /me with the remaining session: expected 200, got %d", code)
+	}
+}
+
+// capturedMail records the email sent through it
+type capturedMail struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (c *capturedMail) Send(ctx context.Context, msg mail.Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, msg)
+	return nil
+}
+
+func (c *capturedMail) templates() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var names []string
+	for _, msg := range c.sent {
+		names = append(names, msg.Template)
+	}
+	return names
+}
+
+func TestNewDeviceAlerts(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.Session.Enabled = true })
+	captured := &capturedMail{}
+	ts.App.Users.SetMailer(captured)
+	sub, _, _ := ts.App.EventHub.Subscribe(0)
+	defer sub.Close()
+
+	// Signing up records the first device, which is no news
+	_, token := ts.Signup(t, "Alice", "alice@example.com", "password123")
+	creds := models.LoginRequest{Email: "alice@example.com", Password: "password123"}
+	login := func(userAgent string) {
+		t.Helper()
+		if code := ts.DoWithHeaders(t, http.MethodPost, "/login", "", http.Header{"User-Agent": {userAgent}}, creds, nil); code != http.StatusOK {
+			t.Fatalf("POST /login: expected 200, got %d", code)
+		}
+	}
+	login("Go-http-client/1.1")
+	if got := captured.templates(); len(got) != 1 || got[0] != mail.TemplateWelcome {
+		t.Fatalf("expected only the welcome email, got %v", got)
+	}
+
+	phone := "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1"
+	login(phone)
+	if got := captured.templates(); len(got) != 2 || got[1] != mail.TemplateNewDevice {
+		t.Fatalf("expected a new device alert, got %v", got)
+	}
+	if data := captured.sent[1].Data.(mail.NewDeviceData); data.Device != "Safari on iPhone" || data.IP == "" {
+		t.Errorf("unexpected alert data %+v", data)
+	}
+	var alert *events.Event
+	for alert == nil {
+		select {
+		case record := <-sub.C:
+			if record.Event.Type == events.UserNewDevice {
+				alert = &record.Event
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no user.new_device event")
+		}
+	}
+	if alert.Device == nil || alert.Device.Name != "Safari on iPhone" || alert.Device.Type != "mobile" {
+		t.Errorf("unexpected event device %+v", alert.Device)
+	}
+
+	// Browser updates don't make a device new
+	login(strings.Replace(phone, "17_5", "18_0", 1))
+	if got := captured.templates(); len(got) != 2 {
+		t.Fatalf("expected no alert for a known device, got %v", got)
+	}
+
+	var listed struct {
+		Sessions []struct {
+			Device     string `json:"device"`
+			Browser    string `json:"browser"`
+			OS         string `json:"os"`
+			DeviceType string `json:"device_type"`
+		} `json:"sessions"`
+	}
+	if code := ts.Do(t, http.MethodGet, "/me/sessions", token, nil, &listed); code != http.StatusOK {
+		t.Fatalf("GET /me/sessions: expected 200, got %d", code)
+	}
+	var found bool
+	for _, s := range listed.Sessions {
+		if s.Device == "Safari on iPhone" {
+			found = s.Browser == "Safari" && s.OS == "iPhone" && s.DeviceType == "mobile"
+		}
+	}
+	if !found {
+		t.Errorf("expected the phone session with its device details, got %+v", listed.Sessions)
+	}
+}
+
+func TestEnumerationProtection(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Enumeration = config.EnumerationConfig{UniformSignup: true, Honeypot: true, Jitter: 10 * time.Millisecond}
+	})
+	captured := &capturedMail{}
+	ts.App.Users.SetMailer(captured)
+	hook := logtest.NewLocal(logger.Log)
+	defer hook.Reset()
+
+	// Signing up answers the same whether or not the address is taken
+	signup := func(req models.SignupRequest) (int, map[string]interface{}) {
+		t.Helper()
+		var body map[string]interface{}
+		return ts.Do(t, http.MethodPost, "/signup", "", req, &body), body
+	}
+	alice := models.SignupRequest{Name: "Alice", Email: "alice@example.com", Password: "password123"}
+	newCode, newBody := signup(alice)
+	takenCode, takenBody := signup(models.SignupRequest{Name: "Mallory", Email: "alice@example.com", Password: "guess12345"})
+	if newCode != http.StatusAccepted || takenCode != newCode || fmt.Sprint(newBody) != fmt.Sprint(takenBody) {
+		t.Fatalf("expected identical 202 answers, got %d %v and %d %v", newCode, newBody, takenCode, takenBody)
+	}
+	if _, ok := newBody["token"]; ok {
+		t.Fatal("uniform signup must not return tokens")
+	}
+	if got := captured.templates(); len(got) != 2 || got[0] != mail.TemplateWelcome || got[1] != mail.TemplateAccountExists {
+		t.Fatalf("expected a welcome email and a signup attempt notice, got %v", got)
+	}
+
+	// Email checks need a CAPTCHA, and none is configured
+	if code := ts.Do(t, http.MethodGet, "/signup/check-email?email=alice@example.com", "", nil, nil); code != http.StatusServiceUnavailable {
+		t.Fatalf("GET /signup/check-email: expected 503, got %d", code)
+	}
+
+	// Bots filling in the honeypot are answered alike but get no account
+	if code, body := signup(models.SignupRequest{Name: "Bot", Email: "bot@example.com", Password: "password123", Website: "http://spam.example"}); code != http.StatusAccepted || fmt.Sprint(body) != fmt.Sprint(newBody) {
+		t.Fatalf("honeypot signup: expected the usual 202, got %d %v", code, body)
+	}
+	if _, err := ts.App.Users.GetUserByEmail(context.Background(), "bot@example.com"); err == nil {
+		t.Fatal("honeypot signup created an account")
+	}
+
+	// Unknown accounts and wrong passwords fail alike
+	login := func(email, password string) (int, map[string]interface{}) {
+		t.Helper()
+		var body map[string]interface{}
+		return ts.Do(t, http.MethodPost, "/login", "", models.LoginRequest{Email: email, Password: password}, &body), body
+	}
+	unknownCode, unknownBody := login("nobody@example.com", "password123")
+	wrongCode, wrongBody := login("alice@example.com", "wrong-password")
+	if unknownCode != http.StatusUnauthorized || wrongCode != unknownCode || fmt.Sprint(unknownBody) != fmt.Sprint(wrongBody) {
+		t.Fatalf("expected identical 401 answers, got %d %v and %d %v", unknownCode, unknownBody, wrongCode, wrongBody)
+	}
+	if code, _ := login("alice@example.com", "password123"); code != http.StatusOK {
+		t.Fatalf("login after a uniform signup: expected 200, got %d", code)
+	}
+
+	signals := map[string]bool{}
+	for _, entry := range hook.AllEntries() {
+		if entry.Data["action"] == "enumeration_attempt" {
+			signals[fmt.Sprint(entry.Data["endpoint"], ":", entry.Data["signal"])] = true
+		}
+	}
+	for _, want := range []string{"signup:email_taken", "signup:honeypot", "login:unknown_account"} {
+		if !signals[want] {
+			t.Errorf("no %s enumeration attempt logged, got %v", want, signals)
+		}
+	}
+}
+
+func TestLoginDelay(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) {
+		cfg.BruteForce = config.BruteForceConfig{FreeAttempts: 1, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Window: time.Minute}
+	})
+	ts.Signup(t, "Ken", "ken@example.com", "password123")
+
+	wrong := models.LoginRequest{Email: "ken@example.com", Password: "wrong-password"}
+	for i := 0; i < 2; i++ {
+		if code := ts.Do(t, http.MethodPost, "/login", "", wrong, nil); code != http.StatusUnauthorized {
+			t.Fatalf("failed login %d: expected 401, got %d", i, code)
+		}
+	}
+
+	// Two failures with one free attempt: 100ms doubled once
+	start := time.Now()
+	right := models.LoginRequest{Email: "ken@example.com", Password: "password123"}
+	if code := ts.Do(t, http.MethodPost, "/login", "", right, nil); code != http.StatusOK {
+		t.Fatalf("login: expected 200, got %d", code)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("login after failures answered in %s, expected a delay of at least 200ms", elapsed)
+	}
+}
+
+func TestTimestampRendering(t *testing.T) {
+	ts := NewTestServer(t)
+	user, token := ts.Signup(t, "Grace", "grace@example.com", "password123")
+	path := fmt.Sprintf("/users/%d", user.ID)
+
+	var local struct {
+		User struct {
+			CreatedAt string `json:"created_at"`
+		} `json:"user"`
+	}
+	header := http.Header{"Time-Zone": {"Asia/Tokyo"}}
+	if code := ts.DoWithHeaders(t, http.MethodGet, path, token, header, nil, &local); code != http.StatusOK {
+		t.Fatalf("GET %s with Time-Zone: status %d", path, code)
+	}
+	if !strings.HasSuffix(local.User.CreatedAt, "+09:00") {
+		t.Fatalf("created_at not rendered in Asia/Tokyo: %q", local.User.CreatedAt)
+	}
+
+	var unix struct {
+		User struct {
+			CreatedAt int64 `json:"created_at"`
+		} `json:"user"`
+	}
+	header = http.Header{"Time-Format": {"unix"}}
+	if code := ts.DoWithHeaders(t, http.MethodGet, path, token, header, nil, &unix); code != http.StatusOK || unix.User.CreatedAt != user.CreatedAt.Unix() {
+		t.Fatalf("GET %s with Time-Format unix: status %d, created_at %d, want %d", path, code, unix.User.CreatedAt, user.CreatedAt.Unix())
+	}
+
+	header = http.Header{"Time-Zone": {"Mars/Olympus_Mons"}}
+	if code := ts.DoWithHeaders(t, http.MethodGet, path, token, header, nil, nil); code != http.StatusBadRequest {
+		t.Fatalf("GET %s with an unknown zone: expected 400, got %d", path, code)
+	}
+}
+
+func TestSLOReport(t *testing.T) {
+	ts := NewTestServer(t)
+	_, token := ts.Signup(t, "Heidi", "heidi@example.com", "password123")
+	ts.Do(t, http.MethodGet, "/api/v1/users", token, nil, nil)
+
+	if code := ts.Do(t, http.MethodGet, "/api/v1/admin/slo", token, nil, nil); code != http.StatusForbidden {
+		t.Fatalf("GET /admin/slo as a user: expected 403, got %d", code)
+	}
+
+	var report struct {
+		Met       bool `json:"met"`
+		Endpoints []struct {
+			Endpoint string `json:"endpoint"`
+			Requests int64  `json:"requests"`
+		} `json:"endpoints"`
+	}
+	if code := ts.Do(t, http.MethodGet, "/api/v1/admin/slo", ts.AdminToken(t), nil, &report); code != http.StatusOK {
+		t.Fatalf("GET /admin/slo: expected 200, got %d", code)
+	}
+	for _, e := range report.Endpoints {
+		if e.Endpoint == "GET /api/v1/users" && e.Requests == 1 {
+			return
+		}
+	}
+	t.Fatalf("GET /api/v1/users missing from SLO report: %+v", report.Endpoints)
+}
+
+func TestUserHistoryEndpoint(t *testing.T) {
+	ts := NewTestServer(t)
+	admin := ts.AdminToken(t)
+	alice, userToken := ts.Signup(t, "Alice", "alice@example.com", "password123")
+	renamedAt := time.Now()
+	if _, err := ts.App.Users.UpdateUser(context.Background(), alice.ID, 0, models.RestUpdateUserRequest{Name: "Alice Liddell"}); err != nil {
+		t.Fatal(err)
+	}
+	path := fmt.Sprintf("/admin/users/%d/history", alice.ID)
+
+	var resp struct {
+		History []models.UserHistory `json:"history"`
+	}
+	if code := ts.Do(t, http.MethodGet, path, admin, nil, &resp); code != http.StatusOK || len(resp.History) != 2 {
+		t.Fatalf("GET %s: status %d, %d snapshots", path, code, len(resp.History))
+	}
+	if resp.History[0].Name != "Alice" || resp.History[1].Name != "Alice Liddell" || resp.History[1].ValidTo != nil {
+		t.Fatalf("GET %s: %+v", path, resp.History)
+	}
+
+	var at struct {
+		Snapshot models.UserHistory `json:"snapshot"`
+	}
+	query := path + "?at=" + url.QueryEscape(renamedAt.Format(time.RFC3339Nano))
+	if code := ts.Do(t, http.MethodGet, query, admin, nil, &at); code != http.StatusOK || at.Snapshot.Name != "Alice" {
+		t.Fatalf("GET %s: status %d, snapshot %+v", query, code, at.Snapshot)
+	}
+
+	for _, tc := range []struct {
+		path, token string
+		status      int
+	}{
+		{path, userToken, http.StatusForbidden},
+		{path + "?at=yesterday", admin, http.StatusBadRequest},
+		{path + "?at=2000-01-01T00:00:00Z", admin, http.StatusNotFound},
+		{fmt.Sprintf("/admin/users/%d/history", alice.ID+100), admin, http.StatusNotFound},
+	} {
+		if code := ts.Do(t, http.MethodGet, tc.path, tc.token, nil, nil); code != tc.status {
+			t.Errorf("GET %s: expected %d, got %d", tc.path, tc.status, code)
+		}
+	}
+}
+
+func TestHistoryPurgeTask(t *testing.T) {
+	ts := NewTestServer(t)
+	user, token := ts.Signup(t, "Grace", "grace@example.com", "password123")
+	name := "Grace Example"
+	patch := models.PatchUserRequest{Name: &name}
+	if code := ts.DoWithHeaders(t, http.MethodPatch, fmt.Sprintf("/users/%d", user.ID), token, ifMatch(user.Version), patch, nil); code != http.StatusOK {
+		t.Fatalf("PATCH: expected 200, got %d", code)
+	}
+
+	// Zero retention purges every superseded snapshot but keeps the current one
+	if err := cron.RunOnce(context.Background(), cron.PurgeUserHistory(ts.Repo, 0)); err != nil {
+		t.Fatalf("purge history: %v", err)
+	}
+	history, err := ts.Repo.GetUserHistory(context.Background(), user.ID)
+	if err != nil || len(history) != 1 || history[0].Name != name || history[0].ValidTo != nil {
+		t.Fatalf("history after purge: %+v, %v", history, err)
+	}
+}
+
+func TestAccountRecovery(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.Recovery.RequiredApprovals = 1 })
+	user, _ := ts.Signup(t, "Heidi", "heidi@example.com", "password123")
+	opener := ts.AdminToken(t)
+	approver := ts.Token(t, auth.Identity{UserID: 1<<30 + 1, Role: models.RoleAdmin, TenantID: models.DefaultTenant})
+
+	var opened struct {
+		Case models.RecoveryCase `json:"case"`
+	}
+	open := models.OpenRecoveryCaseRequest{UserID: user.ID, Reason: "lost mailbox", Verification: "video call with ID"}
+	if code := ts.Do(t, http.MethodPost, "/admin/recovery-cases", opener, open, &opened); code != http.StatusCreated || opened.Case.Status != models.RecoveryOpen {
+		t.Fatalf("open case: status %d, case %+v", code, opened.Case)
+	}
+	path := fmt.Sprintf("/admin/recovery-cases/%d", opened.Case.ID)
+
+	if code := ts.Do(t, http.MethodPost, path+"/reset", opener, models.RecoveryResetRequest{}, nil); code != http.StatusConflict {
+		t.Fatalf("reset before approval: expected 409, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodPost, path+"/approve", opener, models.RecoveryDecisionRequest{}, nil); code != http.StatusForbidden {
+		t.Fatalf("self approval: expected 403, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodPost, path+"/approve", approver, models.RecoveryDecisionRequest{Note: "checked"}, nil); code != http.StatusOK {
+		t.Fatalf("approve: expected 200, got %d", code)
+	}
+
+	var reset struct {
+		ResetToken string `json:"reset_token"`
+	}
+	resetReq := models.RecoveryResetRequest{NewEmail: "heidi@new.example.com"}
+	if code := ts.Do(t, http.MethodPost, path+"/reset", opener, resetReq, &reset); code != http.StatusOK || reset.ResetToken == "" {
+		t.Fatalf("reset: status %d, token %q", code, reset.ResetToken)
+	}
+	if code := ts.Do(t, http.MethodPost, "/login", "", models.LoginRequest{Email: resetReq.NewEmail, Password: "password123"}, nil); code != http.StatusUnauthorized {
+		t.Fatalf("login with the old password: expected 401, got %d", code)
+	}
+
+	redeem := models.RedeemRecoveryTokenRequest{Token: reset.ResetToken, Password: "new-password"}
+	if code := ts.Do(t, http.MethodPost, "/recovery/redeem", "", redeem, nil); code != http.StatusOK {
+		t.Fatalf("redeem: expected 200, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodPost, "/recovery/redeem", "", redeem, nil); code != http.StatusUnauthorized {
+		t.Fatalf("redeem twice: expected 401, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodPost, "/login", "", models.LoginRequest{Email: resetReq.NewEmail, Password: "new-password"}, nil); code != http.StatusOK {
+		t.Fatalf("login after recovery: expected 200, got %d", code)
+	}
+
+	var audited struct {
+		Case models.RecoveryCase `json:"case"`
+	}
+	if code := ts.Do(t, http.MethodGet, path, opener, nil, &audited); code != http.StatusOK || len(audited.Case.Events) != 4 {
+		t.Fatalf("audit log: status %d, events %+v", code, audited.Case.Events)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	ts := NewTestServer(t)
+
+	var created struct {
+		User   models.User `json:"user"`
+		Token  string      `json:"token"`
+		DryRun bool        `json:"dry_run"`
+	}
+	signup := models.SignupRequest{Name: "Ivan", Email: "ivan@example.com", Password: "password123"}
+	if code := ts.Do(t, http.MethodPost, "/signup?dry_run=true", "", signup, &created); code != http.StatusOK || !created.DryRun || created.Token != "" {
+		t.Fatalf("dry-run signup: status %d, body %+v", code, created)
+	}
+	if code := ts.Do(t, http.MethodPost, "/signup?dry_run=maybe", "", signup, nil); code != http.StatusBadRequest {
+		t.Fatalf("invalid dry_run: expected 400, got %d", code)
+	}
+
+	user, token := ts.Signup(t, "Ivan", "ivan@example.com", "password123")
+	if code := ts.Do(t, http.MethodPost, "/signup?dry_run=true", "", signup, nil); code != http.StatusConflict {
+		t.Fatalf("dry-run signup of a taken email: expected 409, got %d", code)
+	}
+
+	path := fmt.Sprintf("/users/%d", user.ID)
+	name := "Ivan Example"
+	var patched userResponse
+	if code := ts.DoWithHeaders(t, http.MethodPatch, path+"?dry_run=true", token, ifMatch(user.Version), models.PatchUserRequest{Name: &name}, &patched); code != http.StatusOK || patched.User.Name != name {
+		t.Fatalf("dry-run PATCH: status %d, user %+v", code, patched.User)
+	}
+	if code := ts.Do(t, http.MethodDelete, path+"?dry_run=true", token, nil, nil); code != http.StatusOK {
+		t.Fatalf("dry-run DELETE: expected 200, got %d", code)
+	}
+
+	var got userResponse
+	if code := ts.Do(t, http.MethodGet, path, token, nil, &got); code != http.StatusOK || got.User.Name != "Ivan" || got.User.Version != user.Version {
+		t.Fatalf("user after dry runs: status %d, user %+v", code, got.User)
+	}
+
+	resp, err := ts.GRPC.CreateUser(context.Background(), &proto.CreateUserRequest{Name: "Judy", Email: "judy@example.com", Password: "password123", DryRun: true})
+	if err != nil || resp.User.Email != "judy@example.com" {
+		t.Fatalf("gRPC dry-run CreateUser: %v, %v", resp, err)
+	}
+	if _, err := ts.Repo.FindUserByEmail(context.Background(), "judy@example.com"); err == nil {
+		t.Fatal("gRPC dry-run CreateUser persisted the user")
+	}
+}
+
+// fakeProvider is an oauth.Provider that approves every login as identity
+type fakeProvider struct {
+	identity oauth.Identity
+}
+
+func (p *fakeProvider) AuthCodeURL(state, nonce string) string {
+	return "https://provider.example/authorize?" + url.Values{"state": {state}}.Encode()
+}
+
+func (p *fakeProvider) Exchange(ctx context.Context, code, nonce string) (*oauth.Identity, error) {
+	identity := p.identity
+	return &identity, nil
+}
+
+// oauthLogin goes through the login flow of the named provider, decoding
+// the callback's response into out
+func oauthLogin(t *testing.T, ts *TestServer, provider string, out interface{}) int {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(ts.HTTP.URL + "/auth/" + provider + "/login")
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("GET /auth/%s/login: %v, %v", provider, resp, err)
+	}
+	resp.Body.Close()
+	location, _ := url.Parse(resp.Header.Get("Location"))
+
+	req, _ := http.NewRequest(http.MethodGet, ts.HTTP.URL+"/auth/"+provider+"/callback?code=ok&state="+location.Query().Get("state"), nil)
+	for _, cookie := range resp.Cookies() {
+		req.AddCookie(cookie)
+	}
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("GET /auth/%s/callback: %v", provider, err)
+	}
+	defer resp.Body.Close()
+	_ = json.NewDecoder(resp.Body).Decode(out)
+	return resp.StatusCode
+}
+
+func TestOAuthLogin(t *testing.T) {
+	ts := NewTestServer(t)
+	provider := &fakeProvider{identity: oauth.Identity{Subject: "42", Email: "kim@example.com", EmailVerified: true, Name: "Kim"}}
+	ts.App.Handler.ConfigureOAuth(map[string]oauth.Provider{"test": provider}, cache.NewMemoryStore(api.TwoFactorTokenTTL))
+	login := func() (int, userResponse) {
+		var body userResponse
+		code := oauthLogin(t, ts, "test", &body)
+		return code, body
+	}
+
+	code, first := login()
+	if code != http.StatusOK || first.User.Email != "kim@example.com" {
+		t.Fatalf("first provider login: status %d, user %+v", code, first.User)
+	}
+	code, second := login()
+	if code != http.StatusOK || second.User.ID != first.User.ID {
+		t.Fatalf("second provider login: status %d, user %+v", code, second.User)
+	}
+
+	if code := ts.Do(t, http.MethodGet, "/auth/test/callback?code=ok&state=forged", "", nil, nil); code != http.StatusBadRequest {
+		t.Fatalf("callback without state cookie: expected 400, got %d", code)
+	}
+
+	provider.identity = oauth.Identity{Subject: "43", Email: "kim@example.com"}
+	if code, _ := login(); code != http.StatusForbidden {
+		t.Fatalf("login with an unverified email: expected 403, got %d", code)
+	}
+}
+
+func TestOAuthLoginTwoFactor(t *testing.T) {
+	ts := NewTestServer(t)
+	provider := &fakeProvider{identity: oauth.Identity{Subject: "44", Email: "lee@example.com", EmailVerified: true, Name: "Lee"}}
+	ts.App.Handler.ConfigureOAuth(map[string]oauth.Provider{"test": provider}, cache.NewMemoryStore(api.TwoFactorTokenTTL))
+	_, token := ts.Signup(t, "Lee", "lee@example.com", "password123")
+
+	var enrollment models.TwoFactorEnrollment
+	if code := ts.Do(t, http.MethodPost, "/me/2fa/enroll", token, nil, &enrollment); code != http.StatusOK {
+		t.Fatalf("enroll: expected 200, got %d", code)
+	}
+	current, err := totp.GenerateCode(enrollment.Secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := ts.Do(t, http.MethodPost, "/me/2fa/verify", token, models.TwoFactorCodeRequest{Code: current}, nil); code != http.StatusOK {
+		t.Fatalf("verify: expected 200, got %d", code)
+	}
+
+	// The provider only stands in for the password
+	var held struct {
+		Code           string `json:"code"`
+		Token          string `json:"token"`
+		TwoFactorToken string `json:"two_factor_token"`
+	}
+	if code := oauthLogin(t, ts, "test", &held); code != http.StatusUnauthorized || held.Code != "two_factor_required" || held.Token != "" || held.TwoFactorToken == "" {
+		t.Fatalf("provider login with 2FA: status %d, response %+v", code, held)
+	}
+
+	var failed struct {
+		Code string `json:"code"`
+	}
+	wrong := models.TwoFactorLoginRequest{TwoFactorToken: held.TwoFactorToken, TOTPCode: "000000"}
+	if code := ts.Do(t, http.MethodPost, "/login/2fa", "", wrong, &failed); code != http.StatusUnauthorized || failed.Code != "invalid_two_factor_code" {
+		t.Fatalf("wrong code: status %d, code %q", code, failed.Code)
+	}
+	forged := models.TwoFactorLoginRequest{TwoFactorToken: "forged", TOTPCode: current}
+	if code := ts.Do(t, http.MethodPost, "/login/2fa", "", forged, &failed); code != http.StatusUnauthorized || failed.Code != "invalid_two_factor_token" {
+		t.Fatalf("forged token: status %d, code %q", code, failed.Code)
+	}
+
+	var body struct {
+		User  models.User `json:"user"`
+		Token string      `json:"token"`
+	}
+	complete := models.TwoFactorLoginRequest{TwoFactorToken: held.TwoFactorToken, TOTPCode: current}
+	if code := ts.Do(t, http.MethodPost, "/login/2fa", "", complete, &body); code != http.StatusOK || body.User.Email != "lee@example.com" || body.Token == "" {
+		t.Fatalf("complete login: status %d, response %+v", code, body)
+	}
+	if code := ts.Do(t, http.MethodPost, "/login/2fa", "", complete, nil); code != http.StatusUnauthorized {
+		t.Fatalf("reused two-factor token: expected 401, got %d", code)
+	}
+
+	// Wrong codes use the token up
+	if code := oauthLogin(t, ts, "test", &held); code != http.StatusUnauthorized {
+		t.Fatalf("second provider login: expected 401, got %d", code)
+	}
+	wrong.TwoFactorToken = held.TwoFactorToken
+	for i := 0; i < 5; i++ {
+		_ = ts.Do(t, http.MethodPost, "/login/2fa", "", wrong, nil)
+	}
+	complete.TwoFactorToken = held.TwoFactorToken
+	if code := ts.Do(t, http.MethodPost, "/login/2fa", "", complete, &failed); code != http.StatusUnauthorized || failed.Code != "invalid_two_factor_token" {
+		t.Fatalf("token after five wrong codes: status %d, code %q", code, failed.Code)
+	}
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	ts := NewTestServer(t)
+	_, token := ts.Signup(t, "Ivan", "ivan@example.com", "password123")
+	login := models.LoginRequest{Email: "ivan@example.com", Password: "password123"}
+
+	var enrollment models.TwoFactorEnrollment
+	if code := ts.Do(t, http.MethodPost, "/me/2fa/enroll", token, nil, &enrollment); code != http.StatusOK || !strings.HasPrefix(enrollment.URL, "otpauth://totp/") {
+		t.Fatalf("enroll: status %d, enrollment %+v", code, enrollment)
+	}
+	// Not enforced until confirmed
+	if code := ts.Do(t, http.MethodPost, "/login", "", login, nil); code != http.StatusOK {
+		t.Fatalf("login before confirming: expected 200, got %d", code)
+	}
+
+	if code := ts.Do(t, http.MethodPost, "/me/2fa/verify", token, models.TwoFactorCodeRequest{Code: "000000"}, nil); code != http.StatusUnauthorized {
+		t.Fatalf("verify with a wrong code: expected 401, got %d", code)
+	}
+	current, err := totp.GenerateCode(enrollment.Secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var enabled struct {
+		BackupCodes []string `json:"backup_codes"`
+	}
+	if code := ts.Do(t, http.MethodPost, "/me/2fa/verify", token, models.TwoFactorCodeRequest{Code: current}, &enabled); code != http.StatusOK || len(enabled.BackupCodes) != 10 {
+		t.Fatalf("verify: status %d, backup codes %v", code, enabled.BackupCodes)
+	}
+
+	var challenge struct {
+		Code string `json:"code"`
+	}
+	if code := ts.Do(t, http.MethodPost, "/login", "", login, &challenge); code != http.StatusUnauthorized || challenge.Code != "two_factor_required" {
+		t.Fatalf("login without a code: status %d, code %q", code, challenge.Code)
+	}
+	login.TOTPCode = current
+	if code := ts.Do(t, http.MethodPost, "/login", "", login, nil); code != http.StatusOK {
+		t.Fatalf("login with a TOTP code: expected 200, got %d", code)
+	}
+
+	// Backup codes work once
+	login.TOTPCode = strings.ToUpper(enabled.BackupCodes[0])
+	if code := ts.Do(t, http.MethodPost, "/login", "", login, nil); code != http.StatusOK {
+		t.Fatalf("login with a backup code: expected 200, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodPost, "/login", "", login, nil); code != http.StatusUnauthorized {
+		t.Fatalf("reused backup code: expected 401, got %d", code)
+	}
+
+	disable := models.TwoFactorCodeRequest{Code: enabled.BackupCodes[1]}
+	if code := ts.Do(t, http.MethodPost, "/me/2fa/disable", token, disable, nil); code != http.StatusOK {
+		t.Fatalf("disable: expected 200, got %d", code)
+	}
+	login.TOTPCode = ""
+	if code := ts.Do(t, http.MethodPost, "/login", "", login, nil); code != http.StatusOK {
+		t.Fatalf("login after disabling: expected 200, got %d", code)
+	}
+}
+
+// capturedSMS records the text messages sent through it
+type capturedSMS struct {
+	mu       sync.Mutex
+	messages []sms.Message
+}
+
+func (c *capturedSMS) Send(ctx context.Context, msg sms.Message) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, msg)
+	return fmt.Sprintf("SM%d", len(c.messages)), nil
+}
+
+// lastCode returns the code in the latest message and how many were sent
+func (c *capturedSMS) lastCode(t *testing.T) (string, int) {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.messages) == 0 {
+		t.Fatal("no text message was sent")
+	}
+	code := regexp.MustCompile(`\d{6}`).FindString(c.messages[len(c.messages)-1].Body)
+	return code, len(c.messages)
+}
+
+func TestPhoneVerificationAndOTPLogin(t *testing.T) {
+	ts := NewTestServer(t)
+	_, token := ts.Signup(t, "Nora", "nora@example.com", "password123")
+	const number = "+14155550123"
+
+	if code := ts.Do(t, http.MethodPost, "/login/otp", "", models.OTPLoginRequest{Phone: number}, nil); code != http.StatusNotFound {
+		t.Fatalf("OTP login is off by default: expected 404, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodPost, "/sms/status", "", nil, nil); code != http.StatusNotFound {
+		t.Fatalf("the log provider sends no delivery reports: expected 404, got %d", code)
+	}
+
+	// Swap in a provider the test can read codes from, allowing 3 codes per number
+	captured := &capturedSMS{}
+	phones := phone.NewService(ts.App.Users, sms.NewClient(captured, "test"), cache.NewMemoryStore(time.Minute), time.Minute)
+	phones.SetRateLimit(router.NewMemoryLimitStore(), 3, time.Hour)
+	ts.App.Handler.ConfigurePhone(phones, ts.App.SMS, true)
+
+	var failure struct {
+		Code string `json:"code"`
+	}
+	if code := ts.Do(t, http.MethodPost, "/me/phone/verify", token, nil, &failure); code != http.StatusBadRequest || failure.Code != "no_phone" {
+		t.Fatalf("verify without a phone: status %d, code %q", code, failure.Code)
+	}
+	if code := ts.Do(t, http.MethodPut, "/me", token, models.RestUpdateUserRequest{Phone: number}, nil); code != http.StatusOK {
+		t.Fatalf("PUT /me: status %d", code)
+	}
+	if code := ts.Do(t, http.MethodPost, "/me/phone/verify", token, nil, nil); code != http.StatusAccepted {
+		t.Fatalf("POST /me/phone/verify: expected 202, got %d", code)
+	}
+	verification, _ := captured.lastCode(t)
+	if code := ts.Do(t, http.MethodPost, "/me/phone/verify/confirm", token, models.PhoneCodeRequest{Code: "000000"}, &failure); code != http.StatusUnauthorized || failure.Code != "invalid_code" {
+		t.Fatalf("confirm with a wrong code: status %d, code %q", code, failure.Code)
+	}
+	var verified userResponse
+	if code := ts.Do(t, http.MethodPost, "/me/phone/verify/confirm", token, models.PhoneCodeRequest{Code: verification}, &verified); code != http.StatusOK || verified.User.PhoneVerifiedAt == nil {
+		t.Fatalf("confirm: status %d, %+v", code, verified.User)
+	}
+	if code := ts.Do(t, http.MethodPost, "/me/phone/verify/confirm", token, models.PhoneCodeRequest{Code: verification}, nil); code != http.StatusUnauthorized {
+		t.Fatalf("reused verification code: expected 401, got %d", code)
+	}
+
+	// Unknown numbers get the same answer and no message
+	_, sent := captured.lastCode(t)
+	if code := ts.Do(t, http.MethodPost, "/login/otp", "", models.OTPLoginRequest{Phone: "+14155550199"}, nil); code != http.StatusAccepted {
+		t.Fatalf("login code for an unknown number: expected 202, got %d", code)
+	}
+	if _, n := captured.lastCode(t); n != sent {
+		t.Fatal("a login code was texted to an unknown number")
+	}
+
+	if code := ts.Do(t, http.MethodPost, "/login/otp", "", models.OTPLoginRequest{Phone: number}, nil); code != http.StatusAccepted {
+		t.Fatalf("POST /login/otp: expected 202, got %d", code)
+	}
+	login, _ := captured.lastCode(t)
+	if code := ts.Do(t, http.MethodPost, "/login/otp/verify", "", models.OTPVerifyRequest{Phone: number, Code: "000000"}, nil); code != http.StatusUnauthorized {
+		t.Fatalf("login with a wrong code: expected 401, got %d", code)
+	}
+	var session struct {
+		Token string      `json:"token"`
+		User  models.User `json:"user"`
+	}
+	if code := ts.Do(t, http.MethodPost, "/login/otp/verify", "", models.OTPVerifyRequest{Phone: number, Code: login}, &session); code != http.StatusOK || session.Token == "" || session.User.Email != "nora@example.com" {
+		t.Fatalf("login with the code: status %d, %+v", code, session.User)
+	}
+
+	// The verification, the login code and this one used up the number's budget
+	if code := ts.Do(t, http.MethodPost, "/login/otp", "", models.OTPLoginRequest{Phone: number}, nil); code != http.StatusAccepted {
+		t.Fatalf("third code: expected 202, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodPost, "/login/otp", "", models.OTPLoginRequest{Phone: number}, &failure); code != http.StatusTooManyRequests || failure.Code != "sms_rate_limited" {
+		t.Fatalf("fourth code: status %d, code %q", code, failure.Code)
+	}
+
+	// Changing the number drops its verification
+	var updated userResponse
+	if code := ts.Do(t, http.MethodPut, "/me", session.Token, models.RestUpdateUserRequest{Phone: "+14155550124"}, &updated); code != http.StatusOK || updated.User.PhoneVerifiedAt != nil {
+		t.Fatalf("PUT /me with a new number: status %d, %+v", code, updated.User)
+	}
+}
+
+func TestProfileAndAvatar(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.Avatars.MaxBytes = 64 << 10 })
+	user, token := ts.Signup(t, "Liam", "liam@example.com", "password123")
+	path := fmt.Sprintf("/users/%d", user.ID)
+
+	var patched userResponse
+	bio, phone := "Gopher", "+14155550123"
+	if code := ts.DoWithHeaders(t, http.MethodPatch, path, token, ifMatch(user.Version), models.PatchUserRequest{Bio: &bio, Phone: &phone}, &patched); code != http.StatusOK || patched.User.Bio != bio || patched.User.Phone != phone {
+		t.Fatalf("PATCH profile: status %d, user %+v", code, patched.User)
+	}
+	bad := "555-0123"
+	if code := ts.DoWithHeaders(t, http.MethodPatch, path, token, ifMatch(patched.User.Version), models.PatchUserRequest{Phone: &bad}, nil); code != http.StatusBadRequest {
+		t.Fatalf("PATCH with a malformed phone: expected 400, got %d", code)
+	}
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	if code := ts.Upload(t, path+"/avatar", token, "avatar", "me.png", []byte("<svg></svg>"), nil); code != http.StatusBadRequest {
+		t.Fatalf("upload a non-image: expected 400, got %d", code)
+	}
+	if code := ts.Upload(t, path+"/avatar", token, "avatar", "big.png", make([]byte, 65<<10), nil); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("upload over the limit: expected 413, got %d", code)
+	}
+
+	var uploaded userResponse
+	if code := ts.Upload(t, path+"/avatar", token, "avatar", "me.png", img.Bytes(), &uploaded); code != http.StatusOK || uploaded.User.Avatar == "" {
+		t.Fatalf("upload: status %d, user %+v", code, uploaded.User)
+	}
+
+	resp, err := ts.HTTP.Client().Get(ts.HTTP.URL + "/avatars/" + uploaded.User.Avatar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	served, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/png" || !bytes.Equal(served, img.Bytes()) {
+		t.Fatalf("GET avatar: status %d, type %q, %d bytes", resp.StatusCode, resp.Header.Get("Content-Type"), len(served))
+	}
+
+	if code := ts.Do(t, http.MethodDelete, path+"/avatar", token, nil, nil); code != http.StatusOK {
+		t.Fatalf("DELETE avatar: expected 200, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodGet, "/avatars/"+uploaded.User.Avatar, "", nil, nil); code != http.StatusNotFound {
+		t.Fatalf("GET deleted avatar: expected 404, got %d", code)
+	}
+}
+
+func TestSignedObjectURL(t *testing.T) {
+	ts := NewTestServer(t)
+	ctx := context.Background()
+	data := []byte(`{"export":true}`)
+	if err := ts.App.Objects.Put(ctx, "exports/1/data.json", bytes.NewReader(data), int64(len(data)), "application/json"); err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := ts.App.Objects.SignedURL(ctx, "exports/1/data.json", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ts.HTTP.Client().Get(ts.HTTP.URL + signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, data) {
+		t.Fatalf("GET signed URL: status %d, body %q", resp.StatusCode, body)
+	}
+
+	tampered := strings.Replace(signed, "exports/1/", "exports/2/", 1)
+	if code := ts.Do(t, http.MethodGet, tampered, "", nil, nil); code != http.StatusForbidden {
+		t.Fatalf("GET tampered URL: expected 403, got %d", code)
+	}
+	expired, err := ts.App.Objects.SignedURL(ctx, "exports/1/data.json", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := ts.Do(t, http.MethodGet, expired, "", nil, nil); code != http.StatusForbidden {
+		t.Fatalf("GET expired URL: expected 403, got %d", code)
+	}
+}
+
+func TestImpersonation(t *testing.T) {
+	ts := NewTestServer(t)
+	bob, _ := ts.Signup(t, "Bob", "bob@example.com", "password123")
+	ada, admin := ts.AdminAccount(t, "Ada", "ada@example.com")
+
+	var issued struct {
+		Token     string `json:"token"`
+		ActorID   uint   `json:"actor_id"`
+		SubjectID uint   `json:"subject_id"`
+	}
+	if code := ts.Do(t, http.MethodPost, fmt.Sprintf("/admin/impersonate/%d", bob.ID), admin, nil, &issued); code != http.StatusOK || issued.SubjectID != bob.ID || issued.ActorID != ada.ID {
+		t.Fatalf("POST /admin/impersonate: status %d, %+v", code, issued)
+	}
+	identity, err := ts.App.Tokens.ParseToken(issued.Token)
+	if err != nil || identity.UserID != bob.ID || identity.Actor() != ada.ID {
+		t.Fatalf("impersonation token identity: %+v, %v", identity, err)
+	}
+
+	var me userResponse
+	if code := ts.Do(t, http.MethodGet, "/me", issued.Token, nil, &me); code != http.StatusOK || me.User.ID != bob.ID {
+		t.Fatalf("GET /me while impersonating: status %d, user %d", code, me.User.ID)
+	}
+	if code := ts.Do(t, http.MethodDelete, fmt.Sprintf("/users/%d", bob.ID), issued.Token, nil, nil); code != http.StatusForbidden {
+		t.Fatalf("DELETE while impersonating: expected 403, got %d", code)
+	}
+	// Anything but reads is refused, not just deletes
+	for _, route := range []struct{ method, path string }{
+		{http.MethodPost, "/me/deactivate"},
+		{http.MethodPost, "/me/2fa/disable"},
+		{http.MethodPost, "/me/2fa/enroll"},
+		{http.MethodPut, "/me"},
+		{http.MethodPost, "/me/export"},
+		{http.MethodPost, "/me/phone/verify"},
+	} {
+		if code := ts.Do(t, route.method, route.path, issued.Token, map[string]any{}, nil); code != http.StatusForbidden {
+			t.Fatalf("%s %s while impersonating: expected 403, got %d", route.method, route.path, code)
+		}
+	}
+	if code := ts.Do(t, http.MethodPost, "/users/batch-get", issued.Token, map[string]any{"ids": []uint{bob.ID}}, nil); code != http.StatusOK {
+		t.Fatalf("POST /users/batch-get, a read, while impersonating: expected 200, got %d", code)
+	}
+	ctx := WithToken(context.Background(), issued.Token)
+	if _, err := ts.GRPC.GetUser(ctx, &proto.GetUserRequest{Id: uint32(bob.ID)}); err != nil {
+		t.Fatalf("gRPC GetUser while impersonating: %v", err)
+	}
+	if _, err := ts.GRPC.UpdateUser(ctx, &proto.UpdateUserRequest{Id: uint32(bob.ID), Name: "Robert"}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("gRPC UpdateUser while impersonating: expected PermissionDenied, got %v", err)
+	}
+	if code := ts.Do(t, http.MethodPost, "/admin/impersonate/1", issued.Token, nil, nil); code != http.StatusForbidden {
+		t.Fatalf("impersonate while impersonating: expected 403, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodPost, "/admin/impersonate/999999", admin, nil, nil); code != http.StatusNotFound {
+		t.Fatalf("impersonate missing user: expected 404, got %d", code)
+	}
+}
+
+func TestImpersonationEndsWithAccounts(t *testing.T) {
+	// Impersonation tokens carry no session, so with sessions enabled they
+	// rely on the account checks of both the subject and the admin
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.Session.Enabled = true })
+	bob, _ := ts.Signup(t, "Bob", "bob@example.com", "password123")
+	ada, admin := ts.AdminAccount(t, "Ada", "ada@example.com")
+	root := ts.AdminToken(t)
+
+	impersonate := func() string {
+		t.Helper()
+		var issued struct {
+			Token string `json:"token"`
+		}
+		if code := ts.Do(t, http.MethodPost, fmt.Sprintf("/admin/impersonate/%d", bob.ID), admin, nil, &issued); code != http.StatusOK {
+			t.Fatalf("POST /admin/impersonate: status %d", code)
+		}
+		if code := ts.Do(t, http.MethodGet, "/me", issued.Token, nil, nil); code != http.StatusOK {
+			t.Fatalf("GET /me while impersonating: status %d", code)
+		}
+		return issued.Token
+	}
+	post := func(path string) {
+		t.Helper()
+		if code := ts.Do(t, http.MethodPost, path, root, nil, nil); code != http.StatusOK {
+			t.Fatalf("POST %s: status %d", path, code)
+		}
+	}
+
+	for _, user := range []*models.User{bob, ada} {
+		token := impersonate()
+		post(fmt.Sprintf("/admin/users/%d/suspend", user.ID))
+		if code := ts.Do(t, http.MethodGet, "/me", token, nil, nil); code != http.StatusUnauthorized {
+			t.Fatalf("impersonating after suspending %s: expected 401, got %d", user.Name, code)
+		}
+		if _, err := ts.GRPC.GetUser(WithToken(context.Background(), token), &proto.GetUserRequest{Id: uint32(bob.ID)}); status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("gRPC impersonating after suspending %s: expected Unauthenticated, got %v", user.Name, err)
+		}
+		post(fmt.Sprintf("/admin/users/%d/reactivate", user.ID))
+	}
+
+	token := impersonate()
+	if code := ts.Do(t, http.MethodDelete, fmt.Sprintf("/users/%d", ada.ID), root, nil, nil); code != http.StatusOK {
+		t.Fatalf("deleting the admin: status %d", code)
+	}
+	if code := ts.Do(t, http.MethodGet, "/me", token, nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("impersonating after deleting the admin: expected 401, got %d", code)
+	}
+}
+
+func TestCompressionAndContentNegotiation(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.API.CompressionMinSize = 1 })
+	alice, _ := ts.Signup(t, "Alice", "alice@example.com", "password123")
+	admin := ts.AdminToken(t)
+
+	get := func(path, accept, encoding string) (*http.Response, []byte) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.HTTP.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer "+admin)
+		req.Header.Set("Accept", accept)
+		req.Header.Set("Accept-Encoding", encoding)
+		resp, err := ts.HTTP.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body io.Reader = resp.Body
+		if resp.Header.Get("Content-Encoding") == "gzip" {
+			if body, err = gzip.NewReader(resp.Body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, data
+	}
+
+	resp, body := get("/users", "", "gzip;q=1, deflate;q=0.5")
+	if resp.Header.Get("Content-Encoding") != "gzip" || !bytes.Contains(body, []byte(`"alice@example.com"`)) {
+		t.Fatalf("gzip: encoding %q, body %s", resp.Header.Get("Content-Encoding"), body)
+	}
+	if resp, _ := get("/users", "", "identity"); resp.Header.Get("Content-Encoding") != "" {
+		t.Fatalf("identity: unexpected Content-Encoding %q", resp.Header.Get("Content-Encoding"))
+	}
+
+	resp, body = get("/users", "application/xml", "")
+	var doc struct {
+		Users []struct {
+			Email string `xml:"email"`
+		} `xml:"users>item"`
+	}
+	if err := xml.Unmarshal(body, &doc); err != nil || len(doc.Users) != 1 || doc.Users[0].Email != "alice@example.com" {
+		t.Fatalf("xml: %v, %s", err, body)
+	}
+
+	resp, body = get("/users", "text/csv", "")
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil || len(records) != 2 || records[0][0] != "id" || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/csv") {
+		t.Fatalf("csv: %v, %s", err, body)
+	}
+
+	if resp, _ := get(fmt.Sprintf("/users/%d", alice.ID), "text/csv", ""); resp.StatusCode != http.StatusNotAcceptable {
+		t.Fatalf("csv of a non-list: expected 406, got %d", resp.StatusCode)
+	}
+	if resp, _ := get("/users", "image/png", ""); resp.StatusCode != http.StatusNotAcceptable {
+		t.Fatalf("unsupported Accept: expected 406, got %d", resp.StatusCode)
+	}
+}
+
+func TestBodyLoggingRedaction(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.Logging.Bodies = true })
+	hook := logtest.NewLocal(logger.Log)
+	defer hook.Reset()
+
+	_, token := ts.Signup(t, "Alice", "alice@example.com", "s3cret-password")
+	ts.Do(t, http.MethodGet, "/me", token, nil, nil)
+
+	var signup, me *logrus.Entry
+	for _, entry := range hook.AllEntries() {
+		switch entry.Data["path"] {
+		case "/signup":
+			signup = entry
+		case "/me":
+			me = entry
+		}
+	}
+	if signup == nil || me == nil {
+		t.Fatal("request log entries missing")
+	}
+
+	requestBody, _ := signup.Data["request_body"].(string)
+	responseBody, _ := signup.Data["response_body"].(string)
+	if !strings.Contains(requestBody, `"alice@example.com"`) || strings.Contains(requestBody, "s3cret-password") || !strings.Contains(requestBody, `"password":"[REDACTED]"`) {
+		t.Fatalf("signup request body not redacted: %s", requestBody)
+	}
+	if strings.Contains(responseBody, token) || !strings.Contains(responseBody, `"token":"[REDACTED]"`) {
+		t.Fatalf("signup response body not redacted: %s", responseBody)
+	}
+	if headers, _ := me.Data["request_headers"].(map[string]string); headers["Authorization"] != "[REDACTED]" {
+		t.Fatalf("authorization header not redacted: %v", headers)
+	}
+}
+
+// documentationNetwork places the 203.0.113.0/24 documentation range in
+// Paris and 198.51.100.0/24 in Sydney
+type documentationNetwork struct{}
+
+func (documentationNetwork) Locate(ip net.IP) (geoip.Location, error) {
+	switch {
+	case ip.Mask(net.CIDRMask(24, 32)).Equal(net.IPv4(203, 0, 113, 0)):
+		return geoip.Location{Country: "FR", City: "Paris", Latitude: 48.8566, Longitude: 2.3522, AccuracyRadius: 20}, nil
+	case ip.Mask(net.CIDRMask(24, 32)).Equal(net.IPv4(198, 51, 100, 0)):
+		return geoip.Location{Country: "AU", City: "Sydney", Latitude: -33.8688, Longitude: 151.2093, AccuracyRadius: 20}, nil
+	}
+	return geoip.Location{}, nil
+}
+
+func (documentationNetwork) Close() error { return nil }
+
+func TestGeoIPLogging(t *testing.T) {
+	// Requests come through a proxy on the loopback interface
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.Server.TrustedProxies = []string{"127.0.0.1"} })
+	ts.App.GeoIP = geoip.New(documentationNetwork{}, 100)
+	located := httptest.NewServer(ts.App.Router())
+	defer located.Close()
+	hook := logtest.NewLocal(logger.Log)
+	defer hook.Reset()
+
+	post := func(path string, body interface{}) {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		req, _ := http.NewRequest(http.MethodPost, located.URL+"/api/v1"+path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+		resp, err := located.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	post("/signup", models.SignupRequest{Name: "Alice", Email: "alice@example.com", Password: "password123"})
+	post("/login", models.LoginRequest{Email: "alice@example.com", Password: "wrong-password"})
+
+	var request, audit *logrus.Entry
+	for _, entry := range hook.AllEntries() {
+		if entry.Data["path"] == "/api/v1/login" {
+			request = entry
+		}
+		if entry.Data["type"] == "auth" && entry.Data["action"] == "login_failed" {
+			audit = entry
+		}
+	}
+	if request == nil || audit == nil {
+		t.Fatal("log entries missing")
+	}
+	for _, entry := range []*logrus.Entry{request, audit} {
+		if entry.Data["country"] != "FR" || entry.Data["city"] != "Paris" {
+			t.Errorf("expected the client's location in %q, got %v", entry.Message, entry.Data)
+		}
+	}
+
+	// Unlocated clients are logged without location fields
+	hook.Reset()
+	ts.Do(t, http.MethodGet, "/healthz", "", nil, nil)
+	for _, entry := range hook.AllEntries() {
+		if _, ok := entry.Data["country"]; ok {
+			t.Errorf("unexpected location in %v", entry.Data)
+		}
+	}
+}
+
+func TestAnomalyDetection(t *testing.T) {
+	alerts := make(chan []byte, 4)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(security.SignatureHeader) == security.Sign([]byte("webhook-secret"), body) {
+			alerts <- body
+		}
+	}))
+	defer webhook.Close()
+
+	ts := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Anomaly.Enabled = true
+		cfg.Anomaly.WebhookURL = webhook.URL
+		cfg.Anomaly.WebhookSecret = "webhook-secret"
+		cfg.Server.TrustedProxies = []string{"127.0.0.1"}
+	})
+	ts.App.GeoIP = geoip.New(documentationNetwork{}, 100)
+	ts.HTTP.Config.Handler = ts.App.Router()
+	captured := &capturedMail{}
+	ts.App.Handler.ConfigureAnomalyDetection(ts.App.Security, security.NewStepUp(cache.NewMemoryStore(time.Minute), captured, time.Minute))
+
+	ts.Signup(t, "Alice", "alice@example.com", "password123")
+	login := func(ip, stepUpCode string) (int, map[string]interface{}) {
+		t.Helper()
+		var body map[string]interface{}
+		creds := models.LoginRequest{Email: "alice@example.com", Password: "password123", StepUpCode: stepUpCode}
+		code := ts.DoWithHeaders(t, http.MethodPost, "/login", "", http.Header{"X-Forwarded-For": {ip}}, creds, &body)
+		return code, body
+	}
+
+	// The first login from Paris sets the baseline
+	if code, _ := login("203.0.113.9", ""); code != http.StatusOK {
+		t.Fatalf("login from Paris: expected 200, got %d", code)
+	}
+
+	// Sydney minutes later is held for a code, however often it is retried
+	for i := 0; i < 2; i++ {
+		code, body := login("198.51.100.7", "")
+		if code != http.StatusUnauthorized || body["code"] != "step_up_required" {
+			t.Fatalf("login from Sydney: expected step_up_required, got %d %v", code, body)
+		}
+	}
+	if got := captured.templates(); len(got) != 1 || got[0] != mail.TemplateStepUp {
+		t.Fatalf("expected one step-up email, got %v", got)
+	}
+	data := captured.sent[0].Data.(mail.StepUpData)
+	if data.Location != "Sydney, AU" || data.IP != "198.51.100.7" {
+		t.Errorf("unexpected step-up data %+v", data)
+	}
+	if code, body := login("198.51.100.7", "000000"+data.Code); code != http.StatusUnauthorized || body["code"] != "invalid_step_up_code" {
+		t.Fatalf("wrong step-up code: expected invalid_step_up_code, got %d %v", code, body)
+	}
+	if code, body := login("198.51.100.7", data.Code); code != http.StatusOK {
+		t.Fatalf("login with the step-up code: expected 200, got %d %v", code, body)
+	}
+
+	select {
+	case alert := <-alerts:
+		if !strings.Contains(string(alert), security.AnalyzerImpossibleTravel) {
+			t.Errorf("unexpected alert %s", alert)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no signed webhook alert")
+	}
+
+	// The Sydney login flagged the account once
+	admin := ts.AdminToken(t)
+	var list struct {
+		Flags []models.SecurityFlag `json:"flags"`
+	}
+	if code := ts.Do(t, http.MethodGet, "/admin/security/flags?status=open", admin, nil, &list); code != http.StatusOK || len(list.Flags) != 1 {
+		t.Fatalf("GET /admin/security/flags: expected 1 open flag, got %d %+v", code, list.Flags)
+	}
+	flag := list.Flags[0]
+	if flag.Analyzer != security.AnalyzerImpossibleTravel || flag.Severity != security.SeverityHigh || flag.IP != "198.51.100.7" {
+		t.Errorf("unexpected flag %+v", flag)
+	}
+	if code := ts.Do(t, http.MethodPost, fmt.Sprintf("/admin/security/flags/%d/resolve", flag.ID), admin, nil, nil); code != http.StatusOK {
+		t.Fatalf("resolve flag: expected 200, got %d", code)
+	}
+	if ts.Do(t, http.MethodGet, "/admin/security/flags?status=open", admin, nil, &list); len(list.Flags) != 0 {
+		t.Fatalf("expected no open flags after resolving, got %+v", list.Flags)
+	}
+	if code := ts.Do(t, http.MethodPost, "/admin/security/flags/999/resolve", admin, nil, nil); code != http.StatusNotFound {
+		t.Fatalf("resolve unknown flag: expected 404, got %d", code)
+	}
+}
+
+func TestErrorReporting(t *testing.T) {
+	ts := NewTestServer(t)
+	var reported []*errorreporting.Event
+	ts.App.Errors.AddHook(errorreporting.ReporterHookFunc(func(_ context.Context, event *errorreporting.Event) {
+		reported = append(reported, event)
+	}))
+
+	r := gin.New()
+	r.Use(api.RequestIDMiddleware(), api.RecoveryMiddleware(ts.App.Errors))
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+	r.GET("/unavailable", func(c *gin.Context) { c.JSON(http.StatusServiceUnavailable, gin.H{}) })
+	for path, status := range map[string]int{"/panic": http.StatusInternalServerError, "/unavailable": http.StatusServiceUnavailable} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != status {
+			t.Fatalf("GET %s: expected %d, got %d", path, status, w.Code)
+		}
+	}
+	if len(reported) != 2 {
+		t.Fatalf("expected 2 reported HTTP events, got %d", len(reported))
+	}
+	for _, event := range reported {
+		if event.Route == "/panic" && (event.Panic != "boom" || len(event.Stack) == 0 || event.RequestID == "") {
+			t.Fatalf("panic event incomplete: %+v", event)
+		}
+	}
+
+	reported = nil
+	interceptor := grpcserver.RecoveryInterceptor(ts.App.Errors)
+	info := &grpc.UnaryServerInfo{FullMethod: proto.UserService_GetUser_FullMethodName}
+	ctx := requestid.WithID(auth.WithIdentity(context.Background(), &auth.Identity{UserID: 7}), "req-42")
+	_, err := interceptor(ctx, nil, info, func(context.Context, interface{}) (interface{}, error) { panic("boom") })
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("gRPC panic: expected INTERNAL, got %v", err)
+	}
+	if details := status.Convert(err).Details(); len(details) != 1 || details[0].(*errdetails.RequestInfo).GetRequestId() != "req-42" {
+		t.Fatalf("gRPC panic: expected the request ID in a RequestInfo detail, got %v", details)
+	}
+	_, err = interceptor(ctx, nil, info, func(context.Context, interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("gRPC client error: expected NOT_FOUND, got %v", err)
+	}
+	if len(reported) != 1 || reported[0].UserID != 7 || reported[0].Transport != errorreporting.TransportGRPC {
+		t.Fatalf("expected only the gRPC panic to be reported, got %+v", reported)
+	}
+}
+
+func TestLogLevels(t *testing.T) {
+	ts := NewTestServer(t)
+	previous := logger.CurrentLevels()
+	out := logger.Log.Out
+	t.Cleanup(func() {
+		logger.SetLevels(previous)
+		logger.Log.SetOutput(out)
+	})
+	admin := ts.AdminToken(t)
+
+	if code := ts.Do(t, http.MethodPut, "/admin/log-levels", admin, map[string]interface{}{"default": "loud"}, nil); code != http.StatusBadRequest {
+		t.Fatalf("PUT invalid level: expected 400, got %d", code)
+	}
+	update := map[string]interface{}{"default": "warn", "components": map[string]string{"database": "debug"}}
+	if code := ts.Do(t, http.MethodPut, "/admin/log-levels", admin, update, nil); code != http.StatusOK {
+		t.Fatalf("PUT /admin/log-levels: status %d", code)
+	}
+	var got struct {
+		Levels struct {
+			Default    string            `json:"default"`
+			Components map[string]string `json:"components"`
+		} `json:"levels"`
+	}
+	if code := ts.Do(t, http.MethodGet, "/admin/log-levels", admin, nil, &got); code != http.StatusOK || got.Levels.Default != "warning" || got.Levels.Components["database"] != "debug" {
+		t.Fatalf("GET /admin/log-levels: status %d, %+v", code, got.Levels)
+	}
+
+	var buf bytes.Buffer
+	logger.Log.SetOutput(&buf)
+	logger.LogDatabase("select", "users").Debug("database debug")
+	logger.For("cron").Info("cron info")
+	logger.Log.Warn("default warning")
+	if logged := buf.String(); !strings.Contains(logged, "database debug") || strings.Contains(logged, "cron info") || !strings.Contains(logged, "default warning") {
+		t.Fatalf("unexpected log output:\n%s", logged)
+	}
+}
+
+func TestSlogBackend(t *testing.T) {
+	NewTestServer(t)
+	t.Cleanup(func() {
+		logger.Init()
+		logger.Log.SetOutput(io.Discard)
+	})
+
+	file := filepath.Join(t.TempDir(), "restapi.log")
+	err := logger.Configure(config.LoggingConfig{
+		Level:   "info",
+		Levels:  "database=debug",
+		Backend: logger.BackendSlog,
+		Format:  "json",
+		Outputs: []string{logger.OutputFile},
+		File:    file,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.LogDatabase("select", "users").WithField("user_id", 7).Debug("database debug")
+	logger.For("cron").Debug("cron debug")
+	logger.Slog.With("component", "api").Info("slog info", "status", 200)
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("log line is not JSON: %q", line)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 || records[0]["msg"] != "database debug" || records[0]["user_id"] != float64(7) ||
+		records[1]["msg"] != "slog info" || records[1]["status"] != float64(200) || records[1]["level"] != "INFO" {
+		t.Fatalf("unexpected slog output: %v", records)
+	}
+}
+
+func TestLogLevelEndpoints(t *testing.T) {
+	ts := NewTestServer(t)
+	previous := logger.CurrentLevels()
+	t.Cleanup(func() { logger.SetLevels(previous) })
+	admin := ts.AdminToken(t)
+	_, userToken := ts.Signup(t, "Alice", "alice@example.com", "password123")
+
+	if code := ts.Do(t, http.MethodPut, "/admin/loglevel", userToken, map[string]string{"level": "info"}, nil); code != http.StatusForbidden {
+		t.Fatalf("PUT /admin/loglevel as user: expected 403, got %d", code)
+	}
+	var updated struct {
+		Level         string `json:"level"`
+		PreviousLevel string `json:"previous_level"`
+	}
+	if code := ts.Do(t, http.MethodPut, "/admin/loglevel", admin, map[string]string{"level": "info"}, &updated); code != http.StatusOK || updated.Level != "info" {
+		t.Fatalf("PUT /admin/loglevel: status %d, %+v", code, updated)
+	}
+	var health struct {
+		LogLevel string `json:"log_level"`
+	}
+	if code := ts.Do(t, http.MethodGet, "/healthz", "", nil, &health); code != http.StatusOK || health.LogLevel != "info" {
+		t.Fatalf("GET /healthz: status %d, log level %q", code, health.LogLevel)
+	}
+
+	conn := ts.GRPCClient(t).Conn()
+	adminClient := proto.NewAdminServiceClient(conn)
+	req := &proto.SetLogLevelRequest{Level: "warn"}
+	if _, err := adminClient.SetLogLevel(WithToken(context.Background(), userToken), req); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("SetLogLevel as user: expected PERMISSION_DENIED, got %v", err)
+	}
+	resp, err := adminClient.SetLogLevel(WithToken(context.Background(), admin), req)
+	if err != nil || resp.Level != "warning" || resp.PreviousLevel != "info" || logger.CurrentLevels().Default.String() != "warning" {
+		t.Fatalf("SetLogLevel: %v, %+v", err, resp)
+	}
+	if _, err := adminClient.SetLogLevel(WithToken(context.Background(), admin), &proto.SetLogLevelRequest{Level: "loud"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("SetLogLevel invalid level: expected INVALID_ARGUMENT, got %v", err)
+	}
+}
+
+func TestExperimentExposures(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Experiments.Definitions = "onboarding=control:50,guided:50;dark_mode=off:90,on:10"
+	})
+	_, token := ts.Signup(t, "Alice", "alice@example.com", "password123")
+
+	if code := ts.Do(t, http.MethodGet, "/api/v1/me/experiments", "", nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("GET /me/experiments anonymously: expected 401, got %d", code)
+	}
+	var assigned struct {
+		Experiments []struct{ Experiment, Variant string } `json:"experiments"`
+	}
+	if code := ts.Do(t, http.MethodGet, "/api/v1/me/experiments", token, nil, &assigned); code != http.StatusOK || len(assigned.Experiments) != 2 {
+		t.Fatalf("GET /me/experiments: status %d, %+v", code, assigned.Experiments)
+	}
+	if assigned.Experiments[0].Experiment != "onboarding" || assigned.Experiments[1].Experiment != "dark_mode" {
+		t.Fatalf("GET /me/experiments: %+v", assigned.Experiments)
+	}
+
+	// Exposures report the variant the caller was assigned
+	var exposed struct {
+		Experiment struct{ Experiment, Variant string } `json:"experiment"`
+	}
+	if code := ts.Do(t, http.MethodPost, "/api/v1/me/experiments/onboarding/exposures", token, nil, &exposed); code != http.StatusCreated || exposed.Experiment != assigned.Experiments[0] {
+		t.Fatalf("POST exposure: status %d, %+v", code, exposed.Experiment)
+	}
+	if code := ts.Do(t, http.MethodPost, "/api/v1/me/experiments/checkout/exposures", token, nil, nil); code != http.StatusNotFound {
+		t.Fatalf("POST exposure to an unknown experiment: expected 404, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodPost, "/api/v1/me/experiments/onboarding/exposures", "", nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("POST exposure anonymously: expected 401, got %d", code)
+	}
+
+	// Without experiments the list is empty rather than missing
+	none := NewTestServer(t)
+	_, token = none.Signup(t, "Bob", "bob@example.com", "password123")
+	var empty map[string][]interface{}
+	if code := none.Do(t, http.MethodGet, "/api/v1/me/experiments", token, nil, &empty); code != http.StatusOK || empty["experiments"] == nil || len(empty["experiments"]) != 0 {
+		t.Fatalf("GET /me/experiments without experiments: status %d, %v", code, empty)
+	}
+}
+
+func TestConfigReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "restapi.env")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.File = path })
+	hook := logtest.NewLocal(logger.Log)
+	defer hook.Reset()
+	_, token := ts.Signup(t, "Alice", "alice@example.com", "password123")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = ts.App.WatchConfig(ctx) }()
+
+	// eventually rewrites the file until check passes, as the watcher may
+	// not be watching yet when it is first written
+	eventually := func(contents string, check func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+			if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(200 * time.Millisecond)
+			if check() {
+				return
+			}
+		}
+		t.Fatalf("config file not applied:\n%s", contents)
+	}
+	variant := func() string {
+		var resp struct {
+			Experiments []struct{ Experiment, Variant string } `json:"experiments"`
+		}
+		ts.Do(t, http.MethodGet, "/api/v1/me/experiments", token, nil, &resp)
+		if len(resp.Experiments) != 1 {
+			return ""
+		}
+		return resp.Experiments[0].Variant
+	}
+
+	eventually("# reloadable settings\nEXPERIMENTS=checkout=old:0,new:1\nexport CORS_ALLOWED_ORIGINS=\"https://app.example.com\"\n", func() bool {
+		return variant() == "new"
+	})
+	audited := false
+	for _, entry := range hook.AllEntries() {
+		audited = audited || (entry.Data["type"] == "config_audit" && entry.Data["setting"] == "EXPERIMENTS")
+	}
+	if !audited {
+		t.Fatal("experiment change not audit-logged")
+	}
+
+	preflight := func(origin string) *http.Response {
+		req, _ := http.NewRequest(http.MethodOptions, ts.HTTP.URL+"/api/v1/me", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+		req.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	if resp := preflight("https://app.example.com"); resp.StatusCode != http.StatusNoContent ||
+		resp.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		resp.Header.Get("Access-Control-Allow-Headers") != "authorization, content-type" {
+		t.Fatalf("preflight from an allowed origin: %d %v", resp.StatusCode, resp.Header)
+	}
+	if resp := preflight("https://evil.example.com"); resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("preflight from another origin allowed: %v", resp.Header)
+	}
+
+	// An invalid file is rejected as a whole
+	eventually("EXPERIMENTS=checkout=old:1,new:0\nRATE_LIMITS=unknown=1:1\n", func() bool {
+		for _, entry := range hook.AllEntries() {
+			if entry.Message == "Config file not reloaded, keeping the current settings" {
+				return true
+			}
+		}
+		return false
+	})
+	if got := variant(); got != "new" {
+		t.Fatalf("invalid config file partially applied: variant %q", got)
+	}
+
+	eventually("EXPERIMENTS=checkout=old:1,new:0\nRATE_LIMITS=default=100:200\n", func() bool {
+		return variant() == "old"
+	})
+	if resp := preflight("https://app.example.com"); resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("removed origin still allowed: %v", resp.Header)
+	}
+}
+
+func TestConfigReloadWithoutRateLimiting(t *testing.T) {
+	// Test servers run without rate limiting, so there is no limiter to update
+	ts := NewTestServer(t)
+	hook := logtest.NewLocal(logger.Log)
+	defer hook.Reset()
+
+	cfg := *ts.App.Config
+	cfg.API.RateLimits = "default=1:1"
+	if err := ts.App.Reload(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	restart := false
+	for _, entry := range hook.AllEntries() {
+		if entry.Data["type"] == "config_audit" && entry.Data["setting"] == "RATE_LIMITS" {
+			t.Fatal("RATE_LIMITS reported as applied without a limiter")
+		}
+		restart = restart || entry.Level == logrus.WarnLevel && strings.Contains(entry.Message, "RATE_LIMITS")
+	}
+	if !restart {
+		t.Fatal("RATE_LIMITS change not reported as requiring a restart")
+	}
+	if ts.App.RateLimits != nil {
+		t.Fatalf("rate limiting enabled by a reload: %+v", ts.App.RateLimits)
+	}
+}
+
+func TestPprof(t *testing.T) {
+	disabled := NewTestServer(t)
+	if code := disabled.Do(t, http.MethodGet, "/debug/pprof/", disabled.AdminToken(t), nil, nil); code != http.StatusNotFound {
+		t.Fatalf("GET /debug/pprof/ with pprof disabled: expected 404, got %d", code)
+	}
+
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.Metrics.Pprof = true })
+	_, userToken := ts.Signup(t, "Alice", "alice@example.com", "password123")
+	if code := ts.Do(t, http.MethodGet, "/debug/pprof/", userToken, nil, nil); code != http.StatusForbidden {
+		t.Fatalf("GET /debug/pprof/ as user: expected 403, got %d", code)
+	}
+
+	for path, want := range map[string]string{
+		"/debug/pprof/":                  "Types of profiles available",
+		"/debug/pprof/goroutine?debug=1": "goroutine profile:",
+		"/debug/pprof/cmdline":           "",
+	} {
+		req, _ := http.NewRequest(http.MethodGet, ts.HTTP.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer "+ts.AdminToken(t))
+		resp, err := ts.HTTP.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), want) {
+			t.Fatalf("GET %s: status %d, body %.200q", path, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestSeparateMetricsListener(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.Server.MetricsAddr = "127.0.0.1:0" })
+
+	if code := ts.Do(t, http.MethodGet, "/metrics", "", nil, nil); code != http.StatusNotFound {
+		t.Fatalf("GET /metrics on the public listener: expected 404, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodGet, "/readyz", "", nil, nil); code != http.StatusOK {
+		t.Fatalf("GET /readyz: expected 200, got %d", code)
+	}
+
+	internal := httptest.NewServer(ts.App.MetricsRouter())
+	defer internal.Close()
+	resp, err := internal.Client().Get(internal.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /metrics on the metrics listener: expected 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestObservabilityStatusIsAdminOnly(t *testing.T) {
+	ts := NewTestServer(t)
+	_, userToken := ts.Signup(t, "Alice", "alice@example.com", "password123")
+
+	if code := ts.Do(t, http.MethodGet, "/internal/observability", "", nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("GET /internal/observability anonymously: expected 401, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodGet, "/internal/observability", userToken, nil, nil); code != http.StatusForbidden {
+		t.Fatalf("GET /internal/observability as user: expected 403, got %d", code)
+	}
+	var status struct {
+		MetricsEnabled *bool `json:"metrics_enabled"`
+	}
+	if code := ts.Do(t, http.MethodGet, "/internal/observability", ts.AdminToken(t), nil, &status); code != http.StatusOK || status.MetricsEnabled == nil {
+		t.Fatalf("GET /internal/observability as admin: status %d, %+v", code, status)
+	}
+
+	// The internal metrics listener serves it without authentication
+	internal := NewTestServer(t, func(cfg *config.Config) { cfg.Server.MetricsAddr = "127.0.0.1:0" })
+	if code := internal.Do(t, http.MethodGet, "/internal/observability", internal.AdminToken(t), nil, nil); code != http.StatusNotFound {
+		t.Fatalf("GET /internal/observability on the public listener: expected 404, got %d", code)
+	}
+	srv := httptest.NewServer(internal.App.MetricsRouter())
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL + "/internal/observability")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /internal/observability on the metrics listener: expected 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	ts := NewTestServer(t)
+	metrics.Init(config.MetricsConfig{Enabled: true})
+
+	var info version.Info
+	if code := ts.Do(t, http.MethodGet, "/version", "", nil, &info); code != http.StatusOK {
+		t.Fatalf("GET /version: expected 200, got %d", code)
+	}
+	if info != version.Get() || info.Version == "" || info.GoVersion != runtime.Version() {
+		t.Fatalf("GET /version: unexpected %+v", info)
+	}
+
+	resp, err := proto.NewAdminServiceClient(ts.GRPCClient(t).Conn()).GetVersion(context.Background(), &proto.GetVersionRequest{})
+	if err != nil || resp.Version != info.Version || resp.Commit != info.Commit || resp.BuildTime != info.BuildTime {
+		t.Fatalf("GetVersion: %v, %+v", err, resp)
+	}
+
+	metricsResp, err := http.Get(ts.HTTP.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(metricsResp.Body)
+	metricsResp.Body.Close()
+	if want := fmt.Sprintf(`build_info{build_time=%q,commit=%q,go_version=%q,version=%q} 1`, info.BuildTime, info.Commit, info.GoVersion, info.Version); !strings.Contains(string(body), want) {
+		t.Fatalf("/metrics lacks %s", want)
+	}
+}
+
+func TestGRPCMiddleware(t *testing.T) {
+	ts := NewTestServer(t)
+	alice, token := ts.Signup(t, "Alice", "alice@example.com", "password123")
+	users := ts.GRPC
+
+	// Calls are logged like REST requests, with the caller
+	hook := logtest.NewLocal(logger.Log)
+	if _, err := users.GetUser(WithToken(context.Background(), token), &proto.GetUserRequest{Id: uint32(alice.ID)}); err != nil {
+		t.Fatal(err)
+	}
+	logged := false
+	for _, entry := range hook.AllEntries() {
+		if entry.Data["type"] == "request" && entry.Data["path"] == proto.UserService_GetUser_FullMethodName {
+			logged = entry.Data["user_id"] == fmt.Sprint(alice.ID) && entry.Data["code"] == codes.OK.String() && entry.Data["request_id"] != ""
+		}
+	}
+	if !logged {
+		t.Fatal("gRPC call not logged with its caller, code and request ID")
+	}
+
+	// Rate limit classes apply to gRPC calls as well
+	ts.App.RateLimits = map[string]router.RateLimit{router.RateLimitDefault: {Rate: rate.Every(time.Hour), Burst: 1}}
+	lis, err := listen.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := ts.App.GRPCServer()
+	go func() { _ = grpcServer.Serve(lis) }()
+	defer grpcServer.Stop()
+
+	c, err := client.New(lis.Addr().String(), client.WithToken(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	limited := proto.NewUserServiceClient(c.Conn())
+	if _, err := limited.GetUser(context.Background(), &proto.GetUserRequest{Id: uint32(alice.ID)}); err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	if _, err := limited.GetUser(context.Background(), &proto.GetUserRequest{Id: uint32(alice.ID)}); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("second call: expected RESOURCE_EXHAUSTED, got %v", err)
+	}
+}
+
+func TestGRPCReflection(t *testing.T) {
+	listServices := func(ts *TestServer) ([]string, error) {
+		stream, err := reflectionpb.NewServerReflectionClient(ts.GRPCClient(t).Conn()).ServerReflectionInfo(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		if err := stream.Send(&reflectionpb.ServerReflectionRequest{MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{}}); err != nil {
+			return nil, err
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, service := range resp.GetListServicesResponse().GetService() {
+			names = append(names, service.Name)
+		}
+		return names, nil
+	}
+
+	// The schema isn't published unless asked for
+	if _, err := listServices(NewTestServer(t)); status.Code(err) != codes.Unimplemented {
+		t.Fatalf("reflection by default: expected Unimplemented, got %v", err)
+	}
+
+	names, err := listServices(NewTestServer(t, func(cfg *config.Config) { cfg.API.GRPCReflection = true }))
+	if err != nil || !strings.Contains(strings.Join(names, " "), proto.UserService_ServiceDesc.ServiceName) {
+		t.Fatalf("reflection with GRPC_REFLECTION: %v, %v", names, err)
+	}
+}
+
+func TestSinglePort(t *testing.T) {
+	ts := NewTestServer(t)
+	alice, token := ts.Signup(t, "Alice", "alice@example.com", "password123")
+
+	check := func(t *testing.T, httpClient *http.Client, baseURL, target string, opts ...client.Option) {
+		t.Helper()
+		resp, err := httpClient.Get(baseURL + "/livez")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET /livez: expected 200, got %d", resp.StatusCode)
+		}
+
+		c, err := client.New(target, append(opts, client.WithToken(token))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		user, err := proto.NewUserServiceClient(c.Conn()).GetUser(context.Background(), &proto.GetUserRequest{Id: uint32(alice.ID)})
+		if err != nil || user.GetUser().GetEmail() != "alice@example.com" {
+			t.Fatalf("GetUser on the shared port: %v, %+v", err, user)
+		}
+	}
+
+	t.Run("plaintext", func(t *testing.T) {
+		lis, err := listen.Listen("127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		grpcLis, httpLis, serve := listen.Split(lis)
+		grpcServer := ts.App.GRPCServer()
+		httpServer := &http.Server{Handler: ts.App.Router()}
+		go func() { _ = grpcServer.Serve(grpcLis) }()
+		go func() { _ = httpServer.Serve(httpLis) }()
+		go func() { _ = serve() }()
+		defer func() {
+			grpcServer.Stop()
+			_ = httpServer.Close()
+			_ = lis.Close()
+		}()
+
+		check(t, http.DefaultClient, "http://"+lis.Addr().String(), lis.Addr().String())
+	})
+
+	t.Run("tls", func(t *testing.T) {
+		srv := httptest.NewUnstartedServer(listen.GRPCHandler(ts.App.GRPCServer(), ts.App.Router()))
+		srv.EnableHTTP2 = true
+		srv.StartTLS()
+		defer srv.Close()
+
+		roots := x509.NewCertPool()
+		roots.AddCert(srv.Certificate())
+		check(t, srv.Client(), srv.URL, srv.Listener.Addr().String(),
+			client.WithTLS(&tls.Config{RootCAs: roots, ServerName: "example.com"}))
+	})
+}
+
+func TestGraphQL(t *testing.T) {
+	ts := NewTestServer(t)
+	alice, aliceToken := ts.Signup(t, "Alice", "alice@example.com", "password123")
+	bob, _ := ts.Signup(t, "Bob", "bob@example.com", "password123")
+
+	type gqlError struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	}
+	query := func(token, q string, variables map[string]any) (map[string]any, []gqlError) {
+		t.Helper()
+		var resp struct {
+			Data   map[string]any `json:"data"`
+			Errors []gqlError     `json:"errors"`
+		}
+		if code := ts.Do(t, http.MethodPost, "/graphql", token, map[string]any{"query": q, "variables": variables}, &resp); code != http.StatusOK {
+			t.Fatalf("POST /graphql: expected 200, got %d", code)
+		}
+		return resp.Data, resp.Errors
+	}
+
+	if code := ts.Do(t, http.MethodPost, "/graphql", "", map[string]any{"query": "{ me { id } }"}, nil); code != http.StatusUnauthorized {
+		t.Fatalf("POST /graphql without token: expected 401, got %d", code)
+	}
+
+	// Aliased lookups of the same and different users resolve through one loader
+	data, errs := query(aliceToken, `query($a: ID!, $b: ID!) {
+		me { email }
+		a: user(id: $a) { name }
+		b: user(id: $b) { name }
+		again: user(id: $a) { email }
+		missing: user(id: "999999") { name }
+		users(first: 1) { users { id } nextPageToken totalCount }
+	}`, map[string]any{"a": fmt.Sprint(alice.ID), "b": fmt.Sprint(bob.ID)})
+	if len(errs) > 0 {
+		t.Fatalf("query: unexpected errors %+v", errs)
+	}
+	if data["me"].(map[string]any)["email"] != "alice@example.com" ||
+		data["a"].(map[string]any)["name"] != "Alice" ||
+		data["b"].(map[string]any)["name"] != "Bob" ||
+		data["again"].(map[string]any)["email"] != "alice@example.com" ||
+		data["missing"] != nil {
+		t.Fatalf("query: unexpected data %+v", data)
+	}
+	if page := data["users"].(map[string]any); len(page["users"].([]any)) != 1 || page["nextPageToken"] == "" || page["totalCount"].(float64) < 2 {
+		t.Fatalf("users(first: 1): unexpected page %+v", page)
+	}
+
+	update := `mutation($id: ID!, $version: Int!) {
+		updateUser(id: $id, version: $version, input: {name: "Alice B", email: "alice@example.com", bio: "Hi"}) { name version attributes }
+	}`
+	_, errs = query(aliceToken, update, map[string]any{"id": fmt.Sprint(bob.ID), "version": 1})
+	if len(errs) != 1 || errs[0].Extensions["code"] != "FORBIDDEN" {
+		t.Fatalf("updating another user: expected FORBIDDEN, got %+v", errs)
+	}
+	data, errs = query(aliceToken, update, map[string]any{"id": fmt.Sprint(alice.ID), "version": 1})
+	if len(errs) > 0 {
+		t.Fatalf("updateUser: unexpected errors %+v", errs)
+	}
+	if updated := data["updateUser"].(map[string]any); updated["name"] != "Alice B" || updated["version"] != float64(2) {
+		t.Fatalf("updateUser: unexpected result %+v", updated)
+	}
+	_, errs = query(aliceToken, update, map[string]any{"id": fmt.Sprint(alice.ID), "version": 1})
+	if len(errs) != 1 || errs[0].Extensions["code"] != "CONFLICT" {
+		t.Fatalf("updateUser with stale version: expected CONFLICT, got %+v", errs)
+	}
+
+	_, errs = query(aliceToken, `mutation { updateMe(input: {name: "Alice", email: "alice@example.com", phone: "not a phone"}) { id } }`, nil)
+	if len(errs) != 1 || errs[0].Extensions["code"] != "BAD_USER_INPUT" || errs[0].Extensions["fields"] == nil {
+		t.Fatalf("updateMe with invalid phone: expected BAD_USER_INPUT with fields, got %+v", errs)
+	}
+	_, errs = query(aliceToken, `mutation { updateMe(input: {name: "Alice", email: "not-an-email"}) { id } }`, nil)
+	if len(errs) != 1 || errs[0].Extensions["code"] != "BAD_USER_INPUT" || errs[0].Extensions["fields"] == nil {
+		t.Fatalf("updateMe with invalid email: expected BAD_USER_INPUT with fields, got %+v", errs)
+	}
+}
+
+func TestGraphQLMutationsRespectSessionsAndImpersonation(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.Session.Enabled = true })
+	bob, _ := ts.Signup(t, "Bob", "bob@example.com", "password123")
+	_, admin := ts.AdminAccount(t, "Ada", "ada@example.com")
+	mutate := func(token, q string) []map[string]any {
+		t.Helper()
+		var resp struct {
+			Errors []map[string]any `json:"errors"`
+		}
+		if code := ts.Do(t, http.MethodPost, "/graphql", token, map[string]any{"query": q}, &resp); code != http.StatusOK {
+			t.Fatalf("POST /graphql: expected 200, got %d", code)
+		}
+		return resp.Errors
+	}
+
+	var impersonation struct {
+		Token string `json:"token"`
+	}
+	if code := ts.Do(t, http.MethodPost, fmt.Sprintf("/admin/impersonate/%d", bob.ID), admin, nil, &impersonation); code != http.StatusOK {
+		t.Fatalf("POST /admin/impersonate: status %d", code)
+	}
+	if errs := mutate(impersonation.Token, `{ me { id } }`); len(errs) > 0 {
+		t.Fatalf("query while impersonating: unexpected errors %+v", errs)
+	}
+	for _, q := range []string{
+		`mutation { updateMe(input: {name: "Robert", email: "bob@example.com"}) { id } }`,
+		fmt.Sprintf(`mutation { updateUser(id: "%d", version: 1, input: {name: "Robert", email: "bob@example.com"}) { id } }`, bob.ID),
+		fmt.Sprintf(`mutation { deleteUser(id: "%d") }`, bob.ID),
+	} {
+		errs := mutate(impersonation.Token, q)
+		if len(errs) != 1 || errs[0]["extensions"].(map[string]any)["code"] != "FORBIDDEN" {
+			t.Fatalf("%s while impersonating: expected FORBIDDEN, got %+v", q, errs)
+		}
+	}
+
+	// Deleting an account erases it like DELETE /me, ending its sessions
+	var login struct {
+		Token string `json:"token"`
+	}
+	creds := models.LoginRequest{Email: "bob@example.com", Password: "password123"}
+	if code := ts.Do(t, http.MethodPost, "/login", "", creds, &login); code != http.StatusOK {
+		t.Fatalf("POST /login: status %d", code)
+	}
+	if errs := mutate(login.Token, fmt.Sprintf(`mutation { deleteUser(id: "%d") }`, bob.ID)); len(errs) > 0 {
+		t.Fatalf("deleteUser: unexpected errors %+v", errs)
+	}
+	if sessions, err := ts.App.Sessions.ListByUser(context.Background(), bob.ID); err != nil || len(sessions) != 0 {
+		t.Fatalf("sessions after deleteUser: %v, %d left", err, len(sessions))
+	}
+}
+
+func TestGraphQLPlayground(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.API.GraphQLPlayground = true })
+	if code := ts.Do(t, http.MethodGet, "/graphql/playground", "", nil, nil); code != http.StatusOK {
+		t.Fatalf("GET /graphql/playground: expected 200, got %d", code)
+	}
+
+	off := NewTestServer(t, func(cfg *config.Config) { cfg.API.GraphQLPlayground = false })
+	if code := off.Do(t, http.MethodGet, "/graphql/playground", "", nil, nil); code != http.StatusNotFound {
+		t.Fatalf("GET /graphql/playground when disabled: expected 404, got %d", code)
+	}
+}
+
+func TestAdminUI(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.API.AdminUI = true })
+	get := func(path string) (*http.Response, string) {
+		t.Helper()
+		resp, err := ts.HTTP.Client().Get(ts.HTTP.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, page := get("/admin")
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") || !strings.Contains(page, `src="/admin/app.js"`) {
+		t.Fatalf("GET /admin: %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if csp := resp.Header.Get("Content-Security-Policy"); !strings.Contains(csp, "default-src 'self'") {
+		t.Errorf("unexpected Content-Security-Policy %q", csp)
+	}
+	for path, contentType := range map[string]string{"/admin/app.js": "text/javascript", "/admin/style.css": "text/css"} {
+		if resp, _ := get(path); resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), contentType) {
+			t.Errorf("GET %s: %d %q", path, resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+	}
+
+	// The data behind it still needs an admin token, also on the legacy paths beside it
+	_, userToken := ts.Signup(t, "Alice", "alice@example.com", "password123")
+	if code := ts.Do(t, http.MethodGet, "/admin/slo", userToken, nil, nil); code != http.StatusForbidden {
+		t.Fatalf("GET /admin/slo as user: expected 403, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodGet, "/admin/slo", ts.AdminToken(t), nil, nil); code != http.StatusOK {
+		t.Fatalf("GET /admin/slo as admin: expected 200, got %d", code)
+	}
+
+	off := NewTestServer(t)
+	if code := off.Do(t, http.MethodGet, "/admin", "", nil, nil); code != http.StatusNotFound {
+		t.Fatalf("GET /admin when disabled: expected 404, got %d", code)
+	}
+}
+
+func TestStaticFiles(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"index.html":      "<!DOCTYPE html><title>app</title>",
+		"assets/app.js":   "console.log('app')",
+		".env":            "SECRET=1",
+		"docs/index.html": "<!DOCTYPE html><title>docs</title>",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.Static.Dir = dir; cfg.Static.SPA = true })
+	get := func(path, accept string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.HTTP.URL+path, nil)
+		req.Header.Set("Accept", accept)
+		resp, err := ts.HTTP.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+	const page = "text/html,application/xhtml+xml"
+
+	resp, body := get("/", page)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "<title>app</title>") || resp.Header.Get("Cache-Control") != "no-cache" {
+		t.Fatalf("GET /: %d %q %q", resp.StatusCode, resp.Header.Get("Cache-Control"), body)
+	}
+	if resp, body := get("/assets/app.js", "*/*"); resp.StatusCode != http.StatusOK || body != "console.log('app')" {
+		t.Fatalf("GET /assets/app.js: %d %q", resp.StatusCode, body)
+	}
+	if _, body := get("/docs/", page); !strings.Contains(body, "<title>docs</title>") {
+		t.Fatalf("GET /docs/: expected the directory's index, got %q", body)
+	}
+
+	// Client-side routes get the app; missing files, dotfiles and API paths don't
+	if resp, body := get("/settings/profile", page); resp.StatusCode != http.StatusOK || !strings.Contains(body, "<title>app</title>") {
+		t.Fatalf("GET /settings/profile: expected the SPA index, got %d %q", resp.StatusCode, body)
+	}
+	for path, accept := range map[string]string{
+		"/assets/missing.js": page,
+		"/.env":              page,
+		"/api/v1/missing":    page,
+		"/settings/profile":  "application/json", // not a page request
+	} {
+		resp, body := get(path, accept)
+		if resp.StatusCode != http.StatusNotFound || !strings.Contains(body, `"error"`) {
+			t.Errorf("GET %s (%s): expected a JSON 404, got %d %q", path, accept, resp.StatusCode, body)
+		}
+	}
+
+	// API routes, including the legacy aliases, come first
+	_, token := ts.Signup(t, "Alice", "alice@example.com", "password123")
+	if code := ts.Do(t, http.MethodGet, "/me", token, nil, nil); code != http.StatusOK {
+		t.Fatalf("GET /me: expected 200, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodPost, "/settings/profile", "", nil, nil); code != http.StatusNotFound {
+		t.Fatalf("POST to a client-side route: expected 404, got %d", code)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.Events.StreamHeartbeat = 50 * time.Millisecond })
+	_, userToken := ts.Signup(t, "Alice", "alice@example.com", "password123")
+	if code := ts.Do(t, http.MethodGet, "/api/v1/events", userToken, nil, nil); code != http.StatusForbidden {
+		t.Fatalf("GET /events as user: expected 403, got %d", code)
+	}
+
+	// open starts a stream and returns a function reading its next message,
+	// skipping the retry hint and heartbeats unless wanted
+	open := func(lastEventID string) (func(heartbeats bool) map[string]string, func()) {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.HTTP.URL+"/api/v1/events", nil)
+		req.Header.Set("Authorization", "Bearer "+ts.AdminToken(t))
+		req.Header.Set("Accept", "text/event-stream")
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := ts.HTTP.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("GET /events: status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		lines := bufio.NewScanner(resp.Body)
+		next := func(heartbeats bool) map[string]string {
+			t.Helper()
+			msg := map[string]string{}
+			for lines.Scan() {
+				line := lines.Text()
+				if line == "" {
+					if _, isRetry := msg["retry"]; len(msg) > 0 && !isRetry && (heartbeats || msg[""] == "") {
+						return msg
+					}
+					msg = map[string]string{}
+					continue
+				}
+				field, value, _ := strings.Cut(line, ":")
+				msg[field] = strings.TrimSpace(value)
+			}
+			t.Fatalf("event stream ended: %v", lines.Err())
+			return nil
+		}
+		return next, func() { cancel(); resp.Body.Close() }
+	}
+
+	next, stop := open("")
+	if msg := next(true); msg[""] != "heartbeat" {
+		t.Fatalf("expected a heartbeat on the idle stream, got %v", msg)
+	}
+	bob, _ := ts.Signup(t, "Bob", "bob@example.com", "password123")
+	created := next(false)
+	if created["event"] != "user.created" || !strings.Contains(created["data"], `"email":"bob@example.com"`) || created["id"] == "" {
+		t.Fatalf("expected user.created for bob, got %v", created)
+	}
+	stop()
+
+	// Events published while disconnected are replayed after Last-Event-ID
+	if code := ts.Do(t, http.MethodDelete, fmt.Sprintf("/api/v1/users/%d", bob.ID), ts.AdminToken(t), nil, nil); code != http.StatusOK {
+		t.Fatalf("DELETE bob: expected 200, got %d", code)
+	}
+	next, stop = open(created["id"])
+	defer stop()
+	if deleted := next(false); deleted["event"] != "user.deleted" {
+		t.Fatalf("expected the missed user.deleted to be replayed, got %v", deleted)
+	}
+
+	// A cursor that can't be honored, e.g. from before a restart, resets the client
+	stale, stopStale := open("999999")
+	defer stopStale()
+	if msg := stale(false); msg["event"] != "reset" {
+		t.Fatalf("expected a reset for an unknown Last-Event-ID, got %v", msg)
+	}
+}
+
+func TestTenantHeader(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Database.Tenants = []string{models.DefaultTenant, "acme"}
+	})
+	acme := http.Header{"X-Tenant-ID": {"acme"}}
+	signup := models.SignupRequest{Name: "Alice", Email: "alice@example.com", Password: "password123"}
+
+	var resp struct {
+		Error string      `json:"error"`
+		Code  string      `json:"code"`
+		User  models.User `json:"user"`
+	}
+	if code := ts.DoWithHeaders(t, http.MethodPost, "/signup", "", http.Header{"X-Tenant-ID": {"initech"}}, signup, &resp); code != http.StatusBadRequest || resp.Code != "unknown_tenant" {
+		t.Fatalf("signup in an unknown tenant: status %d, code %q", code, resp.Code)
+	}
+
+	// The same email may sign up once in each tenant
+	ts.Signup(t, "Alice", "alice@example.com", "password123")
+	if code := ts.DoWithHeaders(t, http.MethodPost, "/signup", "", acme, signup, &resp); code != http.StatusCreated || resp.User.TenantID != "acme" {
+		t.Fatalf("signup in acme: status %d, user %+v", code, resp.User)
+	}
+	if code := ts.DoWithHeaders(t, http.MethodPost, "/signup", "", acme, signup, nil); code != http.StatusConflict {
+		t.Fatalf("second signup in acme: expected 409, got %d", code)
+	}
+
+	var login struct {
+		User models.User `json:"user"`
+	}
+	creds := models.LoginRequest{Email: "alice@example.com", Password: "password123"}
+	if code := ts.DoWithHeaders(t, http.MethodPost, "/login", "", acme, creds, &login); code != http.StatusOK || login.User.TenantID != "acme" {
+		t.Fatalf("login in acme: status %d, user %+v", code, login.User)
+	}
+
+	_, err := ts.GRPC.CreateUser(metadata.AppendToOutgoingContext(context.Background(), "x-tenant-id", "initech"),
+		&proto.CreateUserRequest{Name: "Bob", Email: "bob@example.com", Password: "password123"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("gRPC CreateUser in an unknown tenant: expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestBatchGetUsers(t *testing.T) {
+	ts := NewTestServer(t)
+	alice, token := ts.Signup(t, "Alice", "alice@example.com", "password123")
+	bob, _ := ts.Signup(t, "Bob", "bob@example.com", "password123")
+
+	var resp struct {
+		Users      []models.User `json:"users"`
+		MissingIDs []uint        `json:"missing_ids"`
+	}
+	body := map[string]any{"ids": []uint{bob.ID, 999999, alice.ID, bob.ID}}
+	if code := ts.Do(t, http.MethodPost, "/api/v1/users/batch-get", token, body, &resp); code != http.StatusOK {
+		t.Fatalf("POST /users/batch-get: expected 200, got %d", code)
+	}
+	if len(resp.Users) != 2 || resp.Users[0].ID != bob.ID || resp.Users[1].ID != alice.ID {
+		t.Fatalf("expected bob then alice, got %+v", resp.Users)
+	}
+	if len(resp.MissingIDs) != 1 || resp.MissingIDs[0] != 999999 {
+		t.Fatalf("expected 999999 to be missing, got %v", resp.MissingIDs)
+	}
+
+	tooMany := make([]uint, service.MaxBatchIDs+1)
+	for i := range tooMany {
+		tooMany[i] = uint(i + 1)
+	}
+	if code := ts.Do(t, http.MethodPost, "/api/v1/users/batch-get", token, map[string]any{"ids": tooMany}, nil); code != http.StatusBadRequest {
+		t.Fatalf("POST /users/batch-get with too many ids: expected 400, got %d", code)
+	}
+
+	grpcResp, err := ts.GRPC.GetUsersByIDs(WithToken(context.Background(), token), &proto.GetUsersByIDsRequest{Ids: []uint32{uint32(alice.ID), 999999}})
+	if err != nil {
+		t.Fatalf("GetUsersByIDs: %v", err)
+	}
+	if len(grpcResp.Users) != 1 || grpcResp.Users[0].Email != "alice@example.com" || len(grpcResp.MissingIds) != 1 {
+		t.Fatalf("GetUsersByIDs: unexpected response %v", grpcResp)
+	}
+	_, err = ts.GRPC.GetUsersByIDs(WithToken(context.Background(), token), &proto.GetUsersByIDsRequest{Ids: make([]uint32, service.MaxBatchIDs+1)})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("GetUsersByIDs with too many ids: expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestSignupDomainPolicy(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.Signup.DeniedDomains = []string{"configured.test"} })
+	_, userToken := ts.Signup(t, "Alice", "alice@example.com", "password123")
+
+	policy := map[string][]string{"allow": {"Example.com"}, "deny": {"spam.example.com"}}
+	if code := ts.Do(t, http.MethodPut, "/admin/signup-domains", userToken, policy, nil); code != http.StatusForbidden {
+		t.Fatalf("PUT /admin/signup-domains as user: expected 403, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodPut, "/admin/signup-domains", ts.AdminToken(t), policy, nil); code != http.StatusOK {
+		t.Fatalf("PUT /admin/signup-domains: expected 200, got %d", code)
+	}
+
+	var denied struct {
+		Code string `json:"code"`
+	}
+	req := models.SignupRequest{Name: "Bob", Email: "bob@spam.example.com", Password: "password123"}
+	if code := ts.Do(t, http.MethodPost, "/signup", "", req, &denied); code != http.StatusForbidden || denied.Code != "email_domain_not_allowed" {
+		t.Fatalf("signup from a denied domain: status %d, code %q", code, denied.Code)
+	}
+	if _, err := ts.GRPC.CreateUser(context.Background(), &proto.CreateUserRequest{Name: "Carol", Email: "carol@other.com", Password: "password123"}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("CreateUser outside the allow list: expected PermissionDenied, got %v", err)
+	}
+
+	// A restarted server on the same database keeps the stored policy
+	// rather than the configured one
+	restarted := NewTestServerWithRepository(t, ts.App.Repo, func(cfg *config.Config) { cfg.Signup.DeniedDomains = []string{"configured.test"} })
+	var resp struct {
+		Policy struct {
+			Allow []string `json:"allow"`
+			Deny  []string `json:"deny"`
+		} `json:"policy"`
+	}
+	if code := restarted.Do(t, http.MethodGet, "/admin/signup-domains", restarted.AdminToken(t), nil, &resp); code != http.StatusOK {
+		t.Fatalf("GET /admin/signup-domains after restart: expected 200, got %d", code)
+	}
+	if strings.Join(resp.Policy.Allow, ",") != "example.com" || strings.Join(resp.Policy.Deny, ",") != "spam.example.com" {
+		t.Fatalf("GET /admin/signup-domains after restart: %+v", resp.Policy)
+	}
+	if code := restarted.Do(t, http.MethodPost, "/signup", "", req, nil); code != http.StatusForbidden {
+		t.Fatalf("signup from a denied domain after restart: expected 403, got %d", code)
+	}
+	restarted.Signup(t, "Dave", "dave@eu.example.com", "password123")
+}
+
+func TestEmailAvailable(t *testing.T) {
+	available := func(ts *TestServer, email string) bool {
+		t.Helper()
+		var resp struct {
+			Available bool `json:"available"`
+		}
+		if code := ts.Do(t, http.MethodGet, "/api/v1/users/email-available?email="+url.QueryEscape(email), "", nil, &resp); code != http.StatusOK {
+			t.Fatalf("GET /users/email-available: expected 200, got %d", code)
+		}
+		return resp.Available
+	}
+
+	ts := NewTestServer(t)
+	if code := ts.Do(t, http.MethodGet, "/api/v1/users/email-available?email=nope", "", nil, nil); code != http.StatusBadRequest {
+		t.Fatalf("GET /users/email-available with invalid email: expected 400, got %d", code)
+	}
+	if !available(ts, "carol@example.com") {
+		t.Fatal("expected carol@example.com to be available")
+	}
+	// Signing up through the service clears the cached answer
+	ts.Signup(t, "Carol", "carol@example.com", "password123")
+	if available(ts, "Carol@Example.com") {
+		t.Fatal("expected carol@example.com to be taken after signup")
+	}
+
+	// Answers are cached, so a user created behind the service's back only
+	// shows up once the cached answer expires
+	if !available(ts, "dave@example.com") {
+		t.Fatal("expected dave@example.com to be available")
+	}
+	if err := ts.Repo.CreateUser(context.Background(), &models.User{Name: "Dave", Email: "dave@example.com", Password: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if !available(ts, "dave@example.com") {
+		t.Fatal("expected the cached answer for dave@example.com")
+	}
+
+	uncached := NewTestServer(t, func(cfg *config.Config) { cfg.Signup.EmailAvailabilityCacheTTL = 0 })
+	available(uncached, "erin@example.com")
+	if err := uncached.Repo.CreateUser(context.Background(), &models.User{Name: "Erin", Email: "erin@example.com", Password: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if available(uncached, "erin@example.com") {
+		t.Fatal("expected erin@example.com to be taken with caching disabled")
+	}
+}
+
+func TestEmailCheckRateLimit(t *testing.T) {
+	ts := NewTestServer(t)
+	ts.App.RateLimits = map[string]router.RateLimit{router.RateLimitLookup: {Rate: rate.Every(time.Hour), Burst: 2}}
+	srv := httptest.NewServer(ts.App.Router())
+	defer srv.Close()
+
+	check := func(path string) int {
+		t.Helper()
+		resp, err := srv.Client().Get(srv.URL + path + "?email=alice@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	// Both paths and API versions draw on the client's lookup budget
+	for _, path := range []string{"/api/v1/signup/check-email", "/users/email-available"} {
+		if code := check(path); code != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d", path, code)
+		}
+	}
+	if code := check("/api/v1/users/email-available"); code != http.StatusTooManyRequests {
+		t.Fatalf("GET /api/v1/users/email-available over the limit: expected 429, got %d", code)
+	}
+}
+
+func TestAccountStatus(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.Session.Enabled = true })
+	bob, _ := ts.Signup(t, "Bob", "bob@example.com", "password123")
+	carol, _ := ts.Signup(t, "Carol", "carol@example.com", "password123")
+	admin := ts.AdminToken(t)
+	if bob.Status != models.StatusActive {
+		t.Fatalf("new user status: %q", bob.Status)
+	}
+
+	var login struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+		Code         string `json:"code"`
+	}
+	creds := models.LoginRequest{Email: "bob@example.com", Password: "password123"}
+	if code := ts.Do(t, http.MethodPost, "/login", "", creds, &login); code != http.StatusOK {
+		t.Fatalf("POST /login: status %d", code)
+	}
+
+	var suspended userResponse
+	if code := ts.Do(t, http.MethodPost, fmt.Sprintf("/admin/users/%d/suspend", bob.ID), admin, nil, &suspended); code != http.StatusOK || suspended.User.Status != models.StatusSuspended {
+		t.Fatalf("POST suspend: status %d, user %+v", code, suspended.User)
+	}
+	if code := ts.Do(t, http.MethodGet, "/me", login.Token, nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("GET /me after suspension: expected 401, got %d", code)
+	}
+	refresh := models.RefreshTokenRequest{RefreshToken: login.RefreshToken}
+	if code := ts.Do(t, http.MethodPost, "/token/refresh", "", refresh, nil); code != http.StatusUnauthorized {
+		t.Fatalf("POST /token/refresh after suspension: expected 401, got %d", code)
+	}
+	login.Code = ""
+	if code := ts.Do(t, http.MethodPost, "/login", "", creds, &login); code != http.StatusForbidden || login.Code != "account_suspended" {
+		t.Fatalf("login while suspended: status %d, code %q", code, login.Code)
+	}
+	// A wrong password still gets the generic answer
+	wrong := models.LoginRequest{Email: "bob@example.com", Password: "wrong-password"}
+	if code := ts.Do(t, http.MethodPost, "/login", "", wrong, nil); code != http.StatusUnauthorized {
+		t.Fatalf("wrong password while suspended: expected 401, got %d", code)
+	}
+
+	var page struct {
+		Users []models.User `json:"users"`
+	}
+	if code := ts.Do(t, http.MethodGet, "/users?status=suspended", admin, nil, &page); code != http.StatusOK || len(page.Users) != 1 || page.Users[0].ID != bob.ID {
+		t.Fatalf("GET /users?status=suspended: status %d, users %+v", code, page.Users)
+	}
+	if code := ts.Do(t, http.MethodGet, "/users?status=banned", admin, nil, nil); code != http.StatusBadRequest {
+		t.Fatalf("GET /users with unknown status: expected 400, got %d", code)
+	}
+	list, err := ts.GRPC.ListUsers(WithToken(context.Background(), admin), &proto.ListUsersRequest{Filter: `status = "suspended"`})
+	if err != nil || len(list.Users) != 1 || list.Users[0].Id != uint32(bob.ID) || list.Users[0].Status != models.StatusSuspended {
+		t.Fatalf("gRPC ListUsers by status: %v, %v", list, err)
+	}
+
+	if code := ts.Do(t, http.MethodPost, fmt.Sprintf("/admin/users/%d/reactivate", bob.ID), admin, nil, nil); code != http.StatusOK {
+		t.Fatalf("POST reactivate: expected 200, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodPost, "/login", "", creds, nil); code != http.StatusOK {
+		t.Fatalf("login after reactivation: expected 200, got %d", code)
+	}
+
+	// Deactivation is self-service and keeps the record
+	carolLogin := models.LoginRequest{Email: "carol@example.com", Password: "password123"}
+	var carolTokens struct {
+		Token string `json:"token"`
+	}
+	ts.Do(t, http.MethodPost, "/login", "", carolLogin, &carolTokens)
+	if code := ts.Do(t, http.MethodPost, "/me/deactivate", carolTokens.Token, nil, nil); code != http.StatusOK {
+		t.Fatalf("POST /me/deactivate: expected 200, got %d", code)
+	}
+	login.Code = ""
+	if code := ts.Do(t, http.MethodPost, "/login", "", carolLogin, &login); code != http.StatusForbidden || login.Code != "account_deactivated" {
+		t.Fatalf("login while deactivated: status %d, code %q", code, login.Code)
+	}
+	var got userResponse
+	if code := ts.Do(t, http.MethodGet, fmt.Sprintf("/users/%d", carol.ID), admin, nil, &got); code != http.StatusOK || got.User.Status != models.StatusDeactivated {
+		t.Fatalf("GET deactivated user: status %d, user %+v", code, got.User)
+	}
+
+	if code := ts.Do(t, http.MethodPost, "/admin/users/1073741824/suspend", admin, nil, nil); code != http.StatusBadRequest {
+		t.Fatalf("suspend self: expected 400, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodPost, "/admin/users/999999/suspend", admin, nil, nil); code != http.StatusNotFound {
+		t.Fatalf("suspend missing user: expected 404, got %d", code)
+	}
+}
+
+func TestAccountStatusWithoutSessions(t *testing.T) {
+	ts := NewTestServer(t)
+	dave, token := ts.Signup(t, "Dave", "dave@example.com", "password123")
+	_, erinToken := ts.Signup(t, "Erin", "erin@example.com", "password123")
+	admin := ts.AdminToken(t)
+	daveGRPC := WithToken(context.Background(), token)
+	if _, err := ts.GRPC.GetUser(daveGRPC, &proto.GetUserRequest{Id: uint32(dave.ID)}); err != nil {
+		t.Fatalf("gRPC GetUser before suspension: %v", err)
+	}
+
+	// With no sessions to revoke, the account status is checked on each token
+	if code := ts.Do(t, http.MethodPost, fmt.Sprintf("/admin/users/%d/suspend", dave.ID), admin, nil, nil); code != http.StatusOK {
+		t.Fatalf("POST suspend: status %d", code)
+	}
+	if code := ts.Do(t, http.MethodGet, "/me", token, nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("GET /me after suspension: expected 401, got %d", code)
+	}
+	if _, err := ts.GRPC.GetUser(daveGRPC, &proto.GetUserRequest{Id: uint32(dave.ID)}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("gRPC GetUser after suspension: expected Unauthenticated, got %v", err)
+	}
+
+	if code := ts.Do(t, http.MethodPost, fmt.Sprintf("/admin/users/%d/reactivate", dave.ID), admin, nil, nil); code != http.StatusOK {
+		t.Fatalf("POST reactivate: status %d", code)
+	}
+	if code := ts.Do(t, http.MethodGet, "/me", token, nil, nil); code != http.StatusOK {
+		t.Fatalf("GET /me after reactivation: expected 200, got %d", code)
+	}
+
+	if code := ts.Do(t, http.MethodPost, "/me/deactivate", erinToken, nil, nil); code != http.StatusOK {
+		t.Fatalf("POST /me/deactivate: status %d", code)
+	}
+	if code := ts.Do(t, http.MethodGet, "/me", erinToken, nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("GET /me after deactivation: expected 401, got %d", code)
+	}
+}
+
+func TestDataExportAndErasure(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.Session.Enabled = true })
+	ctx := context.Background()
+	ivan, _ := ts.Signup(t, "Ivan", "ivan@example.com", "password123")
+	admin := ts.AdminToken(t)
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	if code := ts.Do(t, http.MethodPost, "/login", "", models.LoginRequest{Email: "ivan@example.com", Password: "password123"}, &login); code != http.StatusOK {
+		t.Fatalf("POST /login: status %d", code)
+	}
+	if code := ts.Do(t, http.MethodPut, "/me", login.Token, models.RestUpdateUserRequest{Name: "Ivan Petrov", Email: "ivan@example.com"}, nil); code != http.StatusOK {
+		t.Fatalf("PUT /me: status %d", code)
+	}
+	open := models.OpenRecoveryCaseRequest{UserID: ivan.ID, Reason: "lost mailbox", Verification: "passport checked"}
+	if code := ts.Do(t, http.MethodPost, "/admin/recovery-cases", admin, open, nil); code != http.StatusCreated {
+		t.Fatalf("open recovery case: status %d", code)
+	}
+
+	if code := ts.Do(t, http.MethodGet, "/me/export", login.Token, nil, nil); code != http.StatusNotFound {
+		t.Fatalf("GET /me/export before requesting: expected 404, got %d", code)
+	}
+	var started struct {
+		Export models.DataExport `json:"export"`
+	}
+	if code := ts.Do(t, http.MethodPost, "/me/export", login.Token, nil, &started); code != http.StatusAccepted || started.Export.Status != models.ExportPending {
+		t.Fatalf("POST /me/export: status %d, export %+v", code, started.Export)
+	}
+	ts.App.Privacy.Wait()
+
+	var status struct {
+		Export      models.DataExport `json:"export"`
+		DownloadURL string            `json:"download_url"`
+	}
+	if code := ts.Do(t, http.MethodGet, "/me/export", login.Token, nil, &status); code != http.StatusOK || status.Export.Status != models.ExportCompleted || status.DownloadURL == "" {
+		t.Fatalf("GET /me/export: status %d, %+v", code, status)
+	}
+	resp, err := ts.HTTP.Client().Get(ts.HTTP.URL + status.DownloadURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archive privacy.Archive
+	err = json.NewDecoder(resp.Body).Decode(&archive)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("download archive: status %d, %v", resp.StatusCode, err)
+	}
+	// Signup and login each started a session
+	if archive.User.Email != "ivan@example.com" || len(archive.History) != 2 || len(archive.RecoveryCases) != 1 || len(archive.Sessions) != 2 {
+		t.Fatalf("archive: user %+v, %d history, %d recovery cases, %d sessions", archive.User, len(archive.History), len(archive.RecoveryCases), len(archive.Sessions))
+	}
+
+	if code := ts.Do(t, http.MethodDelete, "/me", login.Token, nil, nil); code != http.StatusOK {
+		t.Fatalf("DELETE /me: expected 200, got %d", code)
+	}
+	history, err := ts.Repo.GetUserHistory(ctx, ivan.ID)
+	if err != nil || len(history) != 2 {
+		t.Fatalf("history after erasure: %v, %v", history, err)
+	}
+	for _, h := range history {
+		if h.Name != models.Erased || h.Email != models.Erased || h.ValidTo == nil {
+			t.Fatalf("history snapshot not anonymized: %+v", h)
+		}
+	}
+	cases, err := ts.Repo.ListRecoveryCasesByUser(ctx, ivan.ID)
+	if err != nil || len(cases) != 1 || cases[0].Reason != models.Erased || cases[0].Verification != models.Erased {
+		t.Fatalf("recovery cases after erasure: %+v, %v", cases, err)
+	}
+	if exports, _ := ts.Repo.ListDataExports(ctx, ivan.ID); len(exports) != 0 {
+		t.Fatalf("exports after erasure: %+v", exports)
+	}
+	if _, _, err := ts.App.Objects.Get(ctx, status.Export.ObjectKey); err == nil {
+		t.Fatal("export archive still stored after erasure")
+	}
+	if code := ts.Do(t, http.MethodGet, "/me", login.Token, nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("GET /me after erasure: expected 401, got %d", code)
+	}
+}
+
+func TestDeleteUserErases(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.Session.Enabled = true })
+	ctx := context.Background()
+
+	// Through REST and gRPC, deleting one's own account by ID erases it like DELETE /me
+	deletions := map[string]func(user *models.User, token string) error{
+		"REST": func(user *models.User, token string) error {
+			if code := ts.Do(t, http.MethodDelete, fmt.Sprintf("/api/v1/users/%d", user.ID), token, nil, nil); code != http.StatusOK {
+				return fmt.Errorf("DELETE /users/%d: status %d", user.ID, code)
+			}
+			return nil
+		},
+		"gRPC": func(user *models.User, token string) error {
+			_, err := ts.GRPC.DeleteUser(WithToken(ctx, token), &proto.DeleteUserRequest{Id: uint32(user.ID)})
+			return err
+		},
+	}
+	for transport, deleteUser := range deletions {
+		email := strings.ToLower(transport) + "@example.com"
+		user, _ := ts.Signup(t, "Kate", email, "password123")
+		var login struct {
+			Token        string `json:"token"`
+			RefreshToken string `json:"refresh_token"`
+		}
+		if code := ts.Do(t, http.MethodPost, "/login", "", models.LoginRequest{Email: email, Password: "password123"}, &login); code != http.StatusOK {
+			t.Fatalf("%s: POST /login: status %d", transport, code)
+		}
+
+		// A dry run changes nothing
+		if code := ts.Do(t, http.MethodDelete, fmt.Sprintf("/api/v1/users/%d?dry_run=true", user.ID), login.Token, nil, nil); code != http.StatusOK {
+			t.Fatalf("%s: dry run: status %d", transport, code)
+		}
+		if sessions, err := ts.App.Sessions.ListByUser(ctx, user.ID); err != nil || len(sessions) != 2 {
+			t.Fatalf("%s: sessions after dry run: %d, %v", transport, len(sessions), err)
+		}
+
+		if err := deleteUser(user, login.Token); err != nil {
+			t.Fatalf("%s: %v", transport, err)
+		}
+		history, err := ts.Repo.GetUserHistory(ctx, user.ID)
+		if err != nil || len(history) == 0 {
+			t.Fatalf("%s: history after erasure: %v, %v", transport, history, err)
+		}
+		for _, h := range history {
+			if h.Name != models.Erased || h.Email != models.Erased {
+				t.Fatalf("%s: history snapshot not anonymized: %+v", transport, h)
+			}
+		}
+		if sessions, err := ts.App.Sessions.ListByUser(ctx, user.ID); err != nil || len(sessions) != 0 {
+			t.Fatalf("%s: sessions after erasure: %d, %v", transport, len(sessions), err)
+		}
+		refresh := models.RefreshTokenRequest{RefreshToken: login.RefreshToken}
+		if code := ts.Do(t, http.MethodPost, "/token/refresh", "", refresh, nil); code != http.StatusUnauthorized {
+			t.Fatalf("%s: POST /token/refresh after erasure: expected 401, got %d", transport, code)
+		}
+	}
+}
+
+func TestTermsConsent(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.Consent.TermsVersion = "v1" })
+	ctx := context.Background()
+	judy, token := ts.Signup(t, "Judy", "judy@example.com", "password123")
+	update := models.RestUpdateUserRequest{Name: "Judy Hopps", Email: "judy@example.com"}
+
+	var refused struct {
+		Code         string `json:"code"`
+		TermsVersion string `json:"terms_version"`
+	}
+	if code := ts.Do(t, http.MethodPut, "/me", token, update, &refused); code != http.StatusUnavailableForLegalReasons || refused.Code != "terms_not_accepted" || refused.TermsVersion != "v1" {
+		t.Fatalf("PUT /me before accepting: status %d, %+v", code, refused)
+	}
+	var me struct {
+		Consents     []models.Consent `json:"consents"`
+		TermsVersion string           `json:"terms_version"`
+	}
+	if code := ts.Do(t, http.MethodGet, "/me", token, nil, &me); code != http.StatusOK || len(me.Consents) != 0 || me.TermsVersion != "v1" {
+		t.Fatalf("GET /me before accepting: status %d, %+v", code, me)
+	}
+
+	if code := ts.Do(t, http.MethodPost, "/me/consents", token, models.AcceptConsentRequest{Version: "v0"}, nil); code != http.StatusConflict {
+		t.Fatalf("accept stale version: expected 409, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodPost, "/me/consents", token, models.AcceptConsentRequest{Version: "v1"}, nil); code != http.StatusCreated {
+		t.Fatalf("accept current version: expected 201, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodPut, "/me", token, update, nil); code != http.StatusOK {
+		t.Fatalf("PUT /me after accepting: expected 200, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodGet, "/me", token, nil, &me); code != http.StatusOK || len(me.Consents) != 1 || me.Consents[0].Version != "v1" || me.Consents[0].AcceptedAt.IsZero() {
+		t.Fatalf("GET /me after accepting: status %d, %+v", code, me)
+	}
+
+	// Accepting on signup lets a new user in straight away
+	var signup struct {
+		Token string `json:"token"`
+	}
+	req := models.SignupRequest{Name: "Nick", Email: "nick@example.com", Password: "password123", TermsVersion: "v0"}
+	if code := ts.Do(t, http.MethodPost, "/signup", "", req, nil); code != http.StatusConflict {
+		t.Fatalf("signup with stale terms: expected 409, got %d", code)
+	}
+	req.TermsVersion = "v1"
+	if code := ts.Do(t, http.MethodPost, "/signup", "", req, &signup); code != http.StatusCreated {
+		t.Fatalf("signup accepting terms: status %d", code)
+	}
+	if code := ts.Do(t, http.MethodPut, "/me", signup.Token, models.RestUpdateUserRequest{Name: "Nick Wilde", Email: "nick@example.com"}, nil); code != http.StatusOK {
+		t.Fatalf("PUT /me after signup accepting terms: expected 200, got %d", code)
+	}
+
+	// A new version of the terms requires accepting again
+	next := consent.NewService(ts.Repo, ts.App.Cache, "v2")
+	if accepted, err := next.HasAccepted(ctx, judy.ID); err != nil || accepted {
+		t.Fatalf("accepted v2 after only accepting v1: %v, %v", accepted, err)
+	}
+}
+
+func TestUserPreferences(t *testing.T) {
+	ts := NewTestServer(t)
+	_, token := ts.Signup(t, "Kim", "kim@example.com", "password123")
+
+	var got struct {
+		Preferences models.Preferences `json:"preferences"`
+	}
+	if code := ts.Do(t, http.MethodGet, "/me/preferences", token, nil, &got); code != http.StatusOK || got.Preferences["theme"] != "system" || got.Preferences["page_size"] != float64(20) {
+		t.Fatalf("GET /me/preferences: status %d, %v", code, got.Preferences)
+	}
+
+	patch := models.Preferences{"theme": "dark", "timezone": "Europe/Paris", "page_size": float64(50)}
+	if code := ts.Do(t, http.MethodPut, "/me/preferences", token, patch, &got); code != http.StatusOK || got.Preferences["theme"] != "dark" || got.Preferences["language"] != "en" {
+		t.Fatalf("PUT /me/preferences: status %d, %v", code, got.Preferences)
+	}
+	// A partial update keeps the other keys, and null resets one to its default
+	if code := ts.Do(t, http.MethodPut, "/me/preferences", token, models.Preferences{"language": "fr", "page_size": nil}, &got); code != http.StatusOK {
+		t.Fatalf("PUT /me/preferences: status %d", code)
+	}
+	if got.Preferences["theme"] != "dark" || got.Preferences["timezone"] != "Europe/Paris" || got.Preferences["language"] != "fr" || got.Preferences["page_size"] != float64(20) {
+		t.Fatalf("after partial update: %v", got.Preferences)
+	}
+
+	for name, invalid := range map[string]models.Preferences{
+		"unknown key":      {"font": "serif"},
+		"disallowed value": {"theme": "neon"},
+		"wrong type":       {"email_notifications": "yes"},
+		"out of range":     {"page_size": float64(1000)},
+		"bad time zone":    {"timezone": "Mars/Olympus"},
+	} {
+		// The valid key alongside must not be saved either
+		invalid["language"] = "de"
+		if code := ts.Do(t, http.MethodPut, "/me/preferences", token, invalid, nil); code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", name, code)
+		}
+	}
+	if code := ts.Do(t, http.MethodGet, "/me/preferences", token, nil, &got); code != http.StatusOK || got.Preferences["language"] != "fr" {
+		t.Fatalf("after invalid updates: status %d, %v", code, got.Preferences)
+	}
+
+	var defs struct {
+		Definitions []preferences.Definition `json:"definitions"`
+	}
+	if code := ts.Do(t, http.MethodGet, "/me/preferences/definitions", token, nil, &defs); code != http.StatusOK || len(defs.Definitions) != len(preferences.Builtin) {
+		t.Fatalf("GET /me/preferences/definitions: status %d, %+v", code, defs.Definitions)
+	}
+}
+
+func TestInvitations(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *config.Config) { cfg.Invitations.TTL = time.Hour })
+	ctx := context.Background()
+	admin := ts.AdminToken(t)
+
+	var created struct {
+		Invitation models.Invitation `json:"invitation"`
+	}
+	req := models.CreateInvitationRequest{Name: "Liam", Email: "liam@example.com", Role: models.RoleAdmin}
+	if code := ts.Do(t, http.MethodPost, "/admin/invitations", admin, req, &created); code != http.StatusCreated || created.Invitation.Status != models.InvitationPending {
+		t.Fatalf("POST /admin/invitations: status %d, %+v", code, created.Invitation)
+	}
+	if code := ts.Do(t, http.MethodPost, "/admin/invitations", admin, req, nil); code != http.StatusConflict {
+		t.Fatalf("inviting the same email twice: expected 409, got %d", code)
+	}
+	invited, err := ts.Repo.FindUserByID(ctx, created.Invitation.UserID)
+	if err != nil || invited.Status != models.StatusInvited || invited.Role != models.RoleAdmin {
+		t.Fatalf("invited user: %+v, %v", invited, err)
+	}
+
+	// Resending replaces the emailed token, so take the one it returns
+	_, stale, err := ts.App.Invites.Resend(ctx, created.Invitation.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resent struct {
+		Invitation models.Invitation `json:"invitation"`
+	}
+	if code := ts.Do(t, http.MethodPost, fmt.Sprintf("/admin/invitations/%d/resend", created.Invitation.ID), admin, nil, &resent); code != http.StatusOK || resent.Invitation.SentCount != 3 {
+		t.Fatalf("resend: status %d, %+v", code, resent.Invitation)
+	}
+	_, token, err := ts.App.Invites.Resend(ctx, created.Invitation.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accept := models.AcceptInvitationRequest{Password: "password123", Name: "Liam Neeson"}
+	if code := ts.Do(t, http.MethodPost, "/invitations/"+stale+"/accept", "", accept, nil); code != http.StatusUnauthorized {
+		t.Fatalf("accept with replaced token: expected 401, got %d", code)
+	}
+
+	var accepted struct {
+		User  models.User `json:"user"`
+		Token string      `json:"token"`
+	}
+	if code := ts.Do(t, http.MethodPost, "/invitations/"+token+"/accept", "", accept, &accepted); code != http.StatusOK || accepted.User.Status != models.StatusActive || accepted.User.Name != "Liam Neeson" || accepted.Token == "" {
+		t.Fatalf("accept: status %d, %+v", code, accepted.User)
+	}
+	if code := ts.Do(t, http.MethodPost, "/invitations/"+token+"/accept", "", accept, nil); code != http.StatusUnauthorized {
+		t.Fatalf("accept twice: expected 401, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodPost, "/login", "", models.LoginRequest{Email: "liam@example.com", Password: "password123"}, nil); code != http.StatusOK {
+		t.Fatalf("login after accepting: status %d", code)
+	}
+	if code := ts.Do(t, http.MethodPost, fmt.Sprintf("/admin/invitations/%d/resend", created.Invitation.ID), admin, nil, nil); code != http.StatusConflict {
+		t.Fatalf("resend accepted invitation: expected 409, got %d", code)
+	}
+
+	// An invitation past its expiry is reported as expired and can't be accepted
+	expiring, token, err := ts.App.Invites.Invite(ctx, 1, models.CreateInvitationRequest{Name: "Mia", Email: "mia@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiring.ExpiresAt = time.Now().Add(-time.Minute)
+	if err := ts.Repo.UpdateInvitation(ctx, expiring); err != nil {
+		t.Fatal(err)
+	}
+	var list struct {
+		Invitations []models.Invitation `json:"invitations"`
+	}
+	if code := ts.Do(t, http.MethodGet, "/admin/invitations?status=expired", admin, nil, &list); code != http.StatusOK || len(list.Invitations) != 1 || list.Invitations[0].ID != expiring.ID {
+		t.Fatalf("GET /admin/invitations?status=expired: status %d, %+v", code, list.Invitations)
+	}
+	if code := ts.Do(t, http.MethodPost, "/invitations/"+token+"/accept", "", accept, nil); code != http.StatusUnauthorized {
+		t.Fatalf("accept expired invitation: expected 401, got %d", code)
+	}
+}
+
+func TestOrganizations(t *testing.T) {
+	ts := NewTestServer(t)
+	ctx := context.Background()
+	owner, ownerToken := ts.Signup(t, "Nora", "nora@example.com", "password123")
+	member, memberToken := ts.Signup(t, "Oscar", "oscar@example.com", "password123")
+	outsider, outsiderToken := ts.Signup(t, "Piper", "piper@example.com", "password123")
+
+	var created struct {
+		Organization models.Organization `json:"organization"`
+	}
+	if code := ts.Do(t, http.MethodPost, "/orgs", ownerToken, models.CreateOrganizationRequest{Name: "Acme"}, &created); code != http.StatusCreated || created.Organization.Role != models.OrgRoleOwner {
+		t.Fatalf("POST /orgs: status %d, %+v", code, created.Organization)
+	}
+	org := fmt.Sprintf("/orgs/%d", created.Organization.ID)
+
+	// Outsiders can't tell the organization exists
+	if code := ts.Do(t, http.MethodGet, org+"/members", outsiderToken, nil, nil); code != http.StatusNotFound {
+		t.Fatalf("outsider listing members: expected 404, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodPost, org+"/members", ownerToken, models.AddMemberRequest{UserID: member.ID}, nil); code != http.StatusCreated {
+		t.Fatalf("add member: status %d", code)
+	}
+	if code := ts.Do(t, http.MethodPost, org+"/members", ownerToken, models.AddMemberRequest{UserID: member.ID}, nil); code != http.StatusConflict {
+		t.Fatalf("add member twice: expected 409, got %d", code)
+	}
+
+	var members struct {
+		Members []models.Membership `json:"members"`
+	}
+	if code := ts.Do(t, http.MethodGet, org+"/members", memberToken, nil, &members); code != http.StatusOK || len(members.Members) != 2 {
+		t.Fatalf("member listing members: status %d, %+v", code, members.Members)
+	}
+	if code := ts.Do(t, http.MethodPost, org+"/members", memberToken, models.AddMemberRequest{UserID: outsider.ID}, nil); code != http.StatusForbidden {
+		t.Fatalf("member adding a member: expected 403, got %d", code)
+	}
+	var orgs struct {
+		Organizations []models.Organization `json:"organizations"`
+	}
+	if code := ts.Do(t, http.MethodGet, "/orgs", memberToken, nil, &orgs); code != http.StatusOK || len(orgs.Organizations) != 1 || orgs.Organizations[0].Role != models.OrgRoleMember {
+		t.Fatalf("GET /orgs: status %d, %+v", code, orgs.Organizations)
+	}
+	demote := models.UpdateMemberRequest{Role: models.OrgRoleMember}
+	if code := ts.Do(t, http.MethodPut, fmt.Sprintf("%s/members/%d", org, owner.ID), ownerToken, demote, nil); code != http.StatusConflict {
+		t.Fatalf("demoting the last owner: expected 409, got %d", code)
+	}
+
+	// Admins manage any organization of their own tenant only
+	if code := ts.Do(t, http.MethodGet, org, ts.AdminToken(t), nil, nil); code != http.StatusOK {
+		t.Fatalf("admin reading the organization: status %d", code)
+	}
+	foreignAdmin := ts.Token(t, auth.Identity{UserID: 1<<30 + 2, Role: models.RoleAdmin, TenantID: "acme"})
+	if code := ts.Do(t, http.MethodGet, org, foreignAdmin, nil, nil); code != http.StatusNotFound {
+		t.Fatalf("admin of another tenant reading the organization: expected 404, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodPut, org, foreignAdmin, models.UpdateOrganizationRequest{Name: "Taken"}, nil); code != http.StatusNotFound {
+		t.Fatalf("admin of another tenant renaming the organization: expected 404, got %d", code)
+	}
+
+	// The same rules apply over gRPC
+	orgsClient := ts.GRPCClient(t).Organizations
+	orgID := uint32(created.Organization.ID)
+	if _, err := orgsClient.DeleteOrganization(WithToken(ctx, foreignAdmin), &proto.DeleteOrganizationRequest{Id: orgID}); status.Code(err) != codes.NotFound {
+		t.Fatalf("gRPC admin of another tenant deleting: expected NotFound, got %v", err)
+	}
+	if _, err := orgsClient.ListMembers(WithToken(ctx, outsiderToken), &proto.ListMembersRequest{OrgId: orgID}); status.Code(err) != codes.NotFound {
+		t.Fatalf("gRPC outsider listing members: expected NotFound, got %v", err)
+	}
+	if _, err := orgsClient.UpdateOrganization(WithToken(ctx, memberToken), &proto.UpdateOrganizationRequest{Id: orgID, Name: "Mine"}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("gRPC member renaming: expected PermissionDenied, got %v", err)
+	}
+	promoted, err := orgsClient.UpdateMember(WithToken(ctx, ownerToken), &proto.UpdateMemberRequest{OrgId: orgID, UserId: uint32(member.ID), Role: models.OrgRoleOwner})
+	if err != nil || promoted.Member.Role != models.OrgRoleOwner {
+		t.Fatalf("gRPC promote: %+v, %v", promoted, err)
+	}
+	listed, err := orgsClient.ListMembers(WithToken(ctx, memberToken), &proto.ListMembersRequest{OrgId: orgID})
+	if err != nil || len(listed.Members) != 2 || listed.Members[0].User == nil {
+		t.Fatalf("gRPC list members: %+v, %v", listed, err)
+	}
+
+	// With a second owner the first can leave
+	if code := ts.Do(t, http.MethodDelete, fmt.Sprintf("%s/members/%d", org, owner.ID), ownerToken, nil, nil); code != http.StatusOK {
+		t.Fatalf("owner leaving: status %d", code)
+	}
+	if code := ts.Do(t, http.MethodGet, org, ownerToken, nil, nil); code != http.StatusNotFound {
+		t.Fatalf("former owner: expected 404, got %d", code)
+	}
+	if _, err := orgsClient.DeleteOrganization(WithToken(ctx, memberToken), &proto.DeleteOrganizationRequest{Id: orgID}); err != nil {
+		t.Fatalf("gRPC delete: %v", err)
+	}
+	if code := ts.Do(t, http.MethodGet, org, ts.AdminToken(t), nil, nil); code != http.StatusNotFound {
+		t.Fatalf("deleted organization: expected 404, got %d", code)
+	}
+}
+
+func TestLocalizedErrors(t *testing.T) {
+	ts := NewTestServer(t)
+	admin := ts.AdminToken(t)
+	spanish := http.Header{"Accept-Language": []string{"es-ES,es;q=0.9,en;q=0.5"}}
+
+	var resp struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}
+	if code := ts.DoWithHeaders(t, http.MethodGet, "/users/999999", admin, spanish, nil, &resp); code != http.StatusNotFound || resp.Error != "Usuario no encontrado" {
+		t.Fatalf("GET /users/999999 in Spanish: status %d, %+v", code, resp)
+	}
+	resp.Error = ""
+	if code := ts.DoWithHeaders(t, http.MethodPost, "/signup", "", spanish, models.SignupRequest{Name: "Quinn"}, &resp); code != http.StatusBadRequest || resp.Error != "La validación ha fallado" || resp.Code != "validation_failed" {
+		t.Fatalf("invalid signup in Spanish: status %d, %+v", code, resp)
+	}
+	resp.Error = ""
+	if code := ts.DoWithHeaders(t, http.MethodGet, "/users/999999", admin, http.Header{"Accept-Language": []string{"de"}}, nil, &resp); code != http.StatusNotFound || resp.Error != "User not found" {
+		t.Fatalf("unsupported language falls back to English: status %d, %+v", code, resp)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.HTTP.URL+"/users/999999", nil)
+	req.Header.Set("Authorization", "Bearer "+admin)
+	req.Header.Set("Accept-Language", "es")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if got := res.Header.Get("Content-Language"); got != "es" {
+		t.Fatalf("Content-Language: got %q", got)
+	}
+
+	// gRPC keeps the English message and adds the reason and a translation as details
+	user, _ := ts.Signup(t, "Quinn", "quinn@example.com", "password123")
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "accept-language", "es")
+	_, err = ts.GRPC.CreateUser(ctx, &proto.CreateUserRequest{Name: "Quinn", Email: user.Email, Password: "password123"})
+	st := status.Convert(err)
+	if st.Code() != codes.AlreadyExists || st.Message() != "email already exists" {
+		t.Fatalf("duplicate CreateUser: %v", err)
+	}
+	var info *errdetails.ErrorInfo
+	var localized *errdetails.LocalizedMessage
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			info = d
+		case *errdetails.LocalizedMessage:
+			localized = d
+		}
+	}
+	if info == nil || info.Reason != grpcserver.ReasonEmailTaken || info.Domain != grpcserver.ErrorDomain || info.Metadata["email"] != user.Email {
+		t.Fatalf("ErrorInfo detail: %+v", info)
+	}
+	if localized == nil || localized.Locale != "es" || localized.Message != "el correo electrónico ya existe" {
+		t.Fatalf("LocalizedMessage detail: %+v", localized)
+	}
+}
+
+func TestLocalizedResponses(t *testing.T) {
+	ts := NewTestServer(t)
+	_, token := ts.Signup(t, "Rosa", "rosa@example.com", "password123")
+
+	// Validation messages are translated field by field
+	var invalid struct {
+		Error  string                  `json:"error"`
+		Fields []validation.FieldError `json:"fields"`
+	}
+	french := http.Header{"Accept-Language": []string{"fr"}}
+	if code := ts.DoWithHeaders(t, http.MethodPost, "/signup", "", french, models.SignupRequest{Name: "Rosa", Email: "not-an-email", Password: "password123"}, &invalid); code != http.StatusBadRequest {
+		t.Fatalf("invalid signup: status %d", code)
+	}
+	if invalid.Error != "La validation a échoué" || len(invalid.Fields) != 1 || invalid.Fields[0].Message != "email doit être une adresse e-mail valide" || invalid.Fields[0].Rule != "email" {
+		t.Fatalf("invalid signup in French: %+v", invalid)
+	}
+
+	// So are success messages, leaving the data alone
+	var updated struct {
+		Message     string             `json:"message"`
+		Preferences models.Preferences `json:"preferences"`
+	}
+	chinese := http.Header{"Accept-Language": []string{"zh-CN,zh;q=0.9"}}
+	if code := ts.DoWithHeaders(t, http.MethodPut, "/me/preferences", token, chinese, models.Preferences{"theme": "dark"}, &updated); code != http.StatusOK {
+		t.Fatalf("PUT /me/preferences: status %d", code)
+	}
+	if updated.Message != "偏好设置已更新" || updated.Preferences["theme"] != "dark" {
+		t.Fatalf("PUT /me/preferences in Chinese: %+v", updated)
+	}
+
+	// gRPC translates response messages and field violations
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "accept-language", "fr-FR")
+	created, err := ts.GRPC.CreateUser(ctx, &proto.CreateUserRequest{Name: "Sam", Email: "sam@example.com", Password: "password123"})
+	if err != nil || created.Message != "Utilisateur créé" {
+		t.Fatalf("CreateUser in French: %+v, %v", created, err)
+	}
+	_, err = ts.GRPC.CreateUser(ctx, &proto.CreateUserRequest{Name: "Sam", Email: "sam2@example.com"})
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument || st.Message() != "password is required" {
+		t.Fatalf("CreateUser without password: %v", err)
+	}
+	var violations *errdetails.BadRequest
+	var localized *errdetails.LocalizedMessage
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.BadRequest:
+			violations = d
+		case *errdetails.LocalizedMessage:
+			localized = d
+		}
+	}
+	if violations == nil || violations.FieldViolations[0].Description != "password est obligatoire" {
+		t.Fatalf("BadRequest detail: %+v", violations)
+	}
+	if localized == nil || localized.Message != "password est obligatoire" {
+		t.Fatalf("LocalizedMessage detail: %+v", localized)
+	}
+}
+
+func TestReadinessRegistry(t *testing.T) {
+	ts := NewTestServer(t)
+
+	var report metrics.Report
+	if code := ts.Do(t, http.MethodGet, "/readyz", "", nil, &report); code != http.StatusOK || report.Status != metrics.StatusReady {
+		t.Fatalf("GET /readyz: status %d, %+v", code, report)
+	}
+	if _, ok := report.Dependencies["database"]; !ok {
+		t.Fatalf("database is not reported: %+v", report.Dependencies)
+	}
+
+	broker := metrics.CheckFunc(func(ctx context.Context) error { return errors.New("broker unreachable") })
+	ts.App.Health.Register("broker", broker, metrics.Optional())
+	if code := ts.Do(t, http.MethodGet, "/readyz", "", nil, &report); code != http.StatusOK || report.Status != metrics.StatusDegraded || report.Dependencies["broker"].Error != "broker unreachable" {
+		t.Fatalf("optional dependency down: status %d, %+v", code, report)
+	}
+
+	ts.App.Health.Register("queue", broker)
+	if code := ts.Do(t, http.MethodGet, "/readyz", "", nil, &report); code != http.StatusServiceUnavailable || report.Status != metrics.StatusNotReady {
+		t.Fatalf("required dependency down: status %d, %+v", code, report)
+	}
+}
+
+func TestUserStreaming(t *testing.T) {
+	ts := NewTestServer(t)
+	admin := ts.AdminToken(t)
+	_, userToken := ts.Signup(t, "Alice", "alice@example.com", "password123")
+
+	ctx := context.Background()
+	for i := 0; i < service.MaxListUsers; i++ {
+		user := &models.User{Name: fmt.Sprintf("User %d", i), Email: fmt.Sprintf("user%d@example.com", i), Password: "x", Role: models.RoleUser, Status: models.StatusActive, TenantID: database.TenantFromContext(ctx)}
+		if err := ts.Repo.CreateUser(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	total := service.MaxListUsers + 1
+
+	var list struct {
+		Users     []models.User `json:"users"`
+		Truncated bool          `json:"truncated"`
+	}
+	if code := ts.Do(t, http.MethodGet, "/users", admin, nil, &list); code != http.StatusOK || len(list.Users) != service.MaxListUsers || !list.Truncated {
+		t.Fatalf("GET /users: status %d, %d users, truncated %v", code, len(list.Users), list.Truncated)
+	}
+
+	if code := ts.Do(t, http.MethodGet, "/users/export", userToken, nil, nil); code != http.StatusForbidden {
+		t.Fatalf("export by a non-admin: expected 403, got %d", code)
+	}
+	req, _ := http.NewRequest(http.MethodGet, ts.HTTP.URL+"/users/export", nil)
+	req.Header.Set("Authorization", "Bearer "+admin)
+	resp, err := ts.HTTP.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/csv") {
+		t.Fatalf("GET /users/export: status %d, %v", resp.StatusCode, err)
+	}
+	if len(records) != total+1 || records[0][0] != "id" || records[1][2] != "alice@example.com" {
+		t.Fatalf("export: %d rows, first %v", len(records), records[:2])
+	}
+
+	if _, err := recvAll(WithToken(ctx, userToken), ts.GRPC); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("StreamUsers by a non-admin: %v", err)
+	}
+	users, err := recvAll(WithToken(ctx, admin), ts.GRPC)
+	if err != nil || len(users) != total || users[0].Email != "alice@example.com" {
+		t.Fatalf("StreamUsers: %d users, %v", len(users), err)
+	}
+	if users, err := recvAll(ctx, ts.GRPCClient(t, client.WithToken(admin))); err != nil || len(users) != total {
+		t.Fatalf("StreamUsers with a client token: %d users, %v", len(users), err)
+	}
+}
+
+// recvAll reads every user StreamUsers sends
+func recvAll(ctx context.Context, c proto.UserServiceClient) ([]*proto.ProtoUser, error) {
+	stream, err := c.StreamUsers(ctx, &proto.StreamUsersRequest{})
+	if err != nil {
+		return nil, err
+	}
+	var users []*proto.ProtoUser
+	for {
+		user, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return users, nil
+		}
+		if err != nil {
+			return users, err
+		}
+		users = append(users, user)
+	}
+}
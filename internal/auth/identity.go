@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// Identity is the authenticated caller of a request
+type Identity struct {
+	UserID    uint
+	Role      string
+	TenantID  string
+	SessionID string
+	// ActorID is the admin acting as UserID when the token is an
+	// impersonation token, zero otherwise
+	ActorID uint
+}
+
+// ImpersonationHeader watermarks responses served to an impersonation token
+const ImpersonationHeader = "X-Impersonated-By"
+
+// IsImpersonated reports whether the caller is an admin impersonating the user
+func (i *Identity) IsImpersonated() bool {
+	return i != nil && i.ActorID != 0
+}
+
+// Actor returns the user actually making the request: the impersonating
+// admin for an impersonation token, otherwise UserID
+func (i *Identity) Actor() uint {
+	if i.IsImpersonated() {
+		return i.ActorID
+	}
+	return i.UserID
+}
+
+// IsAdmin reports whether the caller has the admin role
+func (i *Identity) IsAdmin() bool {
+	return i != nil && i.Role == models.RoleAdmin
+}
+
+// CanModifyUser reports whether the caller may change or delete the target user:
+// users may only modify their own record unless they are an admin
+func (i *Identity) CanModifyUser(targetID uint) bool {
+	if i == nil {
+		return false
+	}
+	return i.UserID == targetID || i.IsAdmin()
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the caller identity
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the caller identity stored in ctx, if any
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*Identity)
+	return identity, ok
+}
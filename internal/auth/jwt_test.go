@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var fuzzSecret = []byte("fuzz-secret")
+
+// signHS256 signs an arbitrary claims payload, so fuzzed claims get past
+// the signature check and reach claim extraction
+func signHS256(header, claims string) string {
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString([]byte(header)) + "." + enc.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, fuzzSecret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func FuzzParseToken(f *testing.F) {
+	tokens := NewTokens(fuzzSecret)
+	valid, err := tokens.GenerateToken(Identity{UserID: 7, Role: "user", TenantID: "default", SessionID: "s1"})
+	if err != nil {
+		f.Fatal(err)
+	}
+	impersonation, err := tokens.GenerateToken(Identity{UserID: 7, Role: "user", ActorID: 1})
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, seed := range []string{
+		valid,
+		impersonation,
+		"",
+		"not-a-token",
+		"a.b.c",
+		valid + "x",
+		signHS256(`{"alg":"none","typ":"JWT"}`, `{"user_id":1}`),
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, token string) {
+		identity, err := tokens.Authenticate(context.Background(), token)
+		if (identity == nil) == (err == nil) {
+			t.Fatalf("expected an identity or an error, got %+v, %v", identity, err)
+		}
+	})
+}
+
+func FuzzParseTokenClaims(f *testing.F) {
+	for _, seed := range []string{
+		`{"user_id":7,"role":"user","exp":4102444800}`,
+		`{"role":"admin","exp":4102444800}`,
+		`{"user_id":"7","exp":4102444800}`,
+		`{"user_id":null,"exp":4102444800}`,
+		`{"user_id":[],"role":{},"tenant_id":1,"sid":false,"exp":4102444800}`,
+		`{"user_id":7,"actor_id":1,"subject_id":"7","exp":4102444800}`,
+		`{"user_id":1e400,"exp":4102444800}`,
+		`{"user_id":7,"exp":"tomorrow"}`,
+		`[]`,
+		`null`,
+	} {
+		f.Add(`{"alg":"HS256","typ":"JWT"}`, seed)
+	}
+	f.Add(`{"alg":"HS512","typ":"JWT"}`, `{"user_id":7,"exp":4102444800}`)
+
+	tokens := NewTokens(fuzzSecret)
+	f.Fuzz(func(t *testing.T, header, claims string) {
+		identity, err := tokens.ParseToken(signHS256(header, claims))
+		if (identity == nil) == (err == nil) {
+			t.Fatalf("expected an identity or an error, got %+v, %v", identity, err)
+		}
+		if identity != nil && identity.UserID == 0 {
+			t.Fatalf("accepted a token without a user: %s", claims)
+		}
+	})
+}
+
+func TestTokenRoundTrip(t *testing.T) {
+	tokens := NewTokens(fuzzSecret)
+	want := Identity{UserID: 7, Role: "admin", TenantID: "acme", SessionID: "s1", ActorID: 3}
+	token, err := tokens.GenerateToken(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tokens.ParseToken(token)
+	if err != nil || *got != want {
+		t.Fatalf("expected %+v, got %+v, %v", want, got, err)
+	}
+
+	if _, err := NewTokens([]byte("another-secret")).ParseToken(token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("token signed with another key: expected ErrInvalidToken, got %v", err)
+	}
+}
+
+func TestParseTokenRejects(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	sign := func(method jwt.SigningMethod, claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(fuzzSecret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"user_id": 7, "exp": exp}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"alg none":            none,
+		"alg HS512":           sign(jwt.SigningMethodHS512, jwt.MapClaims{"user_id": 7, "exp": exp}),
+		"no exp":              sign(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": 7}),
+		"no user_id":          sign(jwt.SigningMethodHS256, jwt.MapClaims{"role": "admin", "exp": exp}),
+		"string user_id":      sign(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": "7", "exp": exp}),
+		"zero user_id":        sign(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": 0, "exp": exp}),
+		"negative user_id":    sign(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": -7, "exp": exp}),
+		"fractional user_id":  sign(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": 7.5, "exp": exp}),
+		"oversized user_id":   sign(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": 1 << 40, "exp": exp}),
+		"non-string role":     sign(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": 7, "role": 1, "exp": exp}),
+		"mismatched subject":  sign(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": 7, "actor_id": 1, "subject_id": 8, "exp": exp}),
+		"string actor_id":     sign(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": 7, "actor_id": "1", "subject_id": 7, "exp": exp}),
+		"malformed signature": signHS256(`{"alg":"HS256"}`, `{"user_id":7}`) + "x",
+	}
+	tokens := NewTokens(fuzzSecret)
+	for name, token := range tests {
+		if identity, err := tokens.ParseToken(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %+v, %v", name, identity, err)
+		}
+	}
+}
+
+func TestIssuerAndAudience(t *testing.T) {
+	issuer := NewTokens(fuzzSecret)
+	issuer.SetIssuer("https://auth.example.com")
+	issuer.SetAudience("restapi")
+	token, err := issuer.GenerateToken(Identity{UserID: 7, Role: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issuer.ParseToken(token); err != nil {
+		t.Fatalf("token from the configured issuer: %v", err)
+	}
+
+	plain, err := NewTokens(fuzzSecret).GenerateToken(Identity{UserID: 7, Role: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issuer.ParseToken(plain); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("token without iss and aud: expected ErrInvalidToken, got %v", err)
+	}
+
+	other := NewTokens(fuzzSecret)
+	other.SetIssuer("https://auth.example.com")
+	other.SetAudience("billing")
+	if _, err := other.ParseToken(token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("token for another audience: expected ErrInvalidToken, got %v", err)
+	}
+}
+
+func TestAuthenticateFallsBackToAccountChecks(t *testing.T) {
+	tokens := NewTokens(fuzzSecret)
+	tokens.SetSessionValidator(func(ctx context.Context, id string) error {
+		return errors.New("session revoked")
+	})
+	var checked []uint
+	tokens.SetAccountValidator(func(ctx context.Context, identity *Identity) error {
+		checked = append(checked, identity.UserID)
+		return errors.New("account is suspended")
+	})
+
+	session, err := tokens.GenerateToken(Identity{UserID: 7, Role: "user", SessionID: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tokens.Authenticate(context.Background(), session); !errors.Is(err, ErrSessionRevoked) || len(checked) != 0 {
+		t.Fatalf("token with a session: expected ErrSessionRevoked alone, got %v after checking %v", err, checked)
+	}
+
+	impersonation, err := tokens.GenerateToken(Identity{UserID: 7, Role: "user", ActorID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tokens.Authenticate(context.Background(), impersonation); !errors.Is(err, ErrAccountInactive) || len(checked) != 1 {
+		t.Fatalf("token without a session: expected ErrAccountInactive, got %v after checking %v", err, checked)
+	}
+}
@@ -0,0 +1,144 @@
+package bruteforce
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/114windd/restapi/internal/logger"
+)
+
+// Guard slows down password guessing. Failed logins are counted per client
+// IP and per email within a window; once a key has used up its free
+// attempts, each further attempt is delayed, doubling with every failure.
+// Counting emails as well as IPs covers attacks spread over many addresses.
+//
+// Attempts are counted before the password is checked, so concurrent
+// guesses can't all get in under the free attempts; Succeeded takes back
+// the count of an attempt that turns out to be right. Counts are kept in a
+// Store, shared between instances when it is backed by Redis.
+type Guard struct {
+	store        Store
+	freeAttempts int
+	baseDelay    time.Duration
+	maxDelay     time.Duration
+	window       time.Duration
+}
+
+// NewGuard creates a Guard keeping counts in store and delaying attempts by
+// baseDelay after freeAttempts failures within window, up to maxDelay
+func NewGuard(store Store, freeAttempts int, baseDelay, maxDelay, window time.Duration) *Guard {
+	return &Guard{
+		store:        store,
+		freeAttempts: freeAttempts,
+		baseDelay:    baseDelay,
+		maxDelay:     maxDelay,
+		window:       window,
+	}
+}
+
+// IPKey identifies failures from a client address
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// EmailKey identifies failures against an account, whatever the client
+func EmailKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// Attempt counts an attempt against each key and returns how long it must
+// wait: the longest delay owed by the failures before it. Keys whose count
+// can't be updated are not delayed, so a storage outage doesn't lock
+// everyone out.
+func (g *Guard) Attempt(ctx context.Context, keys ...string) time.Duration {
+	if g == nil {
+		return 0
+	}
+
+	var delay time.Duration
+	for _, key := range keys {
+		count, err := g.store.Add(ctx, key, 1, g.window)
+		if err != nil {
+			logger.Log.WithError(err).Warn("Failed to count a login attempt")
+			continue
+		}
+		if d := g.delayFor(count - 1); d > delay {
+			delay = d
+		}
+	}
+	return delay
+}
+
+// delayFor doubles baseDelay for every failure past the free attempts
+func (g *Guard) delayFor(failures int) time.Duration {
+	excess := failures - g.freeAttempts
+	if excess < 0 {
+		return 0
+	}
+	delay := g.baseDelay
+	for i := 0; i < excess && delay < g.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > g.maxDelay {
+		delay = g.maxDelay
+	}
+	return delay
+}
+
+// Wait counts an attempt against keys and sleeps for the delay it owes,
+// returning early with the context's error if it is cancelled first
+func (g *Guard) Wait(ctx context.Context, keys ...string) error {
+	delay := g.Attempt(ctx, keys...)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RecordFailure counts a failed attempt that wasn't counted by Attempt,
+// e.g. a rejected signup, against each key
+func (g *Guard) RecordFailure(ctx context.Context, keys ...string) {
+	if g == nil {
+		return
+	}
+	for _, key := range keys {
+		if _, err := g.store.Add(ctx, key, 1, g.window); err != nil {
+			logger.Log.WithError(err).Warn("Failed to count a failed login")
+		}
+	}
+}
+
+// Succeeded takes back the attempt just counted against ip, which turned
+// out to be right, and clears the failures of the account. The client's
+// earlier failures are left to expire, so an attacker can't clear them by
+// logging in to an account of their own between guesses.
+func (g *Guard) Succeeded(ctx context.Context, ipKey, emailKey string) {
+	if g == nil {
+		return
+	}
+	if _, err := g.store.Add(ctx, ipKey, -1, g.window); err != nil {
+		logger.Log.WithError(err).Warn("Failed to take back a login attempt")
+	}
+	g.Reset(ctx, emailKey)
+}
+
+// Reset clears the failure counts of keys
+func (g *Guard) Reset(ctx context.Context, keys ...string) {
+	if g == nil {
+		return
+	}
+	for _, key := range keys {
+		if err := g.store.Reset(ctx, key); err != nil {
+			logger.Log.WithError(err).Warn("Failed to reset login failures")
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package bruteforce
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/114windd/restapi/internal/logger"
+)
+
+func init() {
+	logger.Init()
+	logger.Log.SetOutput(io.Discard)
+}
+
+func TestDelayGrows(t *testing.T) {
+	ctx := context.Background()
+	g := NewGuard(NewMemoryStore(), 2, 100*time.Millisecond, time.Second, time.Minute)
+	key := IPKey("192.0.2.1")
+
+	// The free attempts, then a delay doubling with every failure up to the maximum
+	want := []time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, w := range want {
+		if got := g.Attempt(ctx, key); got != w {
+			t.Fatalf("attempt %d: delay %s, want %s", i+1, got, w)
+		}
+	}
+
+	// The longest delay of the keys applies
+	if got := g.Attempt(ctx, IPKey("192.0.2.2"), key); got != time.Second {
+		t.Fatalf("attempt from a fresh IP against a delayed key: delay %s", got)
+	}
+}
+
+func TestDelayDecays(t *testing.T) {
+	ctx := context.Background()
+	g := NewGuard(NewMemoryStore(), 1, time.Second, time.Minute, 50*time.Millisecond)
+	key := EmailKey("alice@example.com")
+
+	g.Attempt(ctx, key)
+	if got := g.Attempt(ctx, key); got != time.Second {
+		t.Fatalf("second attempt: delay %s", got)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if got := g.Attempt(ctx, key); got != 0 {
+		t.Fatalf("attempt after the window: delay %s", got)
+	}
+}
+
+func TestReset(t *testing.T) {
+	ctx := context.Background()
+	g := NewGuard(NewMemoryStore(), 1, time.Second, time.Minute, time.Minute)
+	ip, email := IPKey("192.0.2.1"), EmailKey(" Alice@Example.com ")
+
+	g.Attempt(ctx, ip, email)
+	g.Attempt(ctx, ip, email)
+	// The third attempt is right: the account's failures are cleared, and
+	// the client's are kept minus this attempt
+	g.Attempt(ctx, ip, email)
+	g.Succeeded(ctx, ip, email)
+	if got := g.Attempt(ctx, email); got != 0 {
+		t.Fatalf("account after a success: delay %s", got)
+	}
+	if got := g.Attempt(ctx, ip); got != 2*time.Second {
+		t.Fatalf("client after a success: delay %s, want the two earlier failures to count", got)
+	}
+
+	g.Reset(ctx, ip)
+	if got := g.Attempt(ctx, ip); got != 0 {
+		t.Fatalf("client after Reset: delay %s", got)
+	}
+
+	// Failures counted outside Attempt delay the next one too
+	g.RecordFailure(ctx, IPKey("192.0.2.3"), IPKey("192.0.2.3"))
+	if got := g.Attempt(ctx, IPKey("192.0.2.3")); got != 2*time.Second {
+		t.Fatalf("after two recorded failures: delay %s", got)
+	}
+}
+
+func TestConcurrentAttemptsAreCounted(t *testing.T) {
+	ctx := context.Background()
+	g := NewGuard(NewMemoryStore(), 3, time.Second, time.Minute, time.Minute)
+	key := EmailKey("alice@example.com")
+
+	const attempts = 20
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	free := 0
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if g.Attempt(ctx, key) == 0 {
+				mu.Lock()
+				free++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	// Only the free attempts get through without a delay, however many race
+	if free != 3 {
+		t.Fatalf("%d of %d concurrent attempts were not delayed, want 3", free, attempts)
+	}
+}
+
+func TestMemoryStoreIsBounded(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	store.max = 10
+
+	if _, err := store.Add(ctx, "expiring", 1, time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	for i := 0; i < 20; i++ {
+		if _, err := store.Add(ctx, fmt.Sprintf("ip:%d", i), 1, time.Duration(i+1)*time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := store.Len(); n != 10 {
+		t.Fatalf("store holds %d keys, want at most 10", n)
+	}
+	// The counts ending soonest made room for the newer ones
+	if count, _ := store.Add(ctx, "ip:19", 0, time.Minute); count != 1 {
+		t.Fatalf("latest key lost its count: %d", count)
+	}
+	if count, _ := store.Add(ctx, "ip:0", 0, time.Minute); count != 0 {
+		t.Fatalf("oldest key kept its count: %d", count)
+	}
+}
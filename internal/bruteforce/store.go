@@ -0,0 +1,128 @@
+package bruteforce
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store keeps failure counts per key within fixed windows
+type Store interface {
+	// Add adds delta to the count of key and returns the new count. A key
+	// without a count, or whose window has ended, starts a new window of
+	// the given length at zero. Concurrent calls never lose an update.
+	Add(ctx context.Context, key string, delta int, window time.Duration) (int, error)
+	// Reset forgets the count of key
+	Reset(ctx context.Context, key string) error
+}
+
+// maxTrackedKeys bounds the keys a MemoryStore holds. When it is full,
+// counts whose window has ended are dropped, then the ones ending soonest.
+const maxTrackedKeys = 10000
+
+type failureCount struct {
+	count     int
+	windowEnd time.Time
+}
+
+// MemoryStore keeps counts in process, so each instance counts on its own
+type MemoryStore struct {
+	mu       sync.Mutex
+	max      int
+	failures map[string]*failureCount
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{max: maxTrackedKeys, failures: make(map[string]*failureCount)}
+}
+
+// Add implements Store
+func (m *MemoryStore) Add(ctx context.Context, key string, delta int, window time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	f, ok := m.failures[key]
+	if !ok || now.After(f.windowEnd) {
+		if !ok && len(m.failures) >= m.max {
+			m.evict(now)
+		}
+		f = &failureCount{windowEnd: now.Add(window)}
+		m.failures[key] = f
+	}
+	if f.count += delta; f.count < 0 {
+		f.count = 0
+	}
+	return f.count, nil
+}
+
+// Reset implements Store
+func (m *MemoryStore) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.failures, key)
+	return nil
+}
+
+// Len returns the number of keys held
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.failures)
+}
+
+// evict makes room for a key: it drops counts whose window has ended, or
+// else the one ending soonest. Callers hold m.mu.
+func (m *MemoryStore) evict(now time.Time) {
+	var soonest string
+	for key, f := range m.failures {
+		if now.After(f.windowEnd) {
+			delete(m.failures, key)
+		} else if soonest == "" || f.windowEnd.Before(m.failures[soonest].windowEnd) {
+			soonest = key
+		}
+	}
+	if len(m.failures) >= m.max {
+		delete(m.failures, soonest)
+	}
+}
+
+// redisKeyPrefix namespaces failure counts in a shared Redis
+const redisKeyPrefix = "bruteforce:"
+
+// addScript adds ARGV[1] to the count in KEYS[1], never below zero, and
+// starts its window of ARGV[2] milliseconds when it has none
+var addScript = redis.NewScript(`
+local count = redis.call("INCRBY", KEYS[1], ARGV[1])
+if count < 0 then
+  redis.call("SET", KEYS[1], 0, "KEEPTTL")
+  count = 0
+end
+if redis.call("PTTL", KEYS[1]) < 0 then
+  redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return count
+`)
+
+// RedisStore keeps counts in Redis, so failures count across all instances
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore creates a RedisStore
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// Add implements Store
+func (r *RedisStore) Add(ctx context.Context, key string, delta int, window time.Duration) (int, error) {
+	return addScript.Run(ctx, r.client, []string{redisKeyPrefix + key}, delta, window.Milliseconds()).Int()
+}
+
+// Reset implements Store
+func (r *RedisStore) Reset(ctx context.Context, key string) error {
+	return r.client.Del(ctx, redisKeyPrefix+key).Err()
+}
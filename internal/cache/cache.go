@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"context"
+	"errors"
+
+	"github.com/114windd/restapi/internal/logger"
+)
+
+// Store is a cache backend. Get decodes the value stored under key into
+// dst, which must be a pointer to the type that was stored.
+type Store interface {
+	Get(ctx context.Context, key string, dst interface{}) (bool, error)
+	Set(ctx context.Context, key string, value interface{}) error
+	Delete(ctx context.Context, key string) error
+}
+
+// Cache is a best-effort cache on top of a Store: backend errors are logged
+// and treated as misses, so a cache outage only costs performance
+type Cache struct {
+	store Store
+}
+
+// New creates a cache backed by store
+func New(store Store) *Cache {
+	return &Cache{store: store}
+}
+
+// Get decodes the cached value for key into dst, if present and not expired
+func (c *Cache) Get(ctx context.Context, key string, dst interface{}) bool {
+	ok, err := c.store.Get(ctx, key, dst)
+	if err != nil {
+		logger.Log.WithError(err).WithField("key", key).Warn("Cache read failed")
+		return false
+	}
+	return ok
+}
+
+// Set stores value under key using the default TTL
+func (c *Cache) Set(ctx context.Context, key string, value interface{}) {
+	if err := c.store.Set(ctx, key, value); err != nil {
+		logger.Log.WithError(err).WithField("key", key).Warn("Cache write failed")
+	}
+}
+
+// Delete removes key from the cache
+func (c *Cache) Delete(ctx context.Context, key string) {
+	if err := c.store.Delete(ctx, key); err != nil {
+		logger.Log.WithError(err).WithField("key", key).Warn("Cache delete failed")
+	}
+}
+
+// Ping checks that the backend accepts writes and serves reads
+func (c *Cache) Ping(ctx context.Context) error {
+	const key = "health:ping"
+	if err := c.store.Set(ctx, key, true); err != nil {
+		return err
+	}
+	defer c.store.Delete(ctx, key)
+
+	var value bool
+	ok, err := c.store.Get(ctx, key, &value)
+	if err != nil {
+		return err
+	}
+	if !ok || !value {
+		return errors.New("cache did not return a value it just stored")
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// item is a cached value with its expiry
+type item struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// MemoryStore is a concurrency-safe in-process Store with per-entry TTL.
+// Values are kept as-is, so each instance has its own cache.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	items map[string]item
+	ttl   time.Duration
+	swept time.Time
+}
+
+// NewMemoryStore creates a store whose entries expire after ttl
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		items: make(map[string]item),
+		ttl:   ttl,
+		swept: time.Now(),
+	}
+}
+
+// Get implements Store
+func (m *MemoryStore) Get(ctx context.Context, key string, dst interface{}) (bool, error) {
+	m.mu.RLock()
+	it, ok := m.items[key]
+	m.mu.RUnlock()
+
+	if !ok {
+		return false, nil
+	}
+	if time.Now().After(it.expiresAt) {
+		return false, m.Delete(ctx, key)
+	}
+
+	target := reflect.ValueOf(dst)
+	value := reflect.ValueOf(it.value)
+	if target.Kind() != reflect.Pointer || !value.Type().AssignableTo(target.Elem().Type()) {
+		return false, fmt.Errorf("cache: cannot decode %T into %T", it.value, dst)
+	}
+	target.Elem().Set(value)
+	return true, nil
+}
+
+// Set implements Store
+func (m *MemoryStore) Set(ctx context.Context, key string, value interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.swept) > m.ttl {
+		m.sweep(now)
+	}
+	m.items[key] = item{value: value, expiresAt: now.Add(m.ttl)}
+	return nil
+}
+
+// sweep evicts expired entries that were never read again, so keys written
+// once don't accumulate. Callers must hold m.mu.
+func (m *MemoryStore) sweep(now time.Time) {
+	for key, it := range m.items {
+		if now.After(it.expiresAt) {
+			delete(m.items, key)
+		}
+	}
+	m.swept = now
+}
+
+// Delete implements Store
+func (m *MemoryStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.items, key)
+	return nil
+}
+
+// Len returns the number of entries, including expired ones not yet evicted
+func (m *MemoryStore) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.items)
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/114windd/restapi/internal/logger"
+)
+
+func init() {
+	logger.Init()
+	logger.Log.SetOutput(io.Discard)
+}
+
+type entry struct {
+	Name string
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryStore(50 * time.Millisecond)
+
+	if err := m.Set(ctx, "user:1", entry{Name: "Ada"}); err != nil {
+		t.Fatal(err)
+	}
+	var got entry
+	if ok, err := m.Get(ctx, "user:1", &got); !ok || err != nil || got.Name != "Ada" {
+		t.Fatalf("Get: %v, %v, %+v", ok, err, got)
+	}
+	var wrong int
+	if _, err := m.Get(ctx, "user:1", &wrong); err == nil {
+		t.Fatal("Get into a different type: expected an error")
+	}
+	if ok, err := m.Get(ctx, "user:2", &got); ok || err != nil {
+		t.Fatalf("Get of a missing key: %v, %v", ok, err)
+	}
+
+	_ = m.Delete(ctx, "user:1")
+	if ok, _ := m.Get(ctx, "user:1", &got); ok {
+		t.Fatal("Get after Delete: still cached")
+	}
+
+	// Entries expire after the TTL, and ones never read again are swept
+	_ = m.Set(ctx, "user:1", entry{Name: "Ada"})
+	_ = m.Set(ctx, "user:3", entry{Name: "Cy"})
+	time.Sleep(60 * time.Millisecond)
+	if ok, _ := m.Get(ctx, "user:1", &got); ok {
+		t.Fatal("Get after the TTL: still cached")
+	}
+	_ = m.Set(ctx, "user:4", entry{Name: "Di"})
+	if m.Len() != 1 {
+		t.Fatalf("after a sweep: %d entries, want 1", m.Len())
+	}
+}
+
+// failingStore fails every operation
+type failingStore struct{}
+
+var errBackend = errors.New("backend down")
+
+func (failingStore) Get(context.Context, string, interface{}) (bool, error) { return false, errBackend }
+func (failingStore) Set(context.Context, string, interface{}) error         { return errBackend }
+func (failingStore) Delete(context.Context, string) error                   { return errBackend }
+
+func TestCacheIsBestEffort(t *testing.T) {
+	ctx := context.Background()
+
+	// A failing backend only makes every read a miss
+	c := New(failingStore{})
+	c.Set(ctx, "user:1", entry{Name: "Ada"})
+	var got entry
+	if c.Get(ctx, "user:1", &got) {
+		t.Fatal("Get from a failing store: expected a miss")
+	}
+	c.Delete(ctx, "user:1")
+	if err := c.Ping(ctx); !errors.Is(err, errBackend) {
+		t.Fatalf("Ping of a failing store: %v", err)
+	}
+
+	if err := New(NewMemoryStore(time.Minute)).Ping(ctx); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKeyPrefix namespaces cache entries in a Redis shared with other state
+const redisKeyPrefix = "cache:"
+
+// RedisStore is a Store shared by all instances through Redis. Values are
+// JSON-encoded, so fields hidden from JSON (such as password hashes) are
+// never written to Redis and come back empty.
+type RedisStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisStore creates a store whose entries expire after ttl
+func NewRedisStore(client *redis.Client, ttl time.Duration) *RedisStore {
+	return &RedisStore{client: client, ttl: ttl}
+}
+
+// Get implements Store
+func (r *RedisStore) Get(ctx context.Context, key string, dst interface{}) (bool, error) {
+	data, err := r.client.Get(ctx, redisKeyPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, dst)
+}
+
+// Set implements Store
+func (r *RedisStore) Set(ctx context.Context, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, redisKeyPrefix+key, data, r.ttl).Err()
+}
+
+// Delete implements Store
+func (r *RedisStore) Delete(ctx context.Context, key string) error {
+	return r.client.Del(ctx, redisKeyPrefix+key).Err()
+}
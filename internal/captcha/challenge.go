@@ -0,0 +1,108 @@
+package captcha
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Challenge requires a CAPTCHA once a key (e.g. a client IP) has accumulated
+// too many failed attempts within a window
+type Challenge struct {
+	verifier  Verifier
+	threshold int
+	window    time.Duration
+
+	mu       sync.Mutex
+	failures map[string]*failureCount
+}
+
+// maxTrackedKeys bounds memory before expired entries are swept
+const maxTrackedKeys = 10000
+
+type failureCount struct {
+	count     int
+	windowEnd time.Time
+}
+
+// NewChallenge creates a Challenge. A nil verifier disables challenges.
+func NewChallenge(verifier Verifier, threshold int, window time.Duration) *Challenge {
+	return &Challenge{
+		verifier:  verifier,
+		threshold: threshold,
+		window:    window,
+		failures:  make(map[string]*failureCount),
+	}
+}
+
+// Required reports whether the next attempt for key must solve a CAPTCHA
+func (c *Challenge) Required(key string) bool {
+	if c == nil || c.verifier == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, ok := c.failures[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(f.windowEnd) {
+		delete(c.failures, key)
+		return false
+	}
+	return f.count >= c.threshold
+}
+
+// Enabled reports whether a CAPTCHA provider is configured
+func (c *Challenge) Enabled() bool {
+	return c != nil && c.verifier != nil
+}
+
+// Verify checks a CAPTCHA token with the configured provider
+func (c *Challenge) Verify(ctx context.Context, token, remoteIP string) error {
+	return c.verifier.Verify(ctx, token, remoteIP)
+}
+
+// RecordFailure counts a failed attempt for key
+func (c *Challenge) RecordFailure(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.failures) >= maxTrackedKeys {
+		c.evictExpired(now)
+	}
+
+	f, ok := c.failures[key]
+	if !ok || now.After(f.windowEnd) {
+		f = &failureCount{windowEnd: now.Add(c.window)}
+		c.failures[key] = f
+	}
+	f.count++
+}
+
+// Reset clears the failure count for key, e.g. after a successful login
+func (c *Challenge) Reset(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.failures, key)
+}
+
+// evictExpired drops failure counts whose window has ended. Callers hold c.mu.
+func (c *Challenge) evictExpired(now time.Time) {
+	for key, f := range c.failures {
+		if now.After(f.windowEnd) {
+			delete(c.failures, key)
+		}
+	}
+}
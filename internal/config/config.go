@@ -0,0 +1,767 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds runtime configuration loaded from environment variables
+type Config struct {
+	Env         string // ENV: "production" enables stricter startup checks
+	File        string // CONFIG_FILE: file of KEY=VALUE lines for variables the environment leaves unset
+	Server      ServerConfig
+	API         APIConfig
+	Auth        AuthConfig
+	Cache       CacheConfig
+	Database    DatabaseConfig
+	TLS         TLSConfig
+	Captcha     CaptchaConfig
+	BruteForce  BruteForceConfig
+	Session     SessionConfig
+	Storage     StorageConfig
+	Objects     ObjectStorageConfig
+	Avatars     AvatarConfig
+	Security    SecurityConfig
+	Logging     LoggingConfig
+	Errors      ErrorReportingConfig
+	Metrics     MetricsConfig
+	Signup      SignupConfig
+	Experiments ExperimentsConfig
+	Events      EventsConfig
+	SLO         SLOConfig
+	Cron        CronConfig
+	Recovery    RecoveryConfig
+	Privacy     PrivacyConfig
+	Consent     ConsentConfig
+	Invitations InvitationConfig
+	OAuth       OAuthConfig
+	Mail        MailConfig
+	SMS         SMSConfig
+	GeoIP       GeoIPConfig
+	Anomaly     AnomalyConfig
+	Enumeration EnumerationConfig
+	Static      StaticConfig
+
+	fileErr error // reading File failed
+}
+
+// ServerConfig sets where the server listens. Addresses are host:port, or
+// unix:/path/to.sock for a unix socket.
+type ServerConfig struct {
+	HTTPAddr    string // HTTP_ADDR, or :PORT (default 8080)
+	GRPCAddr    string // GRPC_ADDR, or :GRPC_PORT (default 50051)
+	MetricsAddr string // METRICS_ADDR: serve /metrics on this internal address instead of HTTPAddr
+	SinglePort  bool   // SINGLE_PORT: serve gRPC on HTTPAddr alongside REST; GRPCAddr is unused
+
+	// TrustedProxies are the addresses or CIDR ranges (TRUSTED_PROXIES) of
+	// reverse proxies whose X-Forwarded-For is believed. Empty trusts none,
+	// so the client IP is the connection's peer.
+	TrustedProxies []string
+}
+
+// APIConfig controls API versioning, request deadlines, response compression
+// and the GraphQL endpoint
+type APIConfig struct {
+	LegacySunset       time.Time     // API_LEGACY_SUNSET: date (YYYY-MM-DD) unversioned paths stop being served, announced in the Sunset header
+	RequestTimeout     time.Duration // REQUEST_TIMEOUT: deadline of REST requests and gRPC calls
+	LongRequestTimeout time.Duration // LONG_REQUEST_TIMEOUT: deadline of slow REST routes such as uploads
+	Compression        bool          // COMPRESSION_ENABLED: gzip/deflate responses for clients that accept it
+	CompressionMinSize int           // COMPRESSION_MIN_BYTES: smallest response body worth compressing
+	GraphQL            bool          // GRAPHQL_ENABLED: serve the GraphQL API at /graphql
+	GraphQLPlayground  bool          // GRAPHQL_PLAYGROUND: serve GraphiQL at /graphql/playground (default on outside production)
+	GRPCReflection     bool          // GRPC_REFLECTION: serve the gRPC reflection service for grpcurl/grpcui (default off)
+	AdminUI            bool          // ADMIN_UI_ENABLED: serve the admin dashboard at /admin
+	RateLimits         string        // RATE_LIMITS: per-class overrides in requests per second and burst, e.g. "default=20:40,auth=0.2:10"
+}
+
+// AuthConfig controls token signing and two-factor authentication
+type AuthConfig struct {
+	JWTSecret   string // JWT_SECRET
+	JWTIssuer   string // JWT_ISSUER: "iss" claim of issued tokens, required of presented ones when set
+	JWTAudience string // JWT_AUDIENCE: "aud" claim of issued tokens, required of presented ones when set
+	TOTPIssuer  string // TOTP_ISSUER: issuer shown by authenticator apps
+
+	ImpersonationTTL time.Duration // IMPERSONATION_TOKEN_TTL: lifetime of admin impersonation tokens
+}
+
+// CacheConfig controls the in-process cache
+type CacheConfig struct {
+	TTL       time.Duration // CACHE_TTL
+	WarmUsers int           // WARM_CACHE_USERS: users to preload at startup (0 disables)
+}
+
+// DatabaseConfig controls the database connection and per-request Postgres session parameters
+type DatabaseConfig struct {
+	URL              string        // DATABASE_URL
+	SessionSettings  bool          // DB_SESSION_SETTINGS: apply the settings below to every request
+	StatementTimeout time.Duration // DB_STATEMENT_TIMEOUT
+	QueryTimeout     time.Duration // DB_QUERY_TIMEOUT: client-side bound on repository operations without a deadline
+	ApplicationName  string        // DB_APPLICATION_NAME: prefix, the request ID is appended
+	SessionRole      string        // DB_SESSION_ROLE: role assumed per request, e.g. for row-level security
+	TenancyMode      string        // TENANCY_MODE: "none" or "rls" (row-level security keyed on app.tenant_id)
+	Tenants          []string      // TENANTS: the tenants clients may name in X-Tenant-ID; other values are refused
+	MaintenanceRole  string        // DB_MAINTENANCE_ROLE: role with BYPASSRLS that migrations run as
+
+	MigrationLockTimeout time.Duration // DB_MIGRATION_LOCK_TIMEOUT: how long to wait for another replica's migration
+	ConnectTimeout       time.Duration // DB_CONNECT_TIMEOUT: how long startup retries a database that doesn't answer (0 tries once)
+	LazyConnect          bool          // DB_LAZY_CONNECT: start without the database and connect in the background; /readyz reports not ready until it is up
+	HealthCheckInterval  time.Duration // DB_HEALTH_CHECK_INTERVAL: how often the connection is pinged to detect outages (0 disables)
+	OutageThreshold      int           // DB_OUTAGE_THRESHOLD: failed pings in a row that open the circuit breaker
+
+	PrepareStatements  bool          // DB_PREPARE_STATEMENTS: reuse prepared statements; disable behind PgBouncer in transaction mode
+	SlowQueryThreshold time.Duration // DB_SLOW_QUERY_THRESHOLD: log statements taking at least this long; 0 disables
+
+	ReplicaURLs          []string      // DB_REPLICA_URLS: comma-separated read replicas for user lookups and listings
+	ReplicaCheckInterval time.Duration // DB_REPLICA_CHECK_INTERVAL: how often replicas are pinged
+}
+
+// Tenancy modes
+const (
+	TenancyModeNone = "none"
+	TenancyModeRLS  = "rls"
+)
+
+// TLSConfig controls TLS for the REST and gRPC listeners
+type TLSConfig struct {
+	CertFile         string   // TLS_CERT_FILE
+	KeyFile          string   // TLS_KEY_FILE
+	AutocertDomains  []string // TLS_AUTOCERT_DOMAINS: comma-separated, enables Let's Encrypt
+	AutocertCacheDir string   // TLS_AUTOCERT_CACHE_DIR
+	AutocertHTTPAddr string   // TLS_AUTOCERT_HTTP_ADDR: listener for HTTP-01 challenges
+	GRPCClientCAFile string   // GRPC_TLS_CLIENT_CA: enables mTLS on the gRPC listener
+}
+
+// CaptchaConfig controls CAPTCHA challenges on login and signup
+type CaptchaConfig struct {
+	Provider         string        // CAPTCHA_PROVIDER: "hcaptcha" or "recaptcha"; empty disables challenges
+	Secret           string        // CAPTCHA_SECRET
+	FailureThreshold int           // CAPTCHA_FAILURE_THRESHOLD: failed attempts before a challenge is required
+	FailureWindow    time.Duration // CAPTCHA_FAILURE_WINDOW
+}
+
+// BruteForceConfig controls progressive delays on repeated failed logins
+type BruteForceConfig struct {
+	FreeAttempts int           // LOGIN_DELAY_AFTER: failures per client or account before delays start
+	BaseDelay    time.Duration // LOGIN_DELAY_BASE: first delay, doubled on each further failure (0 disables)
+	MaxDelay     time.Duration // LOGIN_DELAY_MAX
+	Window       time.Duration // LOGIN_FAILURE_WINDOW: how long failures are remembered
+}
+
+// SessionConfig controls server-side login sessions and refresh tokens
+type SessionConfig struct {
+	Enabled bool          // SESSIONS_ENABLED: defaults to true when REDIS_URL is set
+	TTL     time.Duration // SESSION_TTL: session lifetime, extended on each refresh
+}
+
+// Storage backends for rate limit, cache and session state
+const (
+	StorageBackendMemory = "memory"
+	StorageBackendRedis  = "redis"
+)
+
+// StorageConfig selects where rate limit, cache and session state is kept
+type StorageConfig struct {
+	Backend  string // STORAGE_BACKEND: "memory" (per instance) or "redis" (shared); defaults to redis when REDIS_URL is set
+	RedisURL string // REDIS_URL
+}
+
+// Object storage backends for uploaded files and exports
+const (
+	ObjectStorageLocal = "local"
+	ObjectStorageS3    = "s3"
+	ObjectStorageMinIO = "minio" // S3 API with path-style bucket addressing
+)
+
+// ObjectStorageConfig selects where uploaded files such as avatars are kept
+type ObjectStorageConfig struct {
+	Backend     string // OBJECT_STORAGE_BACKEND: "local" (default), "s3" or "minio"
+	LocalDir    string // OBJECT_STORAGE_DIR: root directory of the local backend
+	PublicURL   string // OBJECT_STORAGE_PUBLIC_URL: where the local backend's signed URLs point
+	SigningKey  string // OBJECT_STORAGE_SIGNING_KEY: signs local URLs; defaults to JWT_SECRET
+	S3Endpoint  string // S3_ENDPOINT: host[:port] of the S3 API, e.g. s3.amazonaws.com
+	S3Bucket    string // S3_BUCKET
+	S3Region    string // S3_REGION
+	S3AccessKey string // S3_ACCESS_KEY
+	S3SecretKey string // S3_SECRET_KEY
+	S3Insecure  bool   // S3_INSECURE: use plain HTTP, e.g. for a local test server
+}
+
+// AvatarConfig limits avatar uploads
+type AvatarConfig struct {
+	MaxBytes     int64 // AVATAR_MAX_BYTES
+	MaxDimension int   // AVATAR_MAX_DIMENSION: maximum width and height in pixels
+}
+
+// SecurityConfig controls response security headers and request hardening
+type SecurityConfig struct {
+	HSTSMaxAge          time.Duration // HSTS_MAX_AGE: Strict-Transport-Security max-age on HTTPS responses (0 disables)
+	MaxBodyBytes        int64         // MAX_BODY_BYTES: request body size limit (0 disables)
+	MaxJSONDepth        int           // MAX_JSON_DEPTH: deepest nesting of objects and arrays in JSON bodies (0 disables)
+	AllowDuplicateKeys  bool          // JSON_ALLOW_DUPLICATE_KEYS: accept JSON objects naming a key twice
+	AllowedContentTypes []string      // ALLOWED_CONTENT_TYPES: comma-separated media types accepted for request bodies
+	CORSOrigins         []string      // CORS_ALLOWED_ORIGINS: comma-separated origins browsers may call the API from; "*" allows any
+}
+
+// LoggingConfig controls log levels, outputs and request logging
+type LoggingConfig struct {
+	Level          string   // LOG_LEVEL: default level; debug, or info when ENV=production
+	Levels         string   // LOG_LEVELS: per-package levels, e.g. "database=debug,cron=warn"
+	Backend        string   // LOG_BACKEND: "logrus" or "slog", which formats and writes entries
+	Format         string   // LOG_FORMAT: "text" or "json"; json when ENV=production
+	Outputs        []string // LOG_OUTPUTS: comma-separated: stdout, stderr, file, syslog
+	File           string   // LOG_FILE: path written by the file output
+	FileMaxSizeMB  int      // LOG_FILE_MAX_SIZE_MB: size at which the file is rotated
+	FileMaxBackups int      // LOG_FILE_MAX_BACKUPS: rotated files kept (0 keeps all)
+	FileMaxAgeDays int      // LOG_FILE_MAX_AGE_DAYS: days rotated files are kept (0 keeps them)
+	FileCompress   bool     // LOG_FILE_COMPRESS: gzip rotated files
+	SyslogAddr     string   // LOG_SYSLOG_ADDR: e.g. udp://logs:514; empty uses the local daemon
+	SyslogTag      string   // LOG_SYSLOG_TAG
+
+	Bodies       bool     // LOG_BODIES: log request and response bodies, for debugging; keep off in production
+	BodyMaxBytes int      // LOG_BODY_MAX_BYTES: bodies are truncated to this many bytes
+	RedactFields []string // LOG_REDACT_FIELDS: comma-separated field names redacted in addition to the built-in ones
+}
+
+// ErrorReportingConfig controls reporting of panics and server errors
+type ErrorReportingConfig struct {
+	SentryDSN   string // SENTRY_DSN: Sentry project to report to; empty disables Sentry
+	Environment string // SENTRY_ENVIRONMENT: defaults to ENV
+	Release     string // SENTRY_RELEASE: e.g. the deployed version or commit
+}
+
+// MetricsConfig controls Prometheus metrics
+type MetricsConfig struct {
+	Enabled      bool          // METRICS_ENABLED
+	PushURL      string        // METRICS_PUSH_URL: Pushgateway to push to, in addition to /metrics scraping
+	PushJob      string        // METRICS_PUSH_JOB
+	PushInterval time.Duration // METRICS_PUSH_INTERVAL
+
+	Pprof bool // PPROF_ENABLED: serve /debug/pprof profiles to admins
+
+	LatencyBuckets []float64 // METRICS_LATENCY_BUCKETS: comma-separated seconds for the HTTP and gRPC duration histograms
+	SizeBuckets    []float64 // METRICS_SIZE_BUCKETS: comma-separated bytes for the HTTP request and response size histograms
+}
+
+// SignupConfig restricts who may sign up
+type SignupConfig struct {
+	AllowedDomains           []string // SIGNUP_ALLOWED_DOMAINS: comma-separated; when set only these domains may sign up
+	DeniedDomains            []string // SIGNUP_DENIED_DOMAINS: comma-separated
+	CheckEmailRequireCaptcha bool     // SIGNUP_CHECK_EMAIL_CAPTCHA: anti-enumeration mode, every email check needs a CAPTCHA token
+	StripPlusTags            bool     // EMAIL_STRIP_PLUS_TAGS: treat alice+tag@example.com as alice@example.com
+
+	EmailAvailabilityCacheTTL time.Duration // EMAIL_AVAILABILITY_CACHE_TTL: how long email availability answers are cached (0 disables)
+}
+
+// ExperimentsConfig defines the running A/B experiments
+type ExperimentsConfig struct {
+	Definitions string // EXPERIMENTS: e.g. "onboarding=control:50,guided:50;dark_mode=off:90,on:10"
+}
+
+// Message brokers for user events
+const (
+	EventsBrokerKafka = "kafka"
+	EventsBrokerNATS  = "nats"
+)
+
+// EventsConfig controls publishing of user events to a message broker and
+// the /events stream
+type EventsConfig struct {
+	Broker    string // EVENTS_BROKER: "kafka" or "nats"; empty disables publishing
+	URL       string // EVENTS_URL: Kafka REST Proxy URL or nats:// URL
+	Topic     string // EVENTS_TOPIC: Kafka topic or NATS subject
+	Encoding  string // EVENTS_ENCODING: "json" or "protobuf"
+	QueueSize int    // EVENTS_QUEUE_SIZE: events buffered while the broker is slow or down
+
+	StreamHistory   int           // EVENTS_STREAM_HISTORY: recent events kept for /events clients resuming with Last-Event-ID
+	StreamHeartbeat time.Duration // EVENTS_STREAM_HEARTBEAT: interval of keep-alive comments on idle /events streams
+}
+
+// SLOConfig sets the per-endpoint service level objectives
+type SLOConfig struct {
+	Objectives string        // SLO_OBJECTIVES: e.g. "default=99.9:500ms:99;POST /api/v1/login=99.5:1s:95"
+	Window     time.Duration // SLO_WINDOW: rolling window error budgets are computed over
+}
+
+// CronConfig controls the periodic cleanup tasks
+type CronConfig struct {
+	Enabled               bool          // CRON_ENABLED
+	SessionPurgeInterval  time.Duration // CRON_SESSION_PURGE_INTERVAL: how often expired sessions are dropped (0 disables)
+	HistoryPurgeInterval  time.Duration // CRON_HISTORY_PURGE_INTERVAL: how often old user history is compacted (0 disables)
+	HistoryRetention      time.Duration // HISTORY_RETENTION: how long superseded user snapshots are kept (0 keeps them forever)
+	RecoveryTokenInterval time.Duration // CRON_RECOVERY_TOKEN_INTERVAL: how often expired recovery tokens are cleared (0 disables)
+	ExportPurgeInterval   time.Duration // CRON_EXPORT_PURGE_INTERVAL: how often expired data export archives are deleted (0 disables)
+}
+
+// RecoveryConfig controls admin-verified account recovery
+type RecoveryConfig struct {
+	RequiredApprovals int           // RECOVERY_REQUIRED_APPROVALS: approvals needed from admins other than the one who opened a case
+	TokenTTL          time.Duration // RECOVERY_TOKEN_TTL: how long a reset token can be redeemed
+}
+
+// PrivacyConfig controls users' personal data exports
+type PrivacyConfig struct {
+	ExportRetention time.Duration // EXPORT_RETENTION: how long a data export archive is kept
+	ExportLinkTTL   time.Duration // EXPORT_LINK_TTL: how long an archive's download link is valid
+}
+
+// ConsentConfig controls terms of service acceptance
+type ConsentConfig struct {
+	TermsVersion string // TERMS_VERSION: version of the terms users must accept; empty disables enforcement
+}
+
+// InvitationConfig controls admin invitations
+type InvitationConfig struct {
+	TTL time.Duration // INVITATION_TTL: how long an invitation can be accepted after it is sent
+}
+
+// OAuthConfig holds client credentials for social login; a provider is
+// enabled by setting its client ID
+type OAuthConfig struct {
+	RedirectBaseURL    string // OAUTH_REDIRECT_BASE_URL: public URL of this API, e.g. https://api.example.com
+	GoogleClientID     string // OAUTH_GOOGLE_CLIENT_ID
+	GoogleClientSecret string // OAUTH_GOOGLE_CLIENT_SECRET
+	GitHubClientID     string // OAUTH_GITHUB_CLIENT_ID
+	GitHubClientSecret string // OAUTH_GITHUB_CLIENT_SECRET
+}
+
+// Mail providers
+const (
+	MailProviderLog  = "log"
+	MailProviderSMTP = "smtp"
+	MailProviderSES  = "ses"
+)
+
+// MailConfig controls outgoing email
+type MailConfig struct {
+	Provider  string // MAIL_PROVIDER: "log" (development), "smtp" or "ses"
+	From      string // MAIL_FROM: sender address, e.g. "Example <no-reply@example.com>"
+	Product   string // MAIL_PRODUCT_NAME: product name used in templates
+	QueueSize int    // MAIL_QUEUE_SIZE: messages buffered while the provider is slow or down
+
+	SMTPHost     string // SMTP_HOST
+	SMTPPort     int    // SMTP_PORT: 587 upgrades with STARTTLS, 465 uses implicit TLS
+	SMTPUsername string // SMTP_USERNAME: empty sends without authentication
+	SMTPPassword string // SMTP_PASSWORD
+
+	SESRegion string // SES_REGION: credentials come from the AWS default chain
+}
+
+// SMS providers
+const (
+	SMSProviderLog    = "log"
+	SMSProviderTwilio = "twilio"
+)
+
+// SMSConfig controls text messages carrying phone verification and login codes
+type SMSConfig struct {
+	Provider    string        // SMS_PROVIDER: "log" (development) or "twilio"
+	CodeTTL     time.Duration // SMS_CODE_TTL: how long a code is valid
+	RateLimit   int           // SMS_RATE_LIMIT: codes sent to a phone number per SMS_RATE_WINDOW
+	RateWindow  time.Duration // SMS_RATE_WINDOW
+	OTPLogin    bool          // SMS_OTP_LOGIN: let users with a verified phone log in with a code
+	CallbackURL string        // SMS_STATUS_CALLBACK_URL: public URL of /api/v1/sms/status, for delivery reports
+
+	TwilioAccountSID string // TWILIO_ACCOUNT_SID
+	TwilioAuthToken  string // TWILIO_AUTH_TOKEN: also verifies delivery report signatures
+	TwilioFrom       string // TWILIO_FROM: sending number, or a messaging service SID (MG...)
+}
+
+// GeoIPConfig adds the country and city of client IPs to request logs and
+// login audit records
+type GeoIPConfig struct {
+	DatabasePath string // GEOIP_DATABASE_PATH: MaxMind GeoIP2 or GeoLite2 City/Country database; empty disables lookups
+	CacheSize    int    // GEOIP_CACHE_SIZE: IP addresses whose location is kept in memory
+}
+
+// AnomalyConfig controls anomaly detection on logins: repeated failures,
+// new IP addresses and impossible travel
+type AnomalyConfig struct {
+	Enabled           bool          // ANOMALY_DETECTION
+	FailedLogins      int           // ANOMALY_FAILED_LOGINS: failures on one account within ANOMALY_FAILED_LOGIN_WINDOW that flag it
+	FailedLoginWindow time.Duration // ANOMALY_FAILED_LOGIN_WINDOW
+	MaxTravelSpeed    int           // ANOMALY_MAX_TRAVEL_KMH: faster travel between logins is impossible; needs a GeoIP City database
+	HistoryTTL        time.Duration // ANOMALY_HISTORY_TTL: how long an account's login addresses and last location are remembered
+	StepUp            bool          // ANOMALY_STEP_UP: confirm impossible travel logins with a second factor, or a code emailed to accounts without one
+	StepUpTTL         time.Duration // ANOMALY_STEP_UP_TTL: how long an emailed step-up code is valid
+	WebhookURL        string        // ANOMALY_WEBHOOK_URL: receives findings as JSON; empty disables alerts
+	WebhookSecret     string        // ANOMALY_WEBHOOK_SECRET: signs alerts with HMAC-SHA256 in X-Signature-256
+}
+
+// EnumerationConfig hides from login and signup which email addresses have
+// accounts. Logins for unknown addresses always take as long as wrong
+// passwords.
+type EnumerationConfig struct {
+	UniformSignup bool          // ENUMERATION_UNIFORM_SIGNUP: signup answers 202 without tokens whether or not the email is taken, and email checks need a CAPTCHA
+	Honeypot      bool          // SIGNUP_HONEYPOT: signups that fill in the hidden "website" field are dropped as bots
+	Jitter        time.Duration // AUTH_RESPONSE_JITTER: random delay up to this before answering login and signup (0 disables)
+}
+
+// StaticConfig serves a frontend from the API binary at paths no API route
+// takes
+type StaticConfig struct {
+	Dir      string // STATIC_DIR: directory of files to serve (empty disables)
+	Embedded bool   // STATIC_EMBEDDED: serve the frontend built into internal/static/dist instead of STATIC_DIR
+	SPA      bool   // STATIC_SPA_FALLBACK: answer page requests for unknown paths with index.html, for client-side routing
+}
+
+// Load reads configuration from the environment, applying defaults. When
+// CONFIG_FILE is set, the file supplies the variables the environment leaves
+// unset; a file that can't be read is reported by Validate.
+func Load() *Config {
+	cfg, err := LoadFile(os.Getenv("CONFIG_FILE"))
+	cfg.fileErr = err
+	return cfg
+}
+
+// LoadFile is Load with path as the configuration file; an empty path reads
+// the environment alone. On error the configuration of the environment alone
+// is returned with it.
+func LoadFile(path string) (*Config, error) {
+	vars, err := readConfigFile(path)
+
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	fileVars = vars
+	defer func() { fileVars = nil }()
+
+	cfg := load()
+	cfg.File = path
+	return cfg, err
+}
+
+func load() *Config {
+	redisURL := getEnv("REDIS_URL", "")
+	jwtSecret := getEnv("JWT_SECRET", DefaultJWTSecret)
+	env := getEnv("ENV", "development")
+
+	return &Config{
+		Env: env,
+		Server: ServerConfig{
+			HTTPAddr:    getEnv("HTTP_ADDR", ":"+getEnv("PORT", "8080")),
+			GRPCAddr:    getEnv("GRPC_ADDR", ":"+getEnv("GRPC_PORT", "50051")),
+			MetricsAddr: getEnv("METRICS_ADDR", ""),
+			SinglePort:  getEnvBool("SINGLE_PORT", false),
+
+			TrustedProxies: getEnvList("TRUSTED_PROXIES", nil),
+		},
+		API: APIConfig{
+			LegacySunset:       getEnvDate("API_LEGACY_SUNSET"),
+			RequestTimeout:     getEnvDuration("REQUEST_TIMEOUT", 10*time.Second),
+			LongRequestTimeout: getEnvDuration("LONG_REQUEST_TIMEOUT", 60*time.Second),
+			Compression:        getEnvBool("COMPRESSION_ENABLED", true),
+			CompressionMinSize: getEnvInt("COMPRESSION_MIN_BYTES", 1024),
+			GraphQL:            getEnvBool("GRAPHQL_ENABLED", true),
+			GraphQLPlayground:  getEnvBool("GRAPHQL_PLAYGROUND", env != "production"),
+			GRPCReflection:     getEnvBool("GRPC_REFLECTION", false),
+			AdminUI:            getEnvBool("ADMIN_UI_ENABLED", false),
+			RateLimits:         getEnv("RATE_LIMITS", ""),
+		},
+		Auth: AuthConfig{
+			JWTSecret:   jwtSecret,
+			JWTIssuer:   getEnv("JWT_ISSUER", ""),
+			JWTAudience: getEnv("JWT_AUDIENCE", ""),
+			TOTPIssuer:  getEnv("TOTP_ISSUER", "restapi"),
+
+			ImpersonationTTL: getEnvDuration("IMPERSONATION_TOKEN_TTL", 15*time.Minute),
+		},
+		Cache: CacheConfig{
+			TTL:       getEnvDuration("CACHE_TTL", 5*time.Minute),
+			WarmUsers: getEnvInt("WARM_CACHE_USERS", 0),
+		},
+		Database: DatabaseConfig{
+			URL:              getEnv("DATABASE_URL", "host=localhost user=postgres password=postgres dbname=restapi port=5432 sslmode=disable"),
+			SessionSettings:  getEnvBool("DB_SESSION_SETTINGS", false),
+			StatementTimeout: getEnvDuration("DB_STATEMENT_TIMEOUT", 0),
+			QueryTimeout:     getEnvDuration("DB_QUERY_TIMEOUT", 5*time.Second),
+			ApplicationName:  getEnv("DB_APPLICATION_NAME", "restapi"),
+			SessionRole:      getEnv("DB_SESSION_ROLE", ""),
+			TenancyMode:      getEnv("TENANCY_MODE", TenancyModeNone),
+			Tenants:          getEnvList("TENANTS", []string{"default"}),
+			MaintenanceRole:  getEnv("DB_MAINTENANCE_ROLE", ""),
+
+			MigrationLockTimeout: getEnvDuration("DB_MIGRATION_LOCK_TIMEOUT", 5*time.Minute),
+			ConnectTimeout:       getEnvDuration("DB_CONNECT_TIMEOUT", 30*time.Second),
+			LazyConnect:          getEnvBool("DB_LAZY_CONNECT", false),
+			HealthCheckInterval:  getEnvDuration("DB_HEALTH_CHECK_INTERVAL", 5*time.Second),
+			OutageThreshold:      getEnvInt("DB_OUTAGE_THRESHOLD", 2),
+
+			PrepareStatements:  getEnvBool("DB_PREPARE_STATEMENTS", true),
+			SlowQueryThreshold: getEnvDuration("DB_SLOW_QUERY_THRESHOLD", 200*time.Millisecond),
+
+			ReplicaURLs:          getEnvList("DB_REPLICA_URLS", nil),
+			ReplicaCheckInterval: getEnvDuration("DB_REPLICA_CHECK_INTERVAL", 10*time.Second),
+		},
+		TLS: TLSConfig{
+			CertFile:         getEnv("TLS_CERT_FILE", ""),
+			KeyFile:          getEnv("TLS_KEY_FILE", ""),
+			AutocertDomains:  getEnvList("TLS_AUTOCERT_DOMAINS", nil),
+			AutocertCacheDir: getEnv("TLS_AUTOCERT_CACHE_DIR", "certs"),
+			AutocertHTTPAddr: getEnv("TLS_AUTOCERT_HTTP_ADDR", ":80"),
+			GRPCClientCAFile: getEnv("GRPC_TLS_CLIENT_CA", ""),
+		},
+		Captcha: CaptchaConfig{
+			Provider:         getEnv("CAPTCHA_PROVIDER", ""),
+			Secret:           getEnv("CAPTCHA_SECRET", ""),
+			FailureThreshold: getEnvInt("CAPTCHA_FAILURE_THRESHOLD", 5),
+			FailureWindow:    getEnvDuration("CAPTCHA_FAILURE_WINDOW", 15*time.Minute),
+		},
+		BruteForce: BruteForceConfig{
+			FreeAttempts: getEnvInt("LOGIN_DELAY_AFTER", 3),
+			BaseDelay:    getEnvDuration("LOGIN_DELAY_BASE", 500*time.Millisecond),
+			MaxDelay:     getEnvDuration("LOGIN_DELAY_MAX", 5*time.Second),
+			Window:       getEnvDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		},
+		Session: SessionConfig{
+			Enabled: getEnvBool("SESSIONS_ENABLED", redisURL != ""),
+			TTL:     getEnvDuration("SESSION_TTL", 30*24*time.Hour),
+		},
+		Storage: StorageConfig{
+			Backend:  getEnv("STORAGE_BACKEND", defaultStorageBackend(redisURL)),
+			RedisURL: redisURL,
+		},
+		Objects: ObjectStorageConfig{
+			Backend:     getEnv("OBJECT_STORAGE_BACKEND", ObjectStorageLocal),
+			LocalDir:    getEnv("OBJECT_STORAGE_DIR", "data/objects"),
+			PublicURL:   getEnv("OBJECT_STORAGE_PUBLIC_URL", "/api/v1/objects"),
+			SigningKey:  getEnv("OBJECT_STORAGE_SIGNING_KEY", jwtSecret),
+			S3Endpoint:  getEnv("S3_ENDPOINT", "s3.amazonaws.com"),
+			S3Bucket:    getEnv("S3_BUCKET", ""),
+			S3Region:    getEnv("S3_REGION", ""),
+			S3AccessKey: getEnv("S3_ACCESS_KEY", ""),
+			S3SecretKey: getEnv("S3_SECRET_KEY", ""),
+			S3Insecure:  getEnvBool("S3_INSECURE", false),
+		},
+		Avatars: AvatarConfig{
+			MaxBytes:     int64(getEnvInt("AVATAR_MAX_BYTES", 2<<20)),
+			MaxDimension: getEnvInt("AVATAR_MAX_DIMENSION", 4096),
+		},
+		Security: SecurityConfig{
+			HSTSMaxAge:          getEnvDuration("HSTS_MAX_AGE", 365*24*time.Hour),
+			MaxBodyBytes:        int64(getEnvInt("MAX_BODY_BYTES", 1<<20)),
+			MaxJSONDepth:        getEnvInt("MAX_JSON_DEPTH", 32),
+			AllowDuplicateKeys:  getEnvBool("JSON_ALLOW_DUPLICATE_KEYS", false),
+			AllowedContentTypes: getEnvList("ALLOWED_CONTENT_TYPES", []string{"application/json"}),
+			CORSOrigins:         getEnvList("CORS_ALLOWED_ORIGINS", nil),
+		},
+		Logging: LoggingConfig{
+			Level:          getEnv("LOG_LEVEL", ""),
+			Levels:         getEnv("LOG_LEVELS", ""),
+			Backend:        getEnv("LOG_BACKEND", "logrus"),
+			Format:         getEnv("LOG_FORMAT", ""),
+			Outputs:        getEnvList("LOG_OUTPUTS", []string{"stdout"}),
+			File:           getEnv("LOG_FILE", ""),
+			FileMaxSizeMB:  getEnvInt("LOG_FILE_MAX_SIZE_MB", 100),
+			FileMaxBackups: getEnvInt("LOG_FILE_MAX_BACKUPS", 5),
+			FileMaxAgeDays: getEnvInt("LOG_FILE_MAX_AGE_DAYS", 30),
+			FileCompress:   getEnvBool("LOG_FILE_COMPRESS", true),
+			SyslogAddr:     getEnv("LOG_SYSLOG_ADDR", ""),
+			SyslogTag:      getEnv("LOG_SYSLOG_TAG", "restapi"),
+
+			Bodies:       getEnvBool("LOG_BODIES", false),
+			BodyMaxBytes: getEnvInt("LOG_BODY_MAX_BYTES", 4096),
+			RedactFields: getEnvList("LOG_REDACT_FIELDS", nil),
+		},
+		Errors: ErrorReportingConfig{
+			SentryDSN:   getEnv("SENTRY_DSN", ""),
+			Environment: getEnv("SENTRY_ENVIRONMENT", getEnv("ENV", "development")),
+			Release:     getEnv("SENTRY_RELEASE", ""),
+		},
+		Metrics: MetricsConfig{
+			Enabled:      getEnvBool("METRICS_ENABLED", true),
+			PushURL:      getEnv("METRICS_PUSH_URL", ""),
+			PushJob:      getEnv("METRICS_PUSH_JOB", "restapi"),
+			PushInterval: getEnvDuration("METRICS_PUSH_INTERVAL", 15*time.Second),
+			Pprof:        getEnvBool("PPROF_ENABLED", false),
+
+			LatencyBuckets: getEnvFloats("METRICS_LATENCY_BUCKETS"),
+			SizeBuckets:    getEnvFloats("METRICS_SIZE_BUCKETS"),
+		},
+		Signup: SignupConfig{
+			AllowedDomains:           getEnvList("SIGNUP_ALLOWED_DOMAINS", nil),
+			DeniedDomains:            getEnvList("SIGNUP_DENIED_DOMAINS", nil),
+			CheckEmailRequireCaptcha: getEnvBool("SIGNUP_CHECK_EMAIL_CAPTCHA", false),
+			StripPlusTags:            getEnvBool("EMAIL_STRIP_PLUS_TAGS", false),
+
+			EmailAvailabilityCacheTTL: getEnvDuration("EMAIL_AVAILABILITY_CACHE_TTL", 30*time.Second),
+		},
+		Events: EventsConfig{
+			Broker:    getEnv("EVENTS_BROKER", ""),
+			URL:       getEnv("EVENTS_URL", ""),
+			Topic:     getEnv("EVENTS_TOPIC", "users.events"),
+			Encoding:  getEnv("EVENTS_ENCODING", "json"),
+			QueueSize: getEnvInt("EVENTS_QUEUE_SIZE", 1000),
+
+			StreamHistory:   getEnvInt("EVENTS_STREAM_HISTORY", 1000),
+			StreamHeartbeat: getEnvDuration("EVENTS_STREAM_HEARTBEAT", 15*time.Second),
+		},
+		SLO: SLOConfig{
+			Objectives: getEnv("SLO_OBJECTIVES", "default=99.9:500ms:99"),
+			Window:     getEnvDuration("SLO_WINDOW", time.Hour),
+		},
+		Cron: CronConfig{
+			Enabled:               getEnvBool("CRON_ENABLED", true),
+			SessionPurgeInterval:  getEnvDuration("CRON_SESSION_PURGE_INTERVAL", time.Hour),
+			HistoryPurgeInterval:  getEnvDuration("CRON_HISTORY_PURGE_INTERVAL", 24*time.Hour),
+			HistoryRetention:      getEnvDuration("HISTORY_RETENTION", 0),
+			RecoveryTokenInterval: getEnvDuration("CRON_RECOVERY_TOKEN_INTERVAL", time.Hour),
+			ExportPurgeInterval:   getEnvDuration("CRON_EXPORT_PURGE_INTERVAL", time.Hour),
+		},
+		Recovery: RecoveryConfig{
+			RequiredApprovals: getEnvInt("RECOVERY_REQUIRED_APPROVALS", 2),
+			TokenTTL:          getEnvDuration("RECOVERY_TOKEN_TTL", 24*time.Hour),
+		},
+		Privacy: PrivacyConfig{
+			ExportRetention: getEnvDuration("EXPORT_RETENTION", 7*24*time.Hour),
+			ExportLinkTTL:   getEnvDuration("EXPORT_LINK_TTL", 15*time.Minute),
+		},
+		Consent: ConsentConfig{
+			TermsVersion: getEnv("TERMS_VERSION", ""),
+		},
+		Invitations: InvitationConfig{
+			TTL: getEnvDuration("INVITATION_TTL", 72*time.Hour),
+		},
+		OAuth: OAuthConfig{
+			RedirectBaseURL:    getEnv("OAUTH_REDIRECT_BASE_URL", ""),
+			GoogleClientID:     getEnv("OAUTH_GOOGLE_CLIENT_ID", ""),
+			GoogleClientSecret: getEnv("OAUTH_GOOGLE_CLIENT_SECRET", ""),
+			GitHubClientID:     getEnv("OAUTH_GITHUB_CLIENT_ID", ""),
+			GitHubClientSecret: getEnv("OAUTH_GITHUB_CLIENT_SECRET", ""),
+		},
+		Experiments: ExperimentsConfig{
+			Definitions: getEnv("EXPERIMENTS", ""),
+		},
+		Mail: MailConfig{
+			Provider:  getEnv("MAIL_PROVIDER", MailProviderLog),
+			From:      getEnv("MAIL_FROM", ""),
+			Product:   getEnv("MAIL_PRODUCT_NAME", "restapi"),
+			QueueSize: getEnvInt("MAIL_QUEUE_SIZE", 1000),
+
+			SMTPHost:     getEnv("SMTP_HOST", ""),
+			SMTPPort:     getEnvInt("SMTP_PORT", 587),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+
+			SESRegion: getEnv("SES_REGION", ""),
+		},
+		SMS: SMSConfig{
+			Provider:    getEnv("SMS_PROVIDER", SMSProviderLog),
+			CodeTTL:     getEnvDuration("SMS_CODE_TTL", 10*time.Minute),
+			RateLimit:   getEnvInt("SMS_RATE_LIMIT", 5),
+			RateWindow:  getEnvDuration("SMS_RATE_WINDOW", time.Hour),
+			OTPLogin:    getEnvBool("SMS_OTP_LOGIN", false),
+			CallbackURL: getEnv("SMS_STATUS_CALLBACK_URL", ""),
+
+			TwilioAccountSID: getEnv("TWILIO_ACCOUNT_SID", ""),
+			TwilioAuthToken:  getEnv("TWILIO_AUTH_TOKEN", ""),
+			TwilioFrom:       getEnv("TWILIO_FROM", ""),
+		},
+		GeoIP: GeoIPConfig{
+			DatabasePath: getEnv("GEOIP_DATABASE_PATH", ""),
+			CacheSize:    getEnvInt("GEOIP_CACHE_SIZE", 10000),
+		},
+		Anomaly: AnomalyConfig{
+			Enabled:           getEnvBool("ANOMALY_DETECTION", false),
+			FailedLogins:      getEnvInt("ANOMALY_FAILED_LOGINS", 10),
+			FailedLoginWindow: getEnvDuration("ANOMALY_FAILED_LOGIN_WINDOW", 15*time.Minute),
+			MaxTravelSpeed:    getEnvInt("ANOMALY_MAX_TRAVEL_KMH", 1000),
+			HistoryTTL:        getEnvDuration("ANOMALY_HISTORY_TTL", 30*24*time.Hour),
+			StepUp:            getEnvBool("ANOMALY_STEP_UP", true),
+			StepUpTTL:         getEnvDuration("ANOMALY_STEP_UP_TTL", 10*time.Minute),
+			WebhookURL:        getEnv("ANOMALY_WEBHOOK_URL", ""),
+			WebhookSecret:     getEnv("ANOMALY_WEBHOOK_SECRET", ""),
+		},
+		Enumeration: EnumerationConfig{
+			UniformSignup: getEnvBool("ENUMERATION_UNIFORM_SIGNUP", false),
+			Honeypot:      getEnvBool("SIGNUP_HONEYPOT", false),
+			Jitter:        getEnvDuration("AUTH_RESPONSE_JITTER", 0),
+		},
+		Static: StaticConfig{
+			Dir:      getEnv("STATIC_DIR", ""),
+			Embedded: getEnvBool("STATIC_EMBEDDED", false),
+			SPA:      getEnvBool("STATIC_SPA_FALLBACK", true),
+		},
+	}
+}
+
+// defaultStorageBackend keeps state in Redis whenever one is configured
+func defaultStorageBackend(redisURL string) string {
+	if redisURL != "" {
+		return StorageBackendRedis
+	}
+	return StorageBackendMemory
+}
+
+// lookupEnv returns a variable from the environment or, when unset there,
+// the configuration file being loaded
+func lookupEnv(key string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fileVars[key]
+}
+
+func getEnv(key, fallback string) string {
+	if value := lookupEnv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvList splits a comma-separated variable, dropping empty entries
+func getEnvList(key string, fallback []string) []string {
+	var values []string
+	for _, value := range strings.Split(lookupEnv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return fallback
+	}
+	return values
+}
+
+func getEnvInt(key string, fallback int) int {
+	if value, err := strconv.Atoi(lookupEnv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	if value, err := strconv.ParseBool(lookupEnv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+// getEnvFloats parses a comma-separated list of numbers in ascending order,
+// returning nil when unset or invalid
+func getEnvFloats(key string) []float64 {
+	var values []float64
+	for _, raw := range getEnvList(key, nil) {
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil || (len(values) > 0 && value <= values[len(values)-1]) {
+			return nil
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if value, err := time.ParseDuration(lookupEnv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+// getEnvDate parses a YYYY-MM-DD variable, returning the zero time when unset or invalid
+func getEnvDate(key string) time.Time {
+	if value, err := time.Parse(time.DateOnly, lookupEnv(key)); err == nil {
+		return value
+	}
+	return time.Time{}
+}
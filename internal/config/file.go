@@ -0,0 +1,57 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fileVars holds the variables of the configuration file while a Load runs;
+// loadMu serializes loads so they don't see each other's files
+var (
+	loadMu   sync.Mutex
+	fileVars map[string]string
+)
+
+// readConfigFile parses a file of KEY=VALUE lines, in the format of the
+// environment files read by Docker Compose and systemd. Blank lines and lines
+// starting with # are skipped, an "export " prefix is allowed and values may
+// be quoted.
+func readConfigFile(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("CONFIG_FILE: %w", err)
+	}
+
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("CONFIG_FILE %s:%d: expected KEY=VALUE", path, n)
+		}
+		value = strings.TrimSpace(value)
+		switch {
+		case strings.HasPrefix(value, `"`):
+			if value, err = strconv.Unquote(value); err != nil {
+				return nil, fmt.Errorf("CONFIG_FILE %s:%d: invalid quoted value for %s", path, n, key)
+			}
+		case len(value) >= 2 && strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'"):
+			value = value[1 : len(value)-1]
+		}
+		vars[key] = value
+	}
+	return vars, scanner.Err()
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "restapi.env")
+	contents := `
+# comments and blank lines are skipped
+LOG_LEVEL=warn
+export EXPERIMENTS="checkout=old:1,new:1"
+CORS_ALLOWED_ORIGINS='https://a.example.com, https://b.example.com'
+HTTP_ADDR=:9000
+`
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HTTP_ADDR", ":8081")
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.File != path || cfg.Logging.Level != "warn" || cfg.Experiments.Definitions != "checkout=old:1,new:1" {
+		t.Fatalf("file values not applied: %+v", cfg)
+	}
+	if strings.Join(cfg.Security.CORSOrigins, " ") != "https://a.example.com https://b.example.com" {
+		t.Fatalf("CORS origins: %q", cfg.Security.CORSOrigins)
+	}
+	if cfg.Server.HTTPAddr != ":8081" {
+		t.Fatalf("the environment must take precedence over the file, got %s", cfg.Server.HTTPAddr)
+	}
+
+	if err := os.WriteFile(path, []byte("LOG_LEVEL=warn\nnot a setting\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFile(path); err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Fatalf("malformed line: %v", err)
+	}
+
+	t.Setenv("CONFIG_FILE", filepath.Join(t.TempDir(), "missing.env"))
+	if err := Load().Validate(); err == nil || !strings.Contains(err.Error(), "CONFIG_FILE") {
+		t.Fatalf("unreadable CONFIG_FILE not reported by Validate: %v", err)
+	}
+}
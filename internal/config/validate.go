@@ -0,0 +1,103 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// DefaultJWTSecret is the development signing key used when JWT_SECRET is unset
+const DefaultJWTSecret = "mock-secret-key"
+
+// minProductionSecretBytes is the shortest JWT_SECRET accepted in production (HS256 key size)
+const minProductionSecretBytes = 32
+
+// Production reports whether ENV is "production"
+func (c *Config) Production() bool {
+	return c.Env == "production"
+}
+
+// Validate reports every setting that would keep the server from running
+// correctly, joined into one error
+func (c *Config) Validate() error {
+	var problems []error
+	check := func(failed bool, format string, args ...interface{}) {
+		if failed {
+			problems = append(problems, fmt.Errorf(format, args...))
+		}
+	}
+
+	if c.fileErr != nil {
+		problems = append(problems, c.fileErr)
+	}
+	check(c.Server.HTTPAddr == "", "HTTP_ADDR is empty")
+	if c.Server.SinglePort {
+		check(c.TLS.GRPCClientCAFile != "", "GRPC_TLS_CLIENT_CA is not supported with SINGLE_PORT, REST clients would need certificates too")
+	} else {
+		check(c.Server.GRPCAddr == "", "GRPC_ADDR is empty")
+		check(c.Server.HTTPAddr == c.Server.GRPCAddr, "REST and gRPC can't listen on the same address %s; set SINGLE_PORT=true to share it", c.Server.HTTPAddr)
+	}
+	check(c.Server.MetricsAddr != "" && c.Server.MetricsAddr == c.Server.HTTPAddr, "METRICS_ADDR must differ from HTTP_ADDR")
+	for _, proxy := range c.Server.TrustedProxies {
+		_, _, err := net.ParseCIDR(proxy)
+		check(err != nil && net.ParseIP(proxy) == nil, "TRUSTED_PROXIES: %q is not an IP address or CIDR range", proxy)
+	}
+	check(c.Database.URL == "", "DATABASE_URL is empty")
+	check(c.Auth.JWTSecret == "", "JWT_SECRET is empty")
+	if c.Production() {
+		check(c.Auth.JWTSecret == DefaultJWTSecret, "JWT_SECRET must be set in production")
+		check(c.Auth.JWTSecret != DefaultJWTSecret && len(c.Auth.JWTSecret) < minProductionSecretBytes,
+			"JWT_SECRET must be at least %d bytes in production", minProductionSecretBytes)
+	}
+	check(c.Auth.ImpersonationTTL <= 0, "IMPERSONATION_TOKEN_TTL must be positive")
+
+	check(len(c.TLS.AutocertDomains) > 0 && c.TLS.CertFile != "", "TLS_AUTOCERT_DOMAINS and TLS_CERT_FILE are mutually exclusive")
+
+	check(c.Security.MaxBodyBytes < 0, "MAX_BODY_BYTES must not be negative")
+	check(c.Security.MaxJSONDepth < 0, "MAX_JSON_DEPTH must not be negative")
+
+	check(c.API.RequestTimeout < 0, "REQUEST_TIMEOUT must not be negative")
+	check(c.API.LongRequestTimeout < 0, "LONG_REQUEST_TIMEOUT must not be negative")
+	check(c.Database.QueryTimeout < 0, "DB_QUERY_TIMEOUT must not be negative")
+	check(c.Database.SlowQueryThreshold < 0, "DB_SLOW_QUERY_THRESHOLD must not be negative")
+	check(c.Database.ConnectTimeout < 0, "DB_CONNECT_TIMEOUT must not be negative")
+	check(c.Database.HealthCheckInterval < 0, "DB_HEALTH_CHECK_INTERVAL must not be negative")
+	check(c.Database.HealthCheckInterval > 0 && c.Database.OutageThreshold <= 0, "DB_OUTAGE_THRESHOLD must be positive")
+	check(len(c.Database.ReplicaURLs) > 0 && c.Database.ReplicaCheckInterval <= 0, "DB_REPLICA_CHECK_INTERVAL must be positive")
+	check(c.Metrics.PushURL != "" && c.Metrics.PushInterval <= 0, "METRICS_PUSH_INTERVAL must be positive")
+	check(c.Captcha.Provider != "" && c.Captcha.Secret == "", "CAPTCHA_SECRET is required with CAPTCHA_PROVIDER")
+
+	switch c.Mail.Provider {
+	case MailProviderLog:
+	case MailProviderSMTP:
+		check(c.Mail.SMTPHost == "", "SMTP_HOST is required with MAIL_PROVIDER=smtp")
+		check(c.Mail.From == "", "MAIL_FROM is required with MAIL_PROVIDER=smtp")
+	case MailProviderSES:
+		check(c.Mail.SESRegion == "", "SES_REGION is required with MAIL_PROVIDER=ses")
+		check(c.Mail.From == "", "MAIL_FROM is required with MAIL_PROVIDER=ses")
+	default:
+		check(true, "unknown MAIL_PROVIDER %q", c.Mail.Provider)
+	}
+	check(c.Mail.QueueSize <= 0, "MAIL_QUEUE_SIZE must be positive")
+
+	switch c.SMS.Provider {
+	case SMSProviderLog:
+	case SMSProviderTwilio:
+		check(c.SMS.TwilioAccountSID == "" || c.SMS.TwilioAuthToken == "", "TWILIO_ACCOUNT_SID and TWILIO_AUTH_TOKEN are required with SMS_PROVIDER=twilio")
+		check(c.SMS.TwilioFrom == "", "TWILIO_FROM is required with SMS_PROVIDER=twilio")
+	default:
+		check(true, "unknown SMS_PROVIDER %q", c.SMS.Provider)
+	}
+	check(c.SMS.CodeTTL <= 0, "SMS_CODE_TTL must be positive")
+	check(c.SMS.RateLimit <= 0 || c.SMS.RateWindow <= 0, "SMS_RATE_LIMIT and SMS_RATE_WINDOW must be positive")
+	check(c.GeoIP.CacheSize < 0, "GEOIP_CACHE_SIZE must not be negative")
+	if c.Anomaly.Enabled {
+		check(c.Anomaly.FailedLogins <= 0 || c.Anomaly.FailedLoginWindow <= 0, "ANOMALY_FAILED_LOGINS and ANOMALY_FAILED_LOGIN_WINDOW must be positive")
+		check(c.Anomaly.MaxTravelSpeed <= 0, "ANOMALY_MAX_TRAVEL_KMH must be positive")
+		check(c.Anomaly.HistoryTTL <= 0 || c.Anomaly.StepUpTTL <= 0, "ANOMALY_HISTORY_TTL and ANOMALY_STEP_UP_TTL must be positive")
+	}
+	check(c.Enumeration.Jitter < 0, "AUTH_RESPONSE_JITTER must not be negative")
+	check(c.Static.Embedded && c.Static.Dir != "", "STATIC_DIR and STATIC_EMBEDDED are mutually exclusive")
+
+	return errors.Join(problems...)
+}
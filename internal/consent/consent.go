@@ -0,0 +1,110 @@
+// Package consent records which versions of the terms of service users
+// accepted, and tells whether they accepted the version currently in force.
+package consent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/114windd/restapi/internal/cache"
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// ErrStaleVersion is returned when a user accepts a version other than the current one
+var ErrStaleVersion = errors.New("not the current version of the terms of service")
+
+// Store persists consent records
+type Store interface {
+	CreateConsent(ctx context.Context, consent *models.Consent) error
+	ListConsents(ctx context.Context, userID uint) ([]models.Consent, error)
+}
+
+// Service tracks acceptance of the terms of service. With no terms version
+// configured every user counts as having accepted.
+type Service struct {
+	store        Store
+	cache        *cache.Cache
+	termsVersion string
+}
+
+// NewService creates a Service requiring termsVersion of the terms of
+// service. Accepted versions are cached in c.
+func NewService(store Store, c *cache.Cache, termsVersion string) *Service {
+	return &Service{store: store, cache: c, termsVersion: termsVersion}
+}
+
+// TermsVersion returns the version users must accept; empty when none is required
+func (s *Service) TermsVersion() string {
+	return s.termsVersion
+}
+
+func acceptedCacheKey(tenantID string, userID uint) string {
+	return fmt.Sprintf("%s:terms:%d", tenantID, userID)
+}
+
+// HasAccepted reports whether a user accepted the current terms of service
+func (s *Service) HasAccepted(ctx context.Context, userID uint) (bool, error) {
+	if s.termsVersion == "" {
+		return true, nil
+	}
+
+	key := acceptedCacheKey(database.TenantFromContext(ctx), userID)
+	var accepted string
+	if s.cache.Get(ctx, key, &accepted) {
+		return accepted == s.termsVersion, nil
+	}
+
+	consents, err := s.store.ListConsents(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	accepted = latestTerms(consents)
+	s.cache.Set(ctx, key, accepted)
+	return accepted == s.termsVersion, nil
+}
+
+// Accept records that a user accepted version of document. Only the
+// current version of the terms of service can be accepted.
+func (s *Service) Accept(ctx context.Context, userID uint, document, version, ip, userAgent string) (*models.Consent, error) {
+	if document == "" {
+		document = models.ConsentTerms
+	}
+	if document == models.ConsentTerms && version != s.termsVersion {
+		return nil, ErrStaleVersion
+	}
+
+	tenantID := database.TenantFromContext(ctx)
+	consent := &models.Consent{
+		UserID:     userID,
+		TenantID:   tenantID,
+		Document:   document,
+		Version:    version,
+		IP:         ip,
+		UserAgent:  userAgent,
+		AcceptedAt: time.Now(),
+	}
+	if err := s.store.CreateConsent(ctx, consent); err != nil {
+		return nil, err
+	}
+	s.cache.Delete(ctx, acceptedCacheKey(tenantID, userID))
+	return consent, nil
+}
+
+// History returns the consents a user gave, newest first
+func (s *Service) History(ctx context.Context, userID uint) ([]models.Consent, error) {
+	return s.store.ListConsents(ctx, userID)
+}
+
+// latestTerms returns the most recently accepted terms version in consents,
+// which are ordered newest first
+func latestTerms(consents []models.Consent) string {
+	for _, c := range consents {
+		if c.Document == models.ConsentTerms {
+			return c.Version
+		}
+	}
+	return ""
+}
@@ -0,0 +1,174 @@
+// Package cron runs periodic maintenance tasks in the background.
+package cron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/metrics"
+)
+
+// Task is a unit of periodic work. Tasks run on every instance, so they
+// must be idempotent and safe to run concurrently with themselves.
+type Task interface {
+	Name() string
+	Run(ctx context.Context) error
+}
+
+// funcTask adapts a function to Task
+type funcTask struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+func (t funcTask) Name() string                  { return t.name }
+func (t funcTask) Run(ctx context.Context) error { return t.fn(ctx) }
+
+// Func returns a Task named name that calls fn
+func Func(name string, fn func(ctx context.Context) error) Task {
+	return funcTask{name: name, fn: fn}
+}
+
+type entry struct {
+	task     Task
+	interval time.Duration
+}
+
+// Scheduler runs registered tasks at fixed intervals
+type Scheduler struct {
+	mu      sync.Mutex
+	entries []entry
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	failing map[string]error // tasks whose latest run failed
+}
+
+// NewScheduler creates an empty scheduler
+func NewScheduler() *Scheduler {
+	return &Scheduler{failing: make(map[string]error)}
+}
+
+// Register adds a task run every interval once the scheduler starts.
+// Tasks with a non-positive interval are disabled.
+func (s *Scheduler) Register(task Task, interval time.Duration) {
+	if interval <= 0 {
+		logger.Log.WithField("task", task.Name()).Info("Scheduled task disabled")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry{task: task, interval: interval})
+}
+
+// Tasks returns the names of the registered tasks
+func (s *Scheduler) Tasks() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, len(s.entries))
+	for i, e := range s.entries {
+		names[i] = e.task.Name()
+	}
+	return names
+}
+
+// Start runs every task on its interval until Stop is called
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	for _, e := range s.entries {
+		s.wg.Add(1)
+		go s.loop(ctx, e)
+	}
+	logger.Log.WithField("tasks", len(s.entries)).Info("Scheduler started")
+}
+
+// Stop cancels running tasks and waits for them to return
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.cancel = nil
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		s.wg.Wait()
+	}
+}
+
+// Check reports the scheduler unhealthy while the latest run of a task
+// failed, for the readiness registry
+func (s *Scheduler) Check(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.failing))
+	for name := range s.failing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	errs := make([]error, len(names))
+	for i, name := range names {
+		errs[i] = fmt.Errorf("task %s: %w", name, s.failing[name])
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Scheduler) loop(ctx context.Context, e entry) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := RunOnce(ctx, e.task)
+			s.mu.Lock()
+			if err != nil {
+				s.failing[e.task.Name()] = err
+			} else {
+				delete(s.failing, e.task.Name())
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// RunOnce runs a task immediately, recording its outcome. Panics are
+// recovered, and returned as errors, so one faulty task can't take the
+// process down.
+func RunOnce(ctx context.Context, task Task) (err error) {
+	start := time.Now()
+	entry := logger.Log.WithField("task", task.Name())
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+			entry.WithField("panic", r).Error("Scheduled task panicked")
+			metrics.RecordTaskRun(task.Name(), "panic", time.Since(start))
+		}
+	}()
+
+	err = task.Run(ctx)
+	duration := time.Since(start)
+	if err != nil {
+		entry.WithError(err).Error("Scheduled task failed")
+		metrics.RecordTaskRun(task.Name(), "error", duration)
+		return err
+	}
+	entry.WithField("duration_ms", duration.Milliseconds()).Debug("Scheduled task completed")
+	metrics.RecordTaskRun(task.Name(), "success", duration)
+	return nil
+}
@@ -0,0 +1,69 @@
+package cron
+
+import (
+	"context"
+	"time"
+
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/privacy"
+	"github.com/114windd/restapi/internal/recovery"
+	"github.com/114windd/restapi/internal/session"
+)
+
+// PurgeExpiredSessions drops expired sessions and their index entries
+func PurgeExpiredSessions(sessions *session.Manager) Task {
+	return Func("purge_expired_sessions", func(ctx context.Context) error {
+		purged, err := sessions.PurgeExpired(ctx)
+		if err != nil {
+			return err
+		}
+		if purged > 0 {
+			logger.Log.WithField("purged", purged).Info("Purged expired sessions")
+		}
+		return nil
+	})
+}
+
+// PurgeUserHistory compacts users_history by deleting snapshots superseded
+// more than retention ago
+func PurgeUserHistory(repo database.UserRepository, retention time.Duration) Task {
+	return Func("purge_user_history", func(ctx context.Context) error {
+		purged, err := repo.PurgeUserHistory(ctx, time.Now().Add(-retention))
+		if err != nil {
+			return err
+		}
+		if purged > 0 {
+			logger.Log.WithField("purged", purged).Info("Purged old user history")
+		}
+		return nil
+	})
+}
+
+// ExpireRecoveryTokens clears account recovery tokens that were never redeemed
+func ExpireRecoveryTokens(service *recovery.Service) Task {
+	return Func("expire_recovery_tokens", func(ctx context.Context) error {
+		expired, err := service.ExpireTokens(ctx)
+		if err != nil {
+			return err
+		}
+		if expired > 0 {
+			logger.Log.WithField("expired", expired).Info("Expired unused recovery tokens")
+		}
+		return nil
+	})
+}
+
+// PurgeExpiredExports deletes data export archives past their retention
+func PurgeExpiredExports(service *privacy.Service) Task {
+	return Func("purge_expired_exports", func(ctx context.Context) error {
+		purged, err := service.PurgeExpired(ctx)
+		if err != nil {
+			return err
+		}
+		if purged > 0 {
+			logger.Log.WithField("purged", purged).Info("Purged expired data exports")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/retry"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// CreateAttributeDefinition creates a custom attribute definition with retry logic
+func (p *PostgresRepository) CreateAttributeDefinition(ctx context.Context, def *models.AttributeDefinition) error {
+	config := retry.DefaultRetryConfig()
+
+	return retry.ExecuteWithRetry(ctx, "create_attribute_definition", func() error {
+		logger.LogDatabase("create", "attribute_definitions").WithField("name", def.Name).Debug("Attempting to create attribute definition")
+
+		err := p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.Create(def).Error
+		})
+		if dup := uniqueViolation(err); dup != nil {
+			logger.LogDatabase("create", "attribute_definitions").WithError(err).Warn("Unique constraint violation - not retrying")
+			return retry.Permanent(dup)
+		}
+		return err
+	}, config)
+}
+
+// GetAttributeDefinitions gets all custom attribute definitions with retry logic
+func (p *PostgresRepository) GetAttributeDefinitions(ctx context.Context) ([]models.AttributeDefinition, error) {
+	var defs []models.AttributeDefinition
+	config := retry.DefaultRetryConfig()
+
+	err := retry.ExecuteWithRetry(ctx, "get_attribute_definitions", func() error {
+		logger.LogDatabase("select", "attribute_definitions").Debug("Attempting to fetch attribute definitions")
+
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.Order("name").Find(&defs).Error
+		})
+	}, config)
+
+	if err != nil {
+		return nil, err
+	}
+	return defs, nil
+}
+
+// DeleteAttributeDefinition deletes a custom attribute definition with retry logic
+func (p *PostgresRepository) DeleteAttributeDefinition(ctx context.Context, id uint) error {
+	config := retry.DefaultRetryConfig()
+
+	return retry.ExecuteWithRetry(ctx, "delete_attribute_definition", func() error {
+		logger.LogDatabase("delete", "attribute_definitions").WithField("id", id).Debug("Attempting to delete attribute definition")
+
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.Delete(&models.AttributeDefinition{}, id).Error
+		})
+	}, config)
+}
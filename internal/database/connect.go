@@ -0,0 +1,142 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/retry"
+)
+
+// ErrNotConnected is reported by CheckConnection until a database connected
+// in the background is up and migrated
+var ErrNotConnected = errors.New("database not connected yet")
+
+const (
+	// connectAttemptTimeout bounds each attempt, so an unresponsive host
+	// doesn't hold up the retries until the OS gives up on it
+	connectAttemptTimeout = 5 * time.Second
+	connectBaseDelay      = 250 * time.Millisecond
+	connectMaxDelay       = 5 * time.Second
+)
+
+// connectionState tracks a connection made in the background
+type connectionState struct {
+	mu      sync.RWMutex
+	pending bool  // ConnectInBackground hasn't finished
+	err     error // why its last attempt failed
+}
+
+// WaitForConnection pings the database until it answers, backing off
+// between attempts. It tries at least once and gives up when ctx is done,
+// returning the last failure.
+func (p *PostgresRepository) WaitForConnection(ctx context.Context) error {
+	attempts := 0
+	err := keepTrying(ctx, func() error {
+		attempts++
+		return p.pingOnce(ctx)
+	}, func(err error, delay time.Duration) {
+		logger.LogDatabase("connect", "").WithError(err).
+			WithField("attempt", attempts).
+			WithField("retry_delay_ms", delay.Milliseconds()).
+			Warn("Database unavailable, retrying")
+	})
+	if err == nil && attempts > 1 {
+		logger.LogDatabase("connect", "").WithField("attempt", attempts).Info("Database is up")
+	}
+	return err
+}
+
+// ConnectInBackground waits for a database opened with OpenLazy and
+// migrates it, retrying until both succeed or ctx is done. Until then
+// CheckConnection reports ErrNotConnected. It returns immediately; call it
+// before the repository serves requests.
+func (p *PostgresRepository) ConnectInBackground(ctx context.Context, migration MigrationOptions) {
+	p.conn.mu.Lock()
+	p.conn.pending = true
+	p.conn.mu.Unlock()
+
+	go func() {
+		err := keepTrying(ctx, func() error {
+			if err := p.pingOnce(ctx); err != nil {
+				return err
+			}
+			return p.Migrate(migration)
+		}, func(err error, delay time.Duration) {
+			logger.LogDatabase("connect", "").WithError(err).
+				WithField("retry_delay_ms", delay.Milliseconds()).
+				Warn("Database not ready, retrying")
+			p.conn.mu.Lock()
+			p.conn.err = err
+			p.conn.mu.Unlock()
+		})
+		if err != nil {
+			return
+		}
+
+		p.conn.mu.Lock()
+		p.conn.pending, p.conn.err = false, nil
+		p.conn.mu.Unlock()
+		logger.Log.Info("Database connected and migrated successfully")
+	}()
+}
+
+// connecting reports whether ConnectInBackground is still at work
+func (p *PostgresRepository) connecting() bool {
+	p.conn.mu.RLock()
+	defer p.conn.mu.RUnlock()
+	return p.conn.pending
+}
+
+// pingOnce pings within connectAttemptTimeout, even if ctx is already done,
+// so that a zero wait still makes one attempt
+func (p *PostgresRepository) pingOnce(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), connectAttemptTimeout)
+	defer cancel()
+	return p.Ping(ctx)
+}
+
+// keepTrying calls attempt until it succeeds or ctx is done, telling failed
+// about each failure and the delay before the next attempt. It tries at
+// least once and returns the last failure.
+func keepTrying(ctx context.Context, attempt func() error, failed func(err error, delay time.Duration)) error {
+	for n := 1; ; n++ {
+		err := attempt()
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+
+		delay := retry.Backoff(n, connectBaseDelay, connectMaxDelay)
+		failed(err, delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// CheckConnection reports ErrNotConnected while ConnectInBackground is
+// still at work, an outage found by MonitorConnection as degrading the
+// service, and pings the database otherwise. It is the readiness check of
+// the database.
+func (p *PostgresRepository) CheckConnection(ctx context.Context) error {
+	if p.Unavailable() {
+		return p.outage()
+	}
+	p.conn.mu.RLock()
+	pending, err := p.conn.pending, p.conn.err
+	p.conn.mu.RUnlock()
+	if pending {
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrNotConnected, err)
+		}
+		return ErrNotConnected
+	}
+	return p.Ping(ctx)
+}
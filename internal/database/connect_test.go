@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/114windd/restapi/internal/logger"
+)
+
+func init() {
+	logger.Init()
+	logger.Log.SetOutput(io.Discard)
+}
+
+// unreachable refuses connections at once: nothing listens on port 1
+const unreachable = "host=127.0.0.1 port=1 user=restapi dbname=restapi sslmode=disable"
+
+func TestConnectUnreachable(t *testing.T) {
+	start := time.Now()
+	if _, err := Connect(unreachable, MigrationOptions{LockTimeout: time.Second}, 0); err == nil {
+		t.Fatal("Connect to an unreachable database succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Connect without a wait retried for %s", elapsed)
+	}
+
+	start = time.Now()
+	if _, err := Connect(unreachable, MigrationOptions{LockTimeout: time.Second}, 600*time.Millisecond); err == nil {
+		t.Fatal("Connect to an unreachable database succeeded")
+	}
+	if elapsed := time.Since(start); elapsed < 600*time.Millisecond {
+		t.Fatalf("Connect gave up after %s, before its wait", elapsed)
+	}
+}
+
+func TestConnectInBackground(t *testing.T) {
+	repo, err := OpenLazy(unreachable)
+	if err != nil {
+		t.Fatalf("OpenLazy must not need the database: %v", err)
+	}
+	defer repo.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo.ConnectInBackground(ctx, MigrationOptions{LockTimeout: time.Second})
+	if err := repo.CheckConnection(ctx); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("expected ErrNotConnected while connecting, got %v", err)
+	}
+
+	// The reason shows up once an attempt has failed
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		err := repo.CheckConnection(ctx)
+		if !errors.Is(err, ErrNotConnected) {
+			t.Fatalf("expected ErrNotConnected, got %v", err)
+		}
+		if err.Error() != ErrNotConnected.Error() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the failed attempt was not reported")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
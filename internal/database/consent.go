@@ -0,0 +1,37 @@
+package database
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/retry"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// CreateConsent records that a user accepted a document
+func (p *PostgresRepository) CreateConsent(ctx context.Context, consent *models.Consent) error {
+	logger.LogDatabase("create", "consents").WithField("user_id", consent.UserID).Debug("Attempting to record consent")
+
+	return p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Create(consent).Error
+	})
+}
+
+// ListConsents returns a user's consents, newest first
+func (p *PostgresRepository) ListConsents(ctx context.Context, userID uint) ([]models.Consent, error) {
+	var consents []models.Consent
+	config := retry.DefaultRetryConfig()
+
+	err := retry.ExecuteWithRetry(ctx, "list_consents", func() error {
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.Where("user_id = ?", userID).Order("accepted_at DESC, id DESC").Find(&consents).Error
+		})
+	}, config)
+
+	if err != nil {
+		return nil, err
+	}
+	return consents, nil
+}
@@ -1,67 +1,230 @@
 package database
 
 import (
+	"context"
 	"errors"
-	"os"
+	"fmt"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	gormlogger "gorm.io/gorm/logger"
 
 	"github.com/114windd/restapi/internal/logger"
 	"github.com/114windd/restapi/internal/retry"
 	"github.com/114windd/restapi/pkg/models"
 )
 
-var db *gorm.DB
+// ErrVersionConflict is returned by UpdateUser when the stored record no
+// longer has the version the caller read
+var ErrVersionConflict = errors.New("user was modified by another request")
 
-// InitDB initializes the database connection
-func InitDB() {
-	// Database connection string
-	dsn := "host=localhost user=postgres password=postgres dbname=restapi port=5432 sslmode=disable"
+// ErrDuplicateKey is returned when a write violates a unique constraint,
+// e.g. a second user with the same email address
+var ErrDuplicateKey = errors.New("duplicate key value violates unique constraint")
 
-	// You can override with environment variable
-	if dbURL := os.Getenv("DATABASE_URL"); dbURL != "" {
-		dsn = dbURL
+// uniqueViolation translates a Postgres unique violation into ErrDuplicateKey,
+// returning nil for any other error
+func uniqueViolation(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return fmt.Errorf("%w: %s", ErrDuplicateKey, pgErr.ConstraintName)
 	}
+	return nil
+}
+
+// UserRepository is the persistence layer used by the service package
+type UserRepository interface {
+	CreateUser(ctx context.Context, user *models.User) error
+	FindUserByEmail(ctx context.Context, email string) (*models.User, error)
+	FindUserByVerifiedPhone(ctx context.Context, phone string) (*models.User, error)
+	UserExistsByEmail(ctx context.Context, email string) (bool, error)
+	FindUserByID(ctx context.Context, id uint) (*models.User, error)
+	FindUsersByIDs(ctx context.Context, ids []uint) ([]models.User, error)
+	UpdateUser(ctx context.Context, user *models.User) error
+	DeleteUser(ctx context.Context, id uint) error
+	StreamUsers(ctx context.Context, status string, attributeFilters map[string]string, batchSize int, fn func(batch []models.User) error) error
+	ListUsersPage(ctx context.Context, q models.UserListQuery) ([]models.User, error)
+	SearchUsers(ctx context.Context, query string, limit int) ([]models.User, error)
+	GetRecentlyActiveUsers(ctx context.Context, limit int) ([]models.User, error)
+	TouchLastLogin(ctx context.Context, id uint, at time.Time) error
+	CountUsers(ctx context.Context, filter []models.UserFilterTerm) (int64, error)
+	GetUserHistory(ctx context.Context, userID uint) ([]models.UserHistory, error)
+	PurgeUserHistory(ctx context.Context, before time.Time) (int64, error)
+
+	CreateAttributeDefinition(ctx context.Context, def *models.AttributeDefinition) error
+	GetAttributeDefinitions(ctx context.Context) ([]models.AttributeDefinition, error)
+	DeleteAttributeDefinition(ctx context.Context, id uint) error
+
+	GetSignupDomainPolicy(ctx context.Context) (*models.SignupDomainPolicy, error)
+	SaveSignupDomainPolicy(ctx context.Context, policy *models.SignupDomainPolicy) error
+
+	RecordExposure(ctx context.Context, exposure *models.ExperimentExposure) error
+
+	FindIdentity(ctx context.Context, provider, subject string) (*models.Identity, error)
+	CreateIdentity(ctx context.Context, identity *models.Identity) error
+
+	ListDevicesByUser(ctx context.Context, userID uint) ([]models.KnownDevice, error)
+	CreateDevice(ctx context.Context, device *models.KnownDevice) error
+	TouchDevice(ctx context.Context, id uint, ip string, at time.Time) error
+
+	CreateSecurityFlag(ctx context.Context, flag *models.SecurityFlag) error
+	ListSecurityFlags(ctx context.Context, status string) ([]models.SecurityFlag, error)
+	ResolveSecurityFlag(ctx context.Context, id, adminID uint, at time.Time) (*models.SecurityFlag, error)
+
+	CreateRecoveryCase(ctx context.Context, rc *models.RecoveryCase, event *models.RecoveryCaseEvent) error
+	FindRecoveryCase(ctx context.Context, id uint) (*models.RecoveryCase, error)
+	FindRecoveryCaseByToken(ctx context.Context, tokenHash string, now time.Time) (*models.RecoveryCase, error)
+	ListRecoveryCases(ctx context.Context, status string) ([]models.RecoveryCase, error)
+	UpdateRecoveryCase(ctx context.Context, rc *models.RecoveryCase, event *models.RecoveryCaseEvent) error
+	ExpireRecoveryTokens(ctx context.Context, now time.Time) (int64, error)
+	ListRecoveryCasesByUser(ctx context.Context, userID uint) ([]models.RecoveryCase, error)
+
+	CreateDataExport(ctx context.Context, export *models.DataExport) error
+	UpdateDataExport(ctx context.Context, export *models.DataExport) error
+	ListDataExports(ctx context.Context, userID uint) ([]models.DataExport, error)
+	ListExpiredDataExports(ctx context.Context, now time.Time) ([]models.DataExport, error)
+	DeleteDataExport(ctx context.Context, id uint) error
+	ListIdentitiesByUser(ctx context.Context, userID uint) ([]models.Identity, error)
+	AnonymizeUserRecords(ctx context.Context, userID uint) error
+
+	CreateConsent(ctx context.Context, consent *models.Consent) error
+	ListConsents(ctx context.Context, userID uint) ([]models.Consent, error)
+
+	GetPreferences(ctx context.Context, userID uint) (models.Preferences, error)
+	MergePreferences(ctx context.Context, userID uint, patch models.Preferences) (models.Preferences, error)
+
+	CreateInvitation(ctx context.Context, inv *models.Invitation) error
+	FindInvitation(ctx context.Context, id uint) (*models.Invitation, error)
+	ClaimInvitation(ctx context.Context, tokenHash string, now time.Time) (*models.Invitation, error)
+	ListInvitations(ctx context.Context, status string) ([]models.Invitation, error)
+	UpdateInvitation(ctx context.Context, inv *models.Invitation) error
+
+	CreateOrganization(ctx context.Context, org *models.Organization, owner *models.Membership) error
+	FindOrganization(ctx context.Context, id uint) (*models.Organization, error)
+	ListOrganizationsByUser(ctx context.Context, userID uint) ([]models.Organization, error)
+	UpdateOrganization(ctx context.Context, org *models.Organization) error
+	DeleteOrganization(ctx context.Context, id uint) error
+	FindMembership(ctx context.Context, orgID, userID uint) (*models.Membership, error)
+	ListMemberships(ctx context.Context, orgID uint) ([]models.Membership, error)
+	CreateMembership(ctx context.Context, m *models.Membership) error
+	UpdateMembership(ctx context.Context, m *models.Membership) error
+	DeleteMembership(ctx context.Context, orgID, userID uint) error
+
+	Ping(ctx context.Context) error
+}
+
+// PostgresRepository is the Postgres-backed UserRepository
+type PostgresRepository struct {
+	db *gorm.DB
+
+	hooksMu      sync.RWMutex
+	sessionHooks []SessionHook
+	queryTimeout time.Duration
 
-	var err error
-	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	replicas *replicaSet // nil without read replicas
+	stats    *queryStats
+	conn     connectionState
+	circuit  circuit
+}
+
+var _ UserRepository = (*PostgresRepository)(nil)
+
+// Connect opens the database and applies migrations. A database that
+// doesn't answer is retried with backoff for up to wait, e.g. while it
+// starts beside the server; 0 gives up after the first attempt. When
+// another replica is already migrating, it waits up to
+// migration.LockTimeout for it to finish.
+func Connect(dsn string, migration MigrationOptions, wait time.Duration) (*PostgresRepository, error) {
+	repo, err := OpenLazy(dsn)
 	if err != nil {
-		logger.Log.WithError(err).Fatal("Failed to connect to database")
+		return nil, err
 	}
 
-	// Auto-migrate the schema
-	logger.LogDatabase("migrate", "users").Info("Running database migration")
-	err = db.AutoMigrate(&models.User{})
-	if err != nil {
-		logger.Log.WithError(err).Fatal("Failed to migrate database")
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+	if err := repo.WaitForConnection(ctx); err != nil {
+		_ = repo.Close()
+		return nil, fmt.Errorf("connect to database: %w", err)
+	}
+	if err := repo.Migrate(migration); err != nil {
+		_ = repo.Close()
+		return nil, err
 	}
 
 	logger.Log.Info("Database connected and migrated successfully")
+	return repo, nil
+}
+
+// Open connects to the database without applying migrations, e.g. to
+// inspect the migration status
+func Open(dsn string) (*PostgresRepository, error) {
+	return open(dsn, false)
+}
+
+// OpenLazy prepares the database handle without connecting, so the server
+// can start before the database does. Operations fail until it is up; see
+// WaitForConnection and ConnectInBackground.
+func OpenLazy(dsn string) (*PostgresRepository, error) {
+	return open(dsn, true)
+}
+
+func open(dsn string, lazy bool) (*PostgresRepository, error) {
+	// Slow queries are logged by queryStats without their parameters, and
+	// failures by the repository, so GORM's own logger stays silent
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: gormlogger.Discard, DisableAutomaticPing: lazy})
+	if err != nil {
+		return nil, fmt.Errorf("connect to database: %w", err)
+	}
+	stats := &queryStats{}
+	if err := db.Use(stats); err != nil {
+		return nil, fmt.Errorf("register query stats: %w", err)
+	}
+	return &PostgresRepository{db: db, stats: stats}, nil
+}
+
+// Migrate applies pending migrations, waiting up to opts.LockTimeout for
+// another replica that is already migrating
+func (p *PostgresRepository) Migrate(opts MigrationOptions) error {
+	return migrate(p.db, opts)
+}
+
+// Close closes the underlying connection pools
+func (p *PostgresRepository) Close() error {
+	if p.replicas != nil {
+		p.replicas.close()
+	}
+	sqlDB, err := p.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
 }
 
-// GetDB returns the database instance
-func GetDB() *gorm.DB {
-	return db
+// DB returns the underlying database handle
+func (p *PostgresRepository) DB() *gorm.DB {
+	return p.db
 }
 
 // Database operations with retry logic
 
-// CreateUserWithRetry creates a user with retry logic
-func CreateUserWithRetry(user *models.User) error {
+// CreateUser creates a user with retry logic
+func (p *PostgresRepository) CreateUser(ctx context.Context, user *models.User) error {
 	config := retry.DefaultRetryConfig()
 
-	err := retry.ExecuteWithRetry("create_user", func() error {
+	err := retry.ExecuteWithRetry(ctx, "create_user", func() error {
 		logger.LogDatabase("create", "users").WithField("email", user.Email).Debug("Attempting to create user")
 
-		err := db.Create(user).Error
-		if err != nil {
-			// Don't retry on unique constraint violations (business logic errors)
-			if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "UNIQUE constraint") {
-				logger.LogDatabase("create", "users").WithError(err).Warn("Unique constraint violation - not retrying")
-				return err // Return immediately, don't retry
-			}
+		err := p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.Create(user).Error
+		})
+		if dup := uniqueViolation(err); dup != nil {
+			logger.LogDatabase("create", "users").WithError(err).Warn("Unique constraint violation - not retrying")
+			return retry.Permanent(dup)
 		}
 		return err
 	}, config)
@@ -71,20 +234,22 @@ func CreateUserWithRetry(user *models.User) error {
 	return err
 }
 
-// FindUserByEmailWithRetry finds a user by email with retry logic
-func FindUserByEmailWithRetry(email string) (*models.User, error) {
+// FindUserByEmail finds a user of the tenant in ctx by email with retry logic
+func (p *PostgresRepository) FindUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
 	config := retry.DefaultRetryConfig()
 
-	err := retry.ExecuteWithRetry("find_user_by_email", func() error {
+	err := retry.ExecuteWithRetry(ctx, "find_user_by_email", func() error {
 		logger.LogDatabase("select", "users").WithField("email", email).Debug("Attempting to find user by email")
 
-		err := db.Where("email = ?", email).First(&user).Error
+		err := p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.Where("tenant_id = ? AND lower(email) = lower(?)", TenantFromContext(ctx), email).First(&user).Error
+		})
 		if err != nil {
 			// Don't retry on "not found" errors (business logic errors)
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				logger.LogDatabase("select", "users").WithField("email", email).Debug("User not found - not retrying")
-				return err // Return immediately, don't retry
+				return retry.Permanent(err)
 			}
 		}
 		return err
@@ -98,20 +263,62 @@ func FindUserByEmailWithRetry(email string) (*models.User, error) {
 	return &user, nil
 }
 
-// FindUserByIDWithRetry finds a user by ID with retry logic
-func FindUserByIDWithRetry(id uint) (*models.User, error) {
+// FindUserByVerifiedPhone finds the user who verified phone, with retry logic
+func (p *PostgresRepository) FindUserByVerifiedPhone(ctx context.Context, phone string) (*models.User, error) {
 	var user models.User
 	config := retry.DefaultRetryConfig()
 
-	err := retry.ExecuteWithRetry("find_user_by_id", func() error {
+	err := retry.ExecuteWithRetry(ctx, "find_user_by_verified_phone", func() error {
+		logger.LogDatabase("select", "users").Debug("Attempting to find user by verified phone")
+
+		err := p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.Where("tenant_id = ? AND phone = ? AND phone_verified_at IS NOT NULL", TenantFromContext(ctx), phone).First(&user).Error
+		})
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return retry.Permanent(err)
+		}
+		return err
+	}, config)
+
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UserExistsByEmail reports whether a user of the tenant in ctx has the
+// email with SELECT EXISTS, without loading the row
+func (p *PostgresRepository) UserExistsByEmail(ctx context.Context, email string) (bool, error) {
+	var exists bool
+	config := retry.DefaultRetryConfig()
+
+	err := retry.ExecuteWithRetry(ctx, "user_exists_by_email", func() error {
+		logger.LogDatabase("select", "users").Debug("Attempting to check whether an email is taken")
+
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.Raw("SELECT EXISTS (SELECT 1 FROM users WHERE tenant_id = ? AND lower(email) = lower(?))", TenantFromContext(ctx), email).Scan(&exists).Error
+		})
+	}, config)
+
+	return exists, err
+}
+
+// FindUserByID finds a user by ID with retry logic
+func (p *PostgresRepository) FindUserByID(ctx context.Context, id uint) (*models.User, error) {
+	var user models.User
+	config := retry.DefaultRetryConfig()
+
+	err := retry.ExecuteWithRetry(ctx, "find_user_by_id", func() error {
 		logger.LogDatabase("select", "users").WithField("user_id", id).Debug("Attempting to find user by ID")
 
-		err := db.First(&user, id).Error
+		err := p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.First(&user, id).Error
+		})
 		if err != nil {
 			// Don't retry on "not found" errors
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				logger.LogDatabase("select", "users").WithField("user_id", id).Debug("User not found - not retrying")
-				return err
+				return retry.Permanent(err)
 			}
 		}
 		return err
@@ -125,37 +332,79 @@ func FindUserByIDWithRetry(id uint) (*models.User, error) {
 	return &user, nil
 }
 
-// UpdateUserWithRetry updates a user with retry logic
-func UpdateUserWithRetry(user *models.User) error {
+// FindUsersByIDs fetches the users with the given IDs in one query, in no
+// particular order. IDs without a user are skipped.
+func (p *PostgresRepository) FindUsersByIDs(ctx context.Context, ids []uint) ([]models.User, error) {
+	var users []models.User
 	config := retry.DefaultRetryConfig()
 
-	err := retry.ExecuteWithRetry("update_user", func() error {
+	err := retry.ExecuteWithRetry(ctx, "find_users_by_ids", func() error {
+		logger.LogDatabase("select", "users").WithField("count", len(ids)).Debug("Attempting to find users by IDs")
+
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.Where("id IN ?", ids).Find(&users).Error
+		})
+	}, config)
+
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// UpdateUser updates a user with retry logic. The write only succeeds if
+// the stored version still matches user.Version, which is then incremented.
+func (p *PostgresRepository) UpdateUser(ctx context.Context, user *models.User) error {
+	config := retry.DefaultRetryConfig()
+	expected := user.Version
+
+	err := retry.ExecuteWithRetry(ctx, "update_user", func() error {
 		logger.LogDatabase("update", "users").WithField("user_id", user.ID).Debug("Attempting to update user")
 
-		err := db.Save(user).Error
-		if err != nil {
-			// Don't retry on unique constraint violations
-			if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "UNIQUE constraint") {
-				logger.LogDatabase("update", "users").WithError(err).Warn("Unique constraint violation - not retrying")
-				return err
+		user.Version = expected + 1
+		err := p.withSession(ctx, func(tx *gorm.DB) error {
+			result := tx.Model(user).
+				Where("version = ?", expected).
+				Select("*").
+				Omit("id", "created_at").
+				Updates(user)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrVersionConflict
 			}
+			return nil
+		})
+		if errors.Is(err, ErrVersionConflict) {
+			logger.LogDatabase("update", "users").WithField("user_id", user.ID).Warn("Version conflict - not retrying")
+			return retry.Permanent(err)
+		}
+		if dup := uniqueViolation(err); dup != nil {
+			logger.LogDatabase("update", "users").WithError(err).Warn("Unique constraint violation - not retrying")
+			return retry.Permanent(dup)
 		}
 		return err
 	}, config)
 
 	// Metrics recording moved to service layer
 
+	if err != nil {
+		user.Version = expected
+	}
 	return err
 }
 
-// DeleteUserWithRetry deletes a user with retry logic
-func DeleteUserWithRetry(id uint) error {
+// DeleteUser deletes a user with retry logic
+func (p *PostgresRepository) DeleteUser(ctx context.Context, id uint) error {
 	config := retry.DefaultRetryConfig()
 
-	err := retry.ExecuteWithRetry("delete_user", func() error {
+	err := retry.ExecuteWithRetry(ctx, "delete_user", func() error {
 		logger.LogDatabase("delete", "users").WithField("user_id", id).Debug("Attempting to delete user")
 
-		return db.Delete(&models.User{}, id).Error
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.Delete(&models.User{}, id).Error
+		})
 	}, config)
 
 	// Metrics recording moved to service layer
@@ -163,21 +412,240 @@ func DeleteUserWithRetry(id uint) error {
 	return err
 }
 
-// GetAllUsersWithRetry gets all users with retry logic
-func GetAllUsersWithRetry() ([]models.User, error) {
+// StreamUsers calls fn with successive batches of up to batchSize users,
+// ordered by id, so that all users can be processed without holding them
+// in memory. A non-empty status and attributeFilters restrict the users to
+// those with that status and whose custom attributes match exactly. An
+// error from fn stops the stream and is returned. Batches already handed
+// to fn can't be taken back, so a failed query is not retried. fn must not
+// keep a batch, whose backing array is reused for the next one.
+func (p *PostgresRepository) StreamUsers(ctx context.Context, status string, attributeFilters map[string]string, batchSize int, fn func(batch []models.User) error) error {
+	logger.LogDatabase("select", "users").Debug("Attempting to stream users")
+
+	return p.withSession(ctx, func(tx *gorm.DB) error {
+		query := tx.Model(&models.User{})
+		if status != "" {
+			query = query.Where("status = ?", status)
+		}
+		for name, value := range attributeFilters {
+			query = query.Where("attributes ->> ? = ?", name, value)
+		}
+
+		var batch []models.User
+		return query.FindInBatches(&batch, batchSize, func(*gorm.DB, int) error {
+			return fn(batch)
+		}).Error
+	})
+}
+
+// ListUsersPage returns up to q.Limit users matching q.Filter, ordered by
+// q.OrderBy then id and starting after q.After (keyset pagination)
+func (p *PostgresRepository) ListUsersPage(ctx context.Context, q models.UserListQuery) ([]models.User, error) {
+	if _, ok := models.UserListFields[q.OrderBy]; !ok {
+		return nil, fmt.Errorf("cannot order users by %q", q.OrderBy)
+	}
+	direction, after := "ASC", ">"
+	if q.Descending {
+		direction, after = "DESC", "<"
+	}
+
 	var users []models.User
 	config := retry.DefaultRetryConfig()
 
-	err := retry.ExecuteWithRetry("get_all_users", func() error {
-		logger.LogDatabase("select", "users").Debug("Attempting to fetch all users")
+	err := retry.ExecuteWithRetry(ctx, "list_users_page", func() error {
+		logger.LogDatabase("select", "users").WithField("order_by", q.OrderBy).Debug("Attempting to fetch a page of users")
 
-		return db.Find(&users).Error
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			query, err := whereUserFilter(tx, q.Filter)
+			if err != nil {
+				return err
+			}
+			if q.After != nil {
+				if q.OrderBy == "id" {
+					query = query.Where("id "+after+" ?", q.After.ID)
+				} else {
+					query = query.Where("("+q.OrderBy+", id) "+after+" (?, ?)", q.After.Value, q.After.ID)
+				}
+			}
+			if q.OrderBy != "id" {
+				query = query.Order(q.OrderBy + " " + direction)
+			}
+			return query.Order("id " + direction).Limit(q.Limit).Find(&users).Error
+		})
 	}, config)
 
-	// Metrics recording moved to service layer
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// whereUserFilter adds the comparisons of a list filter to query
+func whereUserFilter(query *gorm.DB, filter []models.UserFilterTerm) (*gorm.DB, error) {
+	for _, term := range filter {
+		column, ok := userListColumn(term.Field)
+		if !ok {
+			return nil, fmt.Errorf("cannot filter users by %q", term.Field)
+		}
+		switch term.Operator {
+		case "=", "!=", "<", "<=", ">", ">=":
+			query = query.Where("? "+term.Operator+" ?", column, term.Value)
+		case ":":
+			query = query.Where(`? ILIKE ? ESCAPE '\'`, column, "%"+escapeLike(fmt.Sprint(term.Value))+"%")
+		default:
+			return nil, fmt.Errorf("unsupported filter operator %q", term.Operator)
+		}
+	}
+	return query, nil
+}
+
+// CountUsers counts the users matching a list filter with SELECT COUNT,
+// without loading them
+func (p *PostgresRepository) CountUsers(ctx context.Context, filter []models.UserFilterTerm) (int64, error) {
+	var count int64
+	config := retry.DefaultRetryConfig()
+
+	err := retry.ExecuteWithRetry(ctx, "count_users", func() error {
+		logger.LogDatabase("select", "users").WithField("terms", len(filter)).Debug("Attempting to count users")
+
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			query, err := whereUserFilter(tx.Model(&models.User{}), filter)
+			if err != nil {
+				return retry.Permanent(err)
+			}
+			return query.Count(&count).Error
+		})
+	}, config)
+
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// userListColumn returns the SQL expression for a list field
+func userListColumn(field string) (clause.Expr, bool) {
+	if name := strings.TrimPrefix(field, models.AttributeFieldPrefix); name != field {
+		return gorm.Expr("attributes ->> ?", name), name != ""
+	}
+	if _, ok := models.UserListFieldKind(field); !ok {
+		return clause.Expr{}, false
+	}
+	return gorm.Expr(field), true
+}
+
+// escapeLike escapes LIKE wildcards so s matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// SearchUsers finds users whose name or email resemble the query,
+// ranked by trigram similarity
+func (p *PostgresRepository) SearchUsers(ctx context.Context, query string, limit int) ([]models.User, error) {
+	var users []models.User
+	config := retry.DefaultRetryConfig()
+
+	err := retry.ExecuteWithRetry(ctx, "search_users", func() error {
+		logger.LogDatabase("select", "users").WithField("query", query).Debug("Attempting to search users")
+
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			return searchUsersQuery(tx, query).Limit(limit).Find(&users).Error
+		})
+	}, config)
+
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// searchUsersQuery matches users whose name or email resemble query by
+// trigram similarity or contain it literally: wildcards in query are escaped
+func searchUsersQuery(tx *gorm.DB, query string) *gorm.DB {
+	pattern := "%" + escapeLike(query) + "%"
+	return tx.
+		Where(`name % ? OR email % ? OR name ILIKE ? ESCAPE '\' OR email ILIKE ? ESCAPE '\'`, query, query, pattern, pattern).
+		Order(gorm.Expr("GREATEST(similarity(name, ?), similarity(email, ?)) DESC", query, query))
+}
+
+// GetRecentlyActiveUsers returns up to limit users ordered by most recent login
+func (p *PostgresRepository) GetRecentlyActiveUsers(ctx context.Context, limit int) ([]models.User, error) {
+	var users []models.User
+	config := retry.DefaultRetryConfig()
+
+	err := retry.ExecuteWithRetry(ctx, "get_recently_active_users", func() error {
+		logger.LogDatabase("select", "users").WithField("limit", limit).Debug("Attempting to fetch recently active users")
+
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.
+				Order("last_login_at DESC NULLS LAST").
+				Order("updated_at DESC").
+				Limit(limit).
+				Find(&users).Error
+		})
+	}, config)
 
 	if err != nil {
 		return nil, err
 	}
 	return users, nil
 }
+
+// TouchLastLogin records the time of a user's latest login
+func (p *PostgresRepository) TouchLastLogin(ctx context.Context, id uint, at time.Time) error {
+	config := retry.DefaultRetryConfig()
+
+	return retry.ExecuteWithRetry(ctx, "touch_last_login", func() error {
+		logger.LogDatabase("update", "users").WithField("user_id", id).Debug("Attempting to record last login")
+
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.Model(&models.User{}).Where("id = ?", id).UpdateColumn("last_login_at", at).Error
+		})
+	}, config)
+}
+
+// GetUserHistory returns a user's snapshots, oldest first, with retry logic
+func (p *PostgresRepository) GetUserHistory(ctx context.Context, userID uint) ([]models.UserHistory, error) {
+	var history []models.UserHistory
+	config := retry.DefaultRetryConfig()
+
+	err := retry.ExecuteWithRetry(ctx, "get_user_history", func() error {
+		logger.LogDatabase("select", "users_history").WithField("user_id", userID).Debug("Attempting to fetch user history")
+
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.Where("user_id = ?", userID).Order("valid_from, id").Find(&history).Error
+		})
+	}, config)
+
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// PurgeUserHistory deletes snapshots that stopped being current before the
+// given time. Current snapshots are always kept.
+func (p *PostgresRepository) PurgeUserHistory(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	config := retry.DefaultRetryConfig()
+
+	err := retry.ExecuteWithRetry(ctx, "purge_user_history", func() error {
+		logger.LogDatabase("delete", "users_history").WithField("before", before).Debug("Attempting to purge user history")
+
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			result := tx.Where("valid_to < ?", before).Delete(&models.UserHistory{})
+			purged = result.RowsAffected
+			return result.Error
+		})
+	}, config)
+
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+// Ping checks database connectivity
+func (p *PostgresRepository) Ping(ctx context.Context) error {
+	return p.db.WithContext(ctx).Exec("SELECT 1").Error
+}
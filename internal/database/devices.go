@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/retry"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// ListDevicesByUser returns the devices a user has logged in from, oldest first
+func (p *PostgresRepository) ListDevicesByUser(ctx context.Context, userID uint) ([]models.KnownDevice, error) {
+	var devices []models.KnownDevice
+	err := p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Where("user_id = ?", userID).Order("id").Find(&devices).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// CreateDevice records a device a user logged in from for the first time.
+// A device the user already has gets ErrDuplicateKey.
+func (p *PostgresRepository) CreateDevice(ctx context.Context, device *models.KnownDevice) error {
+	logger.LogDatabase("create", "known_devices").WithField("user_id", device.UserID).Debug("Attempting to create known device")
+
+	err := p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Create(device).Error
+	})
+	if dup := uniqueViolation(err); dup != nil {
+		return dup
+	}
+	return err
+}
+
+// TouchDevice records another login from a known device, with retry logic
+func (p *PostgresRepository) TouchDevice(ctx context.Context, id uint, ip string, at time.Time) error {
+	config := retry.DefaultRetryConfig()
+
+	return retry.ExecuteWithRetry(ctx, "touch_device", func() error {
+		logger.LogDatabase("update", "known_devices").WithField("device_id", id).Debug("Attempting to record device login")
+
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.Model(&models.KnownDevice{}).Where("id = ?", id).
+				UpdateColumns(map[string]interface{}{"last_ip": ip, "last_seen_at": at}).Error
+		})
+	}, config)
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/retry"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// GetSignupDomainPolicy returns the stored signup domain policy, or
+// gorm.ErrRecordNotFound when admins never set one
+func (p *PostgresRepository) GetSignupDomainPolicy(ctx context.Context) (*models.SignupDomainPolicy, error) {
+	var policy models.SignupDomainPolicy
+	config := retry.DefaultRetryConfig()
+
+	err := retry.ExecuteWithRetry(ctx, "get_signup_domain_policy", func() error {
+		logger.LogDatabase("select", "signup_domain_policies").Debug("Attempting to fetch signup domain policy")
+
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.Take(&policy, models.SignupDomainPolicyID).Error
+		})
+	}, config)
+
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// SaveSignupDomainPolicy stores the signup domain policy, replacing the previous one
+func (p *PostgresRepository) SaveSignupDomainPolicy(ctx context.Context, policy *models.SignupDomainPolicy) error {
+	policy.ID = models.SignupDomainPolicyID
+	config := retry.DefaultRetryConfig()
+
+	return retry.ExecuteWithRetry(ctx, "save_signup_domain_policy", func() error {
+		logger.LogDatabase("upsert", "signup_domain_policies").Debug("Attempting to save signup domain policy")
+
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"allow", "deny", "updated_at"}),
+			}).Create(policy).Error
+		})
+	}, config)
+}
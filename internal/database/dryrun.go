@@ -0,0 +1,24 @@
+package database
+
+import (
+	"context"
+	"errors"
+)
+
+type dryRunKey struct{}
+
+// errDryRun rolls back the transaction of a dry run
+var errDryRun = errors.New("dry run")
+
+// WithDryRun returns a copy of ctx whose writes are validated but not
+// persisted. Postgres runs them in a transaction that is rolled back, so
+// constraints, triggers and defaults still apply to the returned records.
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+// IsDryRun reports whether writes in ctx must not be persisted
+func IsDryRun(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(dryRunKey{}).(bool)
+	return dryRun
+}
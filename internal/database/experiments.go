@@ -0,0 +1,24 @@
+package database
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/retry"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// RecordExposure stores an experiment exposure event with retry logic
+func (p *PostgresRepository) RecordExposure(ctx context.Context, exposure *models.ExperimentExposure) error {
+	config := retry.DefaultRetryConfig()
+
+	return retry.ExecuteWithRetry(ctx, "record_exposure", func() error {
+		logger.LogDatabase("create", "experiment_exposures").WithField("experiment", exposure.Experiment).Debug("Attempting to record experiment exposure")
+
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.Create(exposure).Error
+		})
+	}, config)
+}
@@ -0,0 +1,34 @@
+package database
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// FindIdentity finds the identity a provider knows by subject. It isn't
+// retried: not finding one is the normal case on a user's first login.
+func (p *PostgresRepository) FindIdentity(ctx context.Context, provider, subject string) (*models.Identity, error) {
+	logger.LogDatabase("select", "identities").WithField("provider", provider).Debug("Attempting to find identity")
+
+	var identity models.Identity
+	err := p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// CreateIdentity links an external identity to a user
+func (p *PostgresRepository) CreateIdentity(ctx context.Context, identity *models.Identity) error {
+	logger.LogDatabase("create", "identities").WithField("user_id", identity.UserID).Debug("Attempting to create identity")
+
+	return p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Create(identity).Error
+	})
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/retry"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// CreateInvitation records a new invitation
+func (p *PostgresRepository) CreateInvitation(ctx context.Context, inv *models.Invitation) error {
+	logger.LogDatabase("create", "invitations").WithField("user_id", inv.UserID).Debug("Attempting to create invitation")
+
+	return p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Create(inv).Error
+	})
+}
+
+// FindInvitation returns an invitation by ID
+func (p *PostgresRepository) FindInvitation(ctx context.Context, id uint) (*models.Invitation, error) {
+	var inv models.Invitation
+	config := retry.DefaultRetryConfig()
+
+	err := retry.ExecuteWithRetry(ctx, "find_invitation", func() error {
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.First(&inv, id).Error
+		})
+	}, config)
+
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// ClaimInvitation marks the pending invitation whose unexpired token has
+// the given hash as accepted and returns it. Only one caller can claim a
+// token; the others get gorm.ErrRecordNotFound.
+func (p *PostgresRepository) ClaimInvitation(ctx context.Context, tokenHash string, now time.Time) (*models.Invitation, error) {
+	var inv models.Invitation
+	err := p.withSession(ctx, func(tx *gorm.DB) error {
+		result := tx.Model(&inv).Clauses(clause.Returning{}).
+			Where("token_hash = ? AND status = ? AND expires_at > ?", tokenHash, models.InvitationPending, now).
+			Updates(map[string]interface{}{"status": models.InvitationAccepted, "token_hash": "", "accepted_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// ListInvitations returns invitations, newest first, optionally only those in status
+func (p *PostgresRepository) ListInvitations(ctx context.Context, status string) ([]models.Invitation, error) {
+	var invitations []models.Invitation
+	config := retry.DefaultRetryConfig()
+
+	err := retry.ExecuteWithRetry(ctx, "list_invitations", func() error {
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			query := tx.Order("id DESC")
+			if status != "" {
+				query = query.Where("status = ?", status)
+			}
+			return query.Find(&invitations).Error
+		})
+	}, config)
+
+	if err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+// UpdateInvitation saves an invitation
+func (p *PostgresRepository) UpdateInvitation(ctx context.Context, inv *models.Invitation) error {
+	return p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Save(inv).Error
+	})
+}
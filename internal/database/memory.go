@@ -0,0 +1,1282 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// MemoryRepository is an in-memory UserRepository for tests and local
+// development. Lookups of missing records return gorm.ErrRecordNotFound and
+// unique violations ErrDuplicateKey, like PostgresRepository. Dry
+// runs are honored for user writes.
+type MemoryRepository struct {
+	mu          sync.RWMutex
+	users       map[uint]models.User
+	attributes  map[uint]models.AttributeDefinition
+	history     []models.UserHistory
+	exposures   []models.ExperimentExposure
+	recovery    map[uint]models.RecoveryCase
+	recoveryLog []models.RecoveryCaseEvent
+	identities  []models.Identity
+	devices     []models.KnownDevice
+	flags       map[uint]models.SecurityFlag
+	exports     map[uint]models.DataExport
+	consents    []models.Consent
+	preferences map[uint]models.Preferences
+	invitations map[uint]models.Invitation
+	orgs        map[uint]models.Organization
+	memberships []models.Membership
+	domains     *models.SignupDomainPolicy
+	nextID      uint
+}
+
+var _ UserRepository = (*MemoryRepository)(nil)
+
+// NewMemoryRepository creates an empty MemoryRepository
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		users:       make(map[uint]models.User),
+		attributes:  make(map[uint]models.AttributeDefinition),
+		recovery:    make(map[uint]models.RecoveryCase),
+		exports:     make(map[uint]models.DataExport),
+		preferences: make(map[uint]models.Preferences),
+		invitations: make(map[uint]models.Invitation),
+		orgs:        make(map[uint]models.Organization),
+		flags:       make(map[uint]models.SecurityFlag),
+	}
+}
+
+func (m *MemoryRepository) id() uint {
+	m.nextID++
+	return m.nextID
+}
+
+// CreateUser implements UserRepository
+func (m *MemoryRepository) CreateUser(ctx context.Context, user *models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user.TenantID == "" {
+		user.TenantID = models.DefaultTenant
+	}
+	for _, existing := range m.users {
+		if existing.TenantID == user.TenantID && sameEmail(existing.Email, user.Email) {
+			return ErrDuplicateKey
+		}
+	}
+
+	now := time.Now()
+	if IsDryRun(ctx) {
+		user.ID = m.nextID + 1
+	} else {
+		user.ID = m.id()
+	}
+	user.CreatedAt, user.UpdatedAt = now, now
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	if user.Status == "" {
+		user.Status = models.StatusActive
+	}
+	if user.Attributes == nil {
+		user.Attributes = models.Attributes{}
+	}
+	if user.Version == 0 {
+		user.Version = 1
+	}
+	if IsDryRun(ctx) {
+		return nil
+	}
+	m.users[user.ID] = *user
+	m.recordHistory(user, now)
+	return nil
+}
+
+// FindUserByEmail implements UserRepository
+func (m *MemoryRepository) FindUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tenantID := TenantFromContext(ctx)
+	for _, user := range m.users {
+		if user.TenantID == tenantID && sameEmail(user.Email, email) {
+			return &user, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// FindUserByVerifiedPhone implements UserRepository
+func (m *MemoryRepository) FindUserByVerifiedPhone(ctx context.Context, phone string) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tenantID := TenantFromContext(ctx)
+	for _, user := range m.users {
+		if user.TenantID == tenantID && user.Phone == phone && user.PhoneVerifiedAt != nil {
+			return &user, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// UserExistsByEmail implements UserRepository
+func (m *MemoryRepository) UserExistsByEmail(ctx context.Context, email string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tenantID := TenantFromContext(ctx)
+	for _, user := range m.users {
+		if user.TenantID == tenantID && sameEmail(user.Email, email) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// FindUserByID implements UserRepository
+func (m *MemoryRepository) FindUserByID(ctx context.Context, id uint) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &user, nil
+}
+
+// FindUsersByIDs implements UserRepository
+func (m *MemoryRepository) FindUsersByIDs(ctx context.Context, ids []uint) ([]models.User, error) {
+	wanted := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	return m.filter(func(user models.User) bool { return wanted[user.ID] }), nil
+}
+
+// UpdateUser implements UserRepository
+func (m *MemoryRepository) UpdateUser(ctx context.Context, user *models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, existing := range m.users {
+		if id != user.ID && existing.TenantID == user.TenantID && sameEmail(existing.Email, user.Email) {
+			return ErrDuplicateKey
+		}
+	}
+
+	previous, ok := m.users[user.ID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if previous.Version != user.Version {
+		return ErrVersionConflict
+	}
+	user.Version++
+	user.UpdatedAt = time.Now()
+	if IsDryRun(ctx) {
+		return nil
+	}
+	m.users[user.ID] = *user
+	if historyChanged(&previous, user) {
+		m.closeHistory(user.ID, user.UpdatedAt)
+		m.recordHistory(user, user.UpdatedAt)
+	}
+	return nil
+}
+
+// DeleteUser implements UserRepository
+func (m *MemoryRepository) DeleteUser(ctx context.Context, id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[id]; ok && !IsDryRun(ctx) {
+		delete(m.users, id)
+		m.closeHistory(id, time.Now())
+		m.removeMemberships(func(ms models.Membership) bool { return ms.UserID == id })
+	}
+	return nil
+}
+
+// StreamUsers implements UserRepository
+func (m *MemoryRepository) StreamUsers(ctx context.Context, status string, attributeFilters map[string]string, batchSize int, fn func(batch []models.User) error) error {
+	users := m.filter(func(user models.User) bool {
+		if status != "" && user.Status != status {
+			return false
+		}
+		for name, value := range attributeFilters {
+			attr, ok := user.Attributes[name]
+			if !ok || fmt.Sprint(attr) != value {
+				return false
+			}
+		}
+		return true
+	})
+	for len(users) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n := min(batchSize, len(users))
+		if err := fn(users[:n]); err != nil {
+			return err
+		}
+		users = users[n:]
+	}
+	return nil
+}
+
+// ListUsersPage implements UserRepository
+func (m *MemoryRepository) ListUsersPage(ctx context.Context, q models.UserListQuery) ([]models.User, error) {
+	if _, ok := models.UserListFields[q.OrderBy]; !ok {
+		return nil, fmt.Errorf("cannot order users by %q", q.OrderBy)
+	}
+	for _, term := range q.Filter {
+		if _, ok := models.UserListFieldKind(term.Field); !ok {
+			return nil, fmt.Errorf("cannot filter users by %q", term.Field)
+		}
+	}
+
+	// before reports whether a sorts ahead of b in the requested order
+	before := func(a, b models.User) bool {
+		c := compareListValues(userListValue(a, q.OrderBy), userListValue(b, q.OrderBy))
+		if c == 0 {
+			c = compareListValues(a.ID, b.ID)
+		}
+		if q.Descending {
+			return c > 0
+		}
+		return c < 0
+	}
+
+	users := m.filter(func(user models.User) bool {
+		for _, term := range q.Filter {
+			if !matchListTerm(user, term) {
+				return false
+			}
+		}
+		if q.After != nil {
+			last := models.User{ID: q.After.ID}
+			setUserListValue(&last, q.OrderBy, q.After.Value)
+			return before(last, user)
+		}
+		return true
+	})
+	sort.Slice(users, func(i, j int) bool { return before(users[i], users[j]) })
+	if q.Limit > 0 && len(users) > q.Limit {
+		users = users[:q.Limit]
+	}
+	return users, nil
+}
+
+// userListValue returns a user's value for a list field; missing attributes
+// and a null last_login_at yield nil
+func userListValue(user models.User, field string) interface{} {
+	if name := strings.TrimPrefix(field, models.AttributeFieldPrefix); name != field {
+		if attr, ok := user.Attributes[name]; ok {
+			return fmt.Sprint(attr)
+		}
+		return nil
+	}
+	switch field {
+	case "id":
+		return user.ID
+	case "name":
+		return user.Name
+	case "email":
+		return user.Email
+	case "role":
+		return user.Role
+	case "status":
+		return user.Status
+	case "created_at":
+		return user.CreatedAt
+	case "updated_at":
+		return user.UpdatedAt
+	case "last_login_at":
+		if user.LastLoginAt != nil {
+			return *user.LastLoginAt
+		}
+	}
+	return nil
+}
+
+// setUserListValue is the inverse of userListValue for orderable fields
+func setUserListValue(user *models.User, field string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		switch field {
+		case "name":
+			user.Name = v
+		case "email":
+			user.Email = v
+		case "role":
+			user.Role = v
+		case "status":
+			user.Status = v
+		}
+	case time.Time:
+		switch field {
+		case "created_at":
+			user.CreatedAt = v
+		case "updated_at":
+			user.UpdatedAt = v
+		}
+	}
+}
+
+// matchListTerm evaluates one filter comparison like Postgres would:
+// comparisons against a missing attribute never match
+func matchListTerm(user models.User, term models.UserFilterTerm) bool {
+	value := userListValue(user, term.Field)
+	if value == nil {
+		return false
+	}
+	if term.Operator == ":" {
+		return strings.Contains(strings.ToLower(fmt.Sprint(value)), strings.ToLower(fmt.Sprint(term.Value)))
+	}
+	c := compareListValues(value, term.Value)
+	switch term.Operator {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// compareListValues orders two values of the same list field kind
+func compareListValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case uint:
+		b, _ := b.(uint)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case time.Time:
+		b, _ := b.(time.Time)
+		return a.Compare(b)
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// SearchUsers implements UserRepository with a case-insensitive substring
+// match instead of trigram similarity
+func (m *MemoryRepository) SearchUsers(ctx context.Context, query string, limit int) ([]models.User, error) {
+	query = strings.ToLower(query)
+	users := m.filter(func(user models.User) bool {
+		return strings.Contains(strings.ToLower(user.Name), query) || strings.Contains(strings.ToLower(user.Email), query)
+	})
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+// GetRecentlyActiveUsers implements UserRepository
+func (m *MemoryRepository) GetRecentlyActiveUsers(ctx context.Context, limit int) ([]models.User, error) {
+	users := m.filter(func(models.User) bool { return true })
+	sort.SliceStable(users, func(i, j int) bool {
+		a, b := users[i].LastLoginAt, users[j].LastLoginAt
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return a.After(*b)
+	})
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+// TouchLastLogin implements UserRepository
+func (m *MemoryRepository) TouchLastLogin(ctx context.Context, id uint, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.users[id]; ok {
+		user.LastLoginAt = &at
+		m.users[id] = user
+	}
+	return nil
+}
+
+// CountUsers implements UserRepository
+func (m *MemoryRepository) CountUsers(ctx context.Context, filter []models.UserFilterTerm) (int64, error) {
+	for _, term := range filter {
+		if _, ok := models.UserListFieldKind(term.Field); !ok {
+			return 0, fmt.Errorf("cannot filter users by %q", term.Field)
+		}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int64
+	for _, user := range m.users {
+		match := true
+		for _, term := range filter {
+			match = match && matchListTerm(user, term)
+		}
+		if match {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetUserHistory implements UserRepository
+func (m *MemoryRepository) GetUserHistory(ctx context.Context, userID uint) ([]models.UserHistory, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var history []models.UserHistory
+	for _, h := range m.history {
+		if h.UserID == userID {
+			history = append(history, h)
+		}
+	}
+	return history, nil
+}
+
+// PurgeUserHistory implements UserRepository
+func (m *MemoryRepository) PurgeUserHistory(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.history[:0]
+	for _, h := range m.history {
+		if h.ValidTo == nil || !h.ValidTo.Before(before) {
+			kept = append(kept, h)
+		}
+	}
+	purged := int64(len(m.history) - len(kept))
+	m.history = kept
+	return purged, nil
+}
+
+// recordHistory appends the current snapshot of user. Callers must hold m.mu.
+func (m *MemoryRepository) recordHistory(user *models.User, at time.Time) {
+	m.history = append(m.history, models.UserHistory{
+		ID:         uint(len(m.history) + 1),
+		UserID:     user.ID,
+		Name:       user.Name,
+		Email:      user.Email,
+		Role:       user.Role,
+		TenantID:   user.TenantID,
+		Attributes: user.Attributes,
+		ValidFrom:  at,
+	})
+}
+
+// closeHistory ends the current snapshot of a user. Callers must hold m.mu.
+func (m *MemoryRepository) closeHistory(userID uint, at time.Time) {
+	for i := range m.history {
+		if m.history[i].UserID == userID && m.history[i].ValidTo == nil {
+			m.history[i].ValidTo = &at
+		}
+	}
+}
+
+// historyChanged reports whether an update touches a column tracked in users_history
+func historyChanged(before, after *models.User) bool {
+	if before.Name != after.Name || before.Email != after.Email || before.Role != after.Role || before.TenantID != after.TenantID {
+		return true
+	}
+	return !reflect.DeepEqual(before.Attributes, after.Attributes)
+}
+
+// CreateAttributeDefinition implements UserRepository
+func (m *MemoryRepository) CreateAttributeDefinition(ctx context.Context, def *models.AttributeDefinition) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.attributes {
+		if existing.Name == def.Name {
+			return ErrDuplicateKey
+		}
+	}
+	def.ID = m.id()
+	def.CreatedAt = time.Now()
+	def.UpdatedAt = def.CreatedAt
+	m.attributes[def.ID] = *def
+	return nil
+}
+
+// GetAttributeDefinitions implements UserRepository
+func (m *MemoryRepository) GetAttributeDefinitions(ctx context.Context) ([]models.AttributeDefinition, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	defs := make([]models.AttributeDefinition, 0, len(m.attributes))
+	for _, def := range m.attributes {
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs, nil
+}
+
+// DeleteAttributeDefinition implements UserRepository
+func (m *MemoryRepository) DeleteAttributeDefinition(ctx context.Context, id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.attributes, id)
+	return nil
+}
+
+// GetSignupDomainPolicy implements UserRepository
+func (m *MemoryRepository) GetSignupDomainPolicy(ctx context.Context) (*models.SignupDomainPolicy, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.domains == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	policy := *m.domains
+	return &policy, nil
+}
+
+// SaveSignupDomainPolicy implements UserRepository
+func (m *MemoryRepository) SaveSignupDomainPolicy(ctx context.Context, policy *models.SignupDomainPolicy) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	policy.ID = models.SignupDomainPolicyID
+	policy.UpdatedAt = time.Now()
+	stored := *policy
+	m.domains = &stored
+	return nil
+}
+
+// RecordExposure implements UserRepository
+func (m *MemoryRepository) RecordExposure(ctx context.Context, exposure *models.ExperimentExposure) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	exposure.ID = uint(len(m.exposures) + 1)
+	exposure.CreatedAt = time.Now()
+	m.exposures = append(m.exposures, *exposure)
+	return nil
+}
+
+// FindIdentity implements UserRepository
+func (m *MemoryRepository) FindIdentity(ctx context.Context, provider, subject string) (*models.Identity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, identity := range m.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// CreateIdentity implements UserRepository
+func (m *MemoryRepository) CreateIdentity(ctx context.Context, identity *models.Identity) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.identities {
+		if existing.Provider == identity.Provider && existing.Subject == identity.Subject {
+			return ErrDuplicateKey
+		}
+	}
+	identity.ID = uint(len(m.identities) + 1)
+	identity.CreatedAt = time.Now()
+	m.identities = append(m.identities, *identity)
+	return nil
+}
+
+// CreateRecoveryCase implements UserRepository
+func (m *MemoryRepository) CreateRecoveryCase(ctx context.Context, rc *models.RecoveryCase, event *models.RecoveryCaseEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rc.ID = m.id()
+	rc.CreatedAt = time.Now()
+	rc.UpdatedAt = rc.CreatedAt
+	if rc.Version == 0 {
+		rc.Version = 1
+	}
+	m.recovery[rc.ID] = *rc
+	m.logRecovery(rc.ID, event)
+	return nil
+}
+
+// FindRecoveryCase implements UserRepository
+func (m *MemoryRepository) FindRecoveryCase(ctx context.Context, id uint) (*models.RecoveryCase, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rc, ok := m.recovery[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	rc.Events = nil
+	for _, event := range m.recoveryLog {
+		if event.CaseID == id {
+			rc.Events = append(rc.Events, event)
+		}
+	}
+	return &rc, nil
+}
+
+// FindRecoveryCaseByToken implements UserRepository
+func (m *MemoryRepository) FindRecoveryCaseByToken(ctx context.Context, tokenHash string, now time.Time) (*models.RecoveryCase, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, rc := range m.recovery {
+		if rc.ResetTokenHash != "" && rc.ResetTokenHash == tokenHash && rc.ResetTokenExpires != nil && rc.ResetTokenExpires.After(now) {
+			return &rc, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// ListRecoveryCases implements UserRepository
+func (m *MemoryRepository) ListRecoveryCases(ctx context.Context, status string) ([]models.RecoveryCase, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	cases := []models.RecoveryCase{}
+	for _, rc := range m.recovery {
+		if status == "" || rc.Status == status {
+			cases = append(cases, rc)
+		}
+	}
+	sort.Slice(cases, func(i, j int) bool { return cases[i].ID > cases[j].ID })
+	return cases, nil
+}
+
+// UpdateRecoveryCase implements UserRepository
+func (m *MemoryRepository) UpdateRecoveryCase(ctx context.Context, rc *models.RecoveryCase, event *models.RecoveryCaseEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	previous, ok := m.recovery[rc.ID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if previous.Version != rc.Version {
+		return ErrVersionConflict
+	}
+	rc.Version++
+	rc.UpdatedAt = time.Now()
+	stored := *rc
+	stored.Events = nil
+	m.recovery[rc.ID] = stored
+	m.logRecovery(rc.ID, event)
+	return nil
+}
+
+// ExpireRecoveryTokens implements UserRepository
+func (m *MemoryRepository) ExpireRecoveryTokens(ctx context.Context, now time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var expired int64
+	for id, rc := range m.recovery {
+		if rc.ResetTokenHash != "" && rc.ResetTokenExpires != nil && !rc.ResetTokenExpires.After(now) {
+			rc.ResetTokenHash, rc.ResetTokenExpires = "", nil
+			m.recovery[id] = rc
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+// logRecovery appends a recovery audit event. Callers must hold m.mu.
+func (m *MemoryRepository) logRecovery(caseID uint, event *models.RecoveryCaseEvent) {
+	event.ID = uint(len(m.recoveryLog) + 1)
+	event.CaseID = caseID
+	event.CreatedAt = time.Now()
+	m.recoveryLog = append(m.recoveryLog, *event)
+}
+
+// ListRecoveryCasesByUser implements UserRepository
+func (m *MemoryRepository) ListRecoveryCasesByUser(ctx context.Context, userID uint) ([]models.RecoveryCase, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	cases := []models.RecoveryCase{}
+	for _, rc := range m.recovery {
+		if rc.UserID != userID {
+			continue
+		}
+		rc.Events = nil
+		for _, event := range m.recoveryLog {
+			if event.CaseID == rc.ID {
+				rc.Events = append(rc.Events, event)
+			}
+		}
+		cases = append(cases, rc)
+	}
+	sort.Slice(cases, func(i, j int) bool { return cases[i].ID < cases[j].ID })
+	return cases, nil
+}
+
+// CreateDataExport implements UserRepository
+func (m *MemoryRepository) CreateDataExport(ctx context.Context, export *models.DataExport) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	export.ID = m.id()
+	export.CreatedAt = time.Now()
+	export.UpdatedAt = export.CreatedAt
+	m.exports[export.ID] = *export
+	return nil
+}
+
+// UpdateDataExport implements UserRepository
+func (m *MemoryRepository) UpdateDataExport(ctx context.Context, export *models.DataExport) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.exports[export.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	export.UpdatedAt = time.Now()
+	m.exports[export.ID] = *export
+	return nil
+}
+
+// ListDataExports implements UserRepository
+func (m *MemoryRepository) ListDataExports(ctx context.Context, userID uint) ([]models.DataExport, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	exports := []models.DataExport{}
+	for _, export := range m.exports {
+		if export.UserID == userID {
+			exports = append(exports, export)
+		}
+	}
+	sort.Slice(exports, func(i, j int) bool { return exports[i].ID > exports[j].ID })
+	return exports, nil
+}
+
+// ListExpiredDataExports implements UserRepository
+func (m *MemoryRepository) ListExpiredDataExports(ctx context.Context, now time.Time) ([]models.DataExport, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var exports []models.DataExport
+	for _, export := range m.exports {
+		if export.ExpiresAt != nil && export.ExpiresAt.Before(now) {
+			exports = append(exports, export)
+		}
+	}
+	return exports, nil
+}
+
+// DeleteDataExport implements UserRepository
+func (m *MemoryRepository) DeleteDataExport(ctx context.Context, id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.exports, id)
+	return nil
+}
+
+// ListIdentitiesByUser implements UserRepository
+func (m *MemoryRepository) ListIdentitiesByUser(ctx context.Context, userID uint) ([]models.Identity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	identities := []models.Identity{}
+	for _, identity := range m.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
+
+// AnonymizeUserRecords implements UserRepository
+func (m *MemoryRepository) AnonymizeUserRecords(ctx context.Context, userID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.history {
+		if m.history[i].UserID == userID {
+			m.history[i].Name, m.history[i].Email = models.Erased, models.Erased
+			m.history[i].Attributes = models.Attributes{}
+		}
+	}
+	cases := make(map[uint]bool)
+	for id, rc := range m.recovery {
+		if rc.UserID == userID {
+			rc.Reason, rc.Verification, rc.NewEmail = models.Erased, models.Erased, ""
+			m.recovery[id] = rc
+			cases[id] = true
+		}
+	}
+	for i := range m.recoveryLog {
+		if cases[m.recoveryLog[i].CaseID] && m.recoveryLog[i].Note != "" {
+			m.recoveryLog[i].Note = models.Erased
+		}
+	}
+	for i := range m.consents {
+		if m.consents[i].UserID == userID {
+			m.consents[i].IP, m.consents[i].UserAgent = "", ""
+		}
+	}
+	for id, flag := range m.flags {
+		if flag.UserID == userID {
+			flag.IP = ""
+			m.flags[id] = flag
+		}
+	}
+	for id, inv := range m.invitations {
+		if inv.UserID == userID {
+			inv.Email, inv.TokenHash = models.Erased, ""
+			m.invitations[id] = inv
+		}
+	}
+	kept := m.identities[:0]
+	for _, identity := range m.identities {
+		if identity.UserID != userID {
+			kept = append(kept, identity)
+		}
+	}
+	m.identities = kept
+	devices := m.devices[:0]
+	for _, device := range m.devices {
+		if device.UserID != userID {
+			devices = append(devices, device)
+		}
+	}
+	m.devices = devices
+	delete(m.preferences, userID)
+	return nil
+}
+
+// ListDevicesByUser implements UserRepository
+func (m *MemoryRepository) ListDevicesByUser(ctx context.Context, userID uint) ([]models.KnownDevice, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	devices := []models.KnownDevice{}
+	for _, device := range m.devices {
+		if device.UserID == userID {
+			devices = append(devices, device)
+		}
+	}
+	return devices, nil
+}
+
+// CreateDevice implements UserRepository
+func (m *MemoryRepository) CreateDevice(ctx context.Context, device *models.KnownDevice) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.devices {
+		if existing.UserID == device.UserID && existing.Key == device.Key {
+			return ErrDuplicateKey
+		}
+	}
+	device.ID = m.id()
+	device.CreatedAt = time.Now()
+	m.devices = append(m.devices, *device)
+	return nil
+}
+
+// TouchDevice implements UserRepository
+func (m *MemoryRepository) TouchDevice(ctx context.Context, id uint, ip string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.devices {
+		if m.devices[i].ID == id {
+			m.devices[i].LastIP, m.devices[i].LastSeenAt = ip, at
+		}
+	}
+	return nil
+}
+
+// CreateSecurityFlag implements UserRepository
+func (m *MemoryRepository) CreateSecurityFlag(ctx context.Context, flag *models.SecurityFlag) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	flag.ID = m.id()
+	flag.CreatedAt = time.Now()
+	m.flags[flag.ID] = *flag
+	return nil
+}
+
+// ListSecurityFlags implements UserRepository
+func (m *MemoryRepository) ListSecurityFlags(ctx context.Context, status string) ([]models.SecurityFlag, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tenant := TenantFromContext(ctx)
+	flags := []models.SecurityFlag{}
+	for _, flag := range m.flags {
+		resolved := flag.ResolvedAt != nil
+		if flag.TenantID != tenant || status == models.SecurityFlagOpen && resolved || status == models.SecurityFlagResolved && !resolved {
+			continue
+		}
+		flags = append(flags, flag)
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].ID > flags[j].ID })
+	return flags, nil
+}
+
+// ResolveSecurityFlag implements UserRepository
+func (m *MemoryRepository) ResolveSecurityFlag(ctx context.Context, id, adminID uint, at time.Time) (*models.SecurityFlag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	flag, ok := m.flags[id]
+	if !ok || flag.TenantID != TenantFromContext(ctx) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if flag.ResolvedAt == nil {
+		flag.ResolvedAt, flag.ResolvedBy = &at, &adminID
+		m.flags[id] = flag
+	}
+	return &flag, nil
+}
+
+// CreateConsent implements UserRepository
+func (m *MemoryRepository) CreateConsent(ctx context.Context, consent *models.Consent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	consent.ID = uint(len(m.consents) + 1)
+	m.consents = append(m.consents, *consent)
+	return nil
+}
+
+// ListConsents implements UserRepository
+func (m *MemoryRepository) ListConsents(ctx context.Context, userID uint) ([]models.Consent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	consents := []models.Consent{}
+	for i := len(m.consents) - 1; i >= 0; i-- {
+		if m.consents[i].UserID == userID {
+			consents = append(consents, m.consents[i])
+		}
+	}
+	return consents, nil
+}
+
+// GetPreferences implements UserRepository
+func (m *MemoryRepository) GetPreferences(ctx context.Context, userID uint) (models.Preferences, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	prefs := models.Preferences{}
+	for key, value := range m.preferences[userID] {
+		prefs[key] = value
+	}
+	return prefs, nil
+}
+
+// MergePreferences implements UserRepository
+func (m *MemoryRepository) MergePreferences(ctx context.Context, userID uint, patch models.Preferences) (models.Preferences, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.preferences[userID]
+	if stored == nil {
+		stored = models.Preferences{}
+		m.preferences[userID] = stored
+	}
+	for key, value := range patch {
+		if value == nil {
+			delete(stored, key)
+		} else {
+			stored[key] = value
+		}
+	}
+
+	merged := make(models.Preferences, len(stored))
+	for key, value := range stored {
+		merged[key] = value
+	}
+	return merged, nil
+}
+
+// CreateInvitation implements UserRepository
+func (m *MemoryRepository) CreateInvitation(ctx context.Context, inv *models.Invitation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	inv.ID = m.id()
+	inv.CreatedAt = time.Now()
+	inv.UpdatedAt = inv.CreatedAt
+	m.invitations[inv.ID] = *inv
+	return nil
+}
+
+// FindInvitation implements UserRepository
+func (m *MemoryRepository) FindInvitation(ctx context.Context, id uint) (*models.Invitation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	inv, ok := m.invitations[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &inv, nil
+}
+
+// ClaimInvitation implements UserRepository
+func (m *MemoryRepository) ClaimInvitation(ctx context.Context, tokenHash string, now time.Time) (*models.Invitation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, inv := range m.invitations {
+		if inv.TokenHash != "" && inv.TokenHash == tokenHash && inv.Status == models.InvitationPending && inv.ExpiresAt.After(now) {
+			inv.Status = models.InvitationAccepted
+			inv.TokenHash = ""
+			inv.AcceptedAt = &now
+			inv.UpdatedAt = now
+			m.invitations[id] = inv
+			return &inv, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// ListInvitations implements UserRepository
+func (m *MemoryRepository) ListInvitations(ctx context.Context, status string) ([]models.Invitation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	invitations := []models.Invitation{}
+	for _, inv := range m.invitations {
+		if status == "" || inv.Status == status {
+			invitations = append(invitations, inv)
+		}
+	}
+	sort.Slice(invitations, func(i, j int) bool { return invitations[i].ID > invitations[j].ID })
+	return invitations, nil
+}
+
+// UpdateInvitation implements UserRepository
+func (m *MemoryRepository) UpdateInvitation(ctx context.Context, inv *models.Invitation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.invitations[inv.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	inv.UpdatedAt = time.Now()
+	m.invitations[inv.ID] = *inv
+	return nil
+}
+
+// CreateOrganization implements UserRepository
+func (m *MemoryRepository) CreateOrganization(ctx context.Context, org *models.Organization, owner *models.Membership) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	org.ID = m.id()
+	if org.TenantID == "" {
+		org.TenantID = models.DefaultTenant
+	}
+	org.CreatedAt, org.UpdatedAt = now, now
+	m.orgs[org.ID] = *org
+
+	owner.ID = m.id()
+	owner.OrgID = org.ID
+	owner.CreatedAt, owner.UpdatedAt = now, now
+	m.memberships = append(m.memberships, *owner)
+	return nil
+}
+
+// FindOrganization implements UserRepository
+func (m *MemoryRepository) FindOrganization(ctx context.Context, id uint) (*models.Organization, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	org, ok := m.orgs[id]
+	if !ok || org.TenantID != TenantFromContext(ctx) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &org, nil
+}
+
+// ListOrganizationsByUser implements UserRepository
+func (m *MemoryRepository) ListOrganizationsByUser(ctx context.Context, userID uint) ([]models.Organization, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	orgs := []models.Organization{}
+	for _, ms := range m.memberships {
+		if ms.UserID == userID {
+			org := m.orgs[ms.OrgID]
+			org.Role = ms.Role
+			orgs = append(orgs, org)
+		}
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].ID < orgs[j].ID })
+	return orgs, nil
+}
+
+// UpdateOrganization implements UserRepository
+func (m *MemoryRepository) UpdateOrganization(ctx context.Context, org *models.Organization) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.orgs[org.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	org.UpdatedAt = time.Now()
+	stored := *org
+	stored.Role = ""
+	m.orgs[org.ID] = stored
+	return nil
+}
+
+// DeleteOrganization implements UserRepository
+func (m *MemoryRepository) DeleteOrganization(ctx context.Context, id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.orgs[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(m.orgs, id)
+	m.removeMemberships(func(ms models.Membership) bool { return ms.OrgID == id })
+	return nil
+}
+
+// FindMembership implements UserRepository
+func (m *MemoryRepository) FindMembership(ctx context.Context, orgID, userID uint) (*models.Membership, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, ms := range m.memberships {
+		if ms.OrgID == orgID && ms.UserID == userID {
+			return &ms, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// ListMemberships implements UserRepository
+func (m *MemoryRepository) ListMemberships(ctx context.Context, orgID uint) ([]models.Membership, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	members := []models.Membership{}
+	for _, ms := range m.memberships {
+		if ms.OrgID == orgID {
+			if user, ok := m.users[ms.UserID]; ok {
+				ms.User = &user
+			}
+			members = append(members, ms)
+		}
+	}
+	return members, nil
+}
+
+// CreateMembership implements UserRepository
+func (m *MemoryRepository) CreateMembership(ctx context.Context, ms *models.Membership) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.memberships {
+		if existing.OrgID == ms.OrgID && existing.UserID == ms.UserID {
+			return ErrDuplicateKey
+		}
+	}
+	ms.ID = m.id()
+	ms.CreatedAt = time.Now()
+	ms.UpdatedAt = ms.CreatedAt
+	stored := *ms
+	stored.User = nil
+	m.memberships = append(m.memberships, stored)
+	return nil
+}
+
+// UpdateMembership implements UserRepository
+func (m *MemoryRepository) UpdateMembership(ctx context.Context, ms *models.Membership) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.memberships {
+		if m.memberships[i].ID == ms.ID {
+			m.memberships[i].Role = ms.Role
+			m.memberships[i].UpdatedAt = time.Now()
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+// DeleteMembership implements UserRepository
+func (m *MemoryRepository) DeleteMembership(ctx context.Context, orgID, userID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removeMemberships(func(ms models.Membership) bool { return ms.OrgID == orgID && ms.UserID == userID })
+	return nil
+}
+
+// removeMemberships drops the memberships matching match; m.mu must be held
+func (m *MemoryRepository) removeMemberships(match func(models.Membership) bool) {
+	kept := m.memberships[:0]
+	for _, ms := range m.memberships {
+		if !match(ms) {
+			kept = append(kept, ms)
+		}
+	}
+	m.memberships = kept
+}
+
+// Ping implements UserRepository
+func (m *MemoryRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
+// filter returns copies of the users matching keep, ordered by ID
+func (m *MemoryRepository) filter(keep func(models.User) bool) []models.User {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := make([]models.User, 0, len(m.users))
+	for _, user := range m.users {
+		if keep(user) {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users
+}
+
+// sameEmail compares emails as Postgres does: lower(email) = lower(?), the
+// expression behind idx_users_tenant_email_lower
+func sameEmail(a, b string) bool {
+	return strings.ToLower(a) == strings.ToLower(b)
+}
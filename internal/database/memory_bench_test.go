@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// benchmarkUsers is the number of users the benchmarks list and search
+const benchmarkUsers = 1000
+
+func newBenchmarkRepository(b *testing.B) *MemoryRepository {
+	b.Helper()
+	repo := NewMemoryRepository()
+	for i := 0; i < benchmarkUsers; i++ {
+		user := &models.User{Name: fmt.Sprintf("User %d", i), Email: fmt.Sprintf("user%d@example.com", i)}
+		if err := repo.CreateUser(context.Background(), user); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return repo
+}
+
+func BenchmarkMemoryFindUserByID(b *testing.B) {
+	repo := newBenchmarkRepository(b)
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := repo.FindUserByID(ctx, uint(i%benchmarkUsers)+1); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMemoryListUsersPage(b *testing.B) {
+	repo := newBenchmarkRepository(b)
+	ctx := context.Background()
+	q := models.UserListQuery{
+		Filter:  []models.UserFilterTerm{{Field: "email", Operator: ":", Value: "example.com"}},
+		OrderBy: "name",
+		Limit:   50,
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := repo.ListUsersPage(ctx, q); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMemorySearchUsers(b *testing.B) {
+	repo := newBenchmarkRepository(b)
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := repo.SearchUsers(ctx, "user 42", 20); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// migration is a versioned SQL migration applied after AutoMigrate
+type migration struct {
+	Version int
+	Name    string
+	SQL     []string
+}
+
+// schemaMigration records an applied migration
+type schemaMigration struct {
+	Version int    `gorm:"primaryKey;autoIncrement:false"`
+	Name    string `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// migrations lists SQL migrations in the order they must be applied
+var migrations = []migration{
+	{
+		Version: 1,
+		Name:    "users_search_trigram",
+		SQL: []string{
+			"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+			"CREATE INDEX IF NOT EXISTS idx_users_name_trgm ON users USING gin (name gin_trgm_ops)",
+			"CREATE INDEX IF NOT EXISTS idx_users_email_trgm ON users USING gin (email gin_trgm_ops)",
+		},
+	},
+	{
+		// The policy only takes effect once row-level security is enabled on
+		// users, which migrate does in TENANCY_MODE=rls. Without app.tenant_id
+		// (set by the ApplyTenant session hook) queries fail instead of
+		// seeing every tenant.
+		Version: 2,
+		Name:    "users_tenant_rls",
+		SQL: []string{
+			"DROP POLICY IF EXISTS users_tenant_isolation ON users",
+			tenantPolicy,
+		},
+	},
+	{
+		// users_history is maintained by triggers so every write path is
+		// covered. Updates only record a snapshot when a tracked column
+		// changes, so last_login_at bumps don't add rows.
+		Version: 3,
+		Name:    "users_history_triggers",
+		SQL: []string{
+			`CREATE OR REPLACE FUNCTION users_history_record() RETURNS trigger AS $$
+			BEGIN
+				IF TG_OP IN ('UPDATE', 'DELETE') THEN
+					UPDATE users_history SET valid_to = now() WHERE user_id = OLD.id AND valid_to IS NULL;
+				END IF;
+				IF TG_OP IN ('INSERT', 'UPDATE') THEN
+					INSERT INTO users_history (user_id, name, email, role, tenant_id, attributes, valid_from)
+					VALUES (NEW.id, NEW.name, NEW.email, NEW.role, NEW.tenant_id, NEW.attributes, now());
+				END IF;
+				RETURN NULL;
+			END
+			$$ LANGUAGE plpgsql`,
+			"DROP TRIGGER IF EXISTS users_history_insert_delete ON users",
+			"CREATE TRIGGER users_history_insert_delete AFTER INSERT OR DELETE ON users FOR EACH ROW EXECUTE FUNCTION users_history_record()",
+			"DROP TRIGGER IF EXISTS users_history_update ON users",
+			`CREATE TRIGGER users_history_update AFTER UPDATE ON users FOR EACH ROW
+				WHEN ((OLD.name, OLD.email, OLD.role, OLD.tenant_id, OLD.attributes) IS DISTINCT FROM (NEW.name, NEW.email, NEW.role, NEW.tenant_id, NEW.attributes))
+				EXECUTE FUNCTION users_history_record()`,
+			// Backfill a snapshot for users created before history was tracked
+			`INSERT INTO users_history (user_id, name, email, role, tenant_id, attributes, valid_from)
+				SELECT id, name, email, role, tenant_id, attributes, created_at FROM users u
+				WHERE NOT EXISTS (SELECT 1 FROM users_history h WHERE h.user_id = u.id)`,
+		},
+	},
+	{
+		// Lets admins and reports find users by a preference value, e.g.
+		// preferences @> '{"language": "de"}'
+		Version: 4,
+		Name:    "user_preferences_gin",
+		SQL: []string{
+			"CREATE INDEX IF NOT EXISTS idx_user_preferences_preferences ON user_preferences USING gin (preferences jsonb_path_ops)",
+		},
+	},
+	{
+		// A phone number signs in at most one account per tenant, so only
+		// one user may have it verified
+		Version: 5,
+		Name:    "users_verified_phone_unique",
+		SQL: []string{
+			"CREATE UNIQUE INDEX IF NOT EXISTS idx_users_verified_phone ON users (tenant_id, phone) WHERE phone_verified_at IS NOT NULL",
+		},
+	},
+	{
+		// Replaces the first tenant policy, which let sessions without
+		// app.tenant_id see every tenant. Whether it is enforced now
+		// follows TENANCY_MODE, see enforceTenantPolicy.
+		Version: 6,
+		Name:    "users_tenant_rls_strict",
+		SQL: []string{
+			"DROP POLICY IF EXISTS users_tenant_isolation ON users",
+			tenantPolicy,
+			"ALTER TABLE users NO FORCE ROW LEVEL SECURITY",
+			"ALTER TABLE users DISABLE ROW LEVEL SECURITY",
+		},
+	},
+	{
+		// Emails are unique per tenant (idx_users_tenant_email), so that
+		// signing up in one tenant doesn't reveal accounts in another
+		Version: 7,
+		Name:    "users_email_unique_per_tenant",
+		SQL: []string{
+			"DROP INDEX IF EXISTS idx_users_email",
+		},
+	},
+	{
+		// Emails are looked up with lower(email), and the service stores
+		// them lowercased. Rows written before that are lowercased here;
+		// where that would make two accounts of a tenant collide, the newer
+		// ones are renamed to <email>.duplicate-<id> until an admin merges
+		// or fixes them.
+		Version: 8,
+		Name:    "users_email_lowercase",
+		SQL: []string{
+			`UPDATE users u SET email = lower(u.email) || '.duplicate-' || u.id
+				WHERE EXISTS (SELECT 1 FROM users o WHERE o.tenant_id = u.tenant_id AND lower(o.email) = lower(u.email) AND o.id < u.id)`,
+			"UPDATE users SET email = lower(email) WHERE email <> lower(email)",
+			"CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_email_lower ON users (tenant_id, lower(email))",
+		},
+	},
+}
+
+// tenantPolicy restricts users to the tenant in app.tenant_id.
+// current_setting without missing_ok raises an error when it isn't set.
+const tenantPolicy = `CREATE POLICY users_tenant_isolation ON users
+	USING (tenant_id = current_setting('app.tenant_id'))
+	WITH CHECK (tenant_id = current_setting('app.tenant_id'))`
+
+// MigrationOptions control how Migrate changes the schema
+type MigrationOptions struct {
+	// LockTimeout is how long to wait for another replica that is migrating
+	LockTimeout time.Duration
+	// Role is assumed while migrating, when set. With RowLevelSecurity it
+	// needs BYPASSRLS, since migrations work across tenants.
+	Role string
+	// RowLevelSecurity enforces the tenant policy on users, including for
+	// the table owner (TENANCY_MODE=rls); otherwise it is disabled
+	RowLevelSecurity bool
+}
+
+// migrationLockKey identifies the advisory lock serializing schema changes
+// across replicas ("restapi" in ASCII)
+const migrationLockKey int64 = 0x72657374617069
+
+// migrate applies the schema while holding a Postgres advisory lock, so that
+// when several replicas boot at once they migrate one after the other. Those
+// that waited find little left to do, as AutoMigrate and the SQL migrations
+// only change what differs.
+func migrate(db *gorm.DB, opts MigrationOptions) error {
+	// Advisory locks belong to a database session, so hold one connection throughout
+	return db.Connection(func(conn *gorm.DB) error {
+		if opts.Role != "" {
+			if err := conn.Exec("SET ROLE " + quoteIdentifier(opts.Role)).Error; err != nil {
+				return fmt.Errorf("assume migration role: %w", err)
+			}
+			// The connection goes back to the pool afterwards
+			defer func() {
+				if err := conn.Exec("RESET ROLE").Error; err != nil {
+					logger.LogDatabase("migrate", "users").WithError(err).Warn("Failed to reset migration role")
+				}
+			}()
+		}
+
+		var acquired bool
+		if err := conn.Raw("SELECT pg_try_advisory_lock(?)", migrationLockKey).Scan(&acquired).Error; err != nil {
+			return fmt.Errorf("acquire migration lock: %w", err)
+		}
+		if !acquired {
+			logger.LogDatabase("migrate", "schema_migrations").
+				WithField("timeout", opts.LockTimeout.String()).
+				Info("Another replica is migrating the database, waiting")
+
+			ctx, cancel := context.WithTimeout(context.Background(), opts.LockTimeout)
+			defer cancel()
+			if err := conn.WithContext(ctx).Exec("SELECT pg_advisory_lock(?)", migrationLockKey).Error; err != nil {
+				return fmt.Errorf("wait for migration lock: %w", err)
+			}
+		}
+		defer func() {
+			if err := conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockKey).Error; err != nil {
+				logger.LogDatabase("migrate", "schema_migrations").WithError(err).Warn("Failed to release migration lock")
+			}
+		}()
+
+		if !acquired {
+			// The other replica may have run an older build, given up part
+			// way or used other options, so check the schema against ours
+			logger.LogDatabase("migrate", "schema_migrations").Info("Another replica finished migrating, checking the schema")
+		}
+
+		logger.LogDatabase("migrate", "users").Info("Running database migration")
+		if err := conn.AutoMigrate(&models.User{}, &models.AttributeDefinition{}, &models.UserHistory{}, &models.ExperimentExposure{},
+			&models.RecoveryCase{}, &models.RecoveryCaseEvent{}, &models.Identity{}, &models.DataExport{}, &models.Consent{}, &models.UserPreferences{}, &models.Invitation{},
+			&models.Organization{}, &models.Membership{}, &models.KnownDevice{}, &models.SecurityFlag{}, &models.SignupDomainPolicy{}); err != nil {
+			return fmt.Errorf("migrate database: %w", err)
+		}
+		if err := runMigrations(conn); err != nil {
+			return fmt.Errorf("apply database migrations: %w", err)
+		}
+		if err := enforceTenantPolicy(conn, opts.RowLevelSecurity); err != nil {
+			return fmt.Errorf("configure row-level security: %w", err)
+		}
+		return nil
+	})
+}
+
+// enforceTenantPolicy enables or disables row-level security on users, only
+// altering the table when its state differs, since ALTER TABLE takes an
+// exclusive lock
+func enforceTenantPolicy(db *gorm.DB, enabled bool) error {
+	var state struct {
+		Enabled bool
+		Forced  bool
+	}
+	err := db.Raw("SELECT relrowsecurity AS enabled, relforcerowsecurity AS forced FROM pg_class WHERE oid = 'users'::regclass").Scan(&state).Error
+	if err != nil || (state.Enabled == enabled && state.Forced == enabled) {
+		return err
+	}
+
+	statements := []string{"ALTER TABLE users NO FORCE ROW LEVEL SECURITY", "ALTER TABLE users DISABLE ROW LEVEL SECURITY"}
+	if enabled {
+		// FORCE applies the policy to the table owner too; superusers and
+		// BYPASSRLS roles still bypass it
+		statements = []string{"ALTER TABLE users ENABLE ROW LEVEL SECURITY", "ALTER TABLE users FORCE ROW LEVEL SECURITY"}
+	}
+	logger.LogDatabase("migrate", "users").WithField("row_level_security", enabled).Info("Changing row-level security")
+	for _, stmt := range statements {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runMigrations applies pending SQL migrations, each in its own transaction
+func runMigrations(db *gorm.DB) error {
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		return err
+	}
+
+	var applied []int
+	if err := db.Model(&schemaMigration{}).Pluck("version", &applied).Error; err != nil {
+		return err
+	}
+	done := make(map[int]bool, len(applied))
+	for _, v := range applied {
+		done[v] = true
+	}
+
+	for _, m := range migrations {
+		if done[m.Version] {
+			continue
+		}
+
+		logger.LogDatabase("migrate", "schema_migrations").
+			WithField("version", m.Version).
+			WithField("name", m.Name).
+			Info("Applying migration")
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, stmt := range m.SQL {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name}).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckMigrations returns an error unless every SQL migration has been
+// applied. During an outage it reports the outage instead.
+func (p *PostgresRepository) CheckMigrations(ctx context.Context) error {
+	if p.Unavailable() {
+		return p.outage()
+	}
+	pending, err := pendingMigrations(p.db.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	if pending > 0 {
+		return fmt.Errorf("%d migrations pending", pending)
+	}
+	return nil
+}
+
+// pendingMigrations counts the SQL migrations not yet applied
+func pendingMigrations(db *gorm.DB) (int64, error) {
+	var applied int64
+	err := db.Model(&schemaMigration{}).
+		Where("version <= ?", migrations[len(migrations)-1].Version).
+		Count(&applied).Error
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(migrations)) - applied, nil
+}
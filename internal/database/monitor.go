@@ -0,0 +1,125 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/metrics"
+)
+
+// ErrUnavailable is returned by repository operations while the database
+// is unreachable, instead of each waiting for its own timeout
+var ErrUnavailable = errors.New("database unavailable")
+
+// defaultMaxIdleConns is database/sql's default, which the repository keeps
+const defaultMaxIdleConns = 2
+
+// circuit fails repository operations fast while the database is down
+type circuit struct {
+	open atomic.Bool
+
+	mu    sync.Mutex
+	since time.Time
+	err   error // why the last ping failed
+}
+
+// MonitorConnection pings the database every interval until ctx is done.
+// After failures pings in a row fail, it opens the circuit: operations
+// fail at once with ErrUnavailable, idle connections are dropped, and the
+// database is pinged with backoff until it answers, which closes the
+// circuit again. It returns immediately.
+func (p *PostgresRepository) MonitorConnection(ctx context.Context, interval time.Duration, failures int) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		failed := 0
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if p.connecting() {
+				continue
+			}
+
+			err := p.pingOnce(ctx)
+			if err == nil {
+				failed = 0
+				continue
+			}
+			failed++
+			logger.LogDatabase("ping", "").WithError(err).WithField("failures", failed).Warn("Database ping failed")
+			if failed < failures {
+				continue
+			}
+
+			p.openCircuit(err)
+			err = keepTrying(ctx, func() error {
+				return p.pingOnce(ctx)
+			}, func(err error, delay time.Duration) {
+				p.circuit.mu.Lock()
+				p.circuit.err = err
+				p.circuit.mu.Unlock()
+				logger.LogDatabase("reconnect", "").WithError(err).
+					WithField("retry_delay_ms", delay.Milliseconds()).
+					Debug("Database still unavailable")
+			})
+			if err != nil {
+				return
+			}
+			p.closeCircuit()
+			failed = 0
+		}
+	}()
+}
+
+// Unavailable reports whether the circuit is open because the database
+// was lost
+func (p *PostgresRepository) Unavailable() bool {
+	return p.circuit.open.Load()
+}
+
+// openCircuit starts an outage. Idle connections are dropped, since they
+// may not survive it; database/sql dials new ones once it is over.
+func (p *PostgresRepository) openCircuit(err error) {
+	p.circuit.mu.Lock()
+	p.circuit.since, p.circuit.err = time.Now(), err
+	p.circuit.mu.Unlock()
+	p.circuit.open.Store(true)
+
+	if sqlDB, dbErr := p.db.DB(); dbErr == nil {
+		sqlDB.SetMaxIdleConns(0)
+		sqlDB.SetMaxIdleConns(defaultMaxIdleConns)
+	}
+	metrics.RecordDatabaseCircuit(true)
+	logger.LogDatabase("reconnect", "").WithError(err).Error("Database connection lost, failing queries fast until it is back")
+}
+
+// closeCircuit ends an outage
+func (p *PostgresRepository) closeCircuit() {
+	p.circuit.mu.Lock()
+	since := p.circuit.since
+	p.circuit.err = nil
+	p.circuit.mu.Unlock()
+	p.circuit.open.Store(false)
+
+	metrics.RecordDatabaseCircuit(false)
+	logger.LogDatabase("reconnect", "").WithField("outage_ms", time.Since(since).Milliseconds()).Info("Database connection restored")
+}
+
+// outage describes the current outage for readiness checks: the service
+// is degraded rather than unready, since every replica shares the database
+// and answers quickly while it is down
+func (p *PostgresRepository) outage() error {
+	p.circuit.mu.Lock()
+	since, err := p.circuit.since, p.circuit.err
+	p.circuit.mu.Unlock()
+	return metrics.Degraded(fmt.Errorf("%w since %s: %v", ErrUnavailable, since.UTC().Format(time.RFC3339), err))
+}
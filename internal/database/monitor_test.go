@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/114windd/restapi/internal/metrics"
+)
+
+func TestMonitorConnection(t *testing.T) {
+	repo, err := OpenLazy(unreachable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo.MonitorConnection(ctx, 10*time.Millisecond, 2)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !repo.Unavailable() {
+		if time.Now().After(deadline) {
+			t.Fatal("the circuit did not open with the database unreachable")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Operations fail at once instead of being retried
+	start := time.Now()
+	if _, err := repo.FindUserByID(ctx, 1); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable during the outage, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("a query during the outage took %s", elapsed)
+	}
+
+	// Readiness reports the outage as degrading the service
+	registry := metrics.NewRegistry()
+	registry.Register("database", metrics.CheckFunc(repo.CheckConnection))
+	registry.Register("migrations", metrics.CheckFunc(repo.CheckMigrations))
+	report := registry.Run(ctx)
+	if report.Status != metrics.StatusDegraded || report.Dependencies["database"].Status != metrics.StatusDegraded {
+		t.Fatalf("expected a degraded report during the outage, got %+v", report)
+	}
+
+	repo.closeCircuit()
+	if repo.Unavailable() {
+		t.Fatal("the circuit stayed open")
+	}
+}
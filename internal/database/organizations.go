@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/retry"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// CreateOrganization creates an organization together with its first owner
+func (p *PostgresRepository) CreateOrganization(ctx context.Context, org *models.Organization, owner *models.Membership) error {
+	logger.LogDatabase("create", "organizations").WithField("user_id", owner.UserID).Debug("Attempting to create organization")
+
+	return p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(org).Error; err != nil {
+				return err
+			}
+			owner.OrgID = org.ID
+			return tx.Omit("User", "Organization").Create(owner).Error
+		})
+	})
+}
+
+// FindOrganization returns an organization of the context's tenant by ID
+func (p *PostgresRepository) FindOrganization(ctx context.Context, id uint) (*models.Organization, error) {
+	var org models.Organization
+	config := retry.DefaultRetryConfig()
+
+	err := retry.ExecuteWithRetry(ctx, "find_organization", func() error {
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.Where("tenant_id = ?", TenantFromContext(ctx)).First(&org, id).Error
+		})
+	}, config)
+
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// ListOrganizationsByUser returns the organizations a user belongs to, with
+// their role in each, oldest first
+func (p *PostgresRepository) ListOrganizationsByUser(ctx context.Context, userID uint) ([]models.Organization, error) {
+	var orgs []models.Organization
+	config := retry.DefaultRetryConfig()
+
+	err := retry.ExecuteWithRetry(ctx, "list_organizations", func() error {
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.Select("organizations.*, memberships.role").
+				Joins("JOIN memberships ON memberships.org_id = organizations.id").
+				Where("memberships.user_id = ?", userID).
+				Order("organizations.id").Find(&orgs).Error
+		})
+	}, config)
+
+	if err != nil {
+		return nil, err
+	}
+	return orgs, nil
+}
+
+// UpdateOrganization saves an organization
+func (p *PostgresRepository) UpdateOrganization(ctx context.Context, org *models.Organization) error {
+	return p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Save(org).Error
+	})
+}
+
+// DeleteOrganization deletes an organization; its memberships cascade
+func (p *PostgresRepository) DeleteOrganization(ctx context.Context, id uint) error {
+	logger.LogDatabase("delete", "organizations").WithField("org_id", id).Debug("Attempting to delete organization")
+
+	return p.withSession(ctx, func(tx *gorm.DB) error {
+		result := tx.Delete(&models.Organization{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// FindMembership returns a user's membership of an organization
+func (p *PostgresRepository) FindMembership(ctx context.Context, orgID, userID uint) (*models.Membership, error) {
+	var m models.Membership
+	err := p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Where("org_id = ? AND user_id = ?", orgID, userID).Take(&m).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ListMemberships returns the members of an organization with their user
+// records, in the order they joined
+func (p *PostgresRepository) ListMemberships(ctx context.Context, orgID uint) ([]models.Membership, error) {
+	var members []models.Membership
+	config := retry.DefaultRetryConfig()
+
+	err := retry.ExecuteWithRetry(ctx, "list_memberships", func() error {
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.Preload("User").Where("org_id = ?", orgID).Order("id").Find(&members).Error
+		})
+	}, config)
+
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// CreateMembership adds a user to an organization. A user already in it
+// gets ErrDuplicateKey.
+func (p *PostgresRepository) CreateMembership(ctx context.Context, m *models.Membership) error {
+	err := p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Omit("User", "Organization").Create(m).Error
+	})
+	if dup := uniqueViolation(err); dup != nil {
+		return dup
+	}
+	return err
+}
+
+// UpdateMembership saves a membership's role
+func (p *PostgresRepository) UpdateMembership(ctx context.Context, m *models.Membership) error {
+	return p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Model(m).Update("role", m.Role).Error
+	})
+}
+
+// DeleteMembership removes a user from an organization
+func (p *PostgresRepository) DeleteMembership(ctx context.Context, orgID, userID uint) error {
+	return p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Where("org_id = ? AND user_id = ?", orgID, userID).Delete(&models.Membership{}).Error
+	})
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/retry"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// GetPreferences returns the preferences a user stored; empty when they never set any
+func (p *PostgresRepository) GetPreferences(ctx context.Context, userID uint) (models.Preferences, error) {
+	var row models.UserPreferences
+	config := retry.DefaultRetryConfig()
+
+	err := retry.ExecuteWithRetry(ctx, "get_preferences", func() error {
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.Where("user_id = ?", userID).Take(&row).Error
+		})
+	}, config)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Preferences{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return row.Preferences, nil
+}
+
+// MergePreferences merges patch into a user's stored preferences and
+// returns the result. Keys set to null are removed. The merge runs in a
+// single statement, so concurrent updates of different keys don't overwrite
+// each other.
+func (p *PostgresRepository) MergePreferences(ctx context.Context, userID uint, patch models.Preferences) (models.Preferences, error) {
+	logger.LogDatabase("upsert", "user_preferences").WithField("user_id", userID).Debug("Attempting to merge preferences")
+
+	var merged models.Preferences
+	err := p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Raw(`INSERT INTO user_preferences (user_id, tenant_id, preferences, updated_at)
+			VALUES (?, ?, jsonb_strip_nulls(?::jsonb), now())
+			ON CONFLICT (user_id) DO UPDATE
+			SET preferences = jsonb_strip_nulls(user_preferences.preferences || ?::jsonb), updated_at = now()
+			RETURNING preferences`, userID, TenantFromContext(ctx), patch, patch).Row().Scan(&merged)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
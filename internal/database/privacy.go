@@ -0,0 +1,140 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/retry"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// CreateDataExport records a new data export request
+func (p *PostgresRepository) CreateDataExport(ctx context.Context, export *models.DataExport) error {
+	logger.LogDatabase("create", "data_exports").WithField("user_id", export.UserID).Debug("Attempting to create data export")
+
+	return p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Create(export).Error
+	})
+}
+
+// UpdateDataExport saves the progress of a data export
+func (p *PostgresRepository) UpdateDataExport(ctx context.Context, export *models.DataExport) error {
+	return p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Save(export).Error
+	})
+}
+
+// ListDataExports returns a user's data exports, newest first
+func (p *PostgresRepository) ListDataExports(ctx context.Context, userID uint) ([]models.DataExport, error) {
+	var exports []models.DataExport
+	config := retry.DefaultRetryConfig()
+
+	err := retry.ExecuteWithRetry(ctx, "list_data_exports", func() error {
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.Where("user_id = ?", userID).Order("id DESC").Find(&exports).Error
+		})
+	}, config)
+
+	if err != nil {
+		return nil, err
+	}
+	return exports, nil
+}
+
+// ListExpiredDataExports returns exports whose archives expired before now
+func (p *PostgresRepository) ListExpiredDataExports(ctx context.Context, now time.Time) ([]models.DataExport, error) {
+	var exports []models.DataExport
+	err := p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Where("expires_at < ?", now).Find(&exports).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return exports, nil
+}
+
+// DeleteDataExport removes an export record
+func (p *PostgresRepository) DeleteDataExport(ctx context.Context, id uint) error {
+	return p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Delete(&models.DataExport{}, id).Error
+	})
+}
+
+// ListIdentitiesByUser returns the external identities linked to a user
+func (p *PostgresRepository) ListIdentitiesByUser(ctx context.Context, userID uint) ([]models.Identity, error) {
+	var identities []models.Identity
+	err := p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Where("user_id = ?", userID).Order("id").Find(&identities).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// ListRecoveryCasesByUser returns a user's recovery cases with their audit
+// events, oldest first
+func (p *PostgresRepository) ListRecoveryCasesByUser(ctx context.Context, userID uint) ([]models.RecoveryCase, error) {
+	var cases []models.RecoveryCase
+	err := p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Preload("Events", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+			Where("user_id = ?", userID).Order("id").Find(&cases).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cases, nil
+}
+
+// AnonymizeUserRecords erases the personal data of a deleted user from the
+// records kept about them: history snapshots, recovery cases, consents,
+// security flags and invitations keep their rows, with names, addresses, network details and
+// free text replaced. Identities linking the user to external providers,
+// their known devices and their preferences are removed.
+func (p *PostgresRepository) AnonymizeUserRecords(ctx context.Context, userID uint) error {
+	logger.LogDatabase("update", "users_history").WithField("user_id", userID).Debug("Attempting to anonymize user records")
+
+	return p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.UserHistory{}).Where("user_id = ?", userID).
+				Updates(map[string]interface{}{"name": models.Erased, "email": models.Erased, "attributes": models.Attributes{}}).Error; err != nil {
+				return err
+			}
+			var caseIDs []uint
+			if err := tx.Model(&models.RecoveryCase{}).Where("user_id = ?", userID).Pluck("id", &caseIDs).Error; err != nil {
+				return err
+			}
+			if len(caseIDs) > 0 {
+				if err := tx.Model(&models.RecoveryCase{}).Where("id IN ?", caseIDs).
+					Updates(map[string]interface{}{"reason": models.Erased, "verification": models.Erased, "new_email": ""}).Error; err != nil {
+					return err
+				}
+				if err := tx.Model(&models.RecoveryCaseEvent{}).Where("case_id IN ? AND note <> ''", caseIDs).
+					Update("note", models.Erased).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(&models.Consent{}).Where("user_id = ?", userID).
+				Updates(map[string]interface{}{"ip": "", "user_agent": ""}).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.SecurityFlag{}).Where("user_id = ?", userID).Update("ip", "").Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Invitation{}).Where("user_id = ?", userID).
+				Updates(map[string]interface{}{"email": models.Erased, "token_hash": ""}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("user_id = ?", userID).Delete(&models.UserPreferences{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("user_id = ?", userID).Delete(&models.KnownDevice{}).Error; err != nil {
+				return err
+			}
+			return tx.Where("user_id = ?", userID).Delete(&models.Identity{}).Error
+		})
+	})
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/metrics"
+)
+
+// preparedStatementCacheSize bounds the statements kept prepared per connection pool
+const preparedStatementCacheSize = 500
+
+const queryStartKey = "restapi:query_start"
+
+// queryStats is a GORM plugin timing every statement. Durations are exported
+// per query name ("<operation> <table>"), and statements slower than the
+// threshold are logged with their SQL, whose bound parameters are left as
+// placeholders so no values reach the log.
+type queryStats struct {
+	threshold atomic.Int64 // time.Duration; zero disables the slow query log
+}
+
+func (q *queryStats) Name() string {
+	return "restapi:query_stats"
+}
+
+func (q *queryStats) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().Before("*").Register("restapi:query_start", startQuery),
+		callbacks.Create().After("*").Register("restapi:query_end", q.finish("insert")),
+		callbacks.Query().Before("*").Register("restapi:query_start", startQuery),
+		callbacks.Query().After("*").Register("restapi:query_end", q.finish("select")),
+		callbacks.Update().Before("*").Register("restapi:query_start", startQuery),
+		callbacks.Update().After("*").Register("restapi:query_end", q.finish("update")),
+		callbacks.Delete().Before("*").Register("restapi:query_start", startQuery),
+		callbacks.Delete().After("*").Register("restapi:query_end", q.finish("delete")),
+		callbacks.Row().Before("*").Register("restapi:query_start", startQuery),
+		callbacks.Row().After("*").Register("restapi:query_end", q.finish("select")),
+		callbacks.Raw().Before("*").Register("restapi:query_start", startQuery),
+		callbacks.Raw().After("*").Register("restapi:query_end", q.finish("exec")),
+	)
+}
+
+func startQuery(db *gorm.DB) {
+	db.InstanceSet(queryStartKey, time.Now())
+}
+
+// finish records a statement of the given operation once it has run
+func (q *queryStats) finish(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		start, ok := db.InstanceGet(queryStartKey)
+		if !ok {
+			return
+		}
+		elapsed := time.Since(start.(time.Time))
+		table := db.Statement.Table
+		name := operation
+		if table != "" {
+			name += " " + table
+		}
+		metrics.RecordQuery(name, elapsed)
+
+		threshold := time.Duration(q.threshold.Load())
+		if threshold <= 0 || elapsed < threshold {
+			return
+		}
+		log := logger.LogDatabase(operation, table).
+			WithField("query", name).
+			WithField("duration_ms", elapsed.Milliseconds()).
+			WithField("sql", db.Statement.SQL.String()).
+			WithField("params", len(db.Statement.Vars)).
+			WithField("rows", db.RowsAffected)
+		if db.Error != nil {
+			log = log.WithError(db.Error)
+		}
+		log.Warn("Slow query")
+	}
+}
+
+// SetSlowQueryThreshold logs statements taking at least threshold; zero
+// disables the log. Durations are exported as db_query_duration_seconds
+// either way.
+func (p *PostgresRepository) SetSlowQueryThreshold(threshold time.Duration) {
+	p.stats.threshold.Store(int64(threshold))
+}
+
+// EnablePreparedStatements prepares each distinct statement once per
+// connection and reuses it. Don't enable it behind a pooler in transaction
+// mode, such as PgBouncer, which can't keep statements across transactions.
+func (p *PostgresRepository) EnablePreparedStatements() {
+	p.db.Config.PrepareStmtMaxSize = preparedStatementCacheSize
+	p.db = p.db.Session(&gorm.Session{PrepareStmt: true})
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+func TestSlowQueryLogRedactsParameters(t *testing.T) {
+	logger.Init()
+	hook := test.NewLocal(logger.Log)
+
+	// A dry run builds statements and runs the callbacks without a server
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+		Logger:               gormlogger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := &queryStats{}
+	if err := db.Use(stats); err != nil {
+		t.Fatal(err)
+	}
+
+	var user models.User
+	db.Where("email = ?", "alice@example.com").First(&user)
+	if len(hook.AllEntries()) != 0 {
+		t.Fatal("no statement should be logged without a threshold")
+	}
+
+	stats.threshold.Store(int64(time.Nanosecond))
+	db.Where("email = ?", "alice@example.com").First(&user)
+	entry := hook.LastEntry()
+	if entry == nil || entry.Message != "Slow query" || entry.Level != logrus.WarnLevel {
+		t.Fatalf("slow query not logged: %+v", entry)
+	}
+	if entry.Data["query"] != "select users" || entry.Data["params"] != 2 {
+		t.Fatalf("query fields: %v", entry.Data)
+	}
+	sql, _ := entry.Data["sql"].(string)
+	if !strings.Contains(sql, "email = $1") || strings.Contains(sql, "alice") {
+		t.Fatalf("parameters must stay placeholders: %s", sql)
+	}
+}
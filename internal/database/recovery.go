@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/retry"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// CreateRecoveryCase creates a recovery case together with its first audit event
+func (p *PostgresRepository) CreateRecoveryCase(ctx context.Context, rc *models.RecoveryCase, event *models.RecoveryCaseEvent) error {
+	logger.LogDatabase("create", "recovery_cases").WithField("user_id", rc.UserID).Debug("Attempting to create recovery case")
+
+	return p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Omit("Events").Create(rc).Error; err != nil {
+				return err
+			}
+			event.CaseID = rc.ID
+			return tx.Create(event).Error
+		})
+	})
+}
+
+// FindRecoveryCase returns a recovery case with its audit events, oldest first
+func (p *PostgresRepository) FindRecoveryCase(ctx context.Context, id uint) (*models.RecoveryCase, error) {
+	var rc models.RecoveryCase
+	config := retry.DefaultRetryConfig()
+
+	err := retry.ExecuteWithRetry(ctx, "find_recovery_case", func() error {
+		logger.LogDatabase("select", "recovery_cases").WithField("id", id).Debug("Attempting to fetch recovery case")
+
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.Preload("Events", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).First(&rc, id).Error
+		})
+	}, config)
+
+	if err != nil {
+		return nil, err
+	}
+	return &rc, nil
+}
+
+// FindRecoveryCaseByToken returns the case whose unexpired reset token has the given hash
+func (p *PostgresRepository) FindRecoveryCaseByToken(ctx context.Context, tokenHash string, now time.Time) (*models.RecoveryCase, error) {
+	var rc models.RecoveryCase
+	err := p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Where("reset_token_hash = ? AND reset_token_expires > ?", tokenHash, now).First(&rc).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &rc, nil
+}
+
+// ListRecoveryCases returns recovery cases, newest first, optionally only those in status
+func (p *PostgresRepository) ListRecoveryCases(ctx context.Context, status string) ([]models.RecoveryCase, error) {
+	var cases []models.RecoveryCase
+	config := retry.DefaultRetryConfig()
+
+	err := retry.ExecuteWithRetry(ctx, "list_recovery_cases", func() error {
+		logger.LogDatabase("select", "recovery_cases").WithField("status", status).Debug("Attempting to list recovery cases")
+
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			query := tx.Order("id DESC")
+			if status != "" {
+				query = query.Where("status = ?", status)
+			}
+			return query.Find(&cases).Error
+		})
+	}, config)
+
+	if err != nil {
+		return nil, err
+	}
+	return cases, nil
+}
+
+// UpdateRecoveryCase saves a case and appends an audit event in one
+// transaction. Like UpdateUser it only succeeds when the stored version
+// still matches rc.Version, returning ErrVersionConflict otherwise.
+func (p *PostgresRepository) UpdateRecoveryCase(ctx context.Context, rc *models.RecoveryCase, event *models.RecoveryCaseEvent) error {
+	logger.LogDatabase("update", "recovery_cases").WithField("id", rc.ID).Debug("Attempting to update recovery case")
+
+	expected := rc.Version
+	rc.Version++
+	err := p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(rc).Where("version = ?", expected).Select("*").Omit("id", "created_at", "Events").Updates(rc)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrVersionConflict
+			}
+			event.CaseID = rc.ID
+			return tx.Create(event).Error
+		})
+	})
+	if err != nil {
+		rc.Version = expected
+	}
+	return err
+}
+
+// ExpireRecoveryTokens clears reset tokens that expired before now
+func (p *PostgresRepository) ExpireRecoveryTokens(ctx context.Context, now time.Time) (int64, error) {
+	var expired int64
+	err := p.withSession(ctx, func(tx *gorm.DB) error {
+		result := tx.Model(&models.RecoveryCase{}).
+			Where("reset_token_hash <> '' AND reset_token_expires <= ?", now).
+			Updates(map[string]interface{}{"reset_token_hash": "", "reset_token_expires": nil})
+		expired = result.RowsAffected
+		return result.Error
+	})
+	return expired, err
+}
@@ -0,0 +1,199 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/114windd/restapi/internal/logger"
+)
+
+// ErrNoHealthyReplica is reported by CheckReplicas when every replica is down
+var ErrNoHealthyReplica = errors.New("no healthy read replica")
+
+type preferReplicaKey struct{}
+
+// PreferReplica returns a copy of ctx whose reads may be served by a read
+// replica, which can lag behind the primary. Writes always go to the
+// primary, and so do reads in contexts not marked.
+func PreferReplica(ctx context.Context) context.Context {
+	return context.WithValue(ctx, preferReplicaKey{}, true)
+}
+
+func prefersReplica(ctx context.Context) bool {
+	prefer, _ := ctx.Value(preferReplicaKey{}).(bool)
+	return prefer
+}
+
+// replicaSet tracks the health of the read replicas and picks one per read
+type replicaSet struct {
+	pools []*sql.DB
+	hosts []string // For logs, without credentials
+
+	mu      sync.RWMutex
+	healthy map[gorm.ConnPool]bool
+	next    uint64
+
+	running bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// UseReplicas routes reads marked with PreferReplica to the replicas at
+// dsns, round robin. Each replica is pinged every interval; reads go to the
+// healthy ones only, and to the primary when none is healthy or a replica
+// read fails. Call it before the repository serves requests.
+func (p *PostgresRepository) UseReplicas(dsns []string, interval time.Duration) error {
+	if len(dsns) == 0 {
+		return nil
+	}
+
+	rs := &replicaSet{
+		healthy: make(map[gorm.ConnPool]bool),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	dialectors := make([]gorm.Dialector, 0, len(dsns))
+	for _, dsn := range dsns {
+		// Replicas may be down at startup; the health checks find out
+		db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{DisableAutomaticPing: true})
+		if err != nil {
+			rs.close()
+			return fmt.Errorf("open read replica: %w", err)
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			rs.close()
+			return fmt.Errorf("open read replica: %w", err)
+		}
+		rs.pools = append(rs.pools, sqlDB)
+		rs.hosts = append(rs.hosts, replicaHost(dsn))
+		dialectors = append(dialectors, postgres.New(postgres.Config{Conn: sqlDB}))
+	}
+
+	// dbresolver opens the replicas with the primary's config, which pings them
+	p.db.Config.DisableAutomaticPing = true
+	resolver := dbresolver.Register(dbresolver.Config{Replicas: dialectors, Policy: rs})
+	if err := p.db.Use(resolver); err != nil {
+		rs.close()
+		return fmt.Errorf("register read replicas: %w", err)
+	}
+
+	rs.checkAll(context.Background())
+	p.replicas = rs
+	rs.running = true
+	go rs.run(interval)
+
+	logger.Log.WithField("replicas", len(dsns)).Info("Read replicas configured")
+	return nil
+}
+
+// CheckReplicas reports an error when replicas are configured and none is
+// healthy, i.e. every read is served by the primary
+func (p *PostgresRepository) CheckReplicas(ctx context.Context) error {
+	if p.replicas == nil || p.replicas.anyHealthy() {
+		return nil
+	}
+	return ErrNoHealthyReplica
+}
+
+// Resolve implements dbresolver.Policy, going round robin over the healthy
+// replicas. withSession only asks for a replica when one is healthy; should
+// the last one fail in between, the read fails over to the primary.
+func (rs *replicaSet) Resolve(pools []gorm.ConnPool) gorm.ConnPool {
+	rs.mu.RLock()
+	candidates := make([]gorm.ConnPool, 0, len(pools))
+	for _, pool := range pools {
+		if rs.healthy[pool] {
+			candidates = append(candidates, pool)
+		}
+	}
+	rs.mu.RUnlock()
+	if len(candidates) == 0 {
+		candidates = pools
+	}
+	n := atomic.AddUint64(&rs.next, 1)
+	return candidates[n%uint64(len(candidates))]
+}
+
+func (rs *replicaSet) anyHealthy() bool {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	for _, ok := range rs.healthy {
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// run pings the replicas every interval until close
+func (rs *replicaSet) run(interval time.Duration) {
+	defer close(rs.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-rs.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			rs.checkAll(ctx)
+			cancel()
+		}
+	}
+}
+
+// checkAll pings every replica and records which answer, logging changes
+func (rs *replicaSet) checkAll(ctx context.Context) {
+	for i, pool := range rs.pools {
+		err := pool.PingContext(ctx)
+
+		rs.mu.Lock()
+		was, known := rs.healthy[pool]
+		rs.healthy[pool] = err == nil
+		rs.mu.Unlock()
+
+		log := logger.Log.WithField("replica", rs.hosts[i])
+		switch {
+		case err != nil && (was || !known):
+			log.WithError(err).Warn("Read replica unhealthy, reads fail over to the primary")
+		case err == nil && known && !was:
+			log.Info("Read replica healthy again")
+		}
+	}
+}
+
+// close stops the health checks and closes the replica pools
+func (rs *replicaSet) close() {
+	if rs.running {
+		close(rs.stop)
+		<-rs.done
+	}
+	for _, pool := range rs.pools {
+		pool.Close()
+	}
+}
+
+// replicaHost returns the host of a DSN, in URL or key=value form
+func replicaHost(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Host != "" {
+		return u.Host
+	}
+	for _, field := range strings.Fields(dsn) {
+		if strings.HasPrefix(field, "host=") {
+			return strings.TrimPrefix(field, "host=")
+		}
+	}
+	return "replica"
+}
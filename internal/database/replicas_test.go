@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestReplicaPolicy(t *testing.T) {
+	a, b, c := new(sql.DB), new(sql.DB), new(sql.DB)
+	pools := []gorm.ConnPool{a, b, c}
+	rs := &replicaSet{healthy: map[gorm.ConnPool]bool{a: true, b: false, c: true}}
+
+	seen := map[gorm.ConnPool]int{}
+	for i := 0; i < 10; i++ {
+		seen[rs.Resolve(pools)]++
+	}
+	if seen[a] != 5 || seen[c] != 5 || seen[b] != 0 {
+		t.Fatalf("reads should alternate between healthy replicas: a=%d b=%d c=%d", seen[a], seen[b], seen[c])
+	}
+	if !rs.anyHealthy() {
+		t.Fatal("anyHealthy with two healthy replicas")
+	}
+
+	rs.healthy[a], rs.healthy[c] = false, false
+	if rs.anyHealthy() {
+		t.Fatal("anyHealthy with every replica down")
+	}
+	if pool := rs.Resolve(pools); pool == nil {
+		t.Fatal("Resolve must still pick a replica when none is healthy")
+	}
+
+	repo := &PostgresRepository{replicas: rs}
+	if err := repo.CheckReplicas(context.Background()); err != ErrNoHealthyReplica {
+		t.Fatalf("CheckReplicas with every replica down: %v", err)
+	}
+	if err := (&PostgresRepository{}).CheckReplicas(context.Background()); err != nil {
+		t.Fatalf("CheckReplicas without replicas: %v", err)
+	}
+}
+
+func TestPreferReplica(t *testing.T) {
+	ctx := context.Background()
+	if prefersReplica(ctx) {
+		t.Fatal("reads go to the primary unless marked")
+	}
+	if !prefersReplica(PreferReplica(ctx)) {
+		t.Fatal("PreferReplica not recorded")
+	}
+}
+
+func TestReplicaHost(t *testing.T) {
+	for dsn, want := range map[string]string{
+		"postgres://app:s3cr@t@replica-1:5432/restapi?sslmode=disable": "replica-1:5432",
+		"host=replica-2 user=app password=secret dbname=restapi":       "replica-2",
+		"dbname=restapi": "replica",
+	} {
+		if got := replicaHost(dsn); got != want {
+			t.Errorf("replicaHost(%q) = %q, want %q", dsn, got, want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// dryRun returns a handle that builds statements without a server
+func dryRun(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+		Logger:               gormlogger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestEscapeLike(t *testing.T) {
+	for in, want := range map[string]string{
+		"alice":   "alice",
+		"100%":    `100\%`,
+		"a_b":     `a\_b`,
+		`back\sl`: `back\\sl`,
+		`%_\`:     `\%\_\\`,
+	} {
+		if got := escapeLike(in); got != want {
+			t.Errorf("escapeLike(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSearchUsersQueryEscapesWildcards(t *testing.T) {
+	var users []models.User
+	stmt := searchUsersQuery(dryRun(t), "50%_off").Limit(10).Find(&users).Statement
+
+	sql := stmt.SQL.String()
+	if strings.Count(sql, `ESCAPE '\'`) != 2 {
+		t.Fatalf("both ILIKE comparisons need an escape character: %s", sql)
+	}
+	var patterns []string
+	for _, v := range stmt.Vars {
+		if s, ok := v.(string); ok && strings.HasPrefix(s, "%") {
+			patterns = append(patterns, s)
+		}
+	}
+	if len(patterns) != 2 || patterns[0] != `%50\%\_off%` {
+		t.Fatalf("ILIKE patterns must match the query literally: %q", patterns)
+	}
+
+	filtered, err := whereUserFilter(dryRun(t), []models.UserFilterTerm{{Field: "email", Operator: ":", Value: "a_b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt = filtered.Find(&users).Statement
+	if !strings.Contains(stmt.SQL.String(), `ESCAPE '\'`) || stmt.Vars[len(stmt.Vars)-1] != `%a\_b%` {
+		t.Fatalf("filter: %s %v", stmt.SQL.String(), stmt.Vars)
+	}
+}
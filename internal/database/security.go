@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/retry"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// CreateSecurityFlag flags an account for review
+func (p *PostgresRepository) CreateSecurityFlag(ctx context.Context, flag *models.SecurityFlag) error {
+	logger.LogDatabase("create", "security_flags").WithField("user_id", flag.UserID).Debug("Attempting to create security flag")
+
+	return p.withSession(ctx, func(tx *gorm.DB) error {
+		return tx.Create(flag).Error
+	})
+}
+
+// ListSecurityFlags returns the tenant's flags, newest first, optionally
+// only the open or resolved ones
+func (p *PostgresRepository) ListSecurityFlags(ctx context.Context, status string) ([]models.SecurityFlag, error) {
+	var flags []models.SecurityFlag
+	config := retry.DefaultRetryConfig()
+
+	err := retry.ExecuteWithRetry(ctx, "list_security_flags", func() error {
+		return p.withSession(ctx, func(tx *gorm.DB) error {
+			query := tx.Where("tenant_id = ?", TenantFromContext(ctx)).Order("id DESC")
+			switch status {
+			case models.SecurityFlagOpen:
+				query = query.Where("resolved_at IS NULL")
+			case models.SecurityFlagResolved:
+				query = query.Where("resolved_at IS NOT NULL")
+			}
+			return query.Find(&flags).Error
+		})
+	}, config)
+
+	if err != nil {
+		return nil, err
+	}
+	return flags, nil
+}
+
+// ResolveSecurityFlag closes one of the tenant's flags on behalf of an admin.
+// Resolving a resolved flag keeps its first resolution.
+func (p *PostgresRepository) ResolveSecurityFlag(ctx context.Context, id, adminID uint, at time.Time) (*models.SecurityFlag, error) {
+	var flag models.SecurityFlag
+	config := retry.DefaultRetryConfig()
+
+	err := retry.ExecuteWithRetry(ctx, "resolve_security_flag", func() error {
+		err := p.withSession(ctx, func(tx *gorm.DB) error {
+			return tx.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Where("tenant_id = ?", TenantFromContext(ctx)).First(&flag, id).Error; err != nil {
+					return err
+				}
+				if flag.ResolvedAt != nil {
+					return nil
+				}
+				flag.ResolvedAt, flag.ResolvedBy = &at, &adminID
+				return tx.Model(&flag).Select("resolved_at", "resolved_by").Updates(&flag).Error
+			})
+		})
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return retry.Permanent(err)
+		}
+		return err
+	}, config)
+
+	if err != nil {
+		return nil, err
+	}
+	return &flag, nil
+}
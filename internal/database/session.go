@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/retry"
+)
+
+// SessionSettings are Postgres session parameters applied for the duration of
+// a single request's database work
+type SessionSettings struct {
+	StatementTimeout time.Duration // statement_timeout
+	ApplicationName  string        // application_name, visible in pg_stat_activity
+	Role             string        // SET LOCAL ROLE, e.g. for row-level security policies
+}
+
+type sessionSettingsKey struct{}
+
+// WithSessionSettings returns a copy of ctx carrying session settings
+func WithSessionSettings(ctx context.Context, settings SessionSettings) context.Context {
+	return context.WithValue(ctx, sessionSettingsKey{}, settings)
+}
+
+// SessionSettingsFromContext returns the session settings stored in ctx, if any
+func SessionSettingsFromContext(ctx context.Context) (SessionSettings, bool) {
+	settings, ok := ctx.Value(sessionSettingsKey{}).(SessionSettings)
+	return settings, ok
+}
+
+// SessionHook prepares a transaction before repository queries run in it.
+// Hooks may only use transaction-scoped settings (set_config(..., true), SET LOCAL).
+type SessionHook func(ctx context.Context, tx *gorm.DB) error
+
+// RegisterSessionHook adds a hook run at the start of every repository transaction
+func (p *PostgresRepository) RegisterSessionHook(hook SessionHook) {
+	p.hooksMu.Lock()
+	defer p.hooksMu.Unlock()
+	p.sessionHooks = append(p.sessionHooks, hook)
+}
+
+// SetQueryTimeout bounds each repository operation (one attempt of it, when
+// retried) whose ctx has no deadline, such as background jobs. Requests
+// already carry their route's deadline, which may be longer for exports and
+// other slow admin routes, so it is left to govern them. Zero disables the bound.
+func (p *PostgresRepository) SetQueryTimeout(timeout time.Duration) {
+	p.queryTimeout = timeout
+}
+
+// withSession runs fn against the database for ctx. When session hooks are
+// registered, fn runs inside a transaction the hooks have prepared. In a
+// dry run the transaction is always used and rolled back once fn succeeds.
+// With read replicas, fn runs on one when ctx prefers it and a replica is
+// healthy, and again on the primary if that fails. While the circuit is
+// open, it fails at once with ErrUnavailable.
+func (p *PostgresRepository) withSession(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	if p.Unavailable() {
+		// Retrying can't help until MonitorConnection sees the database back
+		return retry.Permanent(ErrUnavailable)
+	}
+	if _, ok := ctx.Deadline(); !ok && p.queryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.queryTimeout)
+		defer cancel()
+	}
+
+	if p.replicas == nil {
+		return p.runSession(ctx, p.db.WithContext(ctx), fn)
+	}
+	primary := p.db.WithContext(ctx).Clauses(dbresolver.Write).Session(&gorm.Session{})
+	if !prefersReplica(ctx) || !p.replicas.anyHealthy() {
+		return p.runSession(ctx, primary, fn)
+	}
+
+	replica := p.db.WithContext(ctx).Clauses(dbresolver.Read).Session(&gorm.Session{})
+	err := p.runSession(ctx, replica, fn)
+	if err == nil || errors.Is(err, gorm.ErrRecordNotFound) || ctx.Err() != nil {
+		return err
+	}
+	logger.Log.WithError(err).Warn("Read replica query failed, retrying on the primary")
+	return p.runSession(ctx, primary, fn)
+}
+
+// runSession runs fn on db, in a transaction when session hooks or a dry
+// run require one
+func (p *PostgresRepository) runSession(ctx context.Context, db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	p.hooksMu.RLock()
+	hooks := p.sessionHooks
+	p.hooksMu.RUnlock()
+
+	dryRun := IsDryRun(ctx)
+	if len(hooks) == 0 && !dryRun {
+		return fn(db)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, hook := range hooks {
+			if err := hook(ctx, tx); err != nil {
+				return err
+			}
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		return nil
+	}
+	return err
+}
+
+// ApplySessionSettings is a SessionHook applying the SessionSettings in ctx
+func ApplySessionSettings(ctx context.Context, tx *gorm.DB) error {
+	settings, ok := SessionSettingsFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	if settings.StatementTimeout > 0 {
+		timeout := strconv.FormatInt(settings.StatementTimeout.Milliseconds(), 10)
+		if err := tx.Exec("SELECT set_config('statement_timeout', ?, true)", timeout).Error; err != nil {
+			return err
+		}
+	}
+	if settings.ApplicationName != "" {
+		if err := tx.Exec("SELECT set_config('application_name', ?, true)", settings.ApplicationName).Error; err != nil {
+			return err
+		}
+	}
+	if settings.Role != "" {
+		// SET ROLE does not accept bind parameters, so quote the identifier
+		if err := tx.Exec("SET LOCAL ROLE " + quoteIdentifier(settings.Role)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// quoteIdentifier quotes a Postgres identifier
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestQueryTimeout(t *testing.T) {
+	repo := &PostgresRepository{db: dryRun(t), queryTimeout: time.Second}
+	deadline := func(ctx context.Context) (time.Time, bool) {
+		var d time.Time
+		var ok bool
+		if err := repo.withSession(ctx, func(tx *gorm.DB) error {
+			d, ok = tx.Statement.Context.Deadline()
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return d, ok
+	}
+
+	// Work without a deadline of its own, e.g. a background job, is bounded
+	if d, ok := deadline(context.Background()); !ok || time.Until(d) > time.Second {
+		t.Fatalf("without a caller deadline: deadline %v, set %v", d, ok)
+	}
+
+	// A route allowing more time than the query timeout keeps its deadline
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	want, _ := ctx.Deadline()
+	if d, ok := deadline(ctx); !ok || !d.Equal(want) {
+		t.Fatalf("with a route deadline: deadline %v, want %v", d, want)
+	}
+}
+
+func TestApplySessionSettings(t *testing.T) {
+	db := dryRun(t)
+	var statements []string
+	var vars [][]interface{}
+	if err := db.Callback().Raw().After("gorm:raw").Register("test:record", func(tx *gorm.DB) {
+		statements = append(statements, tx.Statement.SQL.String())
+		vars = append(vars, tx.Statement.Vars)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is set without settings in the context
+	if err := ApplySessionSettings(context.Background(), db); err != nil || len(statements) != 0 {
+		t.Fatalf("without settings: %v, %q", err, statements)
+	}
+
+	ctx := WithSessionSettings(context.Background(), SessionSettings{
+		StatementTimeout: 2500 * time.Millisecond,
+		ApplicationName:  "restapi/abc123",
+		Role:             `app"user`,
+	})
+	if err := ApplySessionSettings(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	wantStatements := []string{
+		"SELECT set_config('statement_timeout', $1, true)",
+		"SELECT set_config('application_name', $1, true)",
+		`SET LOCAL ROLE "app""user"`,
+	}
+	wantVars := [][]interface{}{{"2500"}, {"restapi/abc123"}, {}}
+	if !reflect.DeepEqual(statements, wantStatements) || !reflect.DeepEqual(vars, wantVars) {
+		t.Fatalf("statements %q %v, want %q %v", statements, vars, wantStatements, wantVars)
+	}
+}
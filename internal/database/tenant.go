@@ -0,0 +1,30 @@
+package database
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/pkg/models"
+)
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx scoped to the given tenant
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant for ctx, falling back to the default tenant
+func TenantFromContext(ctx context.Context) string {
+	if tenantID, ok := ctx.Value(tenantKey{}).(string); ok && tenantID != "" {
+		return tenantID
+	}
+	return models.DefaultTenant
+}
+
+// ApplyTenant is a SessionHook that sets app.tenant_id for the transaction,
+// which the row-level security policies on users compare against
+func ApplyTenant(ctx context.Context, tx *gorm.DB) error {
+	return tx.Exec("SELECT set_config('app.tenant_id', ?, true)", TenantFromContext(ctx)).Error
+}
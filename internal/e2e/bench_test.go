@@ -0,0 +1,51 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// benchmarkUsers is the number of users the Postgres benchmarks read and list
+const benchmarkUsers = 200
+
+func BenchmarkPostgresFindUserByID(b *testing.B) {
+	repo := connect(b)
+	ctx := context.Background()
+	user := &models.User{Name: "Bench", Email: uniqueEmail("bench"), Password: "x"}
+	if err := repo.CreateUser(ctx, user); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := repo.FindUserByID(ctx, user.ID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPostgresListUsersPage(b *testing.B) {
+	repo := connect(b)
+	ctx := context.Background()
+	for i := 0; i < benchmarkUsers; i++ {
+		user := &models.User{Name: fmt.Sprintf("Bench %d", i), Email: uniqueEmail("bench"), Password: "x"}
+		if err := repo.CreateUser(ctx, user); err != nil {
+			b.Fatal(err)
+		}
+	}
+	q := models.UserListQuery{
+		Filter:  []models.UserFilterTerm{{Field: "name", Operator: ":", Value: "Bench"}},
+		OrderBy: "name",
+		Limit:   50,
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := repo.ListUsersPage(ctx, q); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+// Package e2e holds end-to-end tests that run the application against a
+// real, migrated Postgres database over both REST and gRPC. They are built
+// with the e2e tag:
+//
+//	go test -tags e2e ./internal/e2e
+//
+// E2E_DATABASE_URL names the database to use; without it a throwaway
+// Postgres container is started with docker. When neither is available the
+// tests are skipped.
+package e2e
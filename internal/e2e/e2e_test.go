@@ -0,0 +1,119 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/114windd/restapi/internal/apptest"
+	"github.com/114windd/restapi/internal/auth"
+	"github.com/114windd/restapi/pkg/models"
+	"github.com/114windd/restapi/pkg/proto"
+)
+
+type userResponse struct {
+	User models.User `json:"user"`
+}
+
+// uniqueEmail keeps runs against a shared E2E_DATABASE_URL from colliding
+func uniqueEmail(name string) string {
+	return fmt.Sprintf("%s+%d@example.com", name, time.Now().UnixNano())
+}
+
+func ifMatch(version uint) http.Header {
+	return http.Header{"If-Match": {fmt.Sprintf("%q", fmt.Sprint(version))}}
+}
+
+func TestRESTUserLifecycle(t *testing.T) {
+	ts := apptest.NewTestServerWithRepository(t, connect(t))
+	email := uniqueEmail("alice")
+
+	user, _ := ts.Signup(t, "Alice", email, "password123")
+	var login struct {
+		Token string `json:"token"`
+	}
+	if code := ts.Do(t, http.MethodPost, "/login", "", models.LoginRequest{Email: email, Password: "password123"}, &login); code != http.StatusOK || login.Token == "" {
+		t.Fatalf("login: status %d", code)
+	}
+	if code := ts.Do(t, http.MethodPost, "/login", "", models.LoginRequest{Email: email, Password: "wrong"}, nil); code != http.StatusUnauthorized {
+		t.Fatalf("login with wrong password: expected 401, got %d", code)
+	}
+
+	path := fmt.Sprintf("/users/%d", user.ID)
+	var got userResponse
+	if code := ts.Do(t, http.MethodGet, path, login.Token, nil, &got); code != http.StatusOK || got.User.Email != email {
+		t.Fatalf("GET %s: status %d, user %+v", path, code, got.User)
+	}
+
+	name := "Alice Liddell"
+	if code := ts.DoWithHeaders(t, http.MethodPatch, path, login.Token, ifMatch(got.User.Version), models.PatchUserRequest{Name: &name}, &got); code != http.StatusOK || got.User.Name != name {
+		t.Fatalf("PATCH %s: status %d, user %+v", path, code, got.User)
+	}
+	// The version stored by Postgres rejects a stale update
+	if code := ts.DoWithHeaders(t, http.MethodPatch, path, login.Token, ifMatch(got.User.Version-1), models.PatchUserRequest{Name: &name}, nil); code != http.StatusPreconditionFailed {
+		t.Fatalf("PATCH with a stale version: expected 412, got %d", code)
+	}
+	if code := ts.Do(t, http.MethodPost, "/signup", "", models.SignupRequest{Name: "Alice", Email: email, Password: "password123"}, nil); code != http.StatusConflict {
+		t.Fatalf("duplicate signup: expected 409, got %d", code)
+	}
+
+	if code := ts.Do(t, http.MethodDelete, path, login.Token, nil, nil); code != http.StatusOK {
+		t.Fatalf("DELETE %s: expected 200, got %d", path, code)
+	}
+	if code := ts.Do(t, http.MethodGet, path, ts.AdminToken(t), nil, nil); code != http.StatusNotFound {
+		t.Fatalf("GET deleted user: expected 404, got %d", code)
+	}
+}
+
+func TestGRPCUserLifecycle(t *testing.T) {
+	ts := apptest.NewTestServerWithRepository(t, connect(t))
+	ctx := context.Background()
+	email := uniqueEmail("carol")
+
+	created, err := ts.GRPC.CreateUser(ctx, &proto.CreateUserRequest{Name: "Carol", Email: email, Password: "password123"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	id := created.User.Id
+	if _, err := ts.GRPC.CreateUser(ctx, &proto.CreateUserRequest{Name: "Carol", Email: email, Password: "password123"}); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("duplicate CreateUser: expected AlreadyExists, got %v", err)
+	}
+
+	// Users created over gRPC log in over REST
+	var login struct {
+		Token string `json:"token"`
+	}
+	if code := ts.Do(t, http.MethodPost, "/login", "", models.LoginRequest{Email: email, Password: "password123"}, &login); code != http.StatusOK {
+		t.Fatalf("REST login of a gRPC user: status %d", code)
+	}
+	authed := apptest.WithToken(ctx, login.Token)
+
+	updated, err := ts.GRPC.UpdateUser(authed, &proto.UpdateUserRequest{Id: id, Name: "Caroline", Version: created.User.Version})
+	if err != nil || updated.User.Name != "Caroline" {
+		t.Fatalf("UpdateUser: %v, %+v", err, updated)
+	}
+	var got userResponse
+	if code := ts.Do(t, http.MethodGet, fmt.Sprintf("/users/%d", id), login.Token, nil, &got); code != http.StatusOK || got.User.Name != "Caroline" {
+		t.Fatalf("REST read of a gRPC update: status %d, user %+v", code, got.User)
+	}
+
+	list, err := ts.GRPC.ListUsers(ctx, &proto.ListUsersRequest{Filter: fmt.Sprintf("email = %q", email)})
+	if err != nil || len(list.Users) != 1 || list.TotalSize != 1 {
+		t.Fatalf("ListUsers: %v, %+v", err, list)
+	}
+
+	admin := apptest.WithToken(ctx, ts.Token(t, auth.Identity{UserID: 1 << 30, Role: models.RoleAdmin, TenantID: models.DefaultTenant}))
+	if _, err := ts.GRPC.DeleteUser(admin, &proto.DeleteUserRequest{Id: id}); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, err := ts.GRPC.GetUser(ctx, &proto.GetUserRequest{Id: id}); status.Code(err) != codes.NotFound {
+		t.Fatalf("GetUser after delete: expected NotFound, got %v", err)
+	}
+}
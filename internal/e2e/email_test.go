@@ -0,0 +1,87 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// tenantContext scopes a test to a tenant of its own, so runs against a
+// shared E2E_DATABASE_URL don't see each other's rows
+func tenantContext() context.Context {
+	return database.WithTenant(context.Background(), fmt.Sprintf("e2e-%d", time.Now().UnixNano()))
+}
+
+func TestEmailLookupIgnoresCase(t *testing.T) {
+	repo := connect(t)
+	ctx := tenantContext()
+	email := uniqueEmail("dana")
+
+	// A row written before emails were lowercased
+	legacy := models.User{Name: "Dana", Email: strings.ToUpper(email), Password: "x", TenantID: database.TenantFromContext(ctx)}
+	if err := repo.CreateUser(ctx, &legacy); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	found, err := repo.FindUserByEmail(ctx, email)
+	if err != nil || found.ID != legacy.ID {
+		t.Fatalf("FindUserByEmail(%q): %v, %+v", email, err, found)
+	}
+	if exists, err := repo.UserExistsByEmail(ctx, email); err != nil || !exists {
+		t.Fatalf("UserExistsByEmail(%q): %v, %v", email, exists, err)
+	}
+
+	duplicate := models.User{Name: "Dana", Email: email, Password: "x", TenantID: legacy.TenantID}
+	if err := repo.CreateUser(ctx, &duplicate); !errors.Is(err, database.ErrDuplicateKey) {
+		t.Fatalf("CreateUser differing only in case: expected ErrDuplicateKey, got %v", err)
+	}
+}
+
+func TestEmailLowercaseMigration(t *testing.T) {
+	repo := connect(t)
+	ctx := tenantContext()
+	db := repo.DB().WithContext(ctx)
+	email := uniqueEmail("erin")
+
+	// Rewind to before migration 8 and write the rows it has to clean up
+	if err := db.Exec("DROP INDEX idx_users_tenant_email_lower").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("DELETE FROM schema_migrations WHERE version = 8").Error; err != nil {
+		t.Fatal(err)
+	}
+	tenantID := database.TenantFromContext(ctx)
+	older := models.User{Name: "Erin", Email: strings.ToUpper(email), Password: "x", TenantID: tenantID}
+	newer := models.User{Name: "Erin", Email: email, Password: "x", TenantID: tenantID}
+	for _, user := range []*models.User{&older, &newer} {
+		if err := repo.CreateUser(ctx, user); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+
+	if err := repo.Migrate(database.MigrationOptions{LockTimeout: time.Minute}); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	// The older account keeps the address, and the newer one is set aside
+	for user, want := range map[*models.User]string{&older: email, &newer: fmt.Sprintf("%s.duplicate-%d", email, newer.ID)} {
+		got, err := repo.FindUserByID(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("FindUserByID(%d): %v", user.ID, err)
+		}
+		if got.Email != want {
+			t.Fatalf("user %d after migrating: email %q, want %q", user.ID, got.Email, want)
+		}
+	}
+	if err := repo.CheckMigrations(ctx); err != nil {
+		t.Fatalf("CheckMigrations: %v", err)
+	}
+}
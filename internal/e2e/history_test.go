@@ -0,0 +1,46 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"testing"
+
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// TestHistoryTriggers checks that the Postgres triggers record the same
+// snapshots as the memory repository
+func TestHistoryTriggers(t *testing.T) {
+	repo := connect(t)
+	ctx := tenantContext()
+	user := models.User{Name: "Alice", Email: uniqueEmail("history"), Password: "x", TenantID: database.TenantFromContext(ctx)}
+	if err := repo.CreateUser(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only tracked columns add a snapshot
+	user.Bio = "Hello"
+	if err := repo.UpdateUser(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+	user.Name = "Alice Liddell"
+	if err := repo.UpdateUser(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+	history, err := repo.GetUserHistory(ctx, user.ID)
+	if err != nil || len(history) != 2 {
+		t.Fatalf("GetUserHistory: %d snapshots, %v", len(history), err)
+	}
+	if history[0].Name != "Alice" || history[0].ValidTo == nil || history[1].Name != "Alice Liddell" || history[1].ValidTo != nil {
+		t.Fatalf("GetUserHistory: %+v", history)
+	}
+
+	if err := repo.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	history, err = repo.GetUserHistory(ctx, user.ID)
+	if err != nil || len(history) != 2 || history[1].ValidTo == nil {
+		t.Fatalf("GetUserHistory after delete: %+v, %v", history, err)
+	}
+}
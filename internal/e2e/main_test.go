@@ -0,0 +1,106 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/logger"
+)
+
+// postgresImage is the image of the throwaway database container
+const postgresImage = "postgres:16-alpine"
+
+// postgresStartTimeout bounds how long the container may take to accept connections
+const postgresStartTimeout = time.Minute
+
+var (
+	// databaseURL is the database the tests run against; empty skips them
+	databaseURL string
+	// skipReason explains why databaseURL is empty
+	skipReason string
+)
+
+func TestMain(m *testing.M) {
+	logger.Init()
+	logger.Log.SetOutput(io.Discard)
+
+	databaseURL = os.Getenv("E2E_DATABASE_URL")
+	stop := func() {}
+	if databaseURL == "" {
+		url, stopPostgres, err := startPostgres()
+		if err != nil {
+			skipReason = "no E2E_DATABASE_URL and no Postgres container: " + err.Error()
+		} else {
+			databaseURL, stop = url, stopPostgres
+		}
+	}
+
+	code := m.Run()
+	stop()
+	os.Exit(code)
+}
+
+// startPostgres runs postgresImage with docker, publishing its port on a
+// random local port, and waits until it accepts TCP connections. stop
+// removes the container.
+func startPostgres() (url string, stop func(), err error) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return "", nil, err
+	}
+	out, err := exec.Command("docker", "run", "--detach", "--rm",
+		"--env", "POSTGRES_PASSWORD=postgres", "--env", "POSTGRES_DB=restapi_e2e",
+		"--publish", "127.0.0.1::5432", postgresImage).Output()
+	if err != nil {
+		return "", nil, fmt.Errorf("docker run: %w", err)
+	}
+	id := strings.TrimSpace(string(out))
+	stop = func() { _ = exec.Command("docker", "rm", "--force", id).Run() }
+
+	out, err = exec.Command("docker", "port", id, "5432/tcp").Output()
+	if err != nil {
+		stop()
+		return "", nil, fmt.Errorf("docker port: %w", err)
+	}
+	addr := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+
+	// The image starts a temporary server on a unix socket to initialise the
+	// database, so checking over TCP waits for the real one
+	deadline := time.Now().Add(postgresStartTimeout)
+	for exec.Command("docker", "exec", id, "pg_isready", "--host", "127.0.0.1", "--username", "postgres").Run() != nil {
+		if time.Now().After(deadline) {
+			stop()
+			return "", nil, fmt.Errorf("postgres not ready after %s", postgresStartTimeout)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return "postgres://postgres:postgres@" + addr + "/restapi_e2e?sslmode=disable", stop, nil
+}
+
+// connect migrates the test database and returns a repository on it,
+// closed when the test finishes
+func connect(t testing.TB) *database.PostgresRepository {
+	t.Helper()
+	if databaseURL == "" {
+		t.Skip(skipReason)
+	}
+
+	repo, err := database.Connect(databaseURL, database.MigrationOptions{LockTimeout: time.Minute}, 0)
+	if err != nil {
+		t.Fatalf("connect to %s: %v", databaseURL, err)
+	}
+	t.Cleanup(func() { _ = repo.Close() })
+
+	if err := repo.CheckMigrations(context.Background()); err != nil {
+		t.Fatalf("migrations not applied: %v", err)
+	}
+	return repo
+}
@@ -0,0 +1,66 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// migrationLockKey is the advisory lock database.Migrate holds
+const migrationLockKey int64 = 0x72657374617069
+
+// TestMigrateAfterWaitingForLock checks that a replica which waited for
+// another one to migrate still brings the schema up to date with its own
+// models, rather than trusting that the SQL migrations are all applied
+func TestMigrateAfterWaitingForLock(t *testing.T) {
+	repo := connect(t)
+	db := repo.DB()
+
+	done := make(chan error, 1)
+	err := db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockKey).Error; err != nil {
+			return err
+		}
+		defer conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockKey)
+
+		// Stand in for a replica on an older build, which migrated without
+		// the newest table and released the lock
+		if err := conn.Migrator().DropTable(&models.SignupDomainPolicy{}); err != nil {
+			return err
+		}
+		go func() { done <- repo.Migrate(database.MigrationOptions{LockTimeout: time.Minute}) }()
+
+		select {
+		case err := <-done:
+			t.Fatalf("Migrate returned while another replica held the lock: %v", err)
+		case <-time.After(500 * time.Millisecond):
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+	case <-time.After(time.Minute):
+		t.Fatal("Migrate still waiting after the lock was released")
+	}
+	if !db.Migrator().HasTable(&models.SignupDomainPolicy{}) {
+		t.Fatal("the replica that waited for the lock did not run AutoMigrate")
+	}
+	if _, err := repo.GetSignupDomainPolicy(context.Background()); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("GetSignupDomainPolicy: %v", err)
+	}
+}
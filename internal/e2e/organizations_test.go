@@ -0,0 +1,34 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+func TestOrganizationLookupIsTenantScoped(t *testing.T) {
+	repo := connect(t)
+	ctx := tenantContext()
+
+	owner := models.User{Name: "Gail", Email: uniqueEmail("gail"), Password: "x", TenantID: database.TenantFromContext(ctx)}
+	if err := repo.CreateUser(ctx, &owner); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	org := models.Organization{TenantID: owner.TenantID, Name: "Globex", CreatedBy: owner.ID}
+	if err := repo.CreateOrganization(ctx, &org, &models.Membership{UserID: owner.ID, Role: models.OrgRoleOwner}); err != nil {
+		t.Fatalf("CreateOrganization: %v", err)
+	}
+
+	if found, err := repo.FindOrganization(ctx, org.ID); err != nil || found.Name != "Globex" {
+		t.Fatalf("FindOrganization in its tenant: %v, %+v", err, found)
+	}
+	if _, err := repo.FindOrganization(tenantContext(), org.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("FindOrganization from another tenant: expected ErrRecordNotFound, got %v", err)
+	}
+}
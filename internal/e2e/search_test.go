@@ -0,0 +1,39 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"testing"
+
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+func TestTrigramSearch(t *testing.T) {
+	repo := connect(t)
+	ctx := tenantContext()
+	tenantID := database.TenantFromContext(ctx)
+	for _, name := range []string{"Katherine Johnson", "Catherine Jones", "Zed Brown", "100% Pure"} {
+		user := models.User{Name: name, Email: uniqueEmail("search"), Password: "x", TenantID: tenantID}
+		if err := repo.CreateUser(ctx, &user); err != nil {
+			t.Fatalf("CreateUser(%s): %v", name, err)
+		}
+	}
+
+	// A misspelling still finds the closest name first
+	users, err := repo.SearchUsers(ctx, "Katharine Jonson", 10)
+	if err != nil || len(users) == 0 || users[0].Name != "Katherine Johnson" {
+		t.Fatalf("SearchUsers(Katharine Jonson): %v, %+v", err, users)
+	}
+	for _, user := range users {
+		if user.Name == "Zed Brown" {
+			t.Fatalf("an unrelated name matched: %+v", users)
+		}
+	}
+
+	// Wildcards in the query match literally
+	users, err = repo.SearchUsers(ctx, "%", 10)
+	if err != nil || len(users) != 1 || users[0].Name != "100% Pure" {
+		t.Fatalf("SearchUsers(%%): %v, %+v", err, users)
+	}
+}
@@ -0,0 +1,102 @@
+// Package errorreporting ships panics and server errors, with the request
+// context they happened in, to an error tracker such as Sentry.
+package errorreporting
+
+import (
+	"context"
+	"time"
+
+	"github.com/114windd/restapi/internal/auth"
+	"github.com/114windd/restapi/internal/requestid"
+)
+
+// Transports an event can originate from
+const (
+	TransportHTTP = "http"
+	TransportGRPC = "grpc"
+)
+
+// Event is a panic or server error of one request
+type Event struct {
+	Err       error       // the error reported, or an error describing the panic
+	Panic     interface{} // the recovered value; nil for errors
+	Stack     []byte      // stack trace of the panicking goroutine
+	Transport string      // TransportHTTP or TransportGRPC
+	Method    string      // HTTP method, or the gRPC full method name
+	Route     string      // HTTP route pattern, e.g. /api/v1/users/:id
+	Status    string      // HTTP status code or gRPC code
+	RequestID string
+	UserID    uint // the caller, zero when unauthenticated
+	ActorID   uint // the impersonating admin, if any
+	TenantID  string
+	Time      time.Time
+}
+
+// ReporterHook receives every reported event, e.g. to forward it to an error tracker
+type ReporterHook interface {
+	Report(ctx context.Context, event *Event)
+}
+
+// ReporterHookFunc adapts a function to a ReporterHook
+type ReporterHookFunc func(ctx context.Context, event *Event)
+
+// Report calls f
+func (f ReporterHookFunc) Report(ctx context.Context, event *Event) {
+	f(ctx, event)
+}
+
+// flusher is implemented by hooks that send events asynchronously
+type flusher interface {
+	Flush(timeout time.Duration) bool
+}
+
+// Reporter fans events out to its hooks. A nil Reporter discards events.
+type Reporter struct {
+	hooks []ReporterHook
+}
+
+// New creates a Reporter sending events to hooks
+func New(hooks ...ReporterHook) *Reporter {
+	return &Reporter{hooks: hooks}
+}
+
+// AddHook adds a hook; it must not be called concurrently with Report
+func (r *Reporter) AddHook(hook ReporterHook) {
+	r.hooks = append(r.hooks, hook)
+}
+
+// Report fills in the request ID and caller from ctx and passes event to every hook
+func (r *Reporter) Report(ctx context.Context, event *Event) {
+	if r == nil || len(r.hooks) == 0 {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.RequestID == "" {
+		event.RequestID = requestid.FromContext(ctx)
+	}
+	if identity, ok := auth.IdentityFromContext(ctx); ok && event.UserID == 0 {
+		event.UserID = identity.UserID
+		event.ActorID = identity.ActorID
+		event.TenantID = identity.TenantID
+	}
+	for _, hook := range r.hooks {
+		hook.Report(ctx, event)
+	}
+}
+
+// Flush waits up to timeout for hooks to deliver queued events, e.g. before
+// the process exits. It reports whether everything was delivered.
+func (r *Reporter) Flush(timeout time.Duration) bool {
+	if r == nil {
+		return true
+	}
+	delivered := true
+	for _, hook := range r.hooks {
+		if f, ok := hook.(flusher); ok {
+			delivered = f.Flush(timeout) && delivered
+		}
+	}
+	return delivered
+}
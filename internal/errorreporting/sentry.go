@@ -0,0 +1,76 @@
+package errorreporting
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// SentryHook sends events to Sentry
+type SentryHook struct {
+	client *sentry.Client
+}
+
+// NewSentryHook creates a hook sending events to the project identified by dsn
+func NewSentryHook(dsn, environment, release string) (*SentryHook, error) {
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		Dsn:         dsn,
+		Environment: environment,
+		Release:     release,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create sentry client: %w", err)
+	}
+	return &SentryHook{client: client}, nil
+}
+
+// Report sends event to Sentry; delivery is asynchronous
+func (h *SentryHook) Report(_ context.Context, e *Event) {
+	event := sentry.NewEvent()
+	event.Level = sentry.LevelError
+	event.Timestamp = e.Time
+	event.Transaction = e.Method
+	if e.Route != "" {
+		event.Transaction += " " + e.Route
+	}
+	event.Tags = map[string]string{
+		"transport": e.Transport,
+		"status":    e.Status,
+	}
+	if e.TenantID != "" {
+		event.Tags["tenant_id"] = e.TenantID
+	}
+	if e.RequestID != "" {
+		event.Tags["request_id"] = e.RequestID
+	}
+	if e.UserID != 0 {
+		event.User = sentry.User{ID: strconv.FormatUint(uint64(e.UserID), 10)}
+	}
+	if e.ActorID != 0 {
+		event.Extra["impersonated_by"] = e.ActorID
+	}
+
+	exception := sentry.Exception{Type: "error", Value: e.Err.Error()}
+	if e.Panic != nil {
+		// Reported from the deferred recover, so the panicking frames are still on the stack
+		event.Level = sentry.LevelFatal
+		exception.Type = "panic"
+		exception.Stacktrace = sentry.NewStacktrace()
+		exception.Mechanism = &sentry.Mechanism{Type: "recover", Handled: sentry.Pointer(true)}
+	} else {
+		exception.Type = fmt.Sprintf("%T", e.Err)
+		exception.Stacktrace = sentry.ExtractStacktrace(e.Err)
+	}
+	event.Exception = []sentry.Exception{exception}
+	event.Message = e.Err.Error()
+
+	h.client.CaptureEvent(event, nil, nil)
+}
+
+// Flush waits up to timeout for queued events to be sent
+func (h *SentryHook) Flush(timeout time.Duration) bool {
+	return h.client.Flush(timeout)
+}
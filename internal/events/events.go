@@ -0,0 +1,129 @@
+// Package events publishes user lifecycle events to a message broker
+// (Kafka through its REST Proxy, or NATS) for downstream consumers.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/114windd/restapi/internal/config"
+	"github.com/114windd/restapi/pkg/models"
+	pb "github.com/114windd/restapi/pkg/proto"
+)
+
+// Event types
+const (
+	UserCreated = "user.created"
+	UserUpdated = "user.updated"
+	UserDeleted = "user.deleted"
+	// UserNewDevice reports a login from a device the user hadn't used before
+	UserNewDevice = "user.new_device"
+)
+
+// Encodings for published messages
+const (
+	EncodingJSON     = "json"
+	EncodingProtobuf = "protobuf"
+)
+
+// Event is a change to a user
+type Event struct {
+	Type       string       `json:"type"`
+	User       *models.User `json:"user"`
+	TenantID   string       `json:"tenant_id"`
+	OccurredAt time.Time    `json:"occurred_at"`
+	// Device is the new device of user.new_device events. The protobuf
+	// encoding leaves it out.
+	Device *models.KnownDevice `json:"device,omitempty"`
+}
+
+// NewUserEvent creates an event of type t for user
+func NewUserEvent(t string, user *models.User) Event {
+	return Event{Type: t, User: user, TenantID: user.TenantID, OccurredAt: time.Now().UTC()}
+}
+
+// NewDeviceEvent creates a user.new_device event for a login from device
+func NewDeviceEvent(user *models.User, device *models.KnownDevice) Event {
+	e := NewUserEvent(UserNewDevice, user)
+	e.Device = device
+	return e
+}
+
+// Key returns the message key; keying by user keeps one user's events in order
+func (e Event) Key() string {
+	return fmt.Sprintf("%s:%d", e.TenantID, e.User.ID)
+}
+
+// Message is an encoded event ready to publish
+type Message struct {
+	Topic string
+	Key   string
+	Value []byte
+}
+
+// Broker sends messages to a message broker
+type Broker interface {
+	Name() string
+	Send(ctx context.Context, msg Message) error
+	Close() error
+}
+
+// Encode serializes an event as JSON or as a protobuf UserEvent
+func Encode(e Event, encoding string) ([]byte, error) {
+	switch encoding {
+	case EncodingJSON, "":
+		return json.Marshal(e)
+	case EncodingProtobuf:
+		return proto.Marshal(&pb.UserEvent{
+			Type: e.Type,
+			User: &pb.ProtoUser{
+				Id:        uint32(e.User.ID),
+				Name:      e.User.Name,
+				Email:     e.User.Email,
+				CreatedAt: formatTime(e.User.CreatedAt),
+				UpdatedAt: formatTime(e.User.UpdatedAt),
+				Version:   uint32(e.User.Version),
+			},
+			OccurredAt: e.OccurredAt.Format(time.RFC3339Nano),
+			TenantId:   e.TenantID,
+		})
+	default:
+		return nil, fmt.Errorf("unknown event encoding %q", encoding)
+	}
+}
+
+func formatTime(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// New creates a publisher for the configured broker, or returns nil when
+// publishing is disabled
+func New(cfg config.EventsConfig) (*Publisher, error) {
+	var broker Broker
+	var err error
+	switch cfg.Broker {
+	case "":
+		return nil, nil
+	case config.EventsBrokerKafka:
+		broker, err = NewKafkaBroker(cfg.URL)
+	case config.EventsBrokerNATS:
+		broker, err = NewNATSBroker(cfg.URL)
+	default:
+		return nil, fmt.Errorf("unknown events broker %q", cfg.Broker)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Encoding != EncodingJSON && cfg.Encoding != EncodingProtobuf {
+		return nil, fmt.Errorf("unknown event encoding %q", cfg.Encoding)
+	}
+	return NewPublisher(broker, cfg.Topic, cfg.Encoding, cfg.QueueSize), nil
+}
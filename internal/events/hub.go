@@ -0,0 +1,124 @@
+package events
+
+import (
+	"sync"
+)
+
+// Record is an event as delivered by a Hub, numbered so subscribers can
+// resume after reconnecting
+type Record struct {
+	ID    uint64
+	Event Event
+}
+
+// Hub fans user events out to in-process subscribers, such as the /events
+// stream. It keeps the most recent events so a subscriber that reconnects
+// can resume after the last one it saw. IDs restart when the process does.
+type Hub struct {
+	mu          sync.Mutex
+	nextID      uint64
+	history     []Record // ring buffer of the latest events, oldest at start
+	start       int
+	subscribers map[*Subscription]struct{}
+	bufferSize  int
+}
+
+// NewHub creates a hub remembering the last historySize events, giving each
+// subscriber room for bufferSize undelivered ones
+func NewHub(historySize, bufferSize int) *Hub {
+	if historySize < 1 {
+		historySize = 1
+	}
+	return &Hub{
+		nextID:      1,
+		history:     make([]Record, 0, historySize),
+		subscribers: make(map[*Subscription]struct{}),
+		bufferSize:  bufferSize,
+	}
+}
+
+// Subscription receives the events published after it was created. C is
+// closed when the subscriber falls too far behind or the subscription is
+// closed; a lagging subscriber should resubscribe from its last ID.
+type Subscription struct {
+	C   <-chan Record
+	c   chan Record
+	hub *Hub
+}
+
+// Close stops delivery to the subscription
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// Publish numbers an event, records it and delivers it to every subscriber
+func (h *Hub) Publish(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	record := Record{ID: h.nextID, Event: e}
+	h.nextID++
+	if len(h.history) < cap(h.history) {
+		h.history = append(h.history, record)
+	} else {
+		h.history[h.start] = record
+		h.start = (h.start + 1) % len(h.history)
+	}
+
+	for sub := range h.subscribers {
+		select {
+		case sub.c <- record:
+		default:
+			// Never block publishers on a slow client
+			h.remove(sub)
+		}
+	}
+}
+
+// Subscribe starts a subscription. With a non-zero after, it also returns
+// the retained events that followed it, and reports complete=false when
+// some of them have already been evicted from history.
+func (h *Hub) Subscribe(after uint64) (sub *Subscription, backlog []Record, complete bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	c := make(chan Record, h.bufferSize)
+	sub = &Subscription{C: c, c: c, hub: h}
+	h.subscribers[sub] = struct{}{}
+
+	complete = true
+	if after == 0 {
+		return sub, nil, complete
+	}
+	if after >= h.nextID {
+		// A cursor from before a restart; nothing can be replayed
+		return sub, nil, false
+	}
+	for i := range h.history {
+		record := h.history[(h.start+i)%len(h.history)]
+		if record.ID > after {
+			if len(backlog) == 0 && record.ID > after+1 {
+				complete = false
+			}
+			backlog = append(backlog, record)
+		}
+	}
+	return sub, backlog, complete
+}
+
+// Subscribers returns the number of active subscriptions
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
+
+// remove drops a subscriber; the caller holds h.mu
+func (h *Hub) remove(sub *Subscription) {
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.c)
+	}
+}
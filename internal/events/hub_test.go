@@ -0,0 +1,75 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/114windd/restapi/pkg/models"
+)
+
+func publishN(h *Hub, n int) {
+	for i := 0; i < n; i++ {
+		h.Publish(NewUserEvent(UserUpdated, &models.User{ID: uint(i + 1)}))
+	}
+}
+
+func TestHubReplay(t *testing.T) {
+	h := NewHub(3, 10)
+	publishN(h, 5) // ids 1-5, history keeps 3-5
+
+	tests := []struct {
+		after    uint64
+		want     []uint64
+		complete bool
+	}{
+		{after: 0, want: nil, complete: true},
+		{after: 4, want: []uint64{5}, complete: true},
+		{after: 2, want: []uint64{3, 4, 5}, complete: true},
+		{after: 1, want: []uint64{3, 4, 5}, complete: false},
+		{after: 5, want: nil, complete: true},
+		{after: 42, want: nil, complete: false},
+	}
+	for _, tt := range tests {
+		sub, backlog, complete := h.Subscribe(tt.after)
+		sub.Close()
+		var ids []uint64
+		for _, record := range backlog {
+			ids = append(ids, record.ID)
+		}
+		if len(ids) != len(tt.want) || complete != tt.complete {
+			t.Errorf("Subscribe(%d): got %v complete=%v, want %v complete=%v", tt.after, ids, complete, tt.want, tt.complete)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != tt.want[i] {
+				t.Errorf("Subscribe(%d): got %v, want %v", tt.after, ids, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestHubDropsSlowSubscriber(t *testing.T) {
+	h := NewHub(10, 2)
+	slow, _, _ := h.Subscribe(0)
+	fast, _, _ := h.Subscribe(0)
+
+	publishN(h, 2)
+	for i := 0; i < 2; i++ {
+		<-fast.C
+	}
+	publishN(h, 1)
+
+	if got := h.Subscribers(); got != 1 {
+		t.Fatalf("expected the slow subscriber to be dropped, %d remain", got)
+	}
+	for range slow.C {
+	}
+	if record := <-fast.C; record.ID != 3 {
+		t.Fatalf("fast subscriber: expected event 3, got %d", record.ID)
+	}
+	fast.Close()
+	slow.Close() // closing twice is harmless
+	if got := h.Subscribers(); got != 0 {
+		t.Fatalf("expected no subscribers, got %d", got)
+	}
+}
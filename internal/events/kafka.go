@@ -0,0 +1,100 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// KafkaBroker produces to Kafka through a Confluent-compatible REST Proxy
+// (v2 API), so no native Kafka client is needed. Messages are sent as
+// binary records, keyed for per-user ordering.
+type KafkaBroker struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewKafkaBroker creates a broker for the REST Proxy at baseURL
+func NewKafkaBroker(baseURL string) (*KafkaBroker, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Kafka REST Proxy URL %q", baseURL)
+	}
+	return &KafkaBroker{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Name implements Broker
+func (k *KafkaBroker) Name() string {
+	return "kafka"
+}
+
+type kafkaRecord struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type kafkaProduceResponse struct {
+	Offsets []struct {
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+// Send implements Broker
+func (k *KafkaBroker) Send(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(map[string][]kafkaRecord{
+		"records": {{
+			Key:   base64.StdEncoding.EncodeToString([]byte(msg.Key)),
+			Value: base64.StdEncoding.EncodeToString(msg.Value),
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoint := k.baseURL + "/topics/" + url.PathEscape(msg.Topic)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.binary.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kafka rest proxy: %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var produced kafkaProduceResponse
+	if err := json.Unmarshal(data, &produced); err != nil {
+		return fmt.Errorf("kafka rest proxy: decode response: %w", err)
+	}
+	for _, offset := range produced.Offsets {
+		if offset.ErrorCode != nil {
+			return fmt.Errorf("kafka rest proxy: produce failed: %s (code %d)", offset.Error, *offset.ErrorCode)
+		}
+	}
+	return nil
+}
+
+// Close implements Broker
+func (k *KafkaBroker) Close() error {
+	k.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,81 @@
+package events
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestKafkaSend(t *testing.T) {
+	var got struct {
+		Records []kafkaRecord `json:"records"`
+	}
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/topics/users.updated" || r.Header.Get("Content-Type") != "application/vnd.kafka.binary.v2+json" {
+			t.Errorf("unexpected request: %s %s, %s", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		io.WriteString(w, `{"offsets":[{"partition":0,"offset":7}]}`)
+	}))
+	defer proxy.Close()
+
+	k, err := NewKafkaBroker(proxy.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Send(context.Background(), Message{Topic: "users.updated", Key: "42", Value: []byte(`{"id":42}`)}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if len(got.Records) != 1 {
+		t.Fatalf("records: %+v", got.Records)
+	}
+	key, _ := base64.StdEncoding.DecodeString(got.Records[0].Key)
+	value, _ := base64.StdEncoding.DecodeString(got.Records[0].Value)
+	if string(key) != "42" || string(value) != `{"id":42}` {
+		t.Fatalf("record: key %q, value %q", key, value)
+	}
+}
+
+func TestKafkaSendErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"proxy error", http.StatusNotFound, `{"error_code":40401,"message":"Topic not found."}`, "404 Not Found: {\"error_code\":40401"},
+		{"produce error", http.StatusOK, `{"offsets":[{"partition":null,"offset":null,"error_code":50002,"error":"Leader not available"}]}`, "produce failed: Leader not available (code 50002)"},
+		{"malformed response", http.StatusOK, `<html>`, "decode response"},
+	}
+	for _, tt := range tests {
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+			io.WriteString(w, tt.body)
+		}))
+		k, _ := NewKafkaBroker(proxy.URL)
+		err := k.Send(context.Background(), userMessage)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.want, err)
+		}
+		proxy.Close()
+	}
+
+	// An unreachable proxy
+	proxy := httptest.NewServer(http.NotFoundHandler())
+	k, _ := NewKafkaBroker(proxy.URL)
+	proxy.Close()
+	if err := k.Send(context.Background(), userMessage); err == nil {
+		t.Error("Send to a stopped proxy: expected an error")
+	}
+
+	for _, url := range []string{"kafka://broker:9092", "http://", "::"} {
+		if _, err := NewKafkaBroker(url); err == nil {
+			t.Errorf("NewKafkaBroker(%q): expected an error", url)
+		}
+	}
+}
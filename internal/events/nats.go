@@ -0,0 +1,193 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/114windd/restapi/internal/logger"
+)
+
+// NATSBroker publishes over the NATS client protocol
+// (https://docs.nats.io/reference/reference-protocols/nats-protocol).
+// It connects lazily and reconnects on the next send after a failure.
+type NATSBroker struct {
+	addr     string
+	user     string
+	password string
+
+	mu   sync.Mutex
+	conn net.Conn
+	w    *bufio.Writer
+	err  chan error // receives the first -ERR or read failure of the current connection
+}
+
+// NewNATSBroker creates a broker for a nats://[user:password@]host:port URL
+func NewNATSBroker(rawURL string) (*NATSBroker, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "nats" || u.Host == "" {
+		return nil, fmt.Errorf("invalid NATS URL %q", rawURL)
+	}
+	b := &NATSBroker{addr: u.Host}
+	if u.Port() == "" {
+		b.addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	if u.User != nil {
+		b.user = u.User.Username()
+		b.password, _ = u.User.Password()
+	}
+	return b, nil
+}
+
+// Name implements Broker
+func (b *NATSBroker) Name() string {
+	return "nats"
+}
+
+// Send implements Broker. The topic is used as the NATS subject; NATS has
+// no message keys, so Key is not sent.
+func (b *NATSBroker) Send(ctx context.Context, msg Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.conn == nil {
+		if err := b.connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = b.conn.SetWriteDeadline(deadline)
+	}
+	fmt.Fprintf(b.w, "PUB %s %d\r\n", msg.Topic, len(msg.Value))
+	b.w.Write(msg.Value)
+	b.w.WriteString("\r\n")
+	if err := b.w.Flush(); err != nil {
+		b.disconnect()
+		return err
+	}
+
+	// Surface an asynchronous server error (e.g. permissions) reported so far
+	select {
+	case err := <-b.err:
+		b.disconnect()
+		return err
+	default:
+		return nil
+	}
+}
+
+// Close implements Broker
+func (b *NATSBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.disconnect()
+	return nil
+}
+
+// connect dials the server and completes the CONNECT handshake, confirmed
+// by a PING/PONG round trip. Callers must hold b.mu.
+func (b *NATSBroker) connect(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", b.addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("nats: unexpected greeting %q", strings.TrimSpace(line))
+	}
+
+	options := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "restapi",
+		"lang":     "go",
+		"version":  "1",
+		"protocol": 1,
+	}
+	if b.user != "" {
+		options["user"] = b.user
+		options["pass"] = b.password
+	}
+	connect, _ := json.Marshal(options)
+
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "CONNECT %s\r\nPING\r\n", connect)
+	if err := w.Flush(); err != nil {
+		conn.Close()
+		return err
+	}
+	line, err = r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if strings.TrimSpace(line) != "PONG" {
+		conn.Close()
+		return fmt.Errorf("nats: connect rejected: %s", strings.TrimSpace(line))
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	b.conn, b.w, b.err = conn, w, make(chan error, 1)
+	go b.readLoop(conn, r, b.err)
+	return nil
+}
+
+// readLoop answers server PINGs and reports server errors
+func (b *NATSBroker) readLoop(conn net.Conn, r *bufio.Reader, errs chan<- error) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				select {
+				case errs <- err:
+				default:
+				}
+			}
+			return
+		}
+
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PING":
+			b.mu.Lock()
+			if b.conn == conn {
+				b.w.WriteString("PONG\r\n")
+				b.w.Flush()
+			}
+			b.mu.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			logger.Log.WithField("error", line).Warn("NATS server reported an error")
+			select {
+			case errs <- fmt.Errorf("nats: %s", line):
+			default:
+			}
+		}
+	}
+}
+
+// disconnect drops the current connection. Callers must hold b.mu.
+func (b *NATSBroker) disconnect() {
+	if b.conn != nil {
+		b.conn.Close()
+		b.conn, b.w = nil, nil
+	}
+}
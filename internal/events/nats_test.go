@@ -0,0 +1,180 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/114windd/restapi/internal/logger"
+)
+
+func init() {
+	logger.Init()
+	logger.Log.SetOutput(io.Discard)
+}
+
+// fakeNATS accepts connections, greets them and answers the CONNECT/PING
+// handshake with reply, then hands them to the test
+type fakeNATS struct {
+	addr  string
+	conns chan *natsConn
+}
+
+type natsConn struct {
+	net.Conn
+	r       *bufio.Reader
+	connect string // the CONNECT line the client sent
+}
+
+func newFakeNATS(t *testing.T, reply string) *fakeNATS {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	f := &fakeNATS{addr: ln.Addr().String(), conns: make(chan *natsConn, 4)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c := &natsConn{Conn: conn, r: bufio.NewReader(conn)}
+			fmt.Fprint(conn, "INFO {\"server_id\":\"fake\",\"max_payload\":1048576}\r\n")
+			c.connect, _ = c.r.ReadString('\n')
+			_, _ = c.r.ReadString('\n') // PING
+			fmt.Fprint(conn, reply+"\r\n")
+			f.conns <- c
+		}
+	}()
+	return f
+}
+
+// accept returns the next connection the client made
+func (f *fakeNATS) accept(t *testing.T) *natsConn {
+	t.Helper()
+	select {
+	case c := <-f.conns:
+		t.Cleanup(func() { c.Close() })
+		return c
+	case <-time.After(2 * time.Second):
+		t.Fatal("the client did not connect")
+		return nil
+	}
+}
+
+// expect reads a line from the client, failing unless it is want
+func (c *natsConn) expect(t *testing.T, want string) {
+	t.Helper()
+	_ = c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line, err := c.r.ReadString('\n')
+	if err != nil || strings.TrimSuffix(line, "\r\n") != want {
+		t.Fatalf("expected %q from the client, got %q (%v)", want, line, err)
+	}
+}
+
+func (c *natsConn) send(line string) {
+	fmt.Fprint(c, line+"\r\n")
+}
+
+var userMessage = Message{Topic: "users.updated", Key: "42", Value: []byte(`{"id":42}`)}
+
+func TestNATSPublish(t *testing.T) {
+	server := newFakeNATS(t, "PONG")
+	b, err := NewNATSBroker("nats://app:s3cret@" + server.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	ctx := context.Background()
+
+	if err := b.Send(ctx, userMessage); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	c := server.accept(t)
+	for _, option := range []string{`"user":"app"`, `"pass":"s3cret"`, `"verbose":false`} {
+		if !strings.HasPrefix(c.connect, "CONNECT {") || !strings.Contains(c.connect, option) {
+			t.Fatalf("CONNECT without %s: %q", option, c.connect)
+		}
+	}
+	c.expect(t, "PUB users.updated 9")
+	c.expect(t, `{"id":42}`)
+
+	// The server's keepalive is answered on the same connection
+	c.send("PING")
+	c.expect(t, "PONG")
+
+	if err := b.Send(ctx, userMessage); err != nil {
+		t.Fatalf("second Send: %v", err)
+	}
+	c.expect(t, "PUB users.updated 9")
+	select {
+	case <-server.conns:
+		t.Fatal("a second Send must reuse the connection")
+	default:
+	}
+}
+
+func TestNATSConnectRejected(t *testing.T) {
+	server := newFakeNATS(t, "-ERR 'Authorization Violation'")
+	b, err := NewNATSBroker("nats://" + server.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if err := b.Send(context.Background(), userMessage); err == nil || !strings.Contains(err.Error(), "Authorization Violation") {
+		t.Fatalf("Send to a server refusing the connection: %v", err)
+	}
+}
+
+func TestNATSServerError(t *testing.T) {
+	server := newFakeNATS(t, "PONG")
+	b, err := NewNATSBroker("nats://" + server.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	ctx := context.Background()
+
+	if err := b.Send(ctx, userMessage); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	c := server.accept(t)
+	c.expect(t, "PUB users.updated 9")
+	c.expect(t, `{"id":42}`)
+	c.send("-ERR 'Permissions Violation for Publish to users.updated'")
+	// The client handles server lines in order, so once it answers this
+	// PING it has seen the error
+	c.send("PING")
+	c.expect(t, "PONG")
+
+	// The error is reported by the next send, which drops the connection...
+	if err := b.Send(ctx, userMessage); err == nil || !strings.Contains(err.Error(), "Permissions Violation") {
+		t.Fatalf("Send after -ERR: %v", err)
+	}
+	// ...and the one after it connects again
+	if err := b.Send(ctx, userMessage); err != nil {
+		t.Fatalf("Send after reconnecting: %v", err)
+	}
+	server.accept(t).expect(t, "PUB users.updated 9")
+}
+
+func TestNewNATSBroker(t *testing.T) {
+	b, err := NewNATSBroker("nats://nats.internal")
+	if err != nil || b.addr != "nats.internal:4222" {
+		t.Fatalf("default port: %v, %q", err, b.addr)
+	}
+	for _, url := range []string{"http://nats.internal:4222", "nats://", "::"} {
+		if _, err := NewNATSBroker(url); err == nil {
+			t.Errorf("NewNATSBroker(%q): expected an error", url)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/metrics"
+	"github.com/114windd/restapi/internal/retry"
+)
+
+// publishTimeout bounds a single delivery attempt
+const publishTimeout = 10 * time.Second
+
+// Publisher encodes events and delivers them to a broker in the background,
+// in order, retrying failed deliveries. Publish never blocks the caller:
+// when the queue is full the event is dropped and counted.
+type Publisher struct {
+	broker   Broker
+	topic    string
+	encoding string
+	queue    chan Event
+	done     chan struct{}
+
+	mu      sync.Mutex
+	lastErr error // outcome of the latest delivery
+}
+
+// NewPublisher starts a publisher sending to topic through broker, with
+// room for queueSize undelivered events
+func NewPublisher(broker Broker, topic, encoding string, queueSize int) *Publisher {
+	p := &Publisher{
+		broker:   broker,
+		topic:    topic,
+		encoding: encoding,
+		queue:    make(chan Event, queueSize),
+		done:     make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Publish queues an event for delivery
+func (p *Publisher) Publish(e Event) {
+	select {
+	case p.queue <- e:
+	default:
+		metrics.RecordEventPublish(p.broker.Name(), e.Type, "dropped", 0)
+		logger.Log.WithField("type", e.Type).Warn("Event queue full, dropping event")
+	}
+}
+
+// Close delivers queued events and disconnects from the broker
+func (p *Publisher) Close() error {
+	close(p.queue)
+	<-p.done
+	return p.broker.Close()
+}
+
+// Check reports the publisher unhealthy while its queue is full or when
+// the latest delivery failed, for the readiness registry
+func (p *Publisher) Check(ctx context.Context) error {
+	if len(p.queue) == cap(p.queue) {
+		return fmt.Errorf("event queue full (%d events)", cap(p.queue))
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.lastErr != nil {
+		return fmt.Errorf("last delivery to %s failed: %w", p.broker.Name(), p.lastErr)
+	}
+	return nil
+}
+
+func (p *Publisher) run() {
+	defer close(p.done)
+	for e := range p.queue {
+		p.deliver(e)
+	}
+}
+
+func (p *Publisher) deliver(e Event) {
+	value, err := Encode(e, p.encoding)
+	if err != nil {
+		metrics.RecordEventPublish(p.broker.Name(), e.Type, "error", 0)
+		logger.Log.WithError(err).WithField("type", e.Type).Error("Failed to encode event")
+		return
+	}
+	msg := Message{Topic: p.topic, Key: e.Key(), Value: value}
+
+	// Broker errors aren't classified, and an attempt that timed out is worth
+	// retrying, so retry everything
+	config := retry.DefaultRetryConfig()
+	config.IsRetryable = nil
+
+	start := time.Now()
+	err = retry.ExecuteWithRetry(context.Background(), "publish_event", func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+		defer cancel()
+		return p.broker.Send(ctx, msg)
+	}, config)
+
+	p.mu.Lock()
+	p.lastErr = err
+	p.mu.Unlock()
+	if err != nil {
+		metrics.RecordEventPublish(p.broker.Name(), e.Type, "error", time.Since(start))
+		logger.Log.WithError(err).WithField("type", e.Type).WithField("key", msg.Key).Error("Failed to publish event")
+		return
+	}
+	metrics.RecordEventPublish(p.broker.Name(), e.Type, "success", time.Since(start))
+}
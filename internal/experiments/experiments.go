@@ -0,0 +1,173 @@
+// Package experiments assigns users to A/B experiment variants and records
+// when a user is exposed to their variant.
+package experiments
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/114windd/restapi/internal/metrics"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// ErrUnknownExperiment is returned for experiment keys that aren't configured
+var ErrUnknownExperiment = errors.New("unknown experiment")
+
+// Variant is one arm of an experiment. Users are split across variants in
+// proportion to their weights.
+type Variant struct {
+	Name   string
+	Weight int
+}
+
+// Experiment is a named split of users into variants
+type Experiment struct {
+	Key      string
+	Variants []Variant
+}
+
+// Assignment is the variant a user sees in an experiment
+type Assignment struct {
+	Experiment string `json:"experiment"`
+	Variant    string `json:"variant"`
+}
+
+// Assign deterministically picks the variant for userID. The same user
+// always lands in the same variant as long as the experiment is unchanged,
+// and different experiments split users independently.
+func (e Experiment) Assign(userID uint) string {
+	total := 0
+	for _, v := range e.Variants {
+		total += v.Weight
+	}
+	if total == 0 {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(e.Key + ":" + strconv.FormatUint(uint64(userID), 10)))
+	bucket := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+	for _, v := range e.Variants {
+		if bucket < v.Weight {
+			return v.Name
+		}
+		bucket -= v.Weight
+	}
+	return e.Variants[len(e.Variants)-1].Name
+}
+
+// Parse reads experiment definitions of the form
+// "onboarding=control:50,guided:50;dark_mode=off:90,on:10". A variant
+// without a weight gets weight 1.
+func Parse(spec string) ([]Experiment, error) {
+	var experiments []Experiment
+	seen := map[string]bool{}
+	for _, def := range strings.Split(spec, ";") {
+		def = strings.TrimSpace(def)
+		if def == "" {
+			continue
+		}
+
+		key, variants, ok := strings.Cut(def, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("experiment %q: expected key=variant:weight,...", def)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("experiment %q defined twice", key)
+		}
+		seen[key] = true
+
+		exp := Experiment{Key: key}
+		for _, v := range strings.Split(variants, ",") {
+			name, weight, hasWeight := strings.Cut(strings.TrimSpace(v), ":")
+			variant := Variant{Name: strings.TrimSpace(name), Weight: 1}
+			if variant.Name == "" {
+				return nil, fmt.Errorf("experiment %q: empty variant name", key)
+			}
+			if hasWeight {
+				w, err := strconv.Atoi(strings.TrimSpace(weight))
+				if err != nil || w < 0 {
+					return nil, fmt.Errorf("experiment %q: invalid weight %q for variant %q", key, weight, variant.Name)
+				}
+				variant.Weight = w
+			}
+			exp.Variants = append(exp.Variants, variant)
+		}
+		if len(exp.Variants) < 2 {
+			return nil, fmt.Errorf("experiment %q needs at least two variants", key)
+		}
+		experiments = append(experiments, exp)
+	}
+	return experiments, nil
+}
+
+// ExposureRecorder persists exposure events
+type ExposureRecorder interface {
+	RecordExposure(ctx context.Context, exposure *models.ExperimentExposure) error
+}
+
+// Service assigns users to the configured experiments
+type Service struct {
+	mu          sync.RWMutex
+	experiments []Experiment
+	exposures   ExposureRecorder
+}
+
+// NewService creates a Service for experiments, recording exposures with
+// exposures
+func NewService(experiments []Experiment, exposures ExposureRecorder) *Service {
+	return &Service{experiments: experiments, exposures: exposures}
+}
+
+// SetExperiments replaces the running experiments; it is safe to call while serving
+func (s *Service) SetExperiments(experiments []Experiment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.experiments = experiments
+}
+
+// running returns the experiments in effect
+func (s *Service) running() []Experiment {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.experiments
+}
+
+// Assignments returns the user's variant in every running experiment
+func (s *Service) Assignments(userID uint) []Assignment {
+	experiments := s.running()
+	assignments := make([]Assignment, 0, len(experiments))
+	for _, exp := range experiments {
+		assignments = append(assignments, Assignment{Experiment: exp.Key, Variant: exp.Assign(userID)})
+	}
+	return assignments
+}
+
+// RecordExposure records that the user has been shown their variant of the
+// experiment and returns the assignment
+func (s *Service) RecordExposure(ctx context.Context, userID uint, key string) (*Assignment, error) {
+	for _, exp := range s.running() {
+		if exp.Key != key {
+			continue
+		}
+
+		assignment := Assignment{Experiment: exp.Key, Variant: exp.Assign(userID)}
+		exposure := models.ExperimentExposure{
+			UserID:     userID,
+			Experiment: assignment.Experiment,
+			Variant:    assignment.Variant,
+		}
+		if err := s.exposures.RecordExposure(ctx, &exposure); err != nil {
+			return nil, err
+		}
+		metrics.RecordExperimentExposure(assignment.Experiment, assignment.Variant)
+		return &assignment, nil
+	}
+	return nil, ErrUnknownExperiment
+}
@@ -0,0 +1,133 @@
+package experiments
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/114windd/restapi/pkg/models"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []Experiment
+		err  bool
+	}{
+		{spec: "", want: nil},
+		{spec: "onboarding=control:50,guided:50;dark_mode=off:90,on:10", want: []Experiment{
+			{Key: "onboarding", Variants: []Variant{{"control", 50}, {"guided", 50}}},
+			{Key: "dark_mode", Variants: []Variant{{"off", 90}, {"on", 10}}},
+		}},
+		{spec: " checkout = a , b:3 ; ", want: []Experiment{{Key: "checkout", Variants: []Variant{{"a", 1}, {"b", 3}}}}},
+		{spec: "holdout=control:0,treatment", want: []Experiment{{Key: "holdout", Variants: []Variant{{"control", 0}, {"treatment", 1}}}}},
+		{spec: "onboarding", err: true},
+		{spec: "=a,b", err: true},
+		{spec: "onboarding=control", err: true},
+		{spec: "onboarding=control,:5", err: true},
+		{spec: "onboarding=control:x,guided", err: true},
+		{spec: "onboarding=control:-1,guided", err: true},
+		{spec: "onboarding=a,b;onboarding=c,d", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := Parse(tt.spec)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %+v, got %+v, %v", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestAssign(t *testing.T) {
+	split := Experiment{Key: "onboarding", Variants: []Variant{{"control", 3}, {"guided", 1}}}
+	counts := map[string]int{}
+	for id := uint(1); id <= 4000; id++ {
+		variant := split.Assign(id)
+		if again := split.Assign(id); again != variant {
+			t.Fatalf("user %d assigned %q, then %q", id, variant, again)
+		}
+		counts[variant]++
+	}
+	// 3:1 weights, within a few percent
+	if len(counts) != 2 || counts["control"] < 2800 || counts["control"] > 3200 {
+		t.Fatalf("unexpected split %v", counts)
+	}
+
+	// Another experiment splits the same users independently
+	other := Experiment{Key: "dark_mode", Variants: []Variant{{"control", 3}, {"guided", 1}}}
+	differ := 0
+	for id := uint(1); id <= 1000; id++ {
+		if other.Assign(id) != split.Assign(id) {
+			differ++
+		}
+	}
+	if differ < 200 {
+		t.Fatalf("experiments with different keys assigned %d of 1000 users differently", differ)
+	}
+
+	holdout := Experiment{Key: "holdout", Variants: []Variant{{"control", 0}, {"treatment", 1}}}
+	for id := uint(1); id <= 100; id++ {
+		if variant := holdout.Assign(id); variant != "treatment" {
+			t.Fatalf("user %d assigned the zero-weight variant %q", id, variant)
+		}
+	}
+	if variant := (Experiment{Key: "off", Variants: []Variant{{"a", 0}, {"b", 0}}}).Assign(1); variant != "" {
+		t.Fatalf("experiment without weight assigned %q", variant)
+	}
+}
+
+// exposureLog records exposures in memory, failing with err when set
+type exposureLog struct {
+	exposures []models.ExperimentExposure
+	err       error
+}
+
+func (l *exposureLog) RecordExposure(ctx context.Context, exposure *models.ExperimentExposure) error {
+	if l.err != nil {
+		return l.err
+	}
+	l.exposures = append(l.exposures, *exposure)
+	return nil
+}
+
+func TestRecordExposure(t *testing.T) {
+	onboarding := Experiment{Key: "onboarding", Variants: []Variant{{"control", 1}, {"guided", 1}}}
+	log := &exposureLog{}
+	s := NewService([]Experiment{onboarding}, log)
+
+	assignment, err := s.RecordExposure(context.Background(), 7, "onboarding")
+	if err != nil || assignment.Experiment != "onboarding" || assignment.Variant != onboarding.Assign(7) {
+		t.Fatalf("RecordExposure: %+v, %v", assignment, err)
+	}
+	if len(log.exposures) != 1 || log.exposures[0].UserID != 7 || log.exposures[0].Variant != assignment.Variant {
+		t.Fatalf("recorded %+v", log.exposures)
+	}
+	if got := s.Assignments(7); len(got) != 1 || got[0] != *assignment {
+		t.Fatalf("Assignments: %+v", got)
+	}
+
+	if _, err := s.RecordExposure(context.Background(), 7, "dark_mode"); !errors.Is(err, ErrUnknownExperiment) {
+		t.Fatalf("unknown experiment: %v", err)
+	}
+	log.err = errors.New("database down")
+	if _, err := s.RecordExposure(context.Background(), 7, "onboarding"); !errors.Is(err, log.err) {
+		t.Fatalf("failed write: %v", err)
+	}
+
+	// Experiments can be replaced while serving
+	s.SetExperiments(nil)
+	if got := s.Assignments(7); len(got) != 0 {
+		t.Fatalf("Assignments after SetExperiments(nil): %+v", got)
+	}
+	if _, err := s.RecordExposure(context.Background(), 7, "onboarding"); !errors.Is(err, ErrUnknownExperiment) {
+		t.Fatalf("stopped experiment: %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+// Package geoip locates client IP addresses with a MaxMind GeoIP2 or
+// GeoLite2 database, caching recent lookups, so that logs can say where
+// requests and logins come from.
+package geoip
+
+import (
+	"container/list"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/oschwald/geoip2-golang"
+
+	"github.com/114windd/restapi/internal/logger"
+)
+
+// Location is where an IP address is, as far as the database knows. Either
+// field may be empty.
+type Location struct {
+	Country string // ISO 3166-1 alpha-2 code, e.g. "FR"
+	City    string // English name
+
+	// Coordinates, from City databases, good to within AccuracyRadius
+	// kilometers. A zero radius means they are unknown.
+	Latitude       float64
+	Longitude      float64
+	AccuracyRadius uint16
+}
+
+// LogFields returns the known country and city as log fields
+func (l Location) LogFields() map[string]interface{} {
+	fields := make(map[string]interface{}, 2)
+	if l.Country != "" {
+		fields["country"] = l.Country
+	}
+	if l.City != "" {
+		fields["city"] = l.City
+	}
+	return fields
+}
+
+// Source looks up the location of IP addresses
+type Source interface {
+	Locate(ip net.IP) (Location, error)
+	Close() error
+}
+
+// Locator looks up IP addresses in a Source, remembering the most recent
+// ones. A nil Locator locates nothing.
+type Locator struct {
+	source Source
+	size   int
+
+	mu      sync.Mutex
+	order   *list.List // of *entry, most recently used first
+	entries map[string]*list.Element
+}
+
+type entry struct {
+	ip       string
+	location Location
+}
+
+// New creates a Locator caching up to cacheSize addresses; 0 disables the cache
+func New(source Source, cacheSize int) *Locator {
+	return &Locator{source: source, size: cacheSize, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// Open creates a Locator reading the MaxMind database at path. City and
+// Country databases are supported; the latter leave City empty.
+func Open(path string, cacheSize int) (*Locator, error) {
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open GeoIP database: %w", err)
+	}
+	dbType := reader.Metadata().DatabaseType
+	logger.Log.WithField("path", path).WithField("type", dbType).Info("GeoIP database loaded")
+	return New(&maxmindSource{reader: reader, city: strings.Contains(dbType, "City")}, cacheSize), nil
+}
+
+// Lookup returns the location of ip. Private, loopback and malformed
+// addresses, and failed lookups, have no location.
+func (l *Locator) Lookup(ip string) Location {
+	if l == nil {
+		return Location{}
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.IsPrivate() || parsed.IsLoopback() || parsed.IsUnspecified() || parsed.IsLinkLocalUnicast() {
+		return Location{}
+	}
+
+	l.mu.Lock()
+	if e, ok := l.entries[ip]; ok {
+		l.order.MoveToFront(e)
+		location := e.Value.(*entry).location
+		l.mu.Unlock()
+		return location
+	}
+	l.mu.Unlock()
+
+	location, err := l.source.Locate(parsed)
+	if err != nil {
+		logger.Log.WithError(err).WithField("ip", ip).Warn("GeoIP lookup failed")
+		return Location{}
+	}
+	l.remember(ip, location)
+	return location
+}
+
+// remember caches a location, evicting the least recently used one when full
+func (l *Locator) remember(ip string, location Location) {
+	if l.size <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.entries[ip]; ok {
+		return
+	}
+	l.entries[ip] = l.order.PushFront(&entry{ip: ip, location: location})
+	if l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*entry).ip)
+	}
+}
+
+// Close releases the database
+func (l *Locator) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.source.Close()
+}
+
+// maxmindSource reads a MaxMind database
+type maxmindSource struct {
+	reader *geoip2.Reader
+	city   bool // the database has cities
+}
+
+func (m *maxmindSource) Locate(ip net.IP) (Location, error) {
+	if m.city {
+		record, err := m.reader.City(ip)
+		if err != nil {
+			return Location{}, err
+		}
+		return Location{
+			Country:        record.Country.IsoCode,
+			City:           record.City.Names["en"],
+			Latitude:       record.Location.Latitude,
+			Longitude:      record.Location.Longitude,
+			AccuracyRadius: record.Location.AccuracyRadius,
+		}, nil
+	}
+	record, err := m.reader.Country(ip)
+	if err != nil {
+		return Location{}, err
+	}
+	return Location{Country: record.Country.IsoCode}, nil
+}
+
+func (m *maxmindSource) Close() error {
+	return m.reader.Close()
+}
@@ -0,0 +1,79 @@
+package geoip
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/114windd/restapi/internal/logger"
+)
+
+func init() {
+	logger.Init()
+	logger.Log.SetOutput(io.Discard)
+}
+
+// countingSource places every address in Paris, counting lookups
+type countingSource struct {
+	lookups int
+	fail    bool
+}
+
+func (s *countingSource) Locate(ip net.IP) (Location, error) {
+	s.lookups++
+	if s.fail {
+		return Location{}, errors.New("corrupt database")
+	}
+	return Location{Country: "FR", City: "Paris"}, nil
+}
+
+func (s *countingSource) Close() error { return nil }
+
+func TestLookupCaches(t *testing.T) {
+	source := &countingSource{}
+	locator := New(source, 2)
+
+	if got := locator.Lookup("203.0.113.1"); got != (Location{Country: "FR", City: "Paris"}) {
+		t.Fatalf("unexpected location %+v", got)
+	}
+	locator.Lookup("203.0.113.1")
+	if source.lookups != 1 {
+		t.Fatalf("expected a cached second lookup, got %d lookups", source.lookups)
+	}
+
+	// The least recently used address is evicted
+	locator.Lookup("203.0.113.2")
+	locator.Lookup("203.0.113.1")
+	locator.Lookup("203.0.113.3")
+	locator.Lookup("203.0.113.1")
+	if source.lookups != 3 {
+		t.Fatalf("expected 203.0.113.1 to stay cached, got %d lookups", source.lookups)
+	}
+	locator.Lookup("203.0.113.2")
+	if source.lookups != 4 {
+		t.Fatalf("expected 203.0.113.2 to be evicted, got %d lookups", source.lookups)
+	}
+
+	for _, ip := range []string{"10.0.0.1", "127.0.0.1", "::1", "not an ip", ""} {
+		if got := locator.Lookup(ip); got != (Location{}) {
+			t.Errorf("Lookup(%q) = %+v, want no location", ip, got)
+		}
+	}
+	if source.lookups != 4 {
+		t.Errorf("private and malformed addresses should not be looked up, got %d lookups", source.lookups)
+	}
+
+	// Failures are not cached
+	failing := New(&countingSource{fail: true}, 2)
+	failing.Lookup("203.0.113.1")
+	failing.Lookup("203.0.113.1")
+	if n := failing.source.(*countingSource).lookups; n != 2 {
+		t.Errorf("expected failed lookups to be retried, got %d lookups", n)
+	}
+
+	var none *Locator
+	if got := none.Lookup("203.0.113.1"); got != (Location{}) {
+		t.Errorf("nil Locator located %+v", got)
+	}
+}
@@ -0,0 +1,70 @@
+package graphql
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/service"
+	"github.com/114windd/restapi/internal/validation"
+)
+
+// Error codes reported in the "code" extension of GraphQL errors
+const (
+	codeBadUserInput    = "BAD_USER_INPUT"
+	codeUnauthenticated = "UNAUTHENTICATED"
+	codeForbidden       = "FORBIDDEN"
+	codeNotFound        = "NOT_FOUND"
+	codeConflict        = "CONFLICT"
+	codeInternal        = "INTERNAL"
+)
+
+// resolverError is an error reported to the client with a machine-readable code
+type resolverError struct {
+	message string
+	code    string
+	fields  validation.Errors
+}
+
+func (e *resolverError) Error() string { return e.message }
+
+// Extensions is read by graphql-go into the error's "extensions"
+func (e *resolverError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"code": e.code}
+	if len(e.fields) > 0 {
+		extensions["fields"] = e.fields
+	}
+	return extensions
+}
+
+var (
+	errUnauthenticated = &resolverError{message: "Authentication required", code: codeUnauthenticated}
+	errForbidden       = &resolverError{message: "Not allowed to modify this user", code: codeForbidden}
+	errImpersonating   = &resolverError{message: "Not allowed while impersonating a user", code: codeForbidden}
+	errInvalidUserID   = &resolverError{message: "Invalid user ID", code: codeBadUserInput}
+	errInvalidVersion  = &resolverError{message: "version must be a positive integer", code: codeBadUserInput}
+)
+
+// toError maps a service error to a client error, the same way the REST
+// handlers pick status codes. Unexpected errors are logged and reported as
+// "Failed to <action>".
+func toError(err error, action string) error {
+	var fields validation.Errors
+	switch {
+	case errors.As(err, &fields):
+		return &resolverError{message: fields.Error(), code: codeBadUserInput, fields: fields}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return &resolverError{message: "User not found", code: codeNotFound}
+	case errors.Is(err, service.ErrInvalidAttributes),
+		errors.Is(err, service.ErrInvalidListRequest),
+		errors.Is(err, service.ErrEmptySearchQuery):
+		return &resolverError{message: err.Error(), code: codeBadUserInput}
+	case errors.Is(err, service.ErrVersionConflict):
+		return &resolverError{message: "User was modified by another request; fetch it again and retry", code: codeConflict}
+	case errors.Is(err, service.ErrEmailTaken):
+		return &resolverError{message: "Email already exists", code: codeConflict}
+	}
+	logger.Log.WithError(err).Errorf("GraphQL: failed to %s", action)
+	return &resolverError{message: "Failed to " + action, code: codeInternal}
+}
@@ -0,0 +1,82 @@
+package graphql
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/graph-gophers/dataloader"
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/service"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// batchWait is how long the loader collects user lookups before running
+// them as one batch. Sibling fields resolve concurrently, so a short wait
+// is enough to catch them all.
+const batchWait = 2 * time.Millisecond
+
+// userKey is a user ID as a dataloader key
+type userKey uint
+
+func (k userKey) String() string   { return strconv.FormatUint(uint64(k), 10) }
+func (k userKey) Raw() interface{} { return uint(k) }
+
+// newUserLoader returns a loader that deduplicates the user lookups of one
+// request and resolves each batch with a single GetUsersByIDs call
+func newUserLoader(users *service.UserService) *dataloader.Loader {
+	batch := func(ctx context.Context, keys dataloader.Keys) []*dataloader.Result {
+		ids := make([]uint, len(keys))
+		for i, key := range keys {
+			ids[i] = uint(key.(userKey))
+		}
+		results := make([]*dataloader.Result, len(keys))
+		found, _, err := users.GetUsersByIDs(ctx, ids)
+		if err != nil {
+			for i := range results {
+				results[i] = &dataloader.Result{Error: err}
+			}
+			return results
+		}
+		byID := make(map[uint]*models.User, len(found))
+		for i := range found {
+			byID[found[i].ID] = &found[i]
+		}
+		for i, id := range ids {
+			if user, ok := byID[id]; ok {
+				results[i] = &dataloader.Result{Data: user}
+			} else {
+				results[i] = &dataloader.Result{Error: gorm.ErrRecordNotFound}
+			}
+		}
+		return results
+	}
+	return dataloader.NewBatchedLoader(batch, dataloader.WithWait(batchWait), dataloader.WithBatchCapacity(service.MaxBatchIDs))
+}
+
+type loaderKey struct{}
+
+func withUserLoader(ctx context.Context, loader *dataloader.Loader) context.Context {
+	return context.WithValue(ctx, loaderKey{}, loader)
+}
+
+// loadUser fetches a user through the request's loader
+func (r *resolver) loadUser(ctx context.Context, id uint) (*models.User, error) {
+	loader, ok := ctx.Value(loaderKey{}).(*dataloader.Loader)
+	if !ok {
+		return r.users.GetUser(ctx, id)
+	}
+	data, err := loader.Load(ctx, userKey(id))()
+	if err != nil {
+		return nil, err
+	}
+	return data.(*models.User), nil
+}
+
+// forgetUser drops a user from the request's loader after a mutation
+func forgetUser(ctx context.Context, id uint) {
+	if loader, ok := ctx.Value(loaderKey{}).(*dataloader.Loader); ok {
+		loader.Clear(ctx, userKey(id))
+	}
+}
@@ -0,0 +1,325 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/graph-gophers/graphql-go"
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/auth"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/privacy"
+	"github.com/114windd/restapi/internal/service"
+	"github.com/114windd/restapi/internal/validation"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// resolver is the root of the Query and Mutation types
+type resolver struct {
+	users   *service.UserService
+	privacy *privacy.Service // nil: accounts are deleted without erasure
+}
+
+// caller returns the authenticated identity of the request
+func caller(ctx context.Context) (*auth.Identity, error) {
+	identity, ok := auth.IdentityFromContext(ctx)
+	if !ok || identity == nil {
+		return nil, errUnauthenticated
+	}
+	return identity, nil
+}
+
+// mutator returns the authenticated identity of a mutation. Impersonation
+// tokens are read-only, as on the REST and gRPC APIs.
+func mutator(ctx context.Context, mutation string) (*auth.Identity, error) {
+	identity, err := caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if identity.IsImpersonated() {
+		logger.LogImpersonation("blocked", identity.ActorID, identity.UserID).
+			WithField("mutation", mutation).
+			Warn("Write blocked during impersonation")
+		return nil, errImpersonating
+	}
+	return identity, nil
+}
+
+func parseID(id graphql.ID) (uint, error) {
+	n, err := strconv.ParseUint(string(id), 10, 64)
+	if err != nil || n == 0 {
+		return 0, errInvalidUserID
+	}
+	return uint(n), nil
+}
+
+// Queries
+
+func (r *resolver) Me(ctx context.Context) (*userResolver, error) {
+	identity, err := caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	user, err := r.loadUser(ctx, identity.UserID)
+	if err != nil {
+		return nil, toError(err, "fetch user")
+	}
+	return &userResolver{user}, nil
+}
+
+func (r *resolver) User(ctx context.Context, args struct{ ID graphql.ID }) (*userResolver, error) {
+	if _, err := caller(ctx); err != nil {
+		return nil, err
+	}
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := r.loadUser(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, toError(err, "fetch user")
+	}
+	return &userResolver{user}, nil
+}
+
+func (r *resolver) Users(ctx context.Context, args struct {
+	First   *int32
+	After   *string
+	OrderBy *string
+	Filter  *string
+}) (*userConnectionResolver, error) {
+	if _, err := caller(ctx); err != nil {
+		return nil, err
+	}
+	req := service.UserPageRequest{}
+	if args.First != nil {
+		req.PageSize = int(*args.First)
+	}
+	if args.After != nil {
+		req.PageToken = *args.After
+	}
+	if args.OrderBy != nil {
+		req.OrderBy = *args.OrderBy
+	}
+	if args.Filter != nil {
+		req.Filter = *args.Filter
+	}
+
+	users, next, err := r.users.ListUsersPage(ctx, req)
+	if err != nil {
+		return nil, toError(err, "fetch users")
+	}
+	return &userConnectionResolver{r: r, users: users, next: next, filter: req.Filter}, nil
+}
+
+func (r *resolver) SearchUsers(ctx context.Context, args struct {
+	Query string
+	Limit *int32
+}) ([]*userResolver, error) {
+	if _, err := caller(ctx); err != nil {
+		return nil, err
+	}
+	limit := 0
+	if args.Limit != nil {
+		limit = int(*args.Limit)
+	}
+	users, err := r.users.SearchUsers(ctx, args.Query, limit)
+	if err != nil {
+		return nil, toError(err, "search users")
+	}
+	return userResolvers(users), nil
+}
+
+// Mutations
+
+func (r *resolver) UpdateUser(ctx context.Context, args struct {
+	ID      graphql.ID
+	Version int32
+	Input   userInput
+}) (*userResolver, error) {
+	identity, err := mutator(ctx, "updateUser")
+	if err != nil {
+		return nil, err
+	}
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !identity.CanModifyUser(id) {
+		return nil, errForbidden
+	}
+	// Like If-Match on PUT /users/:id, the version is required
+	if args.Version < 1 {
+		return nil, errInvalidVersion
+	}
+	return r.update(ctx, id, uint(args.Version), args.Input)
+}
+
+func (r *resolver) UpdateMe(ctx context.Context, args struct {
+	Version *int32
+	Input   userInput
+}) (*userResolver, error) {
+	identity, err := mutator(ctx, "updateMe")
+	if err != nil {
+		return nil, err
+	}
+	var version uint
+	if args.Version != nil {
+		if *args.Version < 1 {
+			return nil, errInvalidVersion
+		}
+		version = uint(*args.Version)
+	}
+	return r.update(ctx, identity.UserID, version, args.Input)
+}
+
+func (r *resolver) update(ctx context.Context, id, version uint, input userInput) (*userResolver, error) {
+	req := input.request()
+	if err := validation.Struct(req); err != nil {
+		return nil, toError(err, "update user")
+	}
+	user, err := r.users.UpdateUser(ctx, id, version, req)
+	if err != nil {
+		return nil, toError(err, "update user")
+	}
+	forgetUser(ctx, id)
+	return &userResolver{user}, nil
+}
+
+func (r *resolver) DeleteUser(ctx context.Context, args struct{ ID graphql.ID }) (bool, error) {
+	identity, err := mutator(ctx, "deleteUser")
+	if err != nil {
+		return false, err
+	}
+	id, err := parseID(args.ID)
+	if err != nil {
+		return false, err
+	}
+	if !identity.CanModifyUser(id) {
+		return false, errForbidden
+	}
+	// Like DELETE /me, erasure also revokes the user's sessions and removes
+	// their exports
+	deleteUser := r.users.DeleteUser
+	if r.privacy != nil {
+		deleteUser = r.privacy.Erase
+	}
+	if err := deleteUser(ctx, id); err != nil {
+		return false, toError(err, "delete user")
+	}
+	forgetUser(ctx, id)
+	return true, nil
+}
+
+// userInput is the UserInput type, replacing a user's editable fields
+type userInput struct {
+	Name       string
+	Email      string
+	Bio        *string
+	Phone      *string
+	Attributes *JSON
+}
+
+func (in userInput) request() models.RestUpdateUserRequest {
+	req := models.RestUpdateUserRequest{Name: in.Name, Email: in.Email}
+	if in.Bio != nil {
+		req.Bio = *in.Bio
+	}
+	if in.Phone != nil {
+		req.Phone = *in.Phone
+	}
+	if in.Attributes != nil {
+		req.Attributes = models.Attributes(*in.Attributes)
+	}
+	return req
+}
+
+// JSON is the JSON scalar, a JSON object such as a user's custom attributes
+type JSON map[string]interface{}
+
+// ImplementsGraphQLType binds JSON to the schema's JSON scalar
+func (JSON) ImplementsGraphQLType(name string) bool { return name == "JSON" }
+
+// UnmarshalGraphQL accepts an object literal or variable
+func (j *JSON) UnmarshalGraphQL(input interface{}) error {
+	object, ok := input.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("JSON must be an object, got %T", input)
+	}
+	*j = object
+	return nil
+}
+
+// userResolver resolves the fields of the User type
+type userResolver struct {
+	user *models.User
+}
+
+func userResolvers(users []models.User) []*userResolver {
+	resolvers := make([]*userResolver, len(users))
+	for i := range users {
+		resolvers[i] = &userResolver{&users[i]}
+	}
+	return resolvers
+}
+
+func (u *userResolver) ID() graphql.ID {
+	return graphql.ID(strconv.FormatUint(uint64(u.user.ID), 10))
+}
+
+func (u *userResolver) Name() string           { return u.user.Name }
+func (u *userResolver) Email() string          { return u.user.Email }
+func (u *userResolver) Role() string           { return u.user.Role }
+func (u *userResolver) Status() string         { return u.user.Status }
+func (u *userResolver) TenantID() string       { return u.user.TenantID }
+func (u *userResolver) Bio() string            { return u.user.Bio }
+func (u *userResolver) Phone() string          { return u.user.Phone }
+func (u *userResolver) Avatar() string         { return u.user.Avatar }
+func (u *userResolver) TwoFactorEnabled() bool { return u.user.TwoFactorEnabled }
+func (u *userResolver) Version() int32         { return int32(u.user.Version) }
+func (u *userResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: u.user.CreatedAt}
+}
+func (u *userResolver) UpdatedAt() graphql.Time {
+	return graphql.Time{Time: u.user.UpdatedAt}
+}
+
+func (u *userResolver) Attributes() JSON {
+	if u.user.Attributes == nil {
+		return JSON{}
+	}
+	return JSON(u.user.Attributes)
+}
+
+func (u *userResolver) LastLoginAt() *graphql.Time {
+	if u.user.LastLoginAt == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *u.user.LastLoginAt}
+}
+
+// userConnectionResolver resolves one page of a user listing
+type userConnectionResolver struct {
+	r      *resolver
+	users  []models.User
+	next   string
+	filter string
+}
+
+func (c *userConnectionResolver) Users() []*userResolver { return userResolvers(c.users) }
+func (c *userConnectionResolver) NextPageToken() string  { return c.next }
+
+// TotalCount is only counted when the query selects it
+func (c *userConnectionResolver) TotalCount(ctx context.Context) (int32, error) {
+	total, err := c.r.users.CountUsers(ctx, c.filter)
+	if err != nil {
+		return 0, toError(err, "count users")
+	}
+	return int32(total), nil
+}
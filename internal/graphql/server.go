@@ -0,0 +1,53 @@
+// Package graphql serves the user API as GraphQL, on top of the same
+// service layer as the REST and gRPC APIs.
+package graphql
+
+import (
+	"context"
+	_ "embed"
+
+	"github.com/graph-gophers/graphql-go"
+
+	"github.com/114windd/restapi/internal/privacy"
+	"github.com/114windd/restapi/internal/service"
+)
+
+//go:embed schema.graphql
+var schema string
+
+// maxDepth bounds how deeply a query may nest selections
+const maxDepth = 10
+
+// Request is a GraphQL request as sent over HTTP
+type Request struct {
+	Query         string                 `json:"query" binding:"required"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Server executes GraphQL requests
+type Server struct {
+	schema *graphql.Schema
+	users  *service.UserService
+}
+
+// NewServer parses the schema and binds it to the user service. deleteUser
+// erases accounts through privacy like DELETE /me; without it, they are
+// only deleted.
+func NewServer(users *service.UserService, privacy *privacy.Service) *Server {
+	return &Server{
+		schema: graphql.MustParseSchema(schema, &resolver{users: users, privacy: privacy},
+			graphql.UseStringDescriptions(),
+			graphql.MaxDepth(maxDepth),
+		),
+		users: users,
+	}
+}
+
+// Execute runs a request. ctx must carry the caller identity set by the
+// REST authentication middleware. Each request gets its own user loader, so
+// lookups are batched within the request but never cached across callers.
+func (s *Server) Execute(ctx context.Context, req Request) *graphql.Response {
+	ctx = withUserLoader(ctx, newUserLoader(s.users))
+	return s.schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+}
@@ -0,0 +1,55 @@
+package grpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/version"
+	"github.com/114windd/restapi/pkg/proto"
+)
+
+// AdminServer implements the operational AdminService RPCs
+type AdminServer struct {
+	proto.UnimplementedAdminServiceServer
+}
+
+// NewAdminServer creates an AdminServer
+func NewAdminServer() *AdminServer {
+	return &AdminServer{}
+}
+
+// SetLogLevel changes the default log level, keeping per-package levels
+func (s *AdminServer) SetLogLevel(ctx context.Context, req *proto.SetLogLevelRequest) (*proto.SetLogLevelResponse, error) {
+	identity, err := requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := logger.SetDefaultLevel(req.Level)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	level := logger.CurrentLevels().Default
+
+	logger.Log.WithFields(map[string]interface{}{
+		"admin_id":       identity.UserID,
+		"level":          level.String(),
+		"previous_level": previous.String(),
+	}).Warn("Log level changed over gRPC")
+
+	return &proto.SetLogLevelResponse{Level: level.String(), PreviousLevel: previous.String()}, nil
+}
+
+// GetVersion describes the running build; it needs no token
+func (s *AdminServer) GetVersion(ctx context.Context, req *proto.GetVersionRequest) (*proto.GetVersionResponse, error) {
+	info := version.Get()
+	return &proto.GetVersionResponse{
+		Version:   info.Version,
+		Commit:    info.Commit,
+		BuildTime: info.BuildTime,
+		GoVersion: info.GoVersion,
+	}, nil
+}
@@ -0,0 +1,141 @@
+package grpc
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/114windd/restapi/internal/auth"
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/pkg/proto"
+)
+
+// servicePrefix is the start of the full method names of this API's
+// services, as opposed to standard ones such as health checking
+const servicePrefix = "/user."
+
+// publicMethods are the methods of this API callable without a token
+var publicMethods = map[string]bool{
+	proto.UserService_CreateUser_FullMethodName:  true, // signup
+	proto.AdminService_GetVersion_FullMethodName: true,
+}
+
+// AuthInterceptor extracts the caller identity from the "authorization"
+// metadata. Every method of this API requires one except publicMethods;
+// methods check the caller's permissions themselves. The tenant comes from
+// the token, falling back to "x-tenant-id" metadata, which must name one of
+// tenants.
+func AuthInterceptor(tokens *auth.Tokens, tenants []string) grpc.UnaryServerInterceptor {
+	known := make(map[string]bool, len(tenants))
+	for _, tenantID := range tenants {
+		known[tenantID] = true
+	}
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, ok := metadata.FromIncomingContext(ctx)
+		if ok && len(md.Get("x-tenant-id")) > 0 {
+			tenantID := md.Get("x-tenant-id")[0]
+			if !known[tenantID] {
+				return nil, status.Error(codes.InvalidArgument, "unknown tenant")
+			}
+			ctx = database.WithTenant(ctx, tenantID)
+		}
+		if !ok || len(md.Get("authorization")) == 0 {
+			if strings.HasPrefix(info.FullMethod, servicePrefix) && !publicMethods[info.FullMethod] {
+				return nil, status.Error(codes.Unauthenticated, "authorization token required")
+			}
+			return handler(ctx, req)
+		}
+
+		tokenString := strings.TrimPrefix(md.Get("authorization")[0], "Bearer ")
+		identity, err := tokens.Authenticate(ctx, tokenString)
+		if err != nil {
+			logger.Log.WithError(err).Warn("Invalid JWT token in gRPC metadata")
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+
+		ctx = auth.WithIdentity(ctx, identity)
+		if identity.TenantID != "" {
+			ctx = database.WithTenant(ctx, identity.TenantID)
+		}
+		if identity.IsImpersonated() {
+			return handleImpersonated(ctx, req, info, handler, identity)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// readOnlyMethods are the methods of this API impersonation tokens may call
+var readOnlyMethods = map[string]bool{
+	proto.UserService_GetUser_FullMethodName:                   true,
+	proto.UserService_GetUsersByIDs_FullMethodName:             true,
+	proto.UserService_ListUsers_FullMethodName:                 true,
+	proto.UserService_SearchUsers_FullMethodName:               true,
+	proto.UserService_StreamUsers_FullMethodName:               true,
+	proto.AdminService_GetVersion_FullMethodName:               true,
+	proto.OrganizationService_GetOrganization_FullMethodName:   true,
+	proto.OrganizationService_ListOrganizations_FullMethodName: true,
+	proto.OrganizationService_ListMembers_FullMethodName:       true,
+}
+
+// handleImpersonated watermarks the response, refuses every method of this
+// API but readOnlyMethods and audit-logs the call for requests made with an
+// impersonation token
+func handleImpersonated(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler, identity *auth.Identity) (interface{}, error) {
+	_ = grpc.SetHeader(ctx, metadata.Pairs(strings.ToLower(auth.ImpersonationHeader), strconv.FormatUint(uint64(identity.ActorID), 10)))
+
+	if strings.HasPrefix(info.FullMethod, servicePrefix) && !readOnlyMethods[info.FullMethod] {
+		logger.LogImpersonation("blocked", identity.ActorID, identity.UserID).
+			WithField("method", info.FullMethod).
+			Warn("Write blocked during impersonation")
+		return nil, status.Error(codes.PermissionDenied, "not allowed while impersonating a user")
+	}
+
+	resp, err := handler(ctx, req)
+	logger.LogImpersonation("request", identity.ActorID, identity.UserID).
+		WithField("method", info.FullMethod).
+		WithField("code", status.Code(err).String()).
+		Info("Impersonated gRPC call")
+	return resp, err
+}
+
+// authorizeUserModification checks that the caller may modify the target user
+func authorizeUserModification(ctx context.Context, targetID uint) error {
+	identity, ok := auth.IdentityFromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "authorization token required")
+	}
+	if !identity.CanModifyUser(targetID) {
+		logger.Log.WithField("user_id", identity.UserID).
+			WithField("target_user_id", targetID).
+			Warn("Forbidden gRPC attempt to modify another user")
+		return status.Error(codes.PermissionDenied, "not allowed to modify this user")
+	}
+	return nil
+}
+
+// requireIdentity rejects calls made without a token
+func requireIdentity(ctx context.Context) (*auth.Identity, error) {
+	identity, ok := auth.IdentityFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authorization token required")
+	}
+	return identity, nil
+}
+
+// requireAdmin rejects callers without an admin token
+func requireAdmin(ctx context.Context) (*auth.Identity, error) {
+	identity, err := requireIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !identity.IsAdmin() {
+		return nil, status.Error(codes.PermissionDenied, "admin access required")
+	}
+	return identity, nil
+}
@@ -0,0 +1,28 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DeadlineInterceptor caps each call's deadline at timeout, so calls from
+// clients that set no deadline (or a generous one) are bounded like REST
+// requests. A call that fails after its deadline passed reports
+// DEADLINE_EXCEEDED rather than the handler's error.
+func DeadlineInterceptor(timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		resp, err := handler(ctx, req)
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, status.Error(codes.DeadlineExceeded, "request timed out")
+		}
+		return resp, err
+	}
+}
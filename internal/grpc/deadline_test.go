@@ -0,0 +1,59 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDeadlineInterceptor(t *testing.T) {
+	intercept := DeadlineInterceptor(50 * time.Millisecond)
+	info := &grpc.UnaryServerInfo{FullMethod: "/restapi.v1.UserService/GetUser"}
+	errNotFound := status.Error(codes.NotFound, "user not found")
+
+	// Calls without a deadline get one
+	_, _ = intercept(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		if d, ok := ctx.Deadline(); !ok || time.Until(d) > 50*time.Millisecond {
+			t.Errorf("deadline %v, set %v", d, ok)
+		}
+		return nil, nil
+	})
+
+	// A shorter deadline from the client is kept
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	want, _ := ctx.Deadline()
+	_, _ = intercept(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		if d, _ := ctx.Deadline(); !d.Equal(want) {
+			t.Errorf("client deadline %v replaced by %v", want, d)
+		}
+		return nil, nil
+	})
+
+	// A failure after the deadline passed reports the deadline
+	_, err := intercept(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		<-ctx.Done()
+		return nil, errors.New("query: context deadline exceeded")
+	})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("failure after the deadline: %v", err)
+	}
+
+	// Errors and responses in time are passed through
+	if _, err := intercept(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errNotFound
+	}); err != errNotFound {
+		t.Fatalf("error in time: %v", err)
+	}
+	resp, err := intercept(context.Background(), "req", info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return req, nil
+	})
+	if resp != "req" || err != nil {
+		t.Fatalf("response in time: %v, %v", resp, err)
+	}
+}
@@ -0,0 +1,130 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/114windd/restapi/internal/i18n"
+	"github.com/114windd/restapi/internal/validation"
+)
+
+// ErrorDomain identifies this service in google.rpc.ErrorInfo details
+const ErrorDomain = "github.com/114windd/restapi"
+
+// Reasons reported in google.rpc.ErrorInfo details. They are stable, so
+// clients can branch on them instead of parsing messages.
+const (
+	ReasonEmailTaken            = "EMAIL_TAKEN"
+	ReasonEmailDomainNotAllowed = "EMAIL_DOMAIN_NOT_ALLOWED"
+	ReasonVersionConflict       = "VERSION_CONFLICT"
+	ReasonNotAnOwner            = "NOT_AN_OWNER"
+	ReasonAlreadyMember         = "ALREADY_MEMBER"
+	ReasonLastOwner             = "LAST_OWNER"
+)
+
+// acceptLanguageKey is the metadata key clients send their preferred languages in
+const acceptLanguageKey = "accept-language"
+
+// invalidArgument returns an INVALID_ARGUMENT status for err. When err lists
+// rejected fields they are attached as a google.rpc.BadRequest detail, the
+// gRPC counterpart of the REST "fields" array.
+func invalidArgument(err error) error {
+	st := status.New(codes.InvalidArgument, err.Error())
+	fields, ok := validation.Translate(err)
+	if !ok {
+		return st.Err()
+	}
+
+	detail := &errdetails.BadRequest{}
+	for _, f := range fields {
+		detail.FieldViolations = append(detail.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       f.Field,
+			Description: f.Message,
+			Reason:      strings.ToUpper(f.Rule),
+		})
+	}
+	if detailed, err := st.WithDetails(detail); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// failure returns a status carrying a google.rpc.ErrorInfo detail with
+// reason, one of the Reason* constants, and optional metadata about the
+// failure
+func failure(code codes.Code, reason, message string, md map[string]string) error {
+	st := status.New(code, message)
+	if detailed, err := st.WithDetails(&errdetails.ErrorInfo{Reason: reason, Domain: ErrorDomain, Metadata: md}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// LocalizationInterceptor serves clients that send accept-language
+// metadata in their language, stored in the context for i18n.FromContext.
+// The message field of responses is translated. Failures keep their English
+// status message, for logs and programmatic use, and gain a
+// google.rpc.LocalizedMessage detail; the descriptions of BadRequest field
+// violations are translated in place.
+func LocalizationInterceptor(catalog *i18n.Catalog) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, ok := metadata.FromIncomingContext(ctx)
+		if !ok || len(md.Get(acceptLanguageKey)) == 0 {
+			return handler(ctx, req)
+		}
+		lang := catalog.Negotiate(strings.Join(md.Get(acceptLanguageKey), ","))
+
+		resp, err := handler(i18n.WithLanguage(ctx, lang), req)
+		if err != nil {
+			return resp, localizeStatus(catalog, lang, err)
+		}
+		if msg, ok := resp.(protoreflect.ProtoMessage); ok && lang != i18n.Default {
+			m := msg.ProtoReflect()
+			if fd := m.Descriptor().Fields().ByName("message"); fd != nil && fd.Kind() == protoreflect.StringKind && m.Has(fd) {
+				m.Set(fd, protoreflect.ValueOfString(catalog.Translate(lang, m.Get(fd).String())))
+			}
+		}
+		return resp, nil
+	}
+}
+
+// localizeStatus adds a LocalizedMessage detail in lang to a status error
+func localizeStatus(catalog *i18n.Catalog, lang string, err error) error {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() == codes.OK {
+		return err
+	}
+
+	localized := &errdetails.LocalizedMessage{Locale: lang, Message: catalog.Translate(lang, st.Message())}
+	details := make([]protoadapt.MessageV1, 0, len(st.Details())+1)
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.BadRequest:
+			// The status message joins the violations, so translate them one by one
+			descriptions := make([]string, len(d.FieldViolations))
+			for i, v := range d.FieldViolations {
+				v.Description = catalog.Translate(lang, v.Description)
+				descriptions[i] = v.Description
+			}
+			localized.Message = strings.Join(descriptions, "; ")
+			details = append(details, d)
+		case protoadapt.MessageV1:
+			details = append(details, d)
+		}
+	}
+	details = append(details, localized)
+
+	rebuilt, derr := status.New(st.Code(), st.Message()).WithDetails(details...)
+	if derr != nil {
+		return err
+	}
+	return rebuilt.Err()
+}
@@ -2,14 +2,17 @@ package grpc
 
 import (
 	"context"
-	"strings"
-	"time"
+	"errors"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"github.com/114windd/restapi/internal/database"
 	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/privacy"
 	"github.com/114windd/restapi/internal/service"
+	"github.com/114windd/restapi/internal/validation"
 	"github.com/114windd/restapi/pkg/models"
 	"github.com/114windd/restapi/pkg/proto"
 )
@@ -18,42 +21,59 @@ import (
 type GrpcUserService struct {
 	proto.UnimplementedUserServiceServer
 	userService *service.UserService
+	privacy     *privacy.Service // nil: accounts are deleted without erasure
 }
 
 // NewGrpcUserService creates a new gRPC user service
-func NewGrpcUserService() *GrpcUserService {
+func NewGrpcUserService(userService *service.UserService) *GrpcUserService {
 	return &GrpcUserService{
-		userService: &service.UserService{},
+		userService: userService,
 	}
 }
 
+// ConfigurePrivacy makes DeleteUser erase accounts like DELETE /me,
+// anonymizing the records kept about the user and revoking their sessions
+func (s *GrpcUserService) ConfigurePrivacy(p *privacy.Service) {
+	s.privacy = p
+}
+
+// dryRunMessage is returned by mutations called with dry_run set
+const dryRunMessage = "Dry run: request is valid, nothing was changed"
+
 // CreateUser implements the CreateUser gRPC method
 func (s *GrpcUserService) CreateUser(ctx context.Context, req *proto.CreateUserRequest) (*proto.UserResponse, error) {
 	logger.Log.Info("gRPC CreateUser request", "email", req.Email, "name", req.Name)
 
-	// Validate request
-	if req.Name == "" || req.Email == "" || req.Password == "" {
-		return nil, status.Error(codes.InvalidArgument, "name, email, and password are required")
+	// Apply the same rules as REST signups
+	if err := validation.Struct(models.SignupRequest{Name: req.Name, Email: req.Email, Password: req.Password}); err != nil {
+		return nil, invalidArgument(err)
+	}
+
+	if req.DryRun {
+		ctx = database.WithDryRun(ctx)
 	}
 
 	// Use the existing UserService
-	user, err := s.userService.CreateUser(req.Name, req.Email, req.Password)
+	user, err := s.userService.CreateUser(ctx, req.Name, req.Email, req.Password, nil)
 	if err != nil {
-		if strings.Contains(err.Error(), "duplicate key") {
+		if errors.Is(err, service.ErrEmailDomainNotAllowed) {
+			return nil, failure(codes.PermissionDenied, ReasonEmailDomainNotAllowed, err.Error(), nil)
+		}
+		if errors.Is(err, service.ErrInvalidAttributes) {
+			return nil, invalidArgument(err)
+		}
+		if errors.Is(err, service.ErrEmailTaken) {
 			logger.Log.Warn("gRPC CreateUser failed - email already exists", "email", req.Email)
-			return nil, status.Error(codes.AlreadyExists, "email already exists")
+			return nil, failure(codes.AlreadyExists, ReasonEmailTaken, "email already exists", map[string]string{"email": req.Email})
 		}
 		logger.Log.Error("gRPC CreateUser failed", "error", err, "email", req.Email)
 		return nil, status.Error(codes.Internal, "failed to create user")
 	}
 
-	// Convert to ProtoUser
-	protoUser := &proto.ProtoUser{
-		Id:        uint32(user.ID),
-		Name:      user.Name,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt.Format(time.RFC3339),
-		UpdatedAt: user.UpdatedAt.Format(time.RFC3339),
+	protoUser := userToProtoUser(user)
+
+	if req.DryRun {
+		return &proto.UserResponse{User: protoUser, Message: dryRunMessage}, nil
 	}
 
 	logger.Log.Info("gRPC CreateUser success", "user_id", user.ID, "email", req.Email)
@@ -68,20 +88,13 @@ func (s *GrpcUserService) GetUser(ctx context.Context, req *proto.GetUserRequest
 	logger.Log.Info("gRPC GetUser request", "user_id", req.Id)
 
 	// Use the existing UserService
-	user, err := s.userService.GetUser(uint(req.Id))
+	user, err := s.userService.GetUser(ctx, uint(req.Id))
 	if err != nil {
 		logger.Log.Warn("gRPC GetUser failed - user not found", "user_id", req.Id)
 		return nil, status.Error(codes.NotFound, "user not found")
 	}
 
-	// Convert to ProtoUser
-	protoUser := &proto.ProtoUser{
-		Id:        uint32(user.ID),
-		Name:      user.Name,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt.Format(time.RFC3339),
-		UpdatedAt: user.UpdatedAt.Format(time.RFC3339),
-	}
+	protoUser := userToProtoUser(user)
 
 	logger.Log.Info("gRPC GetUser success", "user_id", req.Id)
 	return &proto.UserResponse{
@@ -90,28 +103,68 @@ func (s *GrpcUserService) GetUser(ctx context.Context, req *proto.GetUserRequest
 	}, nil
 }
 
+// GetUsersByIDs implements the GetUsersByIDs gRPC method
+func (s *GrpcUserService) GetUsersByIDs(ctx context.Context, req *proto.GetUsersByIDsRequest) (*proto.GetUsersByIDsResponse, error) {
+	logger.Log.Info("gRPC GetUsersByIDs request", "count", len(req.Ids))
+
+	ids := make([]uint, len(req.Ids))
+	for i, id := range req.Ids {
+		ids[i] = uint(id)
+	}
+	users, missing, err := s.userService.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		if errors.Is(err, service.ErrTooManyIDs) {
+			return nil, status.Errorf(codes.InvalidArgument, "at most %d ids may be requested", service.MaxBatchIDs)
+		}
+		logger.Log.Error("gRPC GetUsersByIDs failed", "error", err)
+		return nil, status.Error(codes.Internal, "failed to get users")
+	}
+
+	resp := &proto.GetUsersByIDsResponse{Users: make([]*proto.ProtoUser, len(users))}
+	for i := range users {
+		resp.Users[i] = userToProtoUser(&users[i])
+	}
+	for _, id := range missing {
+		resp.MissingIds = append(resp.MissingIds, uint32(id))
+	}
+
+	logger.Log.Info("gRPC GetUsersByIDs success", "count", len(users), "missing", len(missing))
+	return resp, nil
+}
+
 // UpdateUser implements the UpdateUser gRPC method
 func (s *GrpcUserService) UpdateUser(ctx context.Context, req *proto.UpdateUserRequest) (*proto.UserResponse, error) {
 	logger.Log.Info("gRPC UpdateUser request", "user_id", req.Id, "name", req.Name, "email", req.Email)
 
-	// Use the existing UserService
-	user, err := s.userService.UpdateUser(uint(req.Id), req.Name, req.Email)
+	if err := authorizeUserModification(ctx, uint(req.Id)); err != nil {
+		return nil, err
+	}
+
+	if req.DryRun {
+		ctx = database.WithDryRun(ctx)
+	}
+
+	user, err := s.userService.UpdateUserMasked(ctx, uint(req.Id), uint(req.Version),
+		models.RestUpdateUserRequest{Name: req.Name, Email: req.Email, Bio: req.Bio, Phone: req.Phone}, updateMask(req))
 	if err != nil {
-		if strings.Contains(err.Error(), "duplicate key") {
+		if errors.Is(err, service.ErrInvalidAttributes) || errors.Is(err, service.ErrInvalidUpdate) {
+			return nil, invalidArgument(err)
+		}
+		if errors.Is(err, service.ErrVersionConflict) {
+			return nil, failure(codes.FailedPrecondition, ReasonVersionConflict, err.Error(), nil)
+		}
+		if errors.Is(err, service.ErrEmailTaken) {
 			logger.Log.Warn("gRPC UpdateUser failed - email already exists", "user_id", req.Id, "email", req.Email)
-			return nil, status.Error(codes.AlreadyExists, "email already exists")
+			return nil, failure(codes.AlreadyExists, ReasonEmailTaken, "email already exists", map[string]string{"email": req.Email})
 		}
 		logger.Log.Error("gRPC UpdateUser failed", "error", err, "user_id", req.Id)
 		return nil, status.Error(codes.Internal, "failed to update user")
 	}
 
-	// Convert to ProtoUser
-	protoUser := &proto.ProtoUser{
-		Id:        uint32(user.ID),
-		Name:      user.Name,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt.Format(time.RFC3339),
-		UpdatedAt: user.UpdatedAt.Format(time.RFC3339),
+	protoUser := userToProtoUser(user)
+
+	if req.DryRun {
+		return &proto.UserResponse{User: protoUser, Message: dryRunMessage}, nil
 	}
 
 	logger.Log.Info("gRPC UpdateUser success", "user_id", req.Id)
@@ -121,17 +174,47 @@ func (s *GrpcUserService) UpdateUser(ctx context.Context, req *proto.UpdateUserR
 	}, nil
 }
 
+// updateMask returns the request's field mask or, when it has none, an
+// implied mask of the fields that are set
+func updateMask(req *proto.UpdateUserRequest) []string {
+	if req.UpdateMask != nil {
+		return req.UpdateMask.GetPaths()
+	}
+	var mask []string
+	for path, value := range map[string]string{"name": req.Name, "email": req.Email, "bio": req.Bio, "phone": req.Phone} {
+		if value != "" {
+			mask = append(mask, path)
+		}
+	}
+	return mask
+}
+
 // DeleteUser implements the DeleteUser gRPC method
 func (s *GrpcUserService) DeleteUser(ctx context.Context, req *proto.DeleteUserRequest) (*proto.DeleteUserResponse, error) {
 	logger.Log.Info("gRPC DeleteUser request", "user_id", req.Id)
 
-	// Use the existing UserService
-	err := s.userService.DeleteUser(uint(req.Id))
+	if err := authorizeUserModification(ctx, uint(req.Id)); err != nil {
+		return nil, err
+	}
+
+	if req.DryRun {
+		ctx = database.WithDryRun(ctx)
+	}
+
+	deleteUser := s.userService.DeleteUser
+	if s.privacy != nil {
+		deleteUser = s.privacy.Erase
+	}
+	err := deleteUser(ctx, uint(req.Id))
 	if err != nil {
 		logger.Log.Error("gRPC DeleteUser failed", "error", err, "user_id", req.Id)
 		return nil, status.Error(codes.Internal, "failed to delete user")
 	}
 
+	if req.DryRun {
+		return &proto.DeleteUserResponse{Message: dryRunMessage}, nil
+	}
+
 	logger.Log.Info("gRPC DeleteUser success", "user_id", req.Id)
 	return &proto.DeleteUserResponse{
 		Message: "User deleted successfully",
@@ -140,29 +223,92 @@ func (s *GrpcUserService) DeleteUser(ctx context.Context, req *proto.DeleteUserR
 
 // ListUsers implements the ListUsers gRPC method
 func (s *GrpcUserService) ListUsers(ctx context.Context, req *proto.ListUsersRequest) (*proto.ListUsersResponse, error) {
-	logger.Log.Info("gRPC ListUsers request")
+	logger.Log.Info("gRPC ListUsers request", "page_size", req.PageSize, "order_by", req.OrderBy, "filter", req.Filter)
 
-	// Use the existing UserService
-	users, err := s.userService.ListUsers()
+	users, next, err := s.userService.ListUsersPage(ctx, service.UserPageRequest{
+		PageSize:  int(req.PageSize),
+		PageToken: req.PageToken,
+		OrderBy:   req.OrderBy,
+		Filter:    req.Filter,
+	})
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidListRequest) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		logger.Log.Error("gRPC ListUsers failed", "error", err)
 		return nil, status.Error(codes.Internal, "failed to list users")
 	}
+	total, err := s.userService.CountUsers(ctx, req.Filter)
+	if err != nil {
+		logger.Log.Error("gRPC ListUsers count failed", "error", err)
+		return nil, status.Error(codes.Internal, "failed to list users")
+	}
 
-	// Convert to ProtoUser slice
 	protoUsers := make([]*proto.ProtoUser, len(users))
-	for i, user := range users {
-		protoUsers[i] = &proto.ProtoUser{
-			Id:        uint32(user.ID),
-			Name:      user.Name,
-			Email:     user.Email,
-			CreatedAt: user.CreatedAt.Format(time.RFC3339),
-			UpdatedAt: user.UpdatedAt.Format(time.RFC3339),
-		}
+	for i := range users {
+		protoUsers[i] = userToProtoUser(&users[i])
 	}
 
 	logger.Log.Info("gRPC ListUsers success", "count", len(users))
 	return &proto.ListUsersResponse{
+		Users:         protoUsers,
+		NextPageToken: next,
+		TotalSize:     total,
+	}, nil
+}
+
+// StreamUsers implements the StreamUsers gRPC method, sending users as
+// they are read from the database
+func (s *GrpcUserService) StreamUsers(req *proto.StreamUsersRequest, stream proto.UserService_StreamUsersServer) error {
+	ctx := stream.Context()
+	if _, err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	if req.Status != "" && !models.ValidUserStatus(req.Status) {
+		return status.Error(codes.InvalidArgument, "status must be active, suspended or deactivated")
+	}
+
+	count := 0
+	err := s.userService.StreamUsers(ctx, req.Status, req.Attributes, func(user *models.User) error {
+		count++
+		return stream.Send(userToProtoUser(user))
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		if _, ok := status.FromError(err); ok {
+			// Sending failed, the stream is gone
+			return err
+		}
+		logger.Log.WithError(err).WithField("count", count).Error("gRPC StreamUsers failed")
+		return status.Error(codes.Internal, "failed to stream users")
+	}
+
+	logger.Log.WithField("count", count).Info("gRPC StreamUsers success")
+	return nil
+}
+
+// SearchUsers implements the SearchUsers gRPC method
+func (s *GrpcUserService) SearchUsers(ctx context.Context, req *proto.SearchUsersRequest) (*proto.SearchUsersResponse, error) {
+	logger.Log.Info("gRPC SearchUsers request", "query", req.Query)
+
+	users, err := s.userService.SearchUsers(ctx, req.Query, int(req.Limit))
+	if err != nil {
+		if errors.Is(err, service.ErrEmptySearchQuery) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		logger.Log.Error("gRPC SearchUsers failed", "error", err)
+		return nil, status.Error(codes.Internal, "failed to search users")
+	}
+
+	protoUsers := make([]*proto.ProtoUser, len(users))
+	for i := range users {
+		protoUsers[i] = userToProtoUser(&users[i])
+	}
+
+	logger.Log.Info("gRPC SearchUsers success", "count", len(users))
+	return &proto.SearchUsersResponse{
 		Users: protoUsers,
 	}, nil
 }
@@ -173,21 +319,22 @@ func userToProtoUser(user *models.User) *proto.ProtoUser {
 		Id:        uint32(user.ID),
 		Name:      user.Name,
 		Email:     user.Email,
-		CreatedAt: user.CreatedAt.Format(time.RFC3339),
-		UpdatedAt: user.UpdatedAt.Format(time.RFC3339),
+		CreatedAt: timestamppb.New(user.CreatedAt),
+		UpdatedAt: timestamppb.New(user.UpdatedAt),
+		Version:   uint32(user.Version),
+		Bio:       user.Bio,
+		Phone:     user.Phone,
+		Status:    user.Status,
 	}
 }
 
 // Helper function to convert ProtoUser to User (if needed)
 func protoUserToUser(protoUser *proto.ProtoUser) *models.User {
-	createdAt, _ := time.Parse(time.RFC3339, protoUser.CreatedAt)
-	updatedAt, _ := time.Parse(time.RFC3339, protoUser.UpdatedAt)
-
 	return &models.User{
 		ID:        uint(protoUser.Id),
 		Name:      protoUser.Name,
 		Email:     protoUser.Email,
-		CreatedAt: createdAt,
-		UpdatedAt: updatedAt,
+		CreatedAt: protoUser.CreatedAt.AsTime(),
+		UpdatedAt: protoUser.UpdatedAt.AsTime(),
 	}
 }
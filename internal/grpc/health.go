@@ -0,0 +1,59 @@
+package grpc
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/pkg/proto"
+)
+
+// healthCheckInterval is how often database connectivity is re-checked
+const healthCheckInterval = 10 * time.Second
+
+// RegisterHealthServer registers the grpc.health.v1.Health service. The
+// overall ("") and UserService statuses follow database connectivity, checked
+// with pingDB, like /healthz. Once ctx is done the checks stop and every
+// status is NOT_SERVING, so load balancers drain the server.
+func RegisterHealthServer(ctx context.Context, s *grpc.Server, pingDB func(ctx context.Context) error) *health.Server {
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(s, healthServer)
+
+	go watchDatabaseHealth(ctx, healthServer, pingDB)
+	return healthServer
+}
+
+// watchDatabaseHealth periodically pings the database and updates the
+// serving status until ctx is done
+func watchDatabaseHealth(ctx context.Context, healthServer *health.Server, pingDB func(ctx context.Context) error) {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	last := healthpb.HealthCheckResponse_UNKNOWN
+	for {
+		servingStatus := healthpb.HealthCheckResponse_SERVING
+		pingCtx, cancel := context.WithTimeout(ctx, healthCheckInterval/2)
+		if err := pingDB(pingCtx); err != nil {
+			servingStatus = healthpb.HealthCheckResponse_NOT_SERVING
+			if last != servingStatus {
+				logger.Log.WithError(err).Warn("gRPC health: database unreachable")
+			}
+		}
+		cancel()
+
+		healthServer.SetServingStatus("", servingStatus)
+		healthServer.SetServingStatus(proto.UserService_ServiceDesc.ServiceName, servingStatus)
+		last = servingStatus
+
+		select {
+		case <-ctx.Done():
+			healthServer.Shutdown()
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package grpc
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestHealthServerStopsOnShutdown(t *testing.T) {
+	ctx, shutdown := context.WithCancel(context.Background())
+	var pings atomic.Int32
+	healthServer := RegisterHealthServer(ctx, grpc.NewServer(), func(context.Context) error {
+		pings.Add(1)
+		return nil
+	})
+
+	check := func() healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := healthServer.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		if err != nil {
+			return healthpb.HealthCheckResponse_UNKNOWN
+		}
+		return resp.Status
+	}
+	waitFor := func(want healthpb.HealthCheckResponse_ServingStatus) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for check() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("health status %v, want %v", check(), want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	waitFor(healthpb.HealthCheckResponse_SERVING)
+	shutdown()
+	waitFor(healthpb.HealthCheckResponse_NOT_SERVING)
+
+	// The watcher has returned, so later updates can't flip the status back
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	if check() != healthpb.HealthCheckResponse_NOT_SERVING || pings.Load() != 1 {
+		t.Fatalf("after shutdown: status %v, %d pings", check(), pings.Load())
+	}
+}
@@ -0,0 +1,59 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/114windd/restapi/internal/auth"
+	"github.com/114windd/restapi/internal/geoip"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/requestid"
+)
+
+// LoggingInterceptor logs each call with its status code and duration, like
+// the REST request log, locating the client with geo when set. It must run
+// after AuthInterceptor to log the caller.
+func LoggingInterceptor(geo *geoip.Locator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		userID := ""
+		if identity, ok := auth.IdentityFromContext(ctx); ok {
+			userID = strconv.FormatUint(uint64(identity.UserID), 10)
+		}
+		code := status.Code(err)
+		ip := clientIP(ctx)
+		entry := logger.LogRequest("GRPC", info.FullMethod, userID).WithFields(map[string]interface{}{
+			"request_id":  requestid.FromContext(ctx),
+			"code":        code.String(),
+			"duration_ms": time.Since(start).Milliseconds(),
+			"client_ip":   ip,
+		}).WithFields(geo.Lookup(ip).LogFields())
+		if err != nil {
+			entry.Warn("Request completed with error")
+		} else {
+			entry.Info("Request completed successfully")
+		}
+		return resp, err
+	}
+}
+
+// clientIP is the address of the caller, without its port
+func clientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
@@ -0,0 +1,215 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/organization"
+	"github.com/114windd/restapi/internal/validation"
+	"github.com/114windd/restapi/pkg/models"
+	"github.com/114windd/restapi/pkg/proto"
+)
+
+// OrganizationServer implements the gRPC OrganizationService
+type OrganizationServer struct {
+	proto.UnimplementedOrganizationServiceServer
+	orgs *organization.Service
+}
+
+// NewOrganizationServer creates an OrganizationServer
+func NewOrganizationServer(orgs *organization.Service) *OrganizationServer {
+	return &OrganizationServer{orgs: orgs}
+}
+
+// CreateOrganization implements the CreateOrganization gRPC method
+func (s *OrganizationServer) CreateOrganization(ctx context.Context, req *proto.CreateOrganizationRequest) (*proto.OrganizationResponse, error) {
+	caller, err := requireIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := validation.Struct(models.CreateOrganizationRequest{Name: req.Name}); err != nil {
+		return nil, invalidArgument(err)
+	}
+
+	org, err := s.orgs.Create(ctx, caller, req.Name)
+	if err != nil {
+		return nil, organizationStatus(err, "failed to create organization")
+	}
+	return &proto.OrganizationResponse{Organization: orgToProto(org), Message: "Organization created successfully"}, nil
+}
+
+// GetOrganization implements the GetOrganization gRPC method
+func (s *OrganizationServer) GetOrganization(ctx context.Context, req *proto.GetOrganizationRequest) (*proto.OrganizationResponse, error) {
+	caller, err := requireIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	org, err := s.orgs.Get(ctx, caller, uint(req.Id))
+	if err != nil {
+		return nil, organizationStatus(err, "failed to get organization")
+	}
+	return &proto.OrganizationResponse{Organization: orgToProto(org), Message: "Organization retrieved successfully"}, nil
+}
+
+// ListOrganizations implements the ListOrganizations gRPC method
+func (s *OrganizationServer) ListOrganizations(ctx context.Context, req *proto.ListOrganizationsRequest) (*proto.ListOrganizationsResponse, error) {
+	caller, err := requireIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	orgs, err := s.orgs.List(ctx, caller)
+	if err != nil {
+		return nil, organizationStatus(err, "failed to list organizations")
+	}
+	resp := &proto.ListOrganizationsResponse{Organizations: make([]*proto.Organization, len(orgs))}
+	for i := range orgs {
+		resp.Organizations[i] = orgToProto(&orgs[i])
+	}
+	return resp, nil
+}
+
+// UpdateOrganization implements the UpdateOrganization gRPC method
+func (s *OrganizationServer) UpdateOrganization(ctx context.Context, req *proto.UpdateOrganizationRequest) (*proto.OrganizationResponse, error) {
+	caller, err := requireIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := validation.Struct(models.UpdateOrganizationRequest{Name: req.Name}); err != nil {
+		return nil, invalidArgument(err)
+	}
+
+	org, err := s.orgs.Rename(ctx, caller, uint(req.Id), req.Name)
+	if err != nil {
+		return nil, organizationStatus(err, "failed to update organization")
+	}
+	return &proto.OrganizationResponse{Organization: orgToProto(org), Message: "Organization updated successfully"}, nil
+}
+
+// DeleteOrganization implements the DeleteOrganization gRPC method
+func (s *OrganizationServer) DeleteOrganization(ctx context.Context, req *proto.DeleteOrganizationRequest) (*proto.DeleteOrganizationResponse, error) {
+	caller, err := requireIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.orgs.Delete(ctx, caller, uint(req.Id)); err != nil {
+		return nil, organizationStatus(err, "failed to delete organization")
+	}
+	return &proto.DeleteOrganizationResponse{Message: "Organization deleted successfully"}, nil
+}
+
+// ListMembers implements the ListMembers gRPC method
+func (s *OrganizationServer) ListMembers(ctx context.Context, req *proto.ListMembersRequest) (*proto.ListMembersResponse, error) {
+	caller, err := requireIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.orgs.Members(ctx, caller, uint(req.OrgId))
+	if err != nil {
+		return nil, organizationStatus(err, "failed to list members")
+	}
+	resp := &proto.ListMembersResponse{Members: make([]*proto.Member, len(members))}
+	for i := range members {
+		resp.Members[i] = memberToProto(&members[i])
+	}
+	return resp, nil
+}
+
+// AddMember implements the AddMember gRPC method
+func (s *OrganizationServer) AddMember(ctx context.Context, req *proto.AddMemberRequest) (*proto.MemberResponse, error) {
+	caller, err := requireIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := validation.Struct(models.AddMemberRequest{UserID: uint(req.UserId), Role: req.Role}); err != nil {
+		return nil, invalidArgument(err)
+	}
+
+	member, err := s.orgs.AddMember(ctx, caller, uint(req.OrgId), uint(req.UserId), req.Role)
+	if err != nil {
+		return nil, organizationStatus(err, "failed to add member")
+	}
+	return &proto.MemberResponse{Member: memberToProto(member), Message: "Member added successfully"}, nil
+}
+
+// UpdateMember implements the UpdateMember gRPC method
+func (s *OrganizationServer) UpdateMember(ctx context.Context, req *proto.UpdateMemberRequest) (*proto.MemberResponse, error) {
+	caller, err := requireIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := validation.Struct(models.UpdateMemberRequest{Role: req.Role}); err != nil {
+		return nil, invalidArgument(err)
+	}
+
+	member, err := s.orgs.SetRole(ctx, caller, uint(req.OrgId), uint(req.UserId), req.Role)
+	if err != nil {
+		return nil, organizationStatus(err, "failed to update member")
+	}
+	return &proto.MemberResponse{Member: memberToProto(member), Message: "Member updated successfully"}, nil
+}
+
+// RemoveMember implements the RemoveMember gRPC method
+func (s *OrganizationServer) RemoveMember(ctx context.Context, req *proto.RemoveMemberRequest) (*proto.RemoveMemberResponse, error) {
+	caller, err := requireIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.orgs.RemoveMember(ctx, caller, uint(req.OrgId), uint(req.UserId)); err != nil {
+		return nil, organizationStatus(err, "failed to remove member")
+	}
+	return &proto.RemoveMemberResponse{Message: "Member removed successfully"}, nil
+}
+
+// organizationStatus maps organization errors to gRPC statuses, as the
+// REST handlers map them to HTTP statuses
+func organizationStatus(err error, message string) error {
+	switch {
+	case errors.Is(err, organization.ErrNotFound):
+		return status.Error(codes.NotFound, "organization not found")
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, organization.ErrForbidden):
+		return failure(codes.PermissionDenied, ReasonNotAnOwner, err.Error(), nil)
+	case errors.Is(err, organization.ErrAlreadyMember):
+		return failure(codes.AlreadyExists, ReasonAlreadyMember, err.Error(), nil)
+	case errors.Is(err, organization.ErrLastOwner):
+		return failure(codes.FailedPrecondition, ReasonLastOwner, err.Error(), nil)
+	}
+	logger.Log.WithError(err).Error("gRPC " + message)
+	return status.Error(codes.Internal, message)
+}
+
+func orgToProto(org *models.Organization) *proto.Organization {
+	return &proto.Organization{
+		Id:        uint32(org.ID),
+		Name:      org.Name,
+		CreatedBy: uint32(org.CreatedBy),
+		CreatedAt: timestamppb.New(org.CreatedAt),
+		UpdatedAt: timestamppb.New(org.UpdatedAt),
+		Role:      org.Role,
+	}
+}
+
+func memberToProto(m *models.Membership) *proto.Member {
+	member := &proto.Member{
+		OrgId:     uint32(m.OrgID),
+		UserId:    uint32(m.UserID),
+		Role:      m.Role,
+		CreatedAt: timestamppb.New(m.CreatedAt),
+	}
+	if m.User != nil {
+		member.User = userToProtoUser(m.User)
+	}
+	return member
+}
@@ -0,0 +1,25 @@
+package grpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DatabaseOutageInterceptor turns internal errors into UNAVAILABLE while
+// unavailable reports the database down, so clients know to retry later
+func DatabaseOutageInterceptor(unavailable func() bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err == nil || !unavailable() {
+			return resp, err
+		}
+		switch status.Code(err) {
+		case codes.Internal, codes.Unknown:
+			return nil, status.Error(codes.Unavailable, "Service temporarily unavailable, try again later")
+		}
+		return resp, err
+	}
+}
@@ -0,0 +1,37 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/router"
+	"github.com/114windd/restapi/pkg/proto"
+)
+
+// RateLimitInterceptor rejects calls over their rate limit class with
+// RESOURCE_EXHAUSTED. Clients are told apart by IP, as on the REST API, and
+// admin methods share the admin class while other methods use the default.
+func RateLimitInterceptor(limiter *router.Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		class := rateLimitClass(info.FullMethod)
+		ip := clientIP(ctx)
+		if !limiter.Allow(ctx, class, ip) {
+			logger.Log.WithField("client_ip", ip).WithField("class", class).WithField("method", info.FullMethod).Warn("Rate limit exceeded")
+			return nil, status.Error(codes.ResourceExhausted, "too many requests")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// rateLimitClass is the rate limit class of a gRPC method
+func rateLimitClass(fullMethod string) string {
+	if strings.HasPrefix(fullMethod, "/"+proto.AdminService_ServiceDesc.ServiceName+"/") {
+		return router.RateLimitAdmin
+	}
+	return router.RateLimitDefault
+}
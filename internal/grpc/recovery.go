@@ -0,0 +1,78 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/114windd/restapi/internal/errorreporting"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/metrics"
+	"github.com/114windd/restapi/internal/requestid"
+)
+
+// serverErrorCodes are the codes REST would report as 5xx
+var serverErrorCodes = map[codes.Code]bool{
+	codes.Unknown:          true,
+	codes.Internal:         true,
+	codes.DataLoss:         true,
+	codes.Unimplemented:    true,
+	codes.Unavailable:      true,
+	codes.DeadlineExceeded: true,
+}
+
+// RecoveryInterceptor turns a panicking handler into an INTERNAL error
+// rather than crashing the server, and reports the panic, and any other
+// server error, to reporter with the call's context. Panics are logged with
+// their stack and counted in panics_recovered_total; the error carries the
+// request ID in a google.rpc.RequestInfo detail so that callers can quote it.
+func RecoveryInterceptor(reporter *errorreporting.Reporter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+
+			stack := debug.Stack()
+			id := requestid.FromContext(ctx)
+			logger.Log.WithFields(map[string]interface{}{
+				"request_id": id,
+				"method":     info.FullMethod,
+				"panic":      fmt.Sprint(recovered),
+				"stack":      string(stack),
+			}).Error("Panic recovered in gRPC call")
+			reporter.Report(ctx, &errorreporting.Event{
+				Err:       fmt.Errorf("panic: %v", recovered),
+				Panic:     recovered,
+				Stack:     stack,
+				Transport: errorreporting.TransportGRPC,
+				Method:    info.FullMethod,
+				Status:    codes.Internal.String(),
+			})
+			metrics.RecordPanic(errorreporting.TransportGRPC, info.FullMethod)
+
+			st := status.New(codes.Internal, "internal server error")
+			if detailed, derr := st.WithDetails(&errdetails.RequestInfo{RequestId: id}); derr == nil {
+				st = detailed
+			}
+			resp, err = nil, st.Err()
+		}()
+
+		resp, err = handler(ctx, req)
+		if code := status.Code(err); serverErrorCodes[code] {
+			reporter.Report(ctx, &errorreporting.Event{
+				Err:       err,
+				Transport: errorreporting.TransportGRPC,
+				Method:    info.FullMethod,
+				Status:    code.String(),
+			})
+		}
+		return resp, err
+	}
+}
@@ -0,0 +1,42 @@
+package grpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/114windd/restapi/internal/config"
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/requestid"
+)
+
+// RequestIDInterceptor assigns each call an ID, reusing the caller's
+// x-request-id metadata when present, and returns it in the response header
+func RequestIDInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var id string
+		if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(requestid.Header)) > 0 {
+			id = md.Get(requestid.Header)[0]
+		}
+		if id == "" {
+			id = requestid.New()
+		}
+
+		_ = grpc.SetHeader(ctx, metadata.Pairs(requestid.Header, id))
+		return handler(requestid.WithID(ctx, id), req)
+	}
+}
+
+// DBSessionInterceptor attaches per-call Postgres session settings to the
+// context. It must run after RequestIDInterceptor.
+func DBSessionInterceptor(cfg config.DatabaseConfig) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		settings := database.SessionSettings{
+			StatementTimeout: cfg.StatementTimeout,
+			ApplicationName:  cfg.ApplicationName + "/" + requestid.FromContext(ctx),
+			Role:             cfg.SessionRole,
+		}
+		return handler(database.WithSessionSettings(ctx, settings), req)
+	}
+}
@@ -0,0 +1,46 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/114windd/restapi/internal/config"
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/requestid"
+)
+
+func TestDBSessionInterceptor(t *testing.T) {
+	cfg := config.DatabaseConfig{StatementTimeout: 3 * time.Second, ApplicationName: "restapi", SessionRole: "app_user"}
+	info := &grpc.UnaryServerInfo{FullMethod: "/user.UserService/GetUser"}
+	requestIDs, sessions := RequestIDInterceptor(), DBSessionInterceptor(cfg)
+
+	var settings database.SessionSettings
+	var ok bool
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return sessions(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			settings, ok = database.SessionSettingsFromContext(ctx)
+			return nil, nil
+		})
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(requestid.Header, "req-42"))
+	if _, err := requestIDs(ctx, nil, info, handler); err != nil {
+		t.Fatal(err)
+	}
+	want := database.SessionSettings{StatementTimeout: 3 * time.Second, ApplicationName: "restapi/req-42", Role: "app_user"}
+	if !ok || settings != want {
+		t.Fatalf("session settings %+v, want %+v", settings, want)
+	}
+
+	// Calls without an ID get a generated one
+	if _, err := requestIDs(context.Background(), nil, info, handler); err != nil {
+		t.Fatal(err)
+	}
+	if len(settings.ApplicationName) != len("restapi/")+32 {
+		t.Fatalf("application name without a request ID: %q", settings.ApplicationName)
+	}
+}
@@ -0,0 +1,38 @@
+package grpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// StreamInterceptor runs unary interceptors around streaming calls, so that
+// request IDs, metrics, authentication and panic recovery apply to them as
+// well. The interceptors see a nil request and response, and the context
+// they pass on becomes the stream's.
+func StreamInterceptor(interceptors ...grpc.UnaryServerInterceptor) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		unaryInfo := &grpc.UnaryServerInfo{Server: srv, FullMethod: info.FullMethod}
+		call := func(ctx context.Context, _ interface{}) (interface{}, error) {
+			return nil, handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+		}
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], call
+			call = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, unaryInfo, next)
+			}
+		}
+		_, err := call(ss.Context(), nil)
+		return err
+	}
+}
+
+// contextStream is a ServerStream with the context the interceptors built
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
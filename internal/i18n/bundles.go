@@ -0,0 +1,10 @@
+package i18n
+
+// builtin are the bundles every catalog starts with, keyed by language.
+// Each translates the same keys: error messages, validation messages and
+// the success messages of the REST and gRPC APIs.
+var builtin = map[string]map[string]string{
+	"es": spanish,
+	"fr": french,
+	"zh": chinese,
+}
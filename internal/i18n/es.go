@@ -0,0 +1,106 @@
+package i18n
+
+// spanish is the Spanish bundle
+var spanish = map[string]string{
+	// Errors
+	"A valid email is required":                           "Se requiere un correo electrónico válido",
+	"Admin access required":                               "Se requiere acceso de administrador",
+	"Authorization header required":                       "Se requiere la cabecera Authorization",
+	"CAPTCHA verification required":                       "Se requiere la verificación CAPTCHA",
+	"Confirm this login with the code sent to your email": "Confirma este inicio de sesión con el código enviado a tu correo electrónico",
+	"Email already exists":                                "El correo electrónico ya existe",
+	"Email already in use":                                "El correo electrónico ya está en uso",
+	"Failed to read request body":                         "No se pudo leer el cuerpo de la solicitud",
+	"If-Match header with the user's ETag is required":    "Se requiere la cabecera If-Match con el ETag del usuario",
+	"If-Match does not match the current version":         "If-Match no coincide con la versión actual",
+	"Internal server error":                               "Error interno del servidor",
+	"Invalid credentials":                                 "Credenciales no válidas",
+	"Invalid or expired code":                             "Código no válido o caducado",
+	"Invalid or expired invitation":                       "Invitación no válida o caducada",
+	"Invalid or expired link":                             "Enlace no válido o caducado",
+	"Invalid or expired recovery token":                   "Token de recuperación no válido o caducado",
+	"Invalid organization ID":                             "ID de organización no válido",
+	"Invalid refresh token":                               "Token de actualización no válido",
+	"Invalid token":                                       "Token no válido",
+	"Invalid two-factor code":                             "Código de doble factor no válido",
+	"Invalid user ID":                                     "ID de usuario no válido",
+	"JSON body has a duplicate key":                       "El cuerpo JSON tiene una clave duplicada",
+	"JSON body is nested too deeply":                      "El cuerpo JSON está anidado demasiado profundamente",
+	"None of the accepted formats is available":           "Ninguno de los formatos aceptados está disponible",
+	"Not allowed to modify this user":                     "No tiene permiso para modificar este usuario",
+	"Not allowed while impersonating a user":              "No permitido mientras se suplanta a un usuario",
+	"Not found":                                           "No encontrado",
+	"Only the current terms of service can be accepted":   "Solo se pueden aceptar los términos del servicio vigentes",
+	"Organization not found":                              "Organización no encontrada",
+	"Request body too large":                              "El cuerpo de la solicitud es demasiado grande",
+	"Service temporarily unavailable, try again later":    "Servicio no disponible temporalmente, inténtelo más tarde",
+	"Session not found":                                   "Sesión no encontrada",
+	"The terms of service have changed; accept the current version to continue": "Los términos del servicio han cambiado; acepte la versión vigente para continuar",
+	"This account has been deactivated":                                         "Esta cuenta ha sido desactivada",
+	"This account has been suspended":                                           "Esta cuenta ha sido suspendida",
+	"This account's invitation has not been accepted yet":                       "La invitación de esta cuenta aún no ha sido aceptada",
+	"Too many codes sent to this phone number, try again later":                 "Se han enviado demasiados códigos a este número, inténtalo más tarde",
+	"Too many failed login attempts, try again later":                           "Demasiados intentos fallidos de inicio de sesión, inténtelo más tarde",
+	"Two-factor code required":                                                  "Se requiere el código de doble factor",
+	"Unknown tenant":                                                            "Inquilino desconocido",
+	"Unsupported Content-Type":                                                  "Content-Type no admitido",
+	"User not found":                                                            "Usuario no encontrado",
+	"User was modified by another request; fetch it again and retry":            "El usuario fue modificado por otra solicitud; vuelva a obtenerlo e inténtelo de nuevo",
+	"Validation failed":                                                         "La validación ha fallado",
+	"admin access required":                                                     "se requiere acceso de administrador",
+	"an organization needs at least one owner":                                  "una organización necesita al menos un propietario",
+	"authorization token required":                                              "se requiere un token de autorización",
+	"email already exists":                                                      "el correo electrónico ya existe",
+	"invalid token":                                                             "token no válido",
+	"not allowed to modify this user":                                           "no tiene permiso para modificar este usuario",
+	"only owners can manage the organization":                                   "solo los propietarios pueden gestionar la organización",
+	"organization not found":                                                    "organización no encontrada",
+	"user is already a member":                                                  "el usuario ya es miembro",
+	"user not found":                                                            "usuario no encontrado",
+	"user was modified by another request":                                      "el usuario fue modificado por otra solicitud",
+
+	// Validation
+	"{field} is required":                                               "{field} es obligatorio",
+	"{field} must be a valid email address":                             "{field} debe ser una dirección de correo electrónico válida",
+	"{field} must be a phone number in E.164 format, e.g. +14155550123": "{field} debe ser un número de teléfono en formato E.164, p. ej. +14155550123",
+	"{field} must be a valid URL":                                       "{field} debe ser una URL válida",
+	"{field} must be at least {n} characters":                           "{field} debe tener al menos {n} caracteres",
+	"{field} must be at least {n}":                                      "{field} debe ser como mínimo {n}",
+	"{field} must be at most {n} characters":                            "{field} debe tener como máximo {n} caracteres",
+	"{field} must be at most {n}":                                       "{field} debe ser como máximo {n}",
+	"{field} must be exactly {n} characters":                            "{field} debe tener exactamente {n} caracteres",
+	"{field} must be one of: {values}":                                  "{field} debe ser uno de: {values}",
+	"{field} must be a {kind}":                                          "{field} debe ser de tipo {kind}",
+	"{field} failed the {rule} rule":                                    "{field} no cumple la regla {rule}",
+
+	// Success
+	"Account deactivated successfully":               "Cuenta desactivada correctamente",
+	"Avatar deleted successfully":                    "Avatar eliminado correctamente",
+	"Avatar updated successfully":                    "Avatar actualizado correctamente",
+	"Credentials reset":                              "Credenciales restablecidas",
+	"Dry run: request is valid, nothing was changed": "Simulación: la solicitud es válida, no se ha cambiado nada",
+	"Export started":                                 "Exportación iniciada",
+	"Invitation resent":                              "Invitación reenviada",
+	"Invitation sent":                                "Invitación enviada",
+	"Logged out successfully":                        "Sesión cerrada correctamente",
+	"Member added successfully":                      "Miembro añadido correctamente",
+	"Member removed successfully":                    "Miembro eliminado correctamente",
+	"Member updated successfully":                    "Miembro actualizado correctamente",
+	"Organization created successfully":              "Organización creada correctamente",
+	"Organization deleted successfully":              "Organización eliminada correctamente",
+	"Organization retrieved successfully":            "Organización obtenida correctamente",
+	"Organization updated successfully":              "Organización actualizada correctamente",
+	"Password updated, you can now log in":           "Contraseña actualizada, ya puede iniciar sesión",
+	"Phone number verified":                          "Número de teléfono verificado",
+	"Preferences updated successfully":               "Preferencias actualizadas correctamente",
+	"Recovery case opened":                           "Caso de recuperación abierto",
+	"Session revoked successfully":                   "Sesión revocada correctamente",
+	"Sessions revoked successfully":                  "Sesiones revocadas correctamente",
+	"Two-factor authentication disabled":             "Autenticación de doble factor desactivada",
+	"Two-factor authentication enabled":              "Autenticación de doble factor activada",
+	"User created successfully":                      "Usuario creado correctamente",
+	"User deleted successfully":                      "Usuario eliminado correctamente",
+	"User retrieved successfully":                    "Usuario obtenido correctamente",
+	"User updated successfully":                      "Usuario actualizado correctamente",
+	"Verification code sent":                         "Código de verificación enviado",
+}
@@ -0,0 +1,106 @@
+package i18n
+
+// french is the French bundle
+var french = map[string]string{
+	// Errors
+	"A valid email is required":                           "Une adresse e-mail valide est requise",
+	"Admin access required":                               "Accès administrateur requis",
+	"Authorization header required":                       "En-tête Authorization requis",
+	"CAPTCHA verification required":                       "Vérification CAPTCHA requise",
+	"Confirm this login with the code sent to your email": "Confirmez cette connexion avec le code envoyé à votre adresse e-mail",
+	"Email already exists":                                "L'adresse e-mail existe déjà",
+	"Email already in use":                                "L'adresse e-mail est déjà utilisée",
+	"Failed to read request body":                         "Impossible de lire le corps de la requête",
+	"If-Match header with the user's ETag is required":    "L'en-tête If-Match avec l'ETag de l'utilisateur est requis",
+	"If-Match does not match the current version":         "If-Match ne correspond pas à la version actuelle",
+	"Internal server error":                               "Erreur interne du serveur",
+	"Invalid credentials":                                 "Identifiants invalides",
+	"Invalid or expired code":                             "Code invalide ou expiré",
+	"Invalid or expired invitation":                       "Invitation invalide ou expirée",
+	"Invalid or expired link":                             "Lien invalide ou expiré",
+	"Invalid or expired recovery token":                   "Jeton de récupération invalide ou expiré",
+	"Invalid organization ID":                             "ID d'organisation invalide",
+	"Invalid refresh token":                               "Jeton de rafraîchissement invalide",
+	"Invalid token":                                       "Jeton invalide",
+	"Invalid two-factor code":                             "Code à deux facteurs invalide",
+	"Invalid user ID":                                     "ID d'utilisateur invalide",
+	"JSON body has a duplicate key":                       "Le corps JSON contient une clé en double",
+	"JSON body is nested too deeply":                      "Le corps JSON est trop profondément imbriqué",
+	"None of the accepted formats is available":           "Aucun des formats acceptés n'est disponible",
+	"Not allowed to modify this user":                     "Vous n'êtes pas autorisé à modifier cet utilisateur",
+	"Not allowed while impersonating a user":              "Non autorisé lorsque vous agissez en tant qu'un autre utilisateur",
+	"Not found":                                           "Introuvable",
+	"Only the current terms of service can be accepted":   "Seules les conditions d'utilisation en vigueur peuvent être acceptées",
+	"Organization not found":                              "Organisation introuvable",
+	"Request body too large":                              "Corps de la requête trop volumineux",
+	"Service temporarily unavailable, try again later":    "Service momentanément indisponible, réessayez plus tard",
+	"Session not found":                                   "Session introuvable",
+	"The terms of service have changed; accept the current version to continue": "Les conditions d'utilisation ont changé ; acceptez la version en vigueur pour continuer",
+	"This account has been deactivated":                                         "Ce compte a été désactivé",
+	"This account has been suspended":                                           "Ce compte a été suspendu",
+	"This account's invitation has not been accepted yet":                       "L'invitation de ce compte n'a pas encore été acceptée",
+	"Too many codes sent to this phone number, try again later":                 "Trop de codes envoyés à ce numéro, réessayez plus tard",
+	"Too many failed login attempts, try again later":                           "Trop de tentatives de connexion échouées, réessayez plus tard",
+	"Two-factor code required":                                                  "Code à deux facteurs requis",
+	"Unknown tenant":                                                            "Locataire inconnu",
+	"Unsupported Content-Type":                                                  "Content-Type non pris en charge",
+	"User not found":                                                            "Utilisateur introuvable",
+	"User was modified by another request; fetch it again and retry":            "L'utilisateur a été modifié par une autre requête ; récupérez-le à nouveau et réessayez",
+	"Validation failed":                                                         "La validation a échoué",
+	"admin access required":                                                     "accès administrateur requis",
+	"an organization needs at least one owner":                                  "une organisation doit avoir au moins un propriétaire",
+	"authorization token required":                                              "jeton d'autorisation requis",
+	"email already exists":                                                      "l'adresse e-mail existe déjà",
+	"invalid token":                                                             "jeton invalide",
+	"not allowed to modify this user":                                           "vous n'êtes pas autorisé à modifier cet utilisateur",
+	"only owners can manage the organization":                                   "seuls les propriétaires peuvent gérer l'organisation",
+	"organization not found":                                                    "organisation introuvable",
+	"user is already a member":                                                  "l'utilisateur est déjà membre",
+	"user not found":                                                            "utilisateur introuvable",
+	"user was modified by another request":                                      "l'utilisateur a été modifié par une autre requête",
+
+	// Validation
+	"{field} is required":                                               "{field} est obligatoire",
+	"{field} must be a valid email address":                             "{field} doit être une adresse e-mail valide",
+	"{field} must be a phone number in E.164 format, e.g. +14155550123": "{field} doit être un numéro de téléphone au format E.164, par ex. +14155550123",
+	"{field} must be a valid URL":                                       "{field} doit être une URL valide",
+	"{field} must be at least {n} characters":                           "{field} doit contenir au moins {n} caractères",
+	"{field} must be at least {n}":                                      "{field} doit être au moins {n}",
+	"{field} must be at most {n} characters":                            "{field} doit contenir au plus {n} caractères",
+	"{field} must be at most {n}":                                       "{field} doit être au plus {n}",
+	"{field} must be exactly {n} characters":                            "{field} doit contenir exactement {n} caractères",
+	"{field} must be one of: {values}":                                  "{field} doit être l'une des valeurs : {values}",
+	"{field} must be a {kind}":                                          "{field} doit être de type {kind}",
+	"{field} failed the {rule} rule":                                    "{field} ne respecte pas la règle {rule}",
+
+	// Success
+	"Account deactivated successfully":               "Compte désactivé",
+	"Avatar deleted successfully":                    "Avatar supprimé",
+	"Avatar updated successfully":                    "Avatar mis à jour",
+	"Credentials reset":                              "Identifiants réinitialisés",
+	"Dry run: request is valid, nothing was changed": "Simulation : la requête est valide, rien n'a été modifié",
+	"Export started":                                 "Export démarré",
+	"Invitation resent":                              "Invitation renvoyée",
+	"Invitation sent":                                "Invitation envoyée",
+	"Logged out successfully":                        "Déconnexion réussie",
+	"Member added successfully":                      "Membre ajouté",
+	"Member removed successfully":                    "Membre retiré",
+	"Member updated successfully":                    "Membre mis à jour",
+	"Organization created successfully":              "Organisation créée",
+	"Organization deleted successfully":              "Organisation supprimée",
+	"Organization retrieved successfully":            "Organisation récupérée",
+	"Organization updated successfully":              "Organisation mise à jour",
+	"Password updated, you can now log in":           "Mot de passe mis à jour, vous pouvez maintenant vous connecter",
+	"Phone number verified":                          "Numéro de téléphone vérifié",
+	"Preferences updated successfully":               "Préférences mises à jour",
+	"Recovery case opened":                           "Demande de récupération ouverte",
+	"Session revoked successfully":                   "Session révoquée",
+	"Sessions revoked successfully":                  "Sessions révoquées",
+	"Two-factor authentication disabled":             "Authentification à deux facteurs désactivée",
+	"Two-factor authentication enabled":              "Authentification à deux facteurs activée",
+	"User created successfully":                      "Utilisateur créé",
+	"User deleted successfully":                      "Utilisateur supprimé",
+	"User retrieved successfully":                    "Utilisateur récupéré",
+	"User updated successfully":                      "Utilisateur mis à jour",
+	"Verification code sent":                         "Code de vérification envoyé",
+}
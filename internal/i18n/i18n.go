@@ -0,0 +1,172 @@
+// Package i18n translates API messages into the caller's language.
+// Messages are written in English in the code and translations are looked
+// up by that text, so a message missing from a bundle is returned in
+// English rather than lost.
+//
+// A bundle key may contain {placeholders} to translate messages built with
+// fmt, e.g. "{field} is required": the values they match are carried over
+// into the translation untranslated.
+package i18n
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// Default is the language messages are written in
+const Default = "en"
+
+// placeholderPattern matches the {name} placeholders of templated messages
+var placeholderPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+// template translates the messages matching a templated key
+type template struct {
+	pattern     *regexp.Regexp
+	names       []string
+	translation string
+	literal     int // length of the key without placeholders, to try specific keys first
+}
+
+// bundle holds the translations of one language
+type bundle struct {
+	messages  map[string]string
+	templates []template
+}
+
+// Catalog holds a bundle of translations per language
+type Catalog struct {
+	languages []string
+	matcher   language.Matcher
+	bundles   map[string]*bundle
+}
+
+// NewCatalog creates a Catalog with the built-in bundles
+func NewCatalog() *Catalog {
+	c := &Catalog{bundles: make(map[string]*bundle)}
+	c.Add(Default, nil)
+	langs := make([]string, 0, len(builtin))
+	for lang := range builtin {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	for _, lang := range langs {
+		c.Add(lang, builtin[lang])
+	}
+	return c
+}
+
+// Add registers translations for lang, a BCP 47 tag such as "es", merging
+// them into any already registered. Call it before the catalog is used.
+func (c *Catalog) Add(lang string, messages map[string]string) {
+	b, ok := c.bundles[lang]
+	if !ok {
+		b = &bundle{messages: make(map[string]string, len(messages))}
+		c.bundles[lang] = b
+		c.languages = append(c.languages, lang)
+	}
+	for message, translation := range messages {
+		if placeholderPattern.MatchString(message) {
+			b.templates = append(b.templates, compile(message, translation))
+		} else {
+			b.messages[message] = translation
+		}
+	}
+	sort.SliceStable(b.templates, func(i, j int) bool { return b.templates[i].literal > b.templates[j].literal })
+
+	// The default language comes first so the matcher falls back to it
+	tags := []language.Tag{language.Make(Default)}
+	for _, l := range c.languages {
+		if l != Default {
+			tags = append(tags, language.Make(l))
+		}
+	}
+	c.matcher = language.NewMatcher(tags)
+}
+
+// compile turns a templated key into a pattern matching whole messages
+func compile(key, translation string) template {
+	t := template{translation: translation, literal: len(placeholderPattern.ReplaceAllString(key, ""))}
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	last := 0
+	for _, loc := range placeholderPattern.FindAllStringSubmatchIndex(key, -1) {
+		pattern.WriteString(regexp.QuoteMeta(key[last:loc[0]]))
+		pattern.WriteString("(.+?)")
+		t.names = append(t.names, key[loc[2]:loc[3]])
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(key[last:]))
+	pattern.WriteString("$")
+	t.pattern = regexp.MustCompile(pattern.String())
+	return t
+}
+
+// Languages returns the languages with a bundle, the default first
+func (c *Catalog) Languages() []string {
+	langs := []string{Default}
+	for _, l := range c.languages {
+		if l != Default {
+			langs = append(langs, l)
+		}
+	}
+	return langs
+}
+
+// Negotiate picks the supported language that best matches an
+// Accept-Language header, and the default when none does
+func (c *Catalog) Negotiate(acceptLanguage string) string {
+	if acceptLanguage == "" {
+		return Default
+	}
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return Default
+	}
+	_, index, confidence := c.matcher.Match(tags...)
+	if confidence == language.No {
+		return Default
+	}
+	return c.Languages()[index]
+}
+
+// Translate returns message in lang, or message itself when it has no translation
+func (c *Catalog) Translate(lang, message string) string {
+	b, ok := c.bundles[lang]
+	if !ok {
+		return message
+	}
+	if translated, ok := b.messages[message]; ok {
+		return translated
+	}
+	for _, t := range b.templates {
+		match := t.pattern.FindStringSubmatch(message)
+		if match == nil {
+			continue
+		}
+		translated := t.translation
+		for i, name := range t.names {
+			translated = strings.ReplaceAll(translated, "{"+name+"}", match[i+1])
+		}
+		return translated
+	}
+	return message
+}
+
+type contextKey struct{}
+
+// WithLanguage returns a context carrying the language negotiated for a request
+func WithLanguage(ctx context.Context, lang string) context.Context {
+	return context.WithValue(ctx, contextKey{}, lang)
+}
+
+// FromContext returns the language negotiated for a request, or Default
+func FromContext(ctx context.Context) string {
+	if lang, ok := ctx.Value(contextKey{}).(string); ok {
+		return lang
+	}
+	return Default
+}
@@ -0,0 +1,77 @@
+package i18n
+
+import "testing"
+
+func TestNegotiate(t *testing.T) {
+	c := NewCatalog()
+
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "", want: "en"},
+		{header: "es", want: "es"},
+		{header: "es-MX,es;q=0.9,en;q=0.8", want: "es"},
+		{header: "de-DE,es;q=0.5", want: "es"},
+		{header: "en-GB,es;q=0.5", want: "en"},
+		{header: "de", want: "en"},
+		{header: "zh-CN", want: "zh"},
+		{header: "fr-CA;q=0.8,zh-CN;q=0.9", want: "zh"},
+		{header: "not a language!", want: "en"},
+	}
+	for _, tt := range tests {
+		if got := c.Negotiate(tt.header); got != tt.want {
+			t.Errorf("Negotiate(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	c := NewCatalog()
+	c.Add("es", map[string]string{"Widget not found": "Artilugio no encontrado"})
+
+	if got := c.Translate("es", "User not found"); got != "Usuario no encontrado" {
+		t.Errorf("built-in message: got %q", got)
+	}
+	if got := c.Translate("es", "Widget not found"); got != "Artilugio no encontrado" {
+		t.Errorf("added message: got %q", got)
+	}
+	if got := c.Translate("es", "Something unexpected"); got != "Something unexpected" {
+		t.Errorf("untranslated message: got %q", got)
+	}
+	if got := c.Translate("en", "User not found"); got != "User not found" {
+		t.Errorf("default language: got %q", got)
+	}
+}
+
+func TestTranslateTemplates(t *testing.T) {
+	c := NewCatalog()
+
+	tests := []struct {
+		lang, message, want string
+	}{
+		{lang: "fr", message: "email is required", want: "email est obligatoire"},
+		{lang: "es", message: "password must be at least 8 characters", want: "password debe tener al menos 8 caracteres"},
+		{lang: "es", message: "page_size must be at least 1", want: "page_size debe ser como mínimo 1"},
+		{lang: "zh", message: "role must be one of: user, admin", want: "role 必须是以下值之一：user, admin"},
+		{lang: "fr", message: "attributes.plan must be a valid URL", want: "attributes.plan doit être une URL valide"},
+	}
+	for _, tt := range tests {
+		if got := c.Translate(tt.lang, tt.message); got != tt.want {
+			t.Errorf("Translate(%q, %q) = %q, want %q", tt.lang, tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestBundlesAreComplete(t *testing.T) {
+	for lang, messages := range builtin {
+		for message := range spanish {
+			if _, ok := messages[message]; !ok {
+				t.Errorf("%s bundle lacks %q", lang, message)
+			}
+		}
+		if len(messages) != len(spanish) {
+			t.Errorf("%s bundle has %d messages, es has %d", lang, len(messages), len(spanish))
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package i18n
+
+// chinese is the Simplified Chinese bundle
+var chinese = map[string]string{
+	// Errors
+	"A valid email is required":                           "需要有效的电子邮件地址",
+	"Admin access required":                               "需要管理员权限",
+	"Authorization header required":                       "需要 Authorization 请求头",
+	"CAPTCHA verification required":                       "需要进行 CAPTCHA 验证",
+	"Confirm this login with the code sent to your email": "请使用发送到您邮箱的验证码确认此次登录",
+	"Email already exists":                                "电子邮件地址已存在",
+	"Email already in use":                                "电子邮件地址已被使用",
+	"Failed to read request body":                         "无法读取请求体",
+	"If-Match header with the user's ETag is required":    "需要包含用户 ETag 的 If-Match 请求头",
+	"If-Match does not match the current version":         "If-Match 与当前版本不匹配",
+	"Internal server error":                               "服务器内部错误",
+	"Invalid credentials":                                 "凭据无效",
+	"Invalid or expired code":                             "验证码无效或已过期",
+	"Invalid or expired invitation":                       "邀请无效或已过期",
+	"Invalid or expired link":                             "链接无效或已过期",
+	"Invalid or expired recovery token":                   "恢复令牌无效或已过期",
+	"Invalid organization ID":                             "组织 ID 无效",
+	"Invalid refresh token":                               "刷新令牌无效",
+	"Invalid token":                                       "令牌无效",
+	"Invalid two-factor code":                             "双重验证码无效",
+	"Invalid user ID":                                     "用户 ID 无效",
+	"JSON body has a duplicate key":                       "JSON 请求体包含重复的键",
+	"JSON body is nested too deeply":                      "JSON 请求体嵌套过深",
+	"None of the accepted formats is available":           "没有可用的可接受格式",
+	"Not allowed to modify this user":                     "无权修改此用户",
+	"Not allowed while impersonating a user":              "模拟用户时不允许此操作",
+	"Not found":                                           "未找到",
+	"Only the current terms of service can be accepted":   "只能接受当前版本的服务条款",
+	"Organization not found":                              "未找到组织",
+	"Request body too large":                              "请求体过大",
+	"Service temporarily unavailable, try again later":    "服务暂时不可用，请稍后重试",
+	"Session not found":                                   "未找到会话",
+	"The terms of service have changed; accept the current version to continue": "服务条款已更新，请接受当前版本后继续",
+	"This account has been deactivated":                                         "此帐户已停用",
+	"This account has been suspended":                                           "此帐户已被暂停",
+	"This account's invitation has not been accepted yet":                       "此帐户的邀请尚未被接受",
+	"Too many codes sent to this phone number, try again later":                 "发送到此号码的验证码过多，请稍后再试",
+	"Too many failed login attempts, try again later":                           "登录失败次数过多，请稍后再试",
+	"Two-factor code required":                                                  "需要双重验证码",
+	"Unknown tenant":                                                            "未知租户",
+	"Unsupported Content-Type":                                                  "不支持的 Content-Type",
+	"User not found":                                                            "未找到用户",
+	"User was modified by another request; fetch it again and retry":            "用户已被其他请求修改，请重新获取后重试",
+	"Validation failed":                                                         "验证失败",
+	"admin access required":                                                     "需要管理员权限",
+	"an organization needs at least one owner":                                  "组织至少需要一名所有者",
+	"authorization token required":                                              "需要授权令牌",
+	"email already exists":                                                      "电子邮件地址已存在",
+	"invalid token":                                                             "令牌无效",
+	"not allowed to modify this user":                                           "无权修改此用户",
+	"only owners can manage the organization":                                   "只有所有者可以管理该组织",
+	"organization not found":                                                    "未找到组织",
+	"user is already a member":                                                  "该用户已是成员",
+	"user not found":                                                            "未找到用户",
+	"user was modified by another request":                                      "用户已被其他请求修改",
+
+	// Validation
+	"{field} is required":                                               "{field} 为必填项",
+	"{field} must be a valid email address":                             "{field} 必须是有效的电子邮件地址",
+	"{field} must be a phone number in E.164 format, e.g. +14155550123": "{field} 必须是 E.164 格式的电话号码，例如 +14155550123",
+	"{field} must be a valid URL":                                       "{field} 必须是有效的 URL",
+	"{field} must be at least {n} characters":                           "{field} 至少需要 {n} 个字符",
+	"{field} must be at least {n}":                                      "{field} 不能小于 {n}",
+	"{field} must be at most {n} characters":                            "{field} 最多只能有 {n} 个字符",
+	"{field} must be at most {n}":                                       "{field} 不能大于 {n}",
+	"{field} must be exactly {n} characters":                            "{field} 必须正好是 {n} 个字符",
+	"{field} must be one of: {values}":                                  "{field} 必须是以下值之一：{values}",
+	"{field} must be a {kind}":                                          "{field} 的类型必须是 {kind}",
+	"{field} failed the {rule} rule":                                    "{field} 未通过 {rule} 规则",
+
+	// Success
+	"Account deactivated successfully":               "帐户已停用",
+	"Avatar deleted successfully":                    "头像已删除",
+	"Avatar updated successfully":                    "头像已更新",
+	"Credentials reset":                              "凭据已重置",
+	"Dry run: request is valid, nothing was changed": "试运行：请求有效，未做任何更改",
+	"Export started":                                 "导出已开始",
+	"Invitation resent":                              "邀请已重新发送",
+	"Invitation sent":                                "邀请已发送",
+	"Logged out successfully":                        "已成功退出登录",
+	"Member added successfully":                      "成员已添加",
+	"Member removed successfully":                    "成员已移除",
+	"Member updated successfully":                    "成员已更新",
+	"Organization created successfully":              "组织已创建",
+	"Organization deleted successfully":              "组织已删除",
+	"Organization retrieved successfully":            "已获取组织",
+	"Organization updated successfully":              "组织已更新",
+	"Password updated, you can now log in":           "密码已更新，现在可以登录",
+	"Phone number verified":                          "手机号码已验证",
+	"Preferences updated successfully":               "偏好设置已更新",
+	"Recovery case opened":                           "已创建恢复请求",
+	"Session revoked successfully":                   "会话已撤销",
+	"Sessions revoked successfully":                  "会话已全部撤销",
+	"Two-factor authentication disabled":             "双重验证已停用",
+	"Two-factor authentication enabled":              "双重验证已启用",
+	"User created successfully":                      "用户已创建",
+	"User deleted successfully":                      "用户已删除",
+	"User retrieved successfully":                    "已获取用户",
+	"User updated successfully":                      "用户已更新",
+	"Verification code sent":                         "验证码已发送",
+}
@@ -0,0 +1,195 @@
+// Package invitation lets admins create accounts for other people. The
+// account is created with status invited and the invitee is emailed a
+// single-use token to activate it with a password of their choosing.
+package invitation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/mail"
+	"github.com/114windd/restapi/internal/service"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+var (
+	// ErrInvalidToken is returned for unknown, used or expired invitation tokens
+	ErrInvalidToken = errors.New("invalid or expired invitation")
+	// ErrAlreadyAccepted is returned when resending an invitation that was accepted
+	ErrAlreadyAccepted = errors.New("invitation already accepted")
+)
+
+// Store persists invitations
+type Store interface {
+	CreateInvitation(ctx context.Context, inv *models.Invitation) error
+	FindInvitation(ctx context.Context, id uint) (*models.Invitation, error)
+	ClaimInvitation(ctx context.Context, tokenHash string, now time.Time) (*models.Invitation, error)
+	ListInvitations(ctx context.Context, status string) ([]models.Invitation, error)
+	UpdateInvitation(ctx context.Context, inv *models.Invitation) error
+}
+
+// Service creates, resends and accepts invitations
+type Service struct {
+	store  Store
+	users  *service.UserService
+	mailer mail.Mailer
+	ttl    time.Duration
+}
+
+// NewService creates a Service whose invitations are valid for ttl after
+// they are sent
+func NewService(store Store, users *service.UserService, mailer mail.Mailer, ttl time.Duration) *Service {
+	return &Service{store: store, users: users, mailer: mailer, ttl: ttl}
+}
+
+// Invite creates an invited account and emails the invitee. The token is
+// returned for callers that deliver it another way.
+func (s *Service) Invite(ctx context.Context, actorID uint, req models.CreateInvitationRequest) (*models.Invitation, string, error) {
+	user, err := s.users.CreateInvitedUser(ctx, req.Name, req.Email, req.Role, req.Attributes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	inv := &models.Invitation{
+		UserID:     user.ID,
+		TenantID:   user.TenantID,
+		Email:      user.Email,
+		Status:     models.InvitationPending,
+		InvitedBy:  actorID,
+		TokenHash:  hashToken(token),
+		ExpiresAt:  now.Add(s.ttl),
+		SentCount:  1,
+		LastSentAt: now,
+	}
+	if err := s.store.CreateInvitation(ctx, inv); err != nil {
+		return nil, "", err
+	}
+
+	s.send(ctx, inv, user.Name, token)
+	logger.Log.WithField("invitation_id", inv.ID).WithField("user_id", user.ID).WithField("admin_id", actorID).Info("User invited")
+	return inv, token, nil
+}
+
+// Resend replaces an invitation's token, which invalidates the one sent
+// before, restarts its expiry and emails the invitee again
+func (s *Service) Resend(ctx context.Context, id uint) (*models.Invitation, string, error) {
+	inv, err := s.store.FindInvitation(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if inv.Status == models.InvitationAccepted {
+		return nil, "", ErrAlreadyAccepted
+	}
+	user, err := s.users.GetUser(ctx, inv.UserID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	inv.TokenHash = hashToken(token)
+	inv.ExpiresAt = now.Add(s.ttl)
+	inv.SentCount++
+	inv.LastSentAt = now
+	if err := s.store.UpdateInvitation(ctx, inv); err != nil {
+		return nil, "", err
+	}
+
+	s.send(ctx, inv, user.Name, token)
+	return withStatus(*inv, now), token, nil
+}
+
+// Accept activates the invited account with the password the invitee
+// chose, and their name when not empty. Tokens work once.
+func (s *Service) Accept(ctx context.Context, token, name, password string) (*models.User, error) {
+	inv, err := s.store.ClaimInvitation(ctx, hashToken(token), time.Now())
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	user, err := s.users.ActivateInvitedUser(ctx, inv.UserID, name, password)
+	if err != nil {
+		return nil, fmt.Errorf("activate invited user: %w", err)
+	}
+	logger.Log.WithField("invitation_id", inv.ID).WithField("user_id", user.ID).Info("Invitation accepted")
+	return user, nil
+}
+
+// Get returns an invitation
+func (s *Service) Get(ctx context.Context, id uint) (*models.Invitation, error) {
+	inv, err := s.store.FindInvitation(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return withStatus(*inv, time.Now()), nil
+}
+
+// List returns invitations, newest first, optionally only those in status
+// (pending, accepted or expired)
+func (s *Service) List(ctx context.Context, status string) ([]models.Invitation, error) {
+	stored := status
+	if status == models.InvitationExpired {
+		stored = models.InvitationPending
+	}
+	invitations, err := s.store.ListInvitations(ctx, stored)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	filtered := invitations[:0]
+	for _, inv := range invitations {
+		inv = *withStatus(inv, now)
+		if status == "" || inv.Status == status {
+			filtered = append(filtered, inv)
+		}
+	}
+	return filtered, nil
+}
+
+// send emails an invitation; a failure is logged since the invitation can be resent
+func (s *Service) send(ctx context.Context, inv *models.Invitation, name, token string) {
+	msg := mail.Message{
+		To:       inv.Email,
+		Template: mail.TemplateInvite,
+		Data:     mail.InviteData{Name: name, Code: token, ExpiresAt: inv.ExpiresAt},
+	}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		logger.Log.WithError(err).WithField("invitation_id", inv.ID).Warn("Failed to mail invitation")
+	}
+}
+
+// withStatus reports a pending invitation past its expiry as expired
+func withStatus(inv models.Invitation, now time.Time) *models.Invitation {
+	if inv.Status == models.InvitationPending && !inv.ExpiresAt.After(now) {
+		inv.Status = models.InvitationExpired
+	}
+	return &inv
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,64 @@
+// Package listen opens the server's listeners from configured addresses.
+package listen
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+)
+
+// unixPrefix marks an address as a unix socket path
+const unixPrefix = "unix:"
+
+// Listen listens on addr: host:port for TCP, or unix:/path/to.sock for a
+// unix socket. A socket file left behind by a previous run is replaced, as
+// long as nothing is accepting on it.
+func Listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, unixPrefix)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if path == "" {
+		return nil, errors.New("unix socket address has no path")
+	}
+
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// Let a reverse proxy running as another user in the same group connect
+	if err := os.Chmod(path, 0o660); err != nil {
+		lis.Close()
+		return nil, err
+	}
+	return lis, nil
+}
+
+// IsUnix reports whether addr names a unix socket
+func IsUnix(addr string) bool {
+	return strings.HasPrefix(addr, unixPrefix)
+}
+
+func removeStaleSocket(path string) error {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use", path)
+	}
+	return os.Remove(path)
+}
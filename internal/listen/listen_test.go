@@ -0,0 +1,62 @@
+package listen
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+
+	lis, err := Listen("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen("unix:" + path); err == nil {
+		t.Fatal("expected a socket in use to be refused")
+	}
+	go func() {
+		if conn, err := lis.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	// A socket file left behind by a crash is replaced
+	if l, ok := lis.(*net.UnixListener); ok {
+		l.SetUnlinkOnClose(false)
+	}
+	lis.Close()
+	lis, err = Listen("unix:" + path)
+	if err != nil {
+		t.Fatalf("expected a stale socket to be replaced: %v", err)
+	}
+	lis.Close()
+}
+
+func TestListenRefusesRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen("unix:" + path); err == nil {
+		t.Fatal("expected a regular file not to be replaced")
+	}
+}
+
+func TestListenTCP(t *testing.T) {
+	lis, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	if lis.Addr().Network() != "tcp" || IsUnix("127.0.0.1:0") || !IsUnix("unix:/tmp/x.sock") {
+		t.Fatalf("unexpected listener %v", lis.Addr())
+	}
+}
@@ -0,0 +1,35 @@
+package listen
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/soheilhy/cmux"
+)
+
+// Split divides a plaintext listener between gRPC and HTTP: HTTP/2
+// connections whose requests carry content-type application/grpc go to the
+// first listener, everything else (HTTP/1.1, h2c) to the second. Connections
+// are only dispatched once serve is running.
+func Split(lis net.Listener) (grpcLis, httpLis net.Listener, serve func() error) {
+	m := cmux.New(lis)
+	// SendSettings, since gRPC clients wait for the server's SETTINGS frame
+	// before sending the headers the match needs
+	grpcLis = m.MatchWithWriters(cmux.HTTP2MatchHeaderFieldSendSettings("content-type", "application/grpc"))
+	httpLis = m.Match(cmux.Any())
+	return grpcLis, httpLis, m.Serve
+}
+
+// GRPCHandler sends gRPC requests to grpcServer and the rest to next. Over
+// TLS the protocols can't be told apart before the handshake, so single-port
+// mode serves both from one HTTP/2 server instead of splitting connections.
+func GRPCHandler(grpcServer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcServer.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,125 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ComponentField names the component an entry belongs to. Entries without
+// it are keyed by their type field, set by helpers such as LogDatabase.
+const ComponentField = "component"
+
+// Levels are the default log level and overrides per component
+type Levels struct {
+	Default    logrus.Level            `json:"default"`
+	Components map[string]logrus.Level `json:"components,omitempty"`
+}
+
+var levels atomic.Pointer[Levels]
+
+// SetLevels replaces the log levels; it is safe to call while logging
+func SetLevels(l Levels) {
+	levels.Store(&l)
+
+	// Log must let through the most verbose level; levelFilter drops the rest
+	verbose := l.Default
+	for _, level := range l.Components {
+		if level > verbose {
+			verbose = level
+		}
+	}
+	Log.SetLevel(verbose)
+}
+
+// SetDefaultLevel changes the default level, keeping per-component levels,
+// and returns the level it replaced
+func SetDefaultLevel(level string) (previous logrus.Level, err error) {
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return 0, err
+	}
+	l := CurrentLevels()
+	previous, l.Default = l.Default, parsed
+	SetLevels(l)
+	return previous, nil
+}
+
+// CurrentLevels returns the levels in effect
+func CurrentLevels() Levels {
+	if l := levels.Load(); l != nil {
+		return *l
+	}
+	return Levels{Default: Log.GetLevel()}
+}
+
+// ParseLevels parses a default level and per-component overrides such as
+// "database=debug,cron=warn"
+func ParseLevels(defaultLevel, components string) (Levels, error) {
+	overrides := make(map[string]string)
+	for _, pair := range strings.Split(components, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		name, level, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return Levels{}, fmt.Errorf("invalid component level %q, want component=level", pair)
+		}
+		overrides[strings.TrimSpace(name)] = strings.TrimSpace(level)
+	}
+	return NewLevels(defaultLevel, overrides)
+}
+
+// NewLevels builds Levels from level names such as "info" and "debug"
+func NewLevels(defaultLevel string, components map[string]string) (Levels, error) {
+	var l Levels
+	var err error
+	if l.Default, err = logrus.ParseLevel(defaultLevel); err != nil {
+		return Levels{}, err
+	}
+	for name, level := range components {
+		parsed, err := logrus.ParseLevel(level)
+		if err != nil {
+			return Levels{}, fmt.Errorf("%s: %w", name, err)
+		}
+		if l.Components == nil {
+			l.Components = make(map[string]logrus.Level)
+		}
+		l.Components[name] = parsed
+	}
+	return l, nil
+}
+
+// enabled reports whether entry is at or above the level of its component
+func enabled(entry *logrus.Entry) bool {
+	l := levels.Load()
+	if l == nil {
+		return true
+	}
+	level := l.Default
+	if len(l.Components) > 0 {
+		component, ok := entry.Data[ComponentField].(string)
+		if !ok {
+			component, _ = entry.Data["type"].(string)
+		}
+		if override, ok := l.Components[component]; ok {
+			level = override
+		}
+	}
+	return entry.Level <= level
+}
+
+// levelFilter formats only entries enabled by the current levels; the
+// outputs skip the empty result of a filtered entry
+type levelFilter struct {
+	logrus.Formatter
+}
+
+func (f levelFilter) Format(entry *logrus.Entry) ([]byte, error) {
+	if !enabled(entry) {
+		return nil, nil
+	}
+	return f.Formatter.Format(entry)
+}
@@ -8,20 +8,38 @@ import (
 
 var Log *logrus.Logger
 
+// Init sets up Log to write to stdout with the defaults of the environment.
+// Configure replaces the defaults once configuration is loaded.
 func Init() {
 	Log = logrus.New()
 	Log.SetOutput(os.Stdout)
 
 	// Set format based on environment
-	if os.Getenv("ENV") == "production" {
-		Log.SetFormatter(&logrus.JSONFormatter{})
-		Log.SetLevel(logrus.InfoLevel)
+	if production() {
+		Log.SetFormatter(levelFilter{&logrus.JSONFormatter{}})
 	} else {
-		Log.SetFormatter(&logrus.TextFormatter{
+		Log.SetFormatter(levelFilter{&logrus.TextFormatter{
 			ForceColors: true,
-		})
-		Log.SetLevel(logrus.DebugLevel)
+		}})
 	}
+	SetLevels(Levels{Default: defaultLevel()})
+}
+
+func production() bool {
+	return os.Getenv("ENV") == "production"
+}
+
+func defaultLevel() logrus.Level {
+	if production() {
+		return logrus.InfoLevel
+	}
+	return logrus.DebugLevel
+}
+
+// For returns an entry for the given component, usually the calling package's
+// name, so that its level can be set separately (see Levels)
+func For(component string) *logrus.Entry {
+	return Log.WithField(ComponentField, component)
 }
 
 // Helper functions for common logging patterns
@@ -49,3 +67,33 @@ func LogAuth(action, email string) *logrus.Entry {
 		"type":   "auth",
 	})
 }
+
+// LogRecovery returns an audit entry for an action on an account recovery case
+func LogRecovery(action string, caseID, actorID uint) *logrus.Entry {
+	return Log.WithFields(logrus.Fields{
+		"action":   action,
+		"case_id":  caseID,
+		"actor_id": actorID,
+		"type":     "recovery_audit",
+	})
+}
+
+// LogConfigChange returns an audit entry for a setting changed while running
+func LogConfigChange(setting string, from, to interface{}) *logrus.Entry {
+	return Log.WithFields(logrus.Fields{
+		"setting": setting,
+		"old":     from,
+		"new":     to,
+		"type":    "config_audit",
+	})
+}
+
+// LogImpersonation returns an audit entry for actions taken by actorID while impersonating userID
+func LogImpersonation(action string, actorID, userID uint) *logrus.Entry {
+	return Log.WithFields(logrus.Fields{
+		"action":   action,
+		"actor_id": actorID,
+		"user_id":  userID,
+		"type":     "impersonation_audit",
+	})
+}
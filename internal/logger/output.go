@@ -0,0 +1,142 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"github.com/114windd/restapi/internal/config"
+)
+
+// Log outputs accepted in LOG_OUTPUTS
+const (
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+	OutputFile   = "file"
+	OutputSyslog = "syslog"
+)
+
+// ConfiguredLevels parses LOG_LEVEL and LOG_LEVELS; an empty LOG_LEVEL
+// means debug, or info in production
+func ConfiguredLevels(cfg config.LoggingConfig) (Levels, error) {
+	level := cfg.Level
+	if level == "" {
+		level = defaultLevel().String()
+	}
+	l, err := ParseLevels(level, cfg.Levels)
+	if err != nil {
+		return Levels{}, fmt.Errorf("log levels: %w", err)
+	}
+	return l, nil
+}
+
+// Configure applies the logging configuration to Log: levels, backend,
+// format and outputs. Several outputs receive every entry; files are
+// rotated by size.
+func Configure(cfg config.LoggingConfig) error {
+	l, err := ConfiguredLevels(cfg)
+	if err != nil {
+		return err
+	}
+
+	format := cfg.Format
+	if format == "" {
+		format = "text"
+		if production() {
+			format = "json"
+		}
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	outputs := cfg.Outputs
+	if len(outputs) == 0 {
+		outputs = []string{OutputStdout}
+	}
+	var writers []io.Writer
+	terminal, toSyslog := true, false
+	for _, output := range outputs {
+		switch strings.ToLower(output) {
+		case OutputStdout:
+			writers = append(writers, os.Stdout)
+		case OutputStderr:
+			writers = append(writers, os.Stderr)
+		case OutputFile:
+			if cfg.File == "" {
+				return fmt.Errorf("log output %q needs LOG_FILE", output)
+			}
+			writers = append(writers, &lumberjack.Logger{
+				Filename:   cfg.File,
+				MaxSize:    cfg.FileMaxSizeMB,
+				MaxBackups: cfg.FileMaxBackups,
+				MaxAge:     cfg.FileMaxAgeDays,
+				Compress:   cfg.FileCompress,
+			})
+			terminal = false
+		case OutputSyslog:
+			toSyslog, terminal = true, false
+		default:
+			return fmt.Errorf("unknown log output %q", output)
+		}
+	}
+
+	var formatter logrus.Formatter = &logrus.JSONFormatter{}
+	if format == "text" {
+		formatter = &logrus.TextFormatter{ForceColors: terminal, DisableColors: !terminal}
+	}
+	var hooks []logrus.Hook
+	if toSyslog {
+		hook, err := newSyslogHook(cfg.SyslogAddr, cfg.SyslogTag, levelFilter{formatter})
+		if err != nil {
+			return fmt.Errorf("log output syslog: %w", err)
+		}
+		hooks = append(hooks, hook)
+	}
+
+	switch cfg.Backend {
+	case "", BackendLogrus:
+		Log.SetFormatter(levelFilter{formatter})
+		Log.SetOutput(fanout(writers))
+	case BackendSlog:
+		// logrus only collects entries; the slog handler formats and writes them
+		options := &slog.HandlerOptions{Level: slogLevel(logrus.TraceLevel)}
+		var handler slog.Handler = slog.NewTextHandler(fanout(writers), options)
+		if format == "json" {
+			handler = slog.NewJSONHandler(fanout(writers), options)
+		}
+		hooks = append(hooks, slogBackend{handler: handler})
+		Log.SetFormatter(discardFormatter{})
+		Log.SetOutput(io.Discard)
+	default:
+		return fmt.Errorf("unknown log backend %q", cfg.Backend)
+	}
+	for _, hook := range hooks {
+		Log.AddHook(hook)
+	}
+	SetLevels(l)
+	return nil
+}
+
+// fanout writes each entry to every writer. Unlike io.MultiWriter a failing
+// writer doesn't stop the others, and the empty output of entries dropped
+// by levelFilter isn't written at all.
+type fanout []io.Writer
+
+func (f fanout) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	var firstErr error
+	for _, w := range f {
+		if _, err := w.Write(p); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return len(p), firstErr
+}
@@ -0,0 +1,147 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Log backends accepted in LOG_BACKEND
+const (
+	BackendLogrus = "logrus"
+	BackendSlog   = "slog"
+)
+
+// Slog is a log/slog front end to the same outputs and levels as Log, for
+// code that prefers the standard library API. Both front ends work with
+// either backend.
+var Slog = slog.New(logrusHandler{})
+
+// slogLevel maps a logrus level to slog, which has no trace, fatal or panic
+func slogLevel(level logrus.Level) slog.Level {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return slog.LevelError + 4
+	case logrus.ErrorLevel:
+		return slog.LevelError
+	case logrus.WarnLevel:
+		return slog.LevelWarn
+	case logrus.InfoLevel:
+		return slog.LevelInfo
+	case logrus.DebugLevel:
+		return slog.LevelDebug
+	default:
+		return slog.LevelDebug - 4
+	}
+}
+
+// logrusLevel is the inverse of slogLevel
+func logrusLevel(level slog.Level) logrus.Level {
+	switch {
+	case level > slog.LevelError:
+		return logrus.FatalLevel
+	case level >= slog.LevelError:
+		return logrus.ErrorLevel
+	case level >= slog.LevelWarn:
+		return logrus.WarnLevel
+	case level >= slog.LevelInfo:
+		return logrus.InfoLevel
+	case level >= slog.LevelDebug:
+		return logrus.DebugLevel
+	default:
+		return logrus.TraceLevel
+	}
+}
+
+// slogBackend forwards logrus entries to a slog handler, which then does
+// all formatting and writing
+type slogBackend struct {
+	handler slog.Handler
+}
+
+func (b slogBackend) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (b slogBackend) Fire(entry *logrus.Entry) error {
+	if !enabled(entry) {
+		return nil
+	}
+	record := slog.NewRecord(entry.Time, slogLevel(entry.Level), entry.Message, 0)
+	for key, value := range entry.Data {
+		record.AddAttrs(slog.Any(key, value))
+	}
+	ctx := entry.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return b.handler.Handle(ctx, record)
+}
+
+// discardFormatter skips logrus formatting when the slog backend writes the output
+type discardFormatter struct{}
+
+func (discardFormatter) Format(*logrus.Entry) ([]byte, error) {
+	return nil, nil
+}
+
+// logrusHandler is a slog handler logging through Log, so Slog records get
+// the component levels, hooks and outputs of logrus entries
+type logrusHandler struct {
+	attrs  []slog.Attr
+	prefix string // dotted group path of attributes added from here on
+}
+
+func (h logrusHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return Log != nil && Log.IsLevelEnabled(logrusLevel(level))
+}
+
+func (h logrusHandler) Handle(ctx context.Context, record slog.Record) error {
+	fields := make(logrus.Fields, len(h.attrs)+record.NumAttrs())
+	for _, attr := range h.attrs {
+		addField(fields, "", attr)
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		addField(fields, h.prefix, attr)
+		return true
+	})
+	Log.WithContext(ctx).WithTime(record.Time).WithFields(fields).Log(logrusLevel(record.Level), record.Message)
+	return nil
+}
+
+func (h logrusHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	prefixed := make([]slog.Attr, 0, len(h.attrs)+len(attrs))
+	prefixed = append(prefixed, h.attrs...)
+	for _, attr := range attrs {
+		attr.Key = h.prefix + attr.Key
+		prefixed = append(prefixed, attr)
+	}
+	return logrusHandler{attrs: prefixed, prefix: h.prefix}
+}
+
+func (h logrusHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return logrusHandler{attrs: h.attrs, prefix: h.prefix + name + "."}
+}
+
+// addField flattens an attribute, expanding groups into dotted keys
+func addField(fields logrus.Fields, prefix string, attr slog.Attr) {
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if attr.Key != "" {
+			groupPrefix += attr.Key + "."
+		}
+		for _, child := range value.Group() {
+			addField(fields, groupPrefix, child)
+		}
+		return
+	}
+	if attr.Key == "" {
+		return
+	}
+	fields[prefix+attr.Key] = value.Any()
+}
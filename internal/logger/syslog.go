@@ -0,0 +1,58 @@
+//go:build !windows && !plan9
+
+package logger
+
+import (
+	"log/syslog"
+	"net/url"
+
+	"github.com/sirupsen/logrus"
+)
+
+// syslogHook sends entries to syslog with a severity matching their level
+type syslogHook struct {
+	writer    *syslog.Writer
+	formatter logrus.Formatter
+}
+
+// newSyslogHook connects to the syslog daemon at addr, e.g. udp://logs:514,
+// or to the local daemon when addr is empty
+func newSyslogHook(addr, tag string, formatter logrus.Formatter) (logrus.Hook, error) {
+	var network, raddr string
+	if addr != "" {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return nil, err
+		}
+		network, raddr = u.Scheme, u.Host
+	}
+	writer, err := syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogHook{writer: writer, formatter: formatter}, nil
+}
+
+func (h *syslogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *syslogHook) Fire(entry *logrus.Entry) error {
+	line, err := h.formatter.Format(entry)
+	if err != nil || len(line) == 0 {
+		return err
+	}
+	message := string(line)
+	switch entry.Level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return h.writer.Crit(message)
+	case logrus.ErrorLevel:
+		return h.writer.Err(message)
+	case logrus.WarnLevel:
+		return h.writer.Warning(message)
+	case logrus.InfoLevel:
+		return h.writer.Info(message)
+	default:
+		return h.writer.Debug(message)
+	}
+}
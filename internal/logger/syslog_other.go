@@ -0,0 +1,13 @@
+//go:build windows || plan9
+
+package logger
+
+import (
+	"errors"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newSyslogHook(addr, tag string, formatter logrus.Formatter) (logrus.Hook, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,62 @@
+// Package mail sends email: messages rendered from the templates in
+// templates/, queued and delivered in the background through SMTP, Amazon
+// SES, or the log in development.
+package mail
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/114windd/restapi/internal/config"
+	"github.com/114windd/restapi/internal/logger"
+)
+
+// Message is an outgoing email. A message naming a Template has its
+// Subject, Body and HTML rendered from it with Data when sent through a Queue.
+type Message struct {
+	To      string
+	Subject string
+	Body    string // plain text
+	HTML    string // optional HTML alternative to Body
+
+	Template string
+	Data     interface{}
+}
+
+// Mailer delivers email
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogMailer logs messages instead of sending them, for development and tests
+type LogMailer struct{}
+
+// Send implements Mailer
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	logger.Log.WithField("to", msg.To).WithField("subject", msg.Subject).WithField("template", msg.Template).Info("Email (not sent, log mailer)")
+	return nil
+}
+
+// New creates a queue delivering through the configured provider
+func New(ctx context.Context, cfg config.MailConfig) (*Queue, error) {
+	var mailer Mailer
+	switch cfg.Provider {
+	case config.MailProviderLog, "":
+		mailer = LogMailer{}
+	case config.MailProviderSMTP:
+		mailer = NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.From)
+	case config.MailProviderSES:
+		ses, err := NewSESMailer(ctx, cfg.SESRegion, cfg.From)
+		if err != nil {
+			return nil, err
+		}
+		mailer = ses
+	default:
+		return nil, fmt.Errorf("unknown mail provider %q", cfg.Provider)
+	}
+	provider := cfg.Provider
+	if provider == "" {
+		provider = config.MailProviderLog
+	}
+	return NewQueue(mailer, provider, cfg.Product, cfg.QueueSize), nil
+}
@@ -0,0 +1,290 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	netmail "net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/retry"
+)
+
+func init() {
+	logger.Init()
+	logger.Log.SetOutput(io.Discard)
+}
+
+func TestRender(t *testing.T) {
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		msg     Message
+		subject string
+		want    []string
+	}{
+		{Message{Template: TemplateWelcome, Data: WelcomeData{Name: "Alice"}}, "Welcome to Acme", []string{"Hi Alice", "Acme"}},
+		{Message{Template: TemplateVerification, Data: VerificationData{Name: "Alice", Code: "123456", ExpiresAt: expires}}, "Verify your email address", []string{"123456", "02 Jan 2030"}},
+		{Message{Template: TemplatePasswordReset, Data: PasswordResetData{Code: "reset-code", ExpiresAt: expires}}, "Recover your account", []string{"reset-code"}},
+		{Message{Template: TemplateInvite, Data: InviteData{Name: "Bob", Code: "invite-code", ExpiresAt: expires}}, "You have been invited", []string{"Hi Bob", "invite-code"}},
+		{Message{Template: TemplateNewDevice, Data: NewDeviceData{Name: "Alice", Device: "Firefox on Linux", IP: "203.0.113.7", At: expires}}, "New login to your Acme account", []string{"Firefox on Linux", "203.0.113.7"}},
+		{Message{Template: TemplateStepUp, Data: StepUpData{Name: "Alice", Code: "654321", ExpiresAt: expires, IP: "203.0.113.7", Location: "Paris, FR"}}, "Confirm your Acme login", []string{"654321", "Paris, FR"}},
+		{Message{Template: TemplateAccountExists, Data: AccountExistsData{Name: "Alice"}}, "Signup attempt for your Acme account", []string{"Hi Alice", "log in instead"}},
+	}
+	for _, tt := range tests {
+		tt.msg.To = "alice@example.com"
+		msg, err := Render(tt.msg, "Acme")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.msg.Template, err)
+		}
+		if msg.Subject != tt.subject {
+			t.Errorf("%s: subject %q, want %q", tt.msg.Template, msg.Subject, tt.subject)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(msg.Body, want) || !strings.Contains(msg.HTML, want) {
+				t.Errorf("%s: text or HTML body lacks %q:\n%s\n%s", tt.msg.Template, want, msg.Body, msg.HTML)
+			}
+		}
+		if !strings.Contains(msg.HTML, "sent to alice@example.com") {
+			t.Errorf("%s: HTML body lacks the footer:\n%s", tt.msg.Template, msg.HTML)
+		}
+	}
+
+	msg, err := Render(Message{Template: TemplateWelcome, Data: WelcomeData{Name: "<script>x</script>"}}, "Acme")
+	if err != nil || strings.Contains(msg.HTML, "<script>") {
+		t.Fatalf("HTML body must escape data: %v\n%s", err, msg.HTML)
+	}
+	if _, err := Render(Message{Template: "missing"}, "Acme"); err == nil {
+		t.Fatal("expected an error for an unknown template")
+	}
+	plain := Message{To: "a@example.com", Subject: "Hi", Body: "Hello"}
+	if msg, err := Render(plain, "Acme"); err != nil || msg != plain {
+		t.Fatalf("a message without a template must be unchanged, got %+v, %v", msg, err)
+	}
+}
+
+// recordingMailer fails the first failures sends with err
+type recordingMailer struct {
+	mu       sync.Mutex
+	sent     []Message
+	attempts int
+	failures int
+	err      error
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempts++
+	if m.attempts <= m.failures {
+		return m.err
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestQueue(t *testing.T) {
+	mailer := &recordingMailer{failures: 1, err: errors.New("connection reset")}
+	q := NewQueue(mailer, "test", "Acme", 10)
+	if err := q.Send(context.Background(), Message{To: "alice@example.com", Template: TemplateWelcome, Data: WelcomeData{Name: "Alice"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Send(context.Background(), Message{To: "alice@example.com", Template: "missing"}); err == nil {
+		t.Fatal("expected a rendering error to be returned by Send")
+	}
+	q.Close()
+
+	if mailer.attempts != 2 || len(mailer.sent) != 1 || mailer.sent[0].Subject != "Welcome to Acme" {
+		t.Fatalf("expected the message rendered and delivered on the second attempt, got %d attempts, %+v", mailer.attempts, mailer.sent)
+	}
+	if err := q.Check(context.Background()); err != nil {
+		t.Fatalf("expected a healthy queue after a delivery, got %v", err)
+	}
+
+	// Rejected messages are not retried, and turn the queue unhealthy
+	rejecting := &recordingMailer{failures: 10, err: retry.Permanent(errors.New("550 mailbox unavailable"))}
+	q = NewQueue(rejecting, "test", "Acme", 10)
+	if err := q.Send(context.Background(), Message{To: "bob@example.com", Subject: "Hi", Body: "Hello"}); err != nil {
+		t.Fatal(err)
+	}
+	q.Close()
+	if rejecting.attempts != 1 {
+		t.Fatalf("expected a permanent failure to be tried once, got %d attempts", rejecting.attempts)
+	}
+	if err := q.Check(context.Background()); err == nil {
+		t.Fatal("expected the queue to report the failed delivery")
+	}
+}
+
+// smtpServer accepts one session on a local port, answering every command
+// with rcptReply for RCPT and 250 otherwise, and captures the message data
+func smtpServer(t *testing.T, rcptReply string) (addr string, data <-chan string) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+	received := make(chan string, 1)
+
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { _, _ = conn.Write([]byte(s + "\r\n")) }
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "RCPT"):
+				reply(rcptReply)
+			case cmd == "DATA":
+				reply("354 go ahead")
+				var msg strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					msg.WriteString(line)
+				}
+				received <- msg.String()
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return lis.Addr().String(), received
+}
+
+func TestSMTPMailer(t *testing.T) {
+	addr, data := smtpServer(t, "250 ok")
+	host, port, _ := net.SplitHostPort(addr)
+	m := NewSMTPMailer(host, mustAtoi(t, port), "", "", "Acme <no-reply@acme.test>")
+
+	msg, err := Render(Message{To: "alice@example.com", Template: TemplateWelcome, Data: WelcomeData{Name: "Alice"}}, "Acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Send(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := netmail.ReadMessage(strings.NewReader(<-data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Header.Get("Subject") != "Welcome to Acme" || parsed.Header.Get("To") != "<alice@example.com>" || !strings.HasSuffix(parsed.Header.Get("Message-ID"), "@acme.test>") {
+		t.Fatalf("unexpected headers: %v", parsed.Header)
+	}
+	mediaType, params, _ := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("expected multipart/alternative, got %q", mediaType)
+	}
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	var contentTypes []string
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(part)
+		if !strings.Contains(string(body), "Hi Alice") {
+			t.Errorf("%s part lacks the greeting: %s", part.Header.Get("Content-Type"), body)
+		}
+		contentTypes = append(contentTypes, part.Header.Get("Content-Type"))
+	}
+	if len(contentTypes) != 2 || !strings.HasPrefix(contentTypes[0], "text/plain") || !strings.HasPrefix(contentTypes[1], "text/html") {
+		t.Fatalf("expected text and HTML parts, got %v", contentTypes)
+	}
+}
+
+func TestSMTPMailerRejectedRecipient(t *testing.T) {
+	addr, _ := smtpServer(t, "550 no such user")
+	host, port, _ := net.SplitHostPort(addr)
+	m := NewSMTPMailer(host, mustAtoi(t, port), "", "", "no-reply@acme.test")
+
+	err := m.Send(context.Background(), Message{To: "nobody@example.com", Subject: "Hi", Body: "Hello"})
+	if err == nil || !isPermanent(err) {
+		t.Fatalf("expected a permanent error, got %v", err)
+	}
+	if err := m.Send(context.Background(), Message{To: "not an address\r\nBcc: x@example.com", Body: "Hello"}); err == nil {
+		t.Fatal("expected an invalid recipient to be rejected")
+	}
+}
+
+type fakeSES struct {
+	input *sesv2.SendEmailInput
+	err   error
+}
+
+func (f *fakeSES) SendEmail(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+	f.input = params
+	return &sesv2.SendEmailOutput{}, f.err
+}
+
+func TestSESMailer(t *testing.T) {
+	client := &fakeSES{}
+	m := &SESMailer{client: client, from: "no-reply@acme.test"}
+	if err := m.Send(context.Background(), Message{To: "alice@example.com", Subject: "Hi", Body: "Hello", HTML: "<p>Hello</p>"}); err != nil {
+		t.Fatal(err)
+	}
+	simple := client.input.Content.Simple
+	if *client.input.FromEmailAddress != "no-reply@acme.test" || client.input.Destination.ToAddresses[0] != "alice@example.com" ||
+		*simple.Subject.Data != "Hi" || *simple.Body.Text.Data != "Hello" || *simple.Body.Html.Data != "<p>Hello</p>" {
+		t.Fatalf("unexpected SendEmail input: %+v", client.input)
+	}
+
+	client.err = &types.MessageRejected{Message: new(string)}
+	if err := m.Send(context.Background(), Message{To: "alice@example.com"}); err == nil || !isPermanent(err) {
+		t.Fatalf("expected a rejected message to fail permanently, got %v", err)
+	}
+	client.err = &types.TooManyRequestsException{Message: new(string)}
+	if err := m.Send(context.Background(), Message{To: "alice@example.com"}); err == nil || isPermanent(err) {
+		t.Fatalf("expected throttling to be retried, got %v", err)
+	}
+}
+
+// isPermanent reports whether retry gives up on err after one attempt
+func isPermanent(err error) bool {
+	attempts := 0
+	_ = retry.ExecuteWithRetry(context.Background(), "test", func() error { attempts++; return err }, retry.RetryConfig{MaxAttempts: 2})
+	return attempts == 1
+}
+
+func mustAtoi(t *testing.T, s string) int {
+	t.Helper()
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
@@ -0,0 +1,116 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/metrics"
+	"github.com/114windd/restapi/internal/retry"
+)
+
+// sendTimeout bounds a single delivery attempt
+const sendTimeout = 30 * time.Second
+
+// ErrQueueFull is returned by Queue.Send when the message was dropped
+var ErrQueueFull = errors.New("mail queue full")
+
+// Queue renders messages and delivers them through a provider in the
+// background, retrying failed deliveries. Send never waits for the
+// provider: when the queue is full the message is dropped and counted.
+type Queue struct {
+	mailer   Mailer
+	provider string
+	product  string
+	queue    chan Message
+	done     chan struct{}
+
+	mu      sync.Mutex
+	lastErr error // outcome of the latest delivery
+}
+
+// NewQueue starts a queue delivering through mailer, labelled provider in
+// metrics, with room for size undelivered messages
+func NewQueue(mailer Mailer, provider, product string, size int) *Queue {
+	q := &Queue{
+		mailer:   mailer,
+		provider: provider,
+		product:  product,
+		queue:    make(chan Message, size),
+		done:     make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// Send implements Mailer. Rendering errors are returned at once; delivery
+// failures are only logged and counted.
+func (q *Queue) Send(ctx context.Context, msg Message) error {
+	msg, err := Render(msg, q.product)
+	if err != nil {
+		return err
+	}
+	select {
+	case q.queue <- msg:
+		return nil
+	default:
+		metrics.RecordMailDelivery(q.provider, msg.Template, "dropped", 0)
+		logger.Log.WithField("template", msg.Template).Warn("Mail queue full, dropping message")
+		return ErrQueueFull
+	}
+}
+
+// Close delivers queued messages
+func (q *Queue) Close() error {
+	close(q.queue)
+	<-q.done
+	return nil
+}
+
+// Check reports the queue unhealthy while it is full or when the latest
+// delivery failed, for the readiness registry
+func (q *Queue) Check(ctx context.Context) error {
+	if len(q.queue) == cap(q.queue) {
+		return fmt.Errorf("mail queue full (%d messages)", cap(q.queue))
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.lastErr != nil {
+		return fmt.Errorf("last delivery through %s failed: %w", q.provider, q.lastErr)
+	}
+	return nil
+}
+
+func (q *Queue) run() {
+	defer close(q.done)
+	for msg := range q.queue {
+		q.deliver(msg)
+	}
+}
+
+func (q *Queue) deliver(msg Message) {
+	// Providers mark rejected messages permanent; anything else, including
+	// an attempt that timed out, is worth retrying
+	config := retry.DefaultRetryConfig()
+	config.IsRetryable = nil
+
+	start := time.Now()
+	err := retry.ExecuteWithRetry(context.Background(), "send_mail", func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		defer cancel()
+		return q.mailer.Send(ctx, msg)
+	}, config)
+
+	q.mu.Lock()
+	q.lastErr = err
+	q.mu.Unlock()
+	if err != nil {
+		metrics.RecordMailDelivery(q.provider, msg.Template, "error", time.Since(start))
+		logger.Log.WithError(err).WithField("template", msg.Template).Error("Failed to send mail")
+		return
+	}
+	metrics.RecordMailDelivery(q.provider, msg.Template, "success", time.Since(start))
+}
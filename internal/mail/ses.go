@@ -0,0 +1,64 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/aws/smithy-go"
+
+	"github.com/114windd/restapi/internal/retry"
+)
+
+// sesAPI is the part of the SES v2 client SESMailer uses
+type sesAPI interface {
+	SendEmail(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error)
+}
+
+// SESMailer sends email through Amazon SES
+type SESMailer struct {
+	client sesAPI
+	from   string
+}
+
+// NewSESMailer creates a mailer sending from from through SES in region,
+// with credentials from the AWS default chain (environment, shared config,
+// instance or task role)
+func NewSESMailer(ctx context.Context, region, from string) (*SESMailer, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("load AWS configuration: %w", err)
+	}
+	return &SESMailer{client: sesv2.NewFromConfig(cfg), from: from}, nil
+}
+
+// Send implements Mailer. Messages SES rejects as invalid are not worth
+// retrying; throttling and server faults are.
+func (m *SESMailer) Send(ctx context.Context, msg Message) error {
+	body := &types.Body{Text: &types.Content{Data: aws.String(msg.Body), Charset: aws.String("UTF-8")}}
+	if msg.HTML != "" {
+		body.Html = &types.Content{Data: aws.String(msg.HTML), Charset: aws.String("UTF-8")}
+	}
+	_, err := m.client.SendEmail(ctx, &sesv2.SendEmailInput{
+		FromEmailAddress: aws.String(m.from),
+		Destination:      &types.Destination{ToAddresses: []string{msg.To}},
+		Content: &types.EmailContent{Simple: &types.Message{
+			Subject: &types.Content{Data: aws.String(msg.Subject), Charset: aws.String("UTF-8")},
+			Body:    body,
+		}},
+	})
+	if err == nil {
+		return nil
+	}
+
+	var throttled *types.TooManyRequestsException
+	var apiErr smithy.APIError
+	if !errors.As(err, &throttled) && errors.As(err, &apiErr) && apiErr.ErrorFault() == smithy.FaultClient {
+		return retry.Permanent(err)
+	}
+	return err
+}
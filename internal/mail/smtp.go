@@ -0,0 +1,210 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/114windd/restapi/internal/retry"
+)
+
+// implicitTLSPort is the SMTP submission port speaking TLS from the start
+const implicitTLSPort = 465
+
+// SMTPMailer sends email through an SMTP server, upgrading the connection
+// with STARTTLS when the server offers it
+type SMTPMailer struct {
+	host string
+	port int
+	from string
+	auth smtp.Auth
+	// tlsConfig is used for STARTTLS and implicit TLS; nil verifies host
+	tlsConfig *tls.Config
+}
+
+// NewSMTPMailer creates a mailer sending from from through host:port,
+// authenticating with username and password when username is set
+func NewSMTPMailer(host string, port int, username, password, from string) *SMTPMailer {
+	m := &SMTPMailer{host: host, port: port, from: from}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+// Send implements Mailer. Recipients and messages the server rejects
+// outright (5xx replies) are not worth retrying.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	from, err := netmail.ParseAddress(m.from)
+	if err != nil {
+		return retry.Permanent(fmt.Errorf("invalid sender %q: %w", m.from, err))
+	}
+	to, err := netmail.ParseAddress(msg.To)
+	if err != nil {
+		return retry.Permanent(fmt.Errorf("invalid recipient: %w", err))
+	}
+	data, err := encode(from, to, msg)
+	if err != nil {
+		return retry.Permanent(err)
+	}
+
+	client, err := m.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := m.transmit(client, from.Address, to.Address, data); err != nil {
+		var reply *textproto.Error
+		if errors.As(err, &reply) && reply.Code >= 500 {
+			return retry.Permanent(err)
+		}
+		return err
+	}
+	return client.Quit()
+}
+
+func (m *SMTPMailer) dial(ctx context.Context) (*smtp.Client, error) {
+	tlsConfig := m.tlsConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: m.host}
+	}
+
+	addr := net.JoinHostPort(m.host, strconv.Itoa(m.port))
+	var conn net.Conn
+	var err error
+	if m.port == implicitTLSPort {
+		conn, err = (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// net/smtp doesn't take a context; the deadline bounds the whole exchange
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if ok, _ := client.Extension("STARTTLS"); ok && m.port != implicitTLSPort {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	if m.auth != nil {
+		if err := client.Auth(m.auth); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+func (m *SMTPMailer) transmit(client *smtp.Client, from, to string, data []byte) error {
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// encode formats msg as a MIME message, multipart/alternative when it has
+// an HTML body
+func encode(from, to *netmail.Address, msg Message) ([]byte, error) {
+	header := textproto.MIMEHeader{}
+	header.Set("From", from.String())
+	header.Set("To", to.String())
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header.Set("Date", time.Now().Format(time.RFC1123Z))
+	header.Set("Message-ID", messageID(from))
+	header.Set("MIME-Version", "1.0")
+
+	var body bytes.Buffer
+	if msg.HTML == "" {
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		if err := writeQuotedPrintable(&body, msg.Body); err != nil {
+			return nil, err
+		}
+	} else {
+		parts := multipart.NewWriter(&body)
+		header.Set("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+		for _, part := range []struct{ contentType, text string }{
+			{"text/plain; charset=utf-8", msg.Body},
+			{"text/html; charset=utf-8", msg.HTML},
+		} {
+			w, err := parts.CreatePart(textproto.MIMEHeader{
+				"Content-Type":              {part.contentType},
+				"Content-Transfer-Encoding": {"quoted-printable"},
+			})
+			if err != nil {
+				return nil, err
+			}
+			if err := writeQuotedPrintable(w, part.text); err != nil {
+				return nil, err
+			}
+		}
+		if err := parts.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, key := range []string{"From", "To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type", "Content-Transfer-Encoding"} {
+		if value := header.Get(key); value != "" {
+			fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+		}
+	}
+	buf.WriteString("\r\n")
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, text string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(text)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// messageID generates a unique Message-ID in the sender's domain
+func messageID(from *netmail.Address) string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	domain := "localhost"
+	if at := strings.LastIndexByte(from.Address, '@'); at >= 0 {
+		domain = from.Address[at+1:]
+	}
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
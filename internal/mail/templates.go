@@ -0,0 +1,114 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// Templates; each has a <name>.txt file defining the subject as
+// "<name>.subject" alongside the plain text body, and a <name>.html file
+const (
+	TemplateWelcome       = "welcome"
+	TemplateVerification  = "verification"
+	TemplatePasswordReset = "password_reset"
+	TemplateInvite        = "invite"
+	TemplateNewDevice     = "new_device"
+	TemplateStepUp        = "step_up"
+	TemplateAccountExists = "account_exists"
+)
+
+// WelcomeData fills the welcome template, sent on signup
+type WelcomeData struct {
+	Name string
+}
+
+// VerificationData fills the email verification template
+type VerificationData struct {
+	Name      string
+	Code      string
+	ExpiresAt time.Time
+}
+
+// PasswordResetData fills the password reset template
+type PasswordResetData struct {
+	Code      string
+	ExpiresAt time.Time
+}
+
+// InviteData fills the invitation template
+type InviteData struct {
+	Name      string
+	Code      string
+	ExpiresAt time.Time
+}
+
+// NewDeviceData fills the template alerting a user to a login from a new device
+type NewDeviceData struct {
+	Name   string
+	Device string
+	IP     string
+	At     time.Time
+}
+
+// AccountExistsData fills the template telling a user that someone tried
+// to sign up with their email address
+type AccountExistsData struct {
+	Name string
+}
+
+// StepUpData fills the template with a code confirming a suspicious login
+type StepUpData struct {
+	Name      string
+	Code      string
+	ExpiresAt time.Time
+	IP        string
+	Location  string // e.g. "Paris, FR"; empty when unknown
+}
+
+//go:embed templates
+var templateFS embed.FS
+
+var (
+	funcs = map[string]interface{}{
+		"time": func(t time.Time) string { return t.Format(time.RFC1123) },
+	}
+	textTemplates = texttemplate.Must(texttemplate.New("").Funcs(funcs).ParseFS(templateFS, "templates/*.txt"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.New("").Funcs(funcs).ParseFS(templateFS, "templates/*.html"))
+)
+
+// templateView is what templates are executed with
+type templateView struct {
+	Product string
+	To      string
+	Data    interface{}
+}
+
+// Render fills in the subject and bodies of a message naming a template,
+// for the product called product. Messages without a template are
+// returned unchanged.
+func Render(msg Message, product string) (Message, error) {
+	if msg.Template == "" {
+		return msg, nil
+	}
+	view := templateView{Product: product, To: msg.To, Data: msg.Data}
+
+	var subject, text, html bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&subject, msg.Template+".subject", view); err != nil {
+		return msg, fmt.Errorf("render %s subject: %w", msg.Template, err)
+	}
+	if err := textTemplates.ExecuteTemplate(&text, msg.Template+".txt", view); err != nil {
+		return msg, fmt.Errorf("render %s text: %w", msg.Template, err)
+	}
+	if err := htmlTemplates.ExecuteTemplate(&html, msg.Template+".html", view); err != nil {
+		return msg, fmt.Errorf("render %s HTML: %w", msg.Template, err)
+	}
+	msg.Subject = strings.TrimSpace(subject.String())
+	msg.Body = strings.TrimLeft(text.String(), "\n")
+	msg.HTML = html.String()
+	return msg, nil
+}
@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// RecordingRule is a Prometheus recording rule deriving a RED metric from
+// the raw request metrics
+type RecordingRule struct {
+	Record string
+	Expr   string
+}
+
+// RecordingRules derive per-endpoint rates, error ratios and latency
+// quantiles, so dashboards and alerts don't recompute them on every query
+var RecordingRules = []RecordingRule{
+	{
+		Record: "endpoint:http_requests:rate5m",
+		Expr:   `sum by (method, endpoint) (rate(http_requests_total[5m]))`,
+	},
+	{
+		Record: "endpoint:http_request_errors:rate5m",
+		Expr:   `sum by (method, endpoint) (rate(http_requests_total{status_code=~"5.."}[5m]))`,
+	},
+	{
+		Record: "endpoint:http_request_error_ratio:rate5m",
+		Expr:   `endpoint:http_request_errors:rate5m / endpoint:http_requests:rate5m`,
+	},
+	{
+		Record: "endpoint:http_request_duration_seconds:p95",
+		Expr:   `histogram_quantile(0.95, sum by (method, endpoint, le) (rate(http_request_duration_seconds_bucket[5m])))`,
+	},
+	{
+		Record: "method:grpc_requests:rate5m",
+		Expr:   `sum by (method) (rate(grpc_requests_total[5m]))`,
+	},
+	{
+		Record: "method:grpc_request_error_ratio:rate5m",
+		Expr:   `sum by (method) (rate(grpc_requests_total{status_code=~"Unknown|Internal|DataLoss|Unimplemented|Unavailable|DeadlineExceeded"}[5m])) / method:grpc_requests:rate5m`,
+	},
+}
+
+// RecordingRulesYAML renders RecordingRules as a Prometheus rule file
+func RecordingRulesYAML() []byte {
+	var b strings.Builder
+	b.WriteString("# Generated by `go run ./cmd/gendashboard`; do not edit.\n")
+	b.WriteString("groups:\n  - name: restapi-red\n    rules:\n")
+	for _, rule := range RecordingRules {
+		// Quoted as JSON strings, which YAML accepts as double-quoted scalars
+		record, _ := json.Marshal(rule.Record)
+		expr, _ := json.Marshal(rule.Expr)
+		fmt.Fprintf(&b, "      - record: %s\n        expr: %s\n", record, expr)
+	}
+	return []byte(b.String())
+}
+
+// panel is a Grafana time series panel
+type panel struct {
+	ID          int                    `json:"id"`
+	Type        string                 `json:"type"`
+	Title       string                 `json:"title"`
+	Datasource  map[string]string      `json:"datasource"`
+	GridPos     map[string]int         `json:"gridPos"`
+	FieldConfig map[string]interface{} `json:"fieldConfig"`
+	Targets     []target               `json:"targets"`
+}
+
+type target struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat"`
+}
+
+// panelSpec describes one panel of the generated dashboard
+type panelSpec struct {
+	title   string
+	unit    string
+	targets []target
+}
+
+// dashboardPanels are laid out two per row, in order
+var dashboardPanels = []panelSpec{
+	{title: "HTTP request rate", unit: "reqps", targets: []target{
+		{Expr: `sum by (endpoint) (endpoint:http_requests:rate5m)`, LegendFormat: "{{endpoint}}"},
+	}},
+	{title: "HTTP error ratio (5xx)", unit: "percentunit", targets: []target{
+		{Expr: `endpoint:http_request_error_ratio:rate5m > 0`, LegendFormat: "{{method}} {{endpoint}}"},
+	}},
+	{title: "HTTP latency", unit: "s", targets: []target{
+		{Expr: `histogram_quantile(0.5, sum by (le) (rate(http_request_duration_seconds_bucket[5m])))`, LegendFormat: "p50"},
+		{Expr: `histogram_quantile(0.95, sum by (le) (rate(http_request_duration_seconds_bucket[5m])))`, LegendFormat: "p95"},
+		{Expr: `histogram_quantile(0.99, sum by (le) (rate(http_request_duration_seconds_bucket[5m])))`, LegendFormat: "p99"},
+	}},
+	{title: "HTTP p95 latency by endpoint", unit: "s", targets: []target{
+		{Expr: `endpoint:http_request_duration_seconds:p95`, LegendFormat: "{{method}} {{endpoint}}"},
+	}},
+	{title: "In-flight requests", unit: "short", targets: []target{
+		{Expr: `sum(http_requests_in_flight)`, LegendFormat: "HTTP"},
+		{Expr: `sum(grpc_requests_in_flight)`, LegendFormat: "gRPC"},
+	}},
+	{title: "Request and response size (p95)", unit: "bytes", targets: []target{
+		{Expr: `histogram_quantile(0.95, sum by (le) (rate(http_request_size_bytes_bucket[5m])))`, LegendFormat: "request"},
+		{Expr: `histogram_quantile(0.95, sum by (le) (rate(http_response_size_bytes_bucket[5m])))`, LegendFormat: "response"},
+	}},
+	{title: "gRPC call rate", unit: "reqps", targets: []target{
+		{Expr: `method:grpc_requests:rate5m`, LegendFormat: "{{method}}"},
+	}},
+	{title: "gRPC error ratio", unit: "percentunit", targets: []target{
+		{Expr: `method:grpc_request_error_ratio:rate5m > 0`, LegendFormat: "{{method}}"},
+	}},
+	{title: "Database operation latency (p95)", unit: "s", targets: []target{
+		{Expr: `histogram_quantile(0.95, sum by (operation, le) (rate(db_operation_duration_seconds_bucket[5m])))`, LegendFormat: "{{operation}}"},
+	}},
+	{title: "SLO error budget remaining", unit: "percentunit", targets: []target{
+		{Expr: `slo_error_budget_remaining_ratio`, LegendFormat: "{{endpoint}} {{objective}}"},
+	}},
+}
+
+// Dashboard renders the example Grafana dashboard for the RED metrics. It
+// reads from a Prometheus datasource chosen through the DS_PROMETHEUS input.
+func Dashboard() ([]byte, error) {
+	datasource := map[string]string{"type": "prometheus", "uid": "${DS_PROMETHEUS}"}
+	panels := make([]panel, len(dashboardPanels))
+	for i, spec := range dashboardPanels {
+		targets := make([]target, len(spec.targets))
+		for j, t := range spec.targets {
+			t.RefID = string(rune('A' + j))
+			targets[j] = t
+		}
+		panels[i] = panel{
+			ID:         i + 1,
+			Type:       "timeseries",
+			Title:      spec.title,
+			Datasource: datasource,
+			GridPos:    map[string]int{"h": 8, "w": 12, "x": (i % 2) * 12, "y": (i / 2) * 8},
+			FieldConfig: map[string]interface{}{
+				"defaults":  map[string]interface{}{"unit": spec.unit},
+				"overrides": []interface{}{},
+			},
+			Targets: targets,
+		}
+	}
+
+	dashboard := map[string]interface{}{
+		"__inputs": []map[string]string{{
+			"name":     "DS_PROMETHEUS",
+			"label":    "Prometheus",
+			"type":     "datasource",
+			"pluginId": "prometheus",
+		}},
+		"uid":           "restapi-red",
+		"title":         "REST + gRPC API",
+		"tags":          []string{"restapi", "red"},
+		"timezone":      "browser",
+		"schemaVersion": 39,
+		"refresh":       "30s",
+		"time":          map[string]string{"from": "now-6h", "to": "now"},
+		"panels":        panels,
+	}
+	out, err := json.MarshalIndent(dashboard, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
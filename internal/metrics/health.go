@@ -0,0 +1,236 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/version"
+)
+
+// defaultCheckTimeout bounds checks registered without their own timeout
+const defaultCheckTimeout = 2 * time.Second
+
+// Readiness statuses reported by /readyz
+const (
+	StatusReady    = "ready"
+	StatusDegraded = "degraded" // an optional dependency is down, or one reported Degraded
+	StatusNotReady = "not_ready"
+)
+
+// Checker reports whether a dependency is available
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckFunc adapts a function to Checker
+type CheckFunc func(ctx context.Context) error
+
+// Check calls f
+func (f CheckFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// CheckOption configures a registered check
+type CheckOption func(*registration)
+
+// WithTimeout bounds a check by timeout instead of the default of two seconds
+func WithTimeout(timeout time.Duration) CheckOption {
+	return func(r *registration) { r.timeout = timeout }
+}
+
+// Optional marks a dependency the service can do without, such as the event
+// broker: when it is down the service reports degraded but stays ready
+func Optional() CheckOption {
+	return func(r *registration) { r.optional = true }
+}
+
+// degraded marks a check failure that degrades the service without making
+// it unready
+type degraded struct{ err error }
+
+func (d degraded) Error() string { return d.err.Error() }
+func (d degraded) Unwrap() error { return d.err }
+
+// Degraded marks err as degrading the service rather than making it
+// unready, e.g. a database outage the service answers quickly through
+// while it reconnects: taking replicas out of rotation wouldn't help
+func Degraded(err error) error {
+	if err == nil {
+		return nil
+	}
+	return degraded{err}
+}
+
+type registration struct {
+	checker  Checker
+	timeout  time.Duration
+	optional bool
+}
+
+// Registry holds the dependencies reported by /readyz. Subsystems register
+// their checks while the application is wired.
+type Registry struct {
+	mu     sync.RWMutex
+	checks map[string]registration
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{checks: make(map[string]registration)}
+}
+
+// Register adds or replaces the check of the dependency called name
+func (r *Registry) Register(name string, checker Checker, opts ...CheckOption) {
+	reg := registration{checker: checker, timeout: defaultCheckTimeout}
+	for _, opt := range opts {
+		opt(&reg)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[name] = reg
+}
+
+// Names returns the registered dependencies, sorted
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.checks))
+	for name := range r.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Status     string `json:"status"` // up, down or degraded
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+	Optional   bool   `json:"optional,omitempty"`
+}
+
+// Report is the outcome of every check
+type Report struct {
+	Status       string            `json:"status"`
+	Timestamp    string            `json:"timestamp"`
+	DurationMs   int64             `json:"duration_ms"`
+	Dependencies map[string]Result `json:"dependencies"`
+}
+
+// Run runs every check concurrently, each bounded by its timeout, and
+// records their outcome in the health_check_status metric. A check that
+// ignores its context is reported down when the timeout passes.
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := make(map[string]registration, len(r.checks))
+	for name, reg := range r.checks {
+		checks[name] = reg
+	}
+	r.mu.RUnlock()
+
+	start := time.Now()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]Result, len(checks))
+	for name, reg := range checks {
+		wg.Add(1)
+		go func(name string, reg registration) {
+			defer wg.Done()
+			result := run(ctx, reg)
+			UpdateHealthStatus(name, result.Status == "up")
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}(name, reg)
+	}
+	wg.Wait()
+
+	report := Report{
+		Status:       StatusReady,
+		Timestamp:    time.Now().Format(time.RFC3339),
+		DurationMs:   time.Since(start).Milliseconds(),
+		Dependencies: results,
+	}
+	for _, result := range results {
+		switch {
+		case result.Status == "up":
+		case !result.Optional && result.Status != StatusDegraded:
+			report.Status = StatusNotReady
+		case report.Status == StatusReady:
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// run runs one check, turning a timeout or panic into a failure
+func run(ctx context.Context, reg registration) Result {
+	ctx, cancel := context.WithTimeout(ctx, reg.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- fmt.Errorf("check panicked: %v", p)
+			}
+		}()
+		done <- reg.checker.Check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", reg.timeout)
+	}
+
+	result := Result{Status: "up", DurationMs: time.Since(start).Milliseconds(), Optional: reg.optional}
+	var d degraded
+	switch {
+	case errors.As(err, &d):
+		result.Status = StatusDegraded
+		result.Error = err.Error()
+	case err != nil:
+		result.Status = "down"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// LivenessHandler handles /livez: the process is up and serving requests
+func LivenessHandler(c *gin.Context) {
+	UpdateHealthStatus("process", true)
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "alive",
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
+
+// VersionHandler handles /version, describing the running build
+func VersionHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, version.Get())
+}
+
+// ReadinessHandler handles /readyz, running the registry's checks and
+// reporting each dependency with its latency. It responds 503 when a
+// dependency that isn't optional is down.
+func ReadinessHandler(registry *Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := registry.Run(c.Request.Context())
+		code := http.StatusOK
+		if report.Status == StatusNotReady {
+			code = http.StatusServiceUnavailable
+		}
+		c.JSON(code, report)
+	}
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistryRun(t *testing.T) {
+	r := NewRegistry()
+	r.Register("database", CheckFunc(func(ctx context.Context) error { return nil }))
+	r.Register("broker", CheckFunc(func(ctx context.Context) error { return errors.New("connection refused") }), Optional())
+
+	report := r.Run(context.Background())
+	if report.Status != StatusDegraded {
+		t.Fatalf("optional dependency down: status %q", report.Status)
+	}
+	if got := report.Dependencies["broker"]; got.Status != "down" || got.Error != "connection refused" || !got.Optional {
+		t.Fatalf("broker result: %+v", got)
+	}
+	if got := report.Dependencies["database"]; got.Status != "up" {
+		t.Fatalf("database result: %+v", got)
+	}
+
+	// A required dependency reporting Degraded doesn't make the service unready
+	r.Register("database", CheckFunc(func(ctx context.Context) error { return Degraded(errors.New("database unavailable")) }))
+	r.Register("broker", CheckFunc(func(ctx context.Context) error { return nil }), Optional())
+	report = r.Run(context.Background())
+	if got := report.Dependencies["database"]; report.Status != StatusDegraded || got.Status != StatusDegraded || got.Error != "database unavailable" {
+		t.Fatalf("degraded database: %+v", report)
+	}
+
+	r.Register("database", CheckFunc(func(ctx context.Context) error { panic("boom") }))
+	report = r.Run(context.Background())
+	if report.Status != StatusNotReady || !strings.Contains(report.Dependencies["database"].Error, "boom") {
+		t.Fatalf("panicking check: %+v", report)
+	}
+	if names := r.Names(); len(names) != 2 || names[0] != "broker" || names[1] != "database" {
+		t.Fatalf("Names: %v", names)
+	}
+}
+
+func TestRegistryTimeouts(t *testing.T) {
+	r := NewRegistry()
+	release := make(chan struct{})
+	defer close(release)
+	// Two checks that ignore their context must not add up
+	for _, name := range []string{"slow", "stuck"} {
+		r.Register(name, CheckFunc(func(ctx context.Context) error {
+			<-release
+			return nil
+		}), WithTimeout(50*time.Millisecond))
+	}
+
+	start := time.Now()
+	report := r.Run(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("checks ran for %s, expected them to run concurrently and time out", elapsed)
+	}
+	if report.Status != StatusNotReady {
+		t.Fatalf("status %q", report.Status)
+	}
+	for name, result := range report.Dependencies {
+		if result.Status != "down" || !strings.Contains(result.Error, "timed out") || result.DurationMs < 50 {
+			t.Fatalf("%s result: %+v", name, result)
+		}
+	}
+}
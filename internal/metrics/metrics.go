@@ -2,13 +2,12 @@ package metrics
 
 import (
 	"context"
+	"strconv"
 	"time"
 
-	"github.com/114windd/restapi/internal/database"
 	"github.com/114windd/restapi/internal/logger"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/grpc"
 )
@@ -16,7 +15,7 @@ import (
 // Prometheus metrics
 var (
 	// HTTP metrics
-	httpRequestsTotal = promauto.NewCounterVec(
+	httpRequestsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "http_requests_total",
 			Help: "Total number of HTTP requests",
@@ -24,17 +23,20 @@ var (
 		[]string{"method", "endpoint", "status_code"},
 	)
 
-	httpRequestDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "http_request_duration_seconds",
-			Help:    "HTTP request duration in seconds",
-			Buckets: prometheus.DefBuckets,
+	httpRequestDuration = newHTTPRequestDuration(DefaultLatencyBuckets)
+
+	httpRequestSize  = newHTTPSizeHistogram("http_request_size_bytes", "HTTP request body size in bytes", DefaultSizeBuckets)
+	httpResponseSize = newHTTPSizeHistogram("http_response_size_bytes", "HTTP response body size in bytes, as sent", DefaultSizeBuckets)
+
+	httpRequestsInFlight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of HTTP requests currently being served",
 		},
-		[]string{"method", "endpoint"},
 	)
 
 	// gRPC metrics
-	grpcRequestsTotal = promauto.NewCounterVec(
+	grpcRequestsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "grpc_requests_total",
 			Help: "Total number of gRPC requests",
@@ -42,17 +44,17 @@ var (
 		[]string{"method", "status_code"},
 	)
 
-	grpcRequestDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "grpc_request_duration_seconds",
-			Help:    "gRPC request duration in seconds",
-			Buckets: prometheus.DefBuckets,
+	grpcRequestDuration = newGRPCRequestDuration(DefaultLatencyBuckets)
+
+	grpcRequestsInFlight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "grpc_requests_in_flight",
+			Help: "Number of gRPC calls currently being served",
 		},
-		[]string{"method"},
 	)
 
 	// Database metrics
-	dbOperationsTotal = promauto.NewCounterVec(
+	dbOperationsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "db_operations_total",
 			Help: "Total number of database operations",
@@ -60,7 +62,7 @@ var (
 		[]string{"operation", "table", "status"},
 	)
 
-	dbOperationDuration = promauto.NewHistogramVec(
+	dbOperationDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "db_operation_duration_seconds",
 			Help:    "Database operation duration in seconds",
@@ -69,22 +71,280 @@ var (
 		[]string{"operation", "table"},
 	)
 
+	dbQueryDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "db_query_duration_seconds",
+			Help:    "SQL statement duration in seconds, by operation and table",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"query"},
+	)
+
 	// Health check metrics
-	healthCheckStatus = promauto.NewGaugeVec(
+	healthCheckStatus = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "health_check_status",
 			Help: "Health check status (1 = healthy, 0 = unhealthy)",
 		},
 		[]string{"service"},
 	)
+
+	// Experiment metrics
+	experimentExposuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "experiment_exposures_total",
+			Help: "Total number of experiment exposure events",
+		},
+		[]string{"experiment", "variant"},
+	)
+
+	// Event publishing metrics
+	eventsPublishedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "events_published_total",
+			Help: "Total number of user events handed to the message broker, by result",
+		},
+		[]string{"broker", "type", "result"},
+	)
+
+	eventPublishDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "event_publish_duration_seconds",
+			Help:    "Time to deliver an event to the message broker, including retries",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"broker"},
+	)
+
+	// Mail metrics
+	mailDeliveriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mail_deliveries_total",
+			Help: "Total number of emails handed to the mail provider, by template and result",
+		},
+		[]string{"provider", "template", "result"},
+	)
+
+	mailDeliveryDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "mail_delivery_duration_seconds",
+			Help:    "Time to deliver an email to the mail provider, including retries",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"provider"},
+	)
+
+	// SMS metrics
+	smsMessagesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sms_messages_total",
+			Help: "Total number of text messages sent through the SMS provider, by purpose and result",
+		},
+		[]string{"provider", "purpose", "result"},
+	)
+
+	smsDeliveryReportsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sms_delivery_reports_total",
+			Help: "Total number of delivery status reports received from the SMS provider, by status",
+		},
+		[]string{"provider", "status"},
+	)
+
+	// Anomaly detection metrics
+	securityFindingsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "security_findings_total",
+			Help: "Total number of suspicious authentication events found by anomaly detection, by analyzer and severity",
+		},
+		[]string{"analyzer", "severity"},
+	)
+
+	securityAlertsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "security_alerts_total",
+			Help: "Total number of anomaly detection alerts sent to the webhook, by result",
+		},
+		[]string{"result"},
+	)
+
+	enumerationAttemptsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "enumeration_attempts_total",
+			Help: "Total number of suspected account enumeration attempts, by endpoint and signal",
+		},
+		[]string{"endpoint", "signal"},
+	)
+
+	databaseOutagesTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "database_outages_total",
+			Help: "Total number of times the database connection was lost and the circuit breaker opened",
+		},
+	)
+
+	databaseCircuitOpen = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "database_circuit_open",
+			Help: "1 while the database is unreachable and queries fail fast, 0 otherwise",
+		},
+	)
+
+	// SLO metrics
+	sloCompliance = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "slo_compliance_ratio",
+			Help: "Fraction of requests meeting the objective over the SLO window",
+		},
+		[]string{"endpoint", "objective"},
+	)
+
+	sloErrorBudgetRemaining = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "slo_error_budget_remaining_ratio",
+			Help: "Fraction of the error budget left over the SLO window; negative when overspent",
+		},
+		[]string{"endpoint", "objective"},
+	)
+
+	// Scheduled task metrics
+	taskRunsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "scheduled_task_runs_total",
+			Help: "Total number of scheduled task runs, by result",
+		},
+		[]string{"task", "result"},
+	)
+
+	taskRunDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "scheduled_task_duration_seconds",
+			Help:    "Scheduled task run duration in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"task"},
+	)
+
+	// Panics recovered by the REST middleware and the gRPC interceptor
+	panicsRecoveredTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "panics_recovered_total",
+			Help: "Total number of handler panics recovered, by transport and route or gRPC method",
+		},
+		[]string{"transport", "endpoint"},
+	)
+
+	// Build metrics
+	buildInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "build_info",
+			Help: "Always 1, labeled with the version, commit and build time of the running binary",
+		},
+		[]string{"version", "commit", "build_time", "go_version"},
+	)
 )
 
+// Default histogram buckets, overridden by METRICS_LATENCY_BUCKETS and METRICS_SIZE_BUCKETS
+var (
+	DefaultLatencyBuckets = prometheus.DefBuckets
+	// 64B to 1MiB
+	DefaultSizeBuckets = prometheus.ExponentialBuckets(64, 4, 8)
+)
+
+func newHTTPRequestDuration(buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request duration in seconds",
+			Buckets: buckets,
+		},
+		[]string{"method", "endpoint"},
+	)
+}
+
+func newGRPCRequestDuration(buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "grpc_request_duration_seconds",
+			Help:    "gRPC request duration in seconds",
+			Buckets: buckets,
+		},
+		[]string{"method"},
+	)
+}
+
+func newHTTPSizeHistogram(name, help string, buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    name,
+			Help:    help,
+			Buckets: buckets,
+		},
+		[]string{"method", "endpoint"},
+	)
+}
+
+// configureBuckets rebuilds the request histograms with the configured
+// buckets. It must run before the collectors are registered.
+func configureBuckets(latency, size []float64) {
+	if len(latency) > 0 {
+		httpRequestDuration = newHTTPRequestDuration(latency)
+		grpcRequestDuration = newGRPCRequestDuration(latency)
+	}
+	if len(size) > 0 {
+		httpRequestSize = newHTTPSizeHistogram("http_request_size_bytes", "HTTP request body size in bytes", size)
+		httpResponseSize = newHTTPSizeHistogram("http_response_size_bytes", "HTTP response body size in bytes, as sent", size)
+	}
+}
+
+// allCollectors are registered with the default registry by Init
+func allCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		httpRequestsTotal,
+		httpRequestDuration,
+		httpRequestSize,
+		httpResponseSize,
+		httpRequestsInFlight,
+		grpcRequestsTotal,
+		grpcRequestDuration,
+		grpcRequestsInFlight,
+		dbOperationsTotal,
+		dbOperationDuration,
+		dbQueryDuration,
+		healthCheckStatus,
+		experimentExposuresTotal,
+		eventsPublishedTotal,
+		eventPublishDuration,
+		mailDeliveriesTotal,
+		mailDeliveryDuration,
+		smsMessagesTotal,
+		smsDeliveryReportsTotal,
+		securityFindingsTotal,
+		securityAlertsTotal,
+		enumerationAttemptsTotal,
+		databaseOutagesTotal,
+		databaseCircuitOpen,
+		sloCompliance,
+		sloErrorBudgetRemaining,
+		taskRunsTotal,
+		taskRunDuration,
+		panicsRecoveredTotal,
+		buildInfo,
+	}
+}
+
+// UnmatchedEndpoint labels requests that did not match any route, so that
+// arbitrary paths (scanners, typos) don't each create a new series
+const UnmatchedEndpoint = "unmatched"
+
 // PrometheusMiddleware creates a Gin middleware for Prometheus metrics
 func PrometheusMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
-		path := c.Request.URL.Path
 		method := c.Request.Method
+		requestSize := c.Request.ContentLength
+		safely(httpRequestsInFlight.Inc)
+		defer safely(httpRequestsInFlight.Dec)
 
 		// Process request
 		c.Next()
@@ -92,15 +352,40 @@ func PrometheusMiddleware() gin.HandlerFunc {
 		// Record metrics
 		duration := time.Since(start).Seconds()
 		statusCode := c.Writer.Status()
+		endpoint := EndpointLabel(c)
 
-		RecordHTTPRequest(method, path, statusCode, duration)
+		RecordHTTPRequest(method, endpoint, statusCode, duration)
+		RecordHTTPSizes(method, endpoint, requestSize, int64(c.Writer.Size()))
 	}
 }
 
+// EndpointLabel returns the route template (e.g. /users/:id) matched by the
+// request rather than the raw URL path, keeping label cardinality bounded
+func EndpointLabel(c *gin.Context) string {
+	if route := c.FullPath(); route != "" {
+		return route
+	}
+	return UnmatchedEndpoint
+}
+
 // RecordHTTPRequest records HTTP request metrics
-func RecordHTTPRequest(method, path string, statusCode int, duration float64) {
-	httpRequestsTotal.WithLabelValues(method, path, string(rune(statusCode))).Inc()
-	httpRequestDuration.WithLabelValues(method, path).Observe(duration)
+func RecordHTTPRequest(method, endpoint string, statusCode int, duration float64) {
+	safely(func() {
+		httpRequestsTotal.WithLabelValues(method, endpoint, strconv.Itoa(statusCode)).Inc()
+		httpRequestDuration.WithLabelValues(method, endpoint).Observe(duration)
+	})
+}
+
+// RecordHTTPSizes records request and response body sizes. A negative
+// request size (unknown, e.g. chunked) is not recorded; a negative response
+// size means nothing was written.
+func RecordHTTPSizes(method, endpoint string, requestSize, responseSize int64) {
+	safely(func() {
+		if requestSize >= 0 {
+			httpRequestSize.WithLabelValues(method, endpoint).Observe(float64(requestSize))
+		}
+		httpResponseSize.WithLabelValues(method, endpoint).Observe(float64(max(responseSize, 0)))
+	})
 }
 
 // GrpcPrometheusInterceptor creates a gRPC interceptor for Prometheus metrics
@@ -108,6 +393,8 @@ func GrpcPrometheusInterceptor() grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		start := time.Now()
 		method := info.FullMethod
+		safely(grpcRequestsInFlight.Inc)
+		defer safely(grpcRequestsInFlight.Dec)
 
 		// Process request
 		resp, err := handler(ctx, req)
@@ -116,8 +403,10 @@ func GrpcPrometheusInterceptor() grpc.UnaryServerInterceptor {
 		duration := time.Since(start).Seconds()
 		statusCode := grpc.Code(err).String()
 
-		grpcRequestsTotal.WithLabelValues(method, statusCode).Inc()
-		grpcRequestDuration.WithLabelValues(method).Observe(duration)
+		safely(func() {
+			grpcRequestsTotal.WithLabelValues(method, statusCode).Inc()
+			grpcRequestDuration.WithLabelValues(method).Observe(duration)
+		})
 
 		return resp, err
 	}
@@ -125,8 +414,17 @@ func GrpcPrometheusInterceptor() grpc.UnaryServerInterceptor {
 
 // RecordDatabaseOperation records metrics for database operations
 func RecordDatabaseOperation(operation, table, status string, duration time.Duration) {
-	dbOperationsTotal.WithLabelValues(operation, table, status).Inc()
-	dbOperationDuration.WithLabelValues(operation, table).Observe(duration.Seconds())
+	safely(func() {
+		dbOperationsTotal.WithLabelValues(operation, table, status).Inc()
+		dbOperationDuration.WithLabelValues(operation, table).Observe(duration.Seconds())
+	})
+}
+
+// RecordQuery records the duration of a SQL statement
+func RecordQuery(query string, duration time.Duration) {
+	safely(func() {
+		dbQueryDuration.WithLabelValues(query).Observe(duration.Seconds())
+	})
 }
 
 // UpdateHealthStatus updates the health check status metric
@@ -135,39 +433,154 @@ func UpdateHealthStatus(service string, healthy bool) {
 	if healthy {
 		status = 1.0
 	}
-	healthCheckStatus.WithLabelValues(service).Set(status)
+	safely(func() {
+		healthCheckStatus.WithLabelValues(service).Set(status)
+	})
+}
+
+// RecordExperimentExposure counts an experiment exposure event
+func RecordExperimentExposure(experiment, variant string) {
+	safely(func() {
+		experimentExposuresTotal.WithLabelValues(experiment, variant).Inc()
+	})
+}
+
+// RecordEventPublish records the outcome of publishing an event. Dropped
+// events are recorded without a duration.
+func RecordEventPublish(broker, eventType, result string, duration time.Duration) {
+	safely(func() {
+		eventsPublishedTotal.WithLabelValues(broker, eventType, result).Inc()
+		if duration > 0 {
+			eventPublishDuration.WithLabelValues(broker).Observe(duration.Seconds())
+		}
+	})
+}
+
+// RecordMailDelivery records the outcome of sending an email. Dropped
+// messages are recorded without a duration.
+func RecordMailDelivery(provider, template, result string, duration time.Duration) {
+	safely(func() {
+		mailDeliveriesTotal.WithLabelValues(provider, template, result).Inc()
+		if duration > 0 {
+			mailDeliveryDuration.WithLabelValues(provider).Observe(duration.Seconds())
+		}
+	})
+}
+
+// RecordSMSMessage records the outcome of sending a text message
+func RecordSMSMessage(provider, purpose, result string) {
+	safely(func() {
+		smsMessagesTotal.WithLabelValues(provider, purpose, result).Inc()
+	})
+}
+
+// RecordSMSDeliveryReport records a delivery status reported by the SMS provider
+func RecordSMSDeliveryReport(provider, status string) {
+	safely(func() {
+		smsDeliveryReportsTotal.WithLabelValues(provider, status).Inc()
+	})
+}
+
+// RecordSecurityFinding records a suspicious authentication event
+func RecordSecurityFinding(analyzer, severity string) {
+	safely(func() {
+		securityFindingsTotal.WithLabelValues(analyzer, severity).Inc()
+	})
+}
+
+// RecordSecurityAlert records the outcome of sending an anomaly alert
+func RecordSecurityAlert(result string) {
+	safely(func() {
+		securityAlertsTotal.WithLabelValues(result).Inc()
+	})
+}
+
+// RecordEnumerationAttempt records a request that may be probing which
+// accounts exist
+func RecordEnumerationAttempt(endpoint, signal string) {
+	safely(func() {
+		enumerationAttemptsTotal.WithLabelValues(endpoint, signal).Inc()
+	})
+}
+
+// RecordDatabaseCircuit records the database circuit breaker opening, on
+// losing the connection, or closing again
+func RecordDatabaseCircuit(open bool) {
+	safely(func() {
+		if open {
+			databaseOutagesTotal.Inc()
+			databaseCircuitOpen.Set(1)
+		} else {
+			databaseCircuitOpen.Set(0)
+		}
+	})
+}
+
+// UpdateSLO exports an endpoint's compliance and remaining error budget for
+// one objective ("availability" or "latency")
+func UpdateSLO(endpoint, objective string, compliance, budgetRemaining float64) {
+	safely(func() {
+		sloCompliance.WithLabelValues(endpoint, objective).Set(compliance)
+		sloErrorBudgetRemaining.WithLabelValues(endpoint, objective).Set(budgetRemaining)
+	})
+}
+
+// RecordTaskRun records the outcome of a scheduled task run
+func RecordTaskRun(task, result string, duration time.Duration) {
+	safely(func() {
+		taskRunsTotal.WithLabelValues(task, result).Inc()
+		taskRunDuration.WithLabelValues(task).Observe(duration.Seconds())
+	})
+}
+
+// RecordPanic counts a recovered panic; transport is "http" or "grpc"
+func RecordPanic(transport, endpoint string) {
+	safely(func() {
+		panicsRecoveredTotal.WithLabelValues(transport, endpoint).Inc()
+	})
 }
 
 // SetupMetricsRoutes sets up the /metrics endpoint
 func SetupMetricsRoutes(r *gin.Engine) {
-	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	metricsHandler := gin.WrapH(promhttp.Handler())
+	r.GET("/metrics", func(c *gin.Context) {
+		if !Enabled() {
+			c.JSON(503, gin.H{"error": "Metrics are disabled"})
+			return
+		}
+		metricsHandler(c)
+	})
 }
 
-// HealthCheckHandler handles the /healthz endpoint
-func HealthCheckHandler(c *gin.Context) {
-	// Check database connectivity
-	start := time.Now()
-	err := database.GetDB().Exec("SELECT 1").Error
-	duration := time.Since(start)
+// HealthCheckHandler handles the /healthz endpoint, using pingDB to check
+// database connectivity
+func HealthCheckHandler(pingDB CheckFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		err := pingDB(c.Request.Context())
+		duration := time.Since(start)
 
-	healthy := err == nil
-	UpdateHealthStatus("database", healthy)
+		healthy := err == nil
+		UpdateHealthStatus("database", healthy)
 
-	if healthy {
-		RecordDatabaseOperation("health_check", "users", "success", duration)
-		c.JSON(200, gin.H{
-			"status":    "healthy",
-			"timestamp": time.Now().Format(time.RFC3339),
-			"database":  "connected",
-		})
-	} else {
-		RecordDatabaseOperation("health_check", "users", "error", duration)
-		logger.Log.Error("Health check failed - database unreachable", "error", err)
-		c.JSON(500, gin.H{
-			"status":    "unhealthy",
-			"timestamp": time.Now().Format(time.RFC3339),
-			"database":  "disconnected",
-			"error":     err.Error(),
-		})
+		if healthy {
+			RecordDatabaseOperation("health_check", "users", "success", duration)
+			c.JSON(200, gin.H{
+				"status":    "healthy",
+				"timestamp": time.Now().Format(time.RFC3339),
+				"database":  "connected",
+				"log_level": logger.CurrentLevels().Default.String(),
+			})
+		} else {
+			RecordDatabaseOperation("health_check", "users", "error", duration)
+			logger.Log.Error("Health check failed - database unreachable", "error", err)
+			c.JSON(500, gin.H{
+				"status":    "unhealthy",
+				"timestamp": time.Now().Format(time.RFC3339),
+				"database":  "disconnected",
+				"error":     err.Error(),
+				"log_level": logger.CurrentLevels().Default.String(),
+			})
+		}
 	}
 }
@@ -0,0 +1,169 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestRecordHTTPRequestStatusLabel(t *testing.T) {
+	httpRequestsTotal.Reset()
+
+	RecordHTTPRequest("GET", "/users/:id", 404, 0.01)
+
+	if got := testutil.ToFloat64(httpRequestsTotal.WithLabelValues("GET", "/users/:id", "404")); got != 1 {
+		t.Fatalf("expected one request with status_code=404, got %v", got)
+	}
+}
+
+func TestPrometheusMiddlewareUsesRouteTemplate(t *testing.T) {
+	httpRequestsTotal.Reset()
+
+	r := gin.New()
+	r.Use(PrometheusMiddleware())
+	r.GET("/users/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, path := range []string{"/users/1", "/users/2", "/users/3"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := testutil.ToFloat64(httpRequestsTotal.WithLabelValues("GET", "/users/:id", "200")); got != 3 {
+		t.Fatalf("expected 3 requests labelled with the route template, got %v", got)
+	}
+	if got := testutil.CollectAndCount(httpRequestsTotal); got != 1 {
+		t.Fatalf("expected a single series, got %d", got)
+	}
+}
+
+func TestPrometheusMiddlewareUnmatchedRoute(t *testing.T) {
+	httpRequestsTotal.Reset()
+
+	r := gin.New()
+	r.Use(PrometheusMiddleware())
+
+	for _, path := range []string{"/wp-admin", "/.env", "/random/path"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := testutil.ToFloat64(httpRequestsTotal.WithLabelValues("GET", UnmatchedEndpoint, "404")); got != 3 {
+		t.Fatalf("expected 3 unmatched requests, got %v", got)
+	}
+	if got := testutil.CollectAndCount(httpRequestsTotal); got != 1 {
+		t.Fatalf("expected a single series, got %d", got)
+	}
+}
+
+func TestPrometheusMiddlewareREDMetrics(t *testing.T) {
+	httpRequestSize.Reset()
+	httpResponseSize.Reset()
+
+	r := gin.New()
+	r.Use(PrometheusMiddleware())
+	r.POST("/users", func(c *gin.Context) {
+		if got := testutil.ToFloat64(httpRequestsInFlight); got != 1 {
+			t.Errorf("expected one request in flight, got %v", got)
+		}
+		c.String(http.StatusCreated, strings.Repeat("x", 300))
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name":"alice"}`)))
+
+	if got := testutil.ToFloat64(httpRequestsInFlight); got != 0 {
+		t.Fatalf("expected no requests in flight after the response, got %v", got)
+	}
+	if got := histogramSum(t, httpRequestSize.WithLabelValues("POST", "/users")); got != 16 {
+		t.Fatalf("expected a 16 byte request, got %v", got)
+	}
+	if got := histogramSum(t, httpResponseSize.WithLabelValues("POST", "/users")); got != 300 {
+		t.Fatalf("expected a 300 byte response, got %v", got)
+	}
+}
+
+func TestConfigureBuckets(t *testing.T) {
+	previous := httpRequestDuration
+	defer func() { httpRequestDuration = previous }()
+
+	configureBuckets([]float64{0.1, 1}, nil)
+	httpRequestDuration.WithLabelValues("GET", "/").Observe(0.5)
+
+	var m dto.Metric
+	if err := httpRequestDuration.WithLabelValues("GET", "/").(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(m.GetHistogram().GetBucket()); got != 2 {
+		t.Fatalf("expected the 2 configured buckets, got %d", got)
+	}
+}
+
+// TestGeneratedMonitoringFiles fails when the committed dashboard or rules
+// are stale; regenerate them with make dashboards
+func TestGeneratedMonitoringFiles(t *testing.T) {
+	dashboard, err := Dashboard()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string][]byte{
+		"../../monitoring/grafana-dashboard.json": dashboard,
+		"../../monitoring/recording-rules.yml":    RecordingRulesYAML(),
+	} {
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s is out of date; run make dashboards", path)
+		}
+	}
+}
+
+func histogramSum(t *testing.T, observer prometheus.Observer) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := observer.(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleSum()
+}
+
+func TestRuntimeCollector(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectors.NewGoCollector())
+	if err := registerRuntimeCollector(reg); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, family := range families {
+		names[family.GetName()] = true
+	}
+	for _, name := range []string{"go_goroutines", "go_memstats_heap_alloc_bytes", "go_gc_pauses_seconds", "go_sched_latencies_seconds"} {
+		if !names[name] {
+			t.Errorf("expected %s to be exported", name)
+		}
+	}
+}
+
+func TestRecordPanic(t *testing.T) {
+	before := testutil.ToFloat64(panicsRecoveredTotal.WithLabelValues("grpc", "/user.UserService/GetUser"))
+	RecordPanic("grpc", "/user.UserService/GetUser")
+	if got := testutil.ToFloat64(panicsRecoveredTotal.WithLabelValues("grpc", "/user.UserService/GetUser")); got != before+1 {
+		t.Fatalf("panics_recovered_total: expected %v, got %v", before+1, got)
+	}
+}
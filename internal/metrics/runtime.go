@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// newRuntimeCollector exports Go runtime metrics beyond the default set:
+// GC pause and scheduler latency histograms and a heap breakdown, alongside
+// go_goroutines and the go_memstats_* gauges
+func newRuntimeCollector() prometheus.Collector {
+	return collectors.NewGoCollector(collectors.WithGoCollectorRuntimeMetrics(
+		collectors.MetricsGC,
+		collectors.MetricsMemory,
+		collectors.MetricsScheduler,
+	))
+}
+
+// registerRuntimeCollector replaces the registry's default Go collector
+// with newRuntimeCollector
+func registerRuntimeCollector(reg prometheus.Registerer) error {
+	reg.Unregister(collectors.NewGoCollector())
+	return reg.Register(newRuntimeCollector())
+}
@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+
+	"github.com/114windd/restapi/internal/config"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/version"
+)
+
+// Observability subsystems reported by the status endpoint
+const (
+	SubsystemRegistry = "metrics_registry"
+	SubsystemPush     = "metrics_push"
+)
+
+// SubsystemStatus is the health of one observability subsystem
+type SubsystemStatus struct {
+	Status    string    `json:"status"` // "ok", "degraded" or "disabled"
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+var (
+	// disabled is set once metrics recording has failed; the API keeps serving without metrics
+	disabled atomic.Bool
+
+	statusMu sync.RWMutex
+	statuses = map[string]SubsystemStatus{}
+)
+
+// Enabled reports whether metrics are being recorded
+func Enabled() bool {
+	return !disabled.Load()
+}
+
+// Init registers the collectors and, when configured, starts pushing to a
+// Pushgateway. Failures disable metrics with a warning instead of aborting.
+func Init(cfg config.MetricsConfig) {
+	if !cfg.Enabled {
+		disable(SubsystemRegistry, errors.New("disabled by configuration"))
+		return
+	}
+
+	configureBuckets(cfg.LatencyBuckets, cfg.SizeBuckets)
+	for _, collector := range allCollectors() {
+		if err := prometheus.Register(collector); err != nil {
+			var already prometheus.AlreadyRegisteredError
+			if errors.As(err, &already) {
+				continue
+			}
+			disable(SubsystemRegistry, err)
+			return
+		}
+	}
+	if err := registerRuntimeCollector(prometheus.DefaultRegisterer); err != nil {
+		var already prometheus.AlreadyRegisteredError
+		if !errors.As(err, &already) {
+			logger.Log.WithError(err).Warn("Failed to register Go runtime metrics")
+		}
+	}
+	build := version.Get()
+	buildInfo.WithLabelValues(build.Version, build.Commit, build.BuildTime, build.GoVersion).Set(1)
+	setStatus(SubsystemRegistry, "ok", nil)
+
+	if cfg.PushURL != "" {
+		go pushLoop(push.New(cfg.PushURL, cfg.PushJob).Gatherer(prometheus.DefaultGatherer), cfg.PushInterval)
+	}
+}
+
+// pushLoop pushes metrics periodically. Push failures are reported as
+// degraded but never affect request handling.
+func pushLoop(pusher *push.Pusher, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !Enabled() {
+			continue
+		}
+		if err := pusher.Push(); err != nil {
+			if currentStatus(SubsystemPush).Status != "degraded" {
+				logger.Log.WithError(err).Warn("Failed to push metrics")
+			}
+			setStatus(SubsystemPush, "degraded", err)
+			continue
+		}
+		setStatus(SubsystemPush, "ok", nil)
+	}
+}
+
+// safely runs a metrics update, disabling metrics instead of propagating a panic
+func safely(record func()) {
+	if !Enabled() {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			disable(SubsystemRegistry, errors.New("panic while recording metrics"))
+		}
+	}()
+	record()
+}
+
+// disable turns metrics recording off and records why
+func disable(subsystem string, err error) {
+	disabled.Store(true)
+	setStatus(subsystem, "disabled", err)
+	if logger.Log != nil {
+		logger.Log.WithError(err).WithField("subsystem", subsystem).Warn("Metrics disabled, continuing without them")
+	}
+}
+
+func setStatus(subsystem, status string, err error) {
+	s := SubsystemStatus{Status: status, UpdatedAt: time.Now()}
+	if err != nil {
+		s.Error = err.Error()
+	}
+
+	statusMu.Lock()
+	statuses[subsystem] = s
+	statusMu.Unlock()
+}
+
+func currentStatus(subsystem string) SubsystemStatus {
+	statusMu.RLock()
+	defer statusMu.RUnlock()
+	return statuses[subsystem]
+}
+
+// ObservabilityStatusHandler reports the health of the observability subsystems
+func ObservabilityStatusHandler(c *gin.Context) {
+	statusMu.RLock()
+	subsystems := make(map[string]SubsystemStatus, len(statuses))
+	for name, s := range statuses {
+		subsystems[name] = s
+	}
+	statusMu.RUnlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"metrics_enabled": Enabled(),
+		"subsystems":      subsystems,
+	})
+}
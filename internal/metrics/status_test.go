@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/config"
+)
+
+// resetStatus restores metrics recording and clears the reported statuses
+// once the test is done
+func resetStatus(t *testing.T) {
+	t.Cleanup(func() {
+		disabled.Store(false)
+		statusMu.Lock()
+		statuses = map[string]SubsystemStatus{}
+		statusMu.Unlock()
+	})
+}
+
+func observabilityStatus(t *testing.T) (enabled bool, subsystems map[string]SubsystemStatus) {
+	r := gin.New()
+	r.GET("/internal/observability", ObservabilityStatusHandler)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/internal/observability", nil))
+
+	var body struct {
+		MetricsEnabled bool                       `json:"metrics_enabled"`
+		Subsystems     map[string]SubsystemStatus `json:"subsystems"`
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /internal/observability: expected 200, got %d", w.Code)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return body.MetricsEnabled, body.Subsystems
+}
+
+func TestObservabilityStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		degrade func()
+		status  string
+		error   string
+	}{
+		{name: "disabled by configuration", degrade: func() { Init(config.MetricsConfig{}) }, status: "disabled", error: "disabled by configuration"},
+		{name: "panic while recording", degrade: func() { safely(func() { panic("bad label") }) }, status: "disabled", error: "panic while recording metrics"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetStatus(t)
+			setStatus(SubsystemRegistry, "ok", nil)
+			if enabled, subsystems := observabilityStatus(t); !enabled || subsystems[SubsystemRegistry].Status != "ok" {
+				t.Fatalf("before: enabled %v, subsystems %+v", enabled, subsystems)
+			}
+
+			tt.degrade()
+			enabled, subsystems := observabilityStatus(t)
+			registry := subsystems[SubsystemRegistry]
+			if enabled || Enabled() || registry.Status != tt.status || registry.Error != tt.error || registry.UpdatedAt.IsZero() {
+				t.Fatalf("after: enabled %v, registry %+v", enabled, registry)
+			}
+		})
+	}
+}
+
+func TestSafelyWhenDisabled(t *testing.T) {
+	resetStatus(t)
+	disabled.Store(true)
+
+	called := false
+	safely(func() { called = true })
+	if called {
+		t.Fatal("metrics were recorded while disabled")
+	}
+}
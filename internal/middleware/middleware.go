@@ -0,0 +1,136 @@
+// Package middleware builds the cross-cutting layers of the API, such as
+// request IDs, logging, metrics, authentication, rate limiting and panic
+// recovery, as one chain that yields both the gin middleware of the REST
+// router and the interceptors of the gRPC server. A concern added to the
+// chain therefore reaches both protocols, in the same order.
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+
+	"github.com/114windd/restapi/internal/api"
+	"github.com/114windd/restapi/internal/auth"
+	"github.com/114windd/restapi/internal/config"
+	"github.com/114windd/restapi/internal/errorreporting"
+	"github.com/114windd/restapi/internal/geoip"
+	grpcserver "github.com/114windd/restapi/internal/grpc"
+	"github.com/114windd/restapi/internal/i18n"
+	"github.com/114windd/restapi/internal/metrics"
+	"github.com/114windd/restapi/internal/router"
+	"github.com/114windd/restapi/internal/slo"
+)
+
+// Layer is one concern, implemented for each protocol it applies to. A nil
+// HTTP or GRPC means the concern doesn't apply to that protocol, or is
+// enforced elsewhere (REST authentication and rate limits are per route).
+type Layer struct {
+	Name string
+	HTTP gin.HandlerFunc
+	GRPC grpc.UnaryServerInterceptor
+	// UnaryOnly leaves the layer out of streaming calls
+	UnaryOnly bool
+}
+
+// Chain is an ordered list of layers; the first one runs outermost
+type Chain []Layer
+
+// Options are the configuration and components the layers are built from
+type Options struct {
+	Config   *config.Config
+	Errors   *errorreporting.Reporter
+	Messages *i18n.Catalog
+	Tokens   *auth.Tokens
+	CORS     *api.CORS
+	SLO      *slo.Tracker
+	// Limiter enforces rate limit classes on gRPC calls; nil disables it
+	Limiter *router.Limiter
+	// Uploads are the body limits of upload routes, by full path
+	Uploads map[string]int64
+	// Forms are the full paths of routes accepting URL-encoded forms
+	Forms map[string]bool
+	// TimeRendering renders timestamps in the caller's time zone (REST only)
+	TimeRendering gin.HandlerFunc
+	// GeoIP locates clients in request logs; nil leaves locations out
+	GeoIP *geoip.Locator
+	// DatabaseUnavailable reports a database outage, turning server errors
+	// into 503s meanwhile; nil leaves them as they are
+	DatabaseUnavailable func() bool
+}
+
+// New builds the chain of the API server from opts
+func New(opts Options) Chain {
+	cfg := opts.Config
+	chain := Chain{
+		{Name: "request_id", HTTP: api.RequestIDMiddleware(), GRPC: grpcserver.RequestIDInterceptor()},
+		{Name: "security_headers", HTTP: api.SecurityHeadersMiddleware(cfg.Security)},
+		{Name: "cors", HTTP: opts.CORS.Middleware()},
+		{Name: "request_hardening", HTTP: api.RequestHardeningMiddleware(cfg.Security, opts.Uploads, opts.Forms)},
+		{Name: "tenant", HTTP: api.TenantMiddleware(cfg.Database.Tenants)},
+		{Name: "metrics", HTTP: metrics.PrometheusMiddleware(), GRPC: metrics.GrpcPrometheusInterceptor()},
+		{Name: "slo", HTTP: opts.SLO.Middleware()},
+		{Name: "localization", HTTP: api.LocalizationMiddleware(opts.Messages), GRPC: grpcserver.LocalizationInterceptor(opts.Messages)},
+		// gRPC identifies the caller (and tenant) for every call, so that it can be logged
+		{Name: "auth", GRPC: grpcserver.AuthInterceptor(opts.Tokens, cfg.Database.Tenants)},
+		{Name: "logging", HTTP: api.LoggingMiddleware(cfg.Logging, opts.GeoIP), GRPC: grpcserver.LoggingInterceptor(opts.GeoIP)},
+	}
+	if cfg.API.Compression {
+		chain = append(chain, Layer{Name: "compression", HTTP: api.CompressionMiddleware(cfg.API.CompressionMinSize)})
+	}
+	chain = append(chain, Layer{Name: "time_rendering", HTTP: opts.TimeRendering})
+	if opts.Limiter != nil {
+		chain = append(chain, Layer{Name: "rate_limit", GRPC: grpcserver.RateLimitInterceptor(opts.Limiter)})
+	}
+	chain = append(chain, Layer{Name: "recovery", HTTP: api.RecoveryMiddleware(opts.Errors), GRPC: grpcserver.RecoveryInterceptor(opts.Errors)})
+	if opts.DatabaseUnavailable != nil {
+		chain = append(chain, Layer{Name: "database_outage", HTTP: api.DatabaseOutageMiddleware(opts.DatabaseUnavailable), GRPC: grpcserver.DatabaseOutageInterceptor(opts.DatabaseUnavailable)})
+	}
+	if cfg.Database.SessionSettings {
+		chain = append(chain, Layer{Name: "db_session", HTTP: api.DBSessionMiddleware(cfg.Database), GRPC: grpcserver.DBSessionInterceptor(cfg.Database)})
+	}
+	// REST routes set their own timeouts, and streams such as StreamUsers may
+	// outlast the request timeout
+	if cfg.API.RequestTimeout > 0 {
+		chain = append(chain, Layer{Name: "deadline", GRPC: grpcserver.DeadlineInterceptor(cfg.API.RequestTimeout), UnaryOnly: true})
+	}
+	return chain
+}
+
+// Gin returns the chain's gin middleware, for gin.Engine.Use
+func (c Chain) Gin() []gin.HandlerFunc {
+	var handlers []gin.HandlerFunc
+	for _, layer := range c {
+		if layer.HTTP != nil {
+			handlers = append(handlers, layer.HTTP)
+		}
+	}
+	return handlers
+}
+
+// Unary returns the chain's interceptors for unary gRPC calls
+func (c Chain) Unary() []grpc.UnaryServerInterceptor {
+	return c.interceptors(false)
+}
+
+// Stream returns the chain's interceptor for streaming gRPC calls
+func (c Chain) Stream() grpc.StreamServerInterceptor {
+	return grpcserver.StreamInterceptor(c.interceptors(true)...)
+}
+
+// ServerOptions install the chain on a gRPC server
+func (c Chain) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(c.Unary()...),
+		grpc.ChainStreamInterceptor(c.Stream()),
+	}
+}
+
+func (c Chain) interceptors(stream bool) []grpc.UnaryServerInterceptor {
+	var interceptors []grpc.UnaryServerInterceptor
+	for _, layer := range c {
+		if layer.GRPC != nil && !(stream && layer.UnaryOnly) {
+			interceptors = append(interceptors, layer.GRPC)
+		}
+	}
+	return interceptors
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+)
+
+func TestChain(t *testing.T) {
+	var calls []string
+	httpLayer := func(name string) gin.HandlerFunc {
+		return func(*gin.Context) { calls = append(calls, "http:"+name) }
+	}
+	grpcLayer := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			calls = append(calls, "grpc:"+name)
+			return handler(ctx, req)
+		}
+	}
+	chain := Chain{
+		{Name: "both", HTTP: httpLayer("both"), GRPC: grpcLayer("both")},
+		{Name: "http", HTTP: httpLayer("http")},
+		{Name: "unary", GRPC: grpcLayer("unary"), UnaryOnly: true},
+	}
+
+	for _, handler := range chain.Gin() {
+		handler(nil)
+	}
+	noop := func(context.Context, interface{}) (interface{}, error) { return nil, nil }
+	for _, interceptor := range chain.Unary() {
+		_, _ = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{}, noop)
+	}
+	for _, interceptor := range chain.interceptors(true) {
+		_, _ = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{}, noop)
+	}
+
+	want := "http:both http:http grpc:both grpc:unary grpc:both"
+	if got := strings.Join(calls, " "); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,95 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+)
+
+// GitHubProvider signs users in with GitHub, which speaks plain OAuth2
+// rather than OpenID Connect, so the identity comes from its REST API
+type GitHubProvider struct {
+	config oauth2.Config
+	apiURL string
+}
+
+// NewGitHubProvider creates a GitHub provider
+func NewGitHubProvider(clientID, clientSecret, redirectURL string) *GitHubProvider {
+	return &GitHubProvider{
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Endpoint:     github.Endpoint,
+			Scopes:       []string{"read:user", "user:email"},
+		},
+		apiURL: "https://api.github.com",
+	}
+}
+
+// AuthCodeURL implements Provider. GitHub has no ID token, so nonce is unused.
+func (p *GitHubProvider) AuthCodeURL(state, nonce string) string {
+	return p.config.AuthCodeURL(state)
+}
+
+// Exchange implements Provider
+func (p *GitHubProvider) Exchange(ctx context.Context, code, nonce string) (*Identity, error) {
+	token, err := p.config.Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("exchange code: %w", err)
+	}
+	client := p.config.Client(ctx, token)
+
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	if err := p.get(client, "/user", &user); err != nil {
+		return nil, err
+	}
+
+	// The profile email is optional and may be unverified; use the verified primary address
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := p.get(client, "/user/emails", &emails); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{Subject: strconv.FormatInt(user.ID, 10), Name: user.Name}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+	for _, e := range emails {
+		if e.Primary {
+			identity.Email, identity.EmailVerified = e.Email, e.Verified
+		}
+	}
+	return identity, nil
+}
+
+func (p *GitHubProvider) get(client *http.Client, path string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, p.apiURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("GitHub %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GitHub %s: status %d", path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
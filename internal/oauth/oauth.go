@@ -0,0 +1,66 @@
+// Package oauth signs users in through external OAuth2 and OpenID Connect
+// providers such as Google and GitHub.
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/114windd/restapi/internal/config"
+)
+
+// Supported providers
+const (
+	ProviderGoogle = "google"
+	ProviderGitHub = "github"
+)
+
+// googleIssuer is Google's OpenID Connect issuer
+const googleIssuer = "https://accounts.google.com"
+
+// ErrNoVerifiedEmail is returned when the provider can't vouch for an email address
+var ErrNoVerifiedEmail = errors.New("provider returned no verified email address")
+
+// Identity is a user as known to an external provider
+type Identity struct {
+	Subject       string // Stable ID of the user at the provider
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider runs the authorization code flow against one external provider
+type Provider interface {
+	// AuthCodeURL returns the provider's consent page URL. state and nonce
+	// come back to the callback and in the ID token respectively.
+	AuthCodeURL(state, nonce string) string
+	// Exchange trades the code passed to the callback for the user's identity
+	Exchange(ctx context.Context, code, nonce string) (*Identity, error)
+}
+
+// CallbackPath is where providers redirect back to, relative to the API root
+func CallbackPath(provider string) string {
+	return "/api/v1/auth/" + provider + "/callback"
+}
+
+// New creates the providers with client credentials in cfg, keyed by name
+func New(cfg config.OAuthConfig) (map[string]Provider, error) {
+	providers := map[string]Provider{}
+	base := strings.TrimSuffix(cfg.RedirectBaseURL, "/")
+
+	if cfg.GoogleClientID != "" {
+		if base == "" {
+			return nil, fmt.Errorf("OAUTH_REDIRECT_BASE_URL is required for %s login", ProviderGoogle)
+		}
+		providers[ProviderGoogle] = NewOIDCProvider(googleIssuer, cfg.GoogleClientID, cfg.GoogleClientSecret, base+CallbackPath(ProviderGoogle))
+	}
+	if cfg.GitHubClientID != "" {
+		if base == "" {
+			return nil, fmt.Errorf("OAUTH_REDIRECT_BASE_URL is required for %s login", ProviderGitHub)
+		}
+		providers[ProviderGitHub] = NewGitHubProvider(cfg.GitHubClientID, cfg.GitHubClientSecret, base+CallbackPath(ProviderGitHub))
+	}
+	return providers, nil
+}
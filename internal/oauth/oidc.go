@@ -0,0 +1,101 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDCProvider signs users in with an OpenID Connect provider
+type OIDCProvider struct {
+	issuer string
+	config oauth2.Config
+
+	// The discovery document is fetched on first use, so an unreachable
+	// provider doesn't prevent startup
+	mu       sync.Mutex
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDCProvider creates a provider for issuer, e.g. https://accounts.google.com
+func NewOIDCProvider(issuer, clientID, clientSecret, redirectURL string) *OIDCProvider {
+	return &OIDCProvider{
+		issuer: issuer,
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		},
+	}
+}
+
+// discover loads the provider's endpoints and signing keys
+func (p *OIDCProvider) discover(ctx context.Context) (*oidc.Provider, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.provider == nil {
+		provider, err := oidc.NewProvider(ctx, p.issuer)
+		if err != nil {
+			return nil, nil, fmt.Errorf("discover %s: %w", p.issuer, err)
+		}
+		p.provider = provider
+		p.verifier = provider.Verifier(&oidc.Config{ClientID: p.config.ClientID})
+		p.config.Endpoint = provider.Endpoint()
+	}
+	return p.provider, p.verifier, nil
+}
+
+// AuthCodeURL implements Provider. It returns an empty string when the
+// provider can't be reached.
+func (p *OIDCProvider) AuthCodeURL(state, nonce string) string {
+	if _, _, err := p.discover(context.Background()); err != nil {
+		return ""
+	}
+	return p.config.AuthCodeURL(state, oidc.Nonce(nonce))
+}
+
+// Exchange implements Provider, verifying the ID token's signature, audience and nonce
+func (p *OIDCProvider) Exchange(ctx context.Context, code, nonce string) (*Identity, error) {
+	_, verifier, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := p.config.Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("exchange code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response has no id_token")
+	}
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("verify id_token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("decode id_token claims: %w", err)
+	}
+	return &Identity{
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+	}, nil
+}
@@ -0,0 +1,243 @@
+// Package organization groups users into organizations. Owners manage an
+// organization and its members, members can see who else belongs to it,
+// and everyone else, admins aside, can't tell it exists.
+package organization
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/auth"
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/service"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+var (
+	// ErrNotFound is returned for organizations that don't exist or that the
+	// caller doesn't belong to, and for members not in the organization
+	ErrNotFound = errors.New("organization not found")
+	// ErrForbidden is returned when a member who isn't an owner tries to manage the organization
+	ErrForbidden = errors.New("only owners can manage the organization")
+	// ErrAlreadyMember is returned when adding a user who already belongs to the organization
+	ErrAlreadyMember = errors.New("user is already a member")
+	// ErrLastOwner is returned when a change would leave the organization without an owner
+	ErrLastOwner = errors.New("an organization needs at least one owner")
+)
+
+// Store persists organizations and memberships
+type Store interface {
+	CreateOrganization(ctx context.Context, org *models.Organization, owner *models.Membership) error
+	FindOrganization(ctx context.Context, id uint) (*models.Organization, error)
+	ListOrganizationsByUser(ctx context.Context, userID uint) ([]models.Organization, error)
+	UpdateOrganization(ctx context.Context, org *models.Organization) error
+	DeleteOrganization(ctx context.Context, id uint) error
+	FindMembership(ctx context.Context, orgID, userID uint) (*models.Membership, error)
+	ListMemberships(ctx context.Context, orgID uint) ([]models.Membership, error)
+	CreateMembership(ctx context.Context, m *models.Membership) error
+	UpdateMembership(ctx context.Context, m *models.Membership) error
+	DeleteMembership(ctx context.Context, orgID, userID uint) error
+}
+
+// Service manages organizations on behalf of a caller
+type Service struct {
+	store Store
+	users *service.UserService
+}
+
+// NewService creates a Service
+func NewService(store Store, users *service.UserService) *Service {
+	return &Service{store: store, users: users}
+}
+
+// Create creates an organization owned by the caller
+func (s *Service) Create(ctx context.Context, caller *auth.Identity, name string) (*models.Organization, error) {
+	org := &models.Organization{TenantID: database.TenantFromContext(ctx), Name: name, CreatedBy: caller.UserID}
+	owner := &models.Membership{UserID: caller.UserID, Role: models.OrgRoleOwner}
+	if err := s.store.CreateOrganization(ctx, org, owner); err != nil {
+		return nil, err
+	}
+	org.Role = models.OrgRoleOwner
+
+	logger.Log.WithField("org_id", org.ID).WithField("user_id", caller.UserID).Info("Organization created")
+	return org, nil
+}
+
+// List returns the organizations the caller belongs to, with their role in each
+func (s *Service) List(ctx context.Context, caller *auth.Identity) ([]models.Organization, error) {
+	return s.store.ListOrganizationsByUser(ctx, caller.UserID)
+}
+
+// Get returns an organization the caller belongs to, with their role
+func (s *Service) Get(ctx context.Context, caller *auth.Identity, id uint) (*models.Organization, error) {
+	org, role, err := s.authorize(ctx, caller, id, false)
+	if err != nil {
+		return nil, err
+	}
+	org.Role = role
+	return org, nil
+}
+
+// Rename changes an organization's name
+func (s *Service) Rename(ctx context.Context, caller *auth.Identity, id uint, name string) (*models.Organization, error) {
+	org, role, err := s.authorize(ctx, caller, id, true)
+	if err != nil {
+		return nil, err
+	}
+	org.Name = name
+	if err := s.store.UpdateOrganization(ctx, org); err != nil {
+		return nil, err
+	}
+	org.Role = role
+	return org, nil
+}
+
+// Delete deletes an organization and its memberships
+func (s *Service) Delete(ctx context.Context, caller *auth.Identity, id uint) error {
+	if _, _, err := s.authorize(ctx, caller, id, true); err != nil {
+		return err
+	}
+	if err := s.store.DeleteOrganization(ctx, id); err != nil {
+		return notFound(err)
+	}
+	logger.Log.WithField("org_id", id).WithField("user_id", caller.UserID).Info("Organization deleted")
+	return nil
+}
+
+// Members returns an organization's members with their user records
+func (s *Service) Members(ctx context.Context, caller *auth.Identity, id uint) ([]models.Membership, error) {
+	if _, _, err := s.authorize(ctx, caller, id, false); err != nil {
+		return nil, err
+	}
+	return s.store.ListMemberships(ctx, id)
+}
+
+// AddMember adds a user to an organization, as a member unless role says otherwise
+func (s *Service) AddMember(ctx context.Context, caller *auth.Identity, id, userID uint, role string) (*models.Membership, error) {
+	if _, _, err := s.authorize(ctx, caller, id, true); err != nil {
+		return nil, err
+	}
+	user, err := s.users.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		role = models.OrgRoleMember
+	}
+
+	m := &models.Membership{OrgID: id, UserID: user.ID, Role: role}
+	if err := s.store.CreateMembership(ctx, m); err != nil {
+		if errors.Is(err, database.ErrDuplicateKey) {
+			return nil, ErrAlreadyMember
+		}
+		return nil, err
+	}
+	m.User = user
+
+	logger.Log.WithField("org_id", id).WithField("member_id", userID).WithField("user_id", caller.UserID).Info("Organization member added")
+	return m, nil
+}
+
+// SetRole changes a member's role. The last owner can't step down.
+func (s *Service) SetRole(ctx context.Context, caller *auth.Identity, id, userID uint, role string) (*models.Membership, error) {
+	if _, _, err := s.authorize(ctx, caller, id, true); err != nil {
+		return nil, err
+	}
+	m, err := s.store.FindMembership(ctx, id, userID)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if m.Role == role {
+		return m, nil
+	}
+	if m.Role == models.OrgRoleOwner {
+		if err := s.keepAnOwner(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	m.Role = role
+	if err := s.store.UpdateMembership(ctx, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// RemoveMember takes a user out of an organization. Owners can remove
+// anyone and members can remove themselves, but the last owner can't leave.
+func (s *Service) RemoveMember(ctx context.Context, caller *auth.Identity, id, userID uint) error {
+	if _, _, err := s.authorize(ctx, caller, id, caller.UserID != userID); err != nil {
+		return err
+	}
+	m, err := s.store.FindMembership(ctx, id, userID)
+	if err != nil {
+		return notFound(err)
+	}
+	if m.Role == models.OrgRoleOwner {
+		if err := s.keepAnOwner(ctx, id); err != nil {
+			return err
+		}
+	}
+	return s.store.DeleteMembership(ctx, id, userID)
+}
+
+// authorize loads an organization and the caller's role in it. Callers
+// outside the organization get ErrNotFound, and members get ErrForbidden
+// when manage requires an owner. Admins may do anything within their
+// tenant; their role is empty unless they are members. Organizations of
+// other tenants are not found.
+func (s *Service) authorize(ctx context.Context, caller *auth.Identity, id uint, manage bool) (*models.Organization, string, error) {
+	org, err := s.store.FindOrganization(ctx, id)
+	if err != nil {
+		return nil, "", notFound(err)
+	}
+
+	role := ""
+	m, err := s.store.FindMembership(ctx, id, caller.UserID)
+	switch {
+	case err == nil:
+		role = m.Role
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, "", err
+	}
+
+	if caller.IsAdmin() {
+		return org, role, nil
+	}
+	if role == "" {
+		return nil, "", ErrNotFound
+	}
+	if manage && role != models.OrgRoleOwner {
+		return nil, "", ErrForbidden
+	}
+	return org, role, nil
+}
+
+// keepAnOwner returns ErrLastOwner unless the organization has another
+// owner besides the one about to go
+func (s *Service) keepAnOwner(ctx context.Context, id uint) error {
+	members, err := s.store.ListMemberships(ctx, id)
+	if err != nil {
+		return err
+	}
+	owners := 0
+	for _, m := range members {
+		if m.Role == models.OrgRoleOwner {
+			owners++
+		}
+	}
+	if owners < 2 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
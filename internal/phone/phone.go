@@ -0,0 +1,264 @@
+// Package phone verifies users' phone numbers with codes sent by text
+// message, and signs users in with a code sent to their verified number.
+// Codes sent to a number are rate limited, whoever asks for them.
+package phone
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/cache"
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/metrics"
+	"github.com/114windd/restapi/internal/router"
+	"github.com/114windd/restapi/internal/service"
+	"github.com/114windd/restapi/internal/sms"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+const (
+	codeDigits = 6
+	// maxAttempts is how many wrong guesses invalidate a code
+	maxAttempts = 5
+)
+
+// Code purposes, labelling metrics
+const (
+	PurposeVerification = "verification"
+	PurposeLogin        = "login"
+)
+
+var (
+	// ErrInvalidCode is returned for wrong, used or expired codes
+	ErrInvalidCode = errors.New("invalid or expired code")
+	// ErrRateLimited is returned when too many codes were sent to a number
+	ErrRateLimited = errors.New("too many codes sent to this phone number, try again later")
+	// ErrNoPhone is returned when verifying the phone of an account without one
+	ErrNoPhone = errors.New("account has no phone number")
+	// ErrAlreadyVerified is returned when the phone number is already verified
+	ErrAlreadyVerified = errors.New("phone number already verified")
+)
+
+// pendingCode is a code that was sent and not yet used. Only its hash is
+// stored, so the store never holds a usable code.
+type pendingCode struct {
+	Hash      string    `json:"hash"`
+	Phone     string    `json:"phone"`
+	UserID    uint      `json:"user_id"`
+	Attempts  int       `json:"attempts"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Service sends and checks codes
+type Service struct {
+	users  *service.UserService
+	sms    *sms.Client
+	codes  cache.Store
+	ttl    time.Duration
+	limits router.LimitStore
+	limit  router.RateLimit
+}
+
+// NewService creates a Service whose codes are valid for ttl. codes must
+// keep entries for at least ttl.
+func NewService(users *service.UserService, client *sms.Client, codes cache.Store, ttl time.Duration) *Service {
+	return &Service{users: users, sms: client, codes: codes, ttl: ttl}
+}
+
+// SetRateLimit allows count codes per window to each phone number
+func (s *Service) SetRateLimit(limits router.LimitStore, count int, window time.Duration) {
+	s.limits = limits
+	s.limit = router.RateLimit{Rate: rate.Every(window / time.Duration(count)), Burst: count}
+}
+
+// SendVerification texts a code to the user's phone number
+func (s *Service) SendVerification(ctx context.Context, userID uint) error {
+	user, err := s.users.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.Phone == "" {
+		return ErrNoPhone
+	}
+	if user.PhoneVerifiedAt != nil {
+		return ErrAlreadyVerified
+	}
+	return s.send(ctx, verificationKey(ctx, userID), user.Phone, user.ID, PurposeVerification)
+}
+
+// ConfirmVerification checks a code sent by SendVerification and marks the
+// phone number verified
+func (s *Service) ConfirmVerification(ctx context.Context, userID uint, code string) (*models.User, error) {
+	pending, err := s.check(ctx, verificationKey(ctx, userID), code)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.users.MarkPhoneVerified(ctx, userID, pending.Phone)
+	if errors.Is(err, service.ErrPhoneChanged) {
+		return nil, ErrInvalidCode
+	}
+	return user, err
+}
+
+// SendLoginCode texts a login code to phone if an account verified it.
+// Unknown numbers get no message but the same answer, so callers can't
+// tell which numbers have accounts; for the same reason delivery failures
+// are only logged.
+func (s *Service) SendLoginCode(ctx context.Context, phone string) error {
+	if err := s.allow(ctx, phone, PurposeLogin); err != nil {
+		return err
+	}
+	user, err := s.users.GetUserByVerifiedPhone(ctx, phone)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.Log.Debug("Login code requested for an unknown phone number")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.deliver(ctx, loginKey(ctx, phone), phone, user.ID, PurposeLogin); err != nil {
+		logger.Log.WithError(err).WithField("user_id", user.ID).Error("Failed to send login code")
+	}
+	return nil
+}
+
+// VerifyLoginCode checks a code sent by SendLoginCode, returning the user
+// to sign in
+func (s *Service) VerifyLoginCode(ctx context.Context, phone, code string) (*models.User, error) {
+	pending, err := s.check(ctx, loginKey(ctx, phone), code)
+	if err != nil {
+		return nil, err
+	}
+	// The number may have moved to another account since the code was sent
+	user, err := s.users.GetUserByVerifiedPhone(ctx, phone)
+	if errors.Is(err, gorm.ErrRecordNotFound) || err == nil && user.ID != pending.UserID {
+		return nil, ErrInvalidCode
+	}
+	return user, err
+}
+
+// send rate limits and delivers a code
+func (s *Service) send(ctx context.Context, key, phone string, userID uint, purpose string) error {
+	if err := s.allow(ctx, phone, purpose); err != nil {
+		return err
+	}
+	return s.deliver(ctx, key, phone, userID, purpose)
+}
+
+// allow takes a token from phone's bucket. A failing limit store lets
+// messages through rather than blocking logins.
+func (s *Service) allow(ctx context.Context, phone, purpose string) error {
+	if s.limits == nil {
+		return nil
+	}
+	ok, err := s.limits.Allow(ctx, "sms:"+phone, s.limit)
+	if err != nil {
+		logger.Log.WithError(err).Warn("SMS rate limit check failed, allowing message")
+		return nil
+	}
+	if !ok {
+		metrics.RecordSMSMessage(s.sms.Provider(), purpose, "rate_limited")
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// deliver stores a new code under key, replacing any earlier one, and texts it
+func (s *Service) deliver(ctx context.Context, key, phone string, userID uint, purpose string) error {
+	code, err := generateCode()
+	if err != nil {
+		return err
+	}
+	pending := pendingCode{Hash: hashCode(code), Phone: phone, UserID: userID, ExpiresAt: time.Now().Add(s.ttl)}
+	if err := s.codes.Set(ctx, key, pending); err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Your verification code is %s. It expires in %s.", code, formatTTL(s.ttl))
+	if purpose == PurposeLogin {
+		body = fmt.Sprintf("Your login code is %s. It expires in %s. Don't share it with anyone.", code, formatTTL(s.ttl))
+	}
+	id, err := s.sms.Send(ctx, sms.Message{To: phone, Body: body, Purpose: purpose})
+	if err != nil {
+		_ = s.codes.Delete(ctx, key)
+		return err
+	}
+	logger.Log.WithField("user_id", userID).WithField("message_id", id).WithField("purpose", purpose).Info("Code sent by SMS")
+	return nil
+}
+
+// check consumes the code stored under key if it matches. Each wrong guess
+// counts against the code, which stops working after maxAttempts.
+func (s *Service) check(ctx context.Context, key, code string) (*pendingCode, error) {
+	var pending pendingCode
+	ok, err := s.codes.Get(ctx, key, &pending)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || time.Now().After(pending.ExpiresAt) {
+		return nil, ErrInvalidCode
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashCode(code)), []byte(pending.Hash)) != 1 {
+		pending.Attempts++
+		if pending.Attempts >= maxAttempts {
+			err = s.codes.Delete(ctx, key)
+		} else {
+			err = s.codes.Set(ctx, key, pending)
+		}
+		if err != nil {
+			logger.Log.WithError(err).Warn("Failed to record a wrong code")
+		}
+		return nil, ErrInvalidCode
+	}
+	if err := s.codes.Delete(ctx, key); err != nil {
+		return nil, err
+	}
+	return &pending, nil
+}
+
+// Codes are keyed by tenant, so a code never crosses tenant boundaries
+func verificationKey(ctx context.Context, userID uint) string {
+	return database.TenantFromContext(ctx) + ":phone-code:verification:" + strconv.FormatUint(uint64(userID), 10)
+}
+
+func loginKey(ctx context.Context, phone string) string {
+	return database.TenantFromContext(ctx) + ":phone-code:login:" + phone
+}
+
+// generateCode returns a random codeDigits-digit code
+func generateCode() (string, error) {
+	n, err := rand.Int(rand.Reader, new(big.Int).Exp(big.NewInt(10), big.NewInt(codeDigits), nil))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", codeDigits, n.Int64()), nil
+}
+
+// hashCode hashes a code, ignoring surrounding spaces. Codes are short, so
+// the hash only keeps them out of the store; attempts are what's limited.
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// formatTTL renders a code lifetime for the message text, e.g. "10 minutes"
+func formatTTL(ttl time.Duration) string {
+	if minutes := int(ttl.Round(time.Minute) / time.Minute); minutes > 1 {
+		return strconv.Itoa(minutes) + " minutes"
+	}
+	return "1 minute"
+}
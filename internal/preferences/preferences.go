@@ -0,0 +1,196 @@
+// Package preferences stores per-user settings such as theme and language.
+// Only registered keys can be set, each validated against its definition,
+// and keys a user never set read as their registered default.
+package preferences
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+	// Time zones are validated in the alpine image, which ships without zoneinfo
+	_ "time/tzdata"
+
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// ErrInvalidPreferences is returned when an update names an unknown key or
+// a value that doesn't match its definition
+var ErrInvalidPreferences = errors.New("invalid preferences")
+
+// Store persists preferences
+type Store interface {
+	GetPreferences(ctx context.Context, userID uint) (models.Preferences, error)
+	MergePreferences(ctx context.Context, userID uint, patch models.Preferences) (models.Preferences, error)
+}
+
+// Definition describes a preference key
+type Definition struct {
+	Key     string      `json:"key"`
+	Type    string      `json:"type"` // One of the models.AttributeType* constants
+	Default interface{} `json:"default"`
+	// Allowed lists the accepted values of a string preference; any string when empty
+	Allowed []string `json:"allowed,omitempty"`
+	// Validate optionally applies further checks to a value of the right type
+	Validate func(value interface{}) error `json:"-"`
+}
+
+// Builtin are the preferences every deployment supports
+var Builtin = []Definition{
+	{Key: "theme", Type: models.AttributeTypeString, Default: "system", Allowed: []string{"light", "dark", "system"}},
+	{Key: "language", Type: models.AttributeTypeString, Default: "en", Validate: maxLength(35)},
+	{Key: "timezone", Type: models.AttributeTypeString, Default: "UTC", Validate: validTimezone},
+	{Key: "email_notifications", Type: models.AttributeTypeBoolean, Default: true},
+	{Key: "page_size", Type: models.AttributeTypeNumber, Default: float64(20), Validate: integerBetween(1, 100)},
+}
+
+// Service reads and updates preferences against the registered definitions
+type Service struct {
+	store       Store
+	definitions map[string]Definition
+}
+
+// NewService creates a Service with the Builtin preferences registered
+func NewService(store Store) *Service {
+	s := &Service{store: store, definitions: make(map[string]Definition)}
+	for _, def := range Builtin {
+		s.Register(def)
+	}
+	return s
+}
+
+// Register adds or replaces a preference definition. Call it before the
+// service handles requests.
+func (s *Service) Register(def Definition) {
+	s.definitions[def.Key] = def
+}
+
+// Definitions returns the registered preferences sorted by key
+func (s *Service) Definitions() []Definition {
+	defs := make([]Definition, 0, len(s.definitions))
+	for _, def := range s.definitions {
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Key < defs[j].Key })
+	return defs
+}
+
+// Get returns a user's preferences, with defaults for the keys they never
+// set. Stored keys that are no longer registered are left out.
+func (s *Service) Get(ctx context.Context, userID uint) (models.Preferences, error) {
+	stored, err := s.store.GetPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.resolve(stored), nil
+}
+
+// Update merges patch into a user's preferences and returns the result. A
+// null value resets a key to its default. Nothing is saved unless every key
+// in patch is valid.
+func (s *Service) Update(ctx context.Context, userID uint, patch models.Preferences) (models.Preferences, error) {
+	keys := make([]string, 0, len(patch))
+	for key := range patch {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		def, ok := s.definitions[key]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown preference %q", ErrInvalidPreferences, key)
+		}
+		if value := patch[key]; value != nil {
+			if err := validate(def, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	stored, err := s.store.MergePreferences(ctx, userID, patch)
+	if err != nil {
+		return nil, err
+	}
+	return s.resolve(stored), nil
+}
+
+// resolve fills in defaults and drops unregistered keys
+func (s *Service) resolve(stored models.Preferences) models.Preferences {
+	prefs := make(models.Preferences, len(s.definitions))
+	for key, def := range s.definitions {
+		if value, ok := stored[key]; ok {
+			prefs[key] = value
+		} else {
+			prefs[key] = def.Default
+		}
+	}
+	return prefs
+}
+
+// validate checks a value against its definition
+func validate(def Definition, value interface{}) error {
+	switch def.Type {
+	case models.AttributeTypeString:
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%w: preference %q must be a string", ErrInvalidPreferences, def.Key)
+		}
+		if len(def.Allowed) > 0 && !contains(def.Allowed, str) {
+			return fmt.Errorf("%w: preference %q must be one of %v", ErrInvalidPreferences, def.Key, def.Allowed)
+		}
+	case models.AttributeTypeNumber:
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%w: preference %q must be a number", ErrInvalidPreferences, def.Key)
+		}
+	case models.AttributeTypeBoolean:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%w: preference %q must be a boolean", ErrInvalidPreferences, def.Key)
+		}
+	default:
+		return fmt.Errorf("%w: preference %q has unsupported type %q", ErrInvalidPreferences, def.Key, def.Type)
+	}
+	if def.Validate != nil {
+		if err := def.Validate(value); err != nil {
+			return fmt.Errorf("%w: preference %q %v", ErrInvalidPreferences, def.Key, err)
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func maxLength(n int) func(interface{}) error {
+	return func(value interface{}) error {
+		if len(value.(string)) > n {
+			return fmt.Errorf("must be at most %d characters", n)
+		}
+		return nil
+	}
+}
+
+// validTimezone accepts IANA names; the empty string, which LoadLocation
+// reads as UTC, is refused
+func validTimezone(value interface{}) error {
+	name := value.(string)
+	if _, err := time.LoadLocation(name); err != nil || name == "" {
+		return errors.New("must be an IANA time zone such as Europe/Paris")
+	}
+	return nil
+}
+
+func integerBetween(min, max float64) func(interface{}) error {
+	return func(value interface{}) error {
+		n := value.(float64)
+		if n != float64(int64(n)) || n < min || n > max {
+			return fmt.Errorf("must be a whole number from %v to %v", min, max)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,281 @@
+// Package privacy implements the data protection rights of users: an
+// export of everything stored about them, built in the background and
+// downloaded through a signed link, and erasure when they delete their
+// account, which anonymizes the audit records that must be kept.
+package privacy
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/service"
+	"github.com/114windd/restapi/internal/session"
+	"github.com/114windd/restapi/internal/storage"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+var (
+	// ErrExportInProgress is returned when a user requests an export while one is being built
+	ErrExportInProgress = errors.New("a data export is already in progress")
+	// ErrNoExport is returned when a user has not requested an export
+	ErrNoExport = errors.New("no data export requested")
+)
+
+// exportTimeout bounds how long building an archive may take. A pending
+// export older than this was abandoned, e.g. by a restart, and no longer
+// blocks a new request.
+const exportTimeout = 10 * time.Minute
+
+// exportPrefix is the object key prefix archives are stored under
+const exportPrefix = "exports/"
+
+// Store persists data exports and the records included in them
+type Store interface {
+	CreateDataExport(ctx context.Context, export *models.DataExport) error
+	UpdateDataExport(ctx context.Context, export *models.DataExport) error
+	ListDataExports(ctx context.Context, userID uint) ([]models.DataExport, error)
+	ListExpiredDataExports(ctx context.Context, now time.Time) ([]models.DataExport, error)
+	DeleteDataExport(ctx context.Context, id uint) error
+	GetUserHistory(ctx context.Context, userID uint) ([]models.UserHistory, error)
+	ListIdentitiesByUser(ctx context.Context, userID uint) ([]models.Identity, error)
+	ListDevicesByUser(ctx context.Context, userID uint) ([]models.KnownDevice, error)
+	ListRecoveryCasesByUser(ctx context.Context, userID uint) ([]models.RecoveryCase, error)
+	ListConsents(ctx context.Context, userID uint) ([]models.Consent, error)
+	GetPreferences(ctx context.Context, userID uint) (models.Preferences, error)
+	AnonymizeUserRecords(ctx context.Context, userID uint) error
+}
+
+// Archive is the content of a data export
+type Archive struct {
+	GeneratedAt   time.Time             `json:"generated_at"`
+	User          *models.User          `json:"user"`
+	Identities    []models.Identity     `json:"identities"`
+	Devices       []models.KnownDevice  `json:"devices"`
+	Sessions      []session.Session     `json:"sessions"`
+	History       []models.UserHistory  `json:"history"`
+	RecoveryCases []models.RecoveryCase `json:"recovery_cases"`
+	Consents      []models.Consent      `json:"consents"`
+	Preferences   models.Preferences    `json:"preferences"` // Only those the user set
+}
+
+// Service runs data exports and erasures
+type Service struct {
+	store     Store
+	users     *service.UserService
+	objects   storage.ObjectStore
+	sessions  *session.Manager // nil unless sessions are enabled
+	retention time.Duration
+	linkTTL   time.Duration
+	running   sync.WaitGroup
+}
+
+// NewService creates a Service storing archives in objects. Archives are
+// deleted retention after they are built, and download links are valid
+// for linkTTL.
+func NewService(store Store, users *service.UserService, objects storage.ObjectStore, retention, linkTTL time.Duration) *Service {
+	return &Service{store: store, users: users, objects: objects, retention: retention, linkTTL: linkTTL}
+}
+
+// SetSessions includes sessions in exports and revokes them on erasure
+func (s *Service) SetSessions(sessions *session.Manager) {
+	s.sessions = sessions
+}
+
+// StartExport requests an archive of a user's data, built in the background
+func (s *Service) StartExport(ctx context.Context, userID uint) (*models.DataExport, error) {
+	exports, err := s.store.ListDataExports(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(exports) > 0 && exports[0].Status == models.ExportPending && time.Since(exports[0].CreatedAt) < exportTimeout {
+		return nil, ErrExportInProgress
+	}
+
+	export := &models.DataExport{
+		UserID:   userID,
+		TenantID: database.TenantFromContext(ctx),
+		Status:   models.ExportPending,
+	}
+	if err := s.store.CreateDataExport(ctx, export); err != nil {
+		return nil, err
+	}
+
+	// The job outlives the request, keeping only its tenant
+	job := *export
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		ctx, cancel := context.WithTimeout(database.WithTenant(context.Background(), job.TenantID), exportTimeout)
+		defer cancel()
+		s.build(ctx, &job)
+	}()
+	return export, nil
+}
+
+// build writes the archive of an export and records the outcome
+func (s *Service) build(ctx context.Context, export *models.DataExport) {
+	log := logger.Log.WithField("export_id", export.ID).WithField("user_id", export.UserID)
+
+	key, err := s.writeArchive(ctx, export.UserID)
+	now := time.Now()
+	if err != nil {
+		log.WithError(err).Error("Failed to build data export")
+		export.Status = models.ExportFailed
+		export.Error = "The archive could not be built, request a new export"
+	} else {
+		expires := now.Add(s.retention)
+		export.Status = models.ExportCompleted
+		export.ObjectKey = key
+		export.ExpiresAt = &expires
+		export.CompletedAt = &now
+	}
+	if err := s.store.UpdateDataExport(ctx, export); err != nil {
+		log.WithError(err).Error("Failed to record data export result")
+		return
+	}
+	log.WithField("status", export.Status).Info("Data export finished")
+}
+
+// writeArchive collects a user's data and stores it as JSON under a random key
+func (s *Service) writeArchive(ctx context.Context, userID uint) (string, error) {
+	archive := Archive{GeneratedAt: time.Now().UTC(), Sessions: []session.Session{}}
+
+	var err error
+	if archive.User, err = s.users.GetUser(ctx, userID); err != nil {
+		return "", fmt.Errorf("load user: %w", err)
+	}
+	if archive.Identities, err = s.store.ListIdentitiesByUser(ctx, userID); err != nil {
+		return "", fmt.Errorf("load identities: %w", err)
+	}
+	if archive.Devices, err = s.store.ListDevicesByUser(ctx, userID); err != nil {
+		return "", fmt.Errorf("load devices: %w", err)
+	}
+	if archive.History, err = s.store.GetUserHistory(ctx, userID); err != nil {
+		return "", fmt.Errorf("load history: %w", err)
+	}
+	if archive.RecoveryCases, err = s.store.ListRecoveryCasesByUser(ctx, userID); err != nil {
+		return "", fmt.Errorf("load recovery cases: %w", err)
+	}
+	if archive.Consents, err = s.store.ListConsents(ctx, userID); err != nil {
+		return "", fmt.Errorf("load consents: %w", err)
+	}
+	if archive.Preferences, err = s.store.GetPreferences(ctx, userID); err != nil {
+		return "", fmt.Errorf("load preferences: %w", err)
+	}
+	if s.sessions != nil {
+		if archive.Sessions, err = s.sessions.ListByUser(ctx, userID); err != nil {
+			return "", fmt.Errorf("load sessions: %w", err)
+		}
+	}
+
+	data, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	key := fmt.Sprintf("%s%d/%s.json", exportPrefix, userID, hex.EncodeToString(random))
+	if err := s.objects.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "application/json"); err != nil {
+		return "", fmt.Errorf("store archive: %w", err)
+	}
+	return key, nil
+}
+
+// LatestExport returns a user's most recent export and, once it is
+// completed, a link to download the archive. An archive past its expiry is
+// reported with status "expired" until it is purged.
+func (s *Service) LatestExport(ctx context.Context, userID uint) (*models.DataExport, string, error) {
+	exports, err := s.store.ListDataExports(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(exports) == 0 {
+		return nil, "", ErrNoExport
+	}
+
+	export := &exports[0]
+	if export.Status != models.ExportCompleted {
+		return export, "", nil
+	}
+	if export.ExpiresAt != nil && export.ExpiresAt.Before(time.Now()) {
+		export.Status = models.ExportExpired
+		return export, "", nil
+	}
+	url, err := s.objects.SignedURL(ctx, export.ObjectKey, s.linkTTL)
+	if err != nil {
+		return nil, "", err
+	}
+	return export, url, nil
+}
+
+// Erase deletes a user's account. Records that must be kept for auditing
+// are anonymized rather than deleted, and their exports and sessions are
+// removed. A failed erasure can be retried: deleting the missing user again
+// succeeds and the remaining steps run.
+func (s *Service) Erase(ctx context.Context, userID uint) error {
+	if err := s.users.DeleteUser(ctx, userID); err != nil {
+		return err
+	}
+	if database.IsDryRun(ctx) {
+		return nil
+	}
+
+	if err := s.store.AnonymizeUserRecords(ctx, userID); err != nil {
+		return fmt.Errorf("anonymize records: %w", err)
+	}
+	exports, err := s.store.ListDataExports(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("list exports: %w", err)
+	}
+	for _, export := range exports {
+		if err := s.deleteExport(ctx, export); err != nil {
+			return err
+		}
+	}
+	if s.sessions != nil {
+		if err := s.sessions.RevokeUser(ctx, userID); err != nil {
+			return fmt.Errorf("revoke sessions: %w", err)
+		}
+	}
+	return nil
+}
+
+// PurgeExpired deletes archives past their expiry and returns how many
+func (s *Service) PurgeExpired(ctx context.Context) (int, error) {
+	exports, err := s.store.ListExpiredDataExports(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	for i, export := range exports {
+		if err := s.deleteExport(ctx, export); err != nil {
+			return i, err
+		}
+	}
+	return len(exports), nil
+}
+
+// deleteExport removes an export's archive and record
+func (s *Service) deleteExport(ctx context.Context, export models.DataExport) error {
+	if export.ObjectKey != "" {
+		if err := s.objects.Delete(ctx, export.ObjectKey); err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+			return fmt.Errorf("delete export %d: %w", export.ID, err)
+		}
+	}
+	return s.store.DeleteDataExport(ctx, export.ID)
+}
+
+// Wait blocks until the exports being built have finished
+func (s *Service) Wait() {
+	s.running.Wait()
+}
@@ -0,0 +1,252 @@
+// Package recovery implements admin-verified account recovery for users
+// who lost access to their email. An admin opens a case after verifying
+// the user's identity out of band, other admins approve it, and the final
+// reset replaces the user's credentials with a single-use reset token.
+package recovery
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/mail"
+	"github.com/114windd/restapi/internal/service"
+	"github.com/114windd/restapi/internal/session"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+var (
+	// ErrInvalidTransition is returned when a case's status doesn't allow the action
+	ErrInvalidTransition = errors.New("recovery case status does not allow this action")
+	// ErrSelfApproval is returned when the admin who opened a case tries to approve it
+	ErrSelfApproval = errors.New("a recovery case cannot be approved by the admin who opened it")
+	// ErrAlreadyApproved is returned when an admin approves the same case twice
+	ErrAlreadyApproved = errors.New("recovery case already approved by this admin")
+	// ErrInvalidToken is returned for unknown, used or expired reset tokens
+	ErrInvalidToken = errors.New("invalid or expired recovery token")
+)
+
+// Store persists recovery cases and their audit events
+type Store interface {
+	CreateRecoveryCase(ctx context.Context, rc *models.RecoveryCase, event *models.RecoveryCaseEvent) error
+	FindRecoveryCase(ctx context.Context, id uint) (*models.RecoveryCase, error)
+	FindRecoveryCaseByToken(ctx context.Context, tokenHash string, now time.Time) (*models.RecoveryCase, error)
+	ListRecoveryCases(ctx context.Context, status string) ([]models.RecoveryCase, error)
+	UpdateRecoveryCase(ctx context.Context, rc *models.RecoveryCase, event *models.RecoveryCaseEvent) error
+	ExpireRecoveryTokens(ctx context.Context, now time.Time) (int64, error)
+}
+
+// Service runs recovery cases through their states
+type Service struct {
+	store             Store
+	users             *service.UserService
+	mailer            mail.Mailer
+	sessions          *session.Manager // nil unless sessions are enabled
+	requiredApprovals int
+	tokenTTL          time.Duration
+}
+
+// NewService creates a Service. Cases need requiredApprovals approvals
+// (at least one) and reset tokens are valid for tokenTTL.
+func NewService(store Store, users *service.UserService, mailer mail.Mailer, requiredApprovals int, tokenTTL time.Duration) *Service {
+	if requiredApprovals < 1 {
+		requiredApprovals = 1
+	}
+	return &Service{store: store, users: users, mailer: mailer, requiredApprovals: requiredApprovals, tokenTTL: tokenTTL}
+}
+
+// SetSessions makes a credential reset revoke the user's sessions
+func (s *Service) SetSessions(sessions *session.Manager) {
+	s.sessions = sessions
+}
+
+// Open starts a case for a user whose identity actorID has verified
+func (s *Service) Open(ctx context.Context, actorID uint, req models.OpenRecoveryCaseRequest) (*models.RecoveryCase, error) {
+	user, err := s.users.GetUser(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	rc := &models.RecoveryCase{
+		UserID:            user.ID,
+		TenantID:          user.TenantID,
+		Status:            models.RecoveryOpen,
+		Reason:            req.Reason,
+		Verification:      req.Verification,
+		RequiredApprovals: s.requiredApprovals,
+		OpenedBy:          actorID,
+		Version:           1,
+	}
+	event := &models.RecoveryCaseEvent{ActorID: actorID, Action: models.RecoveryActionOpened, Note: req.Verification}
+	if err := s.store.CreateRecoveryCase(ctx, rc, event); err != nil {
+		return nil, err
+	}
+	audit(rc, event).WithField("user_id", rc.UserID).Info("Recovery case opened")
+	return rc, nil
+}
+
+// Get returns a case with its audit log
+func (s *Service) Get(ctx context.Context, id uint) (*models.RecoveryCase, error) {
+	return s.store.FindRecoveryCase(ctx, id)
+}
+
+// List returns cases, newest first, optionally filtered by status
+func (s *Service) List(ctx context.Context, status string) ([]models.RecoveryCase, error) {
+	return s.store.ListRecoveryCases(ctx, status)
+}
+
+// Approve records actorID's approval of an open case. The case becomes
+// approved once it has the required number of approvals from distinct
+// admins other than the one who opened it.
+func (s *Service) Approve(ctx context.Context, id, actorID uint, note string) (*models.RecoveryCase, error) {
+	rc, err := s.store.FindRecoveryCase(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if rc.Status != models.RecoveryOpen {
+		return nil, ErrInvalidTransition
+	}
+	if rc.OpenedBy == actorID {
+		return nil, ErrSelfApproval
+	}
+	for _, event := range rc.Events {
+		if event.Action == models.RecoveryActionApproved && event.ActorID == actorID {
+			return nil, ErrAlreadyApproved
+		}
+	}
+
+	rc.Approvals++
+	if rc.Approvals >= rc.RequiredApprovals {
+		rc.Status = models.RecoveryApproved
+	}
+	return s.update(ctx, rc, &models.RecoveryCaseEvent{ActorID: actorID, Action: models.RecoveryActionApproved, Note: note})
+}
+
+// Reject closes a case that has not been completed
+func (s *Service) Reject(ctx context.Context, id, actorID uint, note string) (*models.RecoveryCase, error) {
+	rc, err := s.store.FindRecoveryCase(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if rc.Status != models.RecoveryOpen && rc.Status != models.RecoveryApproved {
+		return nil, ErrInvalidTransition
+	}
+
+	rc.Status = models.RecoveryRejected
+	return s.update(ctx, rc, &models.RecoveryCaseEvent{ActorID: actorID, Action: models.RecoveryActionRejected, Note: note})
+}
+
+// Reset completes an approved case: the user's password is replaced with a
+// random one, their sessions are revoked, their email is changed to
+// newEmail when given, and a single-use reset token is issued and mailed to
+// the user. The token is also returned so it can be handed over through
+// the channel the user's identity was verified on.
+func (s *Service) Reset(ctx context.Context, id, actorID uint, newEmail string) (*models.RecoveryCase, string, error) {
+	rc, err := s.store.FindRecoveryCase(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if rc.Status != models.RecoveryApproved {
+		return nil, "", ErrInvalidTransition
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	expires := now.Add(s.tokenTTL)
+	rc.Status = models.RecoveryCompleted
+	rc.NewEmail = newEmail
+	rc.ResetTokenHash = hashToken(token)
+	rc.ResetTokenExpires = &expires
+	rc.CompletedAt = &now
+
+	// Completing the case first ensures only one reset wins a race
+	note := ""
+	if newEmail != "" {
+		note = "email changed to " + newEmail
+	}
+	if _, err := s.update(ctx, rc, &models.RecoveryCaseEvent{ActorID: actorID, Action: models.RecoveryActionReset, Note: note}); err != nil {
+		return nil, "", err
+	}
+
+	scrambled, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	user, err := s.users.ResetCredentials(ctx, rc.UserID, newEmail, scrambled)
+	if err != nil {
+		return nil, "", fmt.Errorf("reset credentials: %w", err)
+	}
+	if s.sessions != nil {
+		if err := s.sessions.RevokeUser(ctx, user.ID); err != nil {
+			logger.LogRecovery(models.RecoveryActionReset, rc.ID, actorID).WithError(err).Error("Failed to revoke sessions after credential reset")
+		}
+	}
+
+	msg := mail.Message{
+		To:       user.Email,
+		Template: mail.TemplatePasswordReset,
+		Data:     mail.PasswordResetData{Code: token, ExpiresAt: expires},
+	}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		logger.LogRecovery(models.RecoveryActionReset, rc.ID, actorID).WithError(err).Warn("Failed to mail recovery token")
+	}
+	return rc, token, nil
+}
+
+// Redeem sets a new password using a reset token. Tokens work once.
+func (s *Service) Redeem(ctx context.Context, token, password string) error {
+	rc, err := s.store.FindRecoveryCaseByToken(ctx, hashToken(token), time.Now())
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	rc.ResetTokenHash = ""
+	rc.ResetTokenExpires = nil
+	if _, err := s.update(ctx, rc, &models.RecoveryCaseEvent{Action: models.RecoveryActionTokenRedeemed}); err != nil {
+		return err
+	}
+	_, err = s.users.ResetCredentials(ctx, rc.UserID, "", password)
+	return err
+}
+
+// ExpireTokens clears reset tokens past their expiry, returning how many were cleared
+func (s *Service) ExpireTokens(ctx context.Context) (int64, error) {
+	return s.store.ExpireRecoveryTokens(ctx, time.Now())
+}
+
+// update saves a case with its audit event and writes the event to the audit log
+func (s *Service) update(ctx context.Context, rc *models.RecoveryCase, event *models.RecoveryCaseEvent) (*models.RecoveryCase, error) {
+	if err := s.store.UpdateRecoveryCase(ctx, rc, event); err != nil {
+		return nil, err
+	}
+	audit(rc, event).WithField("status", rc.Status).Info("Recovery case updated")
+	return rc, nil
+}
+
+func audit(rc *models.RecoveryCase, event *models.RecoveryCaseEvent) *logrus.Entry {
+	return logger.LogRecovery(event.Action, rc.ID, event.ActorID)
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,78 @@
+package retry
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// permanentError marks an error that must not be retried
+type permanentError struct {
+	err error
+}
+
+func (p *permanentError) Error() string { return p.err.Error() }
+func (p *permanentError) Unwrap() error { return p.err }
+
+// Permanent wraps err so ExecuteWithRetry returns it without retrying,
+// whatever the classifier says
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// retryablePgCodes are Postgres SQLSTATEs for failures that may succeed
+// when the statement is simply run again. Besides class 08 (connection
+// exceptions), they are the server refusing or dropping the connection.
+var retryablePgCodes = map[string]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"53300": true, // too_many_connections
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
+// IsRetryable classifies errors from the database and network. Only
+// failures known to be transient are retried: connection errors,
+// serialization failures, deadlocks and deadlines of the driver, such as a
+// connect timeout. Everything else, unrecognised errors included, is not,
+// so that a failed write isn't repeated on a guess.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var permanent *permanentError
+	if errors.As(err, &permanent) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	// ExecuteWithRetry stops anyway once the caller's own context is done
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return retryablePgCodes[pgErr.Code] || strings.HasPrefix(pgErr.Code, "08")
+	}
+	return isConnectionError(err)
+}
+
+// isConnectionError reports whether err is the connection failing, to be
+// established or mid-query, rather than the statement
+func isConnectionError(err error) bool {
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	return errors.As(err, &connectErr) || errors.As(err, &netErr) ||
+		errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		pgconn.SafeToRetry(err)
+}
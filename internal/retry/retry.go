@@ -1,8 +1,10 @@
 package retry
 
 import (
+	"context"
 	"fmt"
 	"math"
+	"math/rand"
 	"time"
 
 	"github.com/114windd/restapi/internal/logger"
@@ -14,6 +16,9 @@ type RetryConfig struct {
 	MaxAttempts int
 	BaseDelay   time.Duration
 	MaxDelay    time.Duration
+	// IsRetryable decides whether a failed attempt is tried again; nil
+	// retries every error. Errors wrapped with Permanent are never retried.
+	IsRetryable func(error) bool
 }
 
 // DefaultRetryConfig returns sensible defaults for database operations
@@ -22,14 +27,17 @@ func DefaultRetryConfig() RetryConfig {
 		MaxAttempts: 3,
 		BaseDelay:   100 * time.Millisecond,
 		MaxDelay:    2 * time.Second,
+		IsRetryable: IsRetryable,
 	}
 }
 
 // RetryableFunc is a function that can be retried
 type RetryableFunc func() error
 
-// ExecuteWithRetry executes a function with exponential backoff retry logic
-func ExecuteWithRetry(operation string, fn RetryableFunc, config RetryConfig) error {
+// ExecuteWithRetry executes a function with exponential backoff retry logic.
+// It stops early when ctx is done or the error isn't retryable, returning
+// that error unwrapped.
+func ExecuteWithRetry(ctx context.Context, operation string, fn RetryableFunc, config RetryConfig) error {
 	var lastErr error
 
 	for attempt := 1; attempt <= config.MaxAttempts; attempt++ {
@@ -46,6 +54,18 @@ func ExecuteWithRetry(operation string, fn RetryableFunc, config RetryConfig) er
 			return nil
 		}
 
+		if p, ok := err.(*permanentError); ok {
+			return p.err
+		}
+		// The caller gave up, e.g. its request deadline passed
+		if ctx.Err() != nil {
+			return err
+		}
+		if config.IsRetryable != nil && !config.IsRetryable(err) {
+			LogRetry(operation, attempt, config.MaxAttempts).WithError(err).Debug("Error is not retryable")
+			return err
+		}
+
 		lastErr = err
 
 		// Don't sleep on the last attempt
@@ -62,23 +82,41 @@ func ExecuteWithRetry(operation string, fn RetryableFunc, config RetryConfig) er
 			WithField("retry_delay_ms", delay.Milliseconds()).
 			Warn("Operation failed, retrying")
 
-		time.Sleep(delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("operation '%s' abandoned after %d attempts: %w", operation, attempt, ctx.Err())
+		case <-timer.C:
+		}
 	}
 
 	return fmt.Errorf("operation '%s' failed after %d attempts: %w", operation, config.MaxAttempts, lastErr)
 }
 
-// calculateDelay calculates exponential backoff delay
+// Backoff returns the delay before retrying after failed attempt number
+// attempt, counted from 1, with the backoff and jitter ExecuteWithRetry
+// uses. It is for retry loops that don't fit ExecuteWithRetry, such as
+// waiting for a dependency to come up.
+func Backoff(attempt int, baseDelay, maxDelay time.Duration) time.Duration {
+	return calculateDelay(attempt, baseDelay, maxDelay)
+}
+
+// calculateDelay picks a delay with full jitter: uniformly random between
+// zero and the exponential backoff for this attempt, so that clients failing
+// together don't retry in lockstep
 func calculateDelay(attempt int, baseDelay, maxDelay time.Duration) time.Duration {
 	// Exponential backoff: baseDelay * 2^(attempt-1)
-	delay := time.Duration(float64(baseDelay) * math.Pow(2, float64(attempt-1)))
+	backoff := time.Duration(float64(baseDelay) * math.Pow(2, float64(attempt-1)))
 
 	// Cap at maxDelay
-	if delay > maxDelay {
-		delay = maxDelay
+	if backoff > maxDelay || backoff <= 0 {
+		backoff = maxDelay
 	}
-
-	return delay
+	if backoff <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
 }
 
 // LogRetry creates a structured log entry for retry operations
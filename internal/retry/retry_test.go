@@ -0,0 +1,117 @@
+package retry
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/logger"
+)
+
+func init() {
+	logger.Init()
+	logger.Log.SetOutput(io.Discard)
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"unrecognised", errors.New("something else"), false},
+		{"record not found", gorm.ErrRecordNotFound, false},
+		{"canceled", context.Canceled, false},
+		{"driver deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), true},
+		{"permanent", Permanent(&pgconn.PgError{Code: "40001"}), false},
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, true},
+		{"deadlock", fmt.Errorf("update: %w", &pgconn.PgError{Code: "40P01"}), true},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, true},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, true},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, false},
+		{"syntax error", &pgconn.PgError{Code: "42601"}, false},
+		{"lock not available", &pgconn.PgError{Code: "55P03"}, false},
+		{"query canceled", &pgconn.PgError{Code: "57014"}, false},
+		{"connection refused", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"bad connection", driver.ErrBadConn, true},
+		{"dropped mid-query", io.ErrUnexpectedEOF, true},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("%s: IsRetryable(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestExecuteWithRetry(t *testing.T) {
+	transient := &pgconn.PgError{Code: "40001"}
+	rejected := &pgconn.PgError{Code: "23505"}
+	config := RetryConfig{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, IsRetryable: IsRetryable}
+
+	tests := []struct {
+		name     string
+		errs     []error // returned by successive attempts; nil once exhausted
+		attempts int
+		check    func(error) bool
+	}{
+		{"success", nil, 1, func(err error) bool { return err == nil }},
+		{"succeeds after a transient failure", []error{transient, transient}, 3, func(err error) bool { return err == nil }},
+		{"stops at a permanent failure", []error{transient, rejected}, 2, func(err error) bool { return err == rejected }},
+		{"unwraps Permanent", []error{Permanent(transient)}, 1, func(err error) bool { return err == transient }},
+		{"gives up after MaxAttempts", []error{transient, transient, transient, transient}, 3, func(err error) bool {
+			return errors.Is(err, transient) && err.Error() != transient.Error()
+		}},
+	}
+	for _, tt := range tests {
+		attempts := 0
+		err := ExecuteWithRetry(context.Background(), tt.name, func() error {
+			attempts++
+			if attempts <= len(tt.errs) {
+				return tt.errs[attempts-1]
+			}
+			return nil
+		}, config)
+		if attempts != tt.attempts || !tt.check(err) {
+			t.Errorf("%s: %d attempts, error %v", tt.name, attempts, err)
+		}
+	}
+}
+
+func TestExecuteWithRetryStopsWhenCallerIsDone(t *testing.T) {
+	config := RetryConfig{MaxAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, IsRetryable: IsRetryable}
+
+	// A deadline is only retried while the caller's context has time left
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	attempts := 0
+	err := ExecuteWithRetry(ctx, "expired", func() error {
+		attempts++
+		return ctx.Err()
+	}, config)
+	if attempts != 1 || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expired context: %d attempts, error %v", attempts, err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	attempts = 0
+	err = ExecuteWithRetry(ctx, "cancelled during backoff", func() error {
+		attempts++
+		cancel()
+		return &pgconn.PgError{Code: "40P01"}
+	}, config)
+	if attempts != 1 || !errors.Is(err, context.Canceled) && !errors.As(err, new(*pgconn.PgError)) {
+		t.Fatalf("cancelled context: %d attempts, error %v", attempts, err)
+	}
+}
@@ -0,0 +1,90 @@
+package router
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// OpenAPI describes the routes of versions as an OpenAPI 3 document. The
+// policies of each operation come from the same route metadata the
+// Registrar enforces, as the extensions x-scopes, x-rate-limit (the class,
+// with its rate and burst when limits has it) and x-timeout, so the
+// documentation can't drift from what is served.
+func OpenAPI(title, version string, versions []Version, limits map[string]RateLimit) map[string]interface{} {
+	paths := map[string]map[string]interface{}{}
+	for _, v := range versions {
+		for _, route := range v.Routes {
+			path, params := openAPIPath(v.Prefix + route.Path)
+			if paths[path] == nil {
+				paths[path] = map[string]interface{}{}
+			}
+			paths[path][strings.ToLower(route.Method)] = operation(route, params, limits)
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    map[string]interface{}{"title": title, "version": version},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}
+}
+
+func operation(route Route, params []string, limits map[string]RateLimit) map[string]interface{} {
+	op := map[string]interface{}{
+		"summary":   route.Summary,
+		"responses": map[string]interface{}{"default": map[string]interface{}{"description": "JSON response; errors are {\"error\", \"code\"}"}},
+	}
+	if len(params) > 0 {
+		parameters := make([]interface{}, 0, len(params))
+		for _, name := range params {
+			parameters = append(parameters, map[string]interface{}{
+				"name": name, "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		op["parameters"] = parameters
+	}
+	if !route.Public() {
+		op["security"] = []interface{}{map[string]interface{}{"bearerAuth": []string{}}}
+		scopes := append([]string(nil), route.Scopes...)
+		sort.Strings(scopes)
+		op["x-scopes"] = scopes
+	}
+	if route.RateLimit != "" {
+		limit := map[string]interface{}{"class": route.RateLimit}
+		if l, ok := limits[route.RateLimit]; ok {
+			limit["rate"] = roundRate(float64(l.Rate))
+			limit["burst"] = l.Burst
+		}
+		op["x-rate-limit"] = limit
+	}
+	if route.Timeout > 0 {
+		op["x-timeout"] = route.Timeout.String()
+	}
+	return op
+}
+
+// openAPIPath turns a gin path such as /users/:id into /users/{id},
+// returning the names of its parameters
+func openAPIPath(path string) (string, []string) {
+	segments := strings.Split(path, "/")
+	var params []string
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			name := segment[1:]
+			params = append(params, name)
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// roundRate keeps rates such as one request every 6s readable
+func roundRate(perSecond float64) float64 {
+	return math.Round(perSecond*1000) / 1000
+}
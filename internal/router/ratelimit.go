@@ -0,0 +1,129 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+
+	"github.com/114windd/restapi/internal/logger"
+)
+
+// Rate limit classes
+const (
+	RateLimitDefault = "default"
+	RateLimitAuth    = "auth"   // credential endpoints, kept low to slow down guessing
+	RateLimitAdmin   = "admin"  // admin endpoints, some of which are expensive
+	RateLimitLookup  = "lookup" // unauthenticated existence checks, kept low to slow down enumeration
+)
+
+// RateLimit is a per-client token bucket
+type RateLimit struct {
+	Rate  rate.Limit
+	Burst int
+}
+
+// DefaultRateLimits are the limits applied to each class
+var DefaultRateLimits = map[string]RateLimit{
+	RateLimitDefault: {Rate: 20, Burst: 40},
+	RateLimitAuth:    {Rate: rate.Every(6 * time.Second), Burst: 10},
+	RateLimitAdmin:   {Rate: 5, Burst: 10},
+	RateLimitLookup:  {Rate: rate.Every(3 * time.Second), Burst: 5},
+}
+
+// LimitStore holds the token buckets behind a Limiter
+type LimitStore interface {
+	// Allow takes a token from the bucket identified by key, creating it
+	// with the given limit if needed, and reports whether one was available
+	Allow(ctx context.Context, key string, limit RateLimit) (bool, error)
+}
+
+// ParseRateLimits returns base with the classes of spec overridden. spec is
+// a comma-separated list of class=rate:burst, with rate in requests per
+// second, e.g. "default=20:40,auth=0.2:10".
+func ParseRateLimits(spec string, base map[string]RateLimit) (map[string]RateLimit, error) {
+	limits := make(map[string]RateLimit, len(base))
+	for class, limit := range base {
+		limits[class] = limit
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		class, value, ok := strings.Cut(entry, "=")
+		class = strings.TrimSpace(class)
+		if _, known := base[class]; !ok || !known {
+			return nil, fmt.Errorf("rate limit %q: expected a known class=rate:burst", entry)
+		}
+		r, b, ok := strings.Cut(value, ":")
+		perSecond, err := strconv.ParseFloat(strings.TrimSpace(r), 64)
+		if err != nil || perSecond <= 0 {
+			return nil, fmt.Errorf("rate limit %q: invalid rate", entry)
+		}
+		burst, err := strconv.Atoi(strings.TrimSpace(b))
+		if !ok || err != nil || burst <= 0 {
+			return nil, fmt.Errorf("rate limit %q: invalid burst", entry)
+		}
+		limits[class] = RateLimit{Rate: rate.Limit(perSecond), Burst: burst}
+	}
+	return limits, nil
+}
+
+// Limiter enforces rate limit classes per client IP
+type Limiter struct {
+	limits atomic.Pointer[map[string]RateLimit]
+	store  LimitStore
+}
+
+// NewLimiter creates a limiter for the given classes, keeping buckets in store
+func NewLimiter(limits map[string]RateLimit, store LimitStore) *Limiter {
+	l := &Limiter{store: store}
+	l.SetLimits(limits)
+	return l
+}
+
+// SetLimits replaces the class limits; it is safe to call while serving.
+// Existing client buckets take the new limit on their next request.
+func (l *Limiter) SetLimits(limits map[string]RateLimit) {
+	l.limits.Store(&limits)
+}
+
+// Limits returns the class limits currently enforced
+func (l *Limiter) Limits() map[string]RateLimit {
+	return *l.limits.Load()
+}
+
+// Allow reports whether a request from key in class may proceed. Unknown
+// classes are not limited, and neither are requests when the store fails,
+// so a storage outage doesn't take the API down with it.
+func (l *Limiter) Allow(ctx context.Context, class, key string) bool {
+	limit, ok := (*l.limits.Load())[class]
+	if !ok {
+		return true
+	}
+
+	allowed, err := l.store.Allow(ctx, class+"|"+key, limit)
+	if err != nil {
+		logger.Log.WithError(err).WithField("class", class).Warn("Rate limit store unavailable, allowing request")
+		return true
+	}
+	return allowed
+}
+
+// Middleware rejects requests over the class limit with 429
+func (l *Limiter) Middleware(class string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !l.Allow(c.Request.Context(), class, c.ClientIP()) {
+			logger.Log.WithField("client_ip", c.ClientIP()).WithField("class", class).Warn("Rate limit exceeded")
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			return
+		}
+		c.Next()
+	}
+}
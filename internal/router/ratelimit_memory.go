@@ -0,0 +1,68 @@
+package router
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// idleTimeout is how long an unused client bucket is kept
+const idleTimeout = 10 * time.Minute
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// MemoryLimitStore keeps token buckets in process, so each instance limits
+// independently
+type MemoryLimitStore struct {
+	mu      sync.Mutex
+	clients map[string]*clientLimiter
+	swept   time.Time
+}
+
+// NewMemoryLimitStore creates an empty MemoryLimitStore
+func NewMemoryLimitStore() *MemoryLimitStore {
+	return &MemoryLimitStore{
+		clients: make(map[string]*clientLimiter),
+		swept:   time.Now(),
+	}
+}
+
+// Allow implements LimitStore
+func (m *MemoryLimitStore) Allow(ctx context.Context, key string, limit RateLimit) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.swept) > idleTimeout {
+		m.sweep(now)
+	}
+
+	client, ok := m.clients[key]
+	if !ok {
+		client = &clientLimiter{limiter: rate.NewLimiter(limit.Rate, limit.Burst)}
+		m.clients[key] = client
+	} else if client.limiter.Limit() != limit.Rate || client.limiter.Burst() != limit.Burst {
+		// The class limit was changed since the bucket was created
+		client.limiter.SetLimitAt(now, limit.Rate)
+		client.limiter.SetBurstAt(now, limit.Burst)
+	}
+	client.lastSeen = now
+	return client.limiter.Allow(), nil
+}
+
+// sweep drops idle client buckets. Callers must hold m.mu.
+func (m *MemoryLimitStore) sweep(now time.Time) {
+	for key, client := range m.clients {
+		// A bucket that hasn't refilled yet still limits its client, which
+		// matters for slow limits such as codes sent per phone number
+		if now.Sub(client.lastSeen) > idleTimeout && client.limiter.TokensAt(now) >= float64(client.limiter.Burst()) {
+			delete(m.clients, key)
+		}
+	}
+	m.swept = now
+}
@@ -0,0 +1,65 @@
+package router
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/time/rate"
+)
+
+// redisLimitKeyPrefix namespaces rate limit buckets in a shared Redis
+const redisLimitKeyPrefix = "ratelimit:"
+
+// gcraScript implements a token bucket as GCRA: the key holds the
+// theoretical arrival time (TAT) of the next request in microseconds.
+// A request is allowed while the TAT stays within burst intervals of now.
+//
+//	ARGV[1] emission interval (µs per token), ARGV[2] burst
+var gcraScript = redis.NewScript(`
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local tat = tonumber(redis.call("GET", KEYS[1])) or now
+if tat < now then
+  tat = now
+end
+
+local new_tat = tat + interval
+if new_tat - now > burst * interval then
+  return 0
+end
+
+redis.call("SET", KEYS[1], new_tat, "PX", math.ceil((new_tat - now) / 1000))
+return 1
+`)
+
+// RedisLimitStore keeps token buckets in Redis, so limits apply across all
+// instances
+type RedisLimitStore struct {
+	client *redis.Client
+}
+
+// NewRedisLimitStore creates a RedisLimitStore
+func NewRedisLimitStore(client *redis.Client) *RedisLimitStore {
+	return &RedisLimitStore{client: client}
+}
+
+// Allow implements LimitStore
+func (r *RedisLimitStore) Allow(ctx context.Context, key string, limit RateLimit) (bool, error) {
+	if limit.Rate == rate.Inf {
+		return true, nil
+	}
+	if limit.Rate <= 0 || limit.Burst <= 0 {
+		return false, nil
+	}
+	interval := int64(math.Ceil(float64(time.Second/time.Microsecond) / float64(limit.Rate)))
+	allowed, err := gcraScript.Run(ctx, r.client, []string{redisLimitKeyPrefix + key}, interval, limit.Burst).Int()
+	if err != nil {
+		return false, err
+	}
+	return allowed == 1, nil
+}
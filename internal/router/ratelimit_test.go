@@ -0,0 +1,70 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	limits, err := ParseRateLimits(" auth=0.5:3 , admin=10:20", DefaultRateLimits)
+	if err != nil {
+		t.Fatalf("ParseRateLimits: %v", err)
+	}
+	if limits[RateLimitAuth] != (RateLimit{Rate: 0.5, Burst: 3}) || limits[RateLimitAdmin] != (RateLimit{Rate: 10, Burst: 20}) {
+		t.Fatalf("overridden classes: %+v", limits)
+	}
+	if limits[RateLimitDefault] != DefaultRateLimits[RateLimitDefault] {
+		t.Fatalf("default class changed: %+v", limits[RateLimitDefault])
+	}
+	if DefaultRateLimits[RateLimitAuth].Burst != 10 {
+		t.Fatal("ParseRateLimits modified its base")
+	}
+
+	for _, spec := range []string{"unknown=1:1", "auth", "auth=0:1", "auth=x:1", "auth=1", "auth=1:0", "auth=1:x"} {
+		if _, err := ParseRateLimits(spec, DefaultRateLimits); err == nil {
+			t.Errorf("ParseRateLimits(%q): expected an error", spec)
+		}
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Allow(context.Context, string, RateLimit) (bool, error) {
+	return false, errors.New("store down")
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := NewLimiter(map[string]RateLimit{RateLimitAuth: {Rate: rate.Every(time.Hour), Burst: 2}}, NewMemoryLimitStore())
+
+	for i := 0; i < 2; i++ {
+		if !l.Allow(ctx, RateLimitAuth, "192.0.2.1") {
+			t.Fatalf("request %d within the burst was refused", i+1)
+		}
+	}
+	if l.Allow(ctx, RateLimitAuth, "192.0.2.1") {
+		t.Fatal("request over the burst was allowed")
+	}
+	if !l.Allow(ctx, RateLimitAuth, "192.0.2.2") {
+		t.Fatal("another client shares the first one's bucket")
+	}
+	if !l.Allow(ctx, RateLimitAdmin, "192.0.2.1") {
+		t.Fatal("a class without a limit was limited")
+	}
+
+	// New limits apply to existing buckets
+	l.SetLimits(map[string]RateLimit{RateLimitAuth: {Rate: rate.Inf, Burst: 1}})
+	if !l.Allow(ctx, RateLimitAuth, "192.0.2.1") {
+		t.Fatal("raised limit not applied")
+	}
+
+	// A storage outage lets requests through
+	down := NewLimiter(DefaultRateLimits, failingStore{})
+	if !down.Allow(ctx, RateLimitAuth, "192.0.2.1") {
+		t.Fatal("request refused while the store is down")
+	}
+}
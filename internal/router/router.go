@@ -0,0 +1,321 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Scopes a route may require. Routes without scopes are public.
+const (
+	ScopeAuthenticated = "authenticated"
+	ScopeAdmin         = "admin"
+)
+
+// Route declares an endpoint together with the policies applied to it
+type Route struct {
+	Method    string
+	Path      string
+	Handler   gin.HandlerFunc
+	Summary   string
+	Scopes    []string      // required scopes; empty for public routes
+	RateLimit string        // rate limit class, see RateLimitClasses
+	Timeout   time.Duration // request context deadline (0 disables)
+	DryRun    bool          // accepts ?dry_run=true to validate without persisting
+	Upload    int64         // accepts multipart/form-data bodies up to this many bytes (0: JSON only)
+	Form      bool          // also accepts application/x-www-form-urlencoded bodies, e.g. provider callbacks
+	Stream    bool          // streams its response (e.g. Server-Sent Events), so it is not content-negotiated
+	NoConsent bool          // reachable by callers who haven't accepted the current terms of service
+	ReadOnly  bool          // changes nothing despite not being a GET, e.g. a query sent as POST; see IsReadOnly
+}
+
+// Public reports whether the route can be called without authentication
+func (r Route) Public() bool {
+	return len(r.Scopes) == 0
+}
+
+// readOnlyKey marks requests to routes declared ReadOnly
+const readOnlyKey = "read_only_route"
+
+// IsReadOnly reports whether a request can't change anything: a GET or HEAD,
+// or a request to a route declared ReadOnly. Middleware running before the
+// route's own handlers, such as authentication, can rely on it.
+func IsReadOnly(c *gin.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	}
+	return c.GetBool(readOnlyKey)
+}
+
+func markReadOnly(c *gin.Context) {
+	c.Set(readOnlyKey, true)
+	c.Next()
+}
+
+// Version is an API version: a route table served under a path prefix.
+// Versions are independent, so a new version can change handlers without
+// affecting existing clients.
+type Version struct {
+	Prefix string
+	Routes []Route
+}
+
+// Registrar mounts a route table on a gin router, enforcing each route's policies
+type Registrar struct {
+	// Authenticate runs before any route requiring a scope
+	Authenticate gin.HandlerFunc
+	// Scopes maps a scope to the middleware enforcing it. Scopes without an
+	// entry only require authentication.
+	Scopes map[string]gin.HandlerFunc
+	// Limiter enforces rate limit classes; nil disables rate limiting
+	Limiter *Limiter
+	// Consent runs after the scope checks of authenticated routes, except
+	// those reachable without accepting the terms of service
+	Consent gin.HandlerFunc
+	// DryRun runs before the handler of routes supporting dry runs
+	DryRun gin.HandlerFunc
+	// Negotiate runs before the handler of GET routes to render the response
+	// in a format the client accepts
+	Negotiate gin.HandlerFunc
+}
+
+// Register mounts routes on r
+func (reg *Registrar) Register(r gin.IRoutes, routes []Route) {
+	for _, route := range routes {
+		r.Handle(route.Method, route.Path, reg.chain(route)...)
+	}
+}
+
+// RegisterVersion mounts a version's routes under its prefix
+func (reg *Registrar) RegisterVersion(r gin.IRouter, version Version) {
+	reg.Register(r.Group(version.Prefix), version.Routes)
+}
+
+// chain builds the handler chain for a route: rate limit, timeout,
+// authentication, scope checks, terms of service consent, dry run handling,
+// content negotiation and finally the handler
+func (reg *Registrar) chain(route Route) []gin.HandlerFunc {
+	var handlers []gin.HandlerFunc
+
+	if route.ReadOnly {
+		handlers = append(handlers, markReadOnly)
+	}
+	if reg.Limiter != nil && route.RateLimit != "" {
+		handlers = append(handlers, reg.Limiter.Middleware(route.RateLimit))
+	}
+	if route.Timeout > 0 {
+		handlers = append(handlers, timeoutMiddleware(route.Timeout))
+	}
+	if !route.Public() && reg.Authenticate != nil {
+		handlers = append(handlers, reg.Authenticate)
+	}
+	for _, scope := range route.Scopes {
+		if enforce, ok := reg.Scopes[scope]; ok {
+			handlers = append(handlers, enforce)
+		}
+	}
+	if !route.Public() && !route.NoConsent && reg.Consent != nil {
+		handlers = append(handlers, reg.Consent)
+	}
+	if route.DryRun && reg.DryRun != nil {
+		handlers = append(handlers, reg.DryRun)
+	}
+	if route.Method == http.MethodGet && !route.Stream && reg.Negotiate != nil {
+		handlers = append(handlers, reg.Negotiate)
+	}
+
+	return append(handlers, route.Handler)
+}
+
+// timeoutMiddleware bounds the request context so downstream work (e.g.
+// database queries) is cancelled once the route's deadline passes, and
+// answers 504 at the deadline unless the response has already started. The
+// rest of the chain runs in its own goroutine, which is still waited for,
+// since its gin.Context is reused afterwards, but whatever it writes after
+// the deadline is dropped.
+func timeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		w := newTimeoutWriter(ctx, c.Writer)
+		c.Request = c.Request.WithContext(ctx)
+		c.Writer = w
+
+		done := make(chan interface{}, 1)
+		go func() {
+			defer func() { done <- recover() }()
+			c.Next()
+		}()
+
+		var recovered interface{}
+		select {
+		case recovered = <-done:
+		case <-ctx.Done():
+			// A client that went away gets no response either way
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				w.timeout()
+			}
+			recovered = <-done
+		}
+		c.Writer = w.ResponseWriter
+		if recovered != nil {
+			// Re-raised for the recovery middleware, which runs on this goroutine
+			panic(recovered)
+		}
+		w.finish()
+	}
+}
+
+var timeoutResponse = gin.H{"error": "Request timed out", "code": "timeout"}
+
+// timeoutWriter guards the response of a handler running against a
+// deadline. The handler gets headers of its own, sent when it starts its
+// response, so that a 504 written concurrently at the deadline isn't mixed
+// with them. Once the 504 is written, the handler's writes are dropped.
+type timeoutWriter struct {
+	gin.ResponseWriter
+	ctx context.Context
+
+	mu        sync.Mutex
+	header    http.Header
+	committed bool // header has been copied to the response
+	timedOut  bool
+}
+
+func newTimeoutWriter(ctx context.Context, w gin.ResponseWriter) *timeoutWriter {
+	return &timeoutWriter{ResponseWriter: w, ctx: ctx, header: w.Header().Clone()}
+}
+
+// timeout writes the 504 unless the handler's response has started
+func (w *timeoutWriter) timeout() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.start()
+}
+
+// finish completes the response of a handler that returned without
+// writing a body: a 504 past the deadline, and otherwise its headers, e.g.
+// along with a status it set
+func (w *timeoutWriter) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.start() {
+		w.commit()
+	}
+}
+
+// start writes the 504 instead of a response started after the deadline,
+// reporting whether the handler's response is dropped. w.mu must be held.
+func (w *timeoutWriter) start() bool {
+	if !w.timedOut && !w.ResponseWriter.Written() && errors.Is(w.ctx.Err(), context.DeadlineExceeded) {
+		w.writeTimeout()
+	}
+	return w.timedOut
+}
+
+// writeTimeout writes the 504 and flushes it, so that the client has its
+// response while the handler is still running. w.mu must be held.
+func (w *timeoutWriter) writeTimeout() {
+	w.timedOut = true
+	body, _ := json.Marshal(timeoutResponse)
+	header := w.ResponseWriter.Header()
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	w.ResponseWriter.WriteHeader(http.StatusGatewayTimeout)
+	_, _ = w.ResponseWriter.Write(body)
+	w.ResponseWriter.Flush()
+}
+
+// commit replaces the response headers with the handler's. w.mu must be held.
+func (w *timeoutWriter) commit() {
+	if w.committed {
+		return
+	}
+	w.committed = true
+	header := w.ResponseWriter.Header()
+	for key := range header {
+		delete(header, key)
+	}
+	for key, values := range w.header {
+		header[key] = values
+	}
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.start() {
+		return
+	}
+	w.commit()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.start() {
+		return len(b), nil
+	}
+	w.commit()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.start() {
+		return len(s), nil
+	}
+	w.commit()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *timeoutWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.start() {
+		return
+	}
+	w.commit()
+	w.ResponseWriter.Flush()
+}
+
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Status()
+}
+
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Size()
+}
+
+func (w *timeoutWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Written()
+}
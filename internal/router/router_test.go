@@ -0,0 +1,206 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+
+	"github.com/114windd/restapi/internal/logger"
+)
+
+func init() {
+	logger.Init()
+	logger.Log.SetOutput(io.Discard)
+	gin.SetMode(gin.TestMode)
+}
+
+// recorder returns a handler appending name to the trace of the request
+func recorder(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		trace, _ := c.Get("trace")
+		names, _ := trace.([]string)
+		c.Set("trace", append(names, name))
+	}
+}
+
+func serve(r http.Handler, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestRegistrarChain(t *testing.T) {
+	reg := &Registrar{
+		Authenticate: recorder("authenticate"),
+		Scopes:       map[string]gin.HandlerFunc{ScopeAdmin: recorder("admin")},
+		Limiter:      NewLimiter(map[string]RateLimit{RateLimitAuth: {Rate: rate.Every(time.Hour), Burst: 1}}, NewMemoryLimitStore()),
+		Consent:      recorder("consent"),
+		DryRun:       recorder("dry_run"),
+		Negotiate:    recorder("negotiate"),
+	}
+	var trace []string
+	handler := func(c *gin.Context) {
+		recorder("handler")(c)
+		names, _ := c.Get("trace")
+		trace = names.([]string)
+		c.Status(http.StatusOK)
+	}
+
+	r := gin.New()
+	reg.Register(r, []Route{
+		{Method: http.MethodPost, Path: "/public", Handler: handler, RateLimit: RateLimitAuth, DryRun: true},
+		{Method: http.MethodGet, Path: "/admin", Handler: handler, Scopes: []string{ScopeAuthenticated, ScopeAdmin}},
+		{Method: http.MethodGet, Path: "/terms", Handler: handler, Scopes: []string{ScopeAuthenticated}, NoConsent: true, Stream: true},
+	})
+
+	for _, tc := range []struct {
+		method, path string
+		want         []string
+	}{
+		{http.MethodPost, "/public", []string{"dry_run", "handler"}},
+		{http.MethodGet, "/admin", []string{"authenticate", "admin", "consent", "negotiate", "handler"}},
+		{http.MethodGet, "/terms", []string{"authenticate", "handler"}},
+	} {
+		trace = nil
+		if w := serve(r, tc.method, tc.path); w.Code != http.StatusOK || !reflect.DeepEqual(trace, tc.want) {
+			t.Errorf("%s %s: status %d, chain %v, want %v", tc.method, tc.path, w.Code, trace, tc.want)
+		}
+	}
+
+	// The route's rate limit class applies before anything else runs
+	trace = nil
+	if w := serve(r, http.MethodPost, "/public"); w.Code != http.StatusTooManyRequests || trace != nil {
+		t.Fatalf("POST /public over its limit: status %d, chain %v", w.Code, trace)
+	}
+}
+
+func TestReadOnlyRoutes(t *testing.T) {
+	var readOnly bool
+	check := func(c *gin.Context) { readOnly = IsReadOnly(c) }
+
+	r := gin.New()
+	(&Registrar{}).Register(r, []Route{
+		{Method: http.MethodGet, Path: "/get", Handler: check},
+		{Method: http.MethodPost, Path: "/query", Handler: check, ReadOnly: true},
+		{Method: http.MethodPost, Path: "/write", Handler: check},
+	})
+	for path, want := range map[string]bool{"/query": true, "/write": false} {
+		serve(r, http.MethodPost, path)
+		if readOnly != want {
+			t.Errorf("POST %s: IsReadOnly = %v, want %v", path, readOnly, want)
+		}
+	}
+	serve(r, http.MethodGet, "/get")
+	if !readOnly {
+		t.Error("GET /get: IsReadOnly = false")
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	versions := []Version{{Prefix: "/api/v1", Routes: []Route{
+		{Method: http.MethodPost, Path: "/login", Summary: "Log in", RateLimit: RateLimitAuth, Timeout: 10 * time.Second},
+		{Method: http.MethodGet, Path: "/users/:id", Summary: "Get a user", Scopes: []string{ScopeAuthenticated}, RateLimit: RateLimitDefault},
+		{Method: http.MethodDelete, Path: "/users/:id", Summary: "Delete a user", Scopes: []string{ScopeAuthenticated, ScopeAdmin}},
+	}}}
+	doc := OpenAPI("restapi", "v1.2.0", versions, map[string]RateLimit{RateLimitAuth: {Rate: rate.Every(6 * time.Second), Burst: 10}})
+	paths := doc["paths"].(map[string]map[string]interface{})
+
+	login := paths["/api/v1/login"]["post"].(map[string]interface{})
+	if limit := login["x-rate-limit"].(map[string]interface{}); limit["class"] != RateLimitAuth || limit["rate"] != 0.167 || limit["burst"] != 10 {
+		t.Fatalf("login rate limit: %v", limit)
+	}
+	if login["x-timeout"] != "10s" || login["security"] != nil {
+		t.Fatalf("login: %v", login)
+	}
+
+	user := paths["/api/v1/users/{id}"]
+	if len(user) != 2 {
+		t.Fatalf("/users/{id}: expected GET and DELETE, got %v", user)
+	}
+	get := user["get"].(map[string]interface{})
+	if get["security"] == nil || get["x-rate-limit"].(map[string]interface{})["rate"] != nil {
+		t.Fatalf("GET /users/{id}: %v", get)
+	}
+	params := get["parameters"].([]interface{})
+	if len(params) != 1 || params[0].(map[string]interface{})["name"] != "id" {
+		t.Fatalf("GET /users/{id} parameters: %v", params)
+	}
+	if scopes := user["delete"].(map[string]interface{})["x-scopes"].([]string); strings.Join(scopes, ",") != "admin,authenticated" {
+		t.Fatalf("DELETE /users/{id} scopes: %v", scopes)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	r := gin.New()
+	(&Registrar{}).Register(r, []Route{
+		{Method: http.MethodGet, Path: "/failed", Timeout: time.Millisecond, Handler: func(c *gin.Context) {
+			<-c.Request.Context().Done()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed: context deadline exceeded"})
+		}},
+		{Method: http.MethodGet, Path: "/silent", Timeout: time.Millisecond, Handler: func(c *gin.Context) {
+			<-c.Request.Context().Done()
+		}},
+		{Method: http.MethodGet, Path: "/late", Timeout: time.Millisecond, Handler: func(c *gin.Context) {
+			<-c.Request.Context().Done()
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		}},
+		{Method: http.MethodGet, Path: "/error", Timeout: time.Minute, Handler: func(c *gin.Context) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "boom"})
+		}},
+	})
+
+	for _, tc := range []struct {
+		path   string
+		status int
+		body   string
+	}{
+		// Responses written after the deadline are replaced with a 504
+		{"/failed", http.StatusGatewayTimeout, `{"code":"timeout","error":"Request timed out"}`},
+		{"/silent", http.StatusGatewayTimeout, `{"code":"timeout","error":"Request timed out"}`},
+		{"/late", http.StatusGatewayTimeout, `{"code":"timeout","error":"Request timed out"}`},
+		// Responses within the deadline are left alone
+		{"/error", http.StatusInternalServerError, `{"error":"boom"}`},
+	} {
+		w := serve(r, http.MethodGet, tc.path)
+		if w.Code != tc.status || w.Body.String() != tc.body {
+			t.Errorf("GET %s: status %d, body %s; want %d, %s", tc.path, w.Code, w.Body.String(), tc.status, tc.body)
+		}
+	}
+}
+
+func TestTimeoutPreemptsHandler(t *testing.T) {
+	release := make(chan struct{})
+	returned := make(chan struct{})
+	r := gin.New()
+	(&Registrar{}).Register(r, []Route{
+		{Method: http.MethodGet, Path: "/stuck", Timeout: 10 * time.Millisecond, Handler: func(c *gin.Context) {
+			defer close(returned)
+			// Ignores its context, and answers only once the client has its 504
+			c.Header("X-Handler", "stuck")
+			<-release
+			c.JSON(http.StatusOK, gin.H{"status": "done"})
+		}},
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(srv.URL + "/stuck")
+	close(release)
+	if err != nil {
+		t.Fatalf("GET /stuck: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGatewayTimeout || string(body) != `{"code":"timeout","error":"Request timed out"}` || resp.Header.Get("X-Handler") != "" {
+		t.Fatalf("GET /stuck: status %d, headers %v, body %s", resp.StatusCode, resp.Header, body)
+	}
+	<-returned
+}
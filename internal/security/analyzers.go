@@ -0,0 +1,258 @@
+package security
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/114windd/restapi/internal/cache"
+)
+
+// Analyzer names, labelling findings, flags and metrics
+const (
+	AnalyzerFailedLogins     = "failed_logins"
+	AnalyzerNewIP            = "new_ip"
+	AnalyzerImpossibleTravel = "impossible_travel"
+)
+
+// maxKnownIPs bounds the addresses remembered per account
+const maxKnownIPs = 20
+
+// earthRadiusKm is the mean radius of the Earth
+const earthRadiusKm = 6371.0
+
+// FailedLogins flags accounts whose logins fail repeatedly, which
+// bruteforce delays slow down but don't report
+type FailedLogins struct {
+	store     cache.Store
+	threshold int
+	window    time.Duration
+}
+
+// failureCount counts the failures of one login within a window
+type failureCount struct {
+	Count int       `json:"count"`
+	Since time.Time `json:"since"`
+}
+
+// NewFailedLogins reports the threshold-th failure for a login within
+// window. store must keep entries for at least window.
+func NewFailedLogins(store cache.Store, threshold int, window time.Duration) *FailedLogins {
+	return &FailedLogins{store: store, threshold: threshold, window: window}
+}
+
+// Analyze implements Analyzer. Only the failure that reaches the threshold
+// is reported, so a sustained attack flags the account once per window.
+func (a *FailedLogins) Analyze(ctx context.Context, e Event) ([]Finding, error) {
+	if e.Kind != LoginFailed {
+		return nil, nil
+	}
+	count, err := a.count(ctx, e)
+	if err != nil || count.Count+1 != a.threshold {
+		return nil, err
+	}
+	return []Finding{{
+		Analyzer: AnalyzerFailedLogins,
+		Severity: SeverityMedium,
+		Reason:   fmt.Sprintf("%d failed logins within %s", a.threshold, a.window),
+		Flag:     true,
+	}}, nil
+}
+
+// Record implements Analyzer. A successful login clears the count.
+func (a *FailedLogins) Record(ctx context.Context, e Event) error {
+	key := failuresKey(e)
+	if e.Kind != LoginFailed {
+		return a.store.Delete(ctx, key)
+	}
+	count, err := a.count(ctx, e)
+	if err != nil {
+		return err
+	}
+	if count.Count == 0 {
+		count.Since = e.At
+	}
+	count.Count++
+	return a.store.Set(ctx, key, count)
+}
+
+// count returns the failures within the window ending at e
+func (a *FailedLogins) count(ctx context.Context, e Event) (failureCount, error) {
+	var count failureCount
+	ok, err := a.store.Get(ctx, failuresKey(e), &count)
+	if err != nil || !ok || e.At.Sub(count.Since) > a.window {
+		return failureCount{}, err
+	}
+	return count, nil
+}
+
+// NewIP reports logins from addresses an account has not logged in from
+type NewIP struct {
+	store cache.Store
+}
+
+// NewNewIP creates a NewIP analyzer remembering addresses in store
+func NewNewIP(store cache.Store) *NewIP {
+	return &NewIP{store: store}
+}
+
+// Analyze implements Analyzer. An account's first login is not reported,
+// since every address is new to it.
+func (a *NewIP) Analyze(ctx context.Context, e Event) ([]Finding, error) {
+	if e.Kind != LoginSucceeded || e.UserID == 0 || e.IP == "" {
+		return nil, nil
+	}
+	known, err := a.known(ctx, e)
+	if err != nil || len(known) == 0 || contains(known, e.IP) {
+		return nil, err
+	}
+	reason := "Login from a new IP address " + e.IP
+	if e.Location.Country != "" {
+		reason += " in " + place(e)
+	}
+	return []Finding{{Analyzer: AnalyzerNewIP, Severity: SeverityLow, Reason: reason}}, nil
+}
+
+// Record implements Analyzer, keeping the most recent addresses
+func (a *NewIP) Record(ctx context.Context, e Event) error {
+	if e.Kind != LoginSucceeded || e.UserID == 0 || e.IP == "" {
+		return nil
+	}
+	known, err := a.known(ctx, e)
+	if err != nil {
+		return err
+	}
+	updated := []string{e.IP}
+	for _, ip := range known {
+		if ip != e.IP && len(updated) < maxKnownIPs {
+			updated = append(updated, ip)
+		}
+	}
+	return a.store.Set(ctx, userKey(e, "ips"), updated)
+}
+
+func (a *NewIP) known(ctx context.Context, e Event) ([]string, error) {
+	var known []string
+	if _, err := a.store.Get(ctx, userKey(e, "ips"), &known); err != nil {
+		return nil, err
+	}
+	return known, nil
+}
+
+// ImpossibleTravel reports logins too far from an account's previous login
+// to have been reached in the time between them. It relies on GeoIP
+// coordinates; logins that can't be located are ignored.
+type ImpossibleTravel struct {
+	store  cache.Store
+	maxKmh float64
+}
+
+// lastLogin is where and when an account last logged in
+type lastLogin struct {
+	IP        string    `json:"ip"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Accuracy  float64   `json:"accuracy_km"`
+	Place     string    `json:"place"`
+	At        time.Time `json:"at"`
+}
+
+// NewImpossibleTravel reports travel faster than maxKmh between logins
+func NewImpossibleTravel(store cache.Store, maxKmh float64) *ImpossibleTravel {
+	return &ImpossibleTravel{store: store, maxKmh: maxKmh}
+}
+
+// Analyze implements Analyzer. The accuracy radii of both locations are
+// taken off the distance, so imprecise lookups don't raise false alarms.
+func (a *ImpossibleTravel) Analyze(ctx context.Context, e Event) ([]Finding, error) {
+	if e.Kind != LoginSucceeded || e.UserID == 0 || !located(e) {
+		return nil, nil
+	}
+	var last lastLogin
+	ok, err := a.store.Get(ctx, userKey(e, "last_login"), &last)
+	if err != nil || !ok || last.IP == e.IP {
+		return nil, err
+	}
+
+	distance := haversine(last.Latitude, last.Longitude, e.Location.Latitude, e.Location.Longitude) -
+		last.Accuracy - float64(e.Location.AccuracyRadius)
+	if distance <= 0 {
+		return nil, nil
+	}
+	hours := e.At.Sub(last.At).Hours()
+	if hours > 0 && distance/hours <= a.maxKmh {
+		return nil, nil
+	}
+	return []Finding{{
+		Analyzer: AnalyzerImpossibleTravel,
+		Severity: SeverityHigh,
+		Reason:   fmt.Sprintf("Login from %s %.0f km from the previous login in %s %s earlier", place(e), distance, last.Place, e.At.Sub(last.At).Round(time.Minute)),
+		Flag:     true,
+		StepUp:   true,
+	}}, nil
+}
+
+// Record implements Analyzer, remembering the last located login
+func (a *ImpossibleTravel) Record(ctx context.Context, e Event) error {
+	if e.Kind != LoginSucceeded || e.UserID == 0 || !located(e) {
+		return nil
+	}
+	return a.store.Set(ctx, userKey(e, "last_login"), lastLogin{
+		IP:        e.IP,
+		Latitude:  e.Location.Latitude,
+		Longitude: e.Location.Longitude,
+		Accuracy:  float64(e.Location.AccuracyRadius),
+		Place:     place(e),
+		At:        e.At,
+	})
+}
+
+// located reports whether the event has coordinates. GeoIP databases
+// without cities, and private addresses, leave them unset.
+func located(e Event) bool {
+	return e.Location.Latitude != 0 || e.Location.Longitude != 0
+}
+
+// haversine returns the great-circle distance in kilometres between two points
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// place names where an event came from, e.g. "Paris, FR"
+func place(e Event) string {
+	switch {
+	case e.Location.City != "" && e.Location.Country != "":
+		return e.Location.City + ", " + e.Location.Country
+	case e.Location.Country != "":
+		return e.Location.Country
+	default:
+		return e.IP
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// History is keyed by tenant, like other per-account state
+func userKey(e Event, kind string) string {
+	return e.TenantID + ":security:" + kind + ":" + strconv.FormatUint(uint64(e.UserID), 10)
+}
+
+// failuresKey counts failures by login rather than account, since failed
+// logins often name no account
+func failuresKey(e Event) string {
+	return e.TenantID + ":security:failures:" + strings.ToLower(e.Login)
+}
@@ -0,0 +1,188 @@
+// Package security watches authentication events for signs of account
+// takeover. Pluggable analyzers inspect each event, such as a failed login
+// or a login from a new address, and report findings; the Monitor counts
+// and logs them and, as the findings ask, flags the account for review,
+// requires step-up authentication or sends an alert to a webhook.
+package security
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/geoip"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/metrics"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// Event kinds
+const (
+	LoginSucceeded = "login_succeeded"
+	LoginFailed    = "login_failed"
+)
+
+// Finding severities
+const (
+	SeverityLow    = "low"
+	SeverityMedium = "medium"
+	SeverityHigh   = "high"
+)
+
+// alertTimeout bounds the delivery of one alert
+const alertTimeout = 10 * time.Second
+
+// Event is an authentication event
+type Event struct {
+	Kind      string
+	UserID    uint   // 0 when a failure names no known account
+	Login     string // the email address or phone number logged in with
+	TenantID  string
+	IP        string
+	Location  geoip.Location
+	UserAgent string
+	At        time.Time
+}
+
+// Finding is something suspicious an analyzer found in an event
+type Finding struct {
+	Analyzer string `json:"analyzer"`
+	Severity string `json:"severity"`
+	Reason   string `json:"reason"`
+	Flag     bool   `json:"flag"`    // flag the account for review
+	StepUp   bool   `json:"step_up"` // require a second factor before the login completes
+}
+
+// Verdict is what the analyzers made of an event
+type Verdict struct {
+	Findings []Finding
+	StepUp   bool // some finding asked for step-up authentication
+}
+
+// Analyzer inspects authentication events against the history it keeps.
+// Analyze must not change the history: a login held for step-up
+// authentication is only recorded once it completes.
+type Analyzer interface {
+	Analyze(ctx context.Context, e Event) ([]Finding, error)
+	Record(ctx context.Context, e Event) error
+}
+
+// FlagStore persists account flags
+type FlagStore interface {
+	CreateSecurityFlag(ctx context.Context, flag *models.SecurityFlag) error
+	ListSecurityFlags(ctx context.Context, status string) ([]models.SecurityFlag, error)
+	ResolveSecurityFlag(ctx context.Context, id, adminID uint, at time.Time) (*models.SecurityFlag, error)
+}
+
+// Alerter notifies someone of findings, e.g. through a webhook
+type Alerter interface {
+	Alert(ctx context.Context, e Event, findings []Finding) error
+}
+
+// Monitor runs events through its analyzers and acts on their findings
+type Monitor struct {
+	analyzers []Analyzer
+	flags     FlagStore
+	alerter   Alerter
+}
+
+// NewMonitor creates a Monitor running analyzers in order. Flags and
+// alerts are disabled until configured.
+func NewMonitor(analyzers ...Analyzer) *Monitor {
+	return &Monitor{analyzers: analyzers}
+}
+
+// SetFlagStore enables flagging accounts
+func (m *Monitor) SetFlagStore(flags FlagStore) {
+	m.flags = flags
+}
+
+// SetAlerter enables alerts, sent in the background
+func (m *Monitor) SetAlerter(alerter Alerter) {
+	m.alerter = alerter
+}
+
+// Flags lists the tenant's account flags, optionally only the open or
+// resolved ones
+func (m *Monitor) Flags(ctx context.Context, status string) ([]models.SecurityFlag, error) {
+	if m.flags == nil {
+		return []models.SecurityFlag{}, nil
+	}
+	return m.flags.ListSecurityFlags(ctx, status)
+}
+
+// ResolveFlag closes a flag once an admin has reviewed the account
+func (m *Monitor) ResolveFlag(ctx context.Context, id, adminID uint) (*models.SecurityFlag, error) {
+	if m.flags == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return m.flags.ResolveSecurityFlag(ctx, id, adminID, time.Now())
+}
+
+// Screen analyzes an event without recording it and acts on the findings.
+// Failing analyzers are logged and skipped, so they never block a login.
+func (m *Monitor) Screen(ctx context.Context, e Event) Verdict {
+	var v Verdict
+	for _, a := range m.analyzers {
+		findings, err := a.Analyze(ctx, e)
+		if err != nil {
+			logger.Log.WithError(err).WithField("kind", e.Kind).Warn("Anomaly analyzer failed")
+			continue
+		}
+		v.Findings = append(v.Findings, findings...)
+	}
+
+	for _, f := range v.Findings {
+		metrics.RecordSecurityFinding(f.Analyzer, f.Severity)
+		logger.Log.WithFields(map[string]interface{}{
+			"type":     "security",
+			"analyzer": f.Analyzer,
+			"severity": f.Severity,
+			"user_id":  e.UserID,
+			"ip":       e.IP,
+		}).WithFields(e.Location.LogFields()).Warn(f.Reason)
+
+		v.StepUp = v.StepUp || f.StepUp
+		if f.Flag && e.UserID != 0 && m.flags != nil {
+			flag := &models.SecurityFlag{UserID: e.UserID, TenantID: e.TenantID, Analyzer: f.Analyzer, Severity: f.Severity, Reason: f.Reason, IP: e.IP}
+			if err := m.flags.CreateSecurityFlag(ctx, flag); err != nil {
+				logger.Log.WithError(err).WithField("user_id", e.UserID).Error("Failed to flag account")
+			}
+		}
+	}
+
+	if len(v.Findings) > 0 && m.alerter != nil {
+		go m.alert(context.WithoutCancel(ctx), e, v.Findings)
+	}
+	return v
+}
+
+// Record adds an event to the analyzers' history
+func (m *Monitor) Record(ctx context.Context, e Event) {
+	for _, a := range m.analyzers {
+		if err := a.Record(ctx, e); err != nil {
+			logger.Log.WithError(err).WithField("kind", e.Kind).Warn("Failed to record authentication event")
+		}
+	}
+}
+
+// Observe screens and records an event that needs no decision, such as a
+// failed login
+func (m *Monitor) Observe(ctx context.Context, e Event) Verdict {
+	v := m.Screen(ctx, e)
+	m.Record(ctx, e)
+	return v
+}
+
+func (m *Monitor) alert(ctx context.Context, e Event, findings []Finding) {
+	ctx, cancel := context.WithTimeout(ctx, alertTimeout)
+	defer cancel()
+
+	if err := m.alerter.Alert(ctx, e, findings); err != nil {
+		metrics.RecordSecurityAlert("error")
+		logger.Log.WithError(err).WithField("user_id", e.UserID).Error("Failed to send security alert")
+		return
+	}
+	metrics.RecordSecurityAlert("sent")
+}
@@ -0,0 +1,188 @@
+package security
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/114windd/restapi/internal/cache"
+	"github.com/114windd/restapi/internal/geoip"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+func init() {
+	logger.Init()
+	logger.Log.SetOutput(io.Discard)
+}
+
+var (
+	paris  = geoip.Location{Country: "FR", City: "Paris", Latitude: 48.8566, Longitude: 2.3522, AccuracyRadius: 20}
+	lyon   = geoip.Location{Country: "FR", City: "Lyon", Latitude: 45.764, Longitude: 4.8357, AccuracyRadius: 20}
+	sydney = geoip.Location{Country: "AU", City: "Sydney", Latitude: -33.8688, Longitude: 151.2093, AccuracyRadius: 20}
+)
+
+func TestFailedLogins(t *testing.T) {
+	ctx := context.Background()
+	a := NewFailedLogins(cache.NewMemoryStore(time.Hour), 3, 15*time.Minute)
+	start := time.Now()
+	fail := func(at time.Time) []Finding {
+		t.Helper()
+		e := Event{Kind: LoginFailed, Login: "Alice@example.com", At: at}
+		findings, err := a.Analyze(ctx, e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := a.Record(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+		return findings
+	}
+
+	for i, want := range []int{0, 0, 1, 0} {
+		if got := fail(start.Add(time.Duration(i) * time.Minute)); len(got) != want {
+			t.Fatalf("failure %d: expected %d findings, got %+v", i+1, want, got)
+		}
+	}
+
+	// The count starts over once the window has passed, and after a success
+	if got := fail(start.Add(20 * time.Minute)); len(got) != 0 {
+		t.Fatalf("expected the window to restart, got %+v", got)
+	}
+	if err := a.Record(ctx, Event{Kind: LoginSucceeded, Login: "alice@example.com", UserID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fail(start.Add(21 * time.Minute)); len(got) != 0 {
+		t.Fatalf("expected a success to reset the count, got %+v", got)
+	}
+}
+
+func TestNewIP(t *testing.T) {
+	ctx := context.Background()
+	a := NewNewIP(cache.NewMemoryStore(time.Hour))
+	login := func(ip string) []Finding {
+		t.Helper()
+		e := Event{Kind: LoginSucceeded, UserID: 1, IP: ip, Location: paris, At: time.Now()}
+		findings, err := a.Analyze(ctx, e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = a.Record(ctx, e)
+		return findings
+	}
+
+	if got := login("203.0.113.1"); len(got) != 0 {
+		t.Fatalf("expected no finding for the first login, got %+v", got)
+	}
+	if got := login("203.0.113.1"); len(got) != 0 {
+		t.Fatalf("expected no finding for a known address, got %+v", got)
+	}
+	got := login("203.0.113.2")
+	if len(got) != 1 || got[0].Severity != SeverityLow || got[0].Flag || got[0].StepUp {
+		t.Fatalf("expected a low severity finding, got %+v", got)
+	}
+	if got[0].Reason != "Login from a new IP address 203.0.113.2 in Paris, FR" {
+		t.Errorf("unexpected reason %q", got[0].Reason)
+	}
+}
+
+func TestImpossibleTravel(t *testing.T) {
+	ctx := context.Background()
+	a := NewImpossibleTravel(cache.NewMemoryStore(time.Hour), 1000)
+	start := time.Now()
+	tests := []struct {
+		name     string
+		ip       string
+		location geoip.Location
+		after    time.Duration
+		want     bool
+	}{
+		{"first login", "203.0.113.1", paris, 0, false},
+		{"unlocated", "192.0.2.1", geoip.Location{}, time.Minute, false},
+		{"Lyon by train", "203.0.113.2", lyon, 3 * time.Hour, false},
+		{"Sydney an hour later", "198.51.100.1", sydney, 4 * time.Hour, true},
+		{"Sydney a day later", "198.51.100.2", sydney, 28 * time.Hour, false},
+	}
+	for _, tt := range tests {
+		e := Event{Kind: LoginSucceeded, UserID: 1, IP: tt.ip, Location: tt.location, At: start.Add(tt.after)}
+		findings, err := a.Analyze(ctx, e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(findings) == 1; got != tt.want {
+			t.Errorf("%s: expected a finding %v, got %+v", tt.name, tt.want, findings)
+		}
+		if tt.want && (!findings[0].StepUp || !findings[0].Flag) {
+			t.Errorf("%s: expected step-up and a flag, got %+v", tt.name, findings[0])
+		}
+		if tt.name != "Sydney an hour later" {
+			_ = a.Record(ctx, e)
+		}
+	}
+}
+
+// flagStore keeps flags in memory
+type flagStore struct {
+	flags []models.SecurityFlag
+}
+
+func (s *flagStore) CreateSecurityFlag(ctx context.Context, flag *models.SecurityFlag) error {
+	s.flags = append(s.flags, *flag)
+	return nil
+}
+
+func (s *flagStore) ListSecurityFlags(ctx context.Context, status string) ([]models.SecurityFlag, error) {
+	return s.flags, nil
+}
+
+func (s *flagStore) ResolveSecurityFlag(ctx context.Context, id, adminID uint, at time.Time) (*models.SecurityFlag, error) {
+	return nil, nil
+}
+
+func TestMonitorAlertsWebhook(t *testing.T) {
+	payloads := make(chan webhookPayload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) != Sign([]byte("secret"), body) {
+			t.Errorf("bad signature %q", r.Header.Get(SignatureHeader))
+		}
+		var payload webhookPayload
+		_ = json.Unmarshal(body, &payload)
+		payloads <- payload
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	flags := &flagStore{}
+	m := NewMonitor(NewFailedLogins(cache.NewMemoryStore(time.Hour), 1, time.Minute))
+	m.SetFlagStore(flags)
+	m.SetAlerter(NewWebhookAlerter(server.URL, "secret"))
+
+	// Failures naming no account are alerted on but can't be flagged
+	v := m.Observe(ctx, Event{Kind: LoginFailed, Login: "alice@example.com", IP: "203.0.113.1", At: time.Now()})
+	if len(v.Findings) != 1 || v.StepUp {
+		t.Fatalf("unexpected verdict %+v", v)
+	}
+	if len(flags.flags) != 0 {
+		t.Errorf("expected no flags, got %+v", flags.flags)
+	}
+	select {
+	case payload := <-payloads:
+		if payload.Event != LoginFailed || payload.IP != "203.0.113.1" || len(payload.Findings) != 1 || payload.Findings[0].Analyzer != AnalyzerFailedLogins {
+			t.Errorf("unexpected payload %+v", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no alert")
+	}
+
+	// Failures against a known account flag it
+	m.Observe(ctx, Event{Kind: LoginFailed, UserID: 7, Login: "bob@example.com", At: time.Now()})
+	if len(flags.flags) != 1 || flags.flags[0].UserID != 7 || flags.flags[0].Severity != SeverityMedium {
+		t.Errorf("expected a flag on user 7, got %+v", flags.flags)
+	}
+	<-payloads
+}
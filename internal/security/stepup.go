@@ -0,0 +1,130 @@
+package security
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/114windd/restapi/internal/cache"
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/mail"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+const (
+	codeDigits = 6
+	// maxAttempts is how many wrong guesses invalidate a code
+	maxAttempts = 5
+)
+
+// ErrInvalidCode is returned for wrong, used or expired step-up codes
+var ErrInvalidCode = errors.New("invalid or expired step-up code")
+
+// pendingCode is a step-up code that was mailed and not yet used. Only its
+// hash is stored.
+type pendingCode struct {
+	Hash      string    `json:"hash"`
+	Attempts  int       `json:"attempts"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// StepUp confirms suspicious logins with a code mailed to the account
+type StepUp struct {
+	codes  cache.Store
+	mailer mail.Mailer
+	ttl    time.Duration
+}
+
+// NewStepUp creates a StepUp whose codes are valid for ttl. codes must keep
+// entries for at least ttl.
+func NewStepUp(codes cache.Store, mailer mail.Mailer, ttl time.Duration) *StepUp {
+	return &StepUp{codes: codes, mailer: mailer, ttl: ttl}
+}
+
+// Challenge mails user a code confirming a login from e, replacing any
+// earlier code
+func (s *StepUp) Challenge(ctx context.Context, user *models.User, e Event) error {
+	key := stepUpKey(ctx, user.ID)
+	code, err := generateCode()
+	if err != nil {
+		return err
+	}
+	pending := pendingCode{Hash: hashCode(code), ExpiresAt: time.Now().Add(s.ttl)}
+	if err := s.codes.Set(ctx, key, pending); err != nil {
+		return err
+	}
+
+	location := ""
+	if e.Location.Country != "" {
+		location = place(e)
+	}
+	data := mail.StepUpData{Name: user.Name, Code: code, ExpiresAt: pending.ExpiresAt, IP: e.IP, Location: location}
+	if err := s.mailer.Send(ctx, mail.Message{To: user.Email, Template: mail.TemplateStepUp, Data: data}); err != nil {
+		_ = s.codes.Delete(ctx, key)
+		return err
+	}
+	return nil
+}
+
+// Pending reports whether a code mailed to the user is still valid
+func (s *StepUp) Pending(ctx context.Context, userID uint) (bool, error) {
+	var pending pendingCode
+	ok, err := s.codes.Get(ctx, stepUpKey(ctx, userID), &pending)
+	return ok && time.Now().Before(pending.ExpiresAt), err
+}
+
+// Verify consumes user's pending code if it matches. Each wrong guess
+// counts against the code, which stops working after maxAttempts.
+func (s *StepUp) Verify(ctx context.Context, userID uint, code string) error {
+	key := stepUpKey(ctx, userID)
+	var pending pendingCode
+	ok, err := s.codes.Get(ctx, key, &pending)
+	if err != nil {
+		return err
+	}
+	if !ok || time.Now().After(pending.ExpiresAt) {
+		return ErrInvalidCode
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashCode(code)), []byte(pending.Hash)) != 1 {
+		pending.Attempts++
+		if pending.Attempts >= maxAttempts {
+			err = s.codes.Delete(ctx, key)
+		} else {
+			err = s.codes.Set(ctx, key, pending)
+		}
+		if err != nil {
+			return err
+		}
+		return ErrInvalidCode
+	}
+	return s.codes.Delete(ctx, key)
+}
+
+// Codes are keyed by tenant, so a code never crosses tenant boundaries
+func stepUpKey(ctx context.Context, userID uint) string {
+	return database.TenantFromContext(ctx) + ":security:step_up:" + strconv.FormatUint(uint64(userID), 10)
+}
+
+// generateCode returns a random codeDigits-digit code
+func generateCode() (string, error) {
+	n, err := rand.Int(rand.Reader, new(big.Int).Exp(big.NewInt(10), big.NewInt(codeDigits), nil))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", codeDigits, n.Int64()), nil
+}
+
+// hashCode hashes a code, ignoring surrounding spaces
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(code)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,195 @@
+// Package seed loads users from a fixture file into the database for local
+// development and demo environments.
+package seed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/validation"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// Fixture is the content of a seed file
+type Fixture struct {
+	Users []User `json:"users" yaml:"users"`
+}
+
+// User is a fixture user, identified by email. The password is given in
+// plain text and stored as a bcrypt hash.
+type User struct {
+	Name       string                 `json:"name" yaml:"name" binding:"required"`
+	Email      string                 `json:"email" yaml:"email" binding:"required,email"`
+	Password   string                 `json:"password" yaml:"password" binding:"required,min=6"`
+	Role       string                 `json:"role" yaml:"role" binding:"omitempty,oneof=user admin"`
+	TenantID   string                 `json:"tenant_id" yaml:"tenant_id"`
+	Bio        string                 `json:"bio" yaml:"bio"`
+	Phone      string                 `json:"phone" yaml:"phone" binding:"omitempty,e164"`
+	Attributes map[string]interface{} `json:"attributes" yaml:"attributes"`
+}
+
+// Result counts what Apply did
+type Result struct {
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+}
+
+// Load reads a fixture from a .yaml, .yml or .json file and validates it
+func Load(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fixture Fixture
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &fixture)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &fixture)
+	default:
+		return nil, fmt.Errorf("unsupported fixture format %q, expected .yaml, .yml or .json", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	seen := make(map[string]bool, len(fixture.Users))
+	for i, user := range fixture.Users {
+		if err := validation.Struct(user); err != nil {
+			return nil, fmt.Errorf("user %d (%s): %w", i+1, user.Email, err)
+		}
+		email := strings.ToLower(user.Email)
+		if seen[email] {
+			return nil, fmt.Errorf("user %d: duplicate email %s", i+1, user.Email)
+		}
+		seen[email] = true
+	}
+	return &fixture, nil
+}
+
+// Apply upserts the fixture's users by email, so it can be run repeatedly.
+// Existing users are only written when a field differs, and their password
+// is only rehashed when it no longer matches.
+func Apply(ctx context.Context, repo database.UserRepository, fixture *Fixture) (Result, error) {
+	var result Result
+	for _, user := range fixture.Users {
+		tenantID := user.TenantID
+		if tenantID == "" {
+			tenantID = models.DefaultTenant
+		}
+		tenantCtx := database.WithTenant(ctx, tenantID)
+
+		existing, err := repo.FindUserByEmail(tenantCtx, user.Email)
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			created, err := newUser(user, tenantID)
+			if err != nil {
+				return result, err
+			}
+			if err := repo.CreateUser(tenantCtx, created); err != nil {
+				return result, fmt.Errorf("create %s: %w", user.Email, err)
+			}
+			result.Created++
+		case err != nil:
+			return result, fmt.Errorf("look up %s: %w", user.Email, err)
+		default:
+			changed, err := merge(existing, user, tenantID)
+			if err != nil {
+				return result, err
+			}
+			if !changed {
+				result.Unchanged++
+				continue
+			}
+			if err := repo.UpdateUser(tenantCtx, existing); err != nil {
+				return result, fmt.Errorf("update %s: %w", user.Email, err)
+			}
+			result.Updated++
+		}
+	}
+	return result, nil
+}
+
+func newUser(user User, tenantID string) (*models.User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("hash password of %s: %w", user.Email, err)
+	}
+	return &models.User{
+		Name:       user.Name,
+		Email:      user.Email,
+		Password:   string(hash),
+		Role:       role(user),
+		TenantID:   tenantID,
+		Bio:        user.Bio,
+		Phone:      user.Phone,
+		Attributes: attributes(user),
+	}, nil
+}
+
+// merge copies the fixture's fields onto an existing user and reports
+// whether anything changed
+func merge(existing *models.User, user User, tenantID string) (bool, error) {
+	changed := false
+	set := func(field *string, value string) {
+		if *field != value {
+			*field = value
+			changed = true
+		}
+	}
+	set(&existing.Name, user.Name)
+	set(&existing.Role, role(user))
+	set(&existing.TenantID, tenantID)
+	set(&existing.Bio, user.Bio)
+	set(&existing.Phone, user.Phone)
+	if attrs := attributes(user); !reflect.DeepEqual(normalize(existing.Attributes), normalize(attrs)) {
+		existing.Attributes = attrs
+		changed = true
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(existing.Password), []byte(user.Password)) != nil {
+		hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return false, fmt.Errorf("hash password of %s: %w", user.Email, err)
+		}
+		existing.Password = string(hash)
+		changed = true
+	}
+	return changed, nil
+}
+
+func role(user User) string {
+	if user.Role == "" {
+		return models.RoleUser
+	}
+	return user.Role
+}
+
+func attributes(user User) models.Attributes {
+	if user.Attributes == nil {
+		return models.Attributes{}
+	}
+	return models.Attributes(user.Attributes)
+}
+
+// normalize round-trips attributes through JSON, so values decoded from
+// YAML compare equal to those read back from the database
+func normalize(attrs models.Attributes) map[string]interface{} {
+	data, _ := json.Marshal(attrs)
+	out := map[string]interface{}{}
+	_ = json.Unmarshal(data, &out)
+	return out
+}
@@ -0,0 +1,81 @@
+package seed
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/logger"
+)
+
+func init() {
+	logger.Init()
+}
+
+func TestApplyIsIdempotent(t *testing.T) {
+	fixture, err := Load("../../fixtures/users.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := database.NewMemoryRepository()
+	ctx := context.Background()
+
+	result, err := Apply(ctx, repo, fixture)
+	if err != nil || result.Created != len(fixture.Users) {
+		t.Fatalf("first run: %+v, %v", result, err)
+	}
+	alice, err := repo.FindUserByEmail(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(alice.Password), []byte("alice-password")) != nil || alice.Attributes["plan"] != "pro" {
+		t.Fatalf("alice was not seeded as in the fixture: %+v", alice)
+	}
+
+	result, err = Apply(ctx, repo, fixture)
+	if err != nil || result.Unchanged != len(fixture.Users) {
+		t.Fatalf("second run: expected every user unchanged, got %+v, %v", result, err)
+	}
+
+	fixture.Users[1].Name = "Alice Renamed"
+	fixture.Users[1].Password = "new-password"
+	result, err = Apply(ctx, repo, fixture)
+	if err != nil || result.Updated != 1 || result.Unchanged != len(fixture.Users)-1 {
+		t.Fatalf("third run: expected one update, got %+v, %v", result, err)
+	}
+	alice, _ = repo.FindUserByEmail(ctx, "alice@example.com")
+	if alice.Name != "Alice Renamed" || bcrypt.CompareHashAndPassword([]byte(alice.Password), []byte("new-password")) != nil {
+		t.Fatalf("alice was not updated: %+v", alice)
+	}
+}
+
+func TestLoadValidatesFixture(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"bad-email.json": `{"users": [{"name": "A", "email": "not-an-email", "password": "password"}]}`,
+		"duplicate.yaml": "users:\n  - {name: A, email: a@example.com, password: password}\n  - {name: B, email: A@example.com, password: password}\n",
+		"bad-role.yml":   "users:\n  - {name: A, email: a@example.com, password: password, role: root}\n",
+		"users.toml":     "",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	path := filepath.Join(dir, "ok.json")
+	if err := os.WriteFile(path, []byte(`{"users": [{"name": "A", "email": "a@example.com", "password": "password"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if fixture, err := Load(path); err != nil || len(fixture.Users) != 1 || !strings.EqualFold(fixture.Users[0].Email, "a@example.com") {
+		t.Fatalf("ok.json: %+v, %v", fixture, err)
+	}
+}
@@ -0,0 +1,124 @@
+// Package selfcheck runs startup diagnostics and reports every failure at
+// once, so a misconfigured server can be fixed in one pass.
+package selfcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// DefaultTimeout bounds each check
+const DefaultTimeout = 10 * time.Second
+
+// ErrSkipped is returned by a check that cannot run because one it depends on failed
+var ErrSkipped = errors.New("skipped")
+
+// Check is one diagnostic
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// warning marks a problem that is reported but doesn't fail the self-check
+type warning struct{ err error }
+
+func (w warning) Error() string { return w.err.Error() }
+func (w warning) Unwrap() error { return w.err }
+
+// Warning marks err as not fatal, e.g. pending migrations that startup applies
+func Warning(err error) error {
+	if err == nil {
+		return nil
+	}
+	return warning{err}
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Name     string
+	Err      error
+	Duration time.Duration
+}
+
+// Status is "ok", "warn", "skip" or "fail"
+func (r Result) Status() string {
+	var w warning
+	switch {
+	case r.Err == nil:
+		return "ok"
+	case errors.Is(r.Err, ErrSkipped):
+		return "skip"
+	case errors.As(r.Err, &w):
+		return "warn"
+	}
+	return "fail"
+}
+
+// Report lists the results of a self-check in the order the checks ran
+type Report []Result
+
+// Run runs every check, in order, each bounded by timeout
+func Run(ctx context.Context, timeout time.Duration, checks []Check) Report {
+	report := make(Report, 0, len(checks))
+	for _, check := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		err := check.Run(checkCtx)
+		cancel()
+		report = append(report, Result{Name: check.Name, Err: err, Duration: time.Since(start)})
+	}
+	return report
+}
+
+// Failed reports whether any check failed or was skipped because of a failure
+func (r Report) Failed() bool {
+	for _, result := range r {
+		if status := result.Status(); status == "fail" || status == "skip" {
+			return true
+		}
+	}
+	return false
+}
+
+// Write prints the report, one line per check followed by its problems
+func (r Report) Write(w io.Writer) {
+	failed := 0
+	for _, result := range r {
+		if status := result.Status(); status == "fail" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(w, "Self-check failed: %d of %d checks failed\n", failed, len(r))
+	} else {
+		fmt.Fprintf(w, "Self-check passed: %d checks\n", len(r))
+	}
+	for _, result := range r {
+		fmt.Fprintf(w, "  %-4s  %-12s %s\n", result.Status(), result.Name, result.Duration.Round(time.Millisecond))
+		if result.Err == nil {
+			continue
+		}
+		for _, problem := range problems(result.Err) {
+			fmt.Fprintf(w, "        - %s\n", problem)
+		}
+	}
+}
+
+// problems splits an error joined with errors.Join into its parts
+func problems(err error) []string {
+	var w warning
+	if errors.As(err, &w) {
+		err = w.err
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var lines []string
+		for _, e := range joined.Unwrap() {
+			lines = append(lines, problems(e)...)
+		}
+		return lines
+	}
+	return []string{err.Error()}
+}
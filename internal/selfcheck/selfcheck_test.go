@@ -0,0 +1,53 @@
+package selfcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunReportsEveryProblem(t *testing.T) {
+	report := Run(context.Background(), 50*time.Millisecond, []Check{
+		{Name: "config", Run: func(ctx context.Context) error {
+			return errors.Join(errors.New("DATABASE_URL is empty"), errors.New("JWT_SECRET is empty"))
+		}},
+		{Name: "jwt", Run: func(ctx context.Context) error { return nil }},
+		{Name: "migrations", Run: func(ctx context.Context) error { return Warning(errors.New("2 migrations pending")) }},
+		{Name: "database", Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+		{Name: "cache", Run: func(ctx context.Context) error { return fmt.Errorf("%w: database unavailable", ErrSkipped) }},
+	})
+
+	want := []string{"fail", "ok", "warn", "fail", "skip"}
+	for i, result := range report {
+		if result.Status() != want[i] {
+			t.Errorf("%s: expected %s, got %s (%v)", result.Name, want[i], result.Status(), result.Err)
+		}
+	}
+	if !report.Failed() {
+		t.Fatal("expected the report to fail")
+	}
+
+	var out strings.Builder
+	report.Write(&out)
+	for _, line := range []string{"2 of 5 checks failed", "- DATABASE_URL is empty", "- JWT_SECRET is empty", "- 2 migrations pending", "context deadline exceeded"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("expected the report to contain %q:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestWarningsDoNotFail(t *testing.T) {
+	report := Run(context.Background(), time.Second, []Check{
+		{Name: "jwt", Run: func(ctx context.Context) error { return nil }},
+		{Name: "migrations", Run: func(ctx context.Context) error { return Warning(errors.New("1 migrations pending")) }},
+	})
+	if report.Failed() {
+		t.Fatal("expected warnings not to fail the self-check")
+	}
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// ErrInvalidAttributes is returned when custom attribute values fail validation
+var ErrInvalidAttributes = errors.New("invalid attributes")
+
+// CreateAttributeDefinition registers a new custom attribute definition
+func (s *UserService) CreateAttributeDefinition(ctx context.Context, req models.CreateAttributeDefinitionRequest) (*models.AttributeDefinition, error) {
+	if req.Validation != "" {
+		if req.Type != models.AttributeTypeString {
+			return nil, fmt.Errorf("%w: validation is only supported for string attributes", ErrInvalidAttributes)
+		}
+		if _, err := regexp.Compile(req.Validation); err != nil {
+			return nil, fmt.Errorf("%w: invalid validation pattern: %v", ErrInvalidAttributes, err)
+		}
+	}
+
+	def := models.AttributeDefinition{
+		Name:       req.Name,
+		Type:       req.Type,
+		Required:   req.Required,
+		Validation: req.Validation,
+	}
+	if err := s.repo.CreateAttributeDefinition(ctx, &def); err != nil {
+		return nil, err
+	}
+	return &def, nil
+}
+
+// ListAttributeDefinitions returns all custom attribute definitions
+func (s *UserService) ListAttributeDefinitions(ctx context.Context) ([]models.AttributeDefinition, error) {
+	return s.repo.GetAttributeDefinitions(ctx)
+}
+
+// DeleteAttributeDefinition removes a custom attribute definition
+func (s *UserService) DeleteAttributeDefinition(ctx context.Context, id uint) error {
+	return s.repo.DeleteAttributeDefinition(ctx, id)
+}
+
+// ValidateAttributes checks attribute values against the registered definitions
+func (s *UserService) ValidateAttributes(ctx context.Context, attrs models.Attributes) error {
+	defs, err := s.repo.GetAttributeDefinitions(ctx)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[string]models.AttributeDefinition, len(defs))
+	for _, def := range defs {
+		known[def.Name] = def
+	}
+
+	for name, value := range attrs {
+		def, ok := known[name]
+		if !ok {
+			return fmt.Errorf("%w: unknown attribute %q", ErrInvalidAttributes, name)
+		}
+		if err := validateAttributeValue(def, value); err != nil {
+			return err
+		}
+	}
+
+	for _, def := range defs {
+		if _, ok := attrs[def.Name]; def.Required && !ok {
+			return fmt.Errorf("%w: attribute %q is required", ErrInvalidAttributes, def.Name)
+		}
+	}
+
+	return nil
+}
+
+// validateAttributeValue checks a single value against its definition
+func validateAttributeValue(def models.AttributeDefinition, value interface{}) error {
+	switch def.Type {
+	case models.AttributeTypeString:
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%w: attribute %q must be a string", ErrInvalidAttributes, def.Name)
+		}
+		if def.Validation != "" {
+			re, err := regexp.Compile(def.Validation)
+			if err != nil {
+				return err
+			}
+			if !re.MatchString(str) {
+				return fmt.Errorf("%w: attribute %q does not match %s", ErrInvalidAttributes, def.Name, def.Validation)
+			}
+		}
+	case models.AttributeTypeNumber:
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%w: attribute %q must be a number", ErrInvalidAttributes, def.Name)
+		}
+	case models.AttributeTypeBoolean:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%w: attribute %q must be a boolean", ErrInvalidAttributes, def.Name)
+		}
+	default:
+		return fmt.Errorf("%w: attribute %q has unsupported type %q", ErrInvalidAttributes, def.Name, def.Type)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/114windd/restapi/internal/cache"
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+func init() {
+	if logger.Log == nil {
+		logger.Init()
+		logger.Log.SetOutput(io.Discard)
+	}
+}
+
+// newTestService returns a service on an empty memory repository, with its cache
+func newTestService(t *testing.T) (*UserService, *database.MemoryRepository) {
+	t.Helper()
+	repo := database.NewMemoryRepository()
+	return NewUserService(repo, cache.New(cache.NewMemoryStore(time.Minute))), repo
+}
+
+func TestValidateAttributes(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+	for _, def := range []models.CreateAttributeDefinitionRequest{
+		{Name: "tier", Type: models.AttributeTypeString, Required: true, Validation: "^(gold|silver)$"},
+		{Name: "seats", Type: models.AttributeTypeNumber},
+		{Name: "beta", Type: models.AttributeTypeBoolean},
+	} {
+		if _, err := s.CreateAttributeDefinition(ctx, def); err != nil {
+			t.Fatalf("CreateAttributeDefinition(%s): %v", def.Name, err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		attrs models.Attributes
+		valid bool
+	}{
+		{"all valid", models.Attributes{"tier": "gold", "seats": 3.0, "beta": true}, true},
+		{"optional omitted", models.Attributes{"tier": "silver"}, true},
+		{"required missing", models.Attributes{"seats": 3.0}, false},
+		{"pattern mismatch", models.Attributes{"tier": "bronze"}, false},
+		{"string for a number", models.Attributes{"tier": "gold", "seats": "3"}, false},
+		{"number for a boolean", models.Attributes{"tier": "gold", "beta": 1.0}, false},
+		{"number for a string", models.Attributes{"tier": 1.0}, false},
+		{"unknown attribute", models.Attributes{"tier": "gold", "plan": "pro"}, false},
+	}
+	for _, tt := range tests {
+		err := s.ValidateAttributes(ctx, tt.attrs)
+		if tt.valid && err != nil || !tt.valid && !errors.Is(err, ErrInvalidAttributes) {
+			t.Errorf("%s: ValidateAttributes(%v) = %v", tt.name, tt.attrs, err)
+		}
+	}
+}
+
+func TestCreateAttributeDefinitionValidation(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+	for _, req := range []models.CreateAttributeDefinitionRequest{
+		{Name: "age", Type: models.AttributeTypeNumber, Validation: "^[0-9]+$"},
+		{Name: "code", Type: models.AttributeTypeString, Validation: "(unclosed"},
+	} {
+		if _, err := s.CreateAttributeDefinition(ctx, req); !errors.Is(err, ErrInvalidAttributes) {
+			t.Errorf("CreateAttributeDefinition(%+v): expected ErrInvalidAttributes, got %v", req, err)
+		}
+	}
+}
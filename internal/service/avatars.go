@@ -0,0 +1,142 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // Register decoders for image.DecodeConfig
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"regexp"
+
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/events"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/storage"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// avatarPrefix is the object key prefix avatars are stored under
+const avatarPrefix = "avatars/"
+
+var (
+	ErrInvalidAvatar     = errors.New("avatar must be a PNG, JPEG or GIF image")
+	ErrAvatarsDisabled   = errors.New("avatar storage is not configured")
+	errInvalidAvatarName = errors.New("invalid avatar name")
+)
+
+// avatarTypes maps accepted image types to the extension avatars are stored with
+var avatarTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+}
+
+// avatarName matches the names generated by SetAvatar
+var avatarName = regexp.MustCompile(`^[0-9a-f]{32}\.(png|jpg|gif)$`)
+
+// SetAvatarStore enables avatar uploads, kept in store. Images wider or
+// taller than maxDimension pixels are rejected.
+func (s *UserService) SetAvatarStore(store storage.ObjectStore, maxDimension int) {
+	s.avatars = store
+	s.maxAvatarDimension = maxDimension
+}
+
+// SetAvatar validates an uploaded image and makes it the user's avatar. The
+// image type is detected from its content, not the name or header the
+// client sent, and the previous avatar is removed.
+func (s *UserService) SetAvatar(ctx context.Context, id uint, data []byte) (*models.User, error) {
+	if s.avatars == nil {
+		return nil, ErrAvatarsDisabled
+	}
+
+	contentType := http.DetectContentType(data)
+	ext, ok := avatarTypes[contentType]
+	if !ok {
+		return nil, ErrInvalidAvatar
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidAvatar
+	}
+	if max := s.maxAvatarDimension; max > 0 && (cfg.Width > max || cfg.Height > max) {
+		return nil, fmt.Errorf("%w no larger than %dx%d pixels", ErrInvalidAvatar, max, max)
+	}
+
+	user, err := s.findForUpdate(ctx, id, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// A fresh name per upload lets clients and proxies cache avatars forever
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	name := hex.EncodeToString(random) + ext
+	if err := s.avatars.Put(ctx, avatarPrefix+name, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+		return nil, err
+	}
+
+	previous := user.Avatar
+	user.Avatar = name
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		s.removeAvatar(ctx, name)
+		return nil, err
+	}
+	s.invalidateUser(ctx, user.TenantID, user.ID)
+	s.publish(ctx, events.UserUpdated, user)
+	s.removeAvatar(ctx, previous)
+
+	return user, nil
+}
+
+// DeleteAvatar removes the user's avatar
+func (s *UserService) DeleteAvatar(ctx context.Context, id uint) (*models.User, error) {
+	user, err := s.findForUpdate(ctx, id, 0)
+	if err != nil {
+		return nil, err
+	}
+	if user.Avatar == "" {
+		return user, nil
+	}
+
+	previous := user.Avatar
+	user.Avatar = ""
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	s.invalidateUser(ctx, user.TenantID, user.ID)
+	s.publish(ctx, events.UserUpdated, user)
+	s.removeAvatar(ctx, previous)
+
+	return user, nil
+}
+
+// GetAvatar returns an avatar image by name. The caller must close it.
+func (s *UserService) GetAvatar(ctx context.Context, name string) (io.ReadCloser, *storage.ObjectInfo, error) {
+	if s.avatars == nil {
+		return nil, nil, ErrAvatarsDisabled
+	}
+	if !avatarName.MatchString(name) {
+		return nil, nil, storage.ErrObjectNotFound
+	}
+	return s.avatars.Get(ctx, avatarPrefix+name)
+}
+
+// removeAvatar deletes an avatar image that is no longer referenced. Failures
+// only leave an orphaned object behind, so they are logged, not returned.
+func (s *UserService) removeAvatar(ctx context.Context, name string) {
+	if name == "" || s.avatars == nil || database.IsDryRun(ctx) {
+		return
+	}
+	if err := s.avatars.Delete(ctx, avatarPrefix+name); err != nil {
+		logger.Log.WithError(err).WithField("avatar", name).Warn("Failed to delete avatar image")
+	}
+}
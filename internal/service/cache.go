@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// Cache keys are scoped by tenant so cached rows never cross tenant boundaries
+
+func userCacheKey(tenantID string, id uint) string {
+	return fmt.Sprintf("%s:user:%d", tenantID, id)
+}
+
+// writtenCacheKey marks a user written within the cache TTL, see SetReplicaReads
+func writtenCacheKey(tenantID string, id uint) string {
+	return fmt.Sprintf("%s:user-written:%d", tenantID, id)
+}
+
+func statsCacheKey(tenantID string) string {
+	return tenantID + ":stats:users"
+}
+
+// cacheUser stores a copy of user in the cache
+func (s *UserService) cacheUser(ctx context.Context, user *models.User) {
+	s.cache.Set(ctx, userCacheKey(user.TenantID, user.ID), *user)
+}
+
+// cachedUser returns a copy of the cached user, if present
+func (s *UserService) cachedUser(ctx context.Context, id uint) (*models.User, bool) {
+	var user models.User
+	if !s.cache.Get(ctx, userCacheKey(database.TenantFromContext(ctx), id), &user) {
+		return nil, false
+	}
+	return &user, true
+}
+
+// invalidateUser drops a user and derived stats from the cache
+func (s *UserService) invalidateUser(ctx context.Context, tenantID string, id uint) {
+	s.cache.Delete(ctx, userCacheKey(tenantID, id))
+	s.cache.Delete(ctx, statsCacheKey(tenantID))
+	if s.replicaReads {
+		s.cache.Set(ctx, writtenCacheKey(tenantID, id), true)
+	}
+}
+
+// SetReplicaReads serves user lookups and listings from read replicas when
+// the repository has them. A replica may not have caught up with a recent
+// write, so users written within the cache TTL are still looked up on the
+// primary and an outdated copy never lands in the cache.
+func (s *UserService) SetReplicaReads(enabled bool) {
+	s.replicaReads = enabled
+}
+
+// readContext marks ctx for a read replica when replica reads are enabled
+func (s *UserService) readContext(ctx context.Context) context.Context {
+	if !s.replicaReads {
+		return ctx
+	}
+	return database.PreferReplica(ctx)
+}
+
+// lookupContext is readContext for looking up users by ID, which stay on
+// the primary when any of them was written recently
+func (s *UserService) lookupContext(ctx context.Context, ids ...uint) context.Context {
+	if !s.replicaReads {
+		return ctx
+	}
+	tenantID := database.TenantFromContext(ctx)
+	for _, id := range ids {
+		var written bool
+		if s.cache.Get(ctx, writtenCacheKey(tenantID, id), &written) {
+			return ctx
+		}
+	}
+	return database.PreferReplica(ctx)
+}
+
+// GetUserStats returns aggregate user statistics, served from cache when warm
+func (s *UserService) GetUserStats(ctx context.Context) (*models.UserStats, error) {
+	key := statsCacheKey(database.TenantFromContext(ctx))
+	var stats models.UserStats
+	if s.cache.Get(ctx, key, &stats) {
+		return &stats, nil
+	}
+
+	fresh, err := s.countUserStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.Set(ctx, key, *fresh)
+	return fresh, nil
+}
+
+// countUserStats computes the aggregate statistics with one count per figure
+func (s *UserService) countUserStats(ctx context.Context) (*models.UserStats, error) {
+	stats := models.UserStats{GeneratedAt: time.Now()}
+	since := stats.GeneratedAt.Add(-24 * time.Hour)
+
+	var err error
+	if stats.TotalUsers, err = s.repo.CountUsers(ctx, nil); err != nil {
+		return nil, err
+	}
+	if stats.NewUsersLast24h, err = s.repo.CountUsers(ctx, []models.UserFilterTerm{
+		{Field: "created_at", Operator: ">=", Value: since},
+	}); err != nil {
+		return nil, err
+	}
+	if stats.ActiveUsersLast24h, err = s.repo.CountUsers(ctx, []models.UserFilterTerm{
+		{Field: "last_login_at", Operator: ">=", Value: since},
+	}); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// WarmCache preloads the n most recently active users and aggregate stats,
+// so an instance joining the pool doesn't serve its first requests cold
+func (s *UserService) WarmCache(ctx context.Context, n int) error {
+	start := time.Now()
+
+	users, err := s.repo.GetRecentlyActiveUsers(ctx, n)
+	if err != nil {
+		return err
+	}
+	for i := range users {
+		s.cacheUser(ctx, &users[i])
+	}
+
+	s.cache.Delete(ctx, statsCacheKey(database.TenantFromContext(ctx)))
+	if _, err := s.GetUserStats(ctx); err != nil {
+		return err
+	}
+
+	logger.Log.WithField("users", len(users)).
+		WithField("duration_ms", time.Since(start).Milliseconds()).
+		Info("Cache warmed")
+	return nil
+}
+
+// PingCache checks that the cache accepts writes and serves reads
+func (s *UserService) PingCache(ctx context.Context) error {
+	return s.cache.Ping(ctx)
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+func TestUserCache(t *testing.T) {
+	s, repo := newTestService(t)
+	ctx := context.Background()
+	user := models.User{Name: "Ada", Email: "ada@example.com"}
+	if err := repo.CreateUser(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// A write behind the service's back isn't seen until the entry goes...
+	changed := user
+	changed.Name = "Ada Lovelace"
+	if err := repo.UpdateUser(ctx, &changed); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.GetUser(ctx, user.ID); got.Name != "Ada" {
+		t.Fatalf("GetUser served %q, want the cached copy", got.Name)
+	}
+	// ...and it isn't served to another tenant
+	if got, err := s.GetUser(database.WithTenant(ctx, "other"), user.ID); err == nil && got.Name == "Ada" {
+		t.Fatal("GetUser in another tenant: the cached copy crossed tenants")
+	}
+
+	// Writes through the service drop the entry
+	updated, err := s.UpdateUser(ctx, user.ID, 0, models.RestUpdateUserRequest{Bio: "Analyst"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.GetUser(ctx, user.ID); got.Name != "Ada Lovelace" || got.Bio != "Analyst" || got.Version != updated.Version {
+		t.Fatalf("GetUser after UpdateUser: %+v", got)
+	}
+}
+
+func TestUserStatsCache(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+	if _, err := s.CreateUser(ctx, "Ada", "ada@example.com", "password123", nil); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := s.GetUserStats(ctx)
+	if err != nil || stats.TotalUsers != 1 {
+		t.Fatalf("GetUserStats: %v, %+v", err, stats)
+	}
+	if again, _ := s.GetUserStats(ctx); !again.GeneratedAt.Equal(stats.GeneratedAt) {
+		t.Fatal("GetUserStats recomputed warm stats")
+	}
+
+	if _, err := s.CreateUser(ctx, "Bo", "bo@example.com", "password123", nil); err != nil {
+		t.Fatal(err)
+	}
+	if stats, _ := s.GetUserStats(ctx); stats.TotalUsers != 2 {
+		t.Fatalf("GetUserStats after a signup: %+v", stats)
+	}
+}
+
+func TestWarmCache(t *testing.T) {
+	s, repo := newTestService(t)
+	ctx := context.Background()
+	users := make([]models.User, 3)
+	for i, name := range []string{"Ada", "Bo", "Cy"} {
+		users[i] = models.User{Name: name, Email: name + "@example.com"}
+		if err := repo.CreateUser(ctx, &users[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = repo.TouchLastLogin(ctx, users[0].ID, time.Now().Add(-time.Hour))
+	_ = repo.TouchLastLogin(ctx, users[2].ID, time.Now())
+
+	if err := s.WarmCache(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	// The two most recent logins are cached; rename everyone underneath
+	for _, user := range users {
+		renamed, _ := repo.FindUserByID(ctx, user.ID)
+		renamed.Name += " (renamed)"
+		if err := repo.UpdateUser(ctx, renamed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, cached := range []bool{true, false, true} {
+		got, _ := s.GetUser(ctx, users[i].ID)
+		if (got.Name == users[i].Name) != cached {
+			t.Errorf("%s: served %q, cached %v", users[i].Name, got.Name, cached)
+		}
+	}
+}
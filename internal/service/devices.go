@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/events"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/mail"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// RecordDevice remembers the device a user logged in from, identified by
+// device.Key, and reports whether it was new to them. A new device
+// publishes user.new_device and mails the user an alert; their first
+// device doesn't, as every account has one.
+func (s *UserService) RecordDevice(ctx context.Context, user *models.User, device models.KnownDevice) (bool, error) {
+	known, err := s.repo.ListDevicesByUser(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	for _, d := range known {
+		if d.Key == device.Key {
+			return false, s.repo.TouchDevice(ctx, d.ID, device.LastIP, now)
+		}
+	}
+
+	device.UserID = user.ID
+	device.LastSeenAt = now
+	if err := s.repo.CreateDevice(ctx, &device); err != nil {
+		if errors.Is(err, database.ErrDuplicateKey) {
+			// A concurrent login from the same device recorded it first
+			return false, nil
+		}
+		return false, err
+	}
+	if len(known) == 0 {
+		return false, nil
+	}
+
+	s.publishEvent(events.NewDeviceEvent(user, &device))
+	if s.mailer != nil {
+		data := mail.NewDeviceData{Name: user.Name, Device: device.Name, IP: device.LastIP, At: now}
+		if err := s.mailer.Send(ctx, mail.Message{To: user.Email, Template: mail.TemplateNewDevice, Data: data}); err != nil {
+			logger.Log.WithError(err).WithField("user_id", user.ID).Warn("Failed to mail new device alert")
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// ErrEmailDomainNotAllowed is returned when signups from an email's domain are not permitted
+var ErrEmailDomainNotAllowed = errors.New("signups from this email domain are not allowed")
+
+// EmailDomainPolicy restricts which email domains may sign up. An empty
+// Allow list permits every domain not in Deny. Subdomains match their parent,
+// so "example.com" also covers "eu.example.com".
+type EmailDomainPolicy struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// domainPolicyCacheKey caches the stored policy, which applies to every tenant
+const domainPolicyCacheKey = "signup:domain-policy"
+
+// SetEmailDomainPolicy sets the configured signup domain policy, which
+// applies until an admin stores one with UpdateEmailDomainPolicy
+func (s *UserService) SetEmailDomainPolicy(policy EmailDomainPolicy) {
+	policy.Allow = normalizeDomains(policy.Allow)
+	policy.Deny = normalizeDomains(policy.Deny)
+
+	s.domainPolicyMu.Lock()
+	s.domainPolicy = policy
+	s.domainPolicyMu.Unlock()
+}
+
+// UpdateEmailDomainPolicy stores the signup domain policy, so that it
+// applies on every replica and survives restarts, and returns it normalized
+func (s *UserService) UpdateEmailDomainPolicy(ctx context.Context, policy EmailDomainPolicy) (EmailDomainPolicy, error) {
+	policy = EmailDomainPolicy{Allow: normalizeDomains(policy.Allow), Deny: normalizeDomains(policy.Deny)}
+	if err := s.repo.SaveSignupDomainPolicy(ctx, &models.SignupDomainPolicy{Allow: policy.Allow, Deny: policy.Deny}); err != nil {
+		return EmailDomainPolicy{}, err
+	}
+	s.cache.Set(ctx, domainPolicyCacheKey, policy)
+	return policy, nil
+}
+
+// GetEmailDomainPolicy returns the stored signup domain policy, or the
+// configured one when admins never stored one
+func (s *UserService) GetEmailDomainPolicy(ctx context.Context) (EmailDomainPolicy, error) {
+	var policy EmailDomainPolicy
+	if s.cache.Get(ctx, domainPolicyCacheKey, &policy) {
+		return policy, nil
+	}
+
+	stored, err := s.repo.GetSignupDomainPolicy(ctx)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		s.domainPolicyMu.RLock()
+		policy = EmailDomainPolicy{
+			Allow: append([]string{}, s.domainPolicy.Allow...),
+			Deny:  append([]string{}, s.domainPolicy.Deny...),
+		}
+		s.domainPolicyMu.RUnlock()
+	case err != nil:
+		return EmailDomainPolicy{}, err
+	default:
+		policy = EmailDomainPolicy{Allow: append([]string{}, stored.Allow...), Deny: append([]string{}, stored.Deny...)}
+	}
+	s.cache.Set(ctx, domainPolicyCacheKey, policy)
+	return policy, nil
+}
+
+// CheckEmailDomain returns ErrEmailDomainNotAllowed if email's domain may not sign up
+func (s *UserService) CheckEmailDomain(ctx context.Context, email string) error {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ErrEmailDomainNotAllowed
+	}
+	domain := strings.ToLower(email[at+1:])
+
+	policy, err := s.GetEmailDomainPolicy(ctx)
+	if err != nil {
+		return err
+	}
+	if matchesDomain(domain, policy.Deny) {
+		return ErrEmailDomainNotAllowed
+	}
+	if len(policy.Allow) > 0 && !matchesDomain(domain, policy.Allow) {
+		return ErrEmailDomainNotAllowed
+	}
+	return nil
+}
+
+func matchesDomain(domain string, domains []string) bool {
+	for _, d := range domains {
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeDomains(domains []string) []string {
+	normalized := make([]string, 0, len(domains))
+	for _, d := range domains {
+		if d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "@")); d != "" {
+			normalized = append(normalized, d)
+		}
+	}
+	return normalized
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/114windd/restapi/internal/cache"
+	"github.com/114windd/restapi/internal/validation"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+func TestCheckEmailDomain(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  EmailDomainPolicy
+		email   string
+		allowed bool
+	}{
+		{name: "no policy", email: "alice@example.com", allowed: true},
+		{name: "denied", policy: EmailDomainPolicy{Deny: []string{"spam.test"}}, email: "bob@spam.test"},
+		{name: "denied subdomain", policy: EmailDomainPolicy{Deny: []string{"spam.test"}}, email: "bob@mail.spam.test"},
+		{name: "suffix is not a subdomain", policy: EmailDomainPolicy{Deny: []string{"spam.test"}}, email: "bob@notspam.test", allowed: true},
+		{name: "allowed", policy: EmailDomainPolicy{Allow: []string{"example.com"}}, email: "alice@eu.example.com", allowed: true},
+		{name: "not in allow list", policy: EmailDomainPolicy{Allow: []string{"example.com"}}, email: "alice@other.com"},
+		{name: "deny beats allow", policy: EmailDomainPolicy{Allow: []string{"example.com"}, Deny: []string{"eu.example.com"}}, email: "alice@eu.example.com"},
+		{name: "normalized", policy: EmailDomainPolicy{Deny: []string{" @Spam.TEST "}}, email: "bob@SPAM.test"},
+		{name: "no domain", email: "bob"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestService(t)
+			s.SetEmailDomainPolicy(tt.policy)
+
+			err := s.CheckEmailDomain(context.Background(), tt.email)
+			if tt.allowed && err != nil || !tt.allowed && !errors.Is(err, ErrEmailDomainNotAllowed) {
+				t.Fatalf("CheckEmailDomain(%q): %v", tt.email, err)
+			}
+		})
+	}
+}
+
+func TestEmailDomainPolicyIsStored(t *testing.T) {
+	ctx := context.Background()
+	s, repo := newTestService(t)
+	s.SetEmailDomainPolicy(EmailDomainPolicy{Deny: []string{"configured.test"}})
+
+	policy, err := s.UpdateEmailDomainPolicy(ctx, EmailDomainPolicy{Allow: []string{"Example.com"}, Deny: []string{"@spam.test", " "}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := EmailDomainPolicy{Allow: []string{"example.com"}, Deny: []string{"spam.test"}}
+	if !reflect.DeepEqual(policy, want) {
+		t.Fatalf("UpdateEmailDomainPolicy: got %+v, want %+v", policy, want)
+	}
+	if err := s.CheckEmailDomain(ctx, "bob@configured.test"); !errors.Is(err, ErrEmailDomainNotAllowed) {
+		t.Fatalf("domain outside the stored allow list: %v", err)
+	}
+
+	// A restarted replica, with the configured policy and an empty cache,
+	// applies the stored policy
+	restarted := NewUserService(repo, cache.New(cache.NewMemoryStore(time.Minute)))
+	restarted.SetEmailDomainPolicy(EmailDomainPolicy{Deny: []string{"configured.test"}})
+	if policy, err := restarted.GetEmailDomainPolicy(ctx); err != nil || !reflect.DeepEqual(policy, want) {
+		t.Fatalf("GetEmailDomainPolicy after restart: %+v, %v", policy, err)
+	}
+	for email, allowed := range map[string]bool{"alice@example.com": true, "bob@spam.test": false, "carol@other.com": false} {
+		if err := restarted.CheckEmailDomain(ctx, email); allowed != (err == nil) {
+			t.Errorf("CheckEmailDomain(%q) after restart: %v", email, err)
+		}
+	}
+}
+
+func TestConfiguredEmailDomainPolicy(t *testing.T) {
+	s, _ := newTestService(t)
+	s.SetEmailDomainPolicy(EmailDomainPolicy{Allow: []string{"Example.com"}})
+
+	policy, err := s.GetEmailDomainPolicy(context.Background())
+	if err != nil || !reflect.DeepEqual(policy, EmailDomainPolicy{Allow: []string{"example.com"}, Deny: []string{}}) {
+		t.Fatalf("GetEmailDomainPolicy without a stored policy: %+v, %v", policy, err)
+	}
+}
+
+func TestUpdateRejectsMalformedEmail(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t)
+	user, err := s.CreateUser(ctx, "Alice", "alice@example.com", "password123", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fields validation.Errors
+	_, err = s.UpdateUser(ctx, user.ID, 0, models.RestUpdateUserRequest{Email: "not-an-email"})
+	if !errors.Is(err, ErrInvalidUpdate) || !errors.As(err, &fields) || fields[0].Field != "email" {
+		t.Fatalf("UpdateUser with a malformed email: %v", err)
+	}
+	if _, err := s.ResetCredentials(ctx, user.ID, "alice@", "password456"); !errors.Is(err, ErrInvalidUpdate) {
+		t.Fatalf("ResetCredentials with a malformed email: %v", err)
+	}
+	if _, err := s.UpdateUser(ctx, user.ID, 0, models.RestUpdateUserRequest{Email: " Alice2@Example.com "}); err != nil {
+		t.Fatalf("UpdateUser with an untrimmed email: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/cache"
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/validation"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// ErrEmailTaken is returned when another account already uses an email address
+var ErrEmailTaken = errors.New("email already in use")
+
+// SetEmailNormalization controls whether a "+tag" in the local part of an
+// address is dropped, so that alice+news@example.com and alice@example.com
+// are the same account. Emails are always trimmed and lowercased.
+func (s *UserService) SetEmailNormalization(stripPlusTags bool) {
+	s.stripPlusTags = stripPlusTags
+}
+
+// NormalizeEmail returns the form of email that is stored and looked up
+func (s *UserService) NormalizeEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if s.stripPlusTags {
+		if local, domain, ok := strings.Cut(email, "@"); ok {
+			if tagless, _, tagged := strings.Cut(local, "+"); tagged && tagless != "" {
+				email = tagless + "@" + domain
+			}
+		}
+	}
+	return email
+}
+
+// SetEmailAvailabilityTTL caches the answers of IsEmailAvailable for ttl,
+// so a form checking as the user types, or a script probing addresses,
+// doesn't reach the database for every request. Zero disables the cache.
+func (s *UserService) SetEmailAvailabilityTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		s.emailChecks = nil
+		return
+	}
+	s.emailChecks = cache.New(cache.NewMemoryStore(ttl))
+}
+
+// emailCheckKey keys a cached availability answer. The address is hashed
+// so the cache doesn't hold a list of probed emails.
+func emailCheckKey(ctx context.Context, email string) string {
+	sum := sha256.Sum256([]byte(email))
+	return database.TenantFromContext(ctx) + ":email-available:" + hex.EncodeToString(sum[:])
+}
+
+// forgetEmailCheck drops the cached availability of an address that was
+// just taken. Other replicas keep their answer until it expires.
+func (s *UserService) forgetEmailCheck(ctx context.Context, email string) {
+	if s.emailChecks != nil {
+		s.emailChecks.Delete(ctx, emailCheckKey(ctx, email))
+	}
+}
+
+// setEmail normalizes email and assigns it to user, returning ErrEmailTaken
+// when another user already has it. A malformed address is rejected with
+// ErrInvalidUpdate here rather than by each transport's request binding.
+func (s *UserService) setEmail(ctx context.Context, user *models.User, email string) error {
+	email = s.NormalizeEmail(email)
+	if email == user.Email {
+		return nil
+	}
+	if fields := validation.Struct(emailField{Email: email}); fields != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidUpdate, fields)
+	}
+	existing, err := s.repo.FindUserByEmail(ctx, email)
+	if err == nil && existing.ID != user.ID {
+		return ErrEmailTaken
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	user.Email = email
+	return nil
+}
+
+// emailField validates an address with the same rule as the request models
+type emailField struct {
+	Email string `json:"email" binding:"email"`
+}
+
+// emailConflict maps a unique violation from the repository, i.e. a
+// concurrent signup or update that won the race for the address, to
+// ErrEmailTaken
+func emailConflict(err error) error {
+	if errors.Is(err, database.ErrDuplicateKey) {
+		return ErrEmailTaken
+	}
+	return err
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// ErrNoUserHistory is returned when no snapshot of a user exists for the
+// requested point in time
+var ErrNoUserHistory = errors.New("no history for user")
+
+// GetUserHistory returns every recorded snapshot of a user, oldest first
+func (s *UserService) GetUserHistory(ctx context.Context, id uint) ([]models.UserHistory, error) {
+	history, err := s.repo.GetUserHistory(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		return nil, ErrNoUserHistory
+	}
+	return history, nil
+}
+
+// GetUserAt returns the snapshot of a user that was valid at the given time
+func (s *UserService) GetUserAt(ctx context.Context, id uint, at time.Time) (*models.UserHistory, error) {
+	history, err := s.GetUserHistory(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	for i := range history {
+		if history[i].ValidAt(at) {
+			return &history[i], nil
+		}
+	}
+	return nil, ErrNoUserHistory
+}
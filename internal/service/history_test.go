@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/114windd/restapi/pkg/models"
+)
+
+func TestUserHistory(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	beforeSignup := time.Now()
+	user, err := s.CreateUser(ctx, "Alice", "alice@example.com", "password123", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	afterSignup := time.Now()
+
+	// Bio is not tracked, so it adds no snapshot
+	if _, err := s.UpdateUser(ctx, user.ID, 0, models.RestUpdateUserRequest{Bio: "Hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UpdateUser(ctx, user.ID, 0, models.RestUpdateUserRequest{Name: "Alice Liddell"}); err != nil {
+		t.Fatal(err)
+	}
+	afterRename := time.Now()
+	if err := s.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	afterDelete := time.Now()
+
+	history, err := s.GetUserHistory(ctx, user.ID)
+	if err != nil || len(history) != 2 {
+		t.Fatalf("GetUserHistory: %d snapshots, %v", len(history), err)
+	}
+	if history[0].Name != "Alice" || history[0].ValidTo == nil || !history[0].ValidTo.Equal(history[1].ValidFrom) {
+		t.Fatalf("first snapshot: %+v", history[0])
+	}
+	if history[1].Name != "Alice Liddell" || history[1].ValidTo == nil {
+		t.Fatalf("deleted user's last snapshot is still open: %+v", history[1])
+	}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want string // empty for no snapshot
+	}{
+		{name: "before signup", at: beforeSignup},
+		{name: "after signup", at: afterSignup, want: "Alice"},
+		{name: "after rename", at: afterRename, want: "Alice Liddell"},
+		{name: "after deletion", at: afterDelete},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot, err := s.GetUserAt(ctx, user.ID, tt.at)
+			if tt.want == "" {
+				if !errors.Is(err, ErrNoUserHistory) {
+					t.Fatalf("expected ErrNoUserHistory, got %+v, %v", snapshot, err)
+				}
+				return
+			}
+			if err != nil || snapshot.Name != tt.want {
+				t.Fatalf("expected %q, got %+v, %v", tt.want, snapshot, err)
+			}
+		})
+	}
+
+	if _, err := s.GetUserHistory(ctx, user.ID+1); !errors.Is(err, ErrNoUserHistory) {
+		t.Fatalf("GetUserHistory of an unknown user: %v", err)
+	}
+}
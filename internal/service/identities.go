@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/oauth"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// LoginWithIdentity returns the user linked to an external identity. On the
+// first login through a provider the identity is linked to the user with
+// the same email, or to a new user, but only if the provider verified the
+// email: otherwise anyone could claim an existing account.
+func (s *UserService) LoginWithIdentity(ctx context.Context, provider string, external *oauth.Identity) (*models.User, error) {
+	identity, err := s.repo.FindIdentity(ctx, provider, external.Subject)
+	if err == nil {
+		return s.GetUser(ctx, identity.UserID)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if external.Email == "" || !external.EmailVerified {
+		return nil, oauth.ErrNoVerifiedEmail
+	}
+
+	user, err := s.GetUserByEmail(ctx, external.Email)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		user, err = s.createExternalUser(ctx, external)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	link := &models.Identity{UserID: user.ID, Provider: provider, Subject: external.Subject, Email: external.Email}
+	if err := s.repo.CreateIdentity(ctx, link); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// createExternalUser signs up a user authenticated by a provider. The
+// account gets a random password, so it can only log in through the
+// provider until a password is set.
+func (s *UserService) createExternalUser(ctx context.Context, external *oauth.Identity) (*models.User, error) {
+	name := external.Name
+	if name == "" {
+		name, _, _ = strings.Cut(external.Email, "@")
+	}
+
+	password := make([]byte, 32)
+	if _, err := rand.Read(password); err != nil {
+		return nil, err
+	}
+	return s.CreateUser(ctx, name, external.Email, base64.RawURLEncoding.EncodeToString(password), nil)
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/114windd/restapi/internal/events"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// ErrNotInvited is returned when activating an account that isn't awaiting
+// its invitation
+var ErrNotInvited = errors.New("account is not awaiting an invitation")
+
+// CreateInvitedUser creates an account with status invited. It gets a random
+// password, so it can't log in until the invitee activates it.
+func (s *UserService) CreateInvitedUser(ctx context.Context, name, email, role string, attrs models.Attributes) (*models.User, error) {
+	if role == "" {
+		role = models.RoleUser
+	}
+	password := make([]byte, 32)
+	if _, err := rand.Read(password); err != nil {
+		return nil, err
+	}
+	return s.createUser(ctx, name, email, base64.RawURLEncoding.EncodeToString(password), role, models.StatusInvited, attrs)
+}
+
+// ActivateInvitedUser sets the password an invitee chose, and their name
+// when not empty, and makes the account active
+func (s *UserService) ActivateInvitedUser(ctx context.Context, id uint, name, password string) (*models.User, error) {
+	user, err := s.findForUpdate(ctx, id, 0)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != models.StatusInvited {
+		return nil, ErrNotInvited
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = string(hashedPassword)
+	user.Status = models.StatusActive
+	if name != "" {
+		user.Name = name
+	}
+
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	s.invalidateUser(ctx, user.TenantID, user.ID)
+	s.publish(ctx, events.UserUpdated, user)
+
+	return user, nil
+}
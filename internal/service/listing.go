@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// Page size limits for ListUsersPage
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 1000
+)
+
+// ErrInvalidListRequest wraps malformed page tokens, filters and orderings
+var ErrInvalidListRequest = errors.New("invalid list request")
+
+// UserPageRequest describes one page of a user listing, following Google
+// AIP-158 (pagination), AIP-132 (order_by) and a subset of AIP-160 (filter)
+type UserPageRequest struct {
+	PageSize  int
+	PageToken string
+	OrderBy   string // a field name, optionally followed by "desc"; defaults to id
+	Filter    string // comparisons joined with AND, e.g. role = "admin" AND name : "ada"
+}
+
+// pageToken is the decoded form of an opaque page token. It records the
+// ordering and filter it was issued for so it can't be replayed against a
+// different query.
+type pageToken struct {
+	OrderBy string `json:"o"`
+	Filter  string `json:"f"`
+	Value   string `json:"v,omitempty"`
+	ID      uint   `json:"i"`
+}
+
+// ListUsersPage returns one page of users and the token for the next page,
+// which is empty once the listing is exhausted
+func (s *UserService) ListUsersPage(ctx context.Context, req UserPageRequest) ([]models.User, string, error) {
+	q := models.UserListQuery{Limit: req.PageSize}
+	if q.Limit <= 0 {
+		q.Limit = DefaultPageSize
+	}
+	if q.Limit > MaxPageSize {
+		q.Limit = MaxPageSize
+	}
+
+	orderBy, err := parseOrderBy(req.OrderBy, &q)
+	if err != nil {
+		return nil, "", err
+	}
+	filter := strings.TrimSpace(req.Filter)
+	if q.Filter, err = parseUserFilter(filter); err != nil {
+		return nil, "", err
+	}
+	if req.PageToken != "" {
+		if q.After, err = decodePageToken(req.PageToken, orderBy, filter); err != nil {
+			return nil, "", err
+		}
+	}
+
+	// Fetch one extra row to learn whether another page follows
+	limit := q.Limit
+	q.Limit++
+	users, err := s.repo.ListUsersPage(s.readContext(ctx), q)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(users) <= limit {
+		return users, "", nil
+	}
+	users = users[:limit]
+	last := users[limit-1]
+	return users, encodePageToken(pageToken{
+		OrderBy: orderBy,
+		Filter:  filter,
+		Value:   formatListValue(listFieldValue(last, q.OrderBy)),
+		ID:      last.ID,
+	}), nil
+}
+
+// CountUsers returns how many users match a list filter, across all pages
+func (s *UserService) CountUsers(ctx context.Context, filter string) (int64, error) {
+	terms, err := parseUserFilter(strings.TrimSpace(filter))
+	if err != nil {
+		return 0, err
+	}
+	return s.repo.CountUsers(s.readContext(ctx), terms)
+}
+
+// parseOrderBy fills the ordering of q and returns its canonical form
+func parseOrderBy(orderBy string, q *models.UserListQuery) (string, error) {
+	parts := strings.Fields(orderBy)
+	q.OrderBy = "id"
+	switch {
+	case len(parts) == 0:
+	case len(parts) <= 2:
+		q.OrderBy = parts[0]
+		if len(parts) == 2 {
+			switch strings.ToLower(parts[1]) {
+			case "asc":
+			case "desc":
+				q.Descending = true
+			default:
+				return "", fmt.Errorf("%w: order_by direction must be asc or desc", ErrInvalidListRequest)
+			}
+		}
+	default:
+		return "", fmt.Errorf("%w: order_by accepts a single field", ErrInvalidListRequest)
+	}
+	if _, ok := models.UserListFields[q.OrderBy]; !ok {
+		return "", fmt.Errorf("%w: cannot order by %q", ErrInvalidListRequest, q.OrderBy)
+	}
+	if q.Descending {
+		return q.OrderBy + " desc", nil
+	}
+	return q.OrderBy, nil
+}
+
+var filterTermPattern = regexp.MustCompile(`^([a-z_]+(?:\.[A-Za-z0-9_-]+)?)\s*(<=|>=|!=|=|<|>|:)\s*(.+)$`)
+
+// parseUserFilter parses comparisons joined by AND. Values may be quoted;
+// time fields take RFC 3339 timestamps.
+func parseUserFilter(filter string) ([]models.UserFilterTerm, error) {
+	if filter == "" {
+		return nil, nil
+	}
+	var terms []models.UserFilterTerm
+	for _, part := range strings.Split(filter, " AND ") {
+		m := filterTermPattern.FindStringSubmatch(strings.TrimSpace(part))
+		if m == nil {
+			return nil, fmt.Errorf("%w: malformed filter term %q", ErrInvalidListRequest, strings.TrimSpace(part))
+		}
+		field, op, raw := m[1], m[2], strings.TrimSpace(m[3])
+		kind, ok := models.UserListFieldKind(field)
+		if !ok {
+			return nil, fmt.Errorf("%w: cannot filter on %q", ErrInvalidListRequest, field)
+		}
+		if op == ":" && kind != models.ListFieldString {
+			return nil, fmt.Errorf("%w: %q does not support the : operator", ErrInvalidListRequest, field)
+		}
+		if unquoted, err := strconv.Unquote(raw); err == nil {
+			raw = unquoted
+		}
+		value, err := parseListValue(kind, raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidListRequest, field, err)
+		}
+		terms = append(terms, models.UserFilterTerm{Field: field, Operator: op, Value: value})
+	}
+	return terms, nil
+}
+
+// parseListValue converts a filter or cursor value to its field's kind
+func parseListValue(kind, raw string) (interface{}, error) {
+	switch kind {
+	case models.ListFieldNumber:
+		n, err := strconv.ParseUint(raw, 10, 0)
+		return uint(n), err
+	case models.ListFieldTime:
+		return time.Parse(time.RFC3339Nano, raw)
+	}
+	return raw, nil
+}
+
+// formatListValue is the inverse of parseListValue
+func formatListValue(value interface{}) string {
+	if t, ok := value.(time.Time); ok {
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
+
+// listFieldValue returns the value of an orderable field
+func listFieldValue(user models.User, field string) interface{} {
+	switch field {
+	case "name":
+		return user.Name
+	case "email":
+		return user.Email
+	case "role":
+		return user.Role
+	case "status":
+		return user.Status
+	case "created_at":
+		return user.CreatedAt
+	case "updated_at":
+		return user.UpdatedAt
+	}
+	return user.ID
+}
+
+func encodePageToken(t pageToken) string {
+	b, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodePageToken(token, orderBy, filter string) (*models.UserCursor, error) {
+	invalid := fmt.Errorf("%w: invalid page_token", ErrInvalidListRequest)
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, invalid
+	}
+	var t pageToken
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, invalid
+	}
+	if t.OrderBy != orderBy || t.Filter != filter {
+		return nil, fmt.Errorf("%w: page_token was issued for a different order_by or filter", ErrInvalidListRequest)
+	}
+	field := strings.TrimSuffix(orderBy, " desc")
+	value, err := parseListValue(models.UserListFields[field], t.Value)
+	if err != nil {
+		return nil, invalid
+	}
+	return &models.UserCursor{Value: value, ID: t.ID}, nil
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/events"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+var (
+	// ErrPhoneTaken is returned when another account already verified a phone number
+	ErrPhoneTaken = errors.New("phone number already verified by another account")
+	// ErrPhoneChanged is returned when the phone changed while it was being verified
+	ErrPhoneChanged = errors.New("phone number changed during verification")
+)
+
+// setPhone assigns phone to user, dropping the verification of the old number
+func setPhone(user *models.User, phone string) {
+	if phone != user.Phone {
+		user.Phone = phone
+		user.PhoneVerifiedAt = nil
+	}
+}
+
+// GetUserByVerifiedPhone returns the user who verified phone, for logging
+// in with a code sent to it
+func (s *UserService) GetUserByVerifiedPhone(ctx context.Context, phone string) (*models.User, error) {
+	return s.repo.FindUserByVerifiedPhone(ctx, phone)
+}
+
+// MarkPhoneVerified records that the user proved they receive messages
+// sent to phone, which must still be their number
+func (s *UserService) MarkPhoneVerified(ctx context.Context, id uint, phone string) (*models.User, error) {
+	user, err := s.findForUpdate(ctx, id, 0)
+	if err != nil {
+		return nil, err
+	}
+	if user.Phone != phone {
+		return nil, ErrPhoneChanged
+	}
+	if user.PhoneVerifiedAt != nil {
+		return user, nil
+	}
+
+	existing, err := s.repo.FindUserByVerifiedPhone(ctx, phone)
+	if err == nil && existing.ID != user.ID {
+		return nil, ErrPhoneTaken
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	now := time.Now()
+	user.PhoneVerifiedAt = &now
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		if errors.Is(err, database.ErrDuplicateKey) {
+			return nil, ErrPhoneTaken
+		}
+		return nil, err
+	}
+	s.invalidateUser(ctx, user.TenantID, user.ID)
+	s.publish(ctx, events.UserUpdated, user)
+	return user, nil
+}
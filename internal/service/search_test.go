@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/114windd/restapi/pkg/models"
+)
+
+func TestSearchUsersLimits(t *testing.T) {
+	s, repo := newTestService(t)
+	ctx := context.Background()
+	for i := 0; i < MaxSearchLimit+10; i++ {
+		if err := repo.CreateUser(ctx, &models.User{Name: fmt.Sprintf("Searchable %d", i), Email: fmt.Sprintf("s%d@example.com", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, query := range []string{"", "   "} {
+		if _, err := s.SearchUsers(ctx, query, 10); !errors.Is(err, ErrEmptySearchQuery) {
+			t.Errorf("SearchUsers(%q): expected ErrEmptySearchQuery, got %v", query, err)
+		}
+	}
+	for limit, want := range map[int]int{0: DefaultSearchLimit, -1: DefaultSearchLimit, 5: 5, MaxSearchLimit * 10: MaxSearchLimit} {
+		users, err := s.SearchUsers(ctx, "searchable", limit)
+		if err != nil || len(users) != want {
+			t.Errorf("SearchUsers with limit %d: %d users, %v; want %d", limit, len(users), err, want)
+		}
+	}
+}
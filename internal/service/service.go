@@ -1,17 +1,138 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/114windd/restapi/internal/cache"
 	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/events"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/mail"
+	"github.com/114windd/restapi/internal/storage"
 	"github.com/114windd/restapi/pkg/models"
 )
 
+// ErrVersionConflict is returned when an update names a version other than
+// the user's current one
+var ErrVersionConflict = database.ErrVersionConflict
+
 // UserService contains shared business logic
-type UserService struct{}
+type UserService struct {
+	repo  database.UserRepository
+	cache *cache.Cache
+
+	domainPolicyMu sync.RWMutex
+	domainPolicy   EmailDomainPolicy
+
+	events *events.Publisher // nil unless a message broker is configured
+	hub    *events.Hub       // in-process subscribers such as the /events stream
+	mailer mail.Mailer       // nil sends no email
+
+	totpIssuer    string
+	stripPlusTags bool
+	emailChecks   *cache.Cache // short-lived IsEmailAvailable answers; nil disables
+	replicaReads  bool
+
+	avatars            storage.ObjectStore // nil disables avatar uploads
+	maxAvatarDimension int
+}
+
+// NewUserService creates a UserService backed by repo, caching users in c
+func NewUserService(repo database.UserRepository, c *cache.Cache) *UserService {
+	return &UserService{repo: repo, cache: c}
+}
+
+// SetEventPublisher enables publishing of user created/updated/deleted events
+func (s *UserService) SetEventPublisher(p *events.Publisher) {
+	s.events = p
+}
+
+// SetEventHub delivers user events to in-process subscribers
+func (s *UserService) SetEventHub(h *events.Hub) {
+	s.hub = h
+}
+
+// SetMailer enables the welcome email sent to users who sign up, the
+// alerts of logins from new devices and the notices of signups with taken
+// addresses
+func (s *UserService) SetMailer(m mail.Mailer) {
+	s.mailer = m
+}
+
+// publish queues a user event for the broker and the hub, where enabled.
+// Dry runs publish nothing.
+func (s *UserService) publish(ctx context.Context, eventType string, user *models.User) {
+	if database.IsDryRun(ctx) || (s.events == nil && s.hub == nil) {
+		return
+	}
+	s.publishEvent(events.NewUserEvent(eventType, user))
+}
+
+// publishEvent hands an event to the broker and the hub, where enabled
+func (s *UserService) publishEvent(event events.Event) {
+	if s.events != nil {
+		s.events.Publish(event)
+	}
+	if s.hub != nil {
+		s.hub.Publish(event)
+	}
+}
+
+// CreateUser signs up a new user and sends them the welcome email
+func (s *UserService) CreateUser(ctx context.Context, name, email, password string, attrs models.Attributes) (*models.User, error) {
+	user, err := s.createUser(ctx, name, email, password, models.RoleUser, models.StatusActive, attrs)
+	if err != nil {
+		return nil, err
+	}
+	if s.mailer != nil && !database.IsDryRun(ctx) {
+		msg := mail.Message{To: user.Email, Template: mail.TemplateWelcome, Data: mail.WelcomeData{Name: user.Name}}
+		if err := s.mailer.Send(ctx, msg); err != nil {
+			logger.Log.WithError(err).WithField("user_id", user.ID).Warn("Failed to mail welcome")
+		}
+	}
+	return user, nil
+}
+
+// NotifyExistingAccount mails the owner of email that someone tried to sign
+// up with it, for signups that don't reveal the address is taken
+func (s *UserService) NotifyExistingAccount(ctx context.Context, email string) {
+	if s.mailer == nil || database.IsDryRun(ctx) {
+		return
+	}
+	user, err := s.GetUserByEmail(ctx, email)
+	if err != nil {
+		logger.Log.WithError(err).Warn("Failed to find the account of a taken email")
+		return
+	}
+	msg := mail.Message{To: user.Email, Template: mail.TemplateAccountExists, Data: mail.AccountExistsData{Name: user.Name}}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		logger.Log.WithError(err).WithField("user_id", user.ID).Warn("Failed to mail signup attempt notice")
+	}
+}
+
+// createUser validates and stores a new user with the given role and status
+func (s *UserService) createUser(ctx context.Context, name, email, password, role, status string, attrs models.Attributes) (*models.User, error) {
+	email = s.NormalizeEmail(email)
+	if err := s.CheckEmailDomain(ctx, email); err != nil {
+		return nil, err
+	}
+	if available, err := s.emailAvailable(ctx, email); err != nil {
+		return nil, err
+	} else if !available {
+		return nil, ErrEmailTaken
+	}
+
+	// Validate custom attributes
+	if err := s.ValidateAttributes(ctx, attrs); err != nil {
+		return nil, err
+	}
 
-// CreateUser creates a new user
-func (s *UserService) CreateUser(name, email, password string) (*models.User, error) {
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -20,93 +141,396 @@ func (s *UserService) CreateUser(name, email, password string) (*models.User, er
 
 	// Create user
 	user := models.User{
-		Name:     name,
-		Email:    email,
-		Password: string(hashedPassword),
+		Name:       name,
+		Email:      email,
+		Password:   string(hashedPassword),
+		Role:       role,
+		Status:     status,
+		TenantID:   database.TenantFromContext(ctx),
+		Attributes: attrs,
+		Version:    1,
 	}
 
-	if err := database.CreateUserWithRetry(&user); err != nil {
-		return nil, err
+	if err := s.repo.CreateUser(ctx, &user); err != nil {
+		return nil, emailConflict(err)
 	}
+	s.invalidateUser(ctx, user.TenantID, user.ID)
+	s.forgetEmailCheck(ctx, email)
+	s.publish(ctx, events.UserCreated, &user)
 
 	return &user, nil
 }
 
-// GetUser retrieves a user by ID
-func (s *UserService) GetUser(id uint) (*models.User, error) {
-	return database.FindUserByIDWithRetry(id)
+// GetUser retrieves a user by ID, serving from cache when possible
+func (s *UserService) GetUser(ctx context.Context, id uint) (*models.User, error) {
+	if user, ok := s.cachedUser(ctx, id); ok {
+		return user, nil
+	}
+
+	user, err := s.repo.FindUserByID(s.lookupContext(ctx, id), id)
+	if err != nil {
+		return nil, err
+	}
+	s.cacheUser(ctx, user)
+	return user, nil
+}
+
+// MaxBatchIDs caps the IDs accepted by GetUsersByIDs
+const MaxBatchIDs = 1000
+
+// ErrTooManyIDs is returned when a batch lookup names more than MaxBatchIDs users
+var ErrTooManyIDs = errors.New("too many ids requested at once")
+
+// GetUsersByIDs retrieves many users at once, in the order requested with
+// duplicates removed. Users missing from the cache are fetched in a single
+// query; IDs without a user are returned as missing.
+func (s *UserService) GetUsersByIDs(ctx context.Context, ids []uint) ([]models.User, []uint, error) {
+	if len(ids) > MaxBatchIDs {
+		return nil, nil, ErrTooManyIDs
+	}
+
+	found := make(map[uint]models.User, len(ids))
+	var uncached []uint
+	for _, id := range ids {
+		if _, seen := found[id]; seen {
+			continue
+		}
+		if user, ok := s.cachedUser(ctx, id); ok {
+			found[id] = *user
+		} else {
+			found[id] = models.User{}
+			uncached = append(uncached, id)
+		}
+	}
+	if len(uncached) > 0 {
+		fetched, err := s.repo.FindUsersByIDs(s.lookupContext(ctx, uncached...), uncached)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i := range fetched {
+			found[fetched[i].ID] = fetched[i]
+			s.cacheUser(ctx, &fetched[i])
+		}
+	}
+
+	users := make([]models.User, 0, len(found))
+	var missing []uint
+	for _, id := range ids {
+		user, ok := found[id]
+		if !ok {
+			continue // a duplicate, already placed
+		}
+		delete(found, id)
+		if user.ID == 0 {
+			missing = append(missing, id)
+			continue
+		}
+		users = append(users, user)
+	}
+	return users, missing, nil
+}
+
+// IsEmailAvailable reports whether email can be used to sign up. It returns
+// ErrEmailDomainNotAllowed when the domain policy rejects the address.
+// Answers may be cached briefly, see SetEmailAvailabilityTTL; signup itself
+// always checks the database.
+func (s *UserService) IsEmailAvailable(ctx context.Context, email string) (bool, error) {
+	email = s.NormalizeEmail(email)
+	if err := s.CheckEmailDomain(ctx, email); err != nil {
+		return false, err
+	}
+	if s.emailChecks == nil {
+		return s.emailAvailable(ctx, email)
+	}
+
+	key := emailCheckKey(ctx, email)
+	var available bool
+	if s.emailChecks.Get(ctx, key, &available) {
+		return available, nil
+	}
+	available, err := s.emailAvailable(ctx, email)
+	if err != nil {
+		return false, err
+	}
+	s.emailChecks.Set(ctx, key, available)
+	return available, nil
+}
+
+// emailAvailable reports whether no user has the normalized email
+func (s *UserService) emailAvailable(ctx context.Context, email string) (bool, error) {
+	exists, err := s.repo.UserExistsByEmail(ctx, email)
+	if err != nil {
+		return false, err
+	}
+	return !exists, nil
 }
 
 // GetUserByEmail retrieves a user by email
-func (s *UserService) GetUserByEmail(email string) (*models.User, error) {
-	return database.FindUserByEmailWithRetry(email)
+func (s *UserService) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	return s.repo.FindUserByEmail(ctx, s.NormalizeEmail(email))
 }
 
-// UpdateUser updates a user
-func (s *UserService) UpdateUser(id uint, name, email string) (*models.User, error) {
-	user, err := database.FindUserByIDWithRetry(id)
+// UpdateUser updates a user. Attributes are merged into the existing set;
+// a null value removes the attribute. A non-zero version must match the
+// user's current version.
+func (s *UserService) UpdateUser(ctx context.Context, id, version uint, req models.RestUpdateUserRequest) (*models.User, error) {
+	user, err := s.findForUpdate(ctx, id, version)
 	if err != nil {
 		return nil, err
 	}
 
 	// Update fields if provided
-	if name != "" {
-		user.Name = name
+	if req.Name != "" {
+		user.Name = req.Name
 	}
-	if email != "" {
-		user.Email = email
+	if req.Email != "" {
+		if err := s.setEmail(ctx, user, req.Email); err != nil {
+			return nil, err
+		}
+	}
+	if req.Bio != "" {
+		user.Bio = req.Bio
+	}
+	if req.Phone != "" {
+		setPhone(user, req.Phone)
+	}
+	if req.Attributes != nil {
+		merged, err := s.mergeAttributes(ctx, user.Attributes, req.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		user.Attributes = merged
 	}
 
-	if err := database.UpdateUserWithRetry(user); err != nil {
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		return nil, emailConflict(err)
+	}
+	s.invalidateUser(ctx, user.TenantID, user.ID)
+	s.publish(ctx, events.UserUpdated, user)
+
+	return user, nil
+}
+
+// PatchUser applies a partial update. Unlike UpdateUser, a field that is
+// present in the request is applied as-is, so it can be set to an empty value.
+func (s *UserService) PatchUser(ctx context.Context, id, version uint, req models.PatchUserRequest) (*models.User, error) {
+	user, err := s.findForUpdate(ctx, id, version)
+	if err != nil {
 		return nil, err
 	}
 
+	if req.Name != nil {
+		user.Name = *req.Name
+	}
+	if req.Email != nil {
+		if err := s.setEmail(ctx, user, *req.Email); err != nil {
+			return nil, err
+		}
+	}
+	if req.Bio != nil {
+		user.Bio = *req.Bio
+	}
+	if req.Phone != nil {
+		setPhone(user, *req.Phone)
+	}
+	if req.Attributes != nil {
+		merged, err := s.mergeAttributes(ctx, user.Attributes, req.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		user.Attributes = merged
+	}
+
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		return nil, emailConflict(err)
+	}
+	s.invalidateUser(ctx, user.TenantID, user.ID)
+	s.publish(ctx, events.UserUpdated, user)
+
 	return user, nil
 }
 
-// DeleteUser deletes a user
-func (s *UserService) DeleteUser(id uint) error {
-	return database.DeleteUserWithRetry(id)
+// ResetCredentials replaces a user's password and, when email is not empty,
+// their email address. It is used by account recovery, not self-service.
+func (s *UserService) ResetCredentials(ctx context.Context, id uint, email, password string) (*models.User, error) {
+	user, err := s.findForUpdate(ctx, id, 0)
+	if err != nil {
+		return nil, err
+	}
+	if email != "" {
+		if err := s.CheckEmailDomain(ctx, s.NormalizeEmail(email)); err != nil {
+			return nil, err
+		}
+		if err := s.setEmail(ctx, user, email); err != nil {
+			return nil, err
+		}
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = string(hashedPassword)
+	// The user may have lost their authenticator along with their password
+	clearTwoFactor(user)
+
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		return nil, emailConflict(err)
+	}
+	s.invalidateUser(ctx, user.TenantID, user.ID)
+	s.publish(ctx, events.UserUpdated, user)
+
+	return user, nil
 }
 
-// ListUsers returns all users
-func (s *UserService) ListUsers() ([]models.User, error) {
-	return database.GetAllUsersWithRetry()
+// findForUpdate loads a user about to be modified, checking the expected
+// version when one is given
+func (s *UserService) findForUpdate(ctx context.Context, id, version uint) (*models.User, error) {
+	user, err := s.repo.FindUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 && user.Version != version {
+		return nil, ErrVersionConflict
+	}
+	return user, nil
 }
 
-// ValidatePassword checks if password is correct
-func (s *UserService) ValidatePassword(user *models.User, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+// mergeAttributes merges changes into current and validates the result;
+// a null value removes the attribute
+func (s *UserService) mergeAttributes(ctx context.Context, current, changes models.Attributes) (models.Attributes, error) {
+	merged := models.Attributes{}
+	for k, v := range current {
+		merged[k] = v
+	}
+	for k, v := range changes {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = v
+	}
+	if err := s.ValidateAttributes(ctx, merged); err != nil {
+		return nil, err
+	}
+	return merged, nil
 }
 
-// Global service instance
-var userService = &UserService{}
+// DeleteUser deletes a user
+func (s *UserService) DeleteUser(ctx context.Context, id uint) error {
+	var avatar string
+	if s.avatars != nil {
+		if user, err := s.repo.FindUserByID(ctx, id); err == nil {
+			avatar = user.Avatar
+		}
+	}
 
-// Package-level functions for easy access
-func CreateUser(name, email, password string) (*models.User, error) {
-	return userService.CreateUser(name, email, password)
+	if err := s.repo.DeleteUser(ctx, id); err != nil {
+		return err
+	}
+	tenantID := database.TenantFromContext(ctx)
+	s.invalidateUser(ctx, tenantID, id)
+	s.publish(ctx, events.UserDeleted, &models.User{ID: id, TenantID: tenantID})
+	s.removeAvatar(ctx, avatar)
+	return nil
 }
 
-func GetUser(id uint) (*models.User, error) {
-	return userService.GetUser(id)
+// RecordLogin stores the login time used to rank recently active users
+func (s *UserService) RecordLogin(ctx context.Context, user *models.User) error {
+	now := time.Now()
+	if err := s.repo.TouchLastLogin(ctx, user.ID, now); err != nil {
+		return err
+	}
+	user.LastLoginAt = &now
+	s.invalidateUser(ctx, user.TenantID, user.ID)
+	return nil
 }
 
-func GetUserByEmail(email string) (*models.User, error) {
-	return userService.GetUserByEmail(email)
+// MaxListUsers caps the users returned by ListUsers; ListUsersPage and
+// StreamUsers go through any number of them
+const MaxListUsers = 1000
+
+// StreamBatchSize is how many users StreamUsers loads at a time
+const StreamBatchSize = 500
+
+// errListFull stops the stream behind ListUsers once it has enough users
+var errListFull = errors.New("user list full")
+
+// ListUsers returns users ordered by id, optionally filtered by account
+// status and custom attribute values, up to MaxListUsers of them.
+// truncated reports whether more users matched.
+func (s *UserService) ListUsers(ctx context.Context, status string, attributeFilters map[string]string) (users []models.User, truncated bool, err error) {
+	users = []models.User{}
+	err = s.repo.StreamUsers(s.readContext(ctx), status, attributeFilters, StreamBatchSize, func(batch []models.User) error {
+		for _, user := range batch {
+			if len(users) == MaxListUsers {
+				truncated = true
+				return errListFull
+			}
+			users = append(users, user)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errListFull) {
+		return nil, false, err
+	}
+	return users, truncated, nil
 }
 
-func UpdateUser(id uint, name, email string) (*models.User, error) {
-	return userService.UpdateUser(id, name, email)
+// StreamUsers calls fn for every user, ordered by id and filtered like
+// ListUsers, loading StreamBatchSize of them at a time. An error from fn
+// stops the stream and is returned.
+func (s *UserService) StreamUsers(ctx context.Context, status string, attributeFilters map[string]string, fn func(user *models.User) error) error {
+	return s.repo.StreamUsers(s.readContext(ctx), status, attributeFilters, StreamBatchSize, func(batch []models.User) error {
+		for i := range batch {
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func DeleteUser(id uint) error {
-	return userService.DeleteUser(id)
+// Search result limits
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// ErrEmptySearchQuery is returned when a search query is blank
+var ErrEmptySearchQuery = errors.New("search query is required")
+
+// SearchUsers returns users ranked by how closely their name or email match the query
+func (s *UserService) SearchUsers(ctx context.Context, query string, limit int) ([]models.User, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, ErrEmptySearchQuery
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+	return s.repo.SearchUsers(s.readContext(ctx), query, limit)
 }
 
-func ListUsers() ([]models.User, error) {
-	return userService.ListUsers()
+// ValidatePassword checks if password is correct
+func (s *UserService) ValidatePassword(user *models.User, password string) error {
+	return bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 }
 
-func ValidatePassword(user *models.User, password string) error {
-	return userService.ValidatePassword(user, password)
+// dummyHash stands in for the password hash of accounts that don't exist
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// SimulatePasswordCheck takes as long as ValidatePassword when there is no
+// account to check, so response times don't tell which accounts exist
+func (s *UserService) SimulatePasswordCheck(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+	})
+	_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
 }
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/114windd/restapi/internal/cache"
+	"github.com/114windd/restapi/internal/database"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// benchmarkUsers is the number of users the benchmarks read and list
+const benchmarkUsers = 1000
+
+func newBenchmarkService(b *testing.B) *UserService {
+	b.Helper()
+	if logger.Log == nil {
+		logger.Init()
+		logger.Log.SetOutput(io.Discard)
+	}
+
+	repo := database.NewMemoryRepository()
+	s := NewUserService(repo, cache.New(cache.NewMemoryStore(time.Minute)))
+	for i := 0; i < benchmarkUsers; i++ {
+		// Stored directly: bcrypt would dominate the setup
+		if err := repo.CreateUser(context.Background(), &models.User{Name: fmt.Sprintf("User %d", i), Email: fmt.Sprintf("user%d@example.com", i)}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return s
+}
+
+func BenchmarkGetUser(b *testing.B) {
+	s := newBenchmarkService(b)
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.GetUser(ctx, uint(i%benchmarkUsers)+1); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkListUsersPage(b *testing.B) {
+	s := newBenchmarkService(b)
+	ctx := context.Background()
+	req := UserPageRequest{PageSize: 50, OrderBy: "name desc", Filter: `email : "example.com"`}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := s.ListUsersPage(ctx, req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCreateUser(b *testing.B) {
+	s := newBenchmarkService(b)
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.CreateUser(ctx, "Bench", fmt.Sprintf("bench%d@example.com", i), "password123", nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+
+	"github.com/114windd/restapi/internal/events"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// SuspendUser locks an account until an admin reactivates it
+func (s *UserService) SuspendUser(ctx context.Context, id uint) (*models.User, error) {
+	return s.setStatus(ctx, id, models.StatusSuspended)
+}
+
+// DeactivateUser closes an account at its owner's request, keeping the record
+func (s *UserService) DeactivateUser(ctx context.Context, id uint) (*models.User, error) {
+	return s.setStatus(ctx, id, models.StatusDeactivated)
+}
+
+// ReactivateUser restores a suspended or deactivated account
+func (s *UserService) ReactivateUser(ctx context.Context, id uint) (*models.User, error) {
+	return s.setStatus(ctx, id, models.StatusActive)
+}
+
+// setStatus changes a user's status; setting the current status is a no-op
+func (s *UserService) setStatus(ctx context.Context, id uint, status string) (*models.User, error) {
+	user, err := s.findForUpdate(ctx, id, 0)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status == status {
+		return user, nil
+	}
+
+	user.Status = status
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	s.invalidateUser(ctx, user.TenantID, user.ID)
+	s.publish(ctx, events.UserUpdated, user)
+
+	return user, nil
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/pquerna/otp/totp"
+
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// backupCodeCount is the number of backup codes issued when 2FA is enabled
+const backupCodeCount = 10
+
+var (
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotEnrolled = errors.New("two-factor enrollment has not been started")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+)
+
+// SetTOTPIssuer sets the issuer authenticator apps show next to the account
+func (s *UserService) SetTOTPIssuer(issuer string) {
+	s.totpIssuer = issuer
+}
+
+// EnrollTwoFactor generates a new TOTP secret for the user. 2FA is not
+// enforced until the user confirms a code from their authenticator.
+func (s *UserService) EnrollTwoFactor(ctx context.Context, id uint) (*models.TwoFactorEnrollment, error) {
+	user, err := s.findForUpdate(ctx, id, 0)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	issuer := s.totpIssuer
+	if issuer == "" {
+		issuer = "restapi"
+	}
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: issuer, AccountName: user.Email})
+	if err != nil {
+		return nil, err
+	}
+
+	user.TOTPSecret = key.Secret()
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	s.invalidateUser(ctx, user.TenantID, user.ID)
+
+	return &models.TwoFactorEnrollment{Secret: key.Secret(), URL: key.URL()}, nil
+}
+
+// ConfirmTwoFactor enables 2FA once the user proves their authenticator
+// works, returning single-use backup codes. Only their hashes are kept, so
+// the codes cannot be shown again.
+func (s *UserService) ConfirmTwoFactor(ctx context.Context, id uint, code string) ([]string, error) {
+	user, err := s.findForUpdate(ctx, id, 0)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	if !totp.Validate(strings.TrimSpace(code), user.TOTPSecret) {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes := make([]string, backupCodeCount)
+	hashes := make(models.StringList, backupCodeCount)
+	for i := range codes {
+		if codes[i], err = generateBackupCode(); err != nil {
+			return nil, err
+		}
+		hashes[i] = hashBackupCode(codes[i])
+	}
+
+	user.TwoFactorEnabled = true
+	user.BackupCodes = hashes
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	s.invalidateUser(ctx, user.TenantID, user.ID)
+
+	return codes, nil
+}
+
+// DisableTwoFactor turns 2FA off after checking a current code
+func (s *UserService) DisableTwoFactor(ctx context.Context, id uint, code string) error {
+	user, err := s.findForUpdate(ctx, id, 0)
+	if err != nil {
+		return err
+	}
+	if !user.TwoFactorEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+	if err := s.VerifySecondFactor(ctx, user, code); err != nil {
+		return err
+	}
+
+	clearTwoFactor(user)
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+	s.invalidateUser(ctx, user.TenantID, user.ID)
+	return nil
+}
+
+// VerifySecondFactor checks an authenticator code or an unused backup code
+// for a user with 2FA enabled. A backup code is consumed by a successful
+// check. user must have been loaded from the repository, as cached users
+// carry no secrets.
+func (s *UserService) VerifySecondFactor(ctx context.Context, user *models.User, code string) error {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return ErrInvalidTwoFactorCode
+	}
+	if totp.Validate(code, user.TOTPSecret) {
+		return nil
+	}
+
+	hash := hashBackupCode(code)
+	for i, stored := range user.BackupCodes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) != 1 {
+			continue
+		}
+		remaining := make(models.StringList, 0, len(user.BackupCodes)-1)
+		remaining = append(remaining, user.BackupCodes[:i]...)
+		remaining = append(remaining, user.BackupCodes[i+1:]...)
+		user.BackupCodes = remaining
+		if err := s.repo.UpdateUser(ctx, user); err != nil {
+			return err
+		}
+		s.invalidateUser(ctx, user.TenantID, user.ID)
+		return nil
+	}
+	return ErrInvalidTwoFactorCode
+}
+
+// clearTwoFactor removes the user's authenticator and backup codes
+func clearTwoFactor(user *models.User) {
+	user.TwoFactorEnabled = false
+	user.TOTPSecret = ""
+	user.BackupCodes = models.StringList{}
+}
+
+// generateBackupCode returns a random code formatted as xxxxx-xxxxx
+func generateBackupCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// hashBackupCode hashes a backup code, ignoring case and separators. The
+// codes are random, so a fast hash is enough.
+func hashBackupCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/114windd/restapi/internal/validation"
+	"github.com/114windd/restapi/pkg/models"
+)
+
+// ErrInvalidUpdate is returned for unknown update mask paths and for masked
+// fields whose new value isn't allowed
+var ErrInvalidUpdate = errors.New("invalid update")
+
+// UpdateUserMasked applies exactly the fields of req named in mask, so a
+// masked field is written even when empty. "*" selects every field.
+func (s *UserService) UpdateUserMasked(ctx context.Context, id, version uint, req models.RestUpdateUserRequest, mask []string) (*models.User, error) {
+	var patch models.PatchUserRequest
+	for _, path := range mask {
+		switch path {
+		case "*":
+			patch = models.PatchUserRequest{Name: &req.Name, Email: &req.Email, Bio: &req.Bio, Phone: &req.Phone}
+		case "name":
+			patch.Name = &req.Name
+		case "email":
+			patch.Email = &req.Email
+		case "bio":
+			patch.Bio = &req.Bio
+		case "phone":
+			patch.Phone = &req.Phone
+		default:
+			return nil, fmt.Errorf("%w: unknown field %q in update mask", ErrInvalidUpdate, path)
+		}
+	}
+
+	// Masked fields follow the PATCH rules, except that name and email can't be cleared
+	var fields validation.Errors
+	if err := validation.Struct(patch); err != nil {
+		var ok bool
+		if fields, ok = validation.Translate(err); !ok {
+			return nil, err
+		}
+	}
+	if patch.Name != nil && *patch.Name == "" {
+		fields = append(fields, validation.FieldError{Field: "name", Rule: "required", Message: "name is required"})
+	}
+	if patch.Email != nil && *patch.Email == "" {
+		fields = append(fields, validation.FieldError{Field: "email", Rule: "required", Message: "email is required"})
+	}
+	if len(fields) > 0 {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidUpdate, fields)
+	}
+
+	return s.PatchUser(ctx, id, version, patch)
+}
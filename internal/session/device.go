@@ -0,0 +1,105 @@
+package session
+
+import "strings"
+
+// Device types
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceOther   = "other" // Non-browser clients such as curl or mobile app HTTP stacks
+)
+
+// Device describes the client behind a user agent
+type Device struct {
+	Name    string // Summary, e.g. "Firefox on Linux"
+	Browser string // Empty for non-browser clients
+	OS      string
+	Type    string
+}
+
+// Key identifies the device among those a user logs in from. Versions are
+// left out, so browser and OS updates don't make a device look new.
+func (d Device) Key() string {
+	return d.Type + ":" + d.Name
+}
+
+// ParseDevice describes the client behind a user agent for session
+// listings and new device alerts. Unrecognized clients are named by their
+// product token.
+func ParseDevice(userAgent string) Device {
+	if userAgent == "" {
+		return Device{Name: "Unknown device", Type: DeviceOther}
+	}
+
+	d := Device{
+		Browser: match(userAgent, []pattern{
+			{"Edg/", "Edge"},
+			{"OPR/", "Opera"},
+			{"Firefox/", "Firefox"},
+			{"Chrome/", "Chrome"},
+			{"Safari/", "Safari"},
+		}),
+		OS: match(userAgent, []pattern{
+			{"iPhone", "iPhone"},
+			{"iPad", "iPad"},
+			{"Android", "Android"},
+			{"Windows", "Windows"},
+			{"Mac OS X", "macOS"},
+			{"CrOS", "ChromeOS"},
+			{"Linux", "Linux"},
+		}),
+		Type: deviceType(userAgent),
+	}
+
+	switch {
+	case d.Browser != "" && d.OS != "":
+		d.Name = d.Browser + " on " + d.OS
+	case d.Browser != "":
+		d.Name = d.Browser
+	case d.OS != "":
+		d.Name = d.OS
+	default:
+		// Non-browser clients such as curl/8.0 or okhttp/4.9
+		product, _, _ := strings.Cut(userAgent, " ")
+		d.Name, _, _ = strings.Cut(product, "/")
+	}
+	if d.Type == DeviceDesktop && d.Browser == "" && d.OS == "" {
+		d.Type = DeviceOther
+	}
+	return d
+}
+
+// deviceType classifies a user agent. Android tablets are the Android
+// devices that don't claim to be mobile.
+func deviceType(userAgent string) string {
+	lower := strings.ToLower(userAgent)
+	switch {
+	case strings.Contains(lower, "bot") || strings.Contains(lower, "crawler") || strings.Contains(lower, "spider"):
+		return DeviceBot
+	case strings.Contains(userAgent, "iPad") || strings.Contains(userAgent, "Tablet") ||
+		strings.Contains(userAgent, "Android") && !strings.Contains(userAgent, "Mobile"):
+		return DeviceTablet
+	case strings.Contains(userAgent, "Mobile") || strings.Contains(userAgent, "iPhone"):
+		return DeviceMobile
+	default:
+		return DeviceDesktop
+	}
+}
+
+// pattern maps a user agent substring to a display name
+type pattern struct {
+	token, name string
+}
+
+// match returns the name of the first pattern found in userAgent. Order
+// matters: Chromium-based browsers also claim to be Chrome and Safari.
+func match(userAgent string, patterns []pattern) string {
+	for _, p := range patterns {
+		if strings.Contains(userAgent, p.token) {
+			return p.name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,37 @@
+package session
+
+import "testing"
+
+func TestParseDevice(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      Device
+	}{
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0",
+			Device{Name: "Firefox on Linux", Browser: "Firefox", OS: "Linux", Type: DeviceDesktop}},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0",
+			Device{Name: "Edge on Windows", Browser: "Edge", OS: "Windows", Type: DeviceDesktop}},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36",
+			Device{Name: "Chrome on Android", Browser: "Chrome", OS: "Android", Type: DeviceMobile}},
+		{"Mozilla/5.0 (Linux; Android 14; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36",
+			Device{Name: "Chrome on Android", Browser: "Chrome", OS: "Android", Type: DeviceTablet}},
+		{"Mozilla/5.0 (iPad; CPU OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1",
+			Device{Name: "Safari on iPad", Browser: "Safari", OS: "iPad", Type: DeviceTablet}},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			Device{Name: "Mozilla", Type: DeviceBot}},
+		{"curl/8.0.1", Device{Name: "curl", Type: DeviceOther}},
+		{"", Device{Name: "Unknown device", Type: DeviceOther}},
+	}
+	for _, tt := range tests {
+		if got := ParseDevice(tt.userAgent); got != tt.want {
+			t.Errorf("ParseDevice(%q) = %+v, want %+v", tt.userAgent, got, tt.want)
+		}
+	}
+
+	// Versions don't change the key
+	a := ParseDevice("Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0")
+	b := ParseDevice("Mozilla/5.0 (X11; Linux x86_64; rv:130.0) Gecko/20100101 Firefox/130.0")
+	if a.Key() != b.Key() {
+		t.Errorf("keys differ across versions: %q, %q", a.Key(), b.Key())
+	}
+}
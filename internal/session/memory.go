@@ -0,0 +1,163 @@
+package session
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-process Store for single-instance deployments.
+// Sessions are lost on restart.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	sessions map[string]Session
+	byUser   map[uint]map[string]struct{}
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[string]Session),
+		byUser:   make(map[uint]map[string]struct{}),
+	}
+}
+
+// Create implements Store
+func (m *MemoryStore) Create(ctx context.Context, s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[s.ID] = *s
+	if m.byUser[s.UserID] == nil {
+		m.byUser[s.UserID] = make(map[string]struct{})
+	}
+	m.byUser[s.UserID][s.ID] = struct{}{}
+	return nil
+}
+
+// Get implements Store
+func (m *MemoryStore) Get(ctx context.Context, id string) (*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.sessions[id]
+	if !ok || time.Now().After(s.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	return &s, nil
+}
+
+// Rotate implements Store
+func (m *MemoryStore) Rotate(ctx context.Context, s *Session, previousHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.sessions[s.ID]
+	if !ok || time.Now().After(current.ExpiresAt) {
+		return ErrNotFound
+	}
+	if current.RefreshHash != previousHash {
+		return ErrInvalidRefreshToken
+	}
+	m.sessions[s.ID] = *s
+	return nil
+}
+
+// Touch implements Store
+func (m *MemoryStore) Touch(ctx context.Context, id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	s.LastSeenAt = at
+	m.sessions[id] = s
+	return nil
+}
+
+// Revoke implements Store
+func (m *MemoryStore) Revoke(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.remove(id)
+	return nil
+}
+
+// RevokeUser implements Store
+func (m *MemoryStore) RevokeUser(ctx context.Context, userID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id := range m.byUser[userID] {
+		m.remove(id)
+	}
+	return nil
+}
+
+// ListByUser implements Store
+func (m *MemoryStore) ListByUser(ctx context.Context, userID uint) ([]Session, error) {
+	return m.live(func(s *Session) bool { return s.UserID == userID }), nil
+}
+
+// List implements Store. Sessions are returned newest first.
+func (m *MemoryStore) List(ctx context.Context, filter Filter) ([]Session, int, error) {
+	matched := m.live(func(s *Session) bool {
+		return (filter.UserID == 0 || s.UserID == filter.UserID) && (filter.IP == "" || s.IP == filter.IP)
+	})
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].CreatedAt.After(matched[j].CreatedAt)
+	})
+	return paginate(matched, filter.Offset, filter.Limit), len(matched), nil
+}
+
+// PurgeExpired implements Store
+func (m *MemoryStore) PurgeExpired(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	purged := 0
+	for id, s := range m.sessions {
+		if now.After(s.ExpiresAt) {
+			m.remove(id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// live returns the unexpired sessions matching keep, pruning expired ones
+func (m *MemoryStore) live(keep func(*Session) bool) []Session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	sessions := []Session{}
+	for id, s := range m.sessions {
+		if now.After(s.ExpiresAt) {
+			m.remove(id)
+			continue
+		}
+		if keep(&s) {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions
+}
+
+// remove deletes a session and its index entry. Callers must hold m.mu.
+func (m *MemoryStore) remove(id string) {
+	s, ok := m.sessions[id]
+	if !ok {
+		return
+	}
+	delete(m.sessions, id)
+	delete(m.byUser[s.UserID], id)
+	if len(m.byUser[s.UserID]) == 0 {
+		delete(m.byUser, s.UserID)
+	}
+}
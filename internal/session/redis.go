@@ -0,0 +1,328 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis key layout:
+//
+//	session:<id>          JSON session, expiring with the session
+//	user_sessions:<user>  set of session IDs (secondary index by user)
+//	sessions              sorted set of all session IDs scored by creation time
+const (
+	sessionKeyPrefix     = "session:"
+	userSessionKeyPrefix = "user_sessions:"
+	allSessionsKey       = "sessions"
+)
+
+// RedisStore is a Store shared by all instances through Redis
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore creates a RedisStore
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// storedSession includes the refresh hash, which Session hides from JSON responses
+type storedSession struct {
+	*Session
+	RefreshHash string `json:"refresh_hash"`
+}
+
+func sessionKey(id string) string {
+	return sessionKeyPrefix + id
+}
+
+func userSessionsKey(userID uint) string {
+	return fmt.Sprintf("%s%d", userSessionKeyPrefix, userID)
+}
+
+// Create implements Store
+func (r *RedisStore) Create(ctx context.Context, s *Session) error {
+	data, err := json.Marshal(storedSession{Session: s, RefreshHash: s.RefreshHash})
+	if err != nil {
+		return err
+	}
+
+	ttl := time.Until(s.ExpiresAt)
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, sessionKey(s.ID), data, ttl)
+		pipe.SAdd(ctx, userSessionsKey(s.UserID), s.ID)
+		// All sessions share one lifetime, so the newest session expires last
+		pipe.Expire(ctx, userSessionsKey(s.UserID), ttl)
+		pipe.ZAdd(ctx, allSessionsKey, redis.Z{Score: float64(s.CreatedAt.Unix()), Member: s.ID})
+		return nil
+	})
+	return err
+}
+
+// Get implements Store
+func (r *RedisStore) Get(ctx context.Context, id string) (*Session, error) {
+	data, err := r.client.Get(ctx, sessionKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeSession(data)
+}
+
+// rotateAttempts bounds how often Rotate retries after the session changed
+// under it without being rotated, e.g. by Touch
+const rotateAttempts = 5
+
+// Rotate implements Store. The session key is watched between reading its
+// refresh hash and writing the rotated session, so the write is discarded
+// if another refresh or a revocation got in between.
+func (r *RedisStore) Rotate(ctx context.Context, s *Session, previousHash string) error {
+	data, err := json.Marshal(storedSession{Session: s, RefreshHash: s.RefreshHash})
+	if err != nil {
+		return err
+	}
+
+	key := sessionKey(s.ID)
+	ttl := time.Until(s.ExpiresAt)
+	for attempt := 0; attempt < rotateAttempts; attempt++ {
+		err = r.client.Watch(ctx, func(tx *redis.Tx) error {
+			current, err := tx.Get(ctx, key).Bytes()
+			if errors.Is(err, redis.Nil) {
+				return ErrNotFound
+			}
+			if err != nil {
+				return err
+			}
+			stored, err := decodeSession(current)
+			if err != nil {
+				return err
+			}
+			if stored.RefreshHash != previousHash {
+				return ErrInvalidRefreshToken
+			}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, key, data, ttl)
+				pipe.Expire(ctx, userSessionsKey(s.UserID), ttl)
+				return nil
+			})
+			return err
+		}, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return err
+}
+
+// Touch implements Store. The write is skipped if the session changes
+// concurrently, e.g. a refresh rotating its token, rather than overwriting it.
+func (r *RedisStore) Touch(ctx context.Context, id string, at time.Time) error {
+	key := sessionKey(id)
+	err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		s, err := decodeSession(data)
+		if err != nil {
+			return err
+		}
+
+		s.LastSeenAt = at
+		data, err = json.Marshal(storedSession{Session: s, RefreshHash: s.RefreshHash})
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.SetArgs(ctx, key, data, redis.SetArgs{KeepTTL: true})
+			return nil
+		})
+		return err
+	}, key)
+	if errors.Is(err, redis.TxFailedErr) {
+		return nil
+	}
+	return err
+}
+
+// Revoke implements Store
+func (r *RedisStore) Revoke(ctx context.Context, id string) error {
+	s, err := r.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, sessionKey(id))
+		pipe.SRem(ctx, userSessionsKey(s.UserID), id)
+		pipe.ZRem(ctx, allSessionsKey, id)
+		return nil
+	})
+	return err
+}
+
+// RevokeUser implements Store
+func (r *RedisStore) RevokeUser(ctx context.Context, userID uint) error {
+	ids, err := r.client.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			pipe.Del(ctx, sessionKey(id))
+			pipe.ZRem(ctx, allSessionsKey, id)
+		}
+		pipe.Del(ctx, userSessionsKey(userID))
+		return nil
+	})
+	return err
+}
+
+// ListByUser implements Store
+func (r *RedisStore) ListByUser(ctx context.Context, userID uint) ([]Session, error) {
+	ids, err := r.client.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, expired, err := r.load(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(expired) > 0 {
+		r.client.SRem(ctx, userSessionsKey(userID), expired...)
+	}
+	return sessions, nil
+}
+
+// List implements Store. Sessions are returned newest first.
+func (r *RedisStore) List(ctx context.Context, filter Filter) ([]Session, int, error) {
+	var sessions []Session
+	if filter.UserID != 0 {
+		userSessions, err := r.ListByUser(ctx, filter.UserID)
+		if err != nil {
+			return nil, 0, err
+		}
+		sessions = userSessions
+		sort.Slice(sessions, func(i, j int) bool {
+			return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+		})
+	} else {
+		ids, err := r.client.ZRevRange(ctx, allSessionsKey, 0, -1).Result()
+		if err != nil {
+			return nil, 0, err
+		}
+		all, expired, err := r.load(ctx, ids)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(expired) > 0 {
+			r.client.ZRem(ctx, allSessionsKey, expired...)
+		}
+		sessions = all
+	}
+
+	matched := sessions[:0]
+	for _, s := range sessions {
+		if filter.IP == "" || s.IP == filter.IP {
+			matched = append(matched, s)
+		}
+	}
+	return paginate(matched, filter.Offset, filter.Limit), len(matched), nil
+}
+
+// PurgeExpired implements Store. Session keys expire on their own, so this
+// only prunes the IDs they leave behind in the index of all sessions; per-user
+// indexes expire with the user's newest session.
+func (r *RedisStore) PurgeExpired(ctx context.Context) (int, error) {
+	ids, err := r.client.ZRange(ctx, allSessionsKey, 0, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+	_, expired, err := r.load(ctx, ids)
+	if err != nil {
+		return 0, err
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+	if err := r.client.ZRem(ctx, allSessionsKey, expired...).Err(); err != nil {
+		return 0, err
+	}
+	return len(expired), nil
+}
+
+// load fetches sessions by ID, also returning the IDs whose session has
+// expired so callers can prune their index
+func (r *RedisStore) load(ctx context.Context, ids []string) ([]Session, []interface{}, error) {
+	if len(ids) == 0 {
+		return nil, nil, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = sessionKey(id)
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sessions := make([]Session, 0, len(values))
+	var expired []interface{}
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			expired = append(expired, ids[i])
+			continue
+		}
+		s, err := decodeSession([]byte(data))
+		if err != nil {
+			return nil, nil, err
+		}
+		sessions = append(sessions, *s)
+	}
+	return sessions, expired, nil
+}
+
+func decodeSession(data []byte) (*Session, error) {
+	stored := storedSession{Session: &Session{}}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	stored.Session.RefreshHash = stored.RefreshHash
+	return stored.Session, nil
+}
+
+// paginate returns the page of sessions at offset, limited to limit entries (0 means all)
+func paginate(sessions []Session, offset, limit int) []Session {
+	if offset >= len(sessions) {
+		return []Session{}
+	}
+	sessions = sessions[offset:]
+	if limit > 0 && limit < len(sessions) {
+		sessions = sessions[:limit]
+	}
+	return sessions
+}
+
+// Ping checks that Redis is reachable
+func (r *RedisStore) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
@@ -0,0 +1,198 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when a session does not exist, has expired, or was revoked
+	ErrNotFound = errors.New("session not found")
+	// ErrInvalidRefreshToken is returned when a refresh token is malformed or doesn't match its session
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+)
+
+// Session is a login session backing an access token and its refresh token
+type Session struct {
+	ID          string    `json:"id"`
+	UserID      uint      `json:"user_id"`
+	TenantID    string    `json:"tenant_id"`
+	IP          string    `json:"ip"`
+	UserAgent   string    `json:"user_agent"`
+	Device      string    `json:"device"` // Summary of the user agent, e.g. "Firefox on Linux"
+	Browser     string    `json:"browser,omitempty"`
+	OS          string    `json:"os,omitempty"`
+	DeviceType  string    `json:"device_type,omitempty"` // DeviceDesktop, DeviceMobile, ...
+	CreatedAt   time.Time `json:"created_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	RefreshHash string    `json:"-"` // SHA-256 of the current refresh token secret
+}
+
+// Filter selects sessions for the admin view
+type Filter struct {
+	UserID uint   // 0 matches all users
+	IP     string // exact match; empty matches all
+	Offset int
+	Limit  int
+}
+
+// Store persists sessions with a secondary index by user
+type Store interface {
+	Create(ctx context.Context, s *Session) error
+	Get(ctx context.Context, id string) (*Session, error)
+	// Rotate stores s in place of the session with its ID, provided the
+	// stored refresh hash is still previousHash. Otherwise the token was
+	// already rotated and it returns ErrInvalidRefreshToken, leaving the
+	// session unchanged. The check and the write are atomic.
+	Rotate(ctx context.Context, s *Session, previousHash string) error
+	Touch(ctx context.Context, id string, at time.Time) error
+	Revoke(ctx context.Context, id string) error
+	RevokeUser(ctx context.Context, userID uint) error
+	ListByUser(ctx context.Context, userID uint) ([]Session, error)
+	List(ctx context.Context, filter Filter) ([]Session, int, error)
+	PurgeExpired(ctx context.Context) (int, error)
+}
+
+// Manager issues, validates, refreshes and revokes sessions
+type Manager struct {
+	store Store
+	ttl   time.Duration
+}
+
+// NewManager creates a Manager whose sessions expire ttl after their last refresh
+func NewManager(store Store, ttl time.Duration) *Manager {
+	return &Manager{store: store, ttl: ttl}
+}
+
+// Start creates a session and returns it with its refresh token
+func (m *Manager) Start(ctx context.Context, userID uint, tenantID, ip, userAgent string) (*Session, string, error) {
+	now := time.Now()
+	secret := randomToken()
+	device := ParseDevice(userAgent)
+	s := &Session{
+		ID:          randomToken(),
+		UserID:      userID,
+		TenantID:    tenantID,
+		IP:          ip,
+		UserAgent:   userAgent,
+		Device:      device.Name,
+		Browser:     device.Browser,
+		OS:          device.OS,
+		DeviceType:  device.Type,
+		CreatedAt:   now,
+		LastSeenAt:  now,
+		ExpiresAt:   now.Add(m.ttl),
+		RefreshHash: hashSecret(secret),
+	}
+	if err := m.store.Create(ctx, s); err != nil {
+		return nil, "", err
+	}
+	return s, s.ID + "." + secret, nil
+}
+
+// Validate returns the live session with the given ID
+func (m *Manager) Validate(ctx context.Context, id string) (*Session, error) {
+	s, err := m.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(s.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	return s, nil
+}
+
+// lastSeenResolution limits how often request activity is written back to a session
+const lastSeenResolution = time.Minute
+
+// Seen records activity on a session, writing at most once per minute so
+// that authenticated requests rarely touch the store
+func (m *Manager) Seen(ctx context.Context, s *Session) error {
+	now := time.Now()
+	if now.Sub(s.LastSeenAt) < lastSeenResolution {
+		return nil
+	}
+	s.LastSeenAt = now
+	return m.store.Touch(ctx, s.ID, now)
+}
+
+// Refresh exchanges a refresh token for a rotated one, extending the session.
+// Each refresh token works once: presenting one again, even concurrently
+// with its first use, is taken for a replay and revokes the session.
+func (m *Manager) Refresh(ctx context.Context, refreshToken string) (*Session, string, error) {
+	id, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok || id == "" || secret == "" {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	s, err := m.Validate(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	previousHash := hashSecret(secret)
+	if subtle.ConstantTimeCompare([]byte(s.RefreshHash), []byte(previousHash)) != 1 {
+		// A mismatched secret suggests a replayed token; revoke the session
+		_ = m.store.Revoke(ctx, id)
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	newSecret := randomToken()
+	now := time.Now()
+	s.RefreshHash = hashSecret(newSecret)
+	s.LastSeenAt = now
+	s.ExpiresAt = now.Add(m.ttl)
+	if err := m.store.Rotate(ctx, s, previousHash); err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) {
+			// Another refresh with the same token got there first
+			_ = m.store.Revoke(ctx, id)
+		}
+		return nil, "", err
+	}
+	return s, s.ID + "." + newSecret, nil
+}
+
+// Revoke ends a session immediately
+func (m *Manager) Revoke(ctx context.Context, id string) error {
+	return m.store.Revoke(ctx, id)
+}
+
+// RevokeUser ends all sessions of a user
+func (m *Manager) RevokeUser(ctx context.Context, userID uint) error {
+	return m.store.RevokeUser(ctx, userID)
+}
+
+// ListByUser returns a user's live sessions
+func (m *Manager) ListByUser(ctx context.Context, userID uint) ([]Session, error) {
+	return m.store.ListByUser(ctx, userID)
+}
+
+// List returns live sessions across all instances matching filter, with the total match count
+func (m *Manager) List(ctx context.Context, filter Filter) ([]Session, int, error) {
+	return m.store.List(ctx, filter)
+}
+
+// PurgeExpired drops expired sessions from the store and its indexes,
+// returning how many were removed
+func (m *Manager) PurgeExpired(ctx context.Context) (int, error) {
+	return m.store.PurgeExpired(ctx)
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic("session: crypto/rand unavailable: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
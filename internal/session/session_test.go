@@ -0,0 +1,164 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// stores returns the stores to test: memory, plus Redis when
+// TEST_REDIS_URL names a server the tests may write to
+func stores(t *testing.T) map[string]Store {
+	t.Helper()
+	all := map[string]Store{"memory": NewMemoryStore()}
+	if url := os.Getenv("TEST_REDIS_URL"); url != "" {
+		opts, err := redis.ParseURL(url)
+		if err != nil {
+			t.Fatalf("TEST_REDIS_URL: %v", err)
+		}
+		client := redis.NewClient(opts)
+		t.Cleanup(func() { _ = client.Close() })
+		all["redis"] = NewRedisStore(client)
+	}
+	return all
+}
+
+func TestRefreshRotates(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			m := NewManager(store, time.Hour)
+			s, token, err := m.Start(ctx, 1, "default", "192.0.2.1", "")
+			if err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+
+			_, rotated, err := m.Refresh(ctx, token)
+			if err != nil || rotated == token {
+				t.Fatalf("Refresh: %v, token unchanged: %v", err, rotated == token)
+			}
+			if _, next, err := m.Refresh(ctx, rotated); err != nil || next == rotated {
+				t.Fatalf("Refresh with the rotated token: %v", err)
+			}
+			if _, err := m.Validate(ctx, s.ID); err != nil {
+				t.Fatalf("session after refreshes: %v", err)
+			}
+		})
+	}
+}
+
+func TestRefreshReuseRevokesSession(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			m := NewManager(store, time.Hour)
+			s, token, err := m.Start(ctx, 1, "default", "192.0.2.1", "")
+			if err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+			_, rotated, err := m.Refresh(ctx, token)
+			if err != nil {
+				t.Fatalf("Refresh: %v", err)
+			}
+
+			if _, _, err := m.Refresh(ctx, token); !errors.Is(err, ErrInvalidRefreshToken) {
+				t.Fatalf("reusing a refresh token: expected ErrInvalidRefreshToken, got %v", err)
+			}
+			if _, err := m.Validate(ctx, s.ID); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("session after reuse: expected ErrNotFound, got %v", err)
+			}
+			if _, _, err := m.Refresh(ctx, rotated); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("rotated token after reuse: expected ErrNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+// lockstepStore holds every Get until readers sessions have been read, so
+// that concurrent refreshes all see the session before any of them rotates it
+type lockstepStore struct {
+	Store
+	read *sync.WaitGroup
+}
+
+func (s lockstepStore) Get(ctx context.Context, id string) (*Session, error) {
+	session, err := s.Store.Get(ctx, id)
+	s.read.Done()
+	s.read.Wait()
+	return session, err
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			_, token, err := NewManager(store, time.Hour).Start(ctx, 1, "default", "192.0.2.1", "")
+			if err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+
+			const refreshes = 4
+			read := &sync.WaitGroup{}
+			read.Add(refreshes)
+			m := NewManager(lockstepStore{Store: store, read: read}, time.Hour)
+
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			var issued []string
+			for i := 0; i < refreshes; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, rotated, err := m.Refresh(ctx, token); err == nil {
+						mu.Lock()
+						issued = append(issued, rotated)
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+
+			// A token can only be rotated once, however many requests race
+			if len(issued) > 1 {
+				t.Fatalf("one refresh token was exchanged %d times", len(issued))
+			}
+		})
+	}
+}
+
+func TestRotateRequiresPreviousHash(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now()
+			s := &Session{ID: randomToken(), UserID: 1, CreatedAt: now, LastSeenAt: now, ExpiresAt: now.Add(time.Hour), RefreshHash: "a"}
+			if err := store.Create(ctx, s); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+
+			rotated := *s
+			rotated.RefreshHash = "b"
+			if err := store.Rotate(ctx, &rotated, "stale"); !errors.Is(err, ErrInvalidRefreshToken) {
+				t.Fatalf("Rotate with a stale hash: expected ErrInvalidRefreshToken, got %v", err)
+			}
+			if err := store.Rotate(ctx, &rotated, "a"); err != nil {
+				t.Fatalf("Rotate: %v", err)
+			}
+			if got, err := store.Get(ctx, s.ID); err != nil || got.RefreshHash != "b" {
+				t.Fatalf("Get after Rotate: %v, hash %q", err, got.RefreshHash)
+			}
+
+			missing := rotated
+			missing.ID = randomToken()
+			if err := store.Rotate(ctx, &missing, "b"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Rotate of a missing session: expected ErrNotFound, got %v", err)
+			}
+			_ = store.Revoke(ctx, s.ID)
+		})
+	}
+}
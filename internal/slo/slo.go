@@ -0,0 +1,257 @@
+// Package slo tracks per-endpoint availability and latency objectives over
+// a rolling window and computes the remaining error budgets in-process.
+package slo
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/114windd/restapi/internal/metrics"
+)
+
+// DefaultEndpoint is the objective key applied to endpoints without their own
+const DefaultEndpoint = "default"
+
+// buckets is the number of slices the rolling window is divided into
+const buckets = 60
+
+// metricsInterval is how often budgets are exported as metrics
+const metricsInterval = 15 * time.Second
+
+// Objective is the target for one endpoint. Availability is the fraction of
+// requests that must not fail with a 5xx; LatencyTarget the fraction that
+// must complete within LatencyThreshold.
+type Objective struct {
+	Availability     float64
+	LatencyThreshold time.Duration
+	LatencyTarget    float64
+}
+
+// MarshalJSON renders the latency threshold as a duration string
+func (o Objective) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Availability     float64 `json:"availability"`
+		LatencyThreshold string  `json:"latency_threshold"`
+		LatencyTarget    float64 `json:"latency_target"`
+	}{o.Availability, o.LatencyThreshold.String(), o.LatencyTarget})
+}
+
+// Report is an endpoint's performance against its objective over the window
+type Report struct {
+	Endpoint                    string    `json:"endpoint"`
+	Objective                   Objective `json:"objective"`
+	Requests                    int64     `json:"requests"`
+	Errors                      int64     `json:"errors"`
+	Slow                        int64     `json:"slow"`
+	Availability                float64   `json:"availability"`
+	LatencyCompliance           float64   `json:"latency_compliance"`
+	AvailabilityBudgetRemaining float64   `json:"availability_budget_remaining"`
+	LatencyBudgetRemaining      float64   `json:"latency_budget_remaining"`
+	Met                         bool      `json:"met"`
+}
+
+type bucket struct {
+	epoch                  int64
+	requests, errors, slow int64
+}
+
+type series struct {
+	objective Objective
+	buckets   [buckets]bucket
+}
+
+// Tracker records request outcomes per endpoint ("METHOD /route")
+type Tracker struct {
+	objectives map[string]Objective
+	window     time.Duration
+	width      time.Duration
+
+	mu        sync.Mutex
+	series    map[string]*series
+	published time.Time
+}
+
+// NewTracker creates a tracker evaluating objectives over a rolling window.
+// objectives must contain DefaultEndpoint.
+func NewTracker(objectives map[string]Objective, window time.Duration) *Tracker {
+	return &Tracker{
+		objectives: objectives,
+		window:     window,
+		width:      window / buckets,
+		series:     make(map[string]*series),
+	}
+}
+
+// Window returns the rolling window objectives are evaluated over
+func (t *Tracker) Window() time.Duration {
+	return t.window
+}
+
+// Record adds a request outcome
+func (t *Tracker) Record(endpoint string, status int, duration time.Duration) {
+	now := time.Now()
+
+	t.mu.Lock()
+	s, ok := t.series[endpoint]
+	if !ok {
+		objective, ok := t.objectives[endpoint]
+		if !ok {
+			objective = t.objectives[DefaultEndpoint]
+		}
+		s = &series{objective: objective}
+		t.series[endpoint] = s
+	}
+
+	epoch := now.UnixNano() / int64(t.width)
+	b := &s.buckets[epoch%buckets]
+	if b.epoch != epoch {
+		*b = bucket{epoch: epoch}
+	}
+	b.requests++
+	if status >= 500 {
+		b.errors++
+	}
+	if duration > s.objective.LatencyThreshold {
+		b.slow++
+	}
+
+	publish := now.Sub(t.published) > metricsInterval
+	if publish {
+		t.published = now
+	}
+	t.mu.Unlock()
+
+	if publish {
+		t.Reports()
+	}
+}
+
+// Reports evaluates every endpoint seen during the window, sorted by
+// endpoint, and exports the results as metrics
+func (t *Tracker) Reports() []Report {
+	oldest := time.Now().Add(-t.window).UnixNano()/int64(t.width) + 1
+
+	t.mu.Lock()
+	reports := make([]Report, 0, len(t.series))
+	for endpoint, s := range t.series {
+		r := Report{Endpoint: endpoint, Objective: s.objective}
+		for _, b := range s.buckets {
+			if b.epoch >= oldest {
+				r.Requests += b.requests
+				r.Errors += b.errors
+				r.Slow += b.slow
+			}
+		}
+		r.evaluate()
+		reports = append(reports, r)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Endpoint < reports[j].Endpoint })
+	for _, r := range reports {
+		metrics.UpdateSLO(r.Endpoint, "availability", r.Availability, r.AvailabilityBudgetRemaining)
+		metrics.UpdateSLO(r.Endpoint, "latency", r.LatencyCompliance, r.LatencyBudgetRemaining)
+	}
+	return reports
+}
+
+// evaluate derives compliance and budgets from the counts. With no traffic
+// both objectives are met and the budgets untouched.
+func (r *Report) evaluate() {
+	r.Availability, r.LatencyCompliance = 1, 1
+	r.AvailabilityBudgetRemaining, r.LatencyBudgetRemaining = 1, 1
+	if r.Requests > 0 {
+		total := float64(r.Requests)
+		r.Availability = 1 - float64(r.Errors)/total
+		r.LatencyCompliance = 1 - float64(r.Slow)/total
+		r.AvailabilityBudgetRemaining = budgetRemaining(r.Errors, total, r.Objective.Availability)
+		r.LatencyBudgetRemaining = budgetRemaining(r.Slow, total, r.Objective.LatencyTarget)
+	}
+	r.Met = r.Availability >= r.Objective.Availability && r.LatencyCompliance >= r.Objective.LatencyTarget
+}
+
+// budgetRemaining is the fraction of the allowed bad requests not yet used;
+// negative once the budget is overspent
+func budgetRemaining(bad int64, total, target float64) float64 {
+	allowed := total * (1 - target)
+	if allowed <= 0 {
+		if bad > 0 {
+			return -1
+		}
+		return 1
+	}
+	return 1 - float64(bad)/allowed
+}
+
+// Middleware records the outcome of every request that matched a route
+func (t *Tracker) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			return
+		}
+		t.Record(c.Request.Method+" "+route, c.Writer.Status(), time.Since(start))
+	}
+}
+
+// ParseObjectives reads objectives of the form
+// "default=99.9:500ms:99;POST /api/v1/login=99.5:1s:95", each giving the
+// availability percentage, latency threshold and percentage of requests
+// that must meet it. A default objective is required.
+func ParseObjectives(spec string) (map[string]Objective, error) {
+	objectives := make(map[string]Objective)
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		endpoint, target, ok := strings.Cut(entry, "=")
+		endpoint = strings.TrimSpace(endpoint)
+		parts := strings.Split(target, ":")
+		if !ok || endpoint == "" || len(parts) != 3 {
+			return nil, fmt.Errorf("SLO objective %q: expected endpoint=availability:latency:latency_target", entry)
+		}
+
+		availability, err := parsePercent(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("SLO objective %q: availability: %w", endpoint, err)
+		}
+		threshold, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil || threshold <= 0 {
+			return nil, fmt.Errorf("SLO objective %q: invalid latency threshold %q", endpoint, parts[1])
+		}
+		latencyTarget, err := parsePercent(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("SLO objective %q: latency target: %w", endpoint, err)
+		}
+
+		objectives[endpoint] = Objective{
+			Availability:     availability,
+			LatencyThreshold: threshold,
+			LatencyTarget:    latencyTarget,
+		}
+	}
+	if _, ok := objectives[DefaultEndpoint]; !ok {
+		return nil, fmt.Errorf("SLO objectives need a %q entry", DefaultEndpoint)
+	}
+	return objectives, nil
+}
+
+func parsePercent(s string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil || v <= 0 || v > 100 {
+		return 0, fmt.Errorf("invalid percentage %q", s)
+	}
+	return v / 100, nil
+}
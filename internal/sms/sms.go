@@ -0,0 +1,131 @@
+// Package sms sends text messages through Twilio, or the log in
+// development, and reads the delivery reports the provider posts back.
+package sms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/114windd/restapi/internal/config"
+	"github.com/114windd/restapi/internal/logger"
+	"github.com/114windd/restapi/internal/metrics"
+)
+
+var (
+	// ErrRejected is returned when the provider refuses a message, e.g.
+	// because the number is invalid or can't receive text messages
+	ErrRejected = errors.New("message rejected by the SMS provider")
+	// ErrInvalidSignature is returned for delivery reports that were not
+	// signed by the provider
+	ErrInvalidSignature = errors.New("invalid delivery report signature")
+	// ErrNoDeliveryReports is returned when the provider doesn't send delivery reports
+	ErrNoDeliveryReports = errors.New("SMS delivery reports are not enabled")
+)
+
+// Message is an outgoing text message
+type Message struct {
+	To      string // E.164 phone number
+	Body    string
+	Purpose string // what the message is for, labelling metrics
+}
+
+// Sender delivers text messages, returning the provider's ID for the message
+type Sender interface {
+	Send(ctx context.Context, msg Message) (string, error)
+}
+
+// StatusReport is a delivery status update posted back by the provider
+type StatusReport struct {
+	MessageID string
+	To        string
+	Status    string // e.g. queued, sent, delivered, undelivered, failed
+	ErrorCode string // provider error code for undelivered and failed messages
+}
+
+// StatusParser is implemented by senders that receive delivery reports
+type StatusParser interface {
+	// ParseStatus authenticates and decodes a delivery report request
+	ParseStatus(r *http.Request) (StatusReport, error)
+}
+
+// LogSender logs messages instead of sending them, for development and
+// tests. The body, which carries codes, is only logged at debug level.
+type LogSender struct{}
+
+// Send implements Sender
+func (LogSender) Send(ctx context.Context, msg Message) (string, error) {
+	entry := logger.Log.WithField("to", msg.To).WithField("purpose", msg.Purpose)
+	entry.Info("SMS (not sent, log sender)")
+	entry.WithField("body", msg.Body).Debug("SMS body")
+	return "", nil
+}
+
+// Client sends messages through a provider and receives its delivery
+// reports, counting both in metrics
+type Client struct {
+	sender   Sender
+	provider string
+}
+
+// NewClient creates a client for sender, labelled provider in metrics
+func NewClient(sender Sender, provider string) *Client {
+	return &Client{sender: sender, provider: provider}
+}
+
+// New creates a client for the configured provider
+func New(cfg config.SMSConfig) (*Client, error) {
+	switch cfg.Provider {
+	case config.SMSProviderLog, "":
+		return NewClient(LogSender{}, config.SMSProviderLog), nil
+	case config.SMSProviderTwilio:
+		return NewClient(NewTwilioSender(cfg.TwilioAccountSID, cfg.TwilioAuthToken, cfg.TwilioFrom, cfg.CallbackURL), cfg.Provider), nil
+	default:
+		return nil, fmt.Errorf("unknown SMS provider %q", cfg.Provider)
+	}
+}
+
+// Provider names the provider messages go through
+func (c *Client) Provider() string {
+	return c.provider
+}
+
+// Send implements Sender
+func (c *Client) Send(ctx context.Context, msg Message) (string, error) {
+	id, err := c.sender.Send(ctx, msg)
+	switch {
+	case errors.Is(err, ErrRejected):
+		metrics.RecordSMSMessage(c.provider, msg.Purpose, "rejected")
+	case err != nil:
+		metrics.RecordSMSMessage(c.provider, msg.Purpose, "error")
+	default:
+		metrics.RecordSMSMessage(c.provider, msg.Purpose, "sent")
+	}
+	return id, err
+}
+
+// ReceiveStatus authenticates and records a delivery report posted by the provider
+func (c *Client) ReceiveStatus(r *http.Request) (StatusReport, error) {
+	parser, ok := c.sender.(StatusParser)
+	if !ok {
+		return StatusReport{}, ErrNoDeliveryReports
+	}
+	report, err := parser.ParseStatus(r)
+	if err != nil {
+		return StatusReport{}, err
+	}
+
+	status := report.Status
+	if status == "" {
+		status = "unknown"
+	}
+	metrics.RecordSMSDeliveryReport(c.provider, status)
+	entry := logger.Log.WithField("message_id", report.MessageID).WithField("status", status)
+	if report.ErrorCode != "" {
+		entry.WithField("error_code", report.ErrorCode).Warn("SMS not delivered")
+	} else {
+		entry.Debug("SMS delivery status")
+	}
+	return report, nil
+}
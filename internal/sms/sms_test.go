@@ -0,0 +1,106 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/114windd/restapi/internal/logger"
+)
+
+func init() {
+	logger.Init()
+	logger.Log.SetOutput(io.Discard)
+}
+
+func TestTwilioSend(t *testing.T) {
+	var form url.Values
+	var user, pass string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/2010-04-01/Accounts/AC123/Messages.json" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		user, pass, _ = r.BasicAuth()
+		_ = r.ParseForm()
+		form = r.PostForm
+		if form.Get("To") == "+15005550001" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, `{"code": 21211, "message": "The 'To' number is not a valid phone number.", "status": 400}`)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, `{"sid": "SM123", "status": "queued"}`)
+	}))
+	defer server.Close()
+
+	sender := NewTwilioSender("AC123", "secret", "+15005550006", "https://api.example.com/api/v1/sms/status")
+	sender.baseURL = server.URL
+
+	id, err := sender.Send(context.Background(), Message{To: "+14155550123", Body: "Your code is 123456"})
+	if err != nil || id != "SM123" {
+		t.Fatalf("Send: %q, %v", id, err)
+	}
+	if user != "AC123" || pass != "secret" {
+		t.Errorf("expected basic auth with the account SID and token, got %q:%q", user, pass)
+	}
+	if form.Get("From") != "+15005550006" || form.Get("Body") != "Your code is 123456" || form.Get("StatusCallback") != "https://api.example.com/api/v1/sms/status" {
+		t.Errorf("unexpected form %v", form)
+	}
+
+	// A messaging service SID is sent as such
+	sender.from = "MG123"
+	if _, err := sender.Send(context.Background(), Message{To: "+14155550123", Body: "Hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if form.Get("MessagingServiceSid") != "MG123" || form.Has("From") {
+		t.Errorf("expected MessagingServiceSid, got %v", form)
+	}
+
+	if _, err := sender.Send(context.Background(), Message{To: "+15005550001", Body: "Hi"}); !errors.Is(err, ErrRejected) {
+		t.Fatalf("expected ErrRejected for an invalid number, got %v", err)
+	}
+}
+
+func TestTwilioStatusSignature(t *testing.T) {
+	// The example from Twilio's webhook security documentation
+	callback := "https://mycompany.com/myapp.php?foo=1&bar=2"
+	sender := NewTwilioSender("AC123", "12345", "+15005550006", callback)
+	params := url.Values{
+		"CallSid": {"CA1234567890ABCDE"},
+		"Caller":  {"+12349013030"},
+		"Digits":  {"1234"},
+		"From":    {"+12349013030"},
+		"To":      {"+18005551212"},
+	}
+	if got := sender.signature(callback, params); got != "0/KCTR6DLpKmkAf8muzZqo1nDgQ=" {
+		t.Fatalf("signature %q does not match Twilio's", got)
+	}
+
+	report := url.Values{"MessageSid": {"SM123"}, "MessageStatus": {"undelivered"}, "ErrorCode": {"30003"}, "To": {"+14155550123"}}
+	request := func(signature string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/sms/status", strings.NewReader(report.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("X-Twilio-Signature", signature)
+		return r
+	}
+
+	client := NewClient(sender, "twilio")
+	got, err := client.ReceiveStatus(request(sender.signature(callback, report)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != (StatusReport{MessageID: "SM123", To: "+14155550123", Status: "undelivered", ErrorCode: "30003"}) {
+		t.Fatalf("unexpected report %+v", got)
+	}
+	if _, err := client.ReceiveStatus(request("forged")); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+	if _, err := NewClient(LogSender{}, "log").ReceiveStatus(request("")); !errors.Is(err, ErrNoDeliveryReports) {
+		t.Fatalf("expected ErrNoDeliveryReports from the log sender, got %v", err)
+	}
+}
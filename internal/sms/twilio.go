@@ -0,0 +1,124 @@
+package sms
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// twilioAPI is the base URL of the Twilio REST API
+const twilioAPI = "https://api.twilio.com"
+
+// TwilioSender sends text messages through the Twilio Messages API
+type TwilioSender struct {
+	accountSID string
+	authToken  string
+	from       string
+	callback   string // delivery reports are requested when set
+	baseURL    string
+	client     *http.Client
+}
+
+// NewTwilioSender creates a sender for the account accountSID. from is a
+// phone number or, when it starts with MG, a messaging service SID.
+// Delivery reports are posted to callbackURL when it is set.
+func NewTwilioSender(accountSID, authToken, from, callbackURL string) *TwilioSender {
+	return &TwilioSender{
+		accountSID: accountSID,
+		authToken:  authToken,
+		from:       from,
+		callback:   callbackURL,
+		baseURL:    twilioAPI,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type twilioResponse struct {
+	SID     string `json:"sid"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Send implements Sender. Messages Twilio refuses with a 4xx response wrap
+// ErrRejected.
+func (t *TwilioSender) Send(ctx context.Context, msg Message) (string, error) {
+	form := url.Values{"To": {msg.To}, "Body": {msg.Body}}
+	if strings.HasPrefix(t.from, "MG") {
+		form.Set("MessagingServiceSid", t.from)
+	} else {
+		form.Set("From", t.from)
+	}
+	if t.callback != "" {
+		form.Set("StatusCallback", t.callback)
+	}
+
+	endpoint := t.baseURL + "/2010-04-01/Accounts/" + url.PathEscape(t.accountSID) + "/Messages.json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(t.accountSID, t.authToken)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("twilio unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result twilioResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("invalid twilio response (status %d): %w", resp.StatusCode, err)
+	}
+	switch {
+	case resp.StatusCode >= 500:
+		return "", fmt.Errorf("twilio error %d: %s", result.Code, result.Message)
+	case resp.StatusCode >= 400:
+		return "", fmt.Errorf("%w: twilio error %d: %s", ErrRejected, result.Code, result.Message)
+	}
+	return result.SID, nil
+}
+
+// ParseStatus implements StatusParser, checking the X-Twilio-Signature
+// header against the configured callback URL
+func (t *TwilioSender) ParseStatus(r *http.Request) (StatusReport, error) {
+	if err := r.ParseForm(); err != nil {
+		return StatusReport{}, err
+	}
+	if t.callback == "" || !hmac.Equal([]byte(r.Header.Get("X-Twilio-Signature")), []byte(t.signature(t.callback, r.PostForm))) {
+		return StatusReport{}, ErrInvalidSignature
+	}
+	return StatusReport{
+		MessageID: r.PostForm.Get("MessageSid"),
+		To:        r.PostForm.Get("To"),
+		Status:    r.PostForm.Get("MessageStatus"),
+		ErrorCode: r.PostForm.Get("ErrorCode"),
+	}, nil
+}
+
+// signature computes Twilio's request signature: the HMAC-SHA1, keyed
+// with the auth token, of the URL followed by the sorted POST parameters
+func (t *TwilioSender) signature(callbackURL string, params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	mac := hmac.New(sha1.New, []byte(t.authToken))
+	mac.Write([]byte(callbackURL))
+	for _, key := range keys {
+		for _, value := range params[key] {
+			mac.Write([]byte(key + value))
+		}
+	}
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,116 @@
+// Package static serves a frontend from the API binary: files from a
+// directory, or built into the binary from internal/static/dist, with
+// client-side routes of single-page applications answered by index.html.
+package static
+
+import (
+	"bytes"
+	"embed"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// index is served for directories and, in SPA mode, unknown routes
+const index = "index.html"
+
+//go:embed all:dist
+var dist embed.FS
+
+// Embedded returns the frontend built into the binary. Build the frontend
+// into internal/static/dist before go build; the placeholder there says so.
+func Embedded() fs.FS {
+	assets, err := fs.Sub(dist, "dist")
+	if err != nil {
+		panic(err) // embedded at build time
+	}
+	return assets
+}
+
+// Server serves the files of a file system
+type Server struct {
+	files fs.FS
+	spa   bool
+}
+
+// New creates a Server for files. With spa, page requests for paths that
+// match no file get index.html, leaving routing to the application.
+func New(files fs.FS, spa bool) *Server {
+	return &Server{files: files, spa: spa}
+}
+
+// Serve answers GET and HEAD requests for files, directories with an
+// index.html and, in SPA mode, client-side routes. It returns false without
+// writing anything when the request is none of those, so the caller can
+// answer 404 its own way.
+func (s *Server) Serve(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if hidden(name) {
+		return false
+	}
+	if name == "" {
+		name = index
+	}
+
+	if s.serveFile(w, r, name) || s.serveFile(w, r, path.Join(name, index)) {
+		return true
+	}
+	if s.spa && clientRoute(r, name) {
+		return s.serveFile(w, r, index)
+	}
+	return false
+}
+
+// serveFile serves a regular file, reporting whether there was one
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, name string) bool {
+	f, err := s.files.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return false
+		}
+		content = bytes.NewReader(data)
+	}
+	if path.Base(name) == index {
+		// Pages name the current asset versions, so always revalidate them
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	// Embedded files have no modification time; ServeContent skips it then
+	http.ServeContent(w, r, name, info.ModTime(), content)
+	return true
+}
+
+// clientRoute reports whether a request for a missing file is a page
+// navigation the application routes itself: a browser asking for HTML at
+// a path without a file extension, outside the API
+func clientRoute(r *http.Request, name string) bool {
+	return path.Ext(name) == "" &&
+		!strings.HasPrefix(name, "api/") &&
+		strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// hidden reports whether name is, or is inside, a dotfile such as .env.
+// .well-known is public by design.
+func hidden(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") && part != ".well-known" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package static
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestServe(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html":               {Data: []byte("app")},
+		"app.js":                   {Data: []byte("js")},
+		".git/config":              {Data: []byte("secret")},
+		".well-known/security.txt": {Data: []byte("Contact: security@example.com")},
+	}
+	serve := func(s *Server, method, path, accept string) (bool, *httptest.ResponseRecorder) {
+		r := httptest.NewRequest(method, path, nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		return s.Serve(w, r), w
+	}
+
+	spa := New(files, true)
+	for _, tc := range []struct {
+		method, path, accept string
+		body                 string // empty when nothing is served
+	}{
+		{http.MethodGet, "/", "text/html", "app"},
+		{http.MethodGet, "/app.js", "*/*", "js"},
+		{http.MethodGet, "/../app.js", "*/*", "js"},
+		{http.MethodGet, "/.well-known/security.txt", "*/*", "Contact: security@example.com"},
+		{http.MethodGet, "/users/42", "text/html", "app"},
+		{http.MethodGet, "/users/42", "application/json", ""},
+		{http.MethodGet, "/missing.js", "text/html", ""},
+		{http.MethodGet, "/api/v2/users", "text/html", ""},
+		{http.MethodGet, "/.git/config", "*/*", ""},
+		{http.MethodPost, "/app.js", "*/*", ""},
+	} {
+		ok, w := serve(spa, tc.method, tc.path, tc.accept)
+		if ok != (tc.body != "") || ok && w.Body.String() != tc.body {
+			t.Errorf("%s %s (%s): served %v %q, expected %q", tc.method, tc.path, tc.accept, ok, w.Body.String(), tc.body)
+		}
+		if !ok && w.Body.Len() > 0 {
+			t.Errorf("%s %s: wrote a response without serving", tc.method, tc.path)
+		}
+	}
+
+	if _, w := serve(spa, http.MethodGet, "/", "text/html"); w.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("expected index.html to be revalidated, got %q", w.Header().Get("Cache-Control"))
+	}
+	if ok, _ := serve(New(files, false), http.MethodGet, "/users/42", "text/html"); ok {
+		t.Error("expected no fallback without SPA mode")
+	}
+}
+
+func TestEmbedded(t *testing.T) {
+	w := httptest.NewRecorder()
+	ok := New(Embedded(), true).Serve(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !ok || !strings.Contains(w.Body.String(), "<html") {
+		t.Fatalf("expected the embedded index, got %v %q", ok, w.Body.String())
+	}
+}
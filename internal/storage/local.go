@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSignature is returned for a signed URL that was tampered with or has expired
+var ErrInvalidSignature = errors.New("invalid or expired signature")
+
+// LocalObjectStore keeps objects as files under a root directory. It suits
+// single-instance deployments or a volume shared by all instances. Signed
+// URLs point back at the application, which checks them with Verify.
+type LocalObjectStore struct {
+	root       string
+	publicURL  string
+	signingKey []byte
+}
+
+// NewLocalObjectStore creates a LocalObjectStore rooted at dir, which is
+// created on first write. Signed URLs are publicURL followed by the key.
+func NewLocalObjectStore(dir, publicURL string, signingKey []byte) *LocalObjectStore {
+	return &LocalObjectStore{root: dir, publicURL: strings.TrimSuffix(publicURL, "/"), signingKey: signingKey}
+}
+
+// path maps a key to a file below the root, rejecting keys that would escape it
+func (l *LocalObjectStore) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if key == "" || clean == "/" || clean[1:] != key {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+// Put implements ObjectStore. The file is written under a temporary name
+// and renamed, so readers never see a partial object.
+func (l *LocalObjectStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// Get implements ObjectStore. The content type is derived from the key's extension.
+func (l *LocalObjectStore) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	name, err := l.path(key)
+	if err != nil {
+		return nil, nil, ErrObjectNotFound
+	}
+
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	contentType := mime.TypeByExtension(strings.ToLower(path.Ext(key)))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return f, &ObjectInfo{Size: stat.Size(), ContentType: contentType, ModTime: stat.ModTime()}, nil
+}
+
+// SignedURL implements ObjectStore
+func (l *LocalObjectStore) SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	if _, err := l.path(key); err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	query := url.Values{"expires": {expires}, "signature": {l.sign(key, expires)}}
+	return l.publicURL + "/" + (&url.URL{Path: key}).EscapedPath() + "?" + query.Encode(), nil
+}
+
+// Verify checks the expires and signature parameters of a signed URL for key
+func (l *LocalObjectStore) Verify(key, expires, signature string) error {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(l.sign(key, expires))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// sign computes the signature of a URL for key valid until expires. The
+// prefix keeps these MACs distinct from others made with the same key.
+func (l *LocalObjectStore) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, l.signingKey)
+	mac.Write([]byte("object-url\n" + key + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Delete implements ObjectStore. Deleting a missing object is not an error.
+func (l *LocalObjectStore) Delete(ctx context.Context, key string) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
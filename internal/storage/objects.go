@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/114windd/restapi/internal/config"
+)
+
+// ErrObjectNotFound is returned when no object is stored under a key
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStore keeps uploaded files such as avatars and generated exports.
+// Keys are slash-separated paths like "avatars/3f2a.png".
+type ObjectStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get returns the object's content, which the caller must close
+	Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL granting anyone who holds it read access to
+	// the object until ttl has passed
+	SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// NewObjectStore creates the object store for the configured backend
+func NewObjectStore(cfg config.ObjectStorageConfig) (ObjectStore, error) {
+	switch cfg.Backend {
+	case config.ObjectStorageLocal, "":
+		return NewLocalObjectStore(cfg.LocalDir, cfg.PublicURL, []byte(cfg.SigningKey)), nil
+	case config.ObjectStorageS3, config.ObjectStorageMinIO:
+		return NewS3ObjectStore(cfg)
+	default:
+		return nil, fmt.Errorf("unknown object storage backend %q", cfg.Backend)
+	}
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/114windd/restapi/internal/config"
+)
+
+// S3ObjectStore keeps objects in a bucket of an S3-compatible service such as
+// AWS S3 or MinIO
+type S3ObjectStore struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3ObjectStore creates an S3ObjectStore. The bucket must already exist.
+func NewS3ObjectStore(cfg config.ObjectStorageConfig) (*S3ObjectStore, error) {
+	if cfg.S3Bucket == "" {
+		return nil, fmt.Errorf("object storage backend %q requires S3_BUCKET", cfg.Backend)
+	}
+
+	// Without static keys, fall back to the environment and instance metadata
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.EnvMinio{},
+		&credentials.IAM{Client: &http.Client{Transport: http.DefaultTransport}},
+	})
+	if cfg.S3AccessKey != "" {
+		creds = credentials.NewStaticV4(cfg.S3AccessKey, cfg.S3SecretKey, "")
+	}
+	// MinIO and most self-hosted services address buckets by path, not subdomain
+	lookup := minio.BucketLookupAuto
+	if cfg.Backend == config.ObjectStorageMinIO {
+		lookup = minio.BucketLookupPath
+	}
+	client, err := minio.New(cfg.S3Endpoint, &minio.Options{
+		Creds:        creds,
+		Secure:       !cfg.S3Insecure,
+		Region:       cfg.S3Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+	return &S3ObjectStore{client: client, bucket: cfg.S3Bucket}, nil
+}
+
+// Put implements ObjectStore
+func (s *S3ObjectStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+// Get implements ObjectStore
+func (s *S3ObjectStore) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, s3Error(err)
+	}
+	// GetObject is lazy; Stat issues the request and surfaces missing keys
+	stat, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, nil, s3Error(err)
+	}
+	return obj, &ObjectInfo{Size: stat.Size, ContentType: stat.ContentType, ModTime: stat.LastModified}, nil
+}
+
+// Delete implements ObjectStore. Deleting a missing object is not an error.
+func (s *S3ObjectStore) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+// SignedURL implements ObjectStore with a presigned GET request, so
+// downloads go straight to the storage service
+func (s *S3ObjectStore) SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, ttl, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// s3Error maps a missing key to ErrObjectNotFound
+func s3Error(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrObjectNotFound
+	}
+	return err
+}
@@ -0,0 +1,81 @@
+// Package storage selects the backend for state that is shared between
+// requests: rate limit buckets, cached data and login sessions. The memory
+// backend needs no external services but keeps state per instance; the
+// Redis backend shares it across a cluster.
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/114windd/restapi/internal/bruteforce"
+	"github.com/114windd/restapi/internal/cache"
+	"github.com/114windd/restapi/internal/config"
+	"github.com/114windd/restapi/internal/router"
+	"github.com/114windd/restapi/internal/session"
+)
+
+// Stores are the state backends used by the application
+type Stores struct {
+	Backend  string
+	Limits   router.LimitStore
+	Cache    cache.Store
+	Sessions session.Store
+	// Failures counts failed logins for the brute-force guard
+	Failures bruteforce.Store
+	// Codes creates a store for one-time codes whose entries expire after ttl
+	Codes func(ttl time.Duration) cache.Store
+
+	// Ping checks the backend's connectivity; nil for the memory backend
+	Ping func(ctx context.Context) error
+}
+
+// New creates the stores for the configured backend. Cache entries expire
+// after cacheTTL.
+func New(cfg config.StorageConfig, cacheTTL time.Duration) (*Stores, error) {
+	switch cfg.Backend {
+	case config.StorageBackendMemory, "":
+		return NewMemory(cacheTTL), nil
+	case config.StorageBackendRedis:
+		if cfg.RedisURL == "" {
+			return nil, fmt.Errorf("storage backend %q requires REDIS_URL", cfg.Backend)
+		}
+		opts, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis URL: %w", err)
+		}
+		client := redis.NewClient(opts)
+		return &Stores{
+			Backend:  config.StorageBackendRedis,
+			Limits:   router.NewRedisLimitStore(client),
+			Cache:    cache.NewRedisStore(client, cacheTTL),
+			Sessions: session.NewRedisStore(client),
+			Failures: bruteforce.NewRedisStore(client),
+			Codes: func(ttl time.Duration) cache.Store {
+				return cache.NewRedisStore(client, ttl)
+			},
+			Ping: func(ctx context.Context) error {
+				return client.Ping(ctx).Err()
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
+
+// NewMemory creates in-process stores
+func NewMemory(cacheTTL time.Duration) *Stores {
+	return &Stores{
+		Backend:  config.StorageBackendMemory,
+		Limits:   router.NewMemoryLimitStore(),
+		Cache:    cache.NewMemoryStore(cacheTTL),
+		Sessions: session.NewMemoryStore(),
+		Failures: bruteforce.NewMemoryStore(),
+		Codes: func(ttl time.Duration) cache.Store {
+			return cache.NewMemoryStore(ttl)
+		},
+	}
+}
@@ -0,0 +1,83 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/acme/autocert"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/114windd/restapi/internal/config"
+)
+
+// Server holds the TLS configuration shared by the REST and gRPC listeners
+type Server struct {
+	// Config is nil when TLS is disabled
+	Config *tls.Config
+	// Autocert is set when certificates are obtained from Let's Encrypt
+	Autocert *autocert.Manager
+}
+
+// New builds the server TLS configuration from either static cert/key files
+// or Let's Encrypt autocert
+func New(cfg config.TLSConfig) (*Server, error) {
+	switch {
+	case len(cfg.AutocertDomains) > 0:
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.AutocertDomains...),
+			Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+		}
+		return &Server{Config: manager.TLSConfig(), Autocert: manager}, nil
+
+	case cfg.CertFile != "" || cfg.KeyFile != "":
+		if cfg.CertFile == "" || cfg.KeyFile == "" {
+			return nil, errors.New("both TLS_CERT_FILE and TLS_KEY_FILE must be set")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS key pair: %w", err)
+		}
+		return &Server{Config: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}}, nil
+	}
+
+	return &Server{}, nil
+}
+
+// Enabled reports whether TLS is configured
+func (s *Server) Enabled() bool {
+	return s.Config != nil
+}
+
+// GRPCCredentials returns transport credentials for the gRPC listener. When
+// clientCAFile is set, clients must present a certificate signed by that CA.
+func (s *Server) GRPCCredentials(clientCAFile string) (credentials.TransportCredentials, error) {
+	if !s.Enabled() {
+		return nil, errors.New("TLS is not configured")
+	}
+
+	tlsConfig := s.Config.Clone()
+	// autocert advertises the ACME ALPN protocol; gRPC needs h2
+	tlsConfig.NextProtos = []string{"h2"}
+
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("client CA file contains no certificates")
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
+}
@@ -0,0 +1,148 @@
+// Package validation turns request validation failures into field-keyed
+// errors shared by the REST envelope and gRPC error details.
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError describes why one request field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Errors lists every rejected field of a request
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fe := range e {
+		messages[i] = fe.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+func init() {
+	// Report fields by their JSON names, as clients send them
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+	}
+}
+
+// Struct validates v against its binding tags, the same rules gin applies
+// to request bodies. It returns Errors when a field is invalid.
+func Struct(v interface{}) error {
+	if err := binding.Validator.ValidateStruct(v); err != nil {
+		if errs, ok := Translate(err); ok {
+			return errs
+		}
+		return err
+	}
+	return nil
+}
+
+// Translate converts validator failures and JSON type mismatches into
+// Errors. It reports false for other errors, such as malformed JSON.
+func Translate(err error) (Errors, bool) {
+	var errs Errors
+	if errors.As(err, &errs) {
+		return errs, true
+	}
+
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		errs = make(Errors, len(validationErrs))
+		for i, fe := range validationErrs {
+			errs[i] = FieldError{Field: fieldPath(fe), Rule: rule(fe), Message: message(fe)}
+		}
+		return errs, true
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return Errors{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Message: fmt.Sprintf("%s must be a %s", typeErr.Field, jsonKind(typeErr.Type)),
+		}}, true
+	}
+	return nil, false
+}
+
+// fieldPath is the field's JSON path without the request type, e.g.
+// "attributes.plan" rather than "SignupRequest.attributes.plan"
+func fieldPath(fe validator.FieldError) string {
+	path := fe.Namespace()
+	if i := strings.IndexByte(path, '.'); i >= 0 {
+		return path[i+1:]
+	}
+	return fe.Field()
+}
+
+// rule is the failed tag; for alternatives such as "e164|len=0" it is the first
+func rule(fe validator.FieldError) string {
+	return strings.SplitN(fe.Tag(), "|", 2)[0]
+}
+
+func message(fe validator.FieldError) string {
+	field := fieldPath(fe)
+	switch rule(fe) {
+	case "required":
+		return field + " is required"
+	case "email":
+		return field + " must be a valid email address"
+	case "e164":
+		return field + " must be a phone number in E.164 format, e.g. +14155550123"
+	case "url", "http_url":
+		return field + " must be a valid URL"
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("%s must be at least %s characters", field, fe.Param())
+		}
+		return fmt.Sprintf("%s must be at least %s", field, fe.Param())
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("%s must be at most %s characters", field, fe.Param())
+		}
+		return fmt.Sprintf("%s must be at most %s", field, fe.Param())
+	case "len":
+		return fmt.Sprintf("%s must be exactly %s characters", field, fe.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", field, strings.ReplaceAll(fe.Param(), " ", ", "))
+	}
+	return fmt.Sprintf("%s failed the %s rule", field, rule(fe))
+}
+
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	}
+	return "object"
+}
@@ -0,0 +1,58 @@
+// Package version describes the build of the running binary. Version,
+// Commit and BuildTime are set by the linker, see the Makefile's build
+// target:
+//
+//	go build -ldflags "-X github.com/114windd/restapi/internal/version.Version=v1.2.0 ..."
+//
+// Builds without them fall back to what the go command recorded: the module
+// version and the VCS revision and commit time.
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set with -ldflags -X at build time
+var (
+	Version   = ""
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Info identifies a build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build of the running binary. Fields that are unknown are
+// "dev" for the version and "unknown" otherwise.
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && build.Main.Version != "(devel)" {
+			info.Version = build.Main.Version
+		}
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildTime == "":
+				info.BuildTime = setting.Value
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = "unknown"
+	}
+	return info
+}
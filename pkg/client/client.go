@@ -0,0 +1,234 @@
+// Package client is a Go client for the UserService gRPC API. It wraps the
+// generated stubs with connection management, per-call timeouts, retries of
+// transient failures and bearer token injection:
+//
+//	c, err := client.New("users:50051", client.WithToken(token))
+//	if err != nil { ... }
+//	defer c.Close()
+//	resp, err := c.GetUser(ctx, &proto.GetUserRequest{Id: 42})
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"math/rand"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/114windd/restapi/pkg/proto"
+)
+
+// Defaults applied by New
+const (
+	DefaultTimeout     = 5 * time.Second
+	DefaultMaxAttempts = 3
+	DefaultBaseBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff  = 2 * time.Second
+)
+
+// TokenSource returns the bearer token to send with a call; an empty token
+// sends the call unauthenticated
+type TokenSource func(ctx context.Context) (string, error)
+
+// Client is a UserService client, with the OrganizationService on the same
+// connection in Organizations. It is safe for concurrent use.
+type Client struct {
+	proto.UserServiceClient
+	Organizations proto.OrganizationServiceClient
+	conn          *grpc.ClientConn
+}
+
+type options struct {
+	tls         *tls.Config
+	tokens      TokenSource
+	timeout     time.Duration
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	dialOptions []grpc.DialOption
+}
+
+// Option configures a Client
+type Option func(*options)
+
+// WithTLS connects over TLS with the given configuration. Without it the
+// connection is plaintext.
+func WithTLS(cfg *tls.Config) Option {
+	return func(o *options) { o.tls = cfg }
+}
+
+// WithToken sends a static bearer token with every call
+func WithToken(token string) Option {
+	return WithTokenSource(func(context.Context) (string, error) { return token, nil })
+}
+
+// WithTokenSource fetches the bearer token for each call, e.g. to refresh it
+func WithTokenSource(source TokenSource) Option {
+	return func(o *options) { o.tokens = source }
+}
+
+// WithTimeout bounds each attempt of a call whose context has no deadline.
+// Zero disables the default timeout.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) { o.timeout = d }
+}
+
+// WithRetries sets how many times a call is attempted in total and the
+// backoff between attempts. maxAttempts of 1 disables retries.
+func WithRetries(maxAttempts int, baseBackoff, maxBackoff time.Duration) Option {
+	return func(o *options) {
+		o.maxAttempts = maxAttempts
+		o.baseBackoff = baseBackoff
+		o.maxBackoff = maxBackoff
+	}
+}
+
+// WithDialOptions passes extra options to grpc.NewClient
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) { o.dialOptions = append(o.dialOptions, opts...) }
+}
+
+// New creates a client for the UserService at target (e.g. "host:50051").
+// The connection is established lazily on the first call.
+func New(target string, opts ...Option) (*Client, error) {
+	o := options{
+		timeout:     DefaultTimeout,
+		maxAttempts: DefaultMaxAttempts,
+		baseBackoff: DefaultBaseBackoff,
+		maxBackoff:  DefaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	creds := insecure.NewCredentials()
+	if o.tls != nil {
+		creds = credentials.NewTLS(o.tls)
+	}
+	dialOptions := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		// Retries run outermost so that each attempt gets its own timeout and token
+		grpc.WithChainUnaryInterceptor(o.retryInterceptor, o.timeoutInterceptor, o.authInterceptor),
+		grpc.WithChainStreamInterceptor(o.streamAuthInterceptor),
+	}, o.dialOptions...)
+
+	conn, err := grpc.NewClient(target, dialOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		UserServiceClient: proto.NewUserServiceClient(conn),
+		Organizations:     proto.NewOrganizationServiceClient(conn),
+		conn:              conn,
+	}, nil
+}
+
+// Close closes the underlying connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Conn returns the underlying connection, e.g. for health checks
+func (c *Client) Conn() *grpc.ClientConn {
+	return c.conn
+}
+
+// idempotentMethods are safe to retry even when the server may have seen the call
+var idempotentMethods = map[string]bool{
+	proto.UserService_GetUser_FullMethodName:       true,
+	proto.UserService_GetUsersByIDs_FullMethodName: true,
+	proto.UserService_ListUsers_FullMethodName:     true,
+	proto.UserService_SearchUsers_FullMethodName:   true,
+
+	proto.OrganizationService_GetOrganization_FullMethodName:   true,
+	proto.OrganizationService_ListOrganizations_FullMethodName: true,
+	proto.OrganizationService_ListMembers_FullMethodName:       true,
+}
+
+// retryable reports whether a failed call should be attempted again.
+// UNAVAILABLE usually means the call never reached the service, so any
+// method is retried; timeouts, aborts and throttling only for reads.
+func retryable(method string, err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable:
+		return true
+	case codes.DeadlineExceeded, codes.Aborted, codes.ResourceExhausted:
+		return idempotentMethods[method]
+	}
+	return false
+}
+
+func (o *options) retryInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		if err == nil || attempt >= o.maxAttempts || !retryable(method, err) || ctx.Err() != nil {
+			return err
+		}
+
+		// Full jitter: sleep a random duration up to the exponential backoff
+		backoff := o.baseBackoff << (attempt - 1)
+		if backoff > o.maxBackoff || backoff <= 0 {
+			backoff = o.maxBackoff
+		}
+		var delay time.Duration
+		if backoff > 0 {
+			delay = time.Duration(rand.Int63n(int64(backoff)))
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (o *options) timeoutInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if _, ok := ctx.Deadline(); !ok && o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+func (o *options) authInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx, err := o.withToken(ctx)
+	if err != nil {
+		return err
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// streamAuthInterceptor sends the token with streaming calls such as
+// StreamUsers, which are neither retried nor bounded by the timeout
+func (o *options) streamAuthInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	ctx, err := o.withToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return streamer(ctx, desc, cc, method, opts...)
+}
+
+// withToken adds the bearer token to the outgoing metadata of ctx
+func (o *options) withToken(ctx context.Context) (context.Context, error) {
+	if o.tokens == nil {
+		return ctx, nil
+	}
+	token, err := o.tokens(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "fetch token: %v", err)
+	}
+	if token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+	return ctx, nil
+}
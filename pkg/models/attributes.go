@@ -0,0 +1,66 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Supported custom attribute types
+const (
+	AttributeTypeString  = "string"
+	AttributeTypeNumber  = "number"
+	AttributeTypeBoolean = "boolean"
+)
+
+// AttributeDefinition describes an admin-defined custom user attribute
+type AttributeDefinition struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	Name       string    `json:"name" gorm:"uniqueIndex;not null"`
+	Type       string    `json:"type" gorm:"not null"`
+	Required   bool      `json:"required" gorm:"not null;default:false"`
+	Validation string    `json:"validation,omitempty"` // Regular expression applied to string values
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Attributes holds per-user custom attribute values, stored as JSONB
+type Attributes map[string]interface{}
+
+// Value implements driver.Valuer
+func (a Attributes) Value() (driver.Value, error) {
+	if a == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner
+func (a *Attributes) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*a = Attributes{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("attributes: unsupported scan type")
+	}
+	return json.Unmarshal(data, a)
+}
+
+// Request structs for attribute definitions
+type CreateAttributeDefinitionRequest struct {
+	Name       string `json:"name" binding:"required,alphanum"`
+	Type       string `json:"type" binding:"required,oneof=string number boolean"`
+	Required   bool   `json:"required"`
+	Validation string `json:"validation"`
+}
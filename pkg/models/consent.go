@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// ConsentTerms is the document users accept as the terms of service
+const ConsentTerms = "terms"
+
+// Consent records that a user accepted a version of a legal document
+type Consent struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	UserID     uint      `json:"user_id" gorm:"index;not null"`
+	TenantID   string    `json:"tenant_id" gorm:"not null;default:default"`
+	Document   string    `json:"document" gorm:"not null"`
+	Version    string    `json:"version" gorm:"not null"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	AcceptedAt time.Time `json:"accepted_at" gorm:"not null"`
+}
+
+// AcceptConsentRequest accepts the current version of a document
+type AcceptConsentRequest struct {
+	Document string `json:"document" binding:"omitempty,oneof=terms"` // Defaults to terms
+	Version  string `json:"version" binding:"required,max=64"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// KnownDevice is a device a user has logged in from, told apart by its
+// browser, platform and type so that logins from new devices stand out
+type KnownDevice struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	UserID     uint      `json:"user_id" gorm:"uniqueIndex:idx_known_devices_user_key;not null"`
+	Key        string    `json:"-" gorm:"uniqueIndex:idx_known_devices_user_key;not null"`
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	LastIP     string    `json:"last_ip"`
+	CreatedAt  time.Time `json:"first_seen_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
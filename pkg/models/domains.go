@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// SignupDomainPolicyID is the primary key of the single stored signup
+// domain policy
+const SignupDomainPolicyID = 1
+
+// SignupDomainPolicy is the row holding the signup email domain policy set
+// by admins. Until one is stored, the configured policy applies.
+type SignupDomainPolicy struct {
+	ID        uint       `json:"-" gorm:"primaryKey;autoIncrement:false"`
+	Allow     StringList `json:"allow" gorm:"type:jsonb;not null;default:'[]'"`
+	Deny      StringList `json:"deny" gorm:"type:jsonb;not null;default:'[]'"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func (SignupDomainPolicy) TableName() string {
+	return "signup_domain_policies"
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// ExperimentExposure records that a user was shown their variant of an
+// experiment, for later analysis
+type ExperimentExposure struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	UserID     uint      `json:"user_id" gorm:"index;not null"`
+	Experiment string    `json:"experiment" gorm:"index;not null"`
+	Variant    string    `json:"variant" gorm:"not null"`
+	CreatedAt  time.Time `json:"created_at"`
+}
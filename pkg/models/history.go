@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// UserHistory is a snapshot of a user record as it was from ValidFrom until
+// ValidTo. The current snapshot has no ValidTo.
+type UserHistory struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"index;not null"`
+	Name       string     `json:"name" gorm:"not null"`
+	Email      string     `json:"email" gorm:"not null"`
+	Role       string     `json:"role" gorm:"not null"`
+	TenantID   string     `json:"tenant_id" gorm:"not null"`
+	Attributes Attributes `json:"attributes" gorm:"type:jsonb;not null;default:'{}'"`
+	ValidFrom  time.Time  `json:"valid_from" gorm:"not null"`
+	ValidTo    *time.Time `json:"valid_to,omitempty"`
+}
+
+func (UserHistory) TableName() string {
+	return "users_history"
+}
+
+// ValidAt reports whether the snapshot describes the record at time t
+func (h *UserHistory) ValidAt(t time.Time) bool {
+	return !t.Before(h.ValidFrom) && (h.ValidTo == nil || t.Before(*h.ValidTo))
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Identity links a user to an account at an external login provider
+type Identity struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"index;not null"`
+	Provider  string    `json:"provider" gorm:"uniqueIndex:idx_identities_provider_subject;not null"`
+	Subject   string    `json:"subject" gorm:"uniqueIndex:idx_identities_provider_subject;not null"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
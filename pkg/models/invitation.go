@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Invitation states. A pending invitation past its expiry is reported as
+// expired until it is resent.
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationExpired  = "expired"
+)
+
+// Invitation is an admin's invitation for a user to join. The invited
+// account exists from the start, with status invited, and the invitee
+// activates it by choosing a password with the emailed token.
+type Invitation struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"index;not null"`
+	TenantID   string     `json:"tenant_id" gorm:"not null;default:default"`
+	Email      string     `json:"email" gorm:"not null"`
+	Status     string     `json:"status" gorm:"index;not null"`
+	InvitedBy  uint       `json:"invited_by" gorm:"not null"`
+	TokenHash  string     `json:"-" gorm:"index"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	SentCount  int        `json:"sent_count" gorm:"not null;default:1"`
+	LastSentAt time.Time  `json:"last_sent_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+type CreateInvitationRequest struct {
+	Name       string     `json:"name" binding:"required"`
+	Email      string     `json:"email" binding:"required,email"`
+	Role       string     `json:"role" binding:"omitempty,oneof=user admin"`
+	Attributes Attributes `json:"attributes"`
+}
+
+type AcceptInvitationRequest struct {
+	Password string `json:"password" binding:"required,min=6"`
+	Name     string `json:"name"` // Replaces the name the admin entered when set
+}
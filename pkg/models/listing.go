@@ -0,0 +1,66 @@
+package models
+
+import "strings"
+
+// User list fields that can be filtered and ordered on, by value kind.
+// Custom attributes are addressed as "attributes.<name>" and compare as strings.
+const (
+	ListFieldNumber = "number"
+	ListFieldString = "string"
+	ListFieldTime   = "time"
+)
+
+// UserListFields maps filterable user fields to their kind
+var UserListFields = map[string]string{
+	"id":         ListFieldNumber,
+	"name":       ListFieldString,
+	"email":      ListFieldString,
+	"role":       ListFieldString,
+	"status":     ListFieldString,
+	"created_at": ListFieldTime,
+	"updated_at": ListFieldTime,
+}
+
+// UserFilterFields are user fields that can be filtered on but not ordered
+// on, because they may be null
+var UserFilterFields = map[string]string{
+	"last_login_at": ListFieldTime,
+}
+
+// AttributeFieldPrefix addresses custom attributes in list filters
+const AttributeFieldPrefix = "attributes."
+
+// UserListFieldKind reports the kind of a list field and whether it exists
+func UserListFieldKind(field string) (string, bool) {
+	if name := strings.TrimPrefix(field, AttributeFieldPrefix); name != field {
+		return ListFieldString, name != ""
+	}
+	if kind, ok := UserListFields[field]; ok {
+		return kind, true
+	}
+	kind, ok := UserFilterFields[field]
+	return kind, ok
+}
+
+// UserFilterTerm is one comparison of a list filter, e.g. role = "admin".
+// Value is a uint, string or time.Time according to the field's kind.
+type UserFilterTerm struct {
+	Field    string
+	Operator string // one of = != < <= > >= and : (substring)
+	Value    interface{}
+}
+
+// UserCursor is the position of the last user on the previous page
+type UserCursor struct {
+	Value interface{} // the order field's value, typed like UserFilterTerm.Value
+	ID    uint
+}
+
+// UserListQuery selects one page of users, ordered by OrderBy then id
+type UserListQuery struct {
+	Filter     []UserFilterTerm
+	OrderBy    string
+	Descending bool
+	After      *UserCursor
+	Limit      int
+}
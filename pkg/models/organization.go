@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// Membership roles. Owners manage an organization and its members; members
+// can see the organization and who else belongs to it.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleMember = "member"
+)
+
+// Organization groups users into a team
+type Organization struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	TenantID  string    `json:"tenant_id" gorm:"not null;default:default"`
+	Name      string    `json:"name" gorm:"not null"`
+	CreatedBy uint      `json:"created_by" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Role is the user's role in the organization when listing their own
+	Role string `json:"role,omitempty" gorm:"->;-:migration"`
+}
+
+// Membership places a user in an organization with a role. Memberships go
+// away with their user or organization.
+type Membership struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	OrgID     uint      `json:"org_id" gorm:"not null;uniqueIndex:idx_memberships_org_user"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_memberships_org_user;index"`
+	Role      string    `json:"role" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	User         *User         `json:"user,omitempty" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Organization *Organization `json:"-" gorm:"foreignKey:OrgID;constraint:OnDelete:CASCADE"`
+}
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+type UpdateOrganizationRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+type AddMemberRequest struct {
+	UserID uint   `json:"user_id" binding:"required"`
+	Role   string `json:"role" binding:"omitempty,oneof=owner member"`
+}
+
+type UpdateMemberRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner member"`
+}
@@ -0,0 +1,20 @@
+package models
+
+// PhoneCodeRequest confirms the caller's phone number with the code texted to it
+type PhoneCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// OTPLoginRequest asks for a login code texted to a verified phone number
+type OTPLoginRequest struct {
+	Phone        string `json:"phone" binding:"required,e164"`
+	CaptchaToken string `json:"captcha_token"`
+}
+
+// OTPVerifyRequest signs in with a login code texted by OTPLoginRequest
+type OTPVerifyRequest struct {
+	Phone      string `json:"phone" binding:"required,e164"`
+	Code       string `json:"code" binding:"required"`
+	TOTPCode   string `json:"totp_code"`    // Authenticator or backup code, required when 2FA is enabled
+	StepUpCode string `json:"step_up_code"` // Emailed code confirming a login flagged as unusual
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+// Preferences holds a user's settings keyed by registered preference name,
+// stored as JSONB
+type Preferences map[string]interface{}
+
+// Value implements driver.Valuer
+func (p Preferences) Value() (driver.Value, error) {
+	return Attributes(p).Value()
+}
+
+// Scan implements sql.Scanner
+func (p *Preferences) Scan(value interface{}) error {
+	return (*Attributes)(p).Scan(value)
+}
+
+// UserPreferences is the row holding a user's stored preferences. Keys
+// left unset fall back to their registered defaults.
+type UserPreferences struct {
+	UserID      uint        `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	TenantID    string      `json:"tenant_id" gorm:"not null;default:default"`
+	Preferences Preferences `json:"preferences" gorm:"type:jsonb;not null;default:'{}'"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+func (UserPreferences) TableName() string {
+	return "user_preferences"
+}
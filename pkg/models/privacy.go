@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Data export states. An export is pending while its archive is being
+// built in the background, and expired once the archive is past its
+// retention and about to be purged.
+const (
+	ExportPending   = "pending"
+	ExportCompleted = "completed"
+	ExportFailed    = "failed"
+	ExportExpired   = "expired"
+)
+
+// DataExport is a user's request for an archive of their personal data
+type DataExport struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"user_id" gorm:"index;not null"`
+	TenantID    string     `json:"tenant_id" gorm:"not null;default:default"`
+	Status      string     `json:"status" gorm:"not null"`
+	ObjectKey   string     `json:"-"`                    // Where the archive is stored once completed
+	Error       string     `json:"error,omitempty"`      // Why the export failed
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // When the archive is deleted
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Erased replaces personal data in audit records of an erased user, which
+// are kept so the audit trail stays intact
+const Erased = "[erased]"
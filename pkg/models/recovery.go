@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+// Recovery case states. A case opens when an admin has verified the
+// identity of a user who lost access to their email, is approved once
+// enough other admins agree, and completes when credentials are reset.
+const (
+	RecoveryOpen      = "open"
+	RecoveryApproved  = "approved"
+	RecoveryRejected  = "rejected"
+	RecoveryCompleted = "completed"
+)
+
+// Recovery case audit actions
+const (
+	RecoveryActionOpened        = "opened"
+	RecoveryActionApproved      = "approved"
+	RecoveryActionRejected      = "rejected"
+	RecoveryActionReset         = "credentials_reset"
+	RecoveryActionTokenRedeemed = "token_redeemed"
+)
+
+// RecoveryCase tracks an admin-verified account recovery
+type RecoveryCase struct {
+	ID                uint       `json:"id" gorm:"primaryKey"`
+	UserID            uint       `json:"user_id" gorm:"index;not null"`
+	TenantID          string     `json:"tenant_id" gorm:"not null;default:default"`
+	Status            string     `json:"status" gorm:"index;not null"`
+	Reason            string     `json:"reason" gorm:"not null"`
+	Verification      string     `json:"verification" gorm:"not null"` // How the admin verified the user's identity
+	NewEmail          string     `json:"new_email,omitempty"`          // Address the user can be reached at now, set on reset
+	RequiredApprovals int        `json:"required_approvals" gorm:"not null"`
+	Approvals         int        `json:"approvals" gorm:"not null;default:0"`
+	OpenedBy          uint       `json:"opened_by" gorm:"not null"`
+	ResetTokenHash    string     `json:"-" gorm:"index"`
+	ResetTokenExpires *time.Time `json:"reset_token_expires_at,omitempty"`
+	CompletedAt       *time.Time `json:"completed_at,omitempty"`
+	Version           uint       `json:"version" gorm:"not null;default:1"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+
+	Events []RecoveryCaseEvent `json:"events,omitempty" gorm:"foreignKey:CaseID"`
+}
+
+// RecoveryCaseEvent is an audit log entry of a recovery case
+type RecoveryCaseEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CaseID    uint      `json:"case_id" gorm:"index;not null"`
+	ActorID   uint      `json:"actor_id"` // Zero when the user redeems their reset token
+	Action    string    `json:"action" gorm:"not null"`
+	Note      string    `json:"note,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OpenRecoveryCaseRequest struct {
+	UserID       uint   `json:"user_id" binding:"required"`
+	Reason       string `json:"reason" binding:"required"`
+	Verification string `json:"verification" binding:"required"`
+}
+
+type RecoveryDecisionRequest struct {
+	Note string `json:"note"`
+}
+
+type RecoveryResetRequest struct {
+	NewEmail string `json:"new_email" binding:"omitempty,email"`
+}
+
+type RedeemRecoveryTokenRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
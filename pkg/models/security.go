@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Security flag states
+const (
+	SecurityFlagOpen     = "open"
+	SecurityFlagResolved = "resolved"
+)
+
+// SecurityFlag marks an account for review after anomaly detection found
+// something suspicious in its authentication events, e.g. a login from the
+// other side of the world minutes after the last one
+type SecurityFlag struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"index;not null"`
+	TenantID   string     `json:"tenant_id" gorm:"index;not null;default:default"`
+	Analyzer   string     `json:"analyzer" gorm:"not null"`
+	Severity   string     `json:"severity" gorm:"not null"`
+	Reason     string     `json:"reason"`
+	IP         string     `json:"ip"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	ResolvedBy *uint      `json:"resolved_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
+// StringList is a list of strings stored as a JSONB array
+type StringList []string
+
+// Value implements driver.Valuer
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner
+func (l *StringList) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("string list: unsupported scan type")
+	}
+	return json.Unmarshal(data, l)
+}
+
+// TwoFactorCodeRequest carries an authenticator or backup code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// TwoFactorEnrollment is returned when a user starts enrolling an authenticator
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URL    string `json:"otpauth_url"` // Provisioning URI, rendered as a QR code by clients
+}
+
+// TwoFactorLoginRequest completes a provider login held for the second
+// factor, with the token the callback returned
+type TwoFactorLoginRequest struct {
+	TwoFactorToken string `json:"two_factor_token" binding:"required"`
+	TOTPCode       string `json:"totp_code" binding:"required"` // Authenticator or backup code
+}
@@ -4,29 +4,120 @@ import (
 	"time"
 )
 
+// DefaultTenant is the tenant assigned when a request carries none
+const DefaultTenant = "default"
+
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Account statuses. Suspended accounts are locked by an admin; deactivated
+// ones were closed by their owner but, unlike deleted ones, are kept and can
+// be reactivated. Neither can log in. Invited accounts were created by an
+// admin and become active once the invitee chooses a password.
+const (
+	StatusActive      = "active"
+	StatusSuspended   = "suspended"
+	StatusDeactivated = "deactivated"
+	StatusInvited     = "invited"
+)
+
 // User represents a user in the system
 type User struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	Name      string    `json:"name" gorm:"not null"`
-	Email     string    `json:"email" gorm:"uniqueIndex;not null"`
-	Password  string    `json:"-" gorm:"not null"` // "-" excludes from JSON
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	Name            string     `json:"name" gorm:"not null"`
+	Email           string     `json:"email" gorm:"uniqueIndex:idx_users_tenant_email,priority:2;not null"` // Unique within the tenant
+	Password        string     `json:"-" gorm:"not null"`                                                   // "-" excludes from JSON
+	Role            string     `json:"role" gorm:"not null;default:user"`
+	TenantID        string     `json:"tenant_id" gorm:"index;uniqueIndex:idx_users_tenant_email,priority:1;not null;default:default"`
+	Status          string     `json:"status" gorm:"index;not null;default:active"`
+	Attributes      Attributes `json:"attributes" gorm:"type:jsonb;not null;default:'{}'"`
+	Bio             string     `json:"bio,omitempty"`
+	Phone           string     `json:"phone,omitempty"`
+	PhoneVerifiedAt *time.Time `json:"phone_verified_at,omitempty"` // Cleared when the phone changes
+	Avatar          string     `json:"avatar,omitempty"`            // Image name, served at /api/v1/avatars/<avatar>
+	LastLoginAt     *time.Time `json:"last_login_at,omitempty" gorm:"index"`
+	Version         uint       `json:"version" gorm:"not null;default:1"` // Incremented on every update, served as the ETag
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+
+	// Two-factor authentication; the secret is set on enrollment but only
+	// enforced at login once the user confirms a code
+	TwoFactorEnabled bool       `json:"two_factor_enabled" gorm:"not null;default:false"`
+	TOTPSecret       string     `json:"-"`
+	BackupCodes      StringList `json:"-" gorm:"type:jsonb;not null;default:'[]'"` // SHA-256 hashes of unused backup codes
+}
+
+// ValidUserStatus reports whether status is one of the account statuses
+func ValidUserStatus(status string) bool {
+	switch status {
+	case StatusActive, StatusSuspended, StatusDeactivated, StatusInvited:
+		return true
+	}
+	return false
+}
+
+// IsActive reports whether the account may log in
+func (u *User) IsActive() bool {
+	return u.Status == "" || u.Status == StatusActive
+}
+
+// UserStats holds aggregate user statistics
+type UserStats struct {
+	TotalUsers         int64     `json:"total_users"`
+	NewUsersLast24h    int64     `json:"new_users_last_24h"`
+	ActiveUsersLast24h int64     `json:"active_users_last_24h"`
+	GeneratedAt        time.Time `json:"generated_at"`
 }
 
 // Request structs for REST API
 type SignupRequest struct {
-	Name     string `json:"name" binding:"required"`
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Name         string     `json:"name" binding:"required"`
+	Email        string     `json:"email" binding:"required,email"`
+	Password     string     `json:"password" binding:"required,min=6"`
+	Attributes   Attributes `json:"attributes"`
+	CaptchaToken string     `json:"captcha_token"`
+	TermsVersion string     `json:"terms_version"` // Accepts this version of the terms of service on signup
+	Website      string     `json:"website"`       // Honeypot: signup forms hide this field, so only bots fill it in
 }
 
 type LoginRequest struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required"`
+	Email        string `json:"email" binding:"required,email"`
+	Password     string `json:"password" binding:"required"`
+	TOTPCode     string `json:"totp_code"` // Authenticator or backup code, required when 2FA is enabled
+	CaptchaToken string `json:"captcha_token"`
+	StepUpCode   string `json:"step_up_code"` // Emailed code confirming a login flagged as unusual
+}
+
+type CheckEmailRequest struct {
+	Email        string `form:"email" binding:"required,email"`
+	CaptchaToken string `form:"captcha_token"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// BatchGetUsersRequest names users to fetch in one call
+type BatchGetUsersRequest struct {
+	IDs []uint `json:"ids" binding:"required,min=1,max=1000"`
 }
 
 type RestUpdateUserRequest struct {
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	Name       string     `json:"name"`
+	Email      string     `json:"email" binding:"omitempty,email"`
+	Bio        string     `json:"bio" binding:"max=500"`
+	Phone      string     `json:"phone" binding:"omitempty,e164"`
+	Attributes Attributes `json:"attributes"`
+}
+
+// PatchUserRequest carries a partial update; nil fields are left unchanged
+type PatchUserRequest struct {
+	Name       *string    `json:"name" binding:"omitempty,max=255"`
+	Email      *string    `json:"email" binding:"omitempty,email"`
+	Bio        *string    `json:"bio" binding:"omitempty,max=500"`
+	Phone      *string    `json:"phone" binding:"omitempty,e164|len=0"`
+	Attributes Attributes `json:"attributes"`
 }